@@ -0,0 +1,305 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const glslSandboxURL = "https://glslsandbox.com"
+
+// dialect describes how the conventions of another shader site map onto
+// Shadertoy's. Its built-in values are globals assigned before the dialect's
+// main runs, so user code may shadow them.
+type dialect struct {
+	name       string
+	globals    string   // Declarations of the built-in values
+	setup      string   // Statements in mainImage assigning them
+	uniforms   []string // Built-ins that user code may declare as uniforms
+	backbuffer string   // Name of the previous-frame sampler
+	bodyOnly   bool     // The code is the body of main
+	helpers    string   // Functions available to the code
+}
+
+var glslSandboxDialect = dialect{
+	name:    "GLSL Sandbox",
+	globals: "float time;\nvec2 mouse;\nvec2 resolution;\nvec2 surfaceSize;\nvec2 surfacePosition;\n",
+	setup: "time = iTime;\n    resolution = iResolution.xy;\n    mouse = iMouse.xy / iResolution.xy;\n" +
+		"    surfaceSize = vec2(iResolution.x / iResolution.y, 1.0);\n" +
+		"    surfacePosition = (fragCoord / iResolution.xy - 0.5) * surfaceSize;\n",
+	uniforms:   []string{"time", "mouse", "resolution", "surfaceSize", "surfacePosition", "backbuffer"},
+	backbuffer: "backbuffer",
+}
+
+var twiglClassicDialect = dialect{
+	name:       "twigl classic",
+	globals:    "float time;\nfloat frame;\nvec2 mouse;\nvec2 resolution;\n",
+	setup:      "time = iTime;\n    frame = float(iFrame);\n    resolution = iResolution.xy;\n    mouse = iMouse.xy / iResolution.xy;\n",
+	uniforms:   []string{"time", "frame", "mouse", "resolution", "backbuffer"},
+	backbuffer: "backbuffer",
+}
+
+var twiglGeekDialect = dialect{
+	name:       "twigl geek",
+	globals:    "float t;\nfloat f;\nvec2 m;\nvec2 r;\nvec4 o;\n#define FC gl_FragCoord\n",
+	setup:      "t = iTime;\n    f = float(iFrame);\n    r = iResolution.xy;\n    m = iMouse.xy / iResolution.xy;\n",
+	uniforms:   []string{"t", "f", "m", "r", "b"},
+	backbuffer: "b",
+	bodyOnly:   true,
+}
+
+// twiglHelpers are the functions the geeker and geekest modes predefine.
+const twiglHelpers = `
+mat2 rotate2D(float r) { return mat2(cos(r), sin(r), -sin(r), cos(r)); }
+mat3 rotate3D(float angle, vec3 axis) {
+    vec3 a = normalize(axis);
+    float s = sin(angle), c = cos(angle), r = 1.0 - c;
+    return mat3(a.x * a.x * r + c, a.y * a.x * r + a.z * s, a.z * a.x * r - a.y * s,
+                a.x * a.y * r - a.z * s, a.y * a.y * r + c, a.z * a.y * r + a.x * s,
+                a.x * a.z * r + a.y * s, a.y * a.z * r - a.x * s, a.z * a.z * r + c);
+}
+vec3 hsv(float h, float s, float v) {
+    vec4 t = vec4(1.0, 2.0 / 3.0, 1.0 / 3.0, 3.0);
+    vec3 p = abs(fract(vec3(h) + t.xyz) * 6.0 - vec3(t.w));
+    return v * mix(vec3(t.x), clamp(p - vec3(t.x), 0.0, 1.0), s);
+}
+vec3 twigl_mod289(vec3 x) { return x - floor(x * (1.0 / 289.0)) * 289.0; }
+vec4 twigl_mod289(vec4 x) { return x - floor(x * (1.0 / 289.0)) * 289.0; }
+vec4 twigl_permute(vec4 x) { return twigl_mod289(((x * 34.0) + 1.0) * x); }
+float snoise3D(vec3 v) {
+    const vec2 C = vec2(1.0 / 6.0, 1.0 / 3.0);
+    vec3 i = floor(v + dot(v, C.yyy));
+    vec3 x0 = v - i + dot(i, C.xxx);
+    vec3 g = step(x0.yzx, x0.xyz);
+    vec3 l = 1.0 - g;
+    vec3 i1 = min(g.xyz, l.zxy);
+    vec3 i2 = max(g.xyz, l.zxy);
+    vec3 x1 = x0 - i1 + C.xxx;
+    vec3 x2 = x0 - i2 + C.yyy;
+    vec3 x3 = x0 - 0.5;
+    i = twigl_mod289(i);
+    vec4 p = twigl_permute(twigl_permute(twigl_permute(i.z + vec4(0.0, i1.z, i2.z, 1.0)) + i.y + vec4(0.0, i1.y, i2.y, 1.0)) + i.x + vec4(0.0, i1.x, i2.x, 1.0));
+    vec4 j = p - 49.0 * floor(p / 49.0);
+    vec4 x_ = floor(j / 7.0);
+    vec4 y_ = floor(j - 7.0 * x_);
+    vec4 x = (x_ * 2.0 + 0.5) / 7.0 - 1.0;
+    vec4 y = (y_ * 2.0 + 0.5) / 7.0 - 1.0;
+    vec4 h = 1.0 - abs(x) - abs(y);
+    vec4 b0 = vec4(x.xy, y.xy);
+    vec4 b1 = vec4(x.zw, y.zw);
+    vec4 s0 = floor(b0) * 2.0 + 1.0;
+    vec4 s1 = floor(b1) * 2.0 + 1.0;
+    vec4 sh = -step(h, vec4(0.0));
+    vec4 a0 = b0.xzyw + s0.xzyw * sh.xxyy;
+    vec4 a1 = b1.xzyw + s1.xzyw * sh.zzww;
+    vec3 g0 = vec3(a0.xy, h.x);
+    vec3 g1 = vec3(a0.zw, h.y);
+    vec3 g2 = vec3(a1.xy, h.z);
+    vec3 g3 = vec3(a1.zw, h.w);
+    vec4 norm = inversesqrt(vec4(dot(g0, g0), dot(g1, g1), dot(g2, g2), dot(g3, g3)));
+    g0 *= norm.x; g1 *= norm.y; g2 *= norm.z; g3 *= norm.w;
+    vec4 m = max(0.6 - vec4(dot(x0, x0), dot(x1, x1), dot(x2, x2), dot(x3, x3)), 0.0);
+    m = m * m;
+    return 42.0 * dot(m * m, vec4(dot(g0, x0), dot(g1, x1), dot(g2, x2), dot(g3, x3)));
+}
+float snoise2D(vec2 v) { return snoise3D(vec3(v, 0.0)); }
+`
+
+var twiglModes = map[string]dialect{
+	"classic": twiglClassicDialect,
+	"geek":    twiglGeekDialect,
+	"geeker":  withHelpers(twiglGeekDialect, "twigl geeker"),
+	"geekest": withHelpers(twiglGeekDialect, "twigl geekest"),
+}
+
+func withHelpers(d dialect, name string) dialect {
+	d.name = name
+	d.helpers = twiglHelpers
+	return d
+}
+
+var (
+	directivePattern = regexp.MustCompile(`(?m)^\s*#\s*(version|extension)\b.*$`)
+	outputPattern    = regexp.MustCompile(`\bout\s+(?:(?:lowp|mediump|highp)\s+)?vec4\s+(\w+)\s*;`)
+)
+
+// shaderArgsFromDialect wraps code written for d in a Shadertoy image pass. If
+// the code reads the previous frame, it renders into buffer A, which samples
+// itself, and the image pass displays A.
+func shaderArgsFromDialect(title, code string, d dialect) *ShaderArgs {
+	code = directivePattern.ReplaceAllString(code, "")
+	for _, name := range d.uniforms {
+		declaration := regexp.MustCompile(`(?m)^\s*(?:uniform|varying)\s+(?:(?:lowp|mediump|highp)\s+)?\w+\s+` + name + `\s*;`)
+		code = declaration.ReplaceAllString(code, "")
+	}
+
+	// The result is either gl_FragColor or a declared output (GLSL ES 3.00).
+	output := "dialect_FragColor"
+	globals := d.globals
+	if d.bodyOnly {
+		output = "o"
+	} else if m := outputPattern.FindStringSubmatch(code); m != nil {
+		output = m[1]
+		code = outputPattern.ReplaceAllString(code, "vec4 $1;")
+	} else {
+		globals += "vec4 dialect_FragColor;\n"
+	}
+	code = strings.NewReplacer("gl_FragColor", output, "texture2D(", "texture(").Replace(code)
+
+	if d.bodyOnly {
+		code = "void dialect_main()\n{\n" + code + "\n}\n"
+	} else {
+		code = isfMainPattern.ReplaceAllString(code, "void dialect_main()")
+	}
+
+	// Only sampling calls are rewritten, as the geek modes name the backbuffer "b".
+	backbuffer := regexp.MustCompile(`\b(texture|textureLod|texelFetch)\s*\(\s*` + d.backbuffer + `\s*,`)
+	usesBackbuffer := backbuffer.MatchString(code)
+	code = backbuffer.ReplaceAllString(code, "$1(iChannel0,")
+
+	mainImage := fmt.Sprintf(`
+void mainImage(out vec4 fragColor, in vec2 fragCoord)
+{
+    %s    %s = vec4(0.0);
+    dialect_main();
+    fragColor = %s;
+}
+`, d.setup, output, output)
+
+	pass := &BufferRenderPass{Code: globals + d.helpers + code + mainImage}
+	args := &ShaderArgs{
+		Buffers:  map[string]*BufferRenderPass{},
+		Title:    fmt.Sprintf("%s (%s)", title, d.name),
+		Complete: true,
+	}
+	if !usesBackbuffer {
+		pass.BufferIdx = "image"
+		args.Buffers["image"] = pass
+		return args
+	}
+	pass.BufferIdx = "A"
+	pass.Inputs = []*ShadertoyChannel{bufferChannel(0, "A")}
+	args.Buffers["A"] = pass
+	args.Buffers["image"] = displayBufferPass("A")
+	return args
+}
+
+// bufferChannel returns a channel reading buffer ref.
+func bufferChannel(channel int, ref string) *ShadertoyChannel {
+	return &ShadertoyChannel{
+		CType:     "buffer",
+		Channel:   channel,
+		BufferRef: ref,
+		Sampler:   Sampler{Filter: "linear", Wrap: "clamp", VFlip: "false"},
+	}
+}
+
+// displayBufferPass returns an image pass that shows buffer ref.
+func displayBufferPass(ref string) *BufferRenderPass {
+	return &BufferRenderPass{
+		Code:      "void mainImage(out vec4 fragColor, in vec2 fragCoord) { fragColor = texture(iChannel0, fragCoord / iResolution.xy); }\n",
+		Inputs:    []*ShadertoyChannel{bufferChannel(0, ref)},
+		BufferIdx: "image",
+	}
+}
+
+// IsGLSLSandboxSource reports whether ref names a GLSL Sandbox shader: a
+// "glslsandbox:" prefixed ID or file, or a glslsandbox.com URL.
+func IsGLSLSandboxSource(ref string) bool {
+	return strings.HasPrefix(ref, "glslsandbox:") || strings.Contains(ref, "glslsandbox.com/")
+}
+
+// ShaderArgsFromGLSLSandbox loads a GLSL Sandbox shader. ref is
+// "glslsandbox:<id or file>" or a URL like https://glslsandbox.com/e#12345.0.
+func ShaderArgsFromGLSLSandbox(ref string, useCache bool) (*ShaderArgs, error) {
+	target := strings.TrimPrefix(ref, "glslsandbox:")
+	if data, err := os.ReadFile(target); err == nil {
+		return shaderArgsFromDialect(filepath.Base(target), string(data), glslSandboxDialect), nil
+	}
+
+	id := target
+	if i := strings.LastIndexAny(target, "#/"); i >= 0 {
+		id = target[i+1:]
+	}
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid GLSL Sandbox reference '%s'", ref)
+	}
+	code, err := fetchGLSLSandbox(id, useCache)
+	if err != nil {
+		return nil, err
+	}
+	return shaderArgsFromDialect("GLSL Sandbox "+id, code, glslSandboxDialect), nil
+}
+
+// fetchGLSLSandbox returns the code of a GLSL Sandbox entry, from the cache if
+// possible.
+func fetchGLSLSandbox(id string, useCache bool) (string, error) {
+	cacheDir, err := getCacheDir("shaders")
+	if err != nil {
+		return "", fmt.Errorf("could not get cache directory: %w", err)
+	}
+	cachePath := filepath.Join(cacheDir, "glslsandbox-"+id+".glsl")
+	if useCache {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			return string(data), nil
+		}
+	}
+
+	url := glslSandboxURL + "/item/" + id
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch %s, status code: %d", url, resp.StatusCode)
+	}
+	var item struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&item); err != nil {
+		return "", fmt.Errorf("invalid response from %s: %w", url, err)
+	}
+	if item.Code == "" {
+		return "", fmt.Errorf("GLSL Sandbox entry %s has no code", id)
+	}
+	if useCache {
+		os.WriteFile(cachePath, []byte(item.Code), 0644)
+	}
+	return item.Code, nil
+}
+
+// IsTwiglSource reports whether ref names a twigl shader file.
+func IsTwiglSource(ref string) bool {
+	return strings.HasPrefix(ref, "twigl:")
+}
+
+// ShaderArgsFromTwigl loads a twigl shader from "twigl:[mode:]file". The mode is
+// classic, geek, geeker or geekest, optionally with a "-300es" suffix; without
+// one, code declaring main is classic and anything else geekest.
+func ShaderArgsFromTwigl(ref string) (*ShaderArgs, error) {
+	path := strings.TrimPrefix(ref, "twigl:")
+	mode := ""
+	if i := strings.Index(path, ":"); i >= 0 {
+		if _, ok := twiglModes[strings.TrimSuffix(path[:i], "-300es")]; ok {
+			mode, path = strings.TrimSuffix(path[:i], "-300es"), path[i+1:]
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read twigl shader: %w", err)
+	}
+	code := string(data)
+	if mode == "" {
+		mode = "geekest"
+		if isfMainPattern.MatchString(code) {
+			mode = "classic"
+		}
+	}
+	return shaderArgsFromDialect(filepath.Base(path), code, twiglModes[mode]), nil
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// generatedMedia describes a stock Shadertoy texture or volume that can be
+// synthesized when it can't be downloaded.
+type generatedMedia struct {
+	name     string
+	size     int // Width and height (and depth for volumes)
+	channels int // 1 for grey, 4 for RGBA
+	kind     string
+}
+
+// Kinds of generated media.
+const (
+	whiteNoise = "noise"
+	blueNoise  = "blue noise"
+	bayer      = "Bayer matrix"
+)
+
+// stockMedia maps the file names (without extension) of Shadertoy's stock
+// noise media to equivalents.
+var stockMedia = map[string]generatedMedia{
+	"3083c722c0c738cad0f468383167a0d246f91af2bfa373e9c5c094fb8c8413e0": {"RGBA Noise Small", 64, 4, whiteNoise},
+	"0c7bf5fe9462d5bffbd11126e82908e39be3ce56220d900f633d58fb432e56f5": {"RGBA Noise Medium", 256, 4, whiteNoise},
+	"f735bee5b64ef98879dc618b016ecf7939a5756040c2cde21ccb15e69a6e1cfb": {"Gray Noise Small", 64, 1, whiteNoise},
+	"0a40562379b63dfb89227e6d172f39fdce9022cba76623f1054a2c83d6c0ba5d": {"Gray Noise Medium", 256, 1, whiteNoise},
+	"cbcbb5a6cfb55c36f8f021fbb0e3f69ac96339a39fa85cd96f2017a2192821b5": {"Blue Noise", 1024, 4, blueNoise},
+	"cb49c003b454385aa9975733aff4571c62182ccdda480aaba9a8d250014f00ec": {"Bayer", 8, 1, bayer},
+	"27012b4eadd0c3ce12498b867058e4f717ce79e10a99568cca461682d84a4b04": {"Grey Noise3D", 32, 1, whiteNoise},
+	"aea6b99da1d53055107966b59ac5444fc8bc7b3ce2d0bbb6a4a3cbae1d97f3aa": {"RGBA Noise3D", 32, 4, whiteNoise},
+}
+
+// Noise textures stand in for media that isn't stock.
+var (
+	fallbackTexture = generatedMedia{"RGBA Noise Medium", 256, 4, whiteNoise}
+	fallbackVolume  = generatedMedia{"RGBA Noise3D", 32, 4, whiteNoise}
+)
+
+// stockMediaFor returns the generated equivalent of the media at src.
+func stockMediaFor(src string, fallback generatedMedia) generatedMedia {
+	name := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	if m, ok := stockMedia[name]; ok {
+		return m
+	}
+	return fallback
+}
+
+// generatedTexture synthesizes the texture at src, or RGBA noise if it isn't
+// a stock noise texture, and returns it with a description.
+func generatedTexture(src string) (image.Image, string) {
+	m := stockMediaFor(src, fallbackTexture)
+	var pix []byte
+	switch m.kind {
+	case blueNoise:
+		pix = blueNoisePixels(m.size, m.channels)
+	case bayer:
+		pix = bayerPixels(m.size)
+	default:
+		pix = noisePixels(m.size, m.size, m.channels)
+	}
+
+	rect := image.Rect(0, 0, m.size, m.size)
+	if m.channels == 1 {
+		return &image.Gray{Pix: pix, Stride: m.size, Rect: rect}, m.name + " (" + m.kind + ")"
+	}
+	return &image.RGBA{Pix: pix, Stride: 4 * m.size, Rect: rect}, m.name + " (" + m.kind + ")"
+}
+
+// generatedVolume synthesizes the volume at src in Shadertoy's .bin format,
+// or RGBA noise if it isn't a stock noise volume, and returns it with a
+// description.
+func generatedVolume(src string) ([]byte, string) {
+	m := stockMediaFor(src, fallbackVolume)
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, [4]byte{'B', 'I', 'N', 0})
+	binary.Write(&buf, binary.LittleEndian, [3]uint32{uint32(m.size), uint32(m.size), uint32(m.size)})
+	binary.Write(&buf, binary.LittleEndian, [2]uint8{uint8(m.channels), 0})
+	binary.Write(&buf, binary.LittleEndian, uint16(0)) // 8-bit values
+	buf.Write(noisePixels(m.size, m.size*m.size, m.channels))
+	return buf.Bytes(), m.name + " (" + m.kind + ")"
+}
+
+// hash returns 8 well-mixed bits for index i of stream seed (SplitMix64).
+func hash(seed, i uint64) byte {
+	z := seed*0x9e3779b97f4a7c15 + i + 1
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return byte((z ^ (z >> 31)) >> 56)
+}
+
+// noisePixels returns width x height pixels of uniform noise. Like
+// Shadertoy's RGBA noise, green repeats red and alpha repeats blue offset by
+// (37, 17) texels, which the common single-fetch 3D noise relies on.
+func noisePixels(width, height, channels int) []byte {
+	pix := make([]byte, width*height*channels)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := (y*width + x) * channels
+			if channels == 1 {
+				pix[p] = hash(0, uint64(y*width+x))
+				continue
+			}
+			// Rows run top-down while textures are flipped, so the offset
+			// of 17 texels up is 17 rows down.
+			sx, sy := (x-37+width)%width, (y+17)%height
+			shifted := uint64(sy*width + sx)
+			pix[p] = hash(0, uint64(y*width+x))
+			pix[p+1] = hash(0, shifted)
+			pix[p+2] = hash(1, uint64(y*width+x))
+			pix[p+3] = hash(1, shifted)
+		}
+	}
+	return pix
+}
+
+// blueNoisePixels approximates blue noise: white noise with its low
+// frequencies removed by subtracting a blur, equalized back to a uniform
+// distribution.
+func blueNoisePixels(size, channels int) []byte {
+	const radius = 2
+	pix := make([]byte, size*size*channels)
+	n := size * size
+	values := make([]float32, n)
+	blurred := make([]float32, n)
+	order := make([]int, n)
+	for c := 0; c < channels; c++ {
+		for i := range values {
+			values[i] = float32(hash(uint64(c+2), uint64(i)))
+		}
+		boxBlur(blurred, values, size, radius)
+		for i := range values {
+			blurred[i] = values[i] - blurred[i]
+			order[i] = i
+		}
+		sort.Slice(order, func(a, b int) bool { return blurred[order[a]] < blurred[order[b]] })
+		for rank, i := range order {
+			pix[i*channels+c] = byte(rank * 256 / n)
+		}
+	}
+	return pix
+}
+
+// boxBlur writes to dst the average of the (2r+1)^2 texels around each texel
+// of the size x size src, wrapping at the edges.
+func boxBlur(dst, src []float32, size, r int) {
+	rows := make([]float32, len(src))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			var sum float32
+			for d := -r; d <= r; d++ {
+				sum += src[y*size+(x+d+size)%size]
+			}
+			rows[y*size+x] = sum
+		}
+	}
+	area := float32((2*r + 1) * (2*r + 1))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			var sum float32
+			for d := -r; d <= r; d++ {
+				sum += rows[((y+d+size)%size)*size+x]
+			}
+			dst[y*size+x] = sum / area
+		}
+	}
+}
+
+// bayerPixels returns the size x size ordered dithering matrix, size a power
+// of two, scaled to the full range.
+func bayerPixels(size int) []byte {
+	m := []int{0}
+	for n := 1; n < size; n *= 2 {
+		next := make([]int, 4*n*n)
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				v := 4 * m[y*n+x]
+				next[y*2*n+x] = v
+				next[y*2*n+x+n] = v + 2
+				next[(y+n)*2*n+x] = v + 3
+				next[(y+n)*2*n+x+n] = v + 1
+			}
+		}
+		m = next
+	}
+	pix := make([]byte, size*size)
+	for i, v := range m {
+		pix[i] = byte(v * 255 / (size*size - 1))
+	}
+	return pix
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	includePattern    = regexp.MustCompile(`^\s*#\s*include\s+"([^"]+)"`)
+	pragmaOncePattern = regexp.MustCompile(`^\s*#\s*pragma\s+once\b`)
+)
+
+// includeExpander expands #include "file" directives in the passes of a
+// local shader. Each expanded pass and each included file becomes a GLSL
+// source string of its own, numbered by #line directives, so compiler
+// messages refer to lines of the file they came from.
+type includeExpander struct {
+	root  string          // Directory of the shader, which file names are relative to
+	files []string        // Source string names by number; 0 is the generated code
+	once  map[string]bool // Files with #pragma once that were already included
+}
+
+func newIncludeExpander(root string) *includeExpander {
+	return &includeExpander{root: root, files: []string{""}, once: map[string]bool{}}
+}
+
+// expand returns code with its includes, read relative to dir, expanded.
+// Code without includes is returned unchanged.
+func (e *includeExpander) expand(code, name, dir string) (string, error) {
+	if !hasInclude(code) {
+		return code, nil
+	}
+	var out strings.Builder
+	if err := e.expandFile(&out, code, name, dir, nil); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// expandFile writes code, numbered as a new source string called name,
+// followed by no newline. stack holds the paths of the including files.
+func (e *includeExpander) expandFile(out *strings.Builder, code, name, dir string, stack []string) error {
+	src := len(e.files)
+	e.files = append(e.files, name)
+	fmt.Fprintf(out, "#line 1 %d\n", src)
+
+	for i, line := range strings.Split(code, "\n") {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		if pragmaOncePattern.MatchString(line) {
+			// Blank lines keep the numbering of the rest of the file.
+			continue
+		}
+		match := includePattern.FindStringSubmatch(line)
+		if match == nil {
+			out.WriteString(line)
+			continue
+		}
+
+		path, err := filepath.Abs(filepath.Join(dir, match[1]))
+		if err != nil {
+			return err
+		}
+		for _, p := range stack {
+			if p == path {
+				return fmt.Errorf("include cycle: %s", strings.Join(append(stack, path), " -> "))
+			}
+		}
+		if e.once[path] {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("%s:%d: failed to include %s: %w", name, i+1, match[1], err)
+		}
+		included := string(data)
+		if pragmaOnce(included) {
+			e.once[path] = true
+		}
+		includedName := match[1]
+		if rel, err := filepath.Rel(e.root, path); err == nil {
+			includedName = filepath.ToSlash(rel)
+		}
+		if err := e.expandFile(out, included, includedName, filepath.Dir(path), append(stack, path)); err != nil {
+			return err
+		}
+		// Resume the including file on the line after the directive.
+		fmt.Fprintf(out, "\n#line %d %d", i+2, src)
+	}
+	return nil
+}
+
+func hasInclude(code string) bool {
+	for _, line := range strings.Split(code, "\n") {
+		if includePattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func pragmaOnce(code string) bool {
+	for _, line := range strings.Split(code, "\n") {
+		if pragmaOncePattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocalShaderFile reports whether ref is a Shadertoy-format shader file
+// (".frag" or ".json") rather than a shader ID.
+func isLocalShaderFile(ref string) bool {
+	return strings.HasSuffix(ref, ".frag") || strings.HasSuffix(ref, ".json")
+}
+
+// expandIncludes expands the #include directives of every pass of a local
+// shader loaded from path. It returns the names of the source strings the
+// passes refer to in their #line directives, or nil if there were none.
+func expandIncludes(shaderData *ShadertoyResponse, path string) ([]string, error) {
+	if shaderData.Shader == nil {
+		return nil, nil
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	e := newIncludeExpander(dir)
+	// Every pass is compiled on its own, after the common code, so #pragma
+	// once holds within a pass and the common code it follows. The common
+	// pass is expanded first to know what it includes.
+	passes := shaderData.Shader.RenderPass
+	var commonOnce map[string]bool
+	for _, common := range []bool{true, false} {
+		for i := range passes {
+			pass := &passes[i]
+			if (pass.Type == "common") != common {
+				continue
+			}
+			e.once = map[string]bool{}
+			for path := range commonOnce {
+				e.once[path] = true
+			}
+			name := pass.Name
+			if strings.HasSuffix(path, ".frag") {
+				name = filepath.Base(path)
+			}
+			code, err := e.expand(pass.Code, name, dir)
+			if err != nil {
+				return nil, err
+			}
+			pass.Code = code
+			if common {
+				commonOnce = e.once
+			}
+		}
+	}
+	if len(e.files) == 1 {
+		return nil, nil
+	}
+	return e.files, nil
+}
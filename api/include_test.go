@@ -0,0 +1,56 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandIncludesPragmaOncePerPass(t *testing.T) {
+	dir := t.TempDir()
+	header := "#pragma once\nfloat helper() { return 1.0; }"
+	if err := os.WriteFile(filepath.Join(dir, "helper.glsl"), []byte(header), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	include := "#include \"helper.glsl\"\n#include \"helper.glsl\"\n"
+
+	tests := []struct {
+		name   string
+		passes []RenderPass
+		want   map[string]int // Times each pass has helper() defined
+	}{
+		{
+			name: "buffer and image",
+			passes: []RenderPass{
+				{Type: "buffer", Name: "Buffer A", Code: include},
+				{Type: "image", Name: "Image", Code: include},
+			},
+			want: map[string]int{"Buffer A": 1, "Image": 1},
+		},
+		{
+			name: "common and image",
+			passes: []RenderPass{
+				{Type: "image", Name: "Image", Code: include},
+				{Type: "buffer", Name: "Buffer A", Code: "// A"},
+				{Type: "common", Name: "Common", Code: include},
+			},
+			want: map[string]int{"Common": 1, "Image": 0, "Buffer A": 0},
+		},
+	}
+	for _, tt := range tests {
+		resp := &ShadertoyResponse{Shader: &Shader{RenderPass: tt.passes}}
+		files, err := expandIncludes(resp, filepath.Join(dir, "shader.json"))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(files) == 0 {
+			t.Errorf("%s: no source string names", tt.name)
+		}
+		for _, pass := range resp.Shader.RenderPass {
+			if got := strings.Count(pass.Code, "float helper()"); got != tt.want[pass.Name] {
+				t.Errorf("%s: %s defines helper() %d times, want %d:\n%s", tt.name, pass.Name, got, tt.want[pass.Name], pass.Code)
+			}
+		}
+	}
+}
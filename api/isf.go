@@ -0,0 +1,321 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// isfDocument is the JSON header of an ISF (Interactive Shader Format) shader.
+type isfDocument struct {
+	Credit   string            `json:"CREDIT"`
+	Inputs   []isfInput        `json:"INPUTS"`
+	Passes   []isfPass         `json:"PASSES"`
+	Imported json.RawMessage   `json:"IMPORTED"`
+	imported map[string]string // Image name -> path, from either IMPORTED layout
+}
+
+type isfInput struct {
+	Name    string          `json:"NAME"`
+	Type    string          `json:"TYPE"`
+	Default json.RawMessage `json:"DEFAULT"`
+	Min     json.RawMessage `json:"MIN"`
+}
+
+type isfPass struct {
+	Target string `json:"TARGET"`
+	Width  any    `json:"WIDTH"`
+	Height any    `json:"HEIGHT"`
+}
+
+var (
+	isfHeaderPattern = regexp.MustCompile(`(?s)^\s*/\*\s*(\{.*?\})\s*\*/`)
+	isfMainPattern   = regexp.MustCompile(`\bvoid\s+main\s*\(\s*(void)?\s*\)`)
+)
+
+// IsISFSource reports whether ref names an ISF shader file (".fs") rather than
+// a Shadertoy ID.
+func IsISFSource(ref string) bool {
+	return strings.EqualFold(filepath.Ext(ref), ".fs")
+}
+
+// ShaderArgsFromISF loads an ISF shader from a file path or http(s) URL and maps
+// it onto Shadertoy passes: PASSES with a TARGET become buffers A-D and the last
+// pass the image pass. Image inputs, imported images and targets are assigned to
+// channels, audio inputs to the microphone, and the other INPUTS become custom
+// uniforms whose defaults are returned in ShaderArgs.Uniforms.
+func ShaderArgsFromISF(ref string) (*ShaderArgs, error) {
+	source, err := readISFSource(ref)
+	if err != nil {
+		return nil, err
+	}
+	match := isfHeaderPattern.FindSubmatchIndex(source)
+	if match == nil {
+		return nil, fmt.Errorf("%s has no ISF JSON header", ref)
+	}
+	var doc isfDocument
+	if err := json.Unmarshal(source[match[2]:match[3]], &doc); err != nil {
+		return nil, fmt.Errorf("invalid ISF header in %s: %w", ref, err)
+	}
+	if err := doc.parseImported(); err != nil {
+		return nil, fmt.Errorf("invalid IMPORTED section in %s: %w", ref, err)
+	}
+	code := string(source[match[1]:])
+
+	args := &ShaderArgs{
+		Buffers:  map[string]*BufferRenderPass{},
+		Uniforms: map[string][]float32{},
+		Complete: true,
+	}
+	args.Title = strings.TrimSuffix(filepath.Base(ref), filepath.Ext(ref))
+	if doc.Credit != "" {
+		args.Title = fmt.Sprintf(`"%s" by %s`, args.Title, doc.Credit)
+		args.Author = doc.Credit
+	}
+
+	// Every pass sees the same channels, in this order: targets, image inputs,
+	// audio inputs, imported images.
+	var channels []*ShadertoyChannel
+	var defines strings.Builder
+	addChannel := func(name string, ch *ShadertoyChannel) {
+		ch.Channel = len(channels)
+		channels = append(channels, ch)
+		fmt.Fprintf(&defines, "#define %s iChannel%d\n", name, ch.Channel)
+	}
+
+	passes := doc.Passes
+	if len(passes) == 0 {
+		passes = []isfPass{{}}
+	}
+	// A target written by the last pass is displayed through an extra copy pass.
+	needsCopy := passes[len(passes)-1].Target != ""
+	bufferCount := len(passes) - 1
+	if needsCopy {
+		bufferCount++
+	}
+	if bufferCount > 4 {
+		return nil, fmt.Errorf("ISF shader has %d target passes; at most 4 are supported", bufferCount)
+	}
+	bufferNames := []string{"A", "B", "C", "D"}
+	for i, pass := range passes {
+		if pass.Width != nil || pass.Height != nil {
+			log.Printf("Warning: ISF pass %d sets WIDTH/HEIGHT, which is not supported; it renders at full resolution", i)
+		}
+		if pass.Target == "" {
+			if i < len(passes)-1 {
+				return nil, fmt.Errorf("ISF pass %d has no TARGET; only the last pass may omit it", i)
+			}
+			continue
+		}
+		addChannel(pass.Target, bufferChannel(0, bufferNames[i]))
+	}
+
+	var uniforms strings.Builder
+	for _, in := range doc.Inputs {
+		switch strings.ToLower(in.Type) {
+		case "image":
+			log.Printf("Warning: ISF image input '%s' has no source and renders black", in.Name)
+			addChannel(in.Name, &ShadertoyChannel{
+				CType:   "texture",
+				Data:    image.NewRGBA(image.Rect(0, 0, 1, 1)),
+				Sampler: Sampler{Filter: "linear", Wrap: "clamp", VFlip: "true"},
+			})
+			args.Complete = false
+		case "audio", "audiofft":
+			// The microphone texture has the spectrum in its first row and the
+			// waveform in its second, which approximates both ISF audio layouts.
+			addChannel(in.Name, &ShadertoyChannel{
+				CType:   "mic",
+				Sampler: Sampler{Filter: "linear", Wrap: "clamp", VFlip: "false"},
+			})
+		case "float":
+			fmt.Fprintf(&uniforms, "uniform float %s;\n", in.Name)
+			args.Uniforms[in.Name] = isfDefault(in, 1)
+		case "point2d":
+			fmt.Fprintf(&uniforms, "uniform vec2 %s;\n", in.Name)
+			args.Uniforms[in.Name] = isfDefault(in, 2)
+		case "color":
+			fmt.Fprintf(&uniforms, "uniform vec4 %s;\n", in.Name)
+			args.Uniforms[in.Name] = isfDefault(in, 4)
+		case "bool", "event":
+			// Adjustable uniforms are floats; the shader sees the ISF type.
+			fmt.Fprintf(&uniforms, "uniform float isf_%s;\n#define %s (isf_%s > 0.5)\n", in.Name, in.Name, in.Name)
+			args.Uniforms["isf_"+in.Name] = isfDefault(in, 1)
+		case "long":
+			fmt.Fprintf(&uniforms, "uniform float isf_%s;\n#define %s int(isf_%s)\n", in.Name, in.Name, in.Name)
+			args.Uniforms["isf_"+in.Name] = isfDefault(in, 1)
+		default:
+			log.Printf("Warning: unsupported ISF input type '%s' for '%s'", in.Type, in.Name)
+			args.Complete = false
+		}
+	}
+
+	importedNames := make([]string, 0, len(doc.imported))
+	for name := range doc.imported {
+		importedNames = append(importedNames, name)
+	}
+	sort.Strings(importedNames)
+	for _, name := range importedNames {
+		img, err := loadISFImage(ref, doc.imported[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to load imported image %s: %w", name, err)
+		}
+		addChannel(name, &ShadertoyChannel{
+			CType:   "texture",
+			Data:    img,
+			Sampler: Sampler{Filter: "mipmap", Wrap: "repeat", VFlip: "true"},
+		})
+	}
+	if len(channels) > 4 {
+		return nil, fmt.Errorf("ISF shader needs %d textures (targets, images and audio); at most 4 are supported", len(channels))
+	}
+
+	code = strings.NewReplacer("gl_FragColor", "isf_FragColor", "texture2D(", "texture(").Replace(code)
+	code = isfMainPattern.ReplaceAllString(code, "void isf_main()")
+	header := isfCompatHeader + uniforms.String() + defines.String()
+
+	for i := range passes {
+		name := "image"
+		if i < len(passes)-1 || needsCopy {
+			name = bufferNames[i]
+		}
+		args.Buffers[name] = &BufferRenderPass{
+			Code:      fmt.Sprintf("#define PASSINDEX %d\n", i) + header + code + isfMainImage,
+			Inputs:    channels,
+			BufferIdx: name,
+		}
+	}
+	if needsCopy {
+		args.Buffers["image"] = displayBufferPass(bufferNames[len(passes)-1])
+	}
+	return args, nil
+}
+
+// isfCompatHeader maps the ISF built-ins onto Shadertoy uniforms.
+const isfCompatHeader = `
+#define TIME iTime
+#define TIMEDELTA iTimeDelta
+#define RENDERSIZE iResolution.xy
+#define FRAMEINDEX iFrame
+#define DATE iDate
+#define IMG_SIZE(img) vec2(textureSize(img, 0))
+#define IMG_NORM_PIXEL(img, coord) texture(img, coord)
+#define IMG_PIXEL(img, coord) texture(img, (coord) / IMG_SIZE(img))
+#define IMG_THIS_NORM_PIXEL(img) texture(img, isf_FragNormCoord)
+#define IMG_THIS_PIXEL(img) texture(img, isf_FragNormCoord)
+vec4 isf_FragColor;
+vec2 isf_FragNormCoord;
+`
+
+// isfMainImage calls the ISF main function from the Shadertoy entry point.
+const isfMainImage = `
+void mainImage(out vec4 fragColor, in vec2 fragCoord)
+{
+    isf_FragNormCoord = fragCoord / iResolution.xy;
+    isf_FragColor = vec4(0.0);
+    isf_main();
+    fragColor = isf_FragColor;
+}
+`
+
+// isfDefault returns the DEFAULT of an input as n floats, falling back to MIN.
+// Booleans are 0 or 1.
+func isfDefault(in isfInput, n int) []float32 {
+	value := make([]float32, n)
+	raw := in.Default
+	if len(raw) == 0 {
+		raw = in.Min
+	}
+	if len(raw) == 0 {
+		return value
+	}
+	var b bool
+	if json.Unmarshal(raw, &b) == nil {
+		if b {
+			value[0] = 1
+		}
+		return value
+	}
+	var f float32
+	if json.Unmarshal(raw, &f) == nil {
+		value[0] = f
+		return value
+	}
+	var list []float32
+	if json.Unmarshal(raw, &list) == nil {
+		copy(value, list)
+	}
+	return value
+}
+
+// parseImported reads IMPORTED in either the object form {"name": {"PATH": ...}}
+// or the array form [{"NAME": ..., "PATH": ...}].
+func (d *isfDocument) parseImported() error {
+	d.imported = map[string]string{}
+	if len(d.Imported) == 0 {
+		return nil
+	}
+	type entry struct {
+		Name string `json:"NAME"`
+		Path string `json:"PATH"`
+	}
+	var byName map[string]entry
+	if err := json.Unmarshal(d.Imported, &byName); err == nil {
+		for name, e := range byName {
+			d.imported[name] = e.Path
+		}
+		return nil
+	}
+	var list []entry
+	if err := json.Unmarshal(d.Imported, &list); err != nil {
+		return err
+	}
+	for _, e := range list {
+		d.imported[e.Name] = e.Path
+	}
+	return nil
+}
+
+func isURL(ref string) bool {
+	return strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://")
+}
+
+func readISFSource(ref string) ([]byte, error) {
+	if !isURL(ref) {
+		return os.ReadFile(ref)
+	}
+	resp, err := httpClient.Get(ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", ref, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s, status code: %d", ref, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// loadISFImage loads an imported image relative to the shader's location.
+func loadISFImage(ref, path string) (image.Image, error) {
+	var data []byte
+	var err error
+	if isURL(ref) {
+		data, err = readISFSource(ref[:strings.LastIndex(ref, "/")+1] + path)
+	} else {
+		data, err = os.ReadFile(filepath.Join(filepath.Dir(ref), path))
+	}
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
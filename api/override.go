@@ -0,0 +1,270 @@
+package api
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"strings"
+)
+
+// ChannelOverride replaces or supplies an input channel of a shader's image
+// pass, e.g. to feed a local photo to a shader written for one of
+// Shadertoy's stock textures, or a webcam to one written for a video.
+type ChannelOverride struct {
+	Channel int
+	CType   string // Channel type, as in ShadertoyChannel
+	Source  string // File, URL, device or buffer name; may be empty for mic and keyboard
+	Sampler Sampler
+
+	options map[string]string // Sampler options given explicitly
+	data    image.Image       // Decoded image, loaded on first use
+	volume  *VolumeData       // Parsed volume, loaded on first use
+}
+
+// samplerOptions lists the sampler options an override may set and their
+// valid values.
+var samplerOptions = map[string][]string{
+	"filter": {"nearest", "linear", "mipmap"},
+	"wrap":   {"clamp", "repeat"},
+	"vflip":  {"true", "false"},
+	"srgb":   {"true", "false"},
+}
+
+// overrideSamplers are the samplers of each overridable channel type, as
+// Shadertoy creates them.
+var overrideSamplers = map[string]Sampler{
+	"texture":     {Filter: "mipmap", Wrap: "repeat", VFlip: "true", SRGB: "false", Internal: "byte"},
+	"video":       {Filter: "linear", Wrap: "clamp", VFlip: "true", SRGB: "false", Internal: "byte"},
+	"webcam":      {Filter: "linear", Wrap: "clamp", VFlip: "true", SRGB: "false", Internal: "byte"},
+	"mic":         {Filter: "linear", Wrap: "clamp", VFlip: "true", SRGB: "false", Internal: "byte"},
+	"spectrogram": {Filter: "linear", Wrap: "clamp", VFlip: "true", SRGB: "false", Internal: "byte"},
+	"keyboard":    {Filter: "nearest", Wrap: "clamp", VFlip: "true", SRGB: "false", Internal: "byte"},
+	"buffer":      {Filter: "linear", Wrap: "clamp", VFlip: "false", SRGB: "false", Internal: "byte"},
+	"volume":      {Filter: "mipmap", Wrap: "repeat", VFlip: "true", SRGB: "false", Internal: "byte"},
+	"data":        {Filter: "nearest", Wrap: "clamp", VFlip: "false", SRGB: "false", Internal: "float"},
+	"share":       {Filter: "linear", Wrap: "clamp", VFlip: "false", SRGB: "false", Internal: "byte"},
+}
+
+// ParseChannelOverride parses an override of channel as "type:source",
+// followed by comma-separated sampler options such as
+// "image:photo.png,filter=linear,wrap=clamp". The types are:
+//
+//	texture:FILE       a PNG or JPEG file ("image" is a synonym)
+//	video:FILE         a video file or URL, played in shader time and looped
+//	webcam[:DEV]       a capture device; the platform's first camera by default
+//	mic[:DEV]          the audio input, from a device or file if given
+//	spectrogram[:DEV]  the audio input's FFT and waveform history
+//	keyboard           the keyboard
+//	buffer:X           buffer pass X (A to D)
+//	volume:FILE        a volume texture in Shadertoy's .bin format
+//	data:SOURCE        a row of float values from csv:FILE, osc:ADDR or stdin
+//	syphon:NAME        frames of another application's Syphon server
+//
+// Channels are sampled as Shadertoy would for their type unless the options
+// say otherwise.
+func ParseChannelOverride(channel int, spec string) (*ChannelOverride, error) {
+	if channel < 0 || channel >= 4 {
+		return nil, fmt.Errorf("invalid channel %d", channel)
+	}
+	ctype, source, _ := strings.Cut(spec, ":")
+	switch ctype {
+	case "image":
+		ctype = "texture"
+	case "syphon":
+		ctype = "share"
+	}
+	sampler, ok := overrideSamplers[ctype]
+	if !ok {
+		return nil, fmt.Errorf("unknown channel type '%s'", ctype)
+	}
+	o := &ChannelOverride{Channel: channel, CType: ctype, Sampler: sampler, options: make(map[string]string)}
+
+	// Sampler options are taken from the end, so paths may contain commas.
+	for {
+		i := strings.LastIndex(source, ",")
+		if i < 0 {
+			break
+		}
+		key, value, ok := strings.Cut(source[i+1:], "=")
+		valid, known := samplerOptions[key]
+		if !ok || !known {
+			break
+		}
+		if !contains(valid, value) {
+			return nil, fmt.Errorf("invalid %s '%s' for channel %d, expected one of %s", key, value, channel, strings.Join(valid, ", "))
+		}
+		o.options[key] = value
+		setSamplerOption(&o.Sampler, key, value)
+		source = source[:i]
+	}
+	o.Source = source
+
+	switch ctype {
+	case "texture", "volume":
+		if o.Source == "" {
+			return nil, fmt.Errorf("channel %d: %s needs a file", channel, ctype)
+		}
+		if _, err := os.Stat(o.Source); err != nil {
+			return nil, fmt.Errorf("channel %d: %w", channel, err)
+		}
+	case "video":
+		if o.Source == "" {
+			return nil, fmt.Errorf("channel %d: video needs a file or URL", channel)
+		}
+		if !isURL(o.Source) {
+			if _, err := os.Stat(o.Source); err != nil {
+				return nil, fmt.Errorf("channel %d: %w", channel, err)
+			}
+		}
+	case "data":
+		kind, file, _ := strings.Cut(o.Source, ":")
+		if kind != "csv" && kind != "osc" && kind != "stdin" {
+			return nil, fmt.Errorf("channel %d: invalid data source '%s', expected csv:FILE, osc:ADDR or stdin", channel, o.Source)
+		}
+		if kind == "csv" {
+			if _, err := os.Stat(file); err != nil {
+				return nil, fmt.Errorf("channel %d: %w", channel, err)
+			}
+		}
+	case "share":
+		if o.Source == "" {
+			return nil, fmt.Errorf("channel %d: syphon needs the name of a server", channel)
+		}
+	case "keyboard":
+		if o.Source != "" {
+			return nil, fmt.Errorf("channel %d: keyboard takes no source", channel)
+		}
+	case "buffer":
+		o.Source = strings.ToUpper(o.Source)
+		if o.Source != "A" && o.Source != "B" && o.Source != "C" && o.Source != "D" {
+			return nil, fmt.Errorf("channel %d: invalid buffer '%s', expected A to D", channel, source)
+		}
+	}
+	return o, nil
+}
+
+func setSamplerOption(s *Sampler, key, value string) {
+	switch key {
+	case "filter":
+		s.Filter = value
+	case "wrap":
+		s.Wrap = value
+	case "vflip":
+		s.VFlip = value
+	case "srgb":
+		s.SRGB = value
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// samplerType returns the GLSL sampler type of a channel type.
+func samplerType(ctype string) string {
+	switch ctype {
+	case "cubemap":
+		return "samplerCube"
+	case "volume":
+		return "sampler3D"
+	}
+	return "sampler2D"
+}
+
+// load returns the channel the override supplies in place of existing, the
+// shader's own input on the channel or nil. A channel of the same type keeps
+// the shader's sampler settings, except for the options given explicitly.
+func (o *ChannelOverride) load(existing *ShadertoyChannel) (*ShadertoyChannel, error) {
+	channel := &ShadertoyChannel{CType: o.CType, Channel: o.Channel, Sampler: o.Sampler}
+	if existing != nil && existing.CType == o.CType {
+		channel.Sampler = existing.Sampler
+		for key, value := range o.options {
+			setSamplerOption(&channel.Sampler, key, value)
+		}
+	}
+
+	switch o.CType {
+	case "texture":
+		if o.data == nil {
+			f, err := os.Open(o.Source)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			o.data, _, err = image.Decode(f)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode image %s: %w", o.Source, err)
+			}
+		}
+		channel.Data = o.data
+	case "volume":
+		if o.volume == nil {
+			data, err := os.ReadFile(o.Source)
+			if err != nil {
+				return nil, err
+			}
+			o.volume, err = parseVolume(data)
+			if err != nil {
+				return nil, fmt.Errorf("invalid volume %s: %w", o.Source, err)
+			}
+		}
+		channel.Volume = o.volume
+	case "video", "webcam":
+		channel.Video = o.Source
+	case "data":
+		channel.DataSource = o.Source
+	case "share":
+		channel.Share = o.Source
+	case "buffer":
+		channel.BufferRef = o.Source
+	}
+	return channel, nil
+}
+
+// ApplyChannelOverrides replaces the image pass inputs of shaderArgs on the
+// overridden channels, adding any the pass doesn't use.
+func ApplyChannelOverrides(shaderArgs *ShaderArgs, overrides []*ChannelOverride) error {
+	pass, ok := shaderArgs.Buffers["image"]
+	if !ok {
+		return nil
+	}
+	for _, o := range overrides {
+		if o.CType == "buffer" {
+			if _, ok := shaderArgs.Buffers[o.Source]; !ok {
+				return fmt.Errorf("channel %d: shader has no buffer %s", o.Channel, o.Source)
+			}
+		}
+
+		index := -1
+		for i, input := range pass.Inputs {
+			if input != nil && input.Channel == o.Channel {
+				index = i
+				break
+			}
+		}
+		var existing *ShadertoyChannel
+		if index >= 0 {
+			existing = pass.Inputs[index]
+		}
+		channel, err := o.load(existing)
+		if err != nil {
+			return fmt.Errorf("channel %d: %w", o.Channel, err)
+		}
+
+		if existing == nil {
+			pass.Inputs = append(pass.Inputs, channel)
+			continue
+		}
+		if samplerType(existing.CType) != samplerType(channel.CType) {
+			log.Printf("Warning: channel %d changes from %s to %s, a %s; the shader may not compile", o.Channel, existing.CType, channel.CType, samplerType(channel.CType))
+		}
+		pass.Inputs[index] = channel
+	}
+	return nil
+}
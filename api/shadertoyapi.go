@@ -170,14 +170,17 @@ func rawShaderToShader(raw rawShader) *Shader {
 
 // ShadertoyChannel represents a generic input channel.
 type ShadertoyChannel struct {
-	CType     string
-	Channel   int
-	Sampler   Sampler
-	Data      image.Image    // For textures
-	Volume    *VolumeData    // For 3D volume textures
-	CubeData  [6]image.Image // For cubemaps
-	BufferRef string         // Buffer name that will be attached to this input channel
-	MusicFile string         // For audio input channels
+	CType      string
+	Channel    int
+	Sampler    Sampler
+	Data       image.Image    // For textures
+	Volume     *VolumeData    // For 3D volume textures
+	CubeData   [6]image.Image // For cubemaps
+	BufferRef  string         // Buffer name that will be attached to this input channel
+	MusicFile  string         // For audio input channels
+	Video      string         // For video and webcam channels: file, URL or capture device
+	DataSource string         // For data channels: csv:FILE, osc:ADDR or stdin
+	Share      string         // For share channels: name of a Syphon server
 }
 
 // BufferRenderPass represents a processed buffer pass.
@@ -189,13 +192,23 @@ type BufferRenderPass struct {
 }
 
 // ShaderArgs holds the final, processed arguments for a Shadertoy implementation.
+//
+// Every pass with its own code and inputs is in Buffers: "image", "sound" and
+// the buffers "A" to "D". The common pass has neither a target nor inputs; it
+// is only prepended to the others, so it is CommonCode rather than a pass, and
+// every consumer, the sound renderer included, must prepend it.
 type ShaderArgs struct {
-	// ShaderCode string
 	CommonCode string
-	// Inputs     []*ShadertoyChannel
-	Buffers  map[string]*BufferRenderPass
-	Title    string
-	Complete bool
+	Buffers    map[string]*BufferRenderPass
+	Title      string
+	Author     string // Shader author, if known
+	Source     string // Where the shader came from: its Shadertoy page, file or URL
+	Complete   bool
+	// Default values of custom uniforms, for formats that declare them (e.g. ISF inputs)
+	Uniforms map[string][]float32
+	// Names of the GLSL source strings numbered by #line directives in the code,
+	// when a local shader uses #include. Index 0 is the generated code.
+	SourceFiles []string
 }
 
 type ShaderPasses map[string]*ShaderArgs
@@ -278,6 +291,119 @@ func getCacheDir(subdir string) (string, error) {
 	return cacheDir, nil
 }
 
+// parseVolume parses a volume texture in Shadertoy's .bin format.
+func parseVolume(data []byte) (*VolumeData, error) {
+	if len(data) < 20 {
+		return nil, fmt.Errorf("too small (size: %d)", len(data))
+	}
+
+	// Parse the 20-byte header from the .bin file
+	reader := bytes.NewReader(data)
+	vol := &VolumeData{}
+
+	var signature uint32 // First 4 bytes are a signature
+	binary.Read(reader, binary.LittleEndian, &signature)
+	binary.Read(reader, binary.LittleEndian, &vol.Width)
+	binary.Read(reader, binary.LittleEndian, &vol.Height)
+	binary.Read(reader, binary.LittleEndian, &vol.Depth)
+	binary.Read(reader, binary.LittleEndian, &vol.NumChannels)
+	binary.Read(reader, binary.LittleEndian, &vol.Layout)
+	binary.Read(reader, binary.LittleEndian, &vol.Format)
+
+	// The rest of the byte slice is the raw texture data.
+	vol.Data = data[20:]
+	bytesPerValue := 1
+	if vol.Format == 10 {
+		bytesPerValue = 4
+	}
+	if size := int(vol.Width) * int(vol.Height) * int(vol.Depth) * int(vol.NumChannels) * bytesPerValue; len(vol.Data) < size {
+		return nil, fmt.Errorf("%dx%dx%d volume needs %d bytes of data, has %d", vol.Width, vol.Height, vol.Depth, size, len(vol.Data))
+	}
+	return vol, nil
+}
+
+// downloadImage loads a Shadertoy media image, from the cache if allowed.
+func downloadImage(mediaURL, cachePath string, useCache bool) (image.Image, error) {
+	var img image.Image
+
+	if useCache {
+		if f, err := os.Open(cachePath); err == nil {
+			img, _, err = image.Decode(f)
+			f.Close()
+			if err != nil {
+				log.Printf("Warning: could not decode cached image %s: %v. Redownloading...", cachePath, err)
+				// Fall through to download
+			}
+		}
+	}
+
+	if img == nil { // Not cached or cache read failed
+		resp, err := httpClient.Get(mediaURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download media %s: %w", mediaURL, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to load media %s, status code: %d", mediaURL, resp.StatusCode)
+		}
+
+		// Read into a buffer to allow both decoding and saving
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read media data from %s: %w", mediaURL, err)
+		}
+
+		img, _, err = image.Decode(strings.NewReader(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode downloaded image from %s: %w", mediaURL, err)
+		}
+
+		if useCache {
+			if err := os.WriteFile(cachePath, data, 0644); err != nil {
+				log.Printf("Warning: failed to save media to cache at %s: %v", cachePath, err)
+			}
+		}
+	}
+	return img, nil
+}
+
+// downloadVolume loads a Shadertoy volume file, from the cache if allowed.
+func downloadVolume(mediaURL, cachePath string, useCache bool) ([]byte, error) {
+	var volumeDataBytes []byte
+
+	if useCache {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			volumeDataBytes = data
+		}
+	}
+
+	if volumeDataBytes == nil { // Not cached or cache read failed
+		resp, err := httpClient.Get(mediaURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download volume %s: %w", mediaURL, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to load volume %s, status code: %d", mediaURL, resp.StatusCode)
+		}
+
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read volume data from %s: %w", mediaURL, err)
+		}
+		volumeDataBytes = data
+
+		if useCache {
+			if err := os.WriteFile(cachePath, data, 0644); err != nil {
+				log.Printf("Warning: failed to save volume to cache at %s: %v", cachePath, err)
+			}
+		}
+	}
+	return volumeDataBytes, nil
+}
+
 // downloadMediaChannels processes input descriptions, downloading textures as needed.
 func downloadMediaChannels(inputs []Input, passType string, useCache bool) ([]*ShadertoyChannel, bool, error) {
 	channels := make([]*ShadertoyChannel, 4)
@@ -299,47 +425,12 @@ func downloadMediaChannels(inputs []Input, passType string, useCache bool) ([]*S
 		case "texture":
 			mediaURL := shadertoyMediaURL + inp.Src
 			cachePath := filepath.Join(cacheDir, filepath.Base(inp.Src))
-
-			var img image.Image
-
-			if useCache {
-				if f, err := os.Open(cachePath); err == nil {
-					img, _, err = image.Decode(f)
-					f.Close()
-					if err != nil {
-						log.Printf("Warning: could not decode cached image %s: %v. Redownloading...", cachePath, err)
-						// Fall through to download
-					}
-				}
-			}
-
-			if img == nil { // Not cached or cache read failed
-				resp, err := httpClient.Get(mediaURL)
-				if err != nil {
-					return nil, false, fmt.Errorf("failed to download media %s: %w", mediaURL, err)
-				}
-				defer resp.Body.Close()
-
-				if resp.StatusCode != http.StatusOK {
-					return nil, false, fmt.Errorf("failed to load media %s, status code: %d", mediaURL, resp.StatusCode)
-				}
-
-				// Read into a buffer to allow both decoding and saving
-				data, err := io.ReadAll(resp.Body)
-				if err != nil {
-					return nil, false, fmt.Errorf("failed to read media data from %s: %w", mediaURL, err)
-				}
-
-				img, _, err = image.Decode(strings.NewReader(string(data)))
-				if err != nil {
-					return nil, false, fmt.Errorf("failed to decode downloaded image from %s: %w", mediaURL, err)
-				}
-
-				if useCache {
-					if err := os.WriteFile(cachePath, data, 0644); err != nil {
-						log.Printf("Warning: failed to save media to cache at %s: %v", cachePath, err)
-					}
-				}
+			img, err := downloadImage(mediaURL, cachePath, useCache)
+			if err != nil {
+				// Stand in for stock textures, e.g. when offline.
+				var name string
+				img, name = generatedTexture(inp.Src)
+				log.Printf("Warning: %v; using generated %s instead", err, name)
 			}
 			channel.Data = img
 
@@ -374,57 +465,17 @@ func downloadMediaChannels(inputs []Input, passType string, useCache bool) ([]*S
 		case "volume":
 			mediaURL := shadertoyMediaURL + inp.Src
 			cachePath := filepath.Join(cacheDir, filepath.Base(inp.Src))
-			var volumeDataBytes []byte
-
-			if useCache {
-				if data, err := os.ReadFile(cachePath); err == nil {
-					volumeDataBytes = data
-				}
-			}
-
-			if volumeDataBytes == nil { // Not cached or cache read failed
-				resp, err := httpClient.Get(mediaURL)
-				if err != nil {
-					return nil, false, fmt.Errorf("failed to download volume %s: %w", mediaURL, err)
-				}
-				defer resp.Body.Close()
-
-				if resp.StatusCode != http.StatusOK {
-					return nil, false, fmt.Errorf("failed to load volume %s, status code: %d", mediaURL, resp.StatusCode)
-				}
-
-				data, err := io.ReadAll(resp.Body)
-				if err != nil {
-					return nil, false, fmt.Errorf("failed to read volume data from %s: %w", mediaURL, err)
-				}
-				volumeDataBytes = data
-
-				if useCache {
-					if err := os.WriteFile(cachePath, data, 0644); err != nil {
-						log.Printf("Warning: failed to save volume to cache at %s: %v", cachePath, err)
-					}
-				}
+			volumeDataBytes, err := downloadVolume(mediaURL, cachePath, useCache)
+			if err != nil {
+				var name string
+				volumeDataBytes, name = generatedVolume(inp.Src)
+				log.Printf("Warning: %v; using generated %s instead", err, name)
 			}
 
-			if len(volumeDataBytes) < 20 {
-				return nil, false, fmt.Errorf("volume data for channel %d is too small (size: %d)", inp.Channel, len(volumeDataBytes))
+			vol, err := parseVolume(volumeDataBytes)
+			if err != nil {
+				return nil, false, fmt.Errorf("volume data for channel %d: %w", inp.Channel, err)
 			}
-
-			// Parse the 20-byte header from the .bin file
-			reader := bytes.NewReader(volumeDataBytes)
-			vol := &VolumeData{}
-
-			var signature uint32 // First 4 bytes are a signature
-			binary.Read(reader, binary.LittleEndian, &signature)
-			binary.Read(reader, binary.LittleEndian, &vol.Width)
-			binary.Read(reader, binary.LittleEndian, &vol.Height)
-			binary.Read(reader, binary.LittleEndian, &vol.Depth)
-			binary.Read(reader, binary.LittleEndian, &vol.NumChannels)
-			binary.Read(reader, binary.LittleEndian, &vol.Layout)
-			binary.Read(reader, binary.LittleEndian, &vol.Format)
-
-			// The rest of the byte slice is the raw texture data.
-			vol.Data = volumeDataBytes[20:]
 			channel.Volume = vol
 			log.Printf("Parsed Volume for Channel %d: %dx%dx%d", inp.Channel, vol.Width, vol.Height, vol.Depth)
 		case "cubemap":
@@ -471,13 +522,13 @@ func downloadMediaChannels(inputs []Input, passType string, useCache bool) ([]*S
 					}
 					data, err := io.ReadAll(resp.Body)
 					if err != nil {
-						log.Printf("Warning: failed to read media data from %s: %w", mediaURL, err)
+						log.Printf("Warning: failed to read media data from %s: %v", mediaURL, err)
 						completeDownload = false
 						continue
 					}
 					img, _, err = image.Decode(strings.NewReader(string(data)))
 					if err != nil {
-						log.Printf("Warning: failed to decode downloaded image from %s: %w", mediaURL, err)
+						log.Printf("Warning: failed to decode downloaded image from %s: %v", mediaURL, err)
 						completeDownload = false
 						continue
 					}
@@ -502,8 +553,13 @@ func downloadMediaChannels(inputs []Input, passType string, useCache bool) ([]*S
 				complete = false
 			}
 			channel.CubeData = images
-		case "mic":
+		case "mic", "spectrogram":
 			// For microphone input, we don't download anything, just create a placeholder channel.
+		case "keyboard":
+			// Keyboard state is supplied at render time.
+		case "data":
+			// Local shaders name the data source as the input's src.
+			channel.DataSource = inp.Src
 		case "music":
 			mediaURL := shadertoyMediaURL + inp.Src
 			cachePath := filepath.Join(cacheDir, filepath.Base(inp.Src))
@@ -557,6 +613,47 @@ func downloadMediaChannels(inputs []Input, passType string, useCache bool) ([]*S
 	return channels, complete, nil
 }
 
+// LoadShaderArgs loads the shader named by ref: an ISF file or URL (".fs"), a
+// GLSL Sandbox or twigl shader, or anything ShaderFromID accepts. Local .frag
+// and .json shaders may #include other files relative to their own location.
+func LoadShaderArgs(apikey string, ref string, useCache bool) (*ShaderArgs, error) {
+	args, err := loadShaderArgs(apikey, ref, useCache)
+	if err != nil {
+		return nil, err
+	}
+	if args.Source == "" {
+		args.Source = ref
+	}
+	return args, nil
+}
+
+func loadShaderArgs(apikey string, ref string, useCache bool) (*ShaderArgs, error) {
+	switch {
+	case IsISFSource(ref):
+		return ShaderArgsFromISF(ref)
+	case IsGLSLSandboxSource(ref):
+		return ShaderArgsFromGLSLSandbox(ref, useCache)
+	case IsTwiglSource(ref):
+		return ShaderArgsFromTwigl(ref)
+	}
+	shaderJSON, err := ShaderFromID(apikey, ref, useCache)
+	if err != nil {
+		return nil, err
+	}
+	var sourceFiles []string
+	if isLocalShaderFile(ref) {
+		if sourceFiles, err = expandIncludes(shaderJSON, ref); err != nil {
+			return nil, fmt.Errorf("failed to expand includes in %s: %w", ref, err)
+		}
+	}
+	args, err := ShaderArgsFromJSON(shaderJSON, useCache)
+	if err != nil {
+		return nil, err
+	}
+	args.SourceFiles = sourceFiles
+	return args, nil
+}
+
 // ShaderFromID fetches a shader's JSON data from Shadertoy.com by its ID.
 func ShaderFromID(apikey string, idOrURL string, useCache bool) (*ShadertoyResponse, error) {
 	// check if idOrURL ends with a file extension (*.json, or *.frag)
@@ -719,6 +816,19 @@ func ShaderFromID(apikey string, idOrURL string, useCache bool) (*ShadertoyRespo
 	return &shaderResp, nil
 }
 
+// passKey returns the Buffers key of a render pass with code of its own: the
+// pass type for the image and sound passes, or the buffer letter.
+func passKey(rPass RenderPass) (string, error) {
+	if rPass.Type != "buffer" {
+		return rPass.Type, nil
+	}
+	// The buffer index ('A', 'B', 'C', 'D') is usually the last character of the name.
+	if rPass.Name == "" {
+		return "", fmt.Errorf("buffer pass has no name, cannot determine index")
+	}
+	return strings.ToUpper(rPass.Name[len(rPass.Name)-1:]), nil
+}
+
 // ShaderArgsFromJSON builds the final ShaderArgs from the raw API response.
 func ShaderArgsFromJSON(shaderData *ShadertoyResponse, useCache bool) (*ShaderArgs, error) {
 	args := &ShaderArgs{
@@ -732,28 +842,15 @@ func ShaderArgsFromJSON(shaderData *ShadertoyResponse, useCache bool) (*ShaderAr
 	}
 
 	var inputsComplete bool
-	var err error
 	var bufferInputs []*ShadertoyChannel
 
 	for _, rPass := range shaderData.Shader.RenderPass {
 		switch rPass.Type {
-		case "image":
-			bufferIdx := "image" // Use a special index for the image pass
-
-			bufferInputs, inputsComplete, err = downloadMediaChannels(rPass.Inputs, rPass.Type, useCache)
+		case "image", "sound", "buffer":
+			bufferIdx, err := passKey(rPass)
 			if err != nil {
-				return nil, fmt.Errorf("error processing buffer %s inputs: %w", bufferIdx, err)
+				return nil, err
 			}
-			args.Complete = args.Complete && inputsComplete
-
-			bufferPass := &BufferRenderPass{
-				Code:      rPass.Code,
-				Inputs:    bufferInputs,
-				BufferIdx: bufferIdx,
-			}
-			args.Buffers[bufferIdx] = bufferPass
-		case "sound":
-			bufferIdx := "sound" // Use a special index for the sound pass
 
 			bufferInputs, inputsComplete, err = downloadMediaChannels(rPass.Inputs, rPass.Type, useCache)
 			if err != nil {
@@ -761,34 +858,14 @@ func ShaderArgsFromJSON(shaderData *ShadertoyResponse, useCache bool) (*ShaderAr
 			}
 			args.Complete = args.Complete && inputsComplete
 
-			bufferPass := &BufferRenderPass{
+			args.Buffers[bufferIdx] = &BufferRenderPass{
 				Code:      rPass.Code,
 				Inputs:    bufferInputs,
 				BufferIdx: bufferIdx,
+				Name:      rPass.Name,
 			}
-			args.Buffers[bufferIdx] = bufferPass
 		case "common":
 			args.CommonCode = rPass.Code
-		case "buffer":
-			// The buffer index ('A', 'B', 'C', 'D') is usually the last character of the name.
-			if rPass.Name == "" {
-				return nil, fmt.Errorf("buffer pass has no name, cannot determine index")
-			}
-			bufferIdx := strings.ToUpper(rPass.Name[len(rPass.Name)-1:])
-
-			bufferInputs, inputsComplete, err = downloadMediaChannels(rPass.Inputs, rPass.Type, useCache)
-			if err != nil {
-				return nil, fmt.Errorf("error processing buffer %s inputs: %w", bufferIdx, err)
-			}
-			args.Complete = args.Complete && inputsComplete
-
-			bufferPass := &BufferRenderPass{
-				Code:      rPass.Code,
-				Inputs:    bufferInputs,
-				BufferIdx: bufferIdx,
-			}
-			args.Buffers[bufferIdx] = bufferPass
-
 		default:
 			log.Printf("Warning: unsupported render pass type: %s", rPass.Type)
 			args.Complete = false
@@ -797,6 +874,10 @@ func ShaderArgsFromJSON(shaderData *ShadertoyResponse, useCache bool) (*ShaderAr
 
 	info := shaderData.Shader.Info
 	args.Title = fmt.Sprintf(`"%s" by %s`, info.Name, info.Username)
+	args.Author = info.Username
+	if info.ID != "" && info.ID != "localfile" {
+		args.Source = "https://www.shadertoy.com/view/" + info.ID
+	}
 
 	return args, nil
 }
@@ -0,0 +1,63 @@
+package api
+
+import "testing"
+
+func TestShaderArgsFromJSONPasses(t *testing.T) {
+	cache := t.TempDir() // downloadMediaChannels creates the media cache
+	t.Setenv("HOME", cache)
+	t.Setenv("XDG_CACHE_HOME", cache)
+
+	resp := &ShadertoyResponse{Shader: &Shader{
+		Info: ShaderInfo{ID: "XlSSzV", Name: "Test", Username: "someone"},
+		RenderPass: []RenderPass{
+			{Type: "common", Name: "Common", Code: "float f() { return 1.0; }"},
+			{Type: "buffer", Name: "Buffer A", Code: "// A"},
+			{Type: "buffer", Name: "Buf c", Code: "// C"},
+			{Type: "sound", Name: "Sound", Code: "// sound"},
+			{Type: "image", Name: "Image", Code: "// image"},
+		},
+	}}
+	args, err := ShaderArgsFromJSON(resp, true)
+	if err != nil {
+		t.Fatalf("ShaderArgsFromJSON: %v", err)
+	}
+
+	// The common code is prepended to the passes, not a pass of its own.
+	if args.CommonCode != "float f() { return 1.0; }" {
+		t.Errorf("CommonCode = %q", args.CommonCode)
+	}
+	if _, ok := args.Buffers["common"]; ok {
+		t.Error(`Buffers has a "common" pass`)
+	}
+	want := map[string]string{"A": "// A", "C": "// C", "sound": "// sound", "image": "// image"}
+	if len(args.Buffers) != len(want) {
+		t.Errorf("Buffers has %d passes, want %d", len(args.Buffers), len(want))
+	}
+	for key, code := range want {
+		pass := args.Buffers[key]
+		if pass == nil {
+			t.Errorf("Buffers[%q] is missing", key)
+			continue
+		}
+		if pass.Code != code || pass.BufferIdx != key || len(pass.Inputs) != 4 {
+			t.Errorf("Buffers[%q] = {Code: %q, BufferIdx: %q, %d inputs}, want {Code: %q, BufferIdx: %q, 4 inputs}",
+				key, pass.Code, pass.BufferIdx, len(pass.Inputs), code, key)
+		}
+	}
+	if !args.Complete {
+		t.Error("Complete = false, want true")
+	}
+	if args.Source != "https://www.shadertoy.com/view/XlSSzV" {
+		t.Errorf("Source = %q", args.Source)
+	}
+}
+
+func TestShaderArgsFromJSONUnnamedBuffer(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	resp := &ShadertoyResponse{Shader: &Shader{RenderPass: []RenderPass{{Type: "buffer"}}}}
+	if _, err := ShaderArgsFromJSON(resp, true); err == nil {
+		t.Error("ShaderArgsFromJSON accepted a buffer pass without a name")
+	}
+}
@@ -4,45 +4,43 @@
 package arcana
 
 /*
-#cgo CFLAGS: -I${SRCDIR}/../release/include/arcana
-#cgo LDFLAGS: -L${SRCDIR}/../release/lib -lavdevice_arcana -lavfilter_arcana -lavformat_arcana -lavcodec_arcana -lswscale_arcana -lswresample_arcana -lavutil_arcana -lpostproc_arcana -lx265 -lx264 -liconv -lbz2 -lz -lc++ -framework Foundation -framework AVFoundation -framework AppKit -framework CoreAudio -framework CoreFoundation -framework CoreMedia -framework CoreVideo -framework CoreImage -framework Metal -framework QuartzCore -framework VideoToolbox -framework AudioToolbox -framework Security
-
 #include <libavcodec/avcodec.h>
 #include <libavformat/avformat.h>
 #include <libavutil/avutil.h>
 #include <libavfilter/avfilter.h>
 #include <libavdevice/avdevice.h>
-#include <libpostproc/postprocess.h>
 #include <libswresample/swresample.h>
 #include <libswscale/swscale.h>
 #include <stdio.h>
 
-// A simple C log callback that prints directly to stderr.
-static void simple_log_callback(void* ptr, int level, const char* fmt, va_list vl) {
-    // To prevent FFmpeg's verbose logs from cluttering the console,
-    // we can filter to only show important messages.
-    // AV_LOG_INFO is a good balance. For more detail, use AV_LOG_DEBUG.
-    if (level > AV_LOG_DEBUG) {
+extern void goFFmpegLog(int level, char *line);
+
+// log_callback formats FFmpeg's messages, with the "[codec @ 0x...]" prefix
+// of their context, and hands them to the Go logger.
+static void log_callback(void* ptr, int level, const char* fmt, va_list vl) {
+    static int print_prefix = 1;
+    char line[1024];
+    if (level > av_log_get_level()) {
         return;
     }
-
-    // Prepend a tag to identify FFmpeg logs and print to standard error.
-    fprintf(stderr, "[FFmpeg] ");
-    vfprintf(stderr, fmt, vl);
+    av_log_format_line2(ptr, level, fmt, vl, line, sizeof(line), &print_prefix);
+    goFFmpegLog(level, line);
 }
 
 // Function to set the callback
 static void set_log_callback() {
-    av_log_set_callback(simple_log_callback);
+    av_log_set_callback(log_callback);
 }
 */
 import "C"
+import (
+	logging "github.com/richinsley/goshadertoy/logging"
+)
 
 func Platform_init() {
-	// Set the log level. AV_LOG_INFO is a good default.
-	// Use AV_LOG_DEBUG for more verbose output when needed.
-	C.av_log_set_level(C.AV_LOG_INFO)
-	// Set our simple C function as the callback
+	// Only format the messages the "ffmpeg" subsystem logs
+	C.av_log_set_level(avLogLevel(logging.MinLevel("ffmpeg")))
+	// Route FFmpeg's messages through the Go logger
 	C.set_log_callback()
 
 	// Register all available device muxers and demuxers
@@ -4,34 +4,34 @@
 package arcana
 
 /*
-#cgo CFLAGS: -I${SRCDIR}/../release/include/arcana
-#cgo LDFLAGS: -L${SRCDIR}/../release/lib -lasound
-#cgo pkg-config: --static libavutil_arcana libswresample_arcana libavcodec_arcana libavformat_arcana libswscale_arcana libavfilter_arcana libavdevice_arcana libpostproc_arcana x264 x265
-
 #include <libavcodec/avcodec.h>
 #include <libavformat/avformat.h>
 #include <libavutil/avutil.h>
 #include <libavfilter/avfilter.h>
 #include <libavdevice/avdevice.h>
-#include <libpostproc/postprocess.h>
 #include <libswresample/swresample.h>
 #include <libswscale/swscale.h>
 #include <stdio.h>
 #include <alsa/asoundlib.h>
 
 
-// A simple C log callback that prints directly to stderr.
-static void simple_log_callback(void* ptr, int level, const char* fmt, va_list vl) {
-    if (level > AV_LOG_DEBUG) {
+extern void goFFmpegLog(int level, char *line);
+
+// log_callback formats FFmpeg's messages, with the "[codec @ 0x...]" prefix
+// of their context, and hands them to the Go logger.
+static void log_callback(void* ptr, int level, const char* fmt, va_list vl) {
+    static int print_prefix = 1;
+    char line[1024];
+    if (level > av_log_get_level()) {
         return;
     }
-    fprintf(stderr, "[FFmpeg] ");
-    vfprintf(stderr, fmt, vl);
+    av_log_format_line2(ptr, level, fmt, vl, line, sizeof(line), &print_prefix);
+    goFFmpegLog(level, line);
 }
 
 // Function to set the callback
 static void set_log_callback() {
-    av_log_set_callback(simple_log_callback);
+    av_log_set_callback(log_callback);
 }
 
 // Helper to convert FFmpeg AVSampleFormat to ALSA snd_pcm_format_t
@@ -49,10 +49,12 @@ import (
 	"fmt"
 	"log"
 	"unsafe"
+
+	logging "github.com/richinsley/goshadertoy/logging"
 )
 
 func Platform_init() {
-	C.av_log_set_level(C.AV_LOG_INFO)
+	C.av_log_set_level(avLogLevel(logging.MinLevel("ffmpeg")))
 	C.set_log_callback()
 	C.avdevice_register_all()
 }
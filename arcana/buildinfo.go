@@ -0,0 +1,31 @@
+//go:build (linux || darwin) && cgo
+
+package arcana
+
+/*
+#include <libavcodec/avcodec.h>
+#include <libavformat/avformat.h>
+#include <libavutil/avutil.h>
+#include <libavfilter/avfilter.h>
+*/
+import "C"
+import (
+	"fmt"
+	"strings"
+)
+
+// BuildInfo describes the FFmpeg libraries linked in: their version, library
+// versions and configure flags.
+func BuildInfo() string {
+	version := func(v C.unsigned) string {
+		return fmt.Sprintf("%d.%d.%d", v>>16, (v>>8)&0xff, v&0xff)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "FFmpeg %s (%s)\n", C.GoString(C.av_version_info()), Linkage)
+	fmt.Fprintf(&b, "libavutil %s\n", version(C.avutil_version()))
+	fmt.Fprintf(&b, "libavcodec %s\n", version(C.avcodec_version()))
+	fmt.Fprintf(&b, "libavformat %s\n", version(C.avformat_version()))
+	fmt.Fprintf(&b, "libavfilter %s\n", version(C.avfilter_version()))
+	fmt.Fprintf(&b, "configuration: %s\n", C.GoString(C.avutil_configuration()))
+	return b.String()
+}
@@ -0,0 +1,71 @@
+//go:build (linux || darwin) && cgo
+
+package arcana
+
+/*
+#include <libavutil/log.h>
+*/
+import "C"
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+
+	logging "github.com/richinsley/goshadertoy/logging"
+)
+
+var ffmpegLog = struct {
+	sync.Mutex
+	logger  *slog.Logger
+	partial strings.Builder // Start of a line FFmpeg logged in pieces
+}{logger: logging.Logger("ffmpeg")}
+
+// avLogLevel returns the FFmpeg log level that logs what level does.
+func avLogLevel(level slog.Level) C.int {
+	switch {
+	case level >= logging.LevelQuiet:
+		return C.AV_LOG_QUIET
+	case level >= slog.LevelError:
+		return C.AV_LOG_ERROR
+	case level >= slog.LevelWarn:
+		return C.AV_LOG_WARNING
+	case level >= slog.LevelInfo:
+		return C.AV_LOG_INFO
+	}
+	return C.AV_LOG_DEBUG
+}
+
+// slogLevel returns the level an FFmpeg message of level is logged at.
+func slogLevel(level C.int) slog.Level {
+	switch {
+	case level <= C.AV_LOG_ERROR:
+		return slog.LevelError
+	case level <= C.AV_LOG_WARNING:
+		return slog.LevelWarn
+	case level <= C.AV_LOG_INFO:
+		return slog.LevelInfo
+	}
+	return slog.LevelDebug
+}
+
+// goFFmpegLog logs a message from FFmpeg's log callback, which may be called
+// from any of its threads. FFmpeg builds some lines from several messages,
+// so the text is only logged once a line is complete.
+//
+//export goFFmpegLog
+func goFFmpegLog(level C.int, line *C.char) {
+	text := C.GoString(line)
+	l := &ffmpegLog
+	l.Lock()
+	defer l.Unlock()
+	l.partial.WriteString(text)
+	if !strings.HasSuffix(text, "\n") && !strings.HasSuffix(text, "\r") {
+		return
+	}
+	msg := strings.TrimRight(l.partial.String(), "\r\n")
+	l.partial.Reset()
+	if strings.TrimSpace(msg) != "" {
+		l.logger.Log(context.Background(), slogLevel(level), "[FFmpeg] "+msg)
+	}
+}
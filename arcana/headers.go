@@ -0,0 +1,11 @@
+//go:build (linux || darwin) && cgo && !systemffmpeg
+
+package arcana
+
+// Compiles against the ffmpeg-arcana headers in release/. With systemffmpeg
+// the system's headers are used instead, matching the libraries linked.
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../release/include/arcana
+*/
+import "C"
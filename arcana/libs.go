@@ -1,3 +1,6 @@
+// Package arcana sets up the FFmpeg libraries: ffmpeg-arcana linked
+// statically from release/, or the system's with the systemffmpeg build tag.
+// Only Linux and macOS are supported; there is no Windows build.
 package arcana
 
 func Init() {
@@ -0,0 +1,13 @@
+//go:build darwin && cgo && !systemffmpeg
+
+package arcana
+
+// Links the static ffmpeg-arcana build in release/.
+
+/*
+#cgo LDFLAGS: -L${SRCDIR}/../release/lib -lavdevice_arcana -lavfilter_arcana -lavformat_arcana -lavcodec_arcana -lswscale_arcana -lswresample_arcana -lavutil_arcana -lpostproc_arcana -lx265 -lx264 -liconv -lbz2 -lz -lc++ -framework Foundation -framework AVFoundation -framework AppKit -framework CoreAudio -framework CoreFoundation -framework CoreMedia -framework CoreVideo -framework CoreImage -framework Metal -framework QuartzCore -framework VideoToolbox -framework AudioToolbox -framework Security
+*/
+import "C"
+
+// Linkage describes how FFmpeg is linked in.
+const Linkage = "ffmpeg-arcana, static"
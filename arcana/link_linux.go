@@ -0,0 +1,15 @@
+//go:build linux && cgo && !systemffmpeg
+
+package arcana
+
+// Links the static ffmpeg-arcana build in release/, found through
+// PKG_CONFIG_PATH=release/lib/pkgconfig.
+
+/*
+#cgo LDFLAGS: -L${SRCDIR}/../release/lib -lasound
+#cgo pkg-config: --static libavutil_arcana libswresample_arcana libavcodec_arcana libavformat_arcana libswscale_arcana libavfilter_arcana libavdevice_arcana libpostproc_arcana x264 x265
+*/
+import "C"
+
+// Linkage describes how FFmpeg is linked in.
+const Linkage = "ffmpeg-arcana, static"
@@ -0,0 +1,26 @@
+//go:build (linux || darwin) && cgo && systemffmpeg
+
+package arcana
+
+// Links the system's shared FFmpeg libraries (e.g. the libavcodec-dev family
+// of packages, or Homebrew's ffmpeg) instead of ffmpeg-arcana, for building
+// without the release/ tree:
+//
+//	go build -tags systemffmpeg ./cmd
+//
+// The system's headers are used too, so a release/ tree alongside is ignored.
+// Encoders missing from the system build, such as libx265 or nvenc on many
+// distributions, are skipped when picking one (see -list-encoders), and
+// FFmpeg 7.1 or later is needed.
+//
+// Windows is unsupported either way: arcana and the packages built on it
+// only have Linux and macOS implementations.
+
+/*
+#cgo pkg-config: libavutil libswresample libavcodec libavformat libswscale libavfilter libavdevice
+#cgo linux pkg-config: alsa
+*/
+import "C"
+
+// Linkage describes how FFmpeg is linked in.
+const Linkage = "system, shared"
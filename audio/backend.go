@@ -0,0 +1,102 @@
+package audio
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// AudioDeviceInfo describes a capture source or playback sink reported by FFmpeg.
+type AudioDeviceInfo struct {
+	Name        string
+	Description string
+	IsDefault   bool
+}
+
+// audioBackend describes the FFmpeg device formats used for capture and playback.
+type audioBackend struct {
+	inputFormat  string // FFmpeg input (demuxer) device, empty if capture is unsupported
+	outputFormat string // FFmpeg output (muxer) device, empty if playback is unsupported
+}
+
+// audioBackends lists the backends available per platform. PipeWire is reached
+// through its PulseAudio compatibility server (pipewire-pulse) or its JACK API.
+var audioBackends = map[string]map[string]audioBackend{
+	"linux": {
+		"alsa":  {inputFormat: "alsa", outputFormat: "alsa"},
+		"pulse": {inputFormat: "pulse", outputFormat: "pulse"},
+		"jack":  {inputFormat: "jack"},
+	},
+	"darwin": {
+		"avfoundation": {inputFormat: "avfoundation", outputFormat: "audiotoolbox"},
+	},
+	"windows": {
+		"dshow": {inputFormat: "dshow", outputFormat: "dshow"},
+	},
+}
+
+// defaultAudioBackend is the backend used when none is requested.
+var defaultAudioBackend = map[string]string{
+	"linux":   "alsa",
+	"darwin":  "avfoundation",
+	"windows": "dshow",
+}
+
+// resolveAudioBackend returns the backend for the given name, substituting the
+// platform default for an empty name.
+func resolveAudioBackend(name string) (string, audioBackend, error) {
+	if name == "" {
+		name = defaultAudioBackend[runtime.GOOS]
+	}
+	backend, ok := audioBackends[runtime.GOOS][name]
+	if !ok {
+		return "", audioBackend{}, fmt.Errorf("audio backend '%s' is not supported on %s", name, runtime.GOOS)
+	}
+	return name, backend, nil
+}
+
+// ValidateAudioBackend checks that the named backend exists on this platform.
+func ValidateAudioBackend(name string) error {
+	_, _, err := resolveAudioBackend(name)
+	return err
+}
+
+// inputFormatForBackend returns the FFmpeg capture device format for a backend.
+func inputFormatForBackend(name string) (string, error) {
+	name, backend, err := resolveAudioBackend(name)
+	if err != nil {
+		return "", err
+	}
+	if backend.inputFormat == "" {
+		return "", fmt.Errorf("audio backend '%s' does not support capture", name)
+	}
+	return backend.inputFormat, nil
+}
+
+// outputFormatForBackend returns the FFmpeg playback device format for a backend.
+func outputFormatForBackend(name string) (string, error) {
+	name, backend, err := resolveAudioBackend(name)
+	if err != nil {
+		return "", err
+	}
+	if backend.outputFormat == "" {
+		return "", fmt.Errorf("audio backend '%s' does not support playback", name)
+	}
+	return backend.outputFormat, nil
+}
+
+// DefaultOutputDevice returns the device string that selects the system's default
+// playback device for a backend, or an error if the backend cannot play audio.
+func DefaultOutputDevice(backend string) (string, error) {
+	format, err := outputFormatForBackend(backend)
+	if err != nil {
+		return "", err
+	}
+	switch format {
+	case "dshow":
+		return "", fmt.Errorf("FFmpeg has no DirectShow playback device; pass -audio-output-device explicitly")
+	default:
+		// alsa and pulse both understand "default"; audiotoolbox ignores the URL
+		// and opens the default output unless an index is given.
+		return "default", nil
+	}
+}
@@ -24,6 +24,15 @@ func (d *audioBaseDevice) GetBuffer() *SharedAudioBuffer {
 	return d.buffer
 }
 
+// startMonitor watches the buffer for underruns and overruns while ctx lasts,
+// when something reads it in real time: a player, or the encoder of a stream.
+func (d *audioBaseDevice) startMonitor(ctx context.Context) {
+	if d.player == nil && d.mode != "stream" {
+		return
+	}
+	go monitorBuffer(ctx, d.buffer, d.sampleRate, time.Duration(*d.options.AudioStats*float64(time.Second)))
+}
+
 func (d *audioBaseDevice) SampleRate() int {
 	return d.sampleRate
 }
@@ -0,0 +1,91 @@
+package audio
+
+/*
+#include <libavformat/avformat.h>
+#include <libavdevice/avdevice.h>
+#include <string.h>
+
+static const AVOutputFormat* find_output_device_format(const char* name) {
+    const AVOutputFormat *fmt = NULL;
+    void *opaque = NULL;
+    while ((fmt = av_muxer_iterate(&opaque))) {
+        if (strcmp(fmt->name, name) == 0) {
+            return fmt;
+        }
+    }
+    return NULL;
+}
+
+static AVDeviceInfo* device_at(AVDeviceInfoList* list, int i) {
+    return list->devices[i];
+}
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// ListAudioDevices enumerates the capture sources and playback sinks of the given
+// backend. Not every FFmpeg device implements enumeration; in that case an error
+// is returned for that direction.
+func ListAudioDevices(backend string) (sources []AudioDeviceInfo, sinks []AudioDeviceInfo, sourceErr error, sinkErr error) {
+	if inputFormat, err := inputFormatForBackend(backend); err != nil {
+		sourceErr = err
+	} else {
+		sources, sourceErr = listInputSources(inputFormat)
+	}
+	if outputFormat, err := outputFormatForBackend(backend); err != nil {
+		sinkErr = err
+	} else {
+		sinks, sinkErr = listOutputSinks(outputFormat)
+	}
+	return sources, sinks, sourceErr, sinkErr
+}
+
+func listInputSources(format string) ([]AudioDeviceInfo, error) {
+	cFormat := C.CString(format)
+	defer C.free(unsafe.Pointer(cFormat))
+	inputFormat := C.av_find_input_format(cFormat)
+	if inputFormat == nil {
+		return nil, fmt.Errorf("FFmpeg input device '%s' is not available in this build", format)
+	}
+
+	var list *C.AVDeviceInfoList
+	ret := C.avdevice_list_input_sources(inputFormat, nil, nil, &list)
+	if ret < 0 {
+		return nil, fmt.Errorf("FFmpeg input device '%s' cannot enumerate sources (error %d)", format, int(ret))
+	}
+	defer C.avdevice_free_list_devices(&list)
+	return convertDeviceList(list), nil
+}
+
+func listOutputSinks(format string) ([]AudioDeviceInfo, error) {
+	cFormat := C.CString(format)
+	defer C.free(unsafe.Pointer(cFormat))
+	outputFormat := C.find_output_device_format(cFormat)
+	if outputFormat == nil {
+		return nil, fmt.Errorf("FFmpeg output device '%s' is not available in this build", format)
+	}
+
+	var list *C.AVDeviceInfoList
+	ret := C.avdevice_list_output_sinks(outputFormat, nil, nil, &list)
+	if ret < 0 {
+		return nil, fmt.Errorf("FFmpeg output device '%s' cannot enumerate sinks (error %d)", format, int(ret))
+	}
+	defer C.avdevice_free_list_devices(&list)
+	return convertDeviceList(list), nil
+}
+
+func convertDeviceList(list *C.AVDeviceInfoList) []AudioDeviceInfo {
+	devices := make([]AudioDeviceInfo, 0, int(list.nb_devices))
+	for i := 0; i < int(list.nb_devices); i++ {
+		dev := C.device_at(list, C.int(i))
+		devices = append(devices, AudioDeviceInfo{
+			Name:        C.GoString(dev.device_name),
+			Description: C.GoString(dev.device_description),
+			IsDefault:   i == int(list.default_device),
+		})
+	}
+	return devices
+}
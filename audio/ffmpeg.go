@@ -1,7 +1,12 @@
+//go:build cgo
+
 // audio/ffmpeg.go
 package audio
 
 import (
+	"log"
+
+	audiodecode "github.com/richinsley/goshadertoy/audiodecode"
 	options "github.com/richinsley/goshadertoy/options"
 )
 
@@ -9,19 +14,54 @@ import (
 // based on the provided options. It will return a device for file input, live device input,
 // or a null device if no audio input is specified.
 func NewFFmpegAudioDevice(options *options.ShaderOptions) (AudioDevice, error) {
-	buffer := NewSharedAudioBuffer(44100 * 5) // 5-second buffer
+	// The decoder is the only writer. The lock-free buffer allows only one
+	// reader, so it's used unless both the encoder and a player read.
+	var buffer *SharedAudioBuffer
+	if encoderAndPlayerRead(options) {
+		buffer = NewSharedAudioBuffer(*options.AudioSampleRate * 5) // 5-second buffer
+	} else {
+		buffer = NewSPSCAudioBuffer(*options.AudioSampleRate * 5)
+	}
+	return newFFmpegAudioDevice(options, buffer)
+}
+
+// encoderAndPlayerRead reports whether the options have both the offscreen
+// renderer of record and stream mode and an audio player read the buffer.
+func encoderAndPlayerRead(options *options.ShaderOptions) bool {
+	if *options.AudioOutputDevice == "" {
+		return false
+	}
+	return *options.Mode == "record" || *options.Mode == "stream"
+}
 
+// newFFmpegAudioDevice creates the device for the options' audio input,
+// writing to buffer.
+func newFFmpegAudioDevice(options *options.ShaderOptions, buffer *SharedAudioBuffer) (AudioDevice, error) {
 	if options.AudioInputDevice != nil && *options.AudioInputDevice != "" {
 		// User wants to capture from a live device.
 		return NewFFmpegDeviceInput(options, buffer)
 	}
 
 	if options.AudioInputFile != nil && *options.AudioInputFile != "" {
-		// User wants to read from a file.
-		return NewFFmpegFileInput(options, buffer)
+		// User wants to read from a file. It's probed once, here: formats
+		// the linked FFmpeg lacks a demuxer or decoder for fall back to the
+		// Go decoders, and otherwise Start decodes what was opened.
+		d, err := NewFFmpegFileInput(options, buffer)
+		if err != nil {
+			return nil, err
+		}
+		path := *options.AudioInputFile
+		if err := d.open(path, "", nil); err != nil {
+			if !audiodecode.Supports(path) {
+				return nil, err
+			}
+			log.Printf("Warning: FFmpeg can't decode %s (%v); using the built-in decoder.", path, err)
+			return NewGoFileInput(options, buffer)
+		}
+		return d, nil
 	}
 
 	// If no specific audio input is given, we can default to a silent NullDevice.
 	// This prevents errors when the user runs the program without audio flags.
-	return NewNullDevice(44100), nil
+	return NewNullDeviceWithBuffer(*options.AudioSampleRate, buffer), nil
 }
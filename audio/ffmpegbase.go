@@ -10,7 +10,6 @@ import (
 )
 
 /*
-#cgo CFLAGS: -I${SRCDIR}/../release/include -I${SRCDIR}/../release/include/arcana
 #include <libavformat/avformat.h>
 #include <libavcodec/avcodec.h>
 #include <libavutil/opt.h>
@@ -42,14 +41,84 @@ type ffmpegBaseDevice struct {
 	outChLayout     C.AVChannelLayout
 	isStreaming     bool
 	decodeLock      sync.Mutex // To protect decoding resources in passive mode
+	gain            float32    // Linear gain applied to resampled samples
+	gainBuffer      []float32  // Reused for the samples with gain applied
 }
 
-// init initializes the FFmpeg libraries and sets up the decoding pipeline.
+// init initializes the FFmpeg libraries and sets up the decoding pipeline,
+// opening input unless a probe already has.
 func (d *ffmpegBaseDevice) init(input, format, channelLayout string, enableRateEmulation bool, inputOptions map[string]string) error {
 	d.mode = *d.options.Mode
 	d.enableRateEmulation = enableRateEmulation
 
-	// Open Input
+	if d.formatCtx == nil {
+		if err := d.open(input, format, inputOptions); err != nil {
+			return err
+		}
+	}
+	decoder := C.avcodec_find_decoder(d.audioStream.codecpar.codec_id)
+
+	d.codecCtx = C.avcodec_alloc_context3(decoder)
+	if d.codecCtx == nil {
+		d.cleanup()
+		return fmt.Errorf("failed to allocate codec context")
+	}
+
+	if C.avcodec_parameters_to_context(d.codecCtx, d.audioStream.codecpar) < 0 {
+		d.cleanup()
+		return fmt.Errorf("failed to copy codec parameters to context")
+	}
+
+	if C.avcodec_open2(d.codecCtx, decoder, nil) < 0 {
+		d.cleanup()
+		return fmt.Errorf("failed to open codec")
+	}
+
+	// Setup Resampler. Everything downstream runs at the configured pipeline rate.
+	d.sampleRate = *d.options.AudioSampleRate
+	if int(d.codecCtx.sample_rate) != d.sampleRate {
+		log.Printf("Resampling audio input from %d Hz to %d Hz.", int(d.codecCtx.sample_rate), d.sampleRate)
+	}
+
+	cLayoutStr := C.CString(channelLayout) // Use the passed-in channel layout
+	defer C.free(unsafe.Pointer(cLayoutStr))
+	if C.get_ch_layout_from_string(&d.outChLayout, cLayoutStr) != 0 {
+		d.cleanup()
+		return fmt.Errorf("invalid output channel layout: %s", channelLayout)
+	}
+
+	ret := C.swr_alloc_set_opts2(&d.swrCtx,
+		&d.outChLayout, C.AV_SAMPLE_FMT_FLT, C.int(d.sampleRate),
+		&d.codecCtx.ch_layout, d.codecCtx.sample_fmt, d.codecCtx.sample_rate, 0, nil)
+
+	if ret < 0 {
+		d.cleanup()
+		return fmt.Errorf("failed to allocate resampler context")
+	}
+
+	// Route the requested input channels to the output through a custom rematrix.
+	if err := d.applyChannelMap(); err != nil {
+		d.cleanup()
+		return err
+	}
+
+	if C.swr_init(d.swrCtx) < 0 {
+		d.cleanup()
+		return fmt.Errorf("failed to initialize resampler context")
+	}
+
+	d.gain = 1.0
+	if d.options.AudioGain != nil && *d.options.AudioGain != 0 {
+		d.gain = float32(DecibelsToGain(*d.options.AudioGain))
+		log.Printf("Applying %.1f dB input gain (x%.3f).", *d.options.AudioGain, d.gain)
+	}
+
+	return nil
+}
+
+// open opens input and finds its audio stream and a decoder for it, probing
+// what the linked FFmpeg can decode.
+func (d *ffmpegBaseDevice) open(input, format string, inputOptions map[string]string) error {
 	cInput := C.CString(input)
 	defer C.free(unsafe.Pointer(cInput))
 
@@ -95,48 +164,43 @@ func (d *ffmpegBaseDevice) init(input, format, channelLayout string, enableRateE
 		return fmt.Errorf("could not find audio stream")
 	}
 
-	decoder := C.avcodec_find_decoder(d.audioStream.codecpar.codec_id)
-	if decoder == nil {
+	if C.avcodec_find_decoder(d.audioStream.codecpar.codec_id) == nil {
 		d.cleanup()
 		return fmt.Errorf("unsupported codec")
 	}
+	return nil
+}
 
-	d.codecCtx = C.avcodec_alloc_context3(decoder)
-	if d.codecCtx == nil {
-		d.cleanup()
-		return fmt.Errorf("failed to allocate codec context")
+// applyChannelMap installs a rematrix on the resampler that feeds each output
+// channel from a single, user-selected input channel.
+func (d *ffmpegBaseDevice) applyChannelMap() error {
+	if d.options.AudioChannelMap == nil || *d.options.AudioChannelMap == "" {
+		return nil
 	}
-
-	if C.avcodec_parameters_to_context(d.codecCtx, d.audioStream.codecpar) < 0 {
-		d.cleanup()
-		return fmt.Errorf("failed to copy codec parameters to context")
+	channelMap, err := ParseChannelMap(*d.options.AudioChannelMap)
+	if err != nil {
+		return err
 	}
 
-	if C.avcodec_open2(d.codecCtx, decoder, nil) < 0 {
-		d.cleanup()
-		return fmt.Errorf("failed to open codec")
+	inChannels := int(d.codecCtx.ch_layout.nb_channels)
+	outChannels := int(d.outChLayout.nb_channels)
+	for _, ch := range channelMap {
+		if ch >= inChannels {
+			return fmt.Errorf("audio channel map selects input channel %d, but the input only has %d channels", ch+1, inChannels)
+		}
 	}
 
-	// Setup Resampler
-	d.sampleRate = int(d.codecCtx.sample_rate)
-
-	cLayoutStr := C.CString(channelLayout) // Use the passed-in channel layout
-	defer C.free(unsafe.Pointer(cLayoutStr))
-	if C.get_ch_layout_from_string(&d.outChLayout, cLayoutStr) != 0 {
-		d.cleanup()
-		return fmt.Errorf("invalid output channel layout: %s", channelLayout)
+	// A single mapped channel is duplicated to every output channel.
+	matrix := make([]C.double, outChannels*inChannels)
+	for out := 0; out < outChannels; out++ {
+		in := channelMap[min(out, len(channelMap)-1)]
+		matrix[out*inChannels+in] = 1.0
 	}
 
-	ret := C.swr_alloc_set_opts2(&d.swrCtx,
-		&d.outChLayout, C.AV_SAMPLE_FMT_FLT, C.int(d.sampleRate),
-		&d.codecCtx.ch_layout, d.codecCtx.sample_fmt, d.codecCtx.sample_rate, 0, nil)
-
-	if ret < 0 {
-		d.cleanup()
-		return fmt.Errorf("failed to allocate resampler context")
+	if C.swr_set_matrix(d.swrCtx, &matrix[0], C.int(inChannels)) < 0 {
+		return fmt.Errorf("failed to set resampler channel map")
 	}
-	C.swr_init(d.swrCtx)
-
+	log.Printf("Audio channel map: %v of %d input channels -> %d output channels.", channelMap, inChannels, outChannels)
 	return nil
 }
 
@@ -148,6 +212,7 @@ func (d *ffmpegBaseDevice) Start() error {
 	// Only start the active decoding goroutine for real-time modes.
 	if d.mode == "live" || d.mode == "stream" {
 		go d.runAudioLoop(ctx)
+		d.startMonitor(ctx)
 	}
 
 	if d.player != nil {
@@ -292,14 +357,22 @@ func (d *ffmpegBaseDevice) resampleAndBuffer(frame *C.AVFrame) {
 	numSamples := int(actualOutputSamples)
 	numChannels := int(d.outChLayout.nb_channels)
 
-	// Create Go slice from the actual samples produced
+	// View the samples produced; Write copies them into the buffer.
 	totalFloats := numSamples * numChannels
-	goSlice := (*[1 << 30]float32)(unsafe.Pointer(resampledFrame.data[0]))[:totalFloats]
-	dataCopy := make([]float32, totalFloats)
-	copy(dataCopy, goSlice)
+	samples := (*[1 << 30]float32)(unsafe.Pointer(resampledFrame.data[0]))[:totalFloats]
+	if d.gain != 1.0 {
+		if cap(d.gainBuffer) < totalFloats {
+			d.gainBuffer = make([]float32, totalFloats)
+		}
+		gained := d.gainBuffer[:totalFloats]
+		for i, v := range samples {
+			gained[i] = v * d.gain
+		}
+		samples = gained
+	}
 
 	// Write to buffer and update sample count
-	d.buffer.Write(dataCopy, false)
+	d.buffer.Write(samples, false)
 	d.samplesSent += int64(numSamples)
 }
 
@@ -334,7 +407,7 @@ func (d *ffmpegBaseDevice) Stop() error {
 	return nil
 }
 
-// SampleRate returns the detected sample rate of the audio stream.
+// SampleRate returns the sample rate of the resampled audio stream.
 func (d *ffmpegBaseDevice) SampleRate() int {
 	return d.sampleRate
 }
@@ -1,8 +1,9 @@
+//go:build cgo
+
 package audio
 
 import (
 	"log"
-	"runtime"
 
 	options "github.com/richinsley/goshadertoy/options"
 )
@@ -36,20 +37,15 @@ func NewFFmpegDeviceInput(options *options.ShaderOptions, buffer *SharedAudioBuf
 // Start configures FFmpeg to capture from a live device and starts the process.
 func (d *FFmpegDeviceInput) Start() error {
 	log.Println("Initializing FFmpeg for device input...")
-	var format string
 	inputOptions := map[string]string{"fflags": "nobuffer"}
 
-	switch runtime.GOOS {
-	case "darwin":
-		format = "avfoundation"
-	case "linux":
-		format = "alsa"
-	case "windows":
-		format = "dshow"
+	format, err := inputFormatForBackend(*d.options.AudioBackend)
+	if err != nil {
+		return err
 	}
 
 	// Rate emulation is never needed for live device capture.
-	err := d.init(*d.options.AudioInputDevice, format, "stereo", false, inputOptions)
+	err = d.init(*d.options.AudioInputDevice, format, "stereo", false, inputOptions)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,173 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	audiodecode "github.com/richinsley/goshadertoy/audiodecode"
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+// goFileChunk is the number of stereo frames decoded at a time.
+const goFileChunk = 1024
+
+// GoFileInput reads audio from a WAV, MP3, FLAC or Ogg Vorbis file with the
+// pure Go decoders of audiodecode, for files the linked FFmpeg can't decode.
+// It behaves as FFmpegFileInput: decoding on its own in live and stream
+// modes, at the rate of playback if so, or on demand through DecodeUntil.
+type GoFileInput struct {
+	audioBaseDevice
+	decoder    audiodecode.Decoder
+	channelMap []int // Input channels feeding left and right
+	decoded    []float32
+	stereo     []float32
+	decodeLock sync.Mutex
+	gain       float32
+}
+
+// NewGoFileInput creates a new audio device that decodes a file in Go.
+func NewGoFileInput(options *options.ShaderOptions, buffer *SharedAudioBuffer) (*GoFileInput, error) {
+	d := &GoFileInput{
+		audioBaseDevice: audioBaseDevice{
+			options: options,
+			buffer:  buffer,
+		},
+	}
+	if *options.AudioOutputDevice != "" {
+		player, err := NewAudioPlayer(options)
+		if err != nil {
+			return nil, err
+		}
+		d.player = player
+	}
+	return d, nil
+}
+
+// Start opens the file and, in live and stream modes, starts decoding it.
+func (d *GoFileInput) Start() error {
+	path := *d.options.AudioInputFile
+	decoder, err := audiodecode.Open(path)
+	if err != nil {
+		return err
+	}
+	d.mode = *d.options.Mode
+	d.enableRateEmulation = d.mode == "live" || d.mode == "stream"
+	d.sampleRate = *d.options.AudioSampleRate
+	if decoder.SampleRate() != d.sampleRate {
+		log.Printf("Resampling audio input from %d Hz to %d Hz.", decoder.SampleRate(), d.sampleRate)
+	}
+	d.decoder = audiodecode.Resample(decoder, d.sampleRate)
+
+	// Like FFmpeg's stereo downmix, minus the mixing: mono feeds both
+	// sides, and the first two channels of anything wider feed left and right.
+	channels := d.decoder.Channels()
+	d.channelMap = []int{0, min(1, channels-1)}
+	if d.options.AudioChannelMap != nil && *d.options.AudioChannelMap != "" {
+		channelMap, err := ParseChannelMap(*d.options.AudioChannelMap)
+		if err != nil {
+			d.decoder.Close()
+			return err
+		}
+		for _, ch := range channelMap {
+			if ch >= channels {
+				d.decoder.Close()
+				return fmt.Errorf("audio channel map selects input channel %d, but the input only has %d channels", ch+1, channels)
+			}
+		}
+		d.channelMap = []int{channelMap[0], channelMap[len(channelMap)-1]}
+		log.Printf("Audio channel map: %v of %d input channels -> 2 output channels.", channelMap, channels)
+	}
+	d.decoded = make([]float32, goFileChunk*channels)
+
+	d.gain = 1.0
+	if d.options.AudioGain != nil && *d.options.AudioGain != 0 {
+		d.gain = float32(DecibelsToGain(*d.options.AudioGain))
+		log.Printf("Applying %.1f dB input gain (x%.3f).", *d.options.AudioGain, d.gain)
+	}
+	log.Printf("Decoding %s with the built-in decoder.", path)
+
+	var ctx context.Context
+	ctx, d.cancel = context.WithCancel(context.Background())
+	if d.enableRateEmulation {
+		go d.runAudioLoop(ctx)
+		d.startMonitor(ctx)
+	}
+	if d.player != nil {
+		d.player.Start(d.buffer)
+	}
+	return nil
+}
+
+// decodeChunk decodes up to goFileChunk frames into the buffer.
+func (d *GoFileInput) decodeChunk() error {
+	n, err := d.decoder.Read(d.decoded)
+	channels := d.decoder.Channels()
+	frames := n / channels
+	if cap(d.stereo) < frames*2 {
+		d.stereo = make([]float32, frames*2)
+	}
+	stereo := d.stereo[:frames*2]
+	for i := 0; i < frames; i++ {
+		stereo[i*2] = d.decoded[i*channels+d.channelMap[0]] * d.gain
+		stereo[i*2+1] = d.decoded[i*channels+d.channelMap[1]] * d.gain
+	}
+	if frames > 0 {
+		d.buffer.Write(stereo, false)
+		d.samplesSent += int64(frames)
+	}
+	return err
+}
+
+// runAudioLoop decodes in real time for live and stream modes.
+func (d *GoFileInput) runAudioLoop(ctx context.Context) {
+	d.startTime = time.Now()
+	for ctx.Err() == nil {
+		d.decodeLock.Lock()
+		if d.decoder == nil { // Stopped
+			d.decodeLock.Unlock()
+			return
+		}
+		err := d.decodeChunk()
+		d.decodeLock.Unlock()
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Error: decoding audio input: %v", err)
+			}
+			return
+		}
+		expectedSamples := int64(time.Since(d.startTime).Seconds() * float64(d.sampleRate))
+		if aheadSamples := d.samplesSent - expectedSamples; aheadSamples > 0 {
+			time.Sleep(time.Duration(float64(aheadSamples) * 1e9 / float64(d.sampleRate)))
+		}
+	}
+}
+
+func (d *GoFileInput) DecodeUntil(targetSample int64) error {
+	d.decodeLock.Lock()
+	defer d.decodeLock.Unlock()
+	if d.decoder == nil {
+		return fmt.Errorf("audio input is stopped")
+	}
+	for d.samplesSent < targetSample {
+		if err := d.decodeChunk(); err != nil {
+			return fmt.Errorf("EOF or read error while decoding to sample %d: %w", targetSample, err)
+		}
+	}
+	return nil
+}
+
+// Stop stops decoding and closes the file.
+func (d *GoFileInput) Stop() error {
+	err := d.audioBaseDevice.Stop()
+	d.decodeLock.Lock()
+	defer d.decodeLock.Unlock()
+	if d.decoder != nil {
+		d.decoder.Close()
+		d.decoder = nil
+	}
+	return err
+}
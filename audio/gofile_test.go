@@ -0,0 +1,116 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+// writeMonoWAV writes samples as a 16-bit mono WAV file at rate.
+func writeMonoWAV(t *testing.T, path string, rate int, samples []int16) {
+	t.Helper()
+	data := make([]byte, 44+2*len(samples))
+	copy(data, "RIFF")
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+	copy(data[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(data[16:], 16)
+	binary.LittleEndian.PutUint16(data[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(data[22:], 1)
+	binary.LittleEndian.PutUint32(data[24:], uint32(rate))
+	binary.LittleEndian.PutUint32(data[28:], uint32(rate*2))
+	binary.LittleEndian.PutUint16(data[32:], 2)
+	binary.LittleEndian.PutUint16(data[34:], 16)
+	copy(data[36:], "data")
+	binary.LittleEndian.PutUint32(data[40:], uint32(2*len(samples)))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(data[44+2*i:], uint16(s))
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startGoFileInput starts a record mode GoFileInput reading path at 48 kHz.
+func startGoFileInput(t *testing.T, path string) (*GoFileInput, *SharedAudioBuffer) {
+	t.Helper()
+	mode, outputDevice, channelMap := "record", "", ""
+	rate, gain := 48000, 0.0
+	opts := &options.ShaderOptions{
+		Mode:              &mode,
+		AudioInputFile:    &path,
+		AudioOutputDevice: &outputDevice,
+		AudioSampleRate:   &rate,
+		AudioGain:         &gain,
+		AudioChannelMap:   &channelMap,
+	}
+	buffer := NewSPSCAudioBuffer(rate * 5)
+	d, err := NewGoFileInput(opts, buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return d, buffer
+}
+
+func TestGoFileInputDecodeUntil(t *testing.T) {
+	samples := make([]int16, 3000)
+	for i := range samples {
+		samples[i] = int16(i*16 - 1<<14)
+	}
+	path := filepath.Join(t.TempDir(), "mono.wav")
+	writeMonoWAV(t, path, 48000, samples)
+	d, buffer := startGoFileInput(t, path)
+	defer d.Stop()
+
+	// Decoding is on demand in record mode, a chunk at a time.
+	if err := d.DecodeUntil(1500); err != nil {
+		t.Fatal(err)
+	}
+	if got := buffer.AvailableSamples(); got < 1500*2 || got > (1500+goFileChunk)*2 {
+		t.Fatalf("DecodeUntil(1500) buffered %d samples, want 3000 to %d", got, (1500+goFileChunk)*2)
+	}
+	if err := d.DecodeUntil(int64(len(samples) + 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("DecodeUntil past the end = %v, want io.EOF", err)
+	}
+
+	stereo := make([]float32, 2*len(samples))
+	if n := buffer.ReadInto(stereo); n != len(stereo) {
+		t.Fatalf("buffered %d samples, want %d", n, len(stereo))
+	}
+	for i, s := range samples {
+		want := float32(s) / (1 << 15)
+		if stereo[i*2] != want || stereo[i*2+1] != want {
+			t.Fatalf("frame %d = %v, %v, want %v on both sides", i, stereo[i*2], stereo[i*2+1], want)
+		}
+	}
+}
+
+func TestGoFileInputStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mono.wav")
+	writeMonoWAV(t, path, 48000, make([]int16, 3000))
+	d, _ := startGoFileInput(t, path)
+	if err := d.DecodeUntil(1000); err != nil {
+		t.Fatal(err)
+	}
+
+	// Record mode has no decoding loop to close the file; Stop does.
+	if err := d.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if d.decoder != nil {
+		t.Fatal("Stop left the decoder open")
+	}
+	if err := d.DecodeUntil(2000); err == nil {
+		t.Fatal("DecodeUntil after Stop succeeded")
+	}
+	if err := d.Stop(); err != nil {
+		t.Fatalf("second Stop = %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package audio
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+)
+
+// SystemAudioInput is the -audio-input preset that captures whatever the machine is playing.
+const SystemAudioInput = "system"
+
+// loopbackDeviceHints are substrings of capture source names known to carry the
+// system mix, in order of preference.
+var loopbackDeviceHints = map[string][]string{
+	"darwin":  {"BlackHole", "Loopback Audio", "Soundflower"},
+	"windows": {"virtual-audio-capturer", "Stereo Mix", "CABLE Output", "What U Hear"},
+}
+
+// ResolveSystemLoopback picks a backend and capture device that records the
+// system output mix. On Linux this is the monitor of the default PulseAudio/PipeWire
+// sink. macOS and Windows have no loopback FFmpeg can open directly, so a virtual
+// device (BlackHole, Stereo Mix, virtual-audio-capturer, ...) is located by name.
+func ResolveSystemLoopback(backend string) (string, string, error) {
+	switch runtime.GOOS {
+	case "linux":
+		if backend != "" && backend != "pulse" {
+			return "", "", fmt.Errorf("system audio capture requires the pulse backend (PulseAudio or PipeWire); with %s, load snd-aloop or route ports manually and pass -audio-input-device", backend)
+		}
+		return "pulse", "@DEFAULT_MONITOR@", nil
+	case "darwin":
+		name, err := findLoopbackSource(backend)
+		if err != nil {
+			return "", "", fmt.Errorf("%w. macOS has no built-in loopback: install BlackHole (https://existential.audio/blackhole/), "+
+				"add it to a Multi-Output Device with your speakers and select that as the system output", err)
+		}
+		return backend, ":" + name, nil
+	case "windows":
+		name, err := findLoopbackSource(backend)
+		if err != nil {
+			return "", "", fmt.Errorf("%w. DirectShow cannot open WASAPI loopback directly: enable 'Stereo Mix' in the Sound control panel "+
+				"or install virtual-audio-capturer or VB-CABLE", err)
+		}
+		return backend, "audio=" + name, nil
+	default:
+		return "", "", fmt.Errorf("system audio capture is not supported on %s", runtime.GOOS)
+	}
+}
+
+// findLoopbackSource searches the capture sources of a backend for a known loopback device.
+func findLoopbackSource(backend string) (string, error) {
+	sources, _, err, _ := ListAudioDevices(backend)
+	if err != nil {
+		return "", fmt.Errorf("could not enumerate capture sources: %v", err)
+	}
+	for _, hint := range loopbackDeviceHints[runtime.GOOS] {
+		for _, src := range sources {
+			if strings.Contains(strings.ToLower(src.Name), strings.ToLower(hint)) {
+				log.Printf("Using '%s' for system audio capture", src.Name)
+				return src.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no loopback capture device found")
+}
@@ -0,0 +1,94 @@
+package audio
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// BufferStats reports how well the writer and readers of a SharedAudioBuffer
+// keep up with each other.
+type BufferStats struct {
+	Available int   // Samples queued now
+	Capacity  int   // Samples the buffer holds
+	Written   int64 // Samples written since creation
+	Dropped   int64 // Samples dropped because the buffer was full: overruns
+	Underruns int64 // Times a real-time reader found too few samples
+}
+
+// Stats returns a snapshot of the buffer's counters.
+func (b *SharedAudioBuffer) Stats() BufferStats {
+	s := BufferStats{
+		Available: b.AvailableSamples(),
+		Written:   b.totalWritten.Load(),
+		Dropped:   b.droppedSamples.Load(),
+		Underruns: b.underruns.Load(),
+	}
+	if b.spsc != nil {
+		s.Capacity = len(b.spsc.buf)
+	} else {
+		s.Capacity = len(b.ring)
+	}
+	return s
+}
+
+// ReportUnderrun counts an underrun: a reader that has to deliver audio in
+// real time, like a player or a live stream, found too few samples, so its
+// output has a gap.
+func (b *SharedAudioBuffer) ReportUnderrun() {
+	b.underruns.Add(1)
+}
+
+// bufferSampleInterval is how often monitorBuffer samples the occupancy.
+const bufferSampleInterval = 100 * time.Millisecond
+
+// defaultBufferReport is how often monitorBuffer checks for underruns and
+// overruns when occupancy isn't logged.
+const defaultBufferReport = 10 * time.Second
+
+// monitorBuffer watches b until ctx is done, warning when it underran or
+// dropped samples since the last report. With a report interval it also logs
+// the occupancy over each interval; without, it checks every 10 seconds.
+func monitorBuffer(ctx context.Context, b *SharedAudioBuffer, sampleRate int, report time.Duration) {
+	logOccupancy := report > 0
+	if !logOccupancy {
+		report = defaultBufferReport
+	}
+	toMs := func(samples int) float64 { return float64(samples) / 2 / float64(sampleRate) * 1000 }
+
+	sampler := time.NewTicker(bufferSampleInterval)
+	defer sampler.Stop()
+	last := b.Stats()
+	lastReport := time.Now()
+	minAvailable, maxAvailable, sum, samples := last.Capacity, 0, 0, 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sampler.C:
+		}
+		s := b.Stats()
+		minAvailable = min(minAvailable, s.Available)
+		maxAvailable = max(maxAvailable, s.Available)
+		sum += s.Available
+		samples++
+		if time.Since(lastReport) < report {
+			continue
+		}
+
+		window := time.Since(lastReport).Round(time.Second)
+		underruns, dropped := s.Underruns-last.Underruns, s.Dropped-last.Dropped
+		if logOccupancy {
+			log.Printf("Audio buffer: %.0f ms queued on average (%.0f to %.0f ms) of %.0f ms; %d underruns and %.0f ms dropped in the last %v",
+				toMs(sum/samples), toMs(minAvailable), toMs(maxAvailable), toMs(s.Capacity), underruns, toMs(int(dropped)), window)
+		}
+		if underruns > 0 {
+			log.Printf("Warning: audio underran %d times in the last %v; the audio source is not keeping up with playback, so the output has gaps", underruns, window)
+		}
+		if dropped > 0 {
+			log.Printf("Warning: the audio buffer overflowed, dropping %.0f ms of audio in the last %v; playback or encoding is not keeping up with the source", toMs(int(dropped)), window)
+		}
+		last, lastReport = s, time.Now()
+		minAvailable, maxAvailable, sum, samples = s.Capacity, 0, 0, 0
+	}
+}
@@ -0,0 +1,54 @@
+//go:build !cgo
+
+package audio
+
+import (
+	"fmt"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+// Without cgo there is no FFmpeg: audio files are decoded by audiodecode,
+// and capturing from or playing to devices is unavailable.
+
+var errNoFFmpeg = fmt.Errorf("audio devices need FFmpeg, which builds without cgo lack")
+
+// NewFFmpegAudioDevice creates the device for the options' audio input. An
+// input file is decoded in Go; an input device is an error.
+func NewFFmpegAudioDevice(options *options.ShaderOptions) (AudioDevice, error) {
+	// Without a player the decoder and the encoder are the only writer and
+	// reader, so the lock-free buffer always does.
+	return newFFmpegAudioDevice(options, NewSPSCAudioBuffer(*options.AudioSampleRate*5)) // 5-second buffer
+}
+
+// newFFmpegAudioDevice creates the device for the options' audio input,
+// writing to buffer.
+func newFFmpegAudioDevice(options *options.ShaderOptions, buffer *SharedAudioBuffer) (AudioDevice, error) {
+	if options.AudioInputDevice != nil && *options.AudioInputDevice != "" {
+		return nil, errNoFFmpeg
+	}
+	if options.AudioInputFile != nil && *options.AudioInputFile != "" {
+		return NewGoFileInput(options, buffer)
+	}
+	return NewNullDeviceWithBuffer(*options.AudioSampleRate, buffer), nil
+}
+
+// ListAudioDevices enumerates the capture sources and playback sinks of the
+// given backend, which needs FFmpeg.
+func ListAudioDevices(backend string) (sources []AudioDeviceInfo, sinks []AudioDeviceInfo, sourceErr error, sinkErr error) {
+	return nil, nil, errNoFFmpeg, errNoFFmpeg
+}
+
+// AudioPlayer plays audio to an output device.
+type AudioPlayer struct{}
+
+// NewAudioPlayer creates a new audio player.
+func NewAudioPlayer(options *options.ShaderOptions) (*AudioPlayer, error) {
+	return nil, errNoFFmpeg
+}
+
+// Start begins playing buffer.
+func (p *AudioPlayer) Start(buffer *SharedAudioBuffer) error { return errNoFFmpeg }
+
+// Stop stops playing.
+func (p *AudioPlayer) Stop() error { return nil }
@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"runtime"
 	"time"
 	"unsafe"
 
@@ -14,7 +13,6 @@ import (
 )
 
 /*
-#cgo CFLAGS: -I${SRCDIR}/../release/include -I${SRCDIR}/../release/include/arcana
 #include <libavformat/avformat.h>
 #include <libavcodec/avcodec.h>
 #include <libavutil/opt.h>
@@ -43,7 +41,6 @@ static inline const char* av_error_str(int errnum) {
 */
 import "C"
 
-const outputSampleRate = 44100
 const outputChannelLayout = "stereo"
 const outputChannels = 2
 const outputFrameSize = 1024 // A standard audio frame size
@@ -55,11 +52,14 @@ type AudioPlayer struct {
 	packet         *C.AVPacket
 	isStreaming    bool
 	options        *options.ShaderOptions
-	internalBuffer []float32
+	internalBuffer []float32 // One output frame, filled up to buffered samples
+	buffered       int
+	lastWritten    int64 // Samples the source had written at the last tick
 	startTime      time.Time
 	samplesWritten int64
 	buffer         *SharedAudioBuffer
 	cancel         context.CancelFunc
+	sampleRate     int
 
 	// Re-instated frames for robust memory management
 	swrCtx             *C.struct_SwrContext
@@ -77,38 +77,37 @@ func NewAudioPlayer(options *options.ShaderOptions) (*AudioPlayer, error) {
 
 	p := &AudioPlayer{
 		options:        options,
-		internalBuffer: make([]float32, 0, outputFrameSize*4), // Pre-allocate some capacity
+		internalBuffer: make([]float32, outputFrameSize*outputChannels),
+		sampleRate:     *options.AudioSampleRate,
 	}
 
 	return p, nil
 }
 
-// getOutputFormatAndDevice determines the correct FFmpeg format and device string based on the OS.
-func (p *AudioPlayer) getOutputFormatAndDevice() (format, device string) {
+// getOutputFormatAndDevice determines the FFmpeg format and device string for the selected backend.
+func (p *AudioPlayer) getOutputFormatAndDevice() (format, device string, err error) {
 	device = *p.options.AudioOutputDevice
-	switch runtime.GOOS {
-	case "darwin":
-		format = "audiotoolbox"
-	case "linux":
-		format = "alsa"
-	case "windows":
-		format = "dshow"
-	default:
-		log.Fatalf("Unsupported OS for live audio playback: %s", runtime.GOOS)
-	}
-	return format, device
+	format, err = outputFormatForBackend(*p.options.AudioBackend)
+	return format, device, err
 }
 
 // Start begins the audio playback by setting up the FFmpeg pipeline for raw PCM output.
 func (p *AudioPlayer) Start(buffer *SharedAudioBuffer) error {
 	p.buffer = buffer
-	formatName, deviceName := p.getOutputFormatAndDevice()
-
-	var err error
-	p.targetSampleFormat, err = arcana.ProbeDeviceForBestFormat(deviceName, outputChannels, outputSampleRate)
+	formatName, deviceName, err := p.getOutputFormatAndDevice()
 	if err != nil {
-		log.Printf("Device probe failed: %v. Falling back to S16_LE.", err)
-		p.targetSampleFormat = C.AV_SAMPLE_FMT_S16
+		return err
+	}
+
+	if formatName == "pulse" {
+		// PulseAudio (and PipeWire's pulse server) accept float samples and convert internally.
+		p.targetSampleFormat = C.AV_SAMPLE_FMT_FLT
+	} else {
+		p.targetSampleFormat, err = arcana.ProbeDeviceForBestFormat(deviceName, outputChannels, p.sampleRate)
+		if err != nil {
+			log.Printf("Device probe failed: %v. Falling back to S16_LE.", err)
+			p.targetSampleFormat = C.AV_SAMPLE_FMT_S16
+		}
 	}
 
 	switch p.targetSampleFormat {
@@ -126,7 +125,21 @@ func (p *AudioPlayer) Start(buffer *SharedAudioBuffer) error {
 
 	cFormatName := C.CString(formatName)
 	defer C.free(unsafe.Pointer(cFormatName))
-	cDeviceName := C.CString(deviceName)
+	// The pulse muxer takes a stream name as its URL and selects the sink with the "device" option.
+	outputURL := deviceName
+	if formatName == "pulse" {
+		outputURL = "goshadertoy"
+	}
+	var muxerOptions *C.AVDictionary
+	defer C.av_dict_free(&muxerOptions)
+	if formatName == "pulse" && deviceName != "default" {
+		cKey := C.CString("device")
+		cValue := C.CString(deviceName)
+		C.av_dict_set(&muxerOptions, cKey, cValue, 0)
+		C.free(unsafe.Pointer(cKey))
+		C.free(unsafe.Pointer(cValue))
+	}
+	cDeviceName := C.CString(outputURL)
 	defer C.free(unsafe.Pointer(cDeviceName))
 	outputFormat := C.find_output_format(cFormatName)
 	if outputFormat == nil {
@@ -142,12 +155,12 @@ func (p *AudioPlayer) Start(buffer *SharedAudioBuffer) error {
 		return fmt.Errorf("could not create new stream")
 	}
 	p.audioStream.time_base.num = 1
-	p.audioStream.time_base.den = outputSampleRate
+	p.audioStream.time_base.den = C.int(p.sampleRate)
 	codecpar := p.audioStream.codecpar
 	codecpar.codec_type = C.AVMEDIA_TYPE_AUDIO
 	codecpar.codec_id = p.targetCodecID
 	codecpar.format = C.int(p.targetSampleFormat)
-	codecpar.sample_rate = outputSampleRate
+	codecpar.sample_rate = C.int(p.sampleRate)
 	cLayoutStr := C.CString(outputChannelLayout)
 	defer C.free(unsafe.Pointer(cLayoutStr))
 	C.av_channel_layout_from_string(&codecpar.ch_layout, cLayoutStr)
@@ -158,7 +171,7 @@ func (p *AudioPlayer) Start(buffer *SharedAudioBuffer) error {
 	defer C.av_channel_layout_uninit(&outChLayout)
 	defer C.av_channel_layout_uninit(&inChLayout)
 
-	C.swr_alloc_set_opts2(&p.swrCtx, &outChLayout, p.targetSampleFormat, C.int(outputSampleRate), &inChLayout, C.AV_SAMPLE_FMT_FLT, C.int(outputSampleRate), 0, nil)
+	C.swr_alloc_set_opts2(&p.swrCtx, &outChLayout, p.targetSampleFormat, C.int(p.sampleRate), &inChLayout, C.AV_SAMPLE_FMT_FLT, C.int(p.sampleRate), 0, nil)
 	if p.swrCtx == nil {
 		p.cleanup()
 		return fmt.Errorf("could not allocate resampler context")
@@ -199,7 +212,7 @@ func (p *AudioPlayer) Start(buffer *SharedAudioBuffer) error {
 			return fmt.Errorf("could not open output URL '%s'", deviceName)
 		}
 	}
-	if C.avformat_write_header(p.formatCtx, nil) < 0 {
+	if C.avformat_write_header(p.formatCtx, &muxerOptions) < 0 {
 		p.cleanup()
 		return fmt.Errorf("could not write header")
 	}
@@ -219,7 +232,7 @@ func (p *AudioPlayer) runOutputLoop(ctx context.Context) {
 	p.startTime = time.Now()
 	p.samplesWritten = 0
 
-	ticker := time.NewTicker(time.Second * outputFrameSize / (outputSampleRate))
+	ticker := time.NewTicker(time.Second * outputFrameSize / time.Duration(p.sampleRate))
 	defer ticker.Stop()
 
 	for {
@@ -227,18 +240,25 @@ func (p *AudioPlayer) runOutputLoop(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			frameData := p.buffer.Read(outputFrameSize * outputChannels)
-			p.internalBuffer = append(p.internalBuffer, frameData...)
+			p.buffered += p.buffer.ReadInto(p.internalBuffer[p.buffered:])
+			// Short of a frame while the source is still writing is an underrun;
+			// before it starts or after it ends, there is just nothing to play.
+			written := p.buffer.TotalSamplesWritten()
+			if p.buffered < len(p.internalBuffer) && written > 0 && written != p.lastWritten {
+				p.buffer.ReportUnderrun()
+			}
+			p.lastWritten = written
 		}
-		for len(p.internalBuffer) >= outputFrameSize*outputChannels {
+		if p.buffered == len(p.internalBuffer) {
 			p.sendFrame(&pts)
+			p.buffered = 0
 		}
 	}
 }
 
 func (p *AudioPlayer) sendFrame(pts *int64) {
 	// Get a chunk of float32 audio from our internal buffer.
-	frameSamples := p.internalBuffer[:outputFrameSize*outputChannels]
+	frameSamples := p.internalBuffer
 	// inputSampleCount := C.int(outputFrameSize)
 
 	// Make sure the source frame is writable and copy our Go data into it.
@@ -280,7 +300,6 @@ func (p *AudioPlayer) sendFrame(pts *int64) {
 	// Update counters.
 	p.samplesWritten += int64(convertedSamples)
 	*pts = p.samplesWritten
-	p.internalBuffer = p.internalBuffer[outputFrameSize*outputChannels:]
 }
 
 func (p *AudioPlayer) cleanup() {
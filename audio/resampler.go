@@ -0,0 +1,73 @@
+package audio
+
+/*
+#include <libavutil/channel_layout.h>
+#include <libavutil/samplefmt.h>
+#include <libswresample/swresample.h>
+
+// swr_convert takes arrays of plane pointers; interleaved audio has a single plane.
+static int convert_interleaved(SwrContext* s, float* out, int outCount, const float* in, int inCount) {
+    uint8_t* outPlanes[1] = { (uint8_t*)out };
+    const uint8_t* inPlanes[1] = { (const uint8_t*)in };
+    return swr_convert(s, outPlanes, outCount, in ? inPlanes : NULL, inCount);
+}
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Resampler converts interleaved stereo float audio between sample rates.
+type Resampler struct {
+	swrCtx  *C.SwrContext
+	inRate  int
+	outRate int
+}
+
+// NewResampler creates a stereo float resampler from inRate to outRate.
+func NewResampler(inRate, outRate int) (*Resampler, error) {
+	var layout C.AVChannelLayout
+	C.av_channel_layout_default(&layout, 2)
+	defer C.av_channel_layout_uninit(&layout)
+
+	r := &Resampler{inRate: inRate, outRate: outRate}
+	if C.swr_alloc_set_opts2(&r.swrCtx,
+		&layout, C.AV_SAMPLE_FMT_FLT, C.int(outRate),
+		&layout, C.AV_SAMPLE_FMT_FLT, C.int(inRate), 0, nil) < 0 {
+		return nil, fmt.Errorf("failed to allocate resampler context")
+	}
+	if C.swr_init(r.swrCtx) < 0 {
+		C.swr_free(&r.swrCtx)
+		return nil, fmt.Errorf("failed to initialize resampler %d Hz -> %d Hz", inRate, outRate)
+	}
+	return r, nil
+}
+
+// Process resamples a chunk of interleaved stereo samples. The output length
+// varies per call because the resampler keeps some samples for filtering.
+func (r *Resampler) Process(samples []float32) []float32 {
+	inFrames := len(samples) / 2
+	if inFrames == 0 {
+		return nil
+	}
+	maxOutFrames := int(C.swr_get_out_samples(r.swrCtx, C.int(inFrames)))
+	if maxOutFrames <= 0 {
+		return nil
+	}
+	out := make([]float32, maxOutFrames*2)
+	n := C.convert_interleaved(r.swrCtx,
+		(*C.float)(unsafe.Pointer(&out[0])), C.int(maxOutFrames),
+		(*C.float)(unsafe.Pointer(&samples[0])), C.int(inFrames))
+	if n < 0 {
+		return nil
+	}
+	return out[:int(n)*2]
+}
+
+// Close frees the resampler.
+func (r *Resampler) Close() {
+	if r.swrCtx != nil {
+		C.swr_free(&r.swrCtx)
+	}
+}
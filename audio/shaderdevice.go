@@ -1,3 +1,5 @@
+//go:build cgo
+
 package audio
 
 import (
@@ -16,10 +18,13 @@ type ShaderAudioDevice struct {
 	preRenderedChan <-chan []float32
 	decodeLock      sync.Mutex // Protects the on-demand decoding process
 	samplesWritten  int64      // Correctly track stereo samples written for record mode
+	resampler       *Resampler // Converts from the shader's render rate, nil if rates match
 }
 
-// NewShaderAudioDevice creates a new audio device that consumes from a sound shader.
-func NewShaderAudioDevice(opts *options.ShaderOptions, preRenderedChan <-chan []float32, sampleRate int) (*ShaderAudioDevice, error) {
+// NewShaderAudioDevice creates a new audio device that consumes from a sound shader
+// rendering at renderRate. The audio is resampled to the configured output rate.
+func NewShaderAudioDevice(opts *options.ShaderOptions, preRenderedChan <-chan []float32, renderRate int) (*ShaderAudioDevice, error) {
+	sampleRate := *opts.AudioSampleRate
 	d := &ShaderAudioDevice{
 		audioBaseDevice: audioBaseDevice{
 			options:    opts,
@@ -28,6 +33,14 @@ func NewShaderAudioDevice(opts *options.ShaderOptions, preRenderedChan <-chan []
 		},
 		preRenderedChan: preRenderedChan,
 	}
+	if renderRate != sampleRate {
+		resampler, err := NewResampler(renderRate, sampleRate)
+		if err != nil {
+			return nil, err
+		}
+		d.resampler = resampler
+		log.Printf("Resampling sound shader output from %d Hz to %d Hz.", renderRate, sampleRate)
+	}
 	d.mode = *d.options.Mode
 	d.enableRateEmulation = (*d.options.Mode == "live" || *d.options.Mode == "stream")
 
@@ -38,6 +51,13 @@ func NewShaderAudioDevice(opts *options.ShaderOptions, preRenderedChan <-chan []
 		}
 		d.player = player
 	}
+
+	// The sound renderer produces audio well ahead of playback. Whenever something
+	// consumes the buffer, feed the FFT window from those reads so audio-reactive
+	// image passes see what is being heard rather than what was just rendered.
+	if d.player != nil || d.mode != "live" {
+		d.buffer.SetWindowTapOnRead(true)
+	}
 	return d, nil
 }
 
@@ -48,6 +68,7 @@ func (d *ShaderAudioDevice) Start() error {
 
 	if d.mode == "live" || d.mode == "stream" {
 		go d.runLoop(ctx)
+		d.startMonitor(ctx)
 	}
 
 	if d.player != nil {
@@ -72,6 +93,7 @@ func (d *ShaderAudioDevice) DecodeUntil(targetSample int64) error {
 		if !ok {
 			return fmt.Errorf("shader audio channel closed unexpectedly while decoding")
 		}
+		largeBuffer = d.resample(largeBuffer)
 
 		for i := 0; i < len(largeBuffer); i += playbackChunkSize {
 			end := i + playbackChunkSize
@@ -100,6 +122,7 @@ func (d *ShaderAudioDevice) runLoop(ctx context.Context) {
 				log.Println("Shader audio channel closed, stopping device.")
 				return
 			}
+			largeBuffer = d.resample(largeBuffer)
 
 			for i := 0; i < len(largeBuffer); i += playbackChunkSize {
 				end := i + playbackChunkSize
@@ -107,7 +130,8 @@ func (d *ShaderAudioDevice) runLoop(ctx context.Context) {
 					end = len(largeBuffer)
 				}
 				chunk := largeBuffer[i:end]
-				d.buffer.Write(chunk, false)
+				// In live mode without a player nothing drains the queue, so drop old audio rather than stall.
+				d.buffer.Write(chunk, d.mode == "live" && d.player == nil)
 				d.samplesSent += int64(len(chunk) / 2) // For rate emulation
 
 				if d.enableRateEmulation {
@@ -127,3 +151,11 @@ func (d *ShaderAudioDevice) runLoop(ctx context.Context) {
 		}
 	}
 }
+
+// resample converts a chunk from the render rate to the output rate.
+func (d *ShaderAudioDevice) resample(samples []float32) []float32 {
+	if d.resampler == nil {
+		return samples
+	}
+	return d.resampler.Process(samples)
+}
@@ -2,136 +2,254 @@ package audio
 
 import (
 	"sync"
+	"sync/atomic"
 )
 
-// SharedAudioBuffer provides a thread-safe, buffered audio queue.
+// SharedAudioBuffer provides a thread-safe, buffered audio queue: a fixed
+// ring of interleaved stereo samples, so neither writing nor reading
+// allocates once it is created. A buffer from NewSPSCAudioBuffer is lock-free
+// instead, for exactly one writer and one reader.
 type SharedAudioBuffer struct {
-	mu               sync.Mutex // A regular Mutex is sufficient with Cond
-	cond             *sync.Cond // Use a condition variable for signaling
-	buffers          [][]float32
-	maxBuffers       int
-	totalWritten     int64
-	droppedSamples   int64
-	availableSamples int
-
-	// Window for non-destructive peeking (for FFT)
+	mu             sync.Mutex
+	cond           *sync.Cond // Signaled when samples are read, for writers waiting for room
+	ring           []float32
+	readPos        int
+	available      int
+	totalWritten   atomic.Int64
+	totalRead      atomic.Int64
+	droppedSamples atomic.Int64
+	underruns      atomic.Int64 // Reported by real-time readers
+
+	// Lock-free mode, replacing mu and ring
+	spsc *spscRing
+	room chan struct{} // Signaled when samples are read, for a writer waiting for room
+
+	// Window for non-destructive peeking (for FFT). The history ring holds the
+	// window plus an optional delay so the visualization can trail the capture.
 	windowMu    sync.RWMutex
 	windowSize  int
-	writeWindow []float32
-	readWindow  []float32
+	windowDelay int
+	history     []float32
 	writePos    int
+	tapOnRead   atomic.Bool // Feed the window from Read instead of Write
 }
 
 const DefaultWindowSize = 2048
 
-// NewSharedAudioBuffer creates a new buffer.
+// minBufferSamples is the smallest ring, in samples, so a buffer always holds
+// a few decoded frames.
+const minBufferSamples = 20 * 2048
+
+// NewSharedAudioBuffer creates a buffer holding capacity stereo frames.
 func NewSharedAudioBuffer(capacity int) *SharedAudioBuffer {
-	maxBuffers := max(capacity/1024, 20)
 	b := &SharedAudioBuffer{
-		buffers:          make([][]float32, 0, maxBuffers),
-		maxBuffers:       maxBuffers,
-		availableSamples: 0,
-		windowSize:       DefaultWindowSize,
-		writeWindow:      make([]float32, DefaultWindowSize),
-		readWindow:       make([]float32, DefaultWindowSize),
-		writePos:         0,
+		ring:       make([]float32, max(2*capacity, minBufferSamples)),
+		windowSize: DefaultWindowSize,
+		history:    make([]float32, DefaultWindowSize),
+		writePos:   0,
 	}
 	// Initialize the condition variable with the Mutex
 	b.cond = sync.NewCond(&b.mu)
 	return b
 }
 
-// Write adds new samples to the buffer.
-// If dropIfFull is true, it drops the oldest samples if the buffer is full.
+// NewSPSCAudioBuffer creates a buffer holding at least capacity stereo frames
+// that takes no locks to write or read, so a decoder writing it never holds
+// up the renderer or player reading it. Only one goroutine at a time may
+// write it and one read it; the window may be peeked from anywhere.
+//
+// When it is full, Write with dropIfFull drops the newest samples rather than
+// the oldest: dropping the oldest moves the reader's position, which only the
+// reader may do without a lock. Every input blocks for room instead, so the
+// difference only shows when no one reads the buffer.
+func NewSPSCAudioBuffer(capacity int) *SharedAudioBuffer {
+	return &SharedAudioBuffer{
+		spsc:       newSPSCRing(max(2*capacity, minBufferSamples)),
+		room:       make(chan struct{}, 1),
+		windowSize: DefaultWindowSize,
+		history:    make([]float32, DefaultWindowSize),
+	}
+}
+
+// Write copies samples into the buffer.
+// If dropIfFull is true, it drops the oldest samples if the buffer is full,
+// or the newest for a buffer from NewSPSCAudioBuffer.
 // If dropIfFull is false, it blocks until space is available.
 func (b *SharedAudioBuffer) Write(samples []float32, dropIfFull bool) {
-	b.updateWindow(samples) // Update the non-destructive peek window first
+	if !b.windowTapsReads() {
+		b.updateWindow(samples) // Update the non-destructive peek window first
+	}
+
+	if b.spsc != nil {
+		b.writeSPSC(samples, dropIfFull)
+		return
+	}
 
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	// If we are in blocking mode, wait for space.
-	if !dropIfFull {
-		for len(b.buffers) >= b.maxBuffers {
+	if dropIfFull {
+		// Only the most recent len(ring) samples can be kept.
+		if excess := len(samples) - len(b.ring); excess > 0 {
+			b.droppedSamples.Add(int64(excess))
+			samples = samples[excess:]
+		}
+		if over := b.available + len(samples) - len(b.ring); over > 0 {
+			over = min(over+over&1, b.available) // Keep the stereo channels in step
+			b.discard(over)
+			b.droppedSamples.Add(int64(over))
+		}
+		b.put(samples)
+		return
+	}
+
+	// Wait for room as needed, writing what fits meanwhile.
+	for len(samples) > 0 {
+		for b.available == len(b.ring) {
 			b.cond.Wait() // This atomically unlocks mu and waits.
 		}
+		n := min(len(samples), len(b.ring)-b.available)
+		b.put(samples[:n])
+		samples = samples[n:]
 	}
+}
 
-	// Handle buffer being full for the dropping case.
-	if len(b.buffers) >= b.maxBuffers {
+// writeSPSC is Write for a lock-free buffer.
+func (b *SharedAudioBuffer) writeSPSC(samples []float32, dropIfFull bool) {
+	for {
+		n := b.spsc.write(samples)
+		b.totalWritten.Add(int64(n))
+		samples = samples[n:]
+		if len(samples) == 0 {
+			return
+		}
 		if dropIfFull {
-			// Drop the oldest buffer to make space.
-			oldBuffer := b.buffers[0]
-			b.buffers = b.buffers[1:]
-			b.droppedSamples += int64(len(oldBuffer))
-			b.availableSamples -= len(oldBuffer)
-		} else {
-			// This case should not be reached if blocking is working correctly,
-			// but as a safeguard, we return.
+			b.droppedSamples.Add(int64(len(samples)))
 			return
 		}
+		<-b.room
 	}
+}
 
-	bufferCopy := make([]float32, len(samples))
-	copy(bufferCopy, samples)
+// put appends samples, which must fit, to the ring. Must be called with mu held.
+func (b *SharedAudioBuffer) put(samples []float32) {
+	writePos := (b.readPos + b.available) % len(b.ring)
+	n := copy(b.ring[writePos:], samples)
+	copy(b.ring, samples[n:])
+	b.available += len(samples)
+	b.totalWritten.Add(int64(len(samples)))
+}
 
-	b.buffers = append(b.buffers, bufferCopy)
-	b.totalWritten += int64(len(samples))
-	b.availableSamples += len(samples)
+// discard drops the oldest n samples, which must be available. Must be called
+// with mu held.
+func (b *SharedAudioBuffer) discard(n int) {
+	b.readPos = (b.readPos + n) % len(b.ring)
+	b.available -= n
 }
 
-// Read destructively reads the oldest 'count' samples from the buffer queue.
+// Read destructively reads the oldest 'count' samples from the buffer into a
+// new slice, for consumers that keep the samples. Consumers that don't should
+// use ReadInto with a buffer of their own.
 func (b *SharedAudioBuffer) Read(count int) []float32 {
+	if b.spsc != nil {
+		if count <= 0 || b.spsc.len() == 0 {
+			return nil
+		}
+		out := make([]float32, min(count, b.spsc.len()))
+		return out[:b.readSPSC(out)]
+	}
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if count <= 0 || b.availableSamples == 0 {
+	if count <= 0 || b.available == 0 {
 		return nil
 	}
+	out := make([]float32, min(count, b.available))
+	b.read(out)
+	return out
+}
 
-	// Check if we were previously at full capacity.
-	wasFull := len(b.buffers) >= b.maxBuffers
-
-	if count > b.availableSamples {
-		count = b.availableSamples
+// ReadInto destructively reads the oldest samples into dst, up to len(dst),
+// and returns how many it read.
+func (b *SharedAudioBuffer) ReadInto(dst []float32) int {
+	if b.spsc != nil {
+		return b.readSPSC(dst)
 	}
 
-	out := make([]float32, count)
-	outPos := 0
-	samplesRemainingToRead := count
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.read(dst)
+}
 
-	// Consume from the oldest buffers first (FIFO)
-	for len(b.buffers) > 0 && samplesRemainingToRead > 0 {
-		buffer := b.buffers[0]
-		samplesToCopy := min(samplesRemainingToRead, len(buffer))
+// Discard destructively skips the oldest count samples, or as many as are
+// available, and returns how many it skipped.
+func (b *SharedAudioBuffer) Discard(count int) int {
+	if b.spsc != nil {
+		count = b.spsc.discard(max(count, 0))
+		b.signalRoom()
+		return count
+	}
 
-		copy(out[outPos:], buffer[:samplesToCopy])
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	count = min(max(count, 0), b.available)
+	b.discard(count)
+	if count > 0 {
+		b.cond.Broadcast()
+	}
+	return count
+}
 
-		outPos += samplesToCopy
-		samplesRemainingToRead -= samplesToCopy
+// read moves the oldest samples into dst. Must be called with mu held.
+func (b *SharedAudioBuffer) read(dst []float32) int {
+	count := min(len(dst), b.available)
+	if count == 0 {
+		return 0
+	}
+	n := copy(dst[:count], b.ring[b.readPos:])
+	copy(dst[n:count], b.ring)
+	b.discard(count)
+	b.totalRead.Add(int64(count))
 
-		if samplesToCopy == len(buffer) {
-			b.buffers = b.buffers[1:]
-		} else {
-			b.buffers[0] = buffer[samplesToCopy:]
-		}
+	if b.windowTapsReads() {
+		b.updateWindow(dst[:count])
 	}
 
-	b.availableSamples -= count
+	// Space was made; wake a waiting writer.
+	b.cond.Broadcast()
+	return count
+}
 
-	// If the buffer was full and we've now made space, signal a waiting writer.
-	if wasFull && len(b.buffers) < b.maxBuffers {
-		b.cond.Signal()
+// readSPSC is ReadInto for a lock-free buffer.
+func (b *SharedAudioBuffer) readSPSC(dst []float32) int {
+	n := b.spsc.read(dst)
+	if n > 0 {
+		b.totalRead.Add(int64(n))
+		if b.windowTapsReads() {
+			b.updateWindow(dst[:n])
+		}
+		b.signalRoom()
 	}
+	return n
+}
 
-	return out
+// signalRoom wakes the writer of a lock-free buffer if it waits for room.
+func (b *SharedAudioBuffer) signalRoom() {
+	select {
+	case b.room <- struct{}{}:
+	default:
+	}
 }
 
 // AvailableSamples returns the total number of readable samples.
 func (b *SharedAudioBuffer) AvailableSamples() int {
+	if b.spsc != nil {
+		return b.spsc.len()
+	}
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	return b.availableSamples
+	return b.available
 }
 
 // Window (Peek) Functionality
@@ -140,37 +258,94 @@ func (b *SharedAudioBuffer) updateWindow(samples []float32) {
 	b.windowMu.Lock()
 	defer b.windowMu.Unlock()
 
-	sampleIdx := 0
-	for sampleIdx < len(samples) {
-		spaceInWindow := b.windowSize - b.writePos
-		samplesToWrite := min(len(samples)-sampleIdx, spaceInWindow)
+	// Only the most recent len(history) samples can ever be peeked.
+	if len(samples) > len(b.history) {
+		samples = samples[len(samples)-len(b.history):]
+	}
+	for len(samples) > 0 {
+		n := copy(b.history[b.writePos:], samples)
+		samples = samples[n:]
+		b.writePos = (b.writePos + n) % len(b.history)
+	}
+}
 
-		copy(b.writeWindow[b.writePos:b.writePos+samplesToWrite], samples[sampleIdx:sampleIdx+samplesToWrite])
-		b.writePos += samplesToWrite
-		sampleIdx += samplesToWrite
+// resizeHistory reallocates the history ring for the current window size and delay.
+// Must be called with windowMu held.
+func (b *SharedAudioBuffer) resizeHistory() {
+	b.history = make([]float32, b.windowSize+b.windowDelay)
+	b.writePos = 0
+}
 
-		if b.writePos >= b.windowSize {
-			b.writeWindow, b.readWindow = b.readWindow, b.writeWindow
-			b.writePos = 0
-		}
+// SetWindowTapOnRead selects where the peek window is fed from. By default it
+// follows Write, which suits live capture. Producers that run ahead of playback
+// (like a sound shader) should tap Read instead, so the window reflects the audio
+// actually being played or encoded.
+func (b *SharedAudioBuffer) SetWindowTapOnRead(onRead bool) {
+	b.tapOnRead.Store(onRead)
+}
+
+func (b *SharedAudioBuffer) windowTapsReads() bool {
+	return b.tapOnRead.Load()
+}
+
+// EnsureWindowSize grows the peek window so it holds at least size samples.
+// The window never shrinks, so multiple consumers can each request what they need.
+func (b *SharedAudioBuffer) EnsureWindowSize(size int) {
+	b.windowMu.Lock()
+	defer b.windowMu.Unlock()
+	if size <= b.windowSize {
+		return
+	}
+	b.windowSize = size
+	b.resizeHistory()
+}
+
+// SetWindowDelay makes WindowPeek return audio that is delay samples older than the
+// most recent write. This compensates for output latency so visuals line up with
+// what is heard. The delay is rounded down to a whole stereo frame.
+func (b *SharedAudioBuffer) SetWindowDelay(delay int) {
+	b.windowMu.Lock()
+	defer b.windowMu.Unlock()
+	delay = max(delay, 0) &^ 1
+	if delay == b.windowDelay {
+		return
 	}
+	b.windowDelay = delay
+	b.resizeHistory()
 }
 
 // WindowPeek returns a copy of the most recent audio data for FFT analysis.
 func (b *SharedAudioBuffer) WindowPeek() []float32 {
+	return b.WindowPeekInto(nil)
+}
+
+// WindowPeekInto is WindowPeek copying into dst, which is reused if it has
+// the capacity for the window, and returns the window.
+func (b *SharedAudioBuffer) WindowPeekInto(dst []float32) []float32 {
 	b.windowMu.RLock()
 	defer b.windowMu.RUnlock()
-	result := make([]float32, b.windowSize)
-	copy(result, b.readWindow)
+	if cap(dst) < b.windowSize {
+		dst = make([]float32, b.windowSize)
+	}
+	result := dst[:b.windowSize]
+	// The oldest sample in the ring is at writePos; the window starts there, and the
+	// delay is whatever remains between the window's end and writePos.
+	start := b.writePos
+	n := copy(result, b.history[start:])
+	copy(result[n:], b.history[:b.windowSize-n])
 	return result
 }
 
 // Helper functions and other accessors
 
 func (b *SharedAudioBuffer) TotalSamplesWritten() int64 {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	return b.totalWritten
+	return b.totalWritten.Load()
+}
+
+// TotalSamplesRead returns the number of samples consumed by Read and
+// ReadInto, e.g. by a player; discarded samples don't count.
+func (b *SharedAudioBuffer) TotalSamplesRead() int64 {
+	return b.totalRead.Load()
 }
 
 func min(a, b int) int {
@@ -0,0 +1,95 @@
+package audio
+
+import "testing"
+
+func TestSharedAudioBufferDropIfFull(t *testing.T) {
+	tests := []struct {
+		name       string
+		new        func(capacity int) *SharedAudioBuffer
+		keepsFirst bool // Drops the newest samples rather than the oldest
+	}{
+		{"Mutex", NewSharedAudioBuffer, false},
+		{"SPSC", NewSPSCAudioBuffer, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.new(1024)
+			var next float32
+			write := func(n int) {
+				samples := make([]float32, n)
+				for i := range samples {
+					samples[i] = next
+					next++
+				}
+				b.Write(samples, true)
+			}
+			for b.AvailableSamples() == int(next) {
+				write(1000) // Until samples are dropped
+			}
+			size := b.AvailableSamples()
+			write(1000)
+			if got := b.AvailableSamples(); got != size {
+				t.Fatalf("AvailableSamples() = %d after a full write, want %d", got, size)
+			}
+			out := b.Read(size)
+			first, last := out[0], out[len(out)-1]
+			wantFirst, wantLast := next-float32(size), next-1
+			if tt.keepsFirst {
+				wantFirst, wantLast = 0, float32(size-1)
+			}
+			if first != wantFirst || last != wantLast {
+				t.Errorf("read samples %v to %v, want %v to %v", first, last, wantFirst, wantLast)
+			}
+		})
+	}
+}
+
+// BenchmarkSharedAudioBuffer writes and reads a decoder-sized chunk per
+// iteration. Once the buffer exists, Write and ReadInto allocate nothing;
+// Read allocates only the slice it returns.
+func BenchmarkSharedAudioBuffer(b *testing.B) {
+	const chunk = 2 * 1024 // 1024 stereo frames
+	buffers := []struct {
+		name string
+		new  func(capacity int) *SharedAudioBuffer
+	}{
+		{"Mutex", NewSharedAudioBuffer},
+		{"SPSC", NewSPSCAudioBuffer},
+	}
+	for _, buf := range buffers {
+		b.Run(buf.name+"/Write", func(b *testing.B) {
+			sb := buf.new(4096)
+			samples := make([]float32, chunk)
+			b.ReportAllocs()
+			b.SetBytes(chunk * 4)
+			for i := 0; i < b.N; i++ {
+				sb.Write(samples, true) // Drops once full, so nothing needs to read
+			}
+		})
+		b.Run(buf.name+"/ReadInto", func(b *testing.B) {
+			sb := buf.new(4096)
+			samples := make([]float32, chunk)
+			dst := make([]float32, chunk)
+			b.ReportAllocs()
+			b.SetBytes(chunk * 4)
+			for i := 0; i < b.N; i++ {
+				sb.Write(samples, false)
+				if n := sb.ReadInto(dst); n != chunk {
+					b.Fatalf("ReadInto read %d samples, want %d", n, chunk)
+				}
+			}
+		})
+		b.Run(buf.name+"/Read", func(b *testing.B) {
+			sb := buf.new(4096)
+			samples := make([]float32, chunk)
+			b.ReportAllocs()
+			b.SetBytes(chunk * 4)
+			for i := 0; i < b.N; i++ {
+				sb.Write(samples, false)
+				if out := sb.Read(chunk); len(out) != chunk {
+					b.Fatalf("Read read %d samples, want %d", len(out), chunk)
+				}
+			}
+		})
+	}
+}
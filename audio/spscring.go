@@ -0,0 +1,61 @@
+package audio
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// spscRing is a lock-free ring of samples for exactly one writing and one
+// reading goroutine at a time. The writer only advances head and the reader
+// only advances tail, so neither ever waits for the other.
+type spscRing struct {
+	buf  []float32 // Length is a power of two, so positions wrap with mask
+	mask uint64
+	head atomic.Uint64 // Samples written since creation
+	_    [56]byte      // Keeps head and tail on separate cache lines
+	tail atomic.Uint64 // Samples read since creation
+}
+
+// newSPSCRing creates a ring of at least size samples.
+func newSPSCRing(size int) *spscRing {
+	n := uint64(1) << bits.Len64(uint64(size-1))
+	return &spscRing{buf: make([]float32, n), mask: n - 1}
+}
+
+// len returns the number of samples ready to read.
+func (r *spscRing) len() int {
+	return int(r.head.Load() - r.tail.Load())
+}
+
+// write copies as many of samples as fit and returns how many. Only the
+// writer may call it.
+func (r *spscRing) write(samples []float32) int {
+	head := r.head.Load()
+	n := min(len(samples), len(r.buf)-int(head-r.tail.Load()))
+	pos := int(head & r.mask)
+	copied := copy(r.buf[pos:], samples[:n])
+	copy(r.buf, samples[copied:n])
+	r.head.Store(head + uint64(n)) // Publishes the samples to the reader
+	return n
+}
+
+// read moves up to len(dst) samples into dst and returns how many. Only the
+// reader may call it.
+func (r *spscRing) read(dst []float32) int {
+	tail := r.tail.Load()
+	n := min(len(dst), int(r.head.Load()-tail))
+	pos := int(tail & r.mask)
+	copied := copy(dst[:n], r.buf[pos:])
+	copy(dst[copied:n], r.buf)
+	r.tail.Store(tail + uint64(n)) // Hands the space back to the writer
+	return n
+}
+
+// discard skips up to count samples and returns how many. Only the reader may
+// call it.
+func (r *spscRing) discard(count int) int {
+	tail := r.tail.Load()
+	n := min(count, int(r.head.Load()-tail))
+	r.tail.Store(tail + uint64(n))
+	return n
+}
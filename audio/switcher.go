@@ -0,0 +1,89 @@
+package audio
+
+import (
+	"sync"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+// InputSwitcher is an FFmpeg audio device whose input can be changed while it
+// runs, for playlists whose shaders each configure their own audio input. The
+// inputs write to one buffer, which the renderer and its audio channels keep
+// reading across switches.
+type InputSwitcher struct {
+	options *options.ShaderOptions
+	// The next input starts before the previous one stops, so the buffer
+	// must take concurrent writers and readers.
+	buffer *SharedAudioBuffer
+
+	mu      sync.Mutex
+	device  AudioDevice
+	started bool
+}
+
+// NewInputSwitcher creates a device for the audio input the options select.
+func NewInputSwitcher(options *options.ShaderOptions) (*InputSwitcher, error) {
+	s := &InputSwitcher{
+		options: options,
+		buffer:  NewSharedAudioBuffer(*options.AudioSampleRate * 5), // 5-second buffer
+	}
+	device, err := newFFmpegAudioDevice(options, s.buffer)
+	if err != nil {
+		return nil, err
+	}
+	s.device = device
+	return s, nil
+}
+
+// Switch replaces the input by the one the options now select, and starts it
+// if the switcher is running. The previous input keeps running if the new one
+// can't be created or started.
+func (s *InputSwitcher) Switch() error {
+	device, err := newFFmpegAudioDevice(s.options, s.buffer)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		if err := device.Start(); err != nil {
+			device.Stop()
+			return err
+		}
+		s.device.Stop()
+	}
+	s.device = device
+	return nil
+}
+
+func (s *InputSwitcher) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.device.Start(); err != nil {
+		return err
+	}
+	s.started = true
+	return nil
+}
+
+func (s *InputSwitcher) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = false
+	return s.device.Stop()
+}
+
+// SampleRate is the -audio-sample-rate every input is converted to.
+func (s *InputSwitcher) SampleRate() int {
+	return *s.options.AudioSampleRate
+}
+
+func (s *InputSwitcher) GetBuffer() *SharedAudioBuffer {
+	return s.buffer
+}
+
+func (s *InputSwitcher) DecodeUntil(targetSample int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.device.DecodeUntil(targetSample)
+}
@@ -1,16 +1,81 @@
 package audio
 
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
 // DownmixStereoToMono converts an interleaved stereo float32 buffer to mono
 // by averaging the left and right channels.
 func DownmixStereoToMono(stereo []float32) []float32 {
+	return DownmixStereoToMonoInto(nil, stereo)
+}
+
+// DownmixStereoToMonoInto is DownmixStereoToMono writing into dst, which is
+// reused if it has the capacity, and returns the mono samples.
+func DownmixStereoToMonoInto(dst, stereo []float32) []float32 {
 	if len(stereo)%2 != 0 {
 		// Handle odd-length slices, though this shouldn't happen with stereo audio
 		stereo = stereo[:len(stereo)-1]
 	}
-	mono := make([]float32, len(stereo)/2)
+	if cap(dst) < len(stereo)/2 {
+		dst = make([]float32, len(stereo)/2)
+	}
+	mono := dst[:len(stereo)/2]
 	for i := 0; i < len(mono); i++ {
 		// Average left and right channels
 		mono[i] = (stereo[i*2] + stereo[i*2+1]) * 0.5
 	}
 	return mono
 }
+
+// DecibelsToGain converts a gain in decibels to a linear amplitude factor.
+func DecibelsToGain(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// Levels returns the RMS and peak level of each channel of an interleaved
+// stereo buffer, in dBFS. Silence is reported as -120 dB.
+func Levels(stereo []float32) (rms, peak [2]float64) {
+	var sumSquares, maxAbs [2]float64
+	for i, s := range stereo {
+		ch := i % 2
+		v := math.Abs(float64(s))
+		sumSquares[ch] += v * v
+		if v > maxAbs[ch] {
+			maxAbs[ch] = v
+		}
+	}
+	frames := len(stereo) / 2
+	for ch := 0; ch < 2; ch++ {
+		rms[ch], peak[ch] = -120, -120
+		if frames > 0 && sumSquares[ch] > 0 {
+			rms[ch] = math.Max(-120, 10*math.Log10(sumSquares[ch]/float64(frames)))
+		}
+		if maxAbs[ch] > 0 {
+			peak[ch] = math.Max(-120, 20*math.Log10(maxAbs[ch]))
+		}
+	}
+	return rms, peak
+}
+
+// ParseChannelMap parses a comma-separated list of 1-based input channel
+// numbers (e.g. "3,4") into 0-based indices. The first entry feeds the left
+// output channel and the second feeds the right; a single entry feeds both.
+func ParseChannelMap(spec string) ([]int, error) {
+	parts := strings.Split(spec, ",")
+	if len(parts) > 2 {
+		return nil, fmt.Errorf("invalid audio channel map '%s': expected at most 2 channels", spec)
+	}
+	channelMap := make([]int, 0, len(parts))
+	for _, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid audio channel map '%s': channels are 1-based integers", spec)
+		}
+		channelMap = append(channelMap, n-1)
+	}
+	return channelMap, nil
+}
@@ -0,0 +1,76 @@
+// Package audiodecode decodes common audio files, WAV, MP3, FLAC and Ogg
+// Vorbis, in pure Go, for builds or machines where FFmpeg can't decode
+// -audio-input-file.
+package audiodecode
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Decoder streams the audio of a file as interleaved float32 samples.
+type Decoder interface {
+	SampleRate() int
+	Channels() int
+	// Read decodes up to len(p) samples, a whole number of frames of all
+	// channels, into p. It returns io.EOF at the end, and io.ErrShortBuffer
+	// if p can't hold a frame.
+	Read(p []float32) (int, error)
+	Close() error
+}
+
+// formats maps the extensions of the supported formats to their decoders.
+var formats = map[string]func(f *os.File) (Decoder, error){
+	".wav":  newWAVDecoder,
+	".mp3":  newMP3Decoder,
+	".flac": newFLACDecoder,
+	".ogg":  newVorbisDecoder,
+	".oga":  newVorbisDecoder,
+}
+
+// Supports reports whether Open can decode path, judging by its extension.
+func Supports(path string) bool {
+	_, ok := formats[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// Open opens path with the decoder its signature, or else its extension,
+// picks.
+func Open(path string) (Decoder, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	newDecoder := formats[strings.ToLower(filepath.Ext(path))]
+	magic := make([]byte, 12)
+	if n, _ := io.ReadFull(f, magic); n == len(magic) {
+		switch {
+		case bytes.HasPrefix(magic, []byte("RIFF")) && bytes.Equal(magic[8:], []byte("WAVE")):
+			newDecoder = newWAVDecoder
+		case bytes.HasPrefix(magic, []byte("fLaC")):
+			newDecoder = newFLACDecoder
+		case bytes.HasPrefix(magic, []byte("OggS")):
+			newDecoder = newVorbisDecoder
+		case bytes.HasPrefix(magic, []byte("ID3")), magic[0] == 0xff && magic[1]&0xe0 == 0xe0:
+			newDecoder = newMP3Decoder
+		}
+	}
+	if newDecoder == nil {
+		f.Close()
+		return nil, fmt.Errorf("unsupported audio file '%s' (valid: .wav, .mp3, .flac, .ogg)", path)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	d, err := newDecoder(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,170 @@
+package audiodecode
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+// testSamples are 16 stereo frames of 16 bits, the fewest a FLAC block holds.
+var testSamples = func() []int16 {
+	samples := make([]int16, 32)
+	for i := range samples {
+		samples[i] = int16(i*2048 - 1<<15)
+	}
+	return samples
+}()
+
+func writeWAV(t *testing.T, path string) {
+	t.Helper()
+	data := make([]byte, 44+2*len(testSamples))
+	copy(data, "RIFF")
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+	copy(data[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(data[16:], 16)
+	binary.LittleEndian.PutUint16(data[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(data[22:], 2)
+	binary.LittleEndian.PutUint32(data[24:], 44100)
+	binary.LittleEndian.PutUint32(data[28:], 44100*4)
+	binary.LittleEndian.PutUint16(data[32:], 4)
+	binary.LittleEndian.PutUint16(data[34:], 16)
+	copy(data[36:], "data")
+	binary.LittleEndian.PutUint32(data[40:], uint32(2*len(testSamples)))
+	for i, s := range testSamples {
+		binary.LittleEndian.PutUint16(data[44+2*i:], uint16(s))
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeFLAC(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	frames := len(testSamples) / 2
+	info := &meta.StreamInfo{
+		BlockSizeMin:  16,
+		BlockSizeMax:  16,
+		SampleRate:    44100,
+		NChannels:     2,
+		BitsPerSample: 16,
+		NSamples:      uint64(frames),
+	}
+	enc, err := flac.NewEncoder(f, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fr := &frame.Frame{
+		Header: frame.Header{
+			HasFixedBlockSize: true,
+			BlockSize:         uint16(frames),
+			SampleRate:        44100,
+			Channels:          frame.ChannelsLR,
+			BitsPerSample:     16,
+		},
+	}
+	for ch := 0; ch < 2; ch++ {
+		samples := make([]int32, frames)
+		for i := range samples {
+			samples[i] = int32(testSamples[i*2+ch])
+		}
+		fr.Subframes = append(fr.Subframes, &frame.Subframe{
+			SubHeader: frame.SubHeader{Pred: frame.PredVerbatim},
+			Samples:   samples,
+			NSamples:  frames,
+		})
+	}
+	if err := enc.WriteFrame(fr); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecoders(t *testing.T) {
+	want := make([]float32, len(testSamples))
+	for i, s := range testSamples {
+		want[i] = float32(s) / (1 << 15)
+	}
+	tests := []struct {
+		name  string
+		write func(*testing.T, string)
+	}{
+		{"test.wav", writeWAV},
+		{"test.flac", writeFLAC},
+	}
+	for _, tt := range tests {
+		for _, size := range []int{2, 3, 4, 31, 64} {
+			path := filepath.Join(t.TempDir(), tt.name)
+			tt.write(t, path)
+			d, err := Open(path)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if d.SampleRate() != 44100 || d.Channels() != 2 {
+				t.Errorf("%s: %d Hz, %d channels, want 44100 Hz, 2 channels", tt.name, d.SampleRate(), d.Channels())
+			}
+			if n, err := d.Read(make([]float32, 1)); n != 0 || !errors.Is(err, io.ErrShortBuffer) {
+				t.Errorf("%s: Read of less than a frame = %d, %v, want 0, io.ErrShortBuffer", tt.name, n, err)
+			}
+
+			var got []float32
+			p := make([]float32, size)
+			for {
+				n, err := d.Read(p)
+				if n%2 != 0 {
+					t.Fatalf("%s: Read(%d samples) returned %d, not whole frames", tt.name, size, n)
+				}
+				got = append(got, p[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("%s: Read: %v", tt.name, err)
+				}
+				if n == 0 {
+					t.Fatalf("%s: Read(%d samples) returned nothing without an error", tt.name, size)
+				}
+			}
+			d.Close()
+			if len(got) != len(want) {
+				t.Fatalf("%s: read %v in %d-sample reads, want %v", tt.name, got, size, want)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("%s: read %v in %d-sample reads, want %v", tt.name, got, size, want)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestResampleShortBuffer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wav")
+	writeWAV(t, path)
+	d, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	r := Resample(d, 48000)
+	if n, err := r.Read(make([]float32, 1)); n != 0 || !errors.Is(err, io.ErrShortBuffer) {
+		t.Errorf("Read of less than a frame = %d, %v, want 0, io.ErrShortBuffer", n, err)
+	}
+	if n, err := r.Read(make([]float32, 2)); n != 2 || err != nil {
+		t.Errorf("Read of a frame = %d, %v, want 2, nil", n, err)
+	}
+}
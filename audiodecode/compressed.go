@@ -0,0 +1,119 @@
+package audiodecode
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/jfreymuth/oggvorbis"
+	"github.com/mewkiz/flac"
+)
+
+// mp3Decoder reads MP3, which go-mp3 decodes to 16-bit stereo.
+type mp3Decoder struct {
+	f   *os.File
+	d   *mp3.Decoder
+	buf []byte
+}
+
+func newMP3Decoder(f *os.File) (Decoder, error) {
+	d, err := mp3.NewDecoder(f)
+	if err != nil {
+		return nil, err
+	}
+	return &mp3Decoder{f: f, d: d}, nil
+}
+
+func (d *mp3Decoder) SampleRate() int { return d.d.SampleRate() }
+func (d *mp3Decoder) Channels() int   { return 2 }
+func (d *mp3Decoder) Close() error    { return d.f.Close() }
+
+func (d *mp3Decoder) Read(p []float32) (int, error) {
+	if len(p) < 2 {
+		return 0, io.ErrShortBuffer
+	}
+	n := len(p) &^ 1
+	if cap(d.buf) < n*2 {
+		d.buf = make([]byte, n*2)
+	}
+	read, err := io.ReadFull(d.d, d.buf[:n*2])
+	n = read / 4 * 2
+	for i := range p[:n] {
+		p[i] = float32(int16(binary.LittleEndian.Uint16(d.buf[i*2:]))) / (1 << 15)
+	}
+	if n > 0 {
+		err = nil
+	} else if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// flacDecoder reads FLAC a frame at a time.
+type flacDecoder struct {
+	f      *os.File
+	stream *flac.Stream
+	scale  float32
+	frame  []float32 // Interleaved samples of the last frame
+	pos    int       // In frame of the next sample to read
+}
+
+func newFLACDecoder(f *os.File) (Decoder, error) {
+	stream, err := flac.New(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	return &flacDecoder{f: f, stream: stream, scale: 1 / float32(int64(1)<<(stream.Info.BitsPerSample-1))}, nil
+}
+
+func (d *flacDecoder) SampleRate() int { return int(d.stream.Info.SampleRate) }
+func (d *flacDecoder) Channels() int   { return int(d.stream.Info.NChannels) }
+func (d *flacDecoder) Close() error    { return d.f.Close() }
+
+func (d *flacDecoder) Read(p []float32) (int, error) {
+	channels := d.Channels()
+	if len(p) < channels {
+		return 0, io.ErrShortBuffer
+	}
+	if d.pos == len(d.frame) {
+		frame, err := d.stream.ParseNext()
+		if err != nil {
+			return 0, err // io.EOF after the last frame
+		}
+		d.frame, d.pos = d.frame[:0], 0
+		for i := 0; i < int(frame.BlockSize); i++ {
+			for _, subframe := range frame.Subframes {
+				d.frame = append(d.frame, float32(subframe.Samples[i])*d.scale)
+			}
+		}
+	}
+	n := copy(p[:len(p)/channels*channels], d.frame[d.pos:])
+	d.pos += n
+	return n, nil
+}
+
+// vorbisDecoder reads Ogg Vorbis, which oggvorbis decodes to float32.
+type vorbisDecoder struct {
+	f *os.File
+	*oggvorbis.Reader
+}
+
+func newVorbisDecoder(f *os.File) (Decoder, error) {
+	r, err := oggvorbis.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	return &vorbisDecoder{f: f, Reader: r}, nil
+}
+
+func (d *vorbisDecoder) Close() error { return d.f.Close() }
+
+func (d *vorbisDecoder) Read(p []float32) (int, error) {
+	channels := d.Channels()
+	if len(p) < channels {
+		return 0, io.ErrShortBuffer
+	}
+	return d.Reader.Read(p[:len(p)/channels*channels])
+}
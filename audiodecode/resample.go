@@ -0,0 +1,99 @@
+package audiodecode
+
+import "io"
+
+// resampler converts a decoder's sample rate by linear interpolation, which
+// is plenty for driving audio-reactive shaders but not for listening
+// critically.
+type resampler struct {
+	Decoder
+	rate     int
+	step     float64   // Input frames per output frame
+	pos      float64   // Of the next output frame, relative to prev
+	prev     []float32 // Input frames prev and next
+	next     []float32
+	in       []float32 // Decoded input frames not used yet
+	inPos    int
+	eof      bool
+	inBuffer []float32
+}
+
+// Resample returns d converted to rate, or d if it already has that rate.
+func Resample(d Decoder, rate int) Decoder {
+	if d.SampleRate() == rate {
+		return d
+	}
+	channels := d.Channels()
+	return &resampler{
+		Decoder:  d,
+		rate:     rate,
+		step:     float64(d.SampleRate()) / float64(rate),
+		inBuffer: make([]float32, 4096*channels),
+	}
+}
+
+func (r *resampler) SampleRate() int { return r.rate }
+
+// advance moves prev and next one input frame on, and reports false at the
+// end of the input.
+func (r *resampler) advance() (bool, error) {
+	channels := r.Channels()
+	for r.inPos == len(r.in) {
+		if r.eof {
+			return false, nil
+		}
+		n, err := r.Decoder.Read(r.inBuffer)
+		r.in, r.inPos = r.inBuffer[:n], 0
+		if err == io.EOF {
+			r.eof = true
+		} else if err != nil {
+			return false, err
+		}
+	}
+	if r.next == nil {
+		r.prev, r.next = make([]float32, channels), make([]float32, channels)
+	}
+	r.prev, r.next = r.next, r.prev
+	copy(r.next, r.in[r.inPos:r.inPos+channels])
+	r.inPos += channels
+	return true, nil
+}
+
+func (r *resampler) Read(p []float32) (int, error) {
+	channels := r.Channels()
+	if len(p) < channels {
+		return 0, io.ErrShortBuffer
+	}
+	if r.next == nil { // Load the first two input frames
+		for i := 0; i < 2; i++ {
+			if ok, err := r.advance(); !ok {
+				if err == nil {
+					err = io.EOF
+				}
+				return 0, err
+			}
+		}
+	}
+	n := 0
+	for ; n+channels <= len(p); n += channels {
+		for r.pos >= 1 {
+			ok, err := r.advance()
+			if err != nil {
+				return n, err
+			}
+			if !ok {
+				if n == 0 {
+					return 0, io.EOF
+				}
+				return n, nil
+			}
+			r.pos--
+		}
+		t := float32(r.pos)
+		for ch := 0; ch < channels; ch++ {
+			p[n+ch] = r.prev[ch] + (r.next[ch]-r.prev[ch])*t
+		}
+		r.pos += r.step
+	}
+	return n, nil
+}
@@ -0,0 +1,120 @@
+package audiodecode
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// wavDecoder reads integer PCM of 8 to 32 bits and float PCM of 32 or 64
+// bits from a WAV file.
+type wavDecoder struct {
+	f          *os.File
+	r          io.Reader // The data chunk
+	sampleRate int
+	channels   int
+	format     uint16 // 1 integer PCM, 3 float
+	bytes      int    // Per sample
+	buf        []byte
+}
+
+func newWAVDecoder(f *os.File) (Decoder, error) {
+	br := bufio.NewReader(f)
+	var riff [12]byte
+	if _, err := io.ReadFull(br, riff[:]); err != nil {
+		return nil, err
+	}
+	if string(riff[:4]) != "RIFF" || string(riff[8:]) != "WAVE" {
+		return nil, errors.New("not a RIFF WAVE file")
+	}
+	d := &wavDecoder{f: f}
+	for {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(br, binary.LittleEndian, &chunk); err != nil {
+			return nil, fmt.Errorf("no data chunk: %w", err)
+		}
+		switch string(chunk.ID[:]) {
+		case "fmt ":
+			if chunk.Size < 16 {
+				return nil, errors.New("short fmt chunk")
+			}
+			fmtChunk := make([]byte, chunk.Size+chunk.Size&1)
+			if _, err := io.ReadFull(br, fmtChunk); err != nil {
+				return nil, err
+			}
+			d.format = binary.LittleEndian.Uint16(fmtChunk[0:])
+			d.channels = int(binary.LittleEndian.Uint16(fmtChunk[2:]))
+			d.sampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:]))
+			d.bytes = int(binary.LittleEndian.Uint16(fmtChunk[14:])+7) / 8
+			if d.format == 0xfffe && chunk.Size >= 26 { // WAVE_FORMAT_EXTENSIBLE: the sub format starts with the format
+				d.format = binary.LittleEndian.Uint16(fmtChunk[24:])
+			}
+		case "data":
+			if d.channels == 0 {
+				return nil, errors.New("data chunk before fmt chunk")
+			}
+			switch {
+			case d.format == 1 && d.bytes >= 1 && d.bytes <= 4:
+			case d.format == 3 && (d.bytes == 4 || d.bytes == 8):
+			default:
+				return nil, fmt.Errorf("unsupported WAV format %d with %d bits", d.format, d.bytes*8)
+			}
+			d.r = br
+			if chunk.Size != math.MaxUint32 { // Unknown when written to a pipe
+				d.r = io.LimitReader(br, int64(chunk.Size))
+			}
+			return d, nil
+		default:
+			if _, err := br.Discard(int(chunk.Size + chunk.Size&1)); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (d *wavDecoder) SampleRate() int { return d.sampleRate }
+func (d *wavDecoder) Channels() int   { return d.channels }
+func (d *wavDecoder) Close() error    { return d.f.Close() }
+
+func (d *wavDecoder) Read(p []float32) (int, error) {
+	if len(p) < d.channels {
+		return 0, io.ErrShortBuffer
+	}
+	n := len(p) / d.channels * d.channels
+	if cap(d.buf) < n*d.bytes {
+		d.buf = make([]byte, n*d.bytes)
+	}
+	read, err := io.ReadFull(d.r, d.buf[:n*d.bytes])
+	n = read / d.bytes / d.channels * d.channels
+	if n > 0 {
+		err = nil
+	} else if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	b := d.buf
+	for i := range p[:n] {
+		s := b[i*d.bytes:]
+		switch {
+		case d.format == 3 && d.bytes == 4:
+			p[i] = math.Float32frombits(binary.LittleEndian.Uint32(s))
+		case d.format == 3:
+			p[i] = float32(math.Float64frombits(binary.LittleEndian.Uint64(s)))
+		case d.bytes == 1: // Unsigned
+			p[i] = float32(int(s[0])-128) / 128
+		default: // Signed, left-justified into 32 bits
+			var v uint32
+			for j := 0; j < d.bytes; j++ {
+				v |= uint32(s[j]) << (8 * (4 - d.bytes + j))
+			}
+			p[i] = float32(int32(v)) / (1 << 31)
+		}
+	}
+	return n, err
+}
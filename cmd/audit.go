@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"runtime"
+
+	api "github.com/richinsley/goshadertoy/api"
+	audio "github.com/richinsley/goshadertoy/audio"
+	graphics "github.com/richinsley/goshadertoy/graphics"
+	headless "github.com/richinsley/goshadertoy/headless"
+	options "github.com/richinsley/goshadertoy/options"
+	renderer "github.com/richinsley/goshadertoy/renderer"
+)
+
+// auditAmplification scales the differences in the diff panel of the audit
+// image, so that divergence of a few code values is visible.
+const auditAmplification = 16
+
+// runPrecisionAudit renders the shader through the GLES path and the desktop
+// GL 4.1 path, prints how far the two renders diverge and writes them side by
+// side with an amplified difference to -audit-output. It returns the process
+// exit code: 1 if the renders differ visibly, 2 if either path fails.
+func runPrecisionAudit(shaderArgs *api.ShaderArgs, opts *options.ShaderOptions) int {
+	if runtime.GOOS != "linux" {
+		log.Printf("Precision audit needs headless EGL rendering, which is only supported on Linux")
+		return 2
+	}
+
+	// Renders are compared as floats, so the offscreen frame must be a float one.
+	bitDepth := 10
+	opts.BitDepth = &bitDepth
+
+	paths := []struct {
+		name       string
+		newContext func(width, height int) (graphics.Context, error)
+	}{
+		{"GLES 3.0", func(w, h int) (graphics.Context, error) { return headless.NewHeadless(w, h) }},
+		{"GL 4.1", func(w, h int) (graphics.Context, error) { return headless.NewHeadlessGL(w, h) }},
+	}
+	var renders [2][]float32
+	for i, path := range paths {
+		pixels, err := renderAuditPath(path.newContext, shaderArgs, opts)
+		if err != nil {
+			log.Printf("Failed to render the %s path: %v", path.name, err)
+			return 2
+		}
+		renders[i] = pixels
+	}
+
+	width, height := *opts.Width, *opts.Height
+	stats := comparePrecision(renders[0], renders[1])
+	fmt.Printf("%s: %s vs %s at %dx%d, frame %d, precision %s\n", shaderArgs.Title, paths[0].name, paths[1].name,
+		width, height, *opts.AuditFrames-1, *opts.Precision)
+	fmt.Printf("  max difference:  %.6f (%.1f/255)\n", stats.max, stats.max*255)
+	fmt.Printf("  mean difference: %.6f\n", stats.mean)
+	fmt.Printf("  RMSE:            %.6f\n", stats.rmse)
+	fmt.Printf("  PSNR:            %.2f dB\n", stats.psnr)
+	fmt.Printf("  pixels off by more than 1/255: %d (%.3f%%)\n", stats.visible, 100*float64(stats.visible)/float64(width*height))
+
+	if err := writeAuditImage(*opts.AuditOutput, renders[0], renders[1], width, height); err != nil {
+		log.Printf("Failed to write audit image: %v", err)
+		return 2
+	}
+	log.Printf("Wrote %s (%s | %s | difference x%d)", *opts.AuditOutput, paths[0].name, paths[1].name, auditAmplification)
+
+	if stats.visible > 0 {
+		return 1
+	}
+	return 0
+}
+
+// renderAuditPath renders the shader offscreen in a context from newContext
+// and returns its last audit frame.
+func renderAuditPath(newContext func(width, height int) (graphics.Context, error), shaderArgs *api.ShaderArgs, opts *options.ShaderOptions) ([]float32, error) {
+	ctx, err := newContext(*opts.Width, *opts.Height)
+	if err != nil {
+		return nil, err
+	}
+	defer ctx.Shutdown()
+
+	r, err := renderer.NewRenderer(*opts.Width, *opts.Height, true, *opts.BitDepth, *opts.NumPBOs, audio.NewNullDevice(44100), ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create renderer: %w", err)
+	}
+	defer r.Shutdown()
+	if *opts.Stereo != "" {
+		if err := r.SetStereo(*opts.Stereo, *opts.EyeSeparation); err != nil {
+			return nil, fmt.Errorf("failed to set up stereo: %w", err)
+		}
+	}
+	scene, err := r.LoadScene(shaderArgs, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load scene: %w", err)
+	}
+	r.SetScene(scene)
+	return r.RenderStill(*opts.AuditFrames, float64(*opts.FPS)), nil
+}
+
+// precisionStats summarizes the differences of the color channels of two
+// renders, with values clamped to the displayable range.
+type precisionStats struct {
+	max     float64
+	mean    float64
+	rmse    float64
+	psnr    float64 // +Inf for identical renders
+	visible int     // Pixels with a channel off by more than one 8-bit code value
+}
+
+func comparePrecision(a, b []float32) precisionStats {
+	var s precisionStats
+	var sum, sumSquares float64
+	for i := 0; i < len(a); i += 4 {
+		pixelMax := 0.0
+		for c := 0; c < 3; c++ {
+			d := math.Abs(clamp01(a[i+c]) - clamp01(b[i+c]))
+			sum += d
+			sumSquares += d * d
+			pixelMax = math.Max(pixelMax, d)
+		}
+		s.max = math.Max(s.max, pixelMax)
+		if pixelMax > 1.0/255 {
+			s.visible++
+		}
+	}
+	n := float64(len(a) / 4 * 3)
+	s.mean = sum / n
+	s.rmse = math.Sqrt(sumSquares / n)
+	s.psnr = 20 * math.Log10(1/s.rmse)
+	return s
+}
+
+// writeAuditImage writes the renders a and b and their amplified difference
+// side by side as a PNG.
+func writeAuditImage(path string, a, b []float32, width, height int) error {
+	img := image.NewNRGBA(image.Rect(0, 0, 3*width, height))
+	toByte := func(v float64) uint8 { return uint8(math.Round(math.Min(1, v) * 255)) }
+	for y := 0; y < height; y++ {
+		row := (height - 1 - y) * width * 4 // Renders are bottom row first
+		for x := 0; x < width; x++ {
+			i := row + x*4
+			var diff [3]uint8
+			for c := range diff {
+				diff[c] = toByte(math.Abs(clamp01(a[i+c])-clamp01(b[i+c])) * auditAmplification)
+			}
+			img.SetNRGBA(x, y, color.NRGBA{toByte(clamp01(a[i])), toByte(clamp01(a[i+1])), toByte(clamp01(a[i+2])), 255})
+			img.SetNRGBA(width+x, y, color.NRGBA{toByte(clamp01(b[i])), toByte(clamp01(b[i+1])), toByte(clamp01(b[i+2])), 255})
+			img.SetNRGBA(2*width+x, y, color.NRGBA{diff[0], diff[1], diff[2], 255})
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// clamp01 clamps v to [0, 1]; NaN becomes 0.
+func clamp01(v float32) float64 {
+	if !(v > 0) {
+		return 0
+	}
+	return math.Min(1, float64(v))
+}
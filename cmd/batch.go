@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+// batchJob is one shader of a batch run and its status.
+type batchJob struct {
+	Index     int       `json:"index"`
+	ShaderID  string    `json:"shader"`
+	Output    string    `json:"output"`
+	Log       string    `json:"log"`
+	State     string    `json:"state"` // queued, running, done, failed or cancelled
+	Error     string    `json:"error,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	Elapsed   float64   `json:"elapsedSeconds,omitempty"`
+}
+
+// batchRunner renders every shader of the queue to its own file. Each job runs
+// in a child process in record mode, so every worker has its own (headless)
+// contexts and a failing shader cannot take down the rest of the queue.
+type batchRunner struct {
+	options *options.ShaderOptions
+	jobs    []*batchJob
+
+	mu        sync.Mutex
+	cancelled bool
+	running   map[*batchJob]*exec.Cmd
+
+	statusMu sync.Mutex // Serializes writes of the status file
+}
+
+// batchOutputPath expands the -batch-output pattern for a job.
+func batchOutputPath(pattern, shaderID string, index int) string {
+	return strings.NewReplacer("{id}", shaderID, "{n}", strconv.Itoa(index)).Replace(pattern)
+}
+
+// runBatch renders each shader and returns the number of failed jobs.
+func runBatch(shaderIDs []string, options *options.ShaderOptions) int {
+	b := &batchRunner{options: options, running: make(map[*batchJob]*exec.Cmd)}
+	for i, id := range shaderIDs {
+		output := batchOutputPath(*options.BatchOutput, id, i+1)
+		b.jobs = append(b.jobs, &batchJob{Index: i + 1, ShaderID: id, Output: output, Log: output + ".log", State: "queued"})
+	}
+
+	workers := *options.Jobs
+	if workers > len(b.jobs) {
+		workers = len(b.jobs)
+	}
+	log.Printf("Batch: rendering %d shaders with %d worker(s)", len(b.jobs), workers)
+	b.handleSignals()
+
+	queue := make(chan *batchJob)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				b.run(job)
+			}
+		}()
+	}
+	for _, job := range b.jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	failed := 0
+	for _, job := range b.jobs {
+		if job.State != "done" {
+			failed++
+		}
+	}
+	log.Printf("Batch finished: %d succeeded, %d failed or cancelled", len(b.jobs)-failed, failed)
+	return failed
+}
+
+// run renders one job in a child process.
+func (b *batchRunner) run(job *batchJob) {
+	b.mu.Lock()
+	if b.cancelled {
+		job.State = "cancelled"
+		b.mu.Unlock()
+		b.writeStatus()
+		return
+	}
+
+	if dir := filepath.Dir(job.Output); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			job.State, job.Error = "failed", err.Error()
+			b.mu.Unlock()
+			log.Printf("[%d/%d] %s: failed: %v", job.Index, len(b.jobs), job.ShaderID, err)
+			b.writeStatus()
+			return
+		}
+	}
+	logFile, err := os.Create(job.Log)
+	if err != nil {
+		job.State, job.Error = "failed", err.Error()
+		b.mu.Unlock()
+		log.Printf("[%d/%d] %s: failed: %v", job.Index, len(b.jobs), job.ShaderID, err)
+		b.writeStatus()
+		return
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(os.Args[0], b.childArgs(job)...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	job.State = "running"
+	job.StartedAt = time.Now()
+	err = cmd.Start()
+	if err == nil {
+		b.running[job] = cmd
+	}
+	b.mu.Unlock()
+	log.Printf("[%d/%d] %s: rendering to %s", job.Index, len(b.jobs), job.ShaderID, job.Output)
+	b.writeStatus()
+
+	if err == nil {
+		err = cmd.Wait()
+	}
+
+	b.mu.Lock()
+	delete(b.running, job)
+	job.Elapsed = time.Since(job.StartedAt).Seconds()
+	if err != nil {
+		job.State, job.Error = "failed", err.Error()
+	} else {
+		job.State = "done"
+	}
+	b.mu.Unlock()
+
+	if err != nil {
+		log.Printf("[%d/%d] %s: failed after %.1fs: %v (see %s)", job.Index, len(b.jobs), job.ShaderID, job.Elapsed, err, job.Log)
+	} else {
+		log.Printf("[%d/%d] %s: done in %.1fs", job.Index, len(b.jobs), job.ShaderID, job.Elapsed)
+	}
+	b.writeStatus()
+}
+
+// childArgs returns the command line for a job: the batch's own flags with the
+// shader, mode and output overridden. Later flags win, so the overrides are
+// simply appended. Servers are disabled since their ports would collide.
+func (b *batchRunner) childArgs(job *batchJob) []string {
+	args := append([]string(nil), os.Args[1:]...)
+	return append(args,
+		"-mode=record",
+		"-shader="+job.ShaderID,
+		"-output="+job.Output,
+		"-outputs=",
+		"-preview=",
+		"-control=",
+	)
+}
+
+// handleSignals stops queueing new jobs on SIGINT or SIGTERM. Running jobs
+// finalize their outputs: Ctrl-C already reaches them through the terminal's
+// process group, and SIGTERM is forwarded.
+func (b *batchRunner) handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range signals {
+			b.mu.Lock()
+			b.cancelled = true
+			log.Printf("Batch: received %v, stopping %d running job(s) and cancelling the rest...", sig, len(b.running))
+			if sig == syscall.SIGTERM {
+				for _, cmd := range b.running {
+					if err := cmd.Process.Signal(sig); err != nil {
+						cmd.Process.Kill()
+					}
+				}
+			}
+			b.mu.Unlock()
+		}
+	}()
+}
+
+// writeStatus writes the state of every job to the -batch-status file, if set.
+func (b *batchRunner) writeStatus() {
+	if *b.options.BatchStatus == "" {
+		return
+	}
+	b.statusMu.Lock()
+	defer b.statusMu.Unlock()
+	b.mu.Lock()
+	data, err := json.MarshalIndent(b.jobs, "", "  ")
+	b.mu.Unlock()
+	if err != nil {
+		return
+	}
+	tmp := *b.options.BatchStatus + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("Batch: failed to write status: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, *b.options.BatchStatus); err != nil {
+		log.Printf("Batch: failed to write status: %v", err)
+	}
+}
+
+// validateBatchOptions checks the batch flags.
+func validateBatchOptions(options *options.ShaderOptions, shaderIDs []string) error {
+	if *options.Jobs < 1 {
+		return fmt.Errorf("invalid -jobs %d. Must be at least 1", *options.Jobs)
+	}
+	if len(shaderIDs) > 1 && !strings.Contains(*options.BatchOutput, "{id}") && !strings.Contains(*options.BatchOutput, "{n}") {
+		return fmt.Errorf("-batch-output '%s' must contain {id} or {n} so each shader gets its own file", *options.BatchOutput)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/richinsley/goshadertoy/audio"
+	options "github.com/richinsley/goshadertoy/options"
+	renderer "github.com/richinsley/goshadertoy/renderer"
+	timesource "github.com/richinsley/goshadertoy/timesource"
+)
+
+// setUpClock gives the renderer the time source of the ltc or ntp clock. The
+// returned function stops it.
+func setUpClock(r *renderer.Renderer, opts *options.ShaderOptions) (func(), error) {
+	switch *opts.Clock {
+	case "ltc":
+		// The timecode input is a capture of its own that is never played.
+		inputOpts := *opts
+		inputOpts.AudioInputDevice = opts.TimecodeInput
+		inputOpts.AudioInputFile = new(string)
+		inputOpts.AudioOutputDevice = new(string)
+		device, err := audio.NewFFmpegAudioDevice(&inputOpts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open timecode input: %w", err)
+		}
+		if err := device.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start timecode input: %w", err)
+		}
+		r.SetTimecodeInput(device)
+		return func() { device.Stop() }, nil
+	case "ntp":
+		epoch, err := time.Parse(time.RFC3339, *opts.ClockEpoch)
+		if err != nil {
+			return nil, err
+		}
+		source := timesource.NewNTPClock(*opts.NTPServer)
+		r.SetNTPClock(source, epoch)
+		return func() { source.Close() }, nil
+	}
+	return func() {}, nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/richinsley/goshadertoy/api"
+	audio "github.com/richinsley/goshadertoy/audio"
+	config "github.com/richinsley/goshadertoy/config"
+	control "github.com/richinsley/goshadertoy/control"
+	inputs "github.com/richinsley/goshadertoy/inputs"
+	options "github.com/richinsley/goshadertoy/options"
+	renderer "github.com/richinsley/goshadertoy/renderer"
+)
+
+// sceneController owns the loaded scenes and switches between them. It is shared
+// by the keyboard shortcuts and the web controller.
+type sceneController struct {
+	r           *renderer.Renderer
+	audioDevice audio.AudioDevice
+	sound       *soundSwitcher // Plays each scene's sound shader; nil if none has one
+	options     *options.ShaderOptions
+	sceneCache  map[string]*renderer.Scene
+	sceneArgs   map[string]*api.ShaderArgs
+	sceneOrder  []string
+	// Configured uniform values per shader ID, applied when the scene becomes active
+	shaderUniforms map[string]map[string][]float32
+	// The -config file, whose shader tables set options when their scene
+	// becomes active; nil without one
+	config *config.Config
+	// audioInput switches to the audio input a scene configures; nil if the
+	// input is fixed
+	audioInput *audio.InputSwitcher
+	// resize sets the size of the output; nil if it is fixed, as for recordings
+	resize func(width, height int)
+
+	// setTitle shows the current scene and the zoom of the view, e.g. in the
+	// window title; nil if there is nowhere to show them.
+	setTitle func(string)
+
+	mu           sync.Mutex
+	currentScene int
+	fft          inputs.FFTParams
+}
+
+// switchTo activates the scene at index. It must be called on the render thread.
+func (c *sceneController) switchTo(index int) {
+	c.mu.Lock()
+	if index == c.currentScene {
+		c.mu.Unlock()
+		return // Don't switch to the same scene
+	}
+	c.currentScene = index
+	c.mu.Unlock()
+
+	sceneID := c.sceneOrder[index]
+	title := c.sceneCache[sceneID].Title
+	log.Printf("Switching to scene %d of %d: %s ('%s')", index+1, len(c.sceneOrder), sceneID, title)
+	c.applyOptions(sceneID)
+	c.r.SetScene(c.sceneCache[sceneID])
+	if c.sound != nil {
+		c.sound.play(c.sceneArgs[sceneID])
+	}
+	c.showTitle()
+	for name, value := range c.shaderUniforms[sceneID] {
+		c.r.SetUniformValue(name, value)
+	}
+
+	// Scenes keep their own channels; carry over any FFT settings changed at
+	// runtime or configured for the scene.
+	c.mu.Lock()
+	fft := c.fft
+	c.mu.Unlock()
+	if err := c.r.SetFFTParams(fft); err != nil {
+		log.Printf("Warning: failed to apply FFT settings: %v", err)
+	}
+}
+
+// audioInputOptions are the options that select and shape the audio input.
+var audioInputOptions = map[string]bool{
+	"audio-input-file":    true,
+	"audio-input-device":  true,
+	"audio-channels":      true,
+	"audio-gain":          true,
+	"audio-output-device": true,
+	"audio-backend":       true,
+}
+
+// configSwitchesAudio reports whether the shader tables of cfg, which may be
+// nil, set audio input options.
+func configSwitchesAudio(cfg *config.Config, shaderIDs []string) bool {
+	if cfg == nil {
+		return false
+	}
+	for _, id := range shaderIDs {
+		for name := range cfg.ShaderOptions(id) {
+			if audioInputOptions[name] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyOptions sets the options the config file gives the scene, and puts
+// those that changed into effect: the size of the window, the audio input, the
+// FFT settings, and the playlist's time on the scene. Options only read at
+// startup keep their first value; batch mode renders each shader with all of
+// its own. It must be called on the render thread.
+func (c *sceneController) applyOptions(sceneID string) {
+	if c.config == nil {
+		return
+	}
+	var changed []string
+	for name, value := range c.config.ShaderOptions(sceneID) {
+		f := flag.Lookup(name)
+		if f.Value.String() == value {
+			continue
+		}
+		if err := f.Value.Set(value); err != nil {
+			log.Printf("Warning: invalid value for %s of %s: %v", name, sceneID, err)
+			continue
+		}
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+
+	var resize, switchAudio, fft bool
+	for _, name := range changed {
+		switch {
+		case name == "width" || name == "height":
+			resize = true
+		case audioInputOptions[name]:
+			switchAudio = true
+		case strings.HasPrefix(name, "fft-"):
+			fft = true
+		case name == "duration":
+			// Read by the playlist
+		default:
+			log.Printf("Warning: %s sets -%s, which only takes effect at startup", sceneID, name)
+		}
+	}
+
+	if resize {
+		if c.resize != nil {
+			c.resize(*c.options.Width, *c.options.Height)
+		} else {
+			log.Printf("Warning: %s sets a resolution of %dx%d, but the output's is fixed", sceneID, *c.options.Width, *c.options.Height)
+		}
+	}
+	if switchAudio {
+		if c.audioInput != nil {
+			if err := c.audioInput.Switch(); err != nil {
+				log.Printf("Warning: failed to switch to the audio input of %s: %v", sceneID, err)
+			}
+		} else {
+			log.Printf("Warning: %s sets its own audio input, but the input of %s mode is fixed", sceneID, *c.options.Mode)
+		}
+	}
+	if fft {
+		params := inputs.FFTParamsFromOptions(c.options)
+		if err := params.Validate(); err != nil {
+			log.Printf("Warning: invalid FFT settings for %s: %v", sceneID, err)
+		} else {
+			c.mu.Lock()
+			c.fft = params
+			c.mu.Unlock()
+		}
+	}
+}
+
+// dwell returns how long the playlist shows the scene at index: the duration
+// its config table sets, or fallback.
+func (c *sceneController) dwell(index int, fallback time.Duration) time.Duration {
+	if c.config == nil {
+		return fallback
+	}
+	if s, ok := c.config.Shaders[c.sceneOrder[index]]; ok {
+		if d, err := strconv.ParseFloat(s.Options["duration"], 64); err == nil && d > 0 {
+			return time.Duration(d * float64(time.Second))
+		}
+	}
+	return fallback
+}
+
+// showTitle shows the position in a playlist and the zoom of a zoomed view.
+// It must be called on the render thread.
+func (c *sceneController) showTitle() {
+	if c.setTitle == nil {
+		return
+	}
+	c.mu.Lock()
+	current := c.currentScene
+	c.mu.Unlock()
+	title := "goshadertoy"
+	if len(c.sceneOrder) > 1 && current >= 0 {
+		title += fmt.Sprintf(" [%d/%d] %s", current+1, len(c.sceneOrder), c.sceneCache[c.sceneOrder[current]].Title)
+	}
+	if zoom := c.r.ViewZoom(); zoom > 1 {
+		title += fmt.Sprintf(" - zoom %.1fx", zoom)
+	}
+	c.setTitle(title)
+}
+
+// step activates the scene delta places from the current one, wrapping around
+// the playlist. It must be called on the render thread.
+func (c *sceneController) step(delta int) {
+	c.mu.Lock()
+	current := c.currentScene
+	c.mu.Unlock()
+	n := len(c.sceneOrder)
+	c.switchTo(((current+delta)%n + n) % n)
+}
+
+// Status implements control.Handler.
+func (c *sceneController) Status() control.Status {
+	c.mu.Lock()
+	current := c.currentScene
+	fft := c.fft
+	c.mu.Unlock()
+
+	status := control.Status{
+		Mode:         *c.options.Mode,
+		CurrentScene: current,
+		FFT:          control.FFTSettings{Smoothing: fft.Smoothing, MinDecibels: fft.MinDecibels, MaxDecibels: fft.MaxDecibels},
+		Frame:        c.r.Frames(),
+		FPS:          c.r.FPS(),
+	}
+	for _, id := range c.sceneOrder {
+		status.Scenes = append(status.Scenes, control.SceneInfo{ID: id, Title: c.sceneCache[id].Title})
+	}
+	for _, u := range c.r.CustomUniforms() {
+		status.Uniforms = append(status.Uniforms, control.UniformInfo{Name: u.Name, Components: u.Components, Value: u.Value})
+	}
+	for _, s := range c.r.EncoderStats() {
+		status.Encoders = append(status.Encoders, control.EncoderStats{
+			Output:        s.Output,
+			VideoFrames:   s.VideoFrames,
+			BytesWritten:  s.BytesWritten,
+			BitrateKbps:   s.BitrateKbps,
+			DroppedFrames: s.DroppedFrames,
+			QueuePolicy:   s.QueuePolicy,
+			QueueDepth:    s.QueueDepth,
+			QueueLength:   s.QueueLength,
+			QueuePeak:     s.QueuePeak,
+			QueueMean:     s.QueueMean,
+			QueueWaits:    s.QueueWaits,
+		})
+	}
+	if c.audioDevice != nil {
+		status.Audio.RMS, status.Audio.Peak = audio.Levels(c.audioDevice.GetBuffer().WindowPeek())
+		s := c.audioDevice.GetBuffer().Stats()
+		toMs := func(samples int64) float64 { return float64(samples) / 2 / float64(c.audioDevice.SampleRate()) * 1000 }
+		status.AudioBuffer = control.AudioBuffer{
+			QueuedMs:   toMs(int64(s.Available)),
+			CapacityMs: toMs(int64(s.Capacity)),
+			Underruns:  s.Underruns,
+			DroppedMs:  toMs(s.Dropped),
+		}
+	}
+	return status
+}
+
+// SwitchScene implements control.Handler. ref is a 1-based index, a shader ID,
+// or "next" or "previous".
+func (c *sceneController) SwitchScene(ref string) error {
+	switch ref {
+	case "next":
+		c.r.Post(func() { c.step(1) })
+		return nil
+	case "previous", "prev":
+		c.r.Post(func() { c.step(-1) })
+		return nil
+	}
+	index := -1
+	if n, err := strconv.Atoi(ref); err == nil && n >= 1 && n <= len(c.sceneOrder) {
+		index = n - 1
+	} else {
+		for i, id := range c.sceneOrder {
+			if id == ref {
+				index = i
+				break
+			}
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("no scene '%s'", ref)
+	}
+	c.r.Post(func() { c.switchTo(index) })
+	return nil
+}
+
+// SetUniform implements control.Handler.
+func (c *sceneController) SetUniform(name string, value []float32) error {
+	for _, u := range c.r.CustomUniforms() {
+		if u.Name == name {
+			if len(value) != u.Components {
+				return fmt.Errorf("uniform '%s' takes %d values, got %d", name, u.Components, len(value))
+			}
+			c.r.SetUniformValue(name, value)
+			return nil
+		}
+	}
+	return fmt.Errorf("the current scene has no adjustable uniform '%s'", name)
+}
+
+// SetFFT implements control.Handler.
+func (c *sceneController) SetFFT(settings control.FFTSettings) error {
+	c.mu.Lock()
+	params := c.fft
+	c.mu.Unlock()
+	params.Smoothing = settings.Smoothing
+	params.MinDecibels = settings.MinDecibels
+	params.MaxDecibels = settings.MaxDecibels
+	if err := params.Validate(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.fft = params
+	c.mu.Unlock()
+	c.r.Post(func() {
+		if err := c.r.SetFFTParams(params); err != nil {
+			log.Printf("Warning: failed to apply FFT settings: %v", err)
+		}
+	})
+	return nil
+}
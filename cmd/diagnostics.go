@@ -0,0 +1,195 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	arcana "github.com/richinsley/goshadertoy/arcana"
+	headless "github.com/richinsley/goshadertoy/headless"
+	logging "github.com/richinsley/goshadertoy/logging"
+	renderer "github.com/richinsley/goshadertoy/renderer"
+)
+
+// diagnosticsEnv are the environment variables that pick the display and GL
+// driver.
+var diagnosticsEnv = []string{
+	"DISPLAY", "WAYLAND_DISPLAY", "XDG_SESSION_TYPE", "XDG_CURRENT_DESKTOP",
+	"LIBGL_ALWAYS_SOFTWARE", "MESA_LOADER_DRIVER_OVERRIDE", "__GLX_VENDOR_LIBRARY_NAME",
+	"__EGL_VENDOR_LIBRARY_FILENAMES", "EGL_PLATFORM", "NVIDIA_VISIBLE_DEVICES",
+}
+
+// writeDiagnostics writes a zip to attach to bug reports to path: the build,
+// system, EGL devices, FFmpeg build and recent logs, the GL driver if probeGL
+// (which creates a hidden context, so not after a crash), and crash if not
+// empty.
+func writeDiagnostics(path string, probeGL bool, crash string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	z := zip.NewWriter(f)
+	add := func(name, content string) {
+		if err != nil {
+			return
+		}
+		var w io.Writer
+		if w, err = z.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()}); err == nil {
+			_, err = w.Write([]byte(content))
+		}
+	}
+
+	add("system.txt", systemDiagnostics())
+	if probeGL {
+		add("gpu.txt", glDiagnostics())
+	} else {
+		add("gpu.txt", "Not probed after a crash; see log.txt for the context the renderer created.\n")
+	}
+	if devices, derr := headless.EGLDevices(); derr != nil {
+		add("egl.txt", derr.Error()+"\n")
+	} else {
+		add("egl.txt", fmt.Sprintf("%d device(s)\n%s\n", len(devices), strings.Join(devices, "\n")))
+	}
+	add("ffmpeg.txt", arcana.BuildInfo())
+	logging.Redact(os.Getenv("SHADERTOY_KEY"))
+	add("log.txt", redactURLs(string(logging.Recent())))
+	if crash != "" {
+		add("crash.txt", crash)
+	}
+	if cerr := z.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// secretFlags are the flags whose values diagnostics leave out.
+var secretFlags = map[string]bool{"apikey": true, "control-token": true, "job-token": true}
+
+// urlPattern matches the URLs in flag values and log lines, e.g. the stream
+// URLs of -output and -outputs.
+var urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s|;,'"<>()]+`)
+
+// redactArgs returns args with the values of secretFlags, and the
+// credentials, query values and stream keys of URLs, replaced by REDACTED.
+// The secret flag values are also redacted from logging.Recent.
+func redactArgs(args []string) []string {
+	args = append([]string(nil), args...)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || !secretFlags[name] {
+			args[i] = redactURLs(arg)
+			continue
+		}
+		if hasValue {
+			logging.Redact(arg[strings.Index(arg, "=")+1:])
+			args[i] = arg[:strings.Index(arg, "=")+1] + "REDACTED"
+		} else if i+1 < len(args) {
+			i++
+			logging.Redact(args[i])
+			args[i] = "REDACTED"
+		}
+	}
+	return args
+}
+
+// redactURLs replaces the user info, query values and RTMP stream keys of the
+// URLs in s by REDACTED.
+func redactURLs(s string) string {
+	return urlPattern.ReplaceAllStringFunc(s, func(raw string) string {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return raw
+		}
+		if u.User != nil {
+			u.User = url.User("REDACTED")
+		}
+		if u.RawQuery != "" {
+			query := u.Query()
+			for key := range query {
+				query[key] = []string{"REDACTED"}
+			}
+			u.RawQuery = query.Encode()
+		}
+		if u.Scheme == "rtmp" || u.Scheme == "rtmps" {
+			// rtmp://host/app/key: the key publishes to the channel.
+			if app, key, ok := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/"); ok && key != "" {
+				u.Path = "/" + app + "/REDACTED"
+			}
+		}
+		return u.String()
+	})
+}
+
+// systemDiagnostics describes the build, the translator, the system and the
+// command line, without secrets.
+func systemDiagnostics() string {
+	var b strings.Builder
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(&b, "goshadertoy %s\n", info.Main.Version)
+		for _, s := range info.Settings {
+			if strings.HasPrefix(s.Key, "vcs.") {
+				fmt.Fprintf(&b, "  %s=%s\n", s.Key, s.Value)
+			}
+		}
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/richinsley/goshadertranslator" {
+				fmt.Fprintf(&b, "goshadertranslator %s\n", dep.Version)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "%s %s/%s, %d CPUs\n", runtime.Version(), runtime.GOOS, runtime.GOARCH, runtime.NumCPU())
+	fmt.Fprintf(&b, "time: %s\n", time.Now().Format(time.RFC3339))
+
+	fmt.Fprintf(&b, "command line: %s\n", strings.Join(redactArgs(os.Args), " "))
+	b.WriteString("environment:\n")
+	for _, name := range diagnosticsEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			fmt.Fprintf(&b, "  %s=%s\n", name, value)
+		}
+	}
+	return b.String()
+}
+
+// glDiagnostics describes the GL driver of a hidden context, as validate
+// creates.
+func glDiagnostics() string {
+	ctx, err := newValidationContext()
+	if err != nil {
+		return fmt.Sprintf("Failed to create graphics context: %v\n", err)
+	}
+	defer ctx.Shutdown()
+	ctx.MakeCurrent()
+	info, err := renderer.GLInfo(ctx)
+	if err != nil {
+		return err.Error() + "\n"
+	}
+	return info
+}
+
+// reportPanic, deferred by main, writes a crash report when the main
+// goroutine panics and then panics on. Panics of other goroutines bypass it.
+func reportPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	path := fmt.Sprintf("goshadertoy-crash-%s.zip", time.Now().Format("20060102-150405"))
+	if err := writeDiagnostics(path, false, fmt.Sprintf("panic: %v\n\n%s", r, debug.Stack())); err != nil {
+		log.Printf("Failed to write crash report: %v", err)
+	} else {
+		log.Printf("Wrote crash report to %s; please attach it to bug reports", path)
+	}
+	panic(r)
+}
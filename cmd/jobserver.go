@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	api "github.com/richinsley/goshadertoy/api"
+	arcana "github.com/richinsley/goshadertoy/arcana"
+	audio "github.com/richinsley/goshadertoy/audio"
+	glfwcontext "github.com/richinsley/goshadertoy/glfwcontext"
+	graphics "github.com/richinsley/goshadertoy/graphics"
+	headless "github.com/richinsley/goshadertoy/headless"
+	jobs "github.com/richinsley/goshadertoy/jobs"
+	options "github.com/richinsley/goshadertoy/options"
+	renderer "github.com/richinsley/goshadertoy/renderer"
+	systemd "github.com/richinsley/goshadertoy/systemd"
+)
+
+// jobWorker renders server jobs on the main thread. FFmpeg, the shader
+// translator, and the visual GL context are initialized once and reused.
+type jobWorker struct {
+	options  *options.ShaderOptions
+	apiKey   string
+	visual   graphics.Context
+	headless bool // Contexts are headless EGL rather than hidden GLFW windows
+}
+
+// runJobServer starts the REST API and renders submitted jobs until the process exits.
+func runJobServer(options *options.ShaderOptions, apiKey string) {
+	arcana.Init()
+
+	extension := filepath.Ext(*options.OutputFile)
+	if extension == "" {
+		extension = ".mp4"
+	}
+	server, err := jobs.NewServer(*options.JobDir, extension, *options.JobQueueSize, *options.JobToken)
+	if err != nil {
+		log.Fatalf("Failed to start job server: %v", err)
+	}
+	server.SetRetention(time.Duration(*options.JobTTL*float64(time.Second)), *options.JobKeep)
+
+	w := &jobWorker{options: options, apiKey: apiKey, headless: useHeadless()}
+	if w.headless {
+		w.visual, err = headless.NewHeadless(*options.Width, *options.Height)
+	} else {
+		if err = glfwcontext.InitGraphics(); err == nil {
+			defer glfwcontext.TerminateGraphics()
+			w.visual, err = glfwcontext.New(options, false, nil)
+		}
+	}
+	if err != nil {
+		log.Fatalf("Failed to create GL context: %v", err)
+	}
+	defer w.visual.Shutdown()
+
+	listeners, err := systemd.Listeners()
+	if err != nil {
+		log.Fatalf("Failed to use activation socket: %v", err)
+	}
+	if len(listeners) > 0 {
+		// Socket activated: systemd owns the address, -listen is ignored.
+		server.Serve(listeners[0])
+	} else {
+		server.ListenAndServe(*options.ListenAddr)
+	}
+	if err := systemd.Notify("READY=1\nSTATUS=Waiting for jobs"); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	server.Run(w.render)
+}
+
+// jobOptions returns the server options with the job's settings applied.
+func (w *jobWorker) jobOptions(job *jobs.Job) *options.ShaderOptions {
+	opts := w.options.Clone()
+	req := job.Request
+	*opts.Mode = "record"
+	*opts.ShaderID = req.Shader
+	*opts.OutputFile = job.Output
+	*opts.Outputs = ""
+	*opts.PreviewAddr = ""
+	*opts.ControlAddr = ""
+	if req.Duration > 0 {
+		*opts.Duration = req.Duration
+	}
+	if req.Width > 0 {
+		*opts.Width = req.Width
+	}
+	if req.Height > 0 {
+		*opts.Height = req.Height
+	}
+	if req.FPS > 0 {
+		*opts.FPS = req.FPS
+	}
+	if req.BitDepth > 0 {
+		*opts.BitDepth = req.BitDepth
+	}
+	if req.Codec != "" {
+		*opts.Codec = req.Codec
+	}
+	return opts
+}
+
+// render runs one job: fetch the shader, build a renderer on the shared
+// context, and record to the job's output file.
+func (w *jobWorker) render(job *jobs.Job) error {
+	opts := w.jobOptions(job)
+
+	shaderArgs, err := api.LoadShaderArgs(w.apiKey, *opts.ShaderID, true)
+	if err != nil {
+		return fmt.Errorf("failed to load shader: %w", err)
+	}
+	overrides, err := channelOverrides(opts)
+	if err != nil {
+		return err
+	}
+	if err := api.ApplyChannelOverrides(shaderArgs, overrides); err != nil {
+		return fmt.Errorf("failed to apply channel overrides: %w", err)
+	}
+	opts.Metadata = recordingMetadata(shaderArgs, opts)
+
+	var audioDevice audio.AudioDevice
+	preRenderedAudio := make(chan []float32, 4)
+	_, opts.HasSoundShader = shaderArgs.Buffers["sound"]
+	if opts.HasSoundShader {
+		audioDevice, err = audio.NewShaderAudioDevice(opts, preRenderedAudio, 44100)
+	} else {
+		audioDevice, err = audio.NewFFmpegAudioDevice(opts)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create audio device: %w", err)
+	}
+	defer audioDevice.Stop()
+
+	w.visual.MakeCurrent()
+	r, err := renderer.NewRenderer(*opts.Width, *opts.Height, true, *opts.BitDepth, *opts.NumPBOs, audioDevice, w.visual)
+	if err != nil {
+		return fmt.Errorf("failed to create renderer: %w", err)
+	}
+	defer r.Shutdown()
+	if *opts.Stereo != "" {
+		if err := r.SetStereo(*opts.Stereo, *opts.EyeSeparation); err != nil {
+			return err
+		}
+	}
+	if *opts.Date != "" {
+		date, err := renderer.ParseDate(*opts.Date)
+		if err != nil {
+			return err
+		}
+		r.SetDate(date)
+	}
+	r.SetSeed(*opts.Seed)
+	r.SetTimeWrap(*opts.TimeWrap)
+	post, err := renderer.ParsePostConfig(*opts.Post)
+	if err != nil {
+		return err
+	}
+	if err := r.SetPost(post); err != nil {
+		return err
+	}
+	if err := r.SetTransfer(*opts.Transfer); err != nil {
+		return err
+	}
+	if err := r.SetLUT(*opts.LUT); err != nil {
+		return err
+	}
+	if err := r.SetDither(*opts.Dither); err != nil {
+		return err
+	}
+	if overlay := overlayConfig(opts); overlay.Enabled() {
+		if err := r.SetOverlay(overlay); err != nil {
+			return err
+		}
+	}
+
+	scene, err := r.LoadScene(shaderArgs, opts)
+	if err != nil {
+		return fmt.Errorf("failed to load scene: %w", err)
+	}
+	r.SetScene(scene)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if opts.HasSoundShader {
+		stopSound, err := w.startSoundRenderer(ctx, shaderArgs, opts, preRenderedAudio)
+		if err != nil {
+			return err
+		}
+		defer stopSound()
+	}
+
+	if err := audioDevice.Start(); err != nil {
+		return fmt.Errorf("failed to start audio device: %w", err)
+	}
+
+	totalFrames := int64(*opts.Duration * float64(*opts.FPS))
+	job.SetProgress(0, totalFrames)
+	job.SetCancel(r.Stop)
+	progressDone := make(chan struct{})
+	defer close(progressDone)
+	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-progressDone:
+				return
+			case <-ticker.C:
+				job.SetProgress(r.Frames(), totalFrames)
+			}
+		}
+	}()
+
+	if err := r.RunOffscreen(opts); err != nil {
+		return err
+	}
+	job.SetProgress(r.Frames(), totalFrames)
+	return nil
+}
+
+// startSoundRenderer runs the job's sound shader on its own thread and context.
+// The returned function stops it and releases the context.
+func (w *jobWorker) startSoundRenderer(ctx context.Context, shaderArgs *api.ShaderArgs, opts *options.ShaderOptions, out chan []float32) (func(), error) {
+	var soundContext graphics.Context
+	var err error
+	if w.headless {
+		soundContext, err = headless.NewHeadless(1, 1)
+	} else {
+		soundContext, err = glfwcontext.New(opts, false, w.visual.GetWindow())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sound context: %w", err)
+	}
+	// Creating a context may change the current one on this thread.
+	w.visual.MakeCurrent()
+
+	soundInput, err := newSoundInputDevice(opts, shaderArgs)
+	if err == nil && soundInput != nil {
+		err = soundInput.Start()
+	}
+	if err != nil {
+		soundContext.Shutdown()
+		w.visual.MakeCurrent()
+		return nil, fmt.Errorf("failed to open sound shader audio input: %w", err)
+	}
+	stopInput := func() {
+		if soundInput != nil {
+			soundInput.Stop()
+		}
+	}
+
+	soundRenderer := renderer.NewSoundShaderRenderer(soundContext, out, shaderArgs, opts, soundInput)
+	soundCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	initErr := make(chan error, 1)
+	go func() {
+		defer close(done)
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		defer soundContext.DetachCurrent()
+		if err := soundRenderer.InitGL(); err != nil {
+			soundRenderer.Shutdown()
+			initErr <- err
+			return
+		}
+		initErr <- nil
+		soundRenderer.Run(soundCtx)
+	}()
+	if err := <-initErr; err != nil {
+		cancel()
+		<-done
+		stopInput()
+		soundContext.Shutdown()
+		return nil, fmt.Errorf("failed to initialize sound renderer: %w", err)
+	}
+
+	return func() {
+		cancel()
+		<-done
+		stopInput()
+		soundContext.Shutdown()
+		w.visual.MakeCurrent()
+	}, nil
+}
@@ -4,25 +4,45 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"math"
+	"math/rand"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/go-gl/glfw/v3.3/glfw"
 	api "github.com/richinsley/goshadertoy/api"
 	arcana "github.com/richinsley/goshadertoy/arcana"
 	audio "github.com/richinsley/goshadertoy/audio"
+	config "github.com/richinsley/goshadertoy/config"
+	control "github.com/richinsley/goshadertoy/control"
+	encoder "github.com/richinsley/goshadertoy/encoder"
+	export "github.com/richinsley/goshadertoy/export"
 	glfwcontext "github.com/richinsley/goshadertoy/glfwcontext"
 	graphics "github.com/richinsley/goshadertoy/graphics"
 	headless "github.com/richinsley/goshadertoy/headless"
+	inputs "github.com/richinsley/goshadertoy/inputs"
+	inputscript "github.com/richinsley/goshadertoy/inputscript"
+	kms "github.com/richinsley/goshadertoy/kms"
+	logging "github.com/richinsley/goshadertoy/logging"
 	options "github.com/richinsley/goshadertoy/options"
+	preview "github.com/richinsley/goshadertoy/preview"
 	renderer "github.com/richinsley/goshadertoy/renderer"
+	sink "github.com/richinsley/goshadertoy/sink"
+	systemd "github.com/richinsley/goshadertoy/systemd"
+	texshare "github.com/richinsley/goshadertoy/texshare"
 )
 
 // gamescopeSessionResponse matches the response from the manager service.
@@ -33,13 +53,14 @@ type gamescopeSessionResponse struct {
 }
 
 // setupGamescopeSession connects to the manager to start a session and configures the environment.
-func setupGamescopeSession(options *options.ShaderOptions) {
+// The returned function stops the session if requested by the options; it is never nil.
+func setupGamescopeSession(options *options.ShaderOptions) func() {
 	if options.GamescopeSocket == nil || *options.GamescopeSocket == "" {
-		return // Not using gamescope.
+		return func() {} // Not using gamescope.
 	}
 	if runtime.GOOS != "linux" {
 		log.Println("Warning: Gamescope integration is only supported on Linux. Ignoring --gamescope-socket flag.")
-		return
+		return func() {}
 	}
 
 	log.Println("Requesting Gamescope session from manager at", *options.GamescopeSocket)
@@ -55,11 +76,17 @@ func setupGamescopeSession(options *options.ShaderOptions) {
 	sessionReq := map[string]interface{}{
 		"width":            *options.Width,
 		"height":           *options.Height,
-		"hdr_enabled":      true, // This could be made a flag in the future
-		"sdr_content_nits": 400,
+		"hdr_enabled":      *options.GamescopeHDR,
+		"sdr_content_nits": *options.GamescopeSDRNits,
 		"fullscreen":       true,
 		"fps":              *options.FPS,
 	}
+	if *options.GamescopeBackend != "" {
+		sessionReq["backend"] = *options.GamescopeBackend
+	}
+	if extraArgs := strings.Fields(*options.GamescopeArgs); len(extraArgs) > 0 {
+		sessionReq["extra_args"] = extraArgs
+	}
 	reqBody, err := json.Marshal(sessionReq)
 	if err != nil {
 		log.Fatalf("Failed to marshal gamescope session request: %v", err)
@@ -90,8 +117,8 @@ func setupGamescopeSession(options *options.ShaderOptions) {
 
 	if options.GamescopeTerminateOnExit != nil && *options.GamescopeTerminateOnExit {
 		log.Println("Will terminate gamescope session on exit.")
-		// This deferred function will execute when runShadertoy returns.
-		defer func() {
+		// The caller defers this so it runs when runShadertoy returns.
+		return func() {
 			log.Println("Terminating gamescope session...")
 			resp, err := httpClient.Post("http://localhost/session/stop", "application/json", nil)
 			if err != nil {
@@ -105,31 +132,113 @@ func setupGamescopeSession(options *options.ShaderOptions) {
 				body, _ := io.ReadAll(resp.Body)
 				log.Printf("Error stopping gamescope session: %s (%s)", resp.Status, string(body))
 			}
-		}()
+		}
 	}
+	return func() {}
+}
+
+// handleSignals stops the renderer on SIGINT or SIGTERM so that outputs are
+// finalized and the deferred cleanup in runShadertoy runs. A second signal
+// exits immediately.
+func handleSignals(r *renderer.Renderer) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("Received %v, shutting down (repeat to force quit)...", sig)
+		r.Stop()
+		sig = <-signals
+		log.Printf("Received %v again, exiting without cleanup.", sig)
+		os.Exit(1)
+	}()
+}
+
+// useHeadless reports whether offscreen rendering gets headless contexts
+// rather than hidden GLFW windows, which need a desktop: on Linux and macOS.
+func useHeadless() bool {
+	return runtime.GOOS == "linux" || runtime.GOOS == "darwin"
 }
 
-func runShadertoy(initialShaderArgs *api.ShaderArgs, shaderIDs []string, options *options.ShaderOptions) {
-	setupGamescopeSession(options)
+// runShadertoy loads the shaders and runs the selected mode. shaderUniforms holds
+// configured uniform values per shader ID and may be nil, as may cfg, the
+// -config file.
+func runShadertoy(initialShaderArgs *api.ShaderArgs, shaderIDs []string, shaderUniforms map[string]map[string][]float32, cfg *config.Config, options *options.ShaderOptions) (restart bool) {
+	stopGamescope := setupGamescopeSession(options)
+	defer stopGamescope()
 	arcana.Init()
 
+	if *options.AudioInput == audio.SystemAudioInput {
+		backend, device, err := audio.ResolveSystemLoopback(*options.AudioBackend)
+		if err != nil {
+			log.Fatalf("Cannot capture system audio: %v", err)
+		}
+		*options.AudioBackend = backend
+		*options.AudioInputDevice = device
+		log.Printf("Capturing system audio from '%s'", device)
+	}
+
 	mode := *options.Mode
 	isRecord := mode == "record" || mode == "stream"
 
 	var audioDevice audio.AudioDevice
+	var inputSwitcher *audio.InputSwitcher
 	var err error
-	soundSampleRate := 44100 // Default sample rate for audio playback
+	soundSampleRate := 44100 // Sound shaders render at Shadertoy's rate; the device resamples to -audio-sample-rate
 	// This channel connects the sound renderer (producer) to the audio feeder (consumer).
 	preRenderedAudio := make(chan []float32, 4)
 
-	// Determine if a sound shader is present
-	_, options.HasSoundShader = initialShaderArgs.Buffers["sound"]
+	// Load every shader up front: if any has a sound pass, sound shaders are
+	// the audio source and each scene plays its own.
+	overrides, _ := channelOverrides(options)
+	type loadedShader struct {
+		id   string
+		args *api.ShaderArgs
+	}
+	loaded := make([]loadedShader, 0, len(shaderIDs))
+	for i, id := range shaderIDs {
+		argsToLoad := initialShaderArgs // The arguments for the first shader are already loaded
+		if i > 0 {
+			log.Printf("Loading shader ID: %s", id)
+			argsToLoad, err = api.LoadShaderArgs("", id, true)
+			if err != nil {
+				log.Printf("Warning: Failed to load shader %s: %v", id, err)
+				continue
+			}
+			if err := api.ApplyChannelOverrides(argsToLoad, overrides); err != nil {
+				log.Printf("Warning: Failed to apply channel overrides to shader %s: %v", id, err)
+				continue
+			}
+		}
+		loaded = append(loaded, loadedShader{id, argsToLoad})
+		if _, ok := argsToLoad.Buffers["sound"]; ok {
+			options.HasSoundShader = true
+		}
+	}
+	options.Metadata = recordingMetadata(initialShaderArgs, options)
+
 	if options.HasSoundShader {
 		log.Println("Sound shader detected, using it as the primary audio source.")
+		if mode == "live" && *options.AudioOutputDevice == "" && !*options.Mute {
+			device, err := audio.DefaultOutputDevice(*options.AudioBackend)
+			if err != nil {
+				log.Printf("Warning: sound shader will not be audible: %v", err)
+			} else {
+				*options.AudioOutputDevice = device
+				log.Println("Playing sound shader through the default audio output (use -mute to disable).")
+			}
+		}
 		audioDevice, err = audio.NewShaderAudioDevice(options, preRenderedAudio, soundSampleRate)
 		if err != nil {
 			log.Fatalf("Failed to create shader audio device: %v", err)
 		}
+	} else if mode != "record" && configSwitchesAudio(cfg, shaderIDs) {
+		// Scenes configure their own audio inputs, switched with the scene.
+		// Recordings decode their input on demand and keep the first one.
+		inputSwitcher, err = audio.NewInputSwitcher(options)
+		if err != nil {
+			log.Fatalf("Failed to create audio device: %v", err)
+		}
+		audioDevice = inputSwitcher
 	} else {
 		// If there's no sound shader, use an FFmpeg device or file input
 		audioDevice, err = audio.NewFFmpegAudioDevice(options)
@@ -141,11 +250,11 @@ func runShadertoy(initialShaderArgs *api.ShaderArgs, shaderIDs []string, options
 
 	// CONTEXT CREATION
 	var visualContext, soundContext graphics.Context
-	if isRecord && runtime.GOOS == "linux" { // For recording on Linux, use headless EGL contexts
-		log.Println("Record mode on Linux: Using headless EGL contexts.")
+	if isRecord && useHeadless() { // For recording, use headless EGL or CGL contexts where available
+		log.Println("Record mode: Using headless contexts.")
 		visualContext, err = headless.NewHeadless(*options.Width, *options.Height)
 		if err != nil {
-			log.Fatalf("Failed to create headless EGL context: %v", err)
+			log.Fatalf("Failed to create headless context: %v", err)
 		}
 		if options.HasSoundShader {
 			soundContext, err = headless.NewHeadless(1, 1) // Sound context can be minimal
@@ -153,6 +262,22 @@ func runShadertoy(initialShaderArgs *api.ShaderArgs, shaderIDs []string, options
 				log.Fatalf("Failed to create headless sound context: %v", err)
 			}
 		}
+	} else if *options.KMS { // Straight to a display, without a window system
+		log.Println("Using DRM/KMS output.")
+		var width, height, hz int
+		if *options.VideoMode != "" {
+			width, height, hz, _ = glfwcontext.ParseVideoMode(*options.VideoMode)
+		}
+		visualContext, err = kms.New(*options.KMSDevice, *options.Monitor, width, height, hz)
+		if err != nil {
+			log.Fatalf("Failed to create KMS output: %v", err)
+		}
+		if options.HasSoundShader {
+			soundContext, err = headless.NewHeadless(1, 1)
+			if err != nil {
+				log.Fatalf("Failed to create headless sound context: %v", err)
+			}
+		}
 	} else { // Otherwise, use a visible GLFW context
 		log.Println("Using GLFW contexts.")
 		if err := glfwcontext.InitGraphics(); err != nil {
@@ -179,28 +304,62 @@ func runShadertoy(initialShaderArgs *api.ShaderArgs, shaderIDs []string, options
 		log.Fatalf("Failed to create renderer: %v", err)
 	}
 	defer r.Shutdown()
+	handleSignals(r)
+	if *options.Stereo != "" {
+		if err := r.SetStereo(*options.Stereo, *options.EyeSeparation); err != nil {
+			log.Fatalf("Failed to set up stereo: %v", err)
+		}
+	}
+	if *options.Viewport != "" {
+		vp, _ := parseViewport(*options.Viewport, *options.Canvas) // Checked with the flags
+		r.SetViewport(vp)
+	}
+	if *options.Date != "" {
+		date, _ := renderer.ParseDate(*options.Date) // Checked with the flags
+		r.SetDate(date)
+	}
+	r.SetSeed(*options.Seed)
+	r.SetTimeWrap(*options.TimeWrap)
+	post, _ := renderer.ParsePostConfig(*options.Post) // Checked with the flags
+	if err := r.SetPost(post); err != nil {
+		log.Fatalf("Failed to set up post-processing: %v", err)
+	}
+	if err := r.SetTransfer(*options.Transfer); err != nil {
+		log.Fatalf("Failed to set up output transfer: %v", err)
+	}
+	if err := r.SetLUT(*options.LUT); err != nil {
+		log.Fatalf("Failed to set up color grade: %v", err)
+	}
+	if err := r.SetDither(*options.Dither); err != nil {
+		log.Fatalf("Failed to set up dithering: %v", err)
+	}
+	if *options.HDROutput != "" {
+		if err := r.SetHDROutput(*options.HDROutput, *options.HDRWhite); err != nil {
+			log.Fatalf("Failed to set up HDR output: %v", err)
+		}
+	}
+	if overlay := overlayConfig(options); isRecord && overlay.Enabled() {
+		if err := r.SetOverlay(overlay); err != nil {
+			log.Fatalf("Failed to set up overlay: %v", err)
+		}
+	}
 
 	sceneCache := make(map[string]*renderer.Scene)
-	sceneOrder := make([]string, 0, len(shaderIDs))
-	var currentSceneIndex int = 0
+	sceneArgs := make(map[string]*api.ShaderArgs)
+	sceneOrder := make([]string, 0, len(loaded))
 
-	// The hardcoded list is gone. We now iterate over the `shaderIDs` slice passed into the function.
-	for i, id := range shaderIDs {
-		var argsToLoad *api.ShaderArgs
-		// The arguments for the first shader are already loaded, so we can reuse them.
-		if i == 0 {
-			argsToLoad = initialShaderArgs
-		} else {
-			log.Printf("Loading scene for shader ID: %s", id)
-			json, err := api.ShaderFromID("", id, true)
-			if err != nil {
-				log.Printf("Warning: Failed to fetch shader %s: %v", id, err)
-				continue
+	for _, shader := range loaded {
+		id, argsToLoad := shader.id, shader.args
+		// Uniform defaults declared by the shader apply unless configured otherwise.
+		for name, value := range argsToLoad.Uniforms {
+			if shaderUniforms == nil {
+				shaderUniforms = make(map[string]map[string][]float32)
 			}
-			argsToLoad, err = api.ShaderArgsFromJSON(json, true)
-			if err != nil {
-				log.Printf("Warning: Failed to process shader %s: %v", id, err)
-				continue
+			if shaderUniforms[id] == nil {
+				shaderUniforms[id] = make(map[string][]float32)
+			}
+			if _, ok := shaderUniforms[id][name]; !ok {
+				shaderUniforms[id][name] = value
 			}
 		}
 
@@ -209,16 +368,53 @@ func runShadertoy(initialShaderArgs *api.ShaderArgs, shaderIDs []string, options
 			log.Printf("Warning: Failed to load scene for shader %s: %v", id, err)
 			continue
 		}
+		if *options.ReportVRAM {
+			r.ReportVRAM(scene)
+		}
 		sceneCache[id] = scene
+		sceneArgs[id] = argsToLoad
 		sceneOrder = append(sceneOrder, id)
 	}
 
 	if len(sceneOrder) == 0 {
 		log.Fatalf("No scenes could be loaded. Exiting.")
 	}
+	if *options.Screensaver {
+		rand.Shuffle(len(sceneOrder), func(i, j int) {
+			sceneOrder[i], sceneOrder[j] = sceneOrder[j], sceneOrder[i]
+		})
+	}
+
+	// The sound switcher plays the sound shader of each scene as it becomes active.
+	var sound *soundSwitcher
+	if options.HasSoundShader {
+		sound = newSoundSwitcher(soundContext, preRenderedAudio, options)
+		defer sound.stop()
+	}
+
+	controller := &sceneController{
+		r:              r,
+		audioDevice:    audioDevice,
+		sound:          sound,
+		options:        options,
+		sceneCache:     sceneCache,
+		sceneArgs:      sceneArgs,
+		sceneOrder:     sceneOrder,
+		shaderUniforms: shaderUniforms,
+		config:         cfg,
+		audioInput:     inputSwitcher,
+		currentScene:   -1,
+		fft:            inputs.FFTParamsFromOptions(options),
+	}
+	if gctx, ok := visualContext.(*glfwcontext.Context); ok {
+		controller.setTitle = gctx.SetTitle
+		if !isRecord {
+			controller.resize = gctx.Window().SetSize
+		}
+	}
 
 	// set the initial scene
-	r.SetScene(sceneCache[sceneOrder[0]])
+	controller.switchTo(0)
 
 	// Register key callbacks for scene switching if we are in interactive mode
 	if !isRecord {
@@ -228,47 +424,101 @@ func runShadertoy(initialShaderArgs *api.ShaderArgs, shaderIDs []string, options
 				sceneIndex := i // Capture the loop variable
 				key := glfw.Key1 + glfw.Key(sceneIndex)
 
+				// Scenes stay cached so switching back is instant.
 				gctx.RegisterKeyCallback(key, func() {
-					if sceneIndex == currentSceneIndex {
-						return // Don't switch to the same scene
-					}
+					controller.switchTo(sceneIndex)
+				})
+			}
+			// Page Up and Page Down step through playlists of any length.
+			gctx.RegisterKeyCallback(glfw.KeyPageDown, func() { controller.step(1) })
+			gctx.RegisterKeyCallback(glfw.KeyPageUp, func() { controller.step(-1) })
 
-					sceneID := sceneOrder[sceneIndex]
-					log.Printf("Switching to scene %d: %s ('%s')", sceneIndex+1, sceneID, sceneCache[sceneID].Title)
+			// The scroll wheel zooms into a virtual resolution around the
+			// cursor, right-dragging pans and Home shows the whole frame.
+			gctx.SetViewCallbacks(func(steps, x, y float64) {
+				r.ZoomView(math.Pow(2, steps/2), x, y)
+				controller.showTitle()
+			}, func(dx, dy float64) {
+				r.PanView(dx, dy)
+			})
+			gctx.RegisterKeyCallback(glfw.KeyHome, func() {
+				r.ResetView()
+				controller.showTitle()
+			})
 
-					previousScene := r.SetScene(sceneCache[sceneID])
+			// F5 saves the shader's state and F9 goes back to it.
+			statePath := *options.SaveState
+			if statePath == "" {
+				statePath = "savestate.gst"
+			}
+			gctx.RegisterKeyCallback(glfw.KeyF5, func() {
+				if err := r.SaveState(statePath); err != nil {
+					log.Printf("Failed to save state: %v", err)
+				}
+			})
+			gctx.RegisterKeyCallback(glfw.KeyF9, func() {
+				if err := r.LoadState(statePath); err != nil {
+					log.Printf("Failed to load state: %v", err)
+				}
+			})
+		}
+	}
 
-					// IMPORTANT: Destroy the old scene to free up GPU resources
-					if previousScene != nil {
-						// previousScene.Destroy()
-					}
+	// The preview is shared by the standalone preview server and the control UI.
+	var pv *preview.MJPEGServer
+	if *options.PreviewAddr != "" || *options.ControlAddr != "" {
+		pv = preview.NewMJPEGServer(640, 10)
+		r.SetPreview(pv)
+	}
+	if *options.PreviewAddr != "" {
+		pv.ListenAndServe(*options.PreviewAddr)
+	}
+	if *options.ControlAddr != "" {
+		control.NewServer(controller, pv, *options.ControlToken).ListenAndServe(*options.ControlAddr)
+	}
 
-					currentSceneIndex = sceneIndex
-				})
-			}
+	// The renderer's GL context is current, so the sender shares its textures.
+	if *options.ShareOut != "" {
+		sender, err := texshare.NewSender(*options.ShareOut)
+		if err != nil {
+			log.Fatalf("Failed to share output: %v", err)
 		}
+		defer sender.Close()
+		r.SetShareSender(sender)
+		log.Printf("Sharing output through %s as '%s'", texshare.Name, *options.ShareOut)
 	}
 
 	// Start concurrent processes
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if options.HasSoundShader {
-		// The sound renderer is tied to a specific shader's arguments
-		soundRenderer := renderer.NewSoundShaderRenderer(soundContext, preRenderedAudio, initialShaderArgs, options)
-		go func() {
-			runtime.LockOSThread()
-			if err := soundRenderer.InitGL(); err != nil {
-				log.Fatalf("Failed to initialize sound renderer OpenGL: %v", err)
-			}
-			soundRenderer.Run(ctx)
-		}()
+	if *options.Screensaver && len(sceneOrder) > 1 {
+		go runPlaylist(ctx, r, controller, time.Duration(*options.Dwell*float64(time.Second)))
 	}
 
 	// Start the audio device's own internal loop
 	if err := audioDevice.Start(); err != nil {
 		log.Fatalf("Failed to start audio device: %v", err)
 	}
+	if mode == "live" {
+		stopClock, err := setUpClock(r, options)
+		if err != nil {
+			log.Fatalf("Failed to set up the %s clock: %v", *options.Clock, err)
+		}
+		defer stopClock()
+		leaveFrameLock, err := setUpFrameLock(r, options)
+		if err != nil {
+			log.Fatalf("Failed to set up frame lock: %v", err)
+		}
+		defer leaveFrameLock()
+	}
+
+	// Delay the FFT window in live mode so beat-reactive visuals line up with what is heard.
+	if mode == "live" && *options.AVOffset > 0 {
+		delaySamples := int(*options.AVOffset / 1000.0 * float64(audioDevice.SampleRate()) * 2) // stereo interleaved
+		audioDevice.GetBuffer().SetWindowDelay(delaySamples)
+		log.Printf("Audio visualization delayed by %.0f ms", *options.AVOffset)
+	}
 
 	// Run the main loop; Run() and RunOffscreen() will use the active scene set above
 	switch mode {
@@ -278,10 +528,141 @@ func runShadertoy(initialShaderArgs *api.ShaderArgs, shaderIDs []string, options
 		if err != nil {
 			log.Fatalf("Offscreen rendering failed: %v", err)
 		}
-		log.Printf("Successfully rendered to %s", *options.OutputFile)
+		if *options.Outputs != "" {
+			log.Printf("Successfully rendered to %s", *options.Outputs)
+		} else {
+			log.Printf("Successfully rendered to %s", *options.OutputFile)
+		}
 	default:
 		log.Println("Starting interactive render loop...")
-		r.Run()
+		// With -gl-watchdog a lost context restarts the process once it has
+		// cleaned up; a hung one can't clean up, so restarts at once.
+		if *options.GLWatchdog > 0 {
+			r.SetWatchdog(time.Duration(*options.GLWatchdog*float64(time.Second)), relaunch)
+		}
+		if err := r.Run(options); errors.Is(err, renderer.ErrContextLost) {
+			log.Printf("%v, restarting", err)
+			return true
+		}
+	}
+	return false
+}
+
+// relaunchDelay is how long a GPU reset is given to finish before restarting.
+const relaunchDelay = 2 * time.Second
+
+// channelOverrides parses the -channelN flags.
+func channelOverrides(options *options.ShaderOptions) ([]*api.ChannelOverride, error) {
+	var overrides []*api.ChannelOverride
+	for i, spec := range []*string{options.Channel0, options.Channel1, options.Channel2, options.Channel3} {
+		if *spec == "" {
+			continue
+		}
+		o, err := api.ParseChannelOverride(i, *spec)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, nil
+}
+
+// applyMicOverrides makes the sources of mic channel overrides the audio
+// input. There is a single audio input, so they must agree with each other
+// and with the audio input options.
+func applyMicOverrides(options *options.ShaderOptions, overrides []*api.ChannelOverride) error {
+	source := ""
+	for _, o := range overrides {
+		if (o.CType != "mic" && o.CType != "spectrogram") || o.Source == "" {
+			continue
+		}
+		if source != "" && o.Source != source {
+			return fmt.Errorf("channels read different audio inputs, '%s' and '%s'", source, o.Source)
+		}
+		source = o.Source
+	}
+	if source == "" {
+		return nil
+	}
+	if *options.AudioInput != "" || *options.AudioInputDevice != "" || *options.AudioInputFile != "" {
+		if *options.AudioInputDevice != source && *options.AudioInputFile != source {
+			return fmt.Errorf("mic source '%s' conflicts with the -audio-input options", source)
+		}
+		return nil
+	}
+	if _, err := os.Stat(source); err == nil {
+		*options.AudioInputFile = source
+	} else {
+		*options.AudioInputDevice = source
+	}
+	return nil
+}
+
+// listAudioDevices prints the capture sources and playback sinks reported by FFmpeg.
+func listAudioDevices(backend string) {
+	sources, sinks, sourceErr, sinkErr := audio.ListAudioDevices(backend)
+
+	printDevices := func(kind string, devices []audio.AudioDeviceInfo, err error) {
+		fmt.Printf("%s:\n", kind)
+		if err != nil {
+			fmt.Printf("  (unavailable: %v)\n", err)
+			return
+		}
+		if len(devices) == 0 {
+			fmt.Println("  (none found)")
+		}
+		for _, dev := range devices {
+			marker := " "
+			if dev.IsDefault {
+				marker = "*"
+			}
+			fmt.Printf(" %s %s\t%s\n", marker, dev.Name, dev.Description)
+		}
+	}
+	printDevices("Capture sources", sources, sourceErr)
+	printDevices("Playback sinks", sinks, sinkErr)
+}
+
+// listEncoders prints the encoders -codec and -audio-codec try, in order,
+// and whether each works with the linked FFmpeg on this machine, then the
+// hardware device types.
+func listEncoders() {
+	status := func(info encoder.EncoderInfo) string {
+		switch {
+		case !info.Linked:
+			return "not in this FFmpeg build"
+		case info.Err != nil:
+			return fmt.Sprintf("unavailable: %v", info.Err)
+		}
+		return "ok"
+	}
+	kind := func(info encoder.EncoderInfo) string {
+		if info.Hardware {
+			return "hardware"
+		}
+		return "software"
+	}
+
+	fmt.Printf("FFmpeg: %s\n", arcana.Linkage)
+	fmt.Println("Video encoders (-codec), in order of preference:")
+	for _, info := range encoder.VideoEncoders() {
+		fmt.Printf("  %-5s %-18s %-9s %s\n", info.Codec, info.Name, kind(info), status(info))
+	}
+	fmt.Println("Audio encoders (-audio-codec):")
+	for _, info := range encoder.AudioEncoders() {
+		fmt.Printf("  %-10s %-13s %s\n", info.Codec, info.Name, status(info))
+	}
+	fmt.Println("Hardware devices:")
+	devices := encoder.HWDevices()
+	if len(devices) == 0 {
+		fmt.Println("  (none in this FFmpeg build)")
+	}
+	for _, device := range devices {
+		if device.Err != nil {
+			fmt.Printf("  %-13s unavailable: %v\n", device.Type, device.Err)
+		} else {
+			fmt.Printf("  %-13s ok\n", device.Type)
+		}
 	}
 }
 
@@ -290,50 +671,561 @@ func init() {
 }
 
 func main() {
+	defer reportPanic()
+	if systemd.LoggingToJournal() {
+		// The journal timestamps each line.
+		log.SetFlags(0)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:]))
+	}
+
 	// Command-line flags
 	options := &options.ShaderOptions{}
+	options.ConfigFile = flag.String("config", "", "Config file, TOML or (if named .yaml or .yml) YAML, with option values and per-shader overrides applied as each shader becomes active; command line flags take precedence")
 	options.APIKey = flag.String("apikey", "", "Shadertoy API key (from SHADERTOY_KEY env var if not set)")
-	options.ShaderID = flag.String("shader", "XlSSzV", "Shadertoy shader ID or a comma-separated list of IDs")
+	options.ShaderID = flag.String("shader", "XlSSzV", "Shadertoy shader ID, local .frag/.json file, ISF .fs file or URL, glslsandbox:<id or file>, or twigl:[mode:]<file>; or a comma-separated list of them")
 	options.Help = flag.Bool("help", false, "Show help message")
-	options.Mode = flag.String("mode", "Live", "Rendering mode: Live, Record, or Stream (case-insensitive)")
+	options.Mode = flag.String("mode", "Live", "Rendering mode: Live, Record, Stream, Batch, Server, or Audit (case-insensitive); Audit compares the GLES and GL 4.1 renders of the shader")
 	options.Duration = flag.Float64("duration", 10.0, "Duration to record in seconds")
 	options.FPS = flag.Int("fps", 60, "Frames per second for recording")
 	options.Width = flag.Int("width", 1280, "Width of the output")
 	options.Height = flag.Int("height", 720, "Height of the output")
 	options.BitDepth = flag.Int("bitdepth", 8, "Bit depth for recording (8, 10, or 12)")
+	options.Transfer = flag.String("transfer", "shadertoy", "Output transfer of the shader's colors, for display and encoding alike: shadertoy (already encoded, used as they are, as on Shadertoy), srgb or gamma2.2 (linear light, encoded with the sRGB curve or a 2.2 gamma)")
+	options.Dither = flag.String("dither", "none", "Record and stream modes: dither the output before quantizing it so gradients don't band: none, triangular (TPDF white noise) or blue-noise")
 	options.OutputFile = flag.String("output", "output.mp4", "Output file name for recording")
-	options.Codec = flag.String("codec", "h264", "Video codec for encoding: h264, hevc (default: h264)")
+	options.AudioOutput = flag.String("audio-output", "", "With a -sink other than ffmpeg: write the audio as 32-bit float WAV to this file or named pipe, e.g. for 'ffmpeg -i - -i audio.fifo' next to -output -")
+	options.Sink = flag.String("sink", "ffmpeg", "Record/stream mode output: ffmpeg (encode with the linked FFmpeg), raw (yuv444p frames), y4m (YUV4MPEG2 stream), images (-output is a pattern such as frames/%05d.png) or shm (shared memory for FFmpeg's shmframe demuxer); raw, y4m and shm write to standard output with -output -")
+	options.ExportHTML = flag.String("export-html", "", "Write the shader as a standalone HTML/WebGL2 page with its inputs embedded to this file, then exit")
+	options.ReportVRAM = flag.Bool("report-vram", false, "Log the estimated GPU memory of every pass's textures and buffers after loading a shader, and warn if the resolution likely exceeds the GPU's memory")
+	options.DumpShaders = flag.String("dump-shaders", "", "Write the assembled GLSL of every pass, before and after translation, to this directory")
+	options.OutputFormat = flag.String("format", "", "Output container format (default: guessed from the output name; flv for rtmp://, mpegts for streams)")
+	options.Container = flag.String("container", "", "Output container: mkv, mov, mp4 or webm; the video and audio codecs are checked against it (default: from the output name)")
+	options.TitleCard = flag.Float64("title-card", 0, "Record and stream modes: seconds to show the shader's title, author and source over the output at the start of each scene; 0 disables it")
+	options.TitlePosition = flag.String("title-position", "bottom-left", "Position of the title card: top-left, top, top-right, center, bottom-left, bottom or bottom-right")
+	options.Timestamp = flag.String("timestamp", "", "Record and stream modes: show the render time (time) or the wall clock (clock) over the output")
+	options.TimestampPosition = flag.String("timestamp-position", "top-right", "Position of the timestamp, as -title-position")
+	options.Post = flag.String("post", "", "Finish every frame with post-processing effects as effect=strength pairs, e.g. grain=0.04,vignette=0.3,aberration=0.005,bloom=0.6,threshold=0.8")
+	options.LUT = flag.String("lut", "", "Grade the output through this .cube 3D LUT, e.g. to match a broadcast or film look; applies to the window and to recordings and streams")
+	options.Watermark = flag.String("watermark", "", "Record and stream modes: PNG or JPEG image to show over the output")
+	options.WatermarkPosition = flag.String("watermark-position", "bottom-right", "Position of the watermark, as -title-position")
+	options.WatermarkOpacity = flag.Float64("watermark-opacity", 0.5, "Opacity of the watermark, from 0 to 1")
+	options.MetadataSidecar = flag.Bool("metadata-sidecar", false, "Record and stream modes: also write the shader and render settings tagged in file outputs to <output>.json")
+	options.SceneSubtitles = flag.Bool("scene-subtitles", false, "Record and stream modes: also write the title of each scene shown as subtitles next to file outputs, named like them with an .srt extension")
+	options.PreviewAddr = flag.String("preview", "", "Serve an MJPEG preview of the rendered output on this address (e.g. ':8090')")
+	options.Projection = flag.String("projection", "flat", "Image pass projection: flat, or equirect to render shaders defining mainVR or mainCubemap as a 360° panorama (record mode tags it as 360 video)")
+	options.Stereo = flag.String("stereo", "", "Render two eye views for shaders that declare 'uniform float iEye' or 'iEyeOffset', combined as anaglyph (red-cyan), sbs (side by side) or tb (top and bottom)")
+	options.EyeSeparation = flag.Float64("eye-separation", 0.1, "Stereo: distance between the eyes in scene units; each eye's iEyeOffset is half of it")
+	options.Precision = flag.String("precision", "default", "Shader precision: default, or highp to rewrite every lowp/mediump qualifier and default precision to highp, so GLES renders match desktop GL")
+	options.AuditFrames = flag.Int("audit-frames", 1, "Audit mode: number of frames to render from time zero before comparing the last one")
+	options.AuditOutput = flag.String("audit-output", "precision-audit.png", "Audit mode: PNG file receiving the GLES render, the GL 4.1 render and their amplified difference side by side")
+	options.ShareOut = flag.String("share-out", "", "Publish rendered frames to other applications under this name through Syphon, in macOS builds with the syphon tag")
+	options.ControlAddr = flag.String("control", "", "Serve the web monitor and controller on this address (e.g. ':8080')")
+	options.ControlToken = flag.String("control-token", "", "Token the controller requires, as ?token= or an 'Authorization: Bearer' header, to accept commands; empty generates one and logs the UI address with it")
+	options.Outputs = flag.String("outputs", "", "Multiple simultaneous outputs separated by ';', each 'file-or-url|codec=hevc,format=flv,audio-codec=opus,audio-bitrate=128,queue-policy=block'. Overrides -output")
+	options.Jobs = flag.Int("jobs", 1, "Batch mode: number of shaders to render in parallel")
+	options.BatchOutput = flag.String("batch-output", "{id}.mp4", "Batch mode: output file pattern; {id} is the shader ID and {n} its position in the list")
+	options.BatchStatus = flag.String("batch-status", "", "Batch mode: write the state of every job to this JSON file")
+	options.ListenAddr = flag.String("listen", "127.0.0.1:8081", "Server mode: address for the job REST API (ignored when started by systemd socket activation)")
+	options.JobDir = flag.String("job-dir", "jobs", "Server mode: directory for rendered job outputs")
+	options.JobQueueSize = flag.Int("job-queue", 64, "Server mode: maximum number of queued jobs")
+	options.JobToken = flag.String("job-token", "", "Server mode: token requests must carry, as ?token= or an 'Authorization: Bearer' header; empty generates one and logs it")
+	options.JobTTL = flag.Float64("job-ttl", 86400, "Server mode: seconds finished jobs and their outputs are kept; 0 keeps them until -job-keep removes them")
+	options.JobKeep = flag.Int("job-keep", 100, "Server mode: number of finished jobs and outputs kept; 0 keeps all until -job-ttl removes them")
+	options.SegmentTime = flag.Float64("segment-time", 4, "HLS/DASH outputs (.m3u8/.mpd): target segment duration in seconds")
+	options.SegmentListSize = flag.Int("segment-list-size", 6, "HLS/DASH outputs in stream mode: number of segments kept in the playlist; 0 keeps all")
+	options.SegmentType = flag.String("segment-type", "ts", "HLS outputs: segment container, ts (MPEG-TS) or fmp4 (fragmented MP4)")
+	options.Codec = flag.String("codec", "", "Video codec for encoding: h264, hevc, av1 (default: h264, or av1 for webm)")
+	options.EncodeQueue = flag.Int("encode-queue", 5, "Record and stream modes: frames each output queues for its encoder, decoupling rendering from encoding")
+	options.QueuePolicy = flag.String("queue-policy", "", "Record and stream modes: when an encoder queue is full, block (rendering waits), drop-oldest (keeps latency bounded), or never-drop (the queue grows) (default: drop-oldest when streaming, otherwise block)")
+	options.EncodeThreads = flag.Int("encode-threads", 0, "Record and stream modes: threads of each software video encoder (default: one per core)")
+	options.EncodeSlices = flag.Int("encode-slices", 0, "Record and stream modes: slices per frame for libx264, libx265 and hardware encoders, encoded in parallel (default: the encoder's)")
+	options.EncodeTiles = flag.String("encode-tiles", "", "Record and stream modes: AV1 tiles per frame as COLUMNSxROWS, encoded in parallel (default: a column per 1024 pixels of width)")
+	options.VideoFilter = flag.String("vf", "", "Record and stream modes: run the video through this FFmpeg filter graph before encoding, e.g. scale=1280:720 or lut3d=grade.cube; the encoder takes the size it puts out")
 	options.DecklinkDevice = flag.String("decklink", "", "DeckLink device name for output")
-	options.NumPBOs = flag.Int("numpbos", 2, "Number of PBOs to use for streaming")
+	options.NumPBOs = flag.Int("numpbos", 2, "Record and stream modes: frames of asynchronous readback in flight, each in 3 PBOs (Y, U, V); raise it if the readback summary reports waits")
+	options.Screensaver = flag.Bool("screensaver", false, "Live mode: run as a screensaver, borderless over all monitors with the cursor hidden, exiting on any input and showing the -shader list in random order")
+	options.Dwell = flag.Float64("dwell", 60, "Screensaver mode: seconds each shader is shown")
+	options.Monitor = flag.String("monitor", "", "Live mode: open fullscreen on this monitor, by index (0 is primary) or name; with -span, a comma-separated list of monitors to cover")
+	options.Fullscreen = flag.Bool("fullscreen", false, "Live mode: exclusive fullscreen on the -monitor (primary by default); F11 toggles fullscreen at runtime")
+	options.Borderless = flag.Bool("borderless", false, "Live mode: borderless window covering the -monitor without changing its video mode")
+	options.VideoMode = flag.String("video-mode", "", "Exclusive fullscreen video mode as WIDTHxHEIGHT[@HZ] (default: the current mode; highest refresh rate if no @HZ)")
+	options.VSync = flag.String("vsync", "on", "Live mode: vsync on, off, or adaptive (tears only when a frame is late)")
+	options.HDROutput = flag.String("hdr-output", "", "Live mode: present HDR on an HDR display, so values above 1.0 show brighter than white: scrgb (linear, on a floating-point framebuffer) or pq (HDR10, on a 10-bit framebuffer); refused if the window system doesn't provide that framebuffer, and the display or compositor must treat it as HDR; implies -bitdepth 10")
+	options.HDRWhite = flag.Float64("hdr-white", 203, "HDR output: luminance of SDR white in nits")
+	options.GLWatchdog = flag.Float64("gl-watchdog", 0, "Live mode: restart when the GL context is lost to a GPU reset or compositor restart, or when a frame takes longer than this many seconds, for unattended installations (0: disabled)")
+	options.MaxFPS = flag.Float64("max-fps", 0, "Live mode: cap the frame rate (0: unlimited, other than by vsync)")
+	options.Clock = flag.String("clock", "window", "Live mode: source of iTime: window (the window system's timer), monotonic (keeps running while the window is dragged), audio (locked to the audio device, correcting its drift), ltc (SMPTE timecode from -timecode-input), or ntp (the NTP-synced wall clock since -clock-epoch), so several machines can render in step")
+	options.TimecodeInput = flag.String("timecode-input", "", "ltc clock: FFmpeg audio input device carrying LTC on its left channel (e.g. 'alsa:hw:1')")
+	options.NTPServer = flag.String("ntp-server", "", "ntp clock: NTP server to sync with (default: trust the system clock, e.g. when an NTP or PTP daemon keeps it in step)")
+	options.FrameLock = flag.String("framelock", "", "Live mode: render in lockstep with other instances over UDP, as their master or as a slave")
+	options.FrameLockAddr = flag.String("framelock-addr", ":7770", "Frame lock: UDP address the master listens on, or the master's address for a slave (e.g. 10.0.0.1:7770)")
+	options.FrameLockSlaves = flag.Int("framelock-slaves", 1, "Frame lock master: number of slaves that must have rendered a frame before it is shown")
+	options.Viewport = flag.String("viewport", "", "Render only this region of -canvas, as X,Y,WIDTH,HEIGHT from its top left, e.g. one projector of a video wall or one tile of a render to stitch")
+	options.Canvas = flag.String("canvas", "", "Size of the whole canvas -viewport is part of, as WIDTHxHEIGHT; the shader sees it as iResolution")
+	options.ClockEpoch = flag.String("clock-epoch", "", "ntp clock: RFC 3339 time that iTime counts from, the same on every machine (e.g. 2025-01-01T00:00:00Z)")
+	options.KMS = flag.Bool("kms", false, "Live mode: render straight to a display through DRM/KMS with no compositor or window system; -monitor picks the connector (e.g. HDMI-A-1) and -video-mode its mode")
+	options.KMSDevice = flag.String("kms-device", "", "DRM device for -kms, e.g. /dev/dri/card0, or fd:N for a leased DRM file descriptor (default: the first card with a connected display)")
+	options.Evdev = flag.String("evdev", "", "Live mode: read mouse, touch and keys straight from these input devices (comma-separated /dev/input/event* paths, or \"all\"), for gamescope DRM sessions where the window gets no input")
+	options.Span = flag.Bool("span", false, "Live mode: one borderless window spanning all monitors (or those given by -monitor), for video walls")
+	options.Progress = flag.String("progress", "text", "Record mode progress reporting: text (log lines), json (one JSON event per line on stdout), or none")
+	options.LogLevel = flag.String("log-level", "info", "Minimum level logged (debug, info, warn, error or quiet), then optional per-subsystem overrides such as api, renderer, audio or encoder (e.g. info,encoder=warn,audio=quiet)")
+	options.LogJSON = flag.Bool("log-json", false, "Log one JSON object per line, with time, level, subsystem and message, for log aggregation")
+	options.QuietFFmpeg = flag.Bool("quiet-ffmpeg", false, "Log only FFmpeg's warnings and errors (the same as adding ffmpeg=warn to -log-level)")
+	options.Diagnostics = flag.String("diagnostics", "", "Write GPU and driver info, EGL devices, the FFmpeg build, the translator version and recent logs to this zip file for bug reports, and exit (written automatically as goshadertoy-crash-*.zip on a panic)")
+	options.CheckpointDir = flag.String("checkpoint-dir", "", "Record mode: write the output in segments to this directory and checkpoint after each one, so an interrupted render resumes where it stopped")
+	options.CheckpointInterval = flag.Float64("checkpoint-interval", 60, "Record mode: seconds of output per segment with -checkpoint-dir")
+	options.InputScript = flag.String("input-script", "", "Record mode: JSON timeline of mouse and keyboard events to drive iMouse and keyboard channels, for rendering interactive shaders deterministically")
+	options.TimeWrap = flag.Float64("time-wrap", 0, "Wrap iTime back to 0 every this many seconds, so long-running installations don't stutter as float32 loses precision; shaders can declare 'uniform vec2 iTime64' for the unwrapped whole seconds and fraction instead (0: never wrap)")
+	options.Date = flag.String("date", "", "Start iDate at this date and time with iTime 0 and advance it with iTime, so shaders seeded from it render reproducibly (e.g. 2024-01-01T00:00:00; default: the wall clock)")
+	options.Seed = flag.Float64("seed", 0, "Value of iSeed, for shaders that declare 'uniform float iSeed' to seed their randomness reproducibly")
+	options.SimFPS = flag.Int("sim-fps", 0, "Record mode: step the shader at this rate, a multiple of -fps, and encode only every (sim-fps/fps)th step, for simulations that depend on a small iTimeDelta (0: step at -fps)")
+	options.WarmupFrames = flag.Int("warmup-frames", 0, "Record mode: run the shader this many frames (steps, with -sim-fps) without encoding before the first frame, so simulations that take a while to converge (reaction-diffusion, erosion) start the video in an interesting state")
+	options.LoadState = flag.String("load-state", "", "Live and record modes: continue from a savestate, restoring the shader's buffers, iFrame and iTime, e.g. to resume or branch a long-evolving simulation")
+	options.SaveState = flag.String("save-state", "", "Savestate file: in live mode F5 saves the current state to it (default savestate.gst) and F9 loads it back; in record mode the state after the last frame is saved to it")
+	options.RecordInput = flag.String("record-input", "", "Live mode: save the session's mouse and keyboard input to this JSON file on exit, for replaying with -input-script")
+	options.Channel0 = flag.String("channel0", "", "Replace or supply iChannel0 of the image pass as type:source: texture:FILE, video:FILE|URL, webcam[:DEVICE], mic[:DEVICE|FILE], spectrogram[:DEVICE|FILE], syphon:NAME, keyboard, buffer:A-D, volume:FILE or data:csv:FILE|osc:ADDR|stdin; sampler options follow as ,filter=nearest|linear|mipmap ,wrap=clamp|repeat ,vflip=true|false ,srgb=true|false")
+	options.Channel1 = flag.String("channel1", "", "Replace or supply iChannel1 of the image pass, as -channel0")
+	options.Channel2 = flag.String("channel2", "", "Replace or supply iChannel2 of the image pass, as -channel0")
+	options.Channel3 = flag.String("channel3", "", "Replace or supply iChannel3 of the image pass, as -channel0")
+	options.HWAccel = flag.String("hwaccel", "auto", "Decode video channels on the GPU: auto picks the platform's (cuda or vaapi on Linux, videotoolbox on macOS), none decodes on the CPU, or an FFmpeg hwaccel such as cuda, vaapi, qsv or videotoolbox. Decoded frames are downloaded to the CPU to be uploaded as textures, so this saves decoding work, not copies")
+	options.SoundChunkRows = flag.Int("sound-chunk", 0, "Rows of 512 samples a sound shader renders at a time, 1-512; smaller chunks start and react sooner, larger ones render faster (default: 16, about 0.19 s, in live and stream modes; 512 otherwise)")
 	options.Prewarm = flag.Bool("prewarm", false, "Prewarm the renderer before recording/streaming (optional)")
 
+	options.AudioInput = flag.String("audio-input", "", "Audio input preset: 'system' captures whatever the machine is playing (PulseAudio/PipeWire monitor, Stereo Mix, BlackHole)")
 	options.AudioInputDevice = flag.String("audio-input-device", "", "FFmpeg audio input device string (e.g., a file path or 'avfoundation:default'). Overrides default mic.")
 	options.AudioInputFile = flag.String("audio-input-file", "", "FFmpeg audio input file (e.g., a WAV or MP3 file). Overrides default mic.")
 	options.AudioOutputDevice = flag.String("audio-output-device", "", "FFmpeg audio output device string.")
+	options.Mute = flag.Bool("mute", false, "Live mode: don't play sound shader audio through the default output device")
+	options.AudioBackend = flag.String("audio-backend", "", "Audio device backend: alsa, pulse (PulseAudio/PipeWire), jack (capture only) on Linux; avfoundation on macOS; dshow on Windows (default: platform default)")
+	options.ListAudioDevices = flag.Bool("list-audio-devices", false, "List capture sources and playback sinks for the audio backend and exit")
+	options.ListEncoders = flag.Bool("list-encoders", false, "List the video and audio encoders -codec and -audio-codec can use (nvenc, amf, qsv, videotoolbox and software) and the hardware devices, with whether each works on this machine, and exit")
+	options.AudioCopy = flag.Bool("audio-copy", false, "Record mode: mux the audio track of the input file (or the shader's music) without re-encoding")
+	options.AudioCodec = flag.String("audio-codec", "", "Audio codec for recording: aac, opus, flac, pcm_s24le (default: opus for .webm/.ogg, pcm_s24le for .mov, otherwise aac)")
+	options.AudioBitrate = flag.Int("audio-bitrate", 192, "Audio bitrate in kbps for lossy audio codecs")
+	options.AudioOutChannels = flag.Int("audio-out-channels", 2, "Number of audio channels to encode and write (1 or 2); not to be confused with -audio-channels, which picks the input channels")
+	options.AudioSampleRate = flag.Int("audio-sample-rate", 44100, "Sample rate for audio playback and encoding (e.g. 44100, 48000); sources are resampled to it")
+	options.AVOffset = flag.Float64("av-offset", 0.0, "Live mode: delay in ms applied to audio before visualization, to match output latency")
+	options.AudioGain = flag.Float64("audio-gain", 0.0, "Audio input gain in dB, applied before visualization and encoding")
+	options.AudioStats = flag.Float64("audio-stats", 0, "Live and stream modes: log the audio buffer occupancy, underruns and dropped audio every this many seconds (default: only warn of underruns and drops)")
+	options.AudioChannelMap = flag.String("audio-channels", "", "1-based input channels to use as left,right (e.g. '3,4'); a single channel feeds both")
+
+	options.FFTSize = flag.Int("fft-size", 2048, "FFT input size for audio channels (power of two, >= 1024)")
+	options.FFTSmoothing = flag.Float64("fft-smoothing", 0.8, "Smoothing factor between FFT frames for audio channels [0, 1)")
+	options.FFTMinDecibels = flag.Float64("fft-min-db", -100.0, "Level in dB mapped to 0.0 in the audio FFT texture")
+	options.FFTMaxDecibels = flag.Float64("fft-max-db", -30.0, "Level in dB mapped to 1.0 in the audio FFT texture")
+	options.FFTWindow = flag.String("fft-window", "blackman", "FFT window function: blackman, hann, hamming, rectangular")
+	options.SpectrogramRows = flag.Int("spectrogram-rows", 256, "Frames of FFT and waveform history in spectrogram channels (the texture height)")
 
-	options.GamescopeSocket = flag.String("gamescope-socket", "", "Path to the gamescope manager Unix socket. Enables running inside a managed gamescope session.")
+	options.GamescopeSocket = flag.String("gamescope-socket", "", "Path to the gamescope manager Unix socket. Enables running inside a managed gamescope session; build with -tags wayland to render to it natively rather than through XWayland.")
 	options.GamescopeTerminateOnExit = flag.Bool("gamescope-terminate-on-exit", false, "Terminate the gamescope session when goshadertoy exits.")
+	options.GamescopeHDR = flag.Bool("gamescope-hdr", true, "Request an HDR gamescope session.")
+	options.GamescopeSDRNits = flag.Int("gamescope-sdr-nits", 400, "Brightness in nits of SDR content in an HDR gamescope session.")
+	options.GamescopeBackend = flag.String("gamescope-backend", "", "Gamescope backend: drm, wayland, sdl or headless (default: the manager's choice).")
+	options.GamescopeArgs = flag.String("gamescope-args", "", "Extra arguments passed through to gamescope, separated by whitespace (e.g. \"--adaptive-sync --hdr-itm-enable\").")
 
 	flag.Parse()
 
 	if *options.Help {
 		fmt.Println("Shadertoy Shader Viewer/Recorder")
+		fmt.Println("Usage: goshadertoy [flags]")
+		fmt.Println("       goshadertoy validate -shader ID|path  (compile every pass without rendering)")
 		flag.PrintDefaults()
 		return
 	}
 
+	// Fill in options from the config file before validating them
+	var shaderUniforms map[string]map[string][]float32
+	var cfg *config.Config
+	if *options.ConfigFile != "" {
+		var err error
+		cfg, err = config.Load(*options.ConfigFile)
+		if err != nil {
+			log.Fatalf("Failed to read config file: %v", err)
+		}
+		if err := cfg.Apply(flag.CommandLine); err != nil {
+			log.Fatalf("Invalid config file: %v", err)
+		}
+		shaderUniforms = cfg.Uniforms()
+		log.Printf("Loaded config from %s", *options.ConfigFile)
+	}
+
+	logLevels, err := logging.ParseLevels(*options.LogLevel)
+	if err != nil {
+		log.Fatalf("Invalid log-level: %v", err)
+	}
+	if *options.QuietFFmpeg && logLevels.For("ffmpeg") < slog.LevelWarn {
+		logLevels.Subsystems["ffmpeg"] = slog.LevelWarn
+	}
+	logging.Setup(logging.Config{Levels: logLevels, JSON: *options.LogJSON, Timestamps: !systemd.LoggingToJournal()})
+
+	if *options.Diagnostics != "" {
+		if err := writeDiagnostics(*options.Diagnostics, true, ""); err != nil {
+			log.Fatalf("Failed to write diagnostics: %v", err)
+		}
+		log.Printf("Wrote diagnostics to %s", *options.Diagnostics)
+		return
+	}
+
 	// Validate mode (case-insensitive)
 	*options.Mode = strings.ToLower(*options.Mode)
-	validModes := map[string]bool{"live": true, "record": true, "stream": true}
+	validModes := map[string]bool{"live": true, "record": true, "stream": true, "batch": true, "server": true, "audit": true}
 	if !validModes[*options.Mode] {
-		log.Fatalf("Invalid mode: %s. Valid modes are: Live, Record, Stream (case-insensitive)", *options.Mode)
+		log.Fatalf("Invalid mode: %s. Valid modes are: Live, Record, Stream, Batch, Server, Audit (case-insensitive)", *options.Mode)
+	}
+
+	if *options.Screensaver {
+		if *options.Mode != "live" {
+			log.Fatalf("-screensaver is only supported in live mode")
+		}
+		if *options.Dwell <= 0 {
+			log.Fatalf("Invalid dwell time: %g. Must be positive", *options.Dwell)
+		}
+		// Screensavers run silently.
+		*options.Mute = true
+	}
+
+	if (*options.Monitor != "" || *options.Span || *options.Fullscreen || *options.Borderless || *options.KMS) && *options.Mode != "live" {
+		log.Fatalf("-monitor, -span, -fullscreen, -borderless and -kms are only supported in live mode")
+	}
+	if *options.InputScript != "" {
+		if *options.Mode != "record" {
+			log.Fatalf("-input-script is only supported in record mode")
+		}
+		if _, err := inputscript.Load(*options.InputScript); err != nil {
+			log.Fatalf("Failed to load input script: %v", err)
+		}
+	}
+	if *options.NumPBOs < 1 {
+		log.Fatalf("Invalid numpbos: %d. Must be at least 1", *options.NumPBOs)
+	}
+	if *options.SpectrogramRows < 2 || *options.SpectrogramRows > 4096 {
+		log.Fatalf("Invalid spectrogram-rows: %d. Must be between 2 and 4096", *options.SpectrogramRows)
+	}
+	if _, ok := renderer.StereoModes[*options.Stereo]; *options.Stereo != "" && !ok {
+		log.Fatalf("Invalid stereo mode: %s. Must be anaglyph, sbs or tb", *options.Stereo)
+	}
+	switch *options.Projection {
+	case "flat":
+	case "equirect":
+		if *options.Stereo == "" && *options.Width != 2**options.Height {
+			log.Printf("Warning: %dx%d is not the 2:1 aspect ratio of an equirectangular panorama", *options.Width, *options.Height)
+		}
+	default:
+		log.Fatalf("Invalid projection: %s. Must be flat or equirect", *options.Projection)
+	}
+	for _, position := range []string{*options.TitlePosition, *options.TimestampPosition, *options.WatermarkPosition} {
+		if _, ok := renderer.OverlayPositions[position]; !ok {
+			log.Fatalf("Invalid overlay position: %s. Must be top-left, top, top-right, center, bottom-left, bottom or bottom-right", position)
+		}
+	}
+	if *options.Timestamp != "" && !renderer.TimestampModes[*options.Timestamp] {
+		log.Fatalf("Invalid timestamp: %s. Must be time or clock", *options.Timestamp)
+	}
+	if *options.TitleCard < 0 {
+		log.Fatalf("Invalid title-card: %g. Must be 0 or more seconds", *options.TitleCard)
+	}
+	if *options.WatermarkOpacity < 0 || *options.WatermarkOpacity > 1 {
+		log.Fatalf("Invalid watermark-opacity: %g. Must be between 0 and 1", *options.WatermarkOpacity)
+	}
+	if *options.Precision != "default" && *options.Precision != "highp" {
+		log.Fatalf("Invalid precision: %s. Must be default or highp", *options.Precision)
+	}
+	if *options.AuditFrames < 1 {
+		log.Fatalf("Invalid audit-frames: %d. Must be at least 1", *options.AuditFrames)
+	}
+	if overrides, err := channelOverrides(options); err != nil {
+		log.Fatalf("Invalid channel override: %v", err)
+	} else if err := applyMicOverrides(options, overrides); err != nil {
+		log.Fatalf("Invalid channel override: %v", err)
+	}
+	if *options.RecordInput != "" && *options.Mode != "live" {
+		log.Fatalf("-record-input is only supported in live mode")
+	}
+	if *options.Evdev != "" && *options.Mode != "live" {
+		log.Fatalf("-evdev is only supported in live mode")
+	}
+	if *options.KMS && (*options.Span || *options.Fullscreen || *options.Borderless || *options.Screensaver) {
+		log.Fatalf("-kms cannot be combined with -span, -fullscreen, -borderless or -screensaver")
+	}
+	*options.VSync = strings.ToLower(*options.VSync)
+	if *options.VSync != "on" && *options.VSync != "off" && *options.VSync != "adaptive" {
+		log.Fatalf("Invalid vsync mode: %s. Valid modes are: on, off, adaptive", *options.VSync)
+	}
+	if _, err := renderer.ParsePostConfig(*options.Post); err != nil {
+		log.Fatalf("Invalid post: %v", err)
+	}
+	if _, ok := renderer.Ditherings[*options.Dither]; !ok {
+		log.Fatalf("Invalid dither: %s. Must be none, triangular or blue-noise", *options.Dither)
+	}
+	if _, ok := renderer.Transfers[*options.Transfer]; !ok {
+		log.Fatalf("Invalid transfer: %s. Must be shadertoy, srgb or gamma2.2", *options.Transfer)
+	}
+	if *options.HDROutput != "" {
+		if *options.Mode != "live" {
+			log.Fatalf("-hdr-output is only supported in live mode")
+		}
+		if _, ok := renderer.HDROutputs[*options.HDROutput]; !ok {
+			log.Fatalf("Invalid hdr-output: %s. Must be scrgb or pq", *options.HDROutput)
+		}
+		if *options.HDRWhite <= 0 {
+			log.Fatalf("Invalid hdr-white: %g. Must be positive", *options.HDRWhite)
+		}
+		// Values above 1.0 need the float offscreen FBO and a deep framebuffer.
+		if *options.BitDepth == 8 {
+			*options.BitDepth = 10
+		}
+	}
+	if !renderer.Clocks[*options.Clock] {
+		log.Fatalf("Invalid clock: %s. Valid clocks are: window, monotonic, audio, ltc, ntp", *options.Clock)
+	}
+	if *options.Clock == "ltc" && *options.TimecodeInput == "" {
+		log.Fatalf("-clock ltc needs -timecode-input")
+	}
+	switch *options.FrameLock {
+	case "":
+	case "master", "slave":
+		if *options.Mode != "live" {
+			log.Fatalf("-framelock is only supported in live mode")
+		}
+		if *options.FrameLockSlaves < 0 {
+			log.Fatalf("Invalid framelock-slaves: %d. Must be 0 or more", *options.FrameLockSlaves)
+		}
+	default:
+		log.Fatalf("Invalid framelock role: %s. Must be master or slave", *options.FrameLock)
+	}
+	if *options.Viewport != "" || *options.Canvas != "" {
+		if _, err := parseViewport(*options.Viewport, *options.Canvas); err != nil {
+			log.Fatalf("Invalid viewport: %v", err)
+		}
+	}
+	if *options.Clock == "ntp" {
+		if _, err := time.Parse(time.RFC3339, *options.ClockEpoch); err != nil {
+			log.Fatalf("-clock ntp needs an RFC 3339 -clock-epoch: %v", err)
+		}
+	}
+	if *options.MaxFPS < 0 {
+		log.Fatalf("Invalid max-fps: %g. Must be 0 or more", *options.MaxFPS)
+	}
+	if *options.GamescopeSDRNits <= 0 {
+		log.Fatalf("Invalid gamescope-sdr-nits: %d. Must be positive", *options.GamescopeSDRNits)
+	}
+	*options.GamescopeBackend = strings.ToLower(*options.GamescopeBackend)
+	switch *options.GamescopeBackend {
+	case "", "drm", "wayland", "sdl", "headless":
+	default:
+		log.Fatalf("Invalid gamescope backend: %s. Valid backends are: drm, wayland, sdl, headless", *options.GamescopeBackend)
+	}
+	if *options.Fullscreen && *options.Borderless {
+		log.Fatalf("-fullscreen cannot be combined with -borderless")
+	}
+	if *options.Span && (*options.Fullscreen || *options.Borderless) {
+		log.Fatalf("-span cannot be combined with -fullscreen or -borderless")
+	}
+	if *options.VideoMode != "" {
+		if _, _, _, err := glfwcontext.ParseVideoMode(*options.VideoMode); err != nil {
+			log.Fatalf("Invalid video mode: %v", err)
+		}
+	}
+
+	*options.Progress = strings.ToLower(*options.Progress)
+	if *options.Progress != "text" && *options.Progress != "json" && *options.Progress != "none" {
+		log.Fatalf("Invalid progress format: %s. Valid formats are: text, json, none", *options.Progress)
+	}
+
+	if *options.GLWatchdog < 0 {
+		log.Fatalf("Invalid gl-watchdog: %g. Must not be negative", *options.GLWatchdog)
+	}
+	if *options.GLWatchdog > 0 && *options.Mode != "live" {
+		log.Fatalf("-gl-watchdog is only supported in live mode")
+	}
+	if *options.TimeWrap < 0 {
+		log.Fatalf("Invalid time-wrap: %g. Must not be negative", *options.TimeWrap)
+	}
+	if *options.Date != "" {
+		if _, err := renderer.ParseDate(*options.Date); err != nil {
+			log.Fatalf("Invalid date: %v", err)
+		}
+	}
+	if *options.SimFPS != 0 {
+		if *options.Mode != "record" {
+			log.Fatalf("-sim-fps is only supported in record mode")
+		}
+		if *options.FPS <= 0 || *options.SimFPS < *options.FPS || *options.SimFPS%*options.FPS != 0 {
+			log.Fatalf("Invalid sim-fps: %d. Must be a multiple of -fps (%d)", *options.SimFPS, *options.FPS)
+		}
+	}
+	if *options.WarmupFrames < 0 {
+		log.Fatalf("Invalid warmup-frames: %d. Must not be negative", *options.WarmupFrames)
+	}
+	if *options.WarmupFrames > 0 && *options.Mode != "record" {
+		log.Fatalf("-warmup-frames is only supported in record mode")
+	}
+	if (*options.LoadState != "" || *options.SaveState != "") && *options.Mode != "live" && *options.Mode != "record" {
+		log.Fatalf("-load-state and -save-state are only supported in live and record modes")
+	}
+	if *options.LoadState != "" && *options.CheckpointDir != "" {
+		log.Fatalf("-load-state cannot be combined with -checkpoint-dir")
+	}
+
+	// Validate checkpointing
+	if *options.CheckpointDir != "" {
+		if *options.Mode != "record" {
+			log.Fatalf("-checkpoint-dir is only supported in record mode")
+		}
+		if *options.Outputs != "" || *options.AudioCopy {
+			log.Fatalf("-checkpoint-dir cannot be combined with -outputs or -audio-copy")
+		}
+		if *options.CheckpointInterval <= 0 {
+			log.Fatalf("Invalid checkpoint interval: %g. Must be positive", *options.CheckpointInterval)
+		}
 	}
 
 	// Validate codec
 	*options.Codec = strings.ToLower(*options.Codec)
-	validCodecs := map[string]bool{"h264": true, "hevc": true}
+	validCodecs := map[string]bool{"": true, "h264": true, "hevc": true, "av1": true}
 	if !validCodecs[*options.Codec] {
-		log.Fatalf("Invalid codec: %s. Valid codecs are: h264, hevc", *options.Codec)
+		log.Fatalf("Invalid codec: %s. Valid codecs are: h264, hevc, av1", *options.Codec)
+	}
+
+	// Validate encoder queueing
+	if *options.EncodeQueue < 1 {
+		log.Fatalf("Invalid encode queue depth: %d. Must be at least 1", *options.EncodeQueue)
+	}
+	*options.QueuePolicy = strings.ToLower(*options.QueuePolicy)
+	if _, ok := encoder.QueuePolicies[*options.QueuePolicy]; *options.QueuePolicy != "" && !ok {
+		log.Fatalf("Invalid queue policy: %s. Valid policies are: block, drop-oldest, never-drop", *options.QueuePolicy)
+	}
+	if *options.QueuePolicy == "drop-oldest" && *options.Mode != "stream" {
+		log.Printf("Warning: -queue-policy drop-oldest in %s mode drops frames from the output whenever encoding falls behind", *options.Mode)
+	}
+	if *options.EncodeThreads < 0 {
+		log.Fatalf("Invalid encode thread count: %d. Must not be negative", *options.EncodeThreads)
+	}
+	if *options.EncodeSlices < 0 {
+		log.Fatalf("Invalid encode slice count: %d. Must not be negative", *options.EncodeSlices)
+	}
+	if *options.EncodeTiles != "" {
+		if _, _, err := encoder.ParseTiles(*options.EncodeTiles); err != nil {
+			log.Fatalf("Invalid -encode-tiles: %v", err)
+		}
+	}
+
+	// Validate audio encoding
+	*options.AudioCodec = strings.ToLower(*options.AudioCodec)
+	if err := encoder.ValidateAudioCodec(*options.AudioCodec); err != nil {
+		log.Fatalf("Invalid audio codec: %v", err)
+	}
+	*options.Container = strings.ToLower(*options.Container)
+	if *options.Outputs == "" && (*options.Mode == "record" || *options.Mode == "stream") {
+		if err := encoder.ResolveContainer(options); err != nil {
+			log.Fatalf("Invalid output: %v", err)
+		}
+	}
+	if *options.AudioCopy && *options.Mode != "record" && *options.Mode != "batch" && *options.Mode != "server" {
+		log.Fatalf("-audio-copy is only supported in record, batch, and server modes")
+	}
+	if *options.AudioBitrate <= 0 {
+		log.Fatalf("Invalid audio bitrate: %d. Must be positive", *options.AudioBitrate)
+	}
+	if *options.SoundChunkRows < 0 || *options.SoundChunkRows > 512 {
+		log.Fatalf("Invalid sound chunk: %d rows. Must be between 1 and 512", *options.SoundChunkRows)
+	}
+	if *options.AudioStats < 0 {
+		log.Fatalf("Invalid audio stats interval: %g. Must not be negative", *options.AudioStats)
+	}
+	if *options.AudioOutChannels != 1 && *options.AudioOutChannels != 2 {
+		log.Fatalf("Invalid audio channel count: %d. Must be 1 or 2", *options.AudioOutChannels)
+	}
+
+	// Validate segmenting
+	*options.SegmentType = strings.ToLower(*options.SegmentType)
+	if *options.SegmentType != "ts" && *options.SegmentType != "fmp4" {
+		log.Fatalf("Invalid segment type: %s. Valid types are: ts, fmp4", *options.SegmentType)
+	}
+	if *options.SegmentTime <= 0 {
+		log.Fatalf("Invalid segment time: %g. Must be positive", *options.SegmentTime)
+	}
+	if *options.SegmentListSize < 0 {
+		log.Fatalf("Invalid segment list size: %d. Must be 0 or more", *options.SegmentListSize)
+	}
+
+	// Validate the sink. FFmpeg can't write to "-", so -output - pipes y4m to
+	// standard output for an external encoder unless -sink says otherwise.
+	*options.Sink = strings.ToLower(*options.Sink)
+	if *options.OutputFile == "-" && *options.Sink == "ffmpeg" {
+		*options.Sink = "y4m"
+	}
+	if !slices.Contains(sink.SinkNames(), *options.Sink) {
+		log.Fatalf("Invalid sink: %s. Valid sinks are: %s", *options.Sink, strings.Join(sink.SinkNames(), ", "))
+	}
+	if *options.Sink != "ffmpeg" && (*options.Outputs != "" || *options.CheckpointDir != "" || *options.AudioCopy) {
+		log.Fatalf("-sink %s cannot be combined with -outputs, -checkpoint-dir or -audio-copy", *options.Sink)
+	}
+	if *options.OutputFile == "-" && *options.Progress == "json" {
+		log.Fatalf("-progress json cannot be combined with -output -, which writes to standard output as well")
+	}
+	if *options.AudioOutput != "" {
+		if *options.Sink == "ffmpeg" {
+			log.Fatalf("-audio-output is only supported with -sink raw, y4m, images or shm; the ffmpeg sink encodes the audio itself")
+		}
+		if *options.AudioOutput == "-" && (*options.OutputFile == "-" || *options.Progress == "json") {
+			log.Fatalf("-audio-output - cannot share standard output with -output - or -progress json")
+		}
+	}
+
+	// Validate the output list
+	if *options.Outputs != "" {
+		if _, err := encoder.ParseOutputSpecs(*options.Outputs); err != nil {
+			log.Fatalf("Invalid outputs: %v", err)
+		}
+	}
+
+	// Validate the audio backend
+	*options.AudioBackend = strings.ToLower(*options.AudioBackend)
+	if err := audio.ValidateAudioBackend(*options.AudioBackend); err != nil {
+		log.Fatalf("Invalid audio backend: %v", err)
+	}
+
+	if *options.ListAudioDevices {
+		arcana.Init()
+		listAudioDevices(*options.AudioBackend)
+		return
+	}
+	if *options.ListEncoders {
+		arcana.Init()
+		listEncoders()
+		return
+	}
+
+	// Validate audio routing
+	*options.AudioInput = strings.ToLower(*options.AudioInput)
+	if *options.AudioInput != "" && *options.AudioInput != audio.SystemAudioInput {
+		log.Fatalf("Invalid audio input: %s. The only preset is 'system'", *options.AudioInput)
+	}
+	if *options.AudioInput != "" && (*options.AudioInputDevice != "" || *options.AudioInputFile != "") {
+		log.Fatalf("-audio-input cannot be combined with -audio-input-device or -audio-input-file")
+	}
+	if *options.AudioChannelMap != "" {
+		if _, err := audio.ParseChannelMap(*options.AudioChannelMap); err != nil {
+			log.Fatalf("Invalid audio channel map: %v", err)
+		}
+	}
+
+	validSampleRates := map[int]bool{22050: true, 32000: true, 44100: true, 48000: true, 88200: true, 96000: true}
+	if !validSampleRates[*options.AudioSampleRate] {
+		log.Fatalf("Invalid audio sample rate: %d. Valid rates are: 22050, 32000, 44100, 48000, 88200, 96000", *options.AudioSampleRate)
+	}
+
+	if *options.AVOffset < 0 || *options.AVOffset > 2000 {
+		log.Fatalf("Invalid av-offset: %.0f. Must be between 0 and 2000 ms", *options.AVOffset)
+	}
+
+	// Validate FFT analysis parameters
+	*options.FFTWindow = strings.ToLower(*options.FFTWindow)
+	if err := inputs.FFTParamsFromOptions(options).Validate(); err != nil {
+		log.Fatalf("Invalid FFT options: %v", err)
 	}
 
 	finalAPIKey := *options.APIKey
@@ -341,6 +1233,18 @@ func main() {
 		finalAPIKey = os.Getenv("SHADERTOY_KEY")
 	}
 
+	// Server mode takes its shaders from submitted jobs.
+	if *options.Mode == "server" {
+		if *options.JobQueueSize < 1 {
+			log.Fatalf("Invalid -job-queue %d. Must be at least 1", *options.JobQueueSize)
+		}
+		if *options.JobTTL < 0 || *options.JobKeep < 0 {
+			log.Fatalf("Invalid -job-ttl %g or -job-keep %d. Must not be negative", *options.JobTTL, *options.JobKeep)
+		}
+		runJobServer(options, finalAPIKey)
+		return
+	}
+
 	// Parse the comma-separated shader ID list
 	shaderIDs := strings.Split(*options.ShaderID, ",")
 	if len(shaderIDs) == 0 || shaderIDs[0] == "" {
@@ -351,24 +1255,47 @@ func main() {
 		shaderIDs[i] = strings.TrimSpace(shaderIDs[i])
 	}
 
+	// Batch mode renders each shader in its own record process.
+	if *options.Mode == "batch" {
+		if err := validateBatchOptions(options, shaderIDs); err != nil {
+			log.Fatalf("Invalid batch options: %v", err)
+		}
+		if failed := runBatch(shaderIDs, options); failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Fetch the FIRST shader in the list to use for initialization.
 	initialShaderID := shaderIDs[0]
 	log.Printf("Fetching initial shader with ID: %s", initialShaderID)
-	shaderJSON, err := api.ShaderFromID(finalAPIKey, initialShaderID, true)
-	if err != nil {
-		log.Fatalf("Error fetching initial shader %s: %v", initialShaderID, err)
-	}
-
-	initialShaderArgs, err := api.ShaderArgsFromJSON(shaderJSON, true)
+	initialShaderArgs, err := api.LoadShaderArgs(finalAPIKey, initialShaderID, true)
 	if err != nil {
-		log.Fatalf("Error processing initial shader JSON: %v", err)
+		log.Fatalf("Error loading initial shader %s: %v", initialShaderID, err)
 	}
 	log.Printf("Successfully processed initial shader: %s", initialShaderArgs.Title)
+	overrides, _ := channelOverrides(options)
+	if err := api.ApplyChannelOverrides(initialShaderArgs, overrides); err != nil {
+		log.Fatalf("Failed to apply channel overrides: %v", err)
+	}
 
 	if !initialShaderArgs.Complete {
 		log.Println("Warning: Initial shader arguments may be incomplete (e.g., missing textures or unsupported inputs).")
 	}
 
+	if *options.ExportHTML != "" {
+		if err := export.WriteHTMLFile(*options.ExportHTML, initialShaderArgs); err != nil {
+			log.Fatalf("Failed to export shader: %v", err)
+		}
+		log.Printf("Exported %s to %s", initialShaderArgs.Title, *options.ExportHTML)
+		return
+	}
+	if *options.Mode == "audit" {
+		os.Exit(runPrecisionAudit(initialShaderArgs, options))
+	}
+
 	// Pass the initial parsed shader AND the full list of IDs to the run function.
-	runShadertoy(initialShaderArgs, shaderIDs, options)
+	if runShadertoy(initialShaderArgs, shaderIDs, shaderUniforms, cfg, options) {
+		relaunch()
+	}
 }
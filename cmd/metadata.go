@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/richinsley/goshadertoy/api"
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+// recordingMetadata returns the container tags that trace a recording back to
+// its shader and the settings it was rendered with.
+func recordingMetadata(args *api.ShaderArgs, opts *options.ShaderOptions) map[string]string {
+	settings := fmt.Sprintf("Rendered at %dx%d, %d fps, %d-bit", *opts.Width, *opts.Height, *opts.FPS, *opts.BitDepth)
+	if *opts.Mode == "record" {
+		settings += fmt.Sprintf(", %g s", *opts.Duration)
+	}
+	tags := map[string]string{
+		"title":       args.Title,
+		"description": settings,
+		"encoder":     "goshadertoy " + goshadertoyVersion(),
+	}
+	if args.Author != "" {
+		tags["artist"] = args.Author
+	}
+	if args.Source != "" {
+		tags["comment"] = args.Source
+	}
+	return tags
+}
+
+// goshadertoyVersion returns the module version of this build and, if known,
+// the commit it was built from.
+func goshadertoyVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			version += " (" + s.Value[:12] + ")"
+		}
+	}
+	return version
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	options "github.com/richinsley/goshadertoy/options"
+	renderer "github.com/richinsley/goshadertoy/renderer"
+)
+
+// overlayConfig returns the burn-in overlay the options ask for.
+func overlayConfig(opts *options.ShaderOptions) renderer.OverlayConfig {
+	return renderer.OverlayConfig{
+		TitleSeconds:      *opts.TitleCard,
+		TitlePosition:     *opts.TitlePosition,
+		Timestamp:         *opts.Timestamp,
+		TimestampPosition: *opts.TimestampPosition,
+		Watermark:         *opts.Watermark,
+		WatermarkPosition: *opts.WatermarkPosition,
+		WatermarkOpacity:  *opts.WatermarkOpacity,
+	}
+}
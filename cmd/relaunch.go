@@ -0,0 +1,20 @@
+package main
+
+import (
+	"log"
+	"os"
+	"syscall"
+	"time"
+)
+
+// relaunch replaces the process with a new run of the same command, which
+// creates new GL contexts and reloads the shaders from the cache, after
+// giving the driver time to recover.
+func relaunch() {
+	time.Sleep(relaunchDelay)
+	exe, err := os.Executable()
+	if err == nil {
+		err = syscall.Exec(exe, os.Args, os.Environ())
+	}
+	log.Fatalf("Failed to restart: %v", err)
+}
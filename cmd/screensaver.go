@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	renderer "github.com/richinsley/goshadertoy/renderer"
+)
+
+// runPlaylist switches to another scene every dwell, or after the duration the
+// config file sets for the scene, until ctx is done. Each round shows every
+// scene once, in a new random order.
+func runPlaylist(ctx context.Context, r *renderer.Renderer, c *sceneController, dwell time.Duration) {
+	c.mu.Lock()
+	current := c.currentScene
+	c.mu.Unlock()
+	timer := time.NewTimer(c.dwell(current, dwell))
+	defer timer.Stop()
+
+	var queue []int
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		c.mu.Lock()
+		current := c.currentScene
+		c.mu.Unlock()
+		if len(queue) == 0 {
+			for _, i := range rand.Perm(len(c.sceneOrder)) {
+				if i != current {
+					queue = append(queue, i)
+				}
+			}
+		}
+		next := queue[0]
+		queue = queue[1:]
+		r.Post(func() { c.switchTo(next) })
+		timer.Reset(c.dwell(next, dwell))
+	}
+}
+
+// windowsScreensaverArgs translates the arguments Windows passes to a
+// screensaver (the executable renamed to .scr) into goshadertoy flags. "/s"
+// runs the screensaver, configured by the TOML file with the executable's
+// name next to it (goshadertoy.scr reads goshadertoy.toml). The settings
+// ("/c") and preview ("/p") requests are not supported and return nil args.
+// ok is false if args are not screensaver arguments.
+func windowsScreensaverArgs(exe string, args []string) (flags []string, ok bool) {
+	if len(args) == 0 || len(args[0]) < 2 || args[0][0] != '/' {
+		return nil, false
+	}
+	configPath := strings.TrimSuffix(exe, filepath.Ext(exe)) + ".toml"
+	switch strings.ToLower(args[0][1:2]) {
+	case "s":
+		flags = []string{"-mode", "live", "-screensaver"}
+		if _, err := os.Stat(configPath); err == nil {
+			flags = append(flags, "-config", configPath)
+		}
+		return flags, true
+	case "c":
+		log.Printf("goshadertoy has no settings dialog; put options such as shader = [...] and dwell in %s", configPath)
+		return nil, true
+	case "p":
+		return nil, true
+	}
+	return nil, false
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"log"
+	"runtime"
+
+	"github.com/richinsley/goshadertoy/api"
+	"github.com/richinsley/goshadertoy/graphics"
+	options "github.com/richinsley/goshadertoy/options"
+	renderer "github.com/richinsley/goshadertoy/renderer"
+)
+
+// silenceChunk is what the sound switcher sends while the active scene has no
+// sound shader: 16 rows of the sound texture, like a live sound chunk.
+var silenceChunk = make([]float32, 512*16*2)
+
+// soundSwitcher runs the sound shader of the active scene on the sound
+// context, so the audio follows the visuals when scenes switch. While a scene
+// without a sound shader is active it sends silence, as the shader audio device
+// always waits for audio in record mode.
+type soundSwitcher struct {
+	context graphics.Context
+	out     chan []float32
+	options *options.ShaderOptions
+
+	cancel context.CancelFunc // Stops the running sound shader or silence
+	done   chan struct{}      // Closed when it has stopped
+}
+
+func newSoundSwitcher(ctx graphics.Context, out chan []float32, options *options.ShaderOptions) *soundSwitcher {
+	return &soundSwitcher{context: ctx, out: out, options: options}
+}
+
+// play stops the sound of the previous scene and starts that of shaderArgs.
+// Audio the previous shader rendered but the device hasn't taken yet is
+// dropped, so the new scene is heard as soon as possible.
+func (s *soundSwitcher) play(shaderArgs *api.ShaderArgs) {
+	s.stop()
+	for drained := false; !drained; {
+		select {
+		case <-s.out:
+		default:
+			drained = true
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	s.cancel, s.done = cancel, done
+	if _, ok := shaderArgs.Buffers["sound"]; !ok {
+		go func() {
+			defer close(done)
+			s.sendSilence(ctx)
+		}()
+		return
+	}
+	go func() {
+		defer close(done)
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		if err := s.runShader(ctx, shaderArgs); err != nil {
+			log.Printf("Warning: sound shader of %s failed, playing silence: %v", shaderArgs.Title, err)
+			s.sendSilence(ctx)
+		}
+	}()
+}
+
+// runShader renders the sound shader of shaderArgs until ctx is done. It must
+// be called on a locked OS thread.
+func (s *soundSwitcher) runShader(ctx context.Context, shaderArgs *api.ShaderArgs) error {
+	input, err := newSoundInputDevice(s.options, shaderArgs)
+	if err != nil {
+		return err
+	}
+	if input != nil {
+		if err := input.Start(); err != nil {
+			return err
+		}
+		defer input.Stop()
+	}
+	soundRenderer := renderer.NewSoundShaderRenderer(s.context, s.out, shaderArgs, s.options, input)
+	s.context.MakeCurrent()
+	// The next sound shader may run on another thread.
+	defer s.context.DetachCurrent()
+	defer soundRenderer.Shutdown()
+	if err := soundRenderer.InitGL(); err != nil {
+		return err
+	}
+	soundRenderer.Run(ctx)
+	return nil
+}
+
+// sendSilence sends silent chunks until ctx is done. The audio device paces it.
+func (s *soundSwitcher) sendSilence(ctx context.Context) {
+	for {
+		select {
+		case s.out <- silenceChunk:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// stop stops the sound of the current scene and waits until it has stopped.
+func (s *soundSwitcher) stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+	s.cancel, s.done = nil, nil
+}
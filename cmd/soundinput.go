@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+
+	"github.com/richinsley/goshadertoy/api"
+	"github.com/richinsley/goshadertoy/audio"
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+// newSoundInputDevice creates the audio input a sound shader samples through
+// its mic, music and spectrogram channels, or returns nil if it has none.
+// With a sound shader the primary audio device carries the shader's own
+// output, so the input is a separate FFmpeg device for -audio-input-device or
+// -audio-input-file, or the music channel's file. It is never played; the
+// sound renderer consumes it. The caller must start it.
+func newSoundInputDevice(opts *options.ShaderOptions, shaderArgs *api.ShaderArgs) (audio.AudioDevice, error) {
+	pass := shaderArgs.Buffers["sound"]
+	if pass == nil {
+		return nil, nil
+	}
+	musicFile, wantsAudio := "", false
+	for _, input := range pass.Inputs {
+		if input == nil {
+			continue
+		}
+		switch input.CType {
+		case "mic", "spectrogram":
+			wantsAudio = true
+		case "music":
+			wantsAudio = true
+			if musicFile == "" {
+				musicFile = input.MusicFile
+			}
+		}
+	}
+	if !wantsAudio {
+		return nil, nil
+	}
+
+	inputOpts := *opts
+	inputOpts.AudioOutputDevice = new(string) // The sound shader's output is what gets played
+	if *opts.AudioInputDevice == "" && *opts.AudioInputFile == "" {
+		if musicFile == "" {
+			log.Println("Warning: the sound shader samples audio input, but none is given (use -audio-input-device or -audio-input-file); it will hear silence.")
+		}
+		inputOpts.AudioInputFile = &musicFile
+	}
+	return audio.NewFFmpegAudioDevice(&inputOpts)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	api "github.com/richinsley/goshadertoy/api"
+	glfwcontext "github.com/richinsley/goshadertoy/glfwcontext"
+	graphics "github.com/richinsley/goshadertoy/graphics"
+	headless "github.com/richinsley/goshadertoy/headless"
+	options "github.com/richinsley/goshadertoy/options"
+	renderer "github.com/richinsley/goshadertoy/renderer"
+)
+
+// runValidate implements "goshadertoy validate": every pass of each shader is
+// translated, compiled and linked in a hidden context, without rendering. It
+// prints one line per pass and returns the process exit code, 1 if any
+// shader failed.
+func runValidate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	shaderRefs := flags.String("shader", "", "Shader ID, local file, URL or dialect reference to validate; or a comma-separated list of them")
+	apiKey := flags.String("apikey", "", "Shadertoy API key (from SHADERTOY_KEY env var if not set)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: goshadertoy validate -shader ID|path[,ID|path...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *shaderRefs == "" {
+		flags.Usage()
+		return 2
+	}
+	if *apiKey == "" {
+		*apiKey = os.Getenv("SHADERTOY_KEY")
+	}
+
+	ctx, err := newValidationContext()
+	if err != nil {
+		log.Printf("Failed to create graphics context: %v", err)
+		return 2
+	}
+	defer ctx.Shutdown()
+	ctx.MakeCurrent()
+
+	failed := 0
+	for _, ref := range strings.Split(*shaderRefs, ",") {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		shaderArgs, err := api.LoadShaderArgs(*apiKey, ref, true)
+		if err != nil {
+			fmt.Printf("%s: FAIL\n  %v\n", ref, err)
+			failed++
+			continue
+		}
+		results, err := renderer.ValidateShader(ctx, shaderArgs)
+		if err != nil {
+			log.Printf("Failed to validate %s: %v", ref, err)
+			return 2
+		}
+		ok := true
+		for _, res := range results {
+			if res.Err != nil {
+				ok = false
+				fmt.Printf("%s [%s]: FAIL\n  %s\n", ref, res.Pass, strings.ReplaceAll(strings.TrimSpace(res.Err.Error()), "\n", "\n  "))
+			} else {
+				fmt.Printf("%s [%s]: OK\n", ref, res.Pass)
+			}
+		}
+		if !ok {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d shader(s) failed validation\n", failed)
+		return 1
+	}
+	return 0
+}
+
+// newValidationContext creates a context for compiling shaders: headless
+// where available, a hidden GLFW window elsewhere.
+func newValidationContext() (graphics.Context, error) {
+	if useHeadless() {
+		return headless.NewHeadless(1, 1)
+	}
+	if err := glfwcontext.InitGraphics(); err != nil {
+		return nil, err
+	}
+	width, height, bitDepth := 1, 1, 8
+	opts := &options.ShaderOptions{Width: &width, Height: &height, BitDepth: &bitDepth}
+	return glfwcontext.New(opts, false, nil)
+}
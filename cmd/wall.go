@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/richinsley/goshadertoy/framelock"
+	options "github.com/richinsley/goshadertoy/options"
+	renderer "github.com/richinsley/goshadertoy/renderer"
+)
+
+// parseViewport parses -viewport "X,Y,W,H" and -canvas "WxH".
+func parseViewport(viewport, canvas string) (renderer.Viewport, error) {
+	var vp renderer.Viewport
+	if _, err := fmt.Sscanf(viewport, "%d,%d,%d,%d", &vp.X, &vp.Y, &vp.Width, &vp.Height); err != nil {
+		return vp, fmt.Errorf("viewport '%s' is not X,Y,WIDTH,HEIGHT", viewport)
+	}
+	if _, err := fmt.Sscanf(canvas, "%dx%d", &vp.CanvasWidth, &vp.CanvasHeight); err != nil {
+		return vp, fmt.Errorf("canvas '%s' is not WIDTHxHEIGHT", canvas)
+	}
+	if vp.Width <= 0 || vp.Height <= 0 || vp.X < 0 || vp.Y < 0 || vp.X+vp.Width > vp.CanvasWidth || vp.Y+vp.Height > vp.CanvasHeight {
+		return vp, fmt.Errorf("viewport %s is not within the %s canvas", viewport, canvas)
+	}
+	return vp, nil
+}
+
+// setUpFrameLock makes the renderer a frame lock master or slave. The
+// returned function leaves the lock.
+func setUpFrameLock(r *renderer.Renderer, opts *options.ShaderOptions) (func(), error) {
+	switch *opts.FrameLock {
+	case "master":
+		m, err := framelock.NewMaster(*opts.FrameLockAddr, *opts.FrameLockSlaves)
+		if err != nil {
+			return nil, err
+		}
+		r.SetFrameLock(m)
+		return func() { m.Close() }, nil
+	case "slave":
+		s, err := framelock.NewSlave(*opts.FrameLockAddr)
+		if err != nil {
+			return nil, err
+		}
+		r.SetFrameLock(s)
+		return func() { s.Close() }, nil
+	}
+	return func() {}, nil
+}
@@ -0,0 +1,393 @@
+package config
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Config holds the settings read from a -config file. The file is YAML if its
+// name ends in .yaml or .yml (see loadYAML), and otherwise uses a subset of
+// TOML: top-level keys are command line flag names, and per-shader overrides go
+// in [shader.<id>] tables with uniform values in [shader.<id>.uniforms]:
+//
+//	mode = "record"
+//	width = 1920
+//	shader = ["XlSSzV", "4dXGR4"]
+//
+//	[shader.XlSSzV]
+//	duration = 30
+//	audio-input-file = "intro.wav"
+//
+//	[shader.XlSSzV.uniforms]
+//	uSpeed = 0.5
+//	uTint = [1.0, 0.2, 0.8]
+type Config struct {
+	Path        string
+	Options     map[string]string // Top-level flag values
+	Shaders     map[string]*ShaderOverrides
+	ShaderOrder []string // Shader IDs in the order their tables appear
+
+	// Values, set by Apply, of the flags any shader table overrides for the
+	// shaders whose table doesn't
+	base map[string]string
+}
+
+// ShaderOverrides are the settings of one [shader.<id>] table.
+type ShaderOverrides struct {
+	Options  map[string]string // Flag values that apply when this shader is rendered
+	Uniforms map[string][]float32
+}
+
+// Load reads and parses a config file.
+func Load(path string) (*Config, error) {
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		return loadYAML(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg := &Config{
+		Path:    path,
+		Options: make(map[string]string),
+		Shaders: make(map[string]*ShaderOverrides),
+	}
+
+	// Current table: nil shader means the top level.
+	var shader *ShaderOverrides
+	inUniforms := false
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("%s:%d: malformed table header", path, lineNum)
+			}
+			parts, err := splitKey(strings.TrimSpace(line[1 : len(line)-1]))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNum, err)
+			}
+			if len(parts) < 2 || len(parts) > 3 || parts[0] != "shader" || (len(parts) == 3 && parts[2] != "uniforms") {
+				return nil, fmt.Errorf("%s:%d: unknown table [%s] (expected [shader.<id>] or [shader.<id>.uniforms])", path, lineNum, strings.Join(parts, "."))
+			}
+			id := parts[1]
+			shader = cfg.Shaders[id]
+			if shader == nil {
+				shader = &ShaderOverrides{Options: make(map[string]string), Uniforms: make(map[string][]float32)}
+				cfg.Shaders[id] = shader
+				cfg.ShaderOrder = append(cfg.ShaderOrder, id)
+			}
+			inUniforms = len(parts) == 3
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected 'key = value'", path, lineNum)
+		}
+		keyParts, err := splitKey(strings.TrimSpace(key))
+		if err != nil || len(keyParts) != 1 {
+			return nil, fmt.Errorf("%s:%d: invalid key '%s'", path, lineNum, strings.TrimSpace(key))
+		}
+		name := keyParts[0]
+		val, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s: %w", path, lineNum, name, err)
+		}
+
+		switch {
+		case inUniforms:
+			floats, err := val.floats()
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: uniform %s: %w", path, lineNum, name, err)
+			}
+			shader.Uniforms[name] = floats
+		case shader != nil:
+			shader.Options[name] = val.flagValue()
+		default:
+			cfg.Options[name] = val.flagValue()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Apply sets every flag from the config that was not given on the command line.
+// The table of the first shader in the -shader list overrides the top-level
+// values; ShaderOptions gives those of the others for when they are switched
+// to. When the file lists no shader key, the shader tables are used in order.
+func (c *Config) Apply(fs *flag.FlagSet) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	if _, ok := c.Options["shader"]; !ok && len(c.ShaderOrder) > 0 {
+		c.Options["shader"] = strings.Join(c.ShaderOrder, ",")
+	}
+	if err := c.setFlags(fs, c.Options, explicit); err != nil {
+		return err
+	}
+
+	c.base = make(map[string]string)
+	for _, id := range c.ShaderOrder {
+		for name := range c.Shaders[id].Options {
+			if err := c.checkFlag(fs, name); err != nil {
+				return err
+			}
+			if !explicit[name] {
+				c.base[name] = fs.Lookup(name).Value.String()
+			}
+		}
+	}
+
+	if sf := fs.Lookup("shader"); sf != nil {
+		first, _, _ := strings.Cut(sf.Value.String(), ",")
+		if s, ok := c.Shaders[strings.TrimSpace(first)]; ok {
+			return c.setFlags(fs, s.Options, explicit)
+		}
+	}
+	return nil
+}
+
+// ShaderOptions returns the flag values to set when the shader id becomes
+// active: those of its table, and for the other flags any table overrides, the
+// values Apply set before the first shader's table. Flags given on the command
+// line are left out. Apply must have been called.
+func (c *Config) ShaderOptions(id string) map[string]string {
+	values := make(map[string]string, len(c.base))
+	for name, value := range c.base {
+		if s, ok := c.Shaders[id]; ok {
+			if own, ok := s.Options[name]; ok {
+				value = own
+			}
+		}
+		values[name] = value
+	}
+	return values
+}
+
+// Uniforms returns the uniform values configured for each shader ID.
+func (c *Config) Uniforms() map[string]map[string][]float32 {
+	uniforms := make(map[string]map[string][]float32)
+	for id, s := range c.Shaders {
+		if len(s.Uniforms) > 0 {
+			uniforms[id] = s.Uniforms
+		}
+	}
+	return uniforms
+}
+
+func (c *Config) setFlags(fs *flag.FlagSet, values map[string]string, explicit map[string]bool) error {
+	for name, value := range values {
+		if err := c.checkFlag(fs, name); err != nil {
+			return err
+		}
+		if explicit[name] {
+			continue // The command line wins
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s: invalid value for %s: %w", c.Path, name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) checkFlag(fs *flag.FlagSet, name string) error {
+	if name == "config" {
+		return fmt.Errorf("%s: config files cannot include other config files", c.Path)
+	}
+	if fs.Lookup(name) == nil {
+		return fmt.Errorf("%s: unknown option '%s'", c.Path, name)
+	}
+	return nil
+}
+
+// value is a parsed scalar or array. Scalars and array elements are kept as
+// text so they can be handed to flag.Value.Set.
+type value struct {
+	items []string
+}
+
+// flagValue renders the value as flag text; arrays become comma-separated lists.
+func (v value) flagValue() string {
+	return strings.Join(v.items, ",")
+}
+
+func (v value) floats() ([]float32, error) {
+	if len(v.items) == 0 || len(v.items) > 4 {
+		return nil, fmt.Errorf("expected 1 to 4 numbers")
+	}
+	floats := make([]float32, len(v.items))
+	for i, item := range v.items {
+		f, err := strconv.ParseFloat(item, 32)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a number", item)
+		}
+		floats[i] = float32(f)
+	}
+	return floats, nil
+}
+
+func parseValue(raw string) (value, error) {
+	if raw == "" {
+		return value{}, fmt.Errorf("missing value")
+	}
+	if strings.HasPrefix(raw, "[") {
+		if !strings.HasSuffix(raw, "]") {
+			return value{}, fmt.Errorf("unterminated array (arrays must be on one line)")
+		}
+		var v value
+		rest := strings.TrimSpace(raw[1 : len(raw)-1])
+		for rest != "" {
+			item, remainder, err := parseScalar(rest)
+			if err != nil {
+				return value{}, err
+			}
+			v.items = append(v.items, item)
+			rest = strings.TrimSpace(remainder)
+			if rest == "" {
+				break
+			}
+			if rest[0] != ',' {
+				return value{}, fmt.Errorf("expected ',' between array elements")
+			}
+			rest = strings.TrimSpace(rest[1:])
+		}
+		return v, nil
+	}
+	item, rest, err := parseScalar(raw)
+	if err != nil {
+		return value{}, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return value{}, fmt.Errorf("unexpected text after value: %s", rest)
+	}
+	return value{items: []string{item}}, nil
+}
+
+// parseScalar parses a string, number, or boolean at the start of s and returns
+// its text and the remainder of s.
+func parseScalar(s string) (string, string, error) {
+	switch s[0] {
+	case '"':
+		var sb strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch c := s[i]; c {
+			case '"':
+				return sb.String(), s[i+1:], nil
+			case '\\':
+				i++
+				if i >= len(s) {
+					return "", "", fmt.Errorf("unterminated string")
+				}
+				switch s[i] {
+				case 'n':
+					sb.WriteByte('\n')
+				case 't':
+					sb.WriteByte('\t')
+				case '"', '\\':
+					sb.WriteByte(s[i])
+				default:
+					return "", "", fmt.Errorf("unsupported escape '\\%c'", s[i])
+				}
+			default:
+				sb.WriteByte(c)
+			}
+		}
+		return "", "", fmt.Errorf("unterminated string")
+	case '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+
+	end := strings.IndexAny(s, ", \t]")
+	if end < 0 {
+		end = len(s)
+	}
+	token := s[:end]
+	if token != "true" && token != "false" {
+		if _, err := strconv.ParseFloat(strings.ReplaceAll(token, "_", ""), 64); err != nil {
+			return "", "", fmt.Errorf("invalid value '%s' (strings must be quoted)", token)
+		}
+		token = strings.ReplaceAll(token, "_", "")
+	}
+	return token, s[end:], nil
+}
+
+// splitKey splits a dotted key into its parts; parts may be quoted.
+func splitKey(key string) ([]string, error) {
+	var parts []string
+	for key != "" {
+		var part string
+		if key[0] == '"' || key[0] == '\'' {
+			end := strings.IndexByte(key[1:], key[0])
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted key")
+			}
+			part, key = key[1:end+1], strings.TrimSpace(key[end+2:])
+		} else {
+			end := strings.IndexByte(key, '.')
+			if end < 0 {
+				end = len(key)
+			}
+			part, key = strings.TrimSpace(key[:end]), key[end:]
+			if part == "" || strings.ContainsAny(part, " \t\"'") {
+				return nil, fmt.Errorf("invalid key")
+			}
+		}
+		parts = append(parts, part)
+		if key == "" {
+			break
+		}
+		if key[0] != '.' {
+			return nil, fmt.Errorf("invalid key")
+		}
+		key = strings.TrimSpace(key[1:])
+		if key == "" {
+			return nil, fmt.Errorf("invalid key")
+		}
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty key")
+	}
+	return parts, nil
+}
+
+// stripComment removes a trailing '#' comment that is not inside a string.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
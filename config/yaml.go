@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadYAML reads a YAML config file. It holds the same settings as the TOML
+// form: top-level keys are flag names, and a shader mapping holds the
+// per-shader overrides, in playlist order, with their uniforms:
+//
+//	mode: record
+//	width: 1920
+//	shader:
+//	  XlSSzV:
+//	    duration: 30
+//	    audio-input-file: intro.wav
+//	    uniforms:
+//	      uSpeed: 0.5
+//	      uTint: [1.0, 0.2, 0.8]
+//	  4dXGR4:
+//
+// A shader key holding an ID or a list of IDs sets the flag instead.
+func loadYAML(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	cfg := &Config{
+		Path:    path,
+		Options: make(map[string]string),
+		Shaders: make(map[string]*ShaderOverrides),
+	}
+	if len(doc.Content) == 0 {
+		return cfg, nil // Empty file
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: expected a mapping of option names to values", path, root.Line)
+	}
+	for i := 0; i < len(root.Content); i += 2 {
+		key, node := root.Content[i], root.Content[i+1]
+		if key.Value == "shader" && node.Kind == yaml.MappingNode {
+			if err := cfg.loadYAMLShaders(node); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		val, err := yamlValue(node)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s: %w", path, key.Line, key.Value, err)
+		}
+		cfg.Options[key.Value] = val.flagValue()
+	}
+	return cfg, nil
+}
+
+// loadYAMLShaders reads the mapping of shader IDs to their overrides.
+func (c *Config) loadYAMLShaders(shaders *yaml.Node) error {
+	for i := 0; i < len(shaders.Content); i += 2 {
+		id, table := shaders.Content[i].Value, shaders.Content[i+1]
+		if table.Kind != yaml.MappingNode && !isNull(table) {
+			return fmt.Errorf("%s:%d: shader %s: expected a mapping of overrides", c.Path, table.Line, id)
+		}
+		shader := c.Shaders[id]
+		if shader == nil {
+			shader = &ShaderOverrides{Options: make(map[string]string), Uniforms: make(map[string][]float32)}
+			c.Shaders[id] = shader
+			c.ShaderOrder = append(c.ShaderOrder, id)
+		}
+		for j := 0; j < len(table.Content); j += 2 {
+			key, node := table.Content[j], table.Content[j+1]
+			if key.Value == "uniforms" {
+				if err := c.loadYAMLUniforms(shader, node); err != nil {
+					return err
+				}
+				continue
+			}
+			val, err := yamlValue(node)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %s: %w", c.Path, key.Line, key.Value, err)
+			}
+			shader.Options[key.Value] = val.flagValue()
+		}
+	}
+	return nil
+}
+
+func (c *Config) loadYAMLUniforms(shader *ShaderOverrides, uniforms *yaml.Node) error {
+	if uniforms.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s:%d: expected a mapping of uniform names to values", c.Path, uniforms.Line)
+	}
+	for i := 0; i < len(uniforms.Content); i += 2 {
+		key, node := uniforms.Content[i], uniforms.Content[i+1]
+		val, err := yamlValue(node)
+		if err != nil {
+			return fmt.Errorf("%s:%d: uniform %s: %w", c.Path, key.Line, key.Value, err)
+		}
+		floats, err := val.floats()
+		if err != nil {
+			return fmt.Errorf("%s:%d: uniform %s: %w", c.Path, key.Line, key.Value, err)
+		}
+		shader.Uniforms[key.Value] = floats
+	}
+	return nil
+}
+
+// yamlValue converts a scalar or a sequence of scalars, keeping their text.
+func yamlValue(node *yaml.Node) (value, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if isNull(node) {
+			return value{}, fmt.Errorf("missing value")
+		}
+		return value{items: []string{node.Value}}, nil
+	case yaml.SequenceNode:
+		var v value
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return value{}, fmt.Errorf("array elements must be plain values")
+			}
+			v.items = append(v.items, item.Value)
+		}
+		return v, nil
+	}
+	return value{}, fmt.Errorf("expected a value or an array of values")
+}
+
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
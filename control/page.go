@@ -0,0 +1,130 @@
+package control
+
+// controlPageHTML is the single-page monitor/controller. It is kept small and
+// dependency-free so it loads quickly on a phone.
+const controlPageHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>goshadertoy control</title>
+<style>
+body { font-family: sans-serif; background: #111; color: #ddd; margin: 0; padding: 8px; }
+h2 { font-size: 1em; margin: 12px 0 4px; color: #8cf; }
+#preview { width: 100%; max-width: 640px; background: #000; display: block; }
+button { margin: 2px; padding: 8px 10px; background: #333; color: #ddd; border: 1px solid #555; border-radius: 4px; }
+button.active { background: #2a6; color: #fff; }
+.meter { height: 10px; background: #333; margin: 2px 0; width: 100%; max-width: 320px; }
+.meter div { height: 100%; background: #2a6; }
+table { border-collapse: collapse; }
+td { padding: 2px 8px 2px 0; }
+input[type=range] { width: 200px; }
+#error { color: #f66; }
+</style>
+</head>
+<body>
+<img id="preview" src="/stream.mjpg" alt="preview unavailable">
+<div id="error"></div>
+<h2>Status</h2>
+<table>
+<tr><td>Mode</td><td id="mode"></td></tr>
+<tr><td>Frame</td><td id="frame"></td></tr>
+<tr><td>FPS</td><td id="fps"></td></tr>
+</table>
+<h2>Scenes</h2>
+<div><button id="prevScene">&lt; Previous</button> <span id="sceneIndex"></span> <button id="nextScene">Next &gt;</button></div>
+<div id="scenes"></div>
+<h2>Audio</h2>
+<div>L <div class="meter"><div id="levelL"></div></div></div>
+<div>R <div class="meter"><div id="levelR"></div></div></div>
+<div id="audioBuffer"></div>
+<div>Smoothing <input type="range" id="fftSmoothing" min="0" max="0.99" step="0.01" value="0.8"></div>
+<div>Min dB <input type="range" id="fftMin" min="-140" max="-30" step="1" value="-100"></div>
+<div>Max dB <input type="range" id="fftMax" min="-60" max="0" step="1" value="-30"></div>
+<h2>Uniforms</h2>
+<div id="uniforms"></div>
+<h2>Encoders</h2>
+<table id="encoders"></table>
+<script>
+let ws;
+let uniformsBuilt = "";
+let fftLoaded = false;
+function send(cmd) { if (ws && ws.readyState === 1) ws.send(JSON.stringify(cmd)); }
+function meter(db) { return Math.max(0, Math.min(100, (db + 60) / 60 * 100)) + "%"; }
+function sendFFT() {
+  send({cmd: "fft", fft: {
+    smoothing: parseFloat(fftSmoothing.value),
+    minDecibels: parseFloat(fftMin.value),
+    maxDecibels: parseFloat(fftMax.value)}});
+}
+[fftSmoothing, fftMin, fftMax].forEach(el => el.onchange = sendFFT);
+prevScene.onclick = () => send({cmd: "scene", scene: "previous"});
+nextScene.onclick = () => send({cmd: "scene", scene: "next"});
+function render(s) {
+  mode.textContent = s.mode;
+  frame.textContent = s.frame;
+  fps.textContent = s.fps.toFixed(1);
+  sceneIndex.textContent = (s.currentScene + 1) + " of " + (s.scenes || []).length;
+  scenes.innerHTML = "";
+  (s.scenes || []).forEach((sc, i) => {
+    const b = document.createElement("button");
+    b.textContent = (i + 1) + ": " + sc.title;
+    if (i === s.currentScene) b.className = "active";
+    b.onclick = () => send({cmd: "scene", scene: String(i + 1)});
+    scenes.appendChild(b);
+  });
+  if (!fftLoaded) {
+    fftLoaded = true;
+    fftSmoothing.value = s.fft.smoothing;
+    fftMin.value = s.fft.minDecibels;
+    fftMax.value = s.fft.maxDecibels;
+  }
+  levelL.style.width = meter(s.audio.rms[0]);
+  levelR.style.width = meter(s.audio.rms[1]);
+  const ab = s.audioBuffer;
+  audioBuffer.textContent = "Buffer " + ab.queuedMs.toFixed(0) + " / " + ab.capacityMs.toFixed(0) + " ms, " +
+    ab.underruns + " underruns, " + ab.droppedMs.toFixed(0) + " ms dropped";
+  const key = JSON.stringify((s.uniforms || []).map(u => u.name + u.components));
+  if (key !== uniformsBuilt) {
+    uniformsBuilt = key;
+    uniforms.innerHTML = "";
+    (s.uniforms || []).forEach(u => {
+      const row = document.createElement("div");
+      row.textContent = u.name + " ";
+      for (let c = 0; c < u.components; c++) {
+        const r = document.createElement("input");
+        r.type = "range"; r.min = 0; r.max = 1; r.step = 0.001;
+        r.value = (u.value && u.value[c]) || 0;
+        r.oninput = () => send({cmd: "uniform", name: u.name,
+          value: Array.from(row.querySelectorAll("input")).map(x => parseFloat(x.value))});
+        row.appendChild(r);
+      }
+      uniforms.appendChild(row);
+    });
+  }
+  encoders.innerHTML = "";
+  (s.encoders || []).forEach(e => {
+    const tr = document.createElement("tr");
+    tr.innerHTML = "<td></td><td>" + e.videoFrames + " frames</td><td>" +
+      e.bitrateKbps.toFixed(0) + " kbps</td><td>" + e.droppedFrames + " dropped</td><td>queue " +
+      e.queueLength + "/" + e.queueDepth + " (peak " + e.queuePeak + ", mean " + e.queueMean.toFixed(1) +
+      ", " + e.queuePolicy + ", " + e.queueWaits + " waits)</td>";
+    tr.firstChild.textContent = e.output;
+    encoders.appendChild(tr);
+  });
+}
+function connect() {
+  ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws?token=" +
+    encodeURIComponent(new URLSearchParams(location.search).get("token") || ""));
+  ws.onmessage = ev => {
+    const msg = JSON.parse(ev.data);
+    if (msg.status) { error.textContent = ""; render(msg.status); }
+    if (msg.error) error.textContent = msg.error;
+  };
+  ws.onclose = () => setTimeout(connect, 1000);
+}
+connect();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,262 @@
+package control
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	logging "github.com/richinsley/goshadertoy/logging"
+	preview "github.com/richinsley/goshadertoy/preview"
+)
+
+// SceneInfo describes one loaded scene.
+type SceneInfo struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// UniformInfo describes a user-declared uniform that can be adjusted.
+type UniformInfo struct {
+	Name       string    `json:"name"`
+	Components int       `json:"components"`
+	Value      []float32 `json:"value"`
+}
+
+// AudioLevels holds per-channel levels of the audio being visualized, in dBFS.
+type AudioLevels struct {
+	RMS  [2]float64 `json:"rms"`
+	Peak [2]float64 `json:"peak"`
+}
+
+// AudioBuffer reports how full the audio buffer is and how often it ran dry
+// or overflowed.
+type AudioBuffer struct {
+	QueuedMs   float64 `json:"queuedMs"`
+	CapacityMs float64 `json:"capacityMs"`
+	Underruns  int64   `json:"underruns"`
+	DroppedMs  float64 `json:"droppedMs"`
+}
+
+// EncoderStats reports the progress of one output.
+type EncoderStats struct {
+	Output        string  `json:"output"`
+	VideoFrames   int64   `json:"videoFrames"`
+	BytesWritten  int64   `json:"bytesWritten"`
+	BitrateKbps   float64 `json:"bitrateKbps"`
+	DroppedFrames int64   `json:"droppedFrames"`
+	QueuePolicy   string  `json:"queuePolicy"`
+	QueueDepth    int     `json:"queueDepth"`
+	QueueLength   int     `json:"queueLength"`
+	QueuePeak     int     `json:"queuePeak"`
+	QueueMean     float64 `json:"queueMean"`
+	QueueWaits    int64   `json:"queueWaits"`
+}
+
+// Status is the snapshot pushed to web clients.
+type Status struct {
+	Mode         string         `json:"mode"`
+	Scenes       []SceneInfo    `json:"scenes"`
+	CurrentScene int            `json:"currentScene"`
+	Frame        int64          `json:"frame"`
+	FPS          float64        `json:"fps"`
+	Audio        AudioLevels    `json:"audio"`
+	AudioBuffer  AudioBuffer    `json:"audioBuffer"`
+	FFT          FFTSettings    `json:"fft"`
+	Uniforms     []UniformInfo  `json:"uniforms"`
+	Encoders     []EncoderStats `json:"encoders"`
+}
+
+// FFTSettings adjusts the audio analysis of mic/music channels.
+type FFTSettings struct {
+	Smoothing   float64 `json:"smoothing"`
+	MinDecibels float64 `json:"minDecibels"`
+	MaxDecibels float64 `json:"maxDecibels"`
+}
+
+// Handler is implemented by the application to expose its state and accept commands.
+// Methods are called from HTTP goroutines.
+type Handler interface {
+	Status() Status
+	// SwitchScene selects a scene by 1-based index or shader ID, or the
+	// "next" or "previous" one.
+	SwitchScene(ref string) error
+	SetUniform(name string, value []float32) error
+	SetFFT(settings FFTSettings) error
+}
+
+// command is a message from a web client.
+type command struct {
+	Cmd   string      `json:"cmd"`
+	Scene string      `json:"scene,omitempty"`
+	Name  string      `json:"name,omitempty"`
+	Value []float32   `json:"value,omitempty"`
+	FFT   FFTSettings `json:"fft"`
+}
+
+// Server is the embedded monitor and controller: a web page with a live preview,
+// a WebSocket status feed, and a small JSON API.
+type Server struct {
+	handler  Handler
+	preview  *preview.MJPEGServer
+	interval time.Duration
+	token    string // Required by the WebSocket and the command API
+}
+
+// NewServer creates a control server. preview may be nil. Commands need token,
+// passed as the token query parameter or an "Authorization: Bearer" header; an
+// empty token is replaced by a random one, logged with the UI's address.
+func NewServer(handler Handler, pv *preview.MJPEGServer, token string) *Server {
+	if token == "" {
+		token = randomToken()
+	}
+	logging.Redact(token) // Kept out of diagnostics
+	return &Server{handler: handler, preview: pv, interval: 500 * time.Millisecond, token: token}
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("control: failed to generate token: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// authorized reports whether r carries the server's token.
+func (s *Server) authorized(r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = bearer
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// ListenAndServe serves the UI on addr in the background.
+func (s *Server) ListenAndServe(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.servePage)
+	mux.HandleFunc("/ws", s.serveWebSocket)
+	mux.HandleFunc("/api/status", s.serveStatus)
+	mux.HandleFunc("/api/command", s.serveCommand)
+	if s.preview != nil {
+		s.preview.Register(mux)
+	}
+	go func() {
+		log.Printf("Control UI available at http://%s/?token=%s", addr, s.token)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("Control server stopped: %v", err)
+		}
+	}()
+}
+
+func (s *Server) servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, controlPageHTML)
+}
+
+func (s *Server) serveStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.handler.Status())
+}
+
+// serveCommand accepts a JSON command via POST, for scripting without a WebSocket.
+func (s *Server) serveCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST a JSON command", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(r) {
+		http.Error(w, "missing or wrong token", http.StatusUnauthorized)
+		return
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin command refused", http.StatusForbidden)
+		return
+	}
+	var cmd command
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxMessageSize)).Decode(&cmd); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.dispatch(cmd); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "missing or wrong token", http.StatusUnauthorized)
+		return
+	}
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	go s.pushStatus(conn, done)
+	defer close(done)
+
+	for {
+		msg, err := conn.ReadText()
+		if err != nil {
+			return
+		}
+		var cmd command
+		if err := json.Unmarshal(msg, &cmd); err != nil {
+			s.sendError(conn, fmt.Errorf("invalid command: %w", err))
+			continue
+		}
+		if err := s.dispatch(cmd); err != nil {
+			s.sendError(conn, err)
+		}
+	}
+}
+
+// pushStatus sends a status snapshot at a fixed interval until done is closed.
+func (s *Server) pushStatus(conn *wsConn, done <-chan struct{}) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		data, _ := json.Marshal(map[string]any{"status": s.handler.Status()})
+		if err := conn.WriteText(data); err != nil {
+			return
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) sendError(conn *wsConn, err error) {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	conn.WriteText(data)
+}
+
+func (s *Server) dispatch(cmd command) error {
+	switch cmd.Cmd {
+	case "scene":
+		return s.handler.SwitchScene(cmd.Scene)
+	case "uniform":
+		return s.handler.SetUniform(cmd.Name, cmd.Value)
+	case "fft":
+		return s.handler.SetFFT(cmd.FFT)
+	default:
+		return fmt.Errorf("unknown command '%s'", cmd.Cmd)
+	}
+}
@@ -0,0 +1,88 @@
+package datasource
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// csvSource plays rows of values over time.
+type csvSource struct {
+	times  []float64
+	rows   [][]float32
+	values []float32 // Interpolated values returned by Values
+}
+
+func openCSV(path string) (*csvSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := &csvSource{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	width := 0
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		values, err := parseValues(text)
+		if err != nil {
+			if len(s.rows) == 0 && line == 1 {
+				continue // Header
+			}
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if len(values) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected a time and at least one value", path, line)
+		}
+		s.times = append(s.times, float64(values[0]))
+		s.rows = append(s.rows, values[1:])
+		width = max(width, len(values)-1)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if len(s.rows) == 0 {
+		return nil, fmt.Errorf("%s has no data rows", path)
+	}
+	if !sort.Float64sAreSorted(s.times) {
+		return nil, fmt.Errorf("%s: times must be in increasing order", path)
+	}
+	// Short rows are padded with zeros.
+	for i, row := range s.rows {
+		if len(row) < width {
+			s.rows[i] = append(row, make([]float32, width-len(row))...)
+		}
+	}
+	s.values = make([]float32, width)
+	return s, nil
+}
+
+// Values interpolates linearly between the rows around t, holding the first
+// and last rows outside them.
+func (s *csvSource) Values(t float64) []float32 {
+	i := sort.Search(len(s.times), func(i int) bool { return s.times[i] > t })
+	switch {
+	case i == 0:
+		copy(s.values, s.rows[0])
+	case i == len(s.times):
+		copy(s.values, s.rows[i-1])
+	default:
+		t0, t1 := s.times[i-1], s.times[i]
+		f := float32((t - t0) / (t1 - t0))
+		for j := range s.values {
+			s.values[j] = s.rows[i-1][j] + f*(s.rows[i][j]-s.rows[i-1][j])
+		}
+	}
+	return s.values
+}
+
+func (s *csvSource) Close() error {
+	return nil
+}
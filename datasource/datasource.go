@@ -0,0 +1,146 @@
+// Package datasource reads external data for data channels, which give
+// shaders a row of float values each frame. Sources are:
+//
+//	csv:FILE  rows of "time,value,..." played in shader time, interpolated
+//	          between rows; a header line is skipped
+//	osc:ADDR  OSC messages on UDP address ADDR (e.g. ":9000"); the float and
+//	          int arguments of a message whose address ends in /N set the
+//	          values from N on, otherwise from 0
+//	stdin     lines of numbers separated by spaces or commas; each line
+//	          replaces the values
+package datasource
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MaxValues is the most values a source supplies.
+const MaxValues = 4096
+
+// Source supplies the values of a data channel.
+type Source interface {
+	// Values returns the values for shader time t.
+	Values(t float64) []float32
+
+	// Close stops reading the source.
+	Close() error
+}
+
+var (
+	sharedMu sync.Mutex
+	shared   = make(map[string]*sharedSource)
+)
+
+// sharedSource is a source opened by several channels, e.g. of the scenes of
+// a playlist, which is closed with the last of them.
+type sharedSource struct {
+	Source
+	spec string
+	refs int
+}
+
+func (s *sharedSource) Close() error {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if s.refs--; s.refs > 0 {
+		return nil
+	}
+	delete(shared, s.spec)
+	return s.Source.Close()
+}
+
+// Open opens the source described by spec, or shares it if it is open.
+func Open(spec string) (Source, error) {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if s, ok := shared[spec]; ok {
+		s.refs++
+		return s, nil
+	}
+	source, err := open(spec)
+	if err != nil {
+		return nil, err
+	}
+	s := &sharedSource{Source: source, spec: spec, refs: 1}
+	shared[spec] = s
+	return s, nil
+}
+
+func open(spec string) (Source, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "csv":
+		return openCSV(arg)
+	case "osc":
+		return listenOSC(arg)
+	case "stdin":
+		return newStreamSource(os.Stdin), nil
+	}
+	return nil, fmt.Errorf("unknown data source '%s', expected csv:FILE, osc:ADDR or stdin", spec)
+}
+
+// parseValues parses numbers separated by spaces or commas.
+func parseValues(line string) ([]float32, error) {
+	fields := strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+	values := make([]float32, 0, len(fields))
+	for _, f := range fields {
+		v, err := strconv.ParseFloat(f, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s'", f)
+		}
+		values = append(values, float32(v))
+	}
+	if len(values) > MaxValues {
+		values = values[:MaxValues]
+	}
+	return values, nil
+}
+
+// streamSource holds the last line of numbers read from a stream.
+type streamSource struct {
+	r      io.Reader
+	mu     sync.Mutex
+	values []float32
+}
+
+func newStreamSource(r io.Reader) *streamSource {
+	s := &streamSource{r: r}
+	go s.read()
+	return s
+}
+
+func (s *streamSource) read() {
+	scanner := bufio.NewScanner(s.r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		values, err := parseValues(line)
+		if err != nil {
+			log.Printf("Warning: skipping data line: %v", err)
+			continue
+		}
+		s.mu.Lock()
+		s.values = values
+		s.mu.Unlock()
+	}
+}
+
+func (s *streamSource) Values(t float64) []float32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values
+}
+
+// Close does nothing: the stream is read until it ends.
+func (s *streamSource) Close() error {
+	return nil
+}
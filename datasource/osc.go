@@ -0,0 +1,158 @@
+package datasource
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// oscSource holds the values set by OSC messages.
+type oscSource struct {
+	conn   net.PacketConn
+	mu     sync.Mutex
+	values []float32
+}
+
+func listenOSC(addr string) (*oscSource, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("osc data source needs an address, e.g. osc::9000")
+	}
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for OSC: %w", err)
+	}
+	log.Printf("Listening for OSC data on %s", conn.LocalAddr())
+	s := &oscSource{conn: conn}
+	go s.read()
+	return s, nil
+}
+
+func (s *oscSource) read() {
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return // Closed
+		}
+		if err := s.handlePacket(buf[:n]); err != nil {
+			log.Printf("Warning: skipping OSC packet: %v", err)
+		}
+	}
+}
+
+// handlePacket applies a message or the messages of a bundle.
+func (s *oscSource) handlePacket(p []byte) error {
+	if !bytes.HasPrefix(p, []byte("#bundle\x00")) {
+		return s.handleMessage(p)
+	}
+	if len(p) < 16 {
+		return fmt.Errorf("truncated bundle")
+	}
+	p = p[16:] // "#bundle", time tag
+	for len(p) >= 4 {
+		size := int(binary.BigEndian.Uint32(p))
+		if size > len(p)-4 {
+			return fmt.Errorf("truncated bundle")
+		}
+		if err := s.handlePacket(p[4 : 4+size]); err != nil {
+			return err
+		}
+		p = p[4+size:]
+	}
+	return nil
+}
+
+// handleMessage sets values from the numeric arguments of a message.
+func (s *oscSource) handleMessage(p []byte) error {
+	address, p, err := oscString(p)
+	if err != nil {
+		return err
+	}
+	tags, p, err := oscString(p)
+	if err != nil || !strings.HasPrefix(tags, ",") {
+		return fmt.Errorf("message %s has no type tags", address)
+	}
+
+	var args []float32
+	for _, tag := range tags[1:] {
+		var v float64
+		switch tag {
+		case 'f', 'i':
+			if len(p) < 4 {
+				return fmt.Errorf("truncated message %s", address)
+			}
+			bits := binary.BigEndian.Uint32(p)
+			if tag == 'f' {
+				v = float64(math.Float32frombits(bits))
+			} else {
+				v = float64(int32(bits))
+			}
+			p = p[4:]
+		case 'd', 'h':
+			if len(p) < 8 {
+				return fmt.Errorf("truncated message %s", address)
+			}
+			bits := binary.BigEndian.Uint64(p)
+			if tag == 'd' {
+				v = math.Float64frombits(bits)
+			} else {
+				v = float64(int64(bits))
+			}
+			p = p[8:]
+		case 'T':
+			v = 1
+		case 'F':
+			v = 0
+		default:
+			return fmt.Errorf("message %s has unsupported argument type '%c'", address, tag)
+		}
+		args = append(args, float32(v))
+	}
+
+	start := 0
+	if i := strings.LastIndex(address, "/"); i >= 0 {
+		if n, err := strconv.Atoi(address[i+1:]); err == nil && n >= 0 {
+			start = n
+		}
+	}
+	if start+len(args) > MaxValues {
+		return fmt.Errorf("message %s sets values beyond %d", address, MaxValues)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if need := start + len(args); need > len(s.values) {
+		s.values = append(s.values, make([]float32, need-len(s.values))...)
+	}
+	copy(s.values[start:], args)
+	return nil
+}
+
+// oscString reads a null-terminated string padded to four bytes.
+func oscString(p []byte) (string, []byte, error) {
+	end := bytes.IndexByte(p, 0)
+	if end < 0 {
+		return "", nil, fmt.Errorf("unterminated string")
+	}
+	next := (end + 4) &^ 3
+	if next > len(p) {
+		next = len(p)
+	}
+	return string(p[:end]), p[next:], nil
+}
+
+func (s *oscSource) Values(t float64) []float32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]float32(nil), s.values...)
+}
+
+func (s *oscSource) Close() error {
+	return s.conn.Close()
+}
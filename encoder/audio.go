@@ -0,0 +1,269 @@
+package encoder
+
+/*
+#include <libavcodec/avcodec.h>
+#include <libavutil/audio_fifo.h>
+#include <libavutil/channel_layout.h>
+#include <libavutil/samplefmt.h>
+#include <libswresample/swresample.h>
+#include <stdlib.h>
+
+// The supported format/rate lists are terminated arrays; index them from C
+// rather than doing pointer arithmetic in Go.
+static enum AVSampleFormat codec_sample_fmt_at(const AVCodec* c, int i) {
+    return c->sample_fmts ? c->sample_fmts[i] : AV_SAMPLE_FMT_NONE;
+}
+
+static int codec_sample_rate_at(const AVCodec* c, int i) {
+    return c->supported_samplerates ? c->supported_samplerates[i] : 0;
+}
+
+// swr_convert takes arrays of plane pointers; the renderer's audio is interleaved.
+static int convert_interleaved(SwrContext* s, uint8_t** out, int outCount, const float* in, int inCount) {
+    const uint8_t* inPlanes[1] = { (const uint8_t*)in };
+    return swr_convert(s, out, outCount, in ? inPlanes : NULL, inCount);
+}
+*/
+import "C"
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+// audioCodecs maps the -audio-codec names to FFmpeg encoders, in order of preference.
+var audioCodecs = map[string][]string{
+	"aac":       {"aac"},
+	"opus":      {"libopus", "opus"},
+	"flac":      {"flac"},
+	"pcm_s24le": {"pcm_s24le"},
+}
+
+// preferredSampleFormats is the order in which encoder sample formats are chosen.
+var preferredSampleFormats = []C.enum_AVSampleFormat{
+	C.AV_SAMPLE_FMT_FLTP, C.AV_SAMPLE_FMT_FLT,
+	C.AV_SAMPLE_FMT_S32P, C.AV_SAMPLE_FMT_S32,
+	C.AV_SAMPLE_FMT_S16P, C.AV_SAMPLE_FMT_S16,
+}
+
+// ValidateAudioCodec checks an -audio-codec value. An empty name selects a default per container.
+func ValidateAudioCodec(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, ok := audioCodecs[name]; !ok {
+		return fmt.Errorf("unsupported audio codec '%s' (valid: aac, opus, flac, pcm_s24le)", name)
+	}
+	return nil
+}
+
+// defaultAudioCodec picks a codec that suits the output container.
+func defaultAudioCodec(opts *options.ShaderOptions) string {
+	if *opts.Mode == "stream" {
+		return "aac" // MPEG-TS
+	}
+	if c, ok := Containers[containerName(opts)]; ok {
+		return c.audioCodecs[0]
+	}
+	switch strings.ToLower(filepath.Ext(*opts.OutputFile)) {
+	case ".webm", ".ogg":
+		return "opus"
+	case ".mov":
+		return "pcm_s24le"
+	default:
+		return "aac"
+	}
+}
+
+// findAudioEncoder resolves the configured audio codec to an FFmpeg encoder.
+func findAudioEncoder(opts *options.ShaderOptions) (*C.AVCodec, error) {
+	name := *opts.AudioCodec
+	if name == "" {
+		name = defaultAudioCodec(opts)
+	}
+	for _, encoderName := range audioCodecs[name] {
+		cName := C.CString(encoderName)
+		codec := C.avcodec_find_encoder_by_name(cName)
+		C.free(unsafe.Pointer(cName))
+		if codec != nil {
+			log.Printf("Selected audio encoder: %s", encoderName)
+			return codec, nil
+		}
+	}
+	return nil, fmt.Errorf("could not find an encoder for audio codec '%s'", name)
+}
+
+// chooseSampleFormat picks the most precise sample format the encoder accepts.
+func chooseSampleFormat(codec *C.AVCodec) C.enum_AVSampleFormat {
+	supported := map[C.enum_AVSampleFormat]bool{}
+	for i := 0; ; i++ {
+		f := C.codec_sample_fmt_at(codec, C.int(i))
+		if f == C.AV_SAMPLE_FMT_NONE {
+			break
+		}
+		supported[f] = true
+	}
+	for _, f := range preferredSampleFormats {
+		if supported[f] {
+			return f
+		}
+	}
+	return C.AV_SAMPLE_FMT_FLTP
+}
+
+// chooseSampleRate returns want if the encoder supports it, otherwise the closest supported rate.
+func chooseSampleRate(codec *C.AVCodec, want int) int {
+	best := 0
+	for i := 0; ; i++ {
+		rate := int(C.codec_sample_rate_at(codec, C.int(i)))
+		if rate == 0 {
+			break
+		}
+		if rate == want {
+			return want
+		}
+		if best == 0 || abs(rate-want) < abs(best-want) {
+			best = rate
+		}
+	}
+	if best == 0 {
+		return want // No restrictions
+	}
+	return best
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func (e *FFmpegEncoder) openAudio(codec *C.AVCodec, opts *options.ShaderOptions) error {
+	ctx := e.audioCodecCtx
+	ctx.sample_fmt = chooseSampleFormat(codec)
+	ctx.sample_rate = C.int(chooseSampleRate(codec, *opts.AudioSampleRate))
+	ctx.time_base = C.AVRational{num: 1, den: ctx.sample_rate}
+	ctx.bit_rate = C.int64_t(*opts.AudioBitrate * 1000)
+	C.av_channel_layout_default(&ctx.ch_layout, C.int(*opts.AudioOutChannels))
+	if int(ctx.sample_rate) != *opts.AudioSampleRate {
+		log.Printf("Audio encoder does not support %d Hz, encoding at %d Hz.", *opts.AudioSampleRate, int(ctx.sample_rate))
+	}
+
+	if (e.formatCtx.oformat.flags & C.AVFMT_GLOBALHEADER) != 0 {
+		ctx.flags |= C.AV_CODEC_FLAG_GLOBAL_HEADER
+	}
+
+	if C.avcodec_open2(ctx, codec, nil) < 0 {
+		return fmt.Errorf("could not open audio codec")
+	}
+
+	if C.avcodec_parameters_from_context(e.audioStream.codecpar, ctx) < 0 {
+		return fmt.Errorf("could not copy audio codec parameters to stream")
+	}
+	e.audioStream.time_base = ctx.time_base
+
+	// PCM encoders accept any frame size and report 0.
+	e.audioFrameSize = int(ctx.frame_size)
+	if e.audioFrameSize == 0 {
+		e.audioFrameSize = 1024
+	}
+
+	// The renderer delivers interleaved stereo float at the pipeline rate;
+	// convert it to whatever the encoder wants.
+	var inLayout C.AVChannelLayout
+	C.av_channel_layout_default(&inLayout, 2)
+	defer C.av_channel_layout_uninit(&inLayout)
+	if C.swr_alloc_set_opts2(&e.audioSwr,
+		&ctx.ch_layout, ctx.sample_fmt, ctx.sample_rate,
+		&inLayout, C.AV_SAMPLE_FMT_FLT, C.int(*opts.AudioSampleRate), 0, nil) < 0 || C.swr_init(e.audioSwr) < 0 {
+		return fmt.Errorf("could not initialize audio resampler")
+	}
+
+	e.audioFifo = C.av_audio_fifo_alloc(ctx.sample_fmt, ctx.ch_layout.nb_channels, C.int(e.audioFrameSize))
+	if e.audioFifo == nil {
+		return fmt.Errorf("could not allocate audio FIFO")
+	}
+
+	// Initialize the audio frame
+	e.audioFrame = C.av_frame_alloc()
+	e.audioFrame.nb_samples = C.int(e.audioFrameSize)
+	e.audioFrame.format = C.int(ctx.sample_fmt)
+	e.audioFrame.sample_rate = ctx.sample_rate
+	C.av_channel_layout_copy(&e.audioFrame.ch_layout, &ctx.ch_layout)
+	if C.av_frame_get_buffer(e.audioFrame, 0) < 0 {
+		return fmt.Errorf("could not allocate audio frame data")
+	}
+
+	return nil
+}
+
+// writeAudio converts interleaved stereo samples into the encoder's format and
+// encodes every complete frame that becomes available.
+func (e *FFmpegEncoder) writeAudio(samples []float32) {
+	inFrames := len(samples) / 2
+	if inFrames > 0 {
+		e.convertToFifo((*C.float)(unsafe.Pointer(&samples[0])), inFrames)
+	}
+	for int(C.av_audio_fifo_size(e.audioFifo)) >= e.audioFrameSize {
+		e.encodeAudioFrame(e.audioFrameSize)
+	}
+}
+
+// flushAudio drains the resampler and encodes the remaining partial frame, if the
+// encoder accepts one.
+func (e *FFmpegEncoder) flushAudio() {
+	e.convertToFifo(nil, 0)
+	for int(C.av_audio_fifo_size(e.audioFifo)) >= e.audioFrameSize {
+		e.encodeAudioFrame(e.audioFrameSize)
+	}
+	remaining := int(C.av_audio_fifo_size(e.audioFifo))
+	caps := e.audioCodecCtx.codec.capabilities
+	if remaining > 0 && caps&(C.AV_CODEC_CAP_SMALL_LAST_FRAME|C.AV_CODEC_CAP_VARIABLE_FRAME_SIZE) != 0 {
+		e.encodeAudioFrame(remaining)
+	}
+}
+
+// convertToFifo resamples inFrames interleaved stereo frames (nil flushes the
+// resampler) and appends the result to the FIFO.
+func (e *FFmpegEncoder) convertToFifo(in *C.float, inFrames int) {
+	maxOut := C.swr_get_out_samples(e.audioSwr, C.int(inFrames))
+	if maxOut <= 0 {
+		return
+	}
+	var outData **C.uint8_t
+	if C.av_samples_alloc_array_and_samples(&outData, nil, e.audioCodecCtx.ch_layout.nb_channels, maxOut, e.audioCodecCtx.sample_fmt, 0) < 0 {
+		e.fail(fmt.Errorf("could not allocate audio conversion buffer"))
+		return
+	}
+	defer func() {
+		C.av_freep(unsafe.Pointer(outData))
+		C.av_freep(unsafe.Pointer(&outData))
+	}()
+
+	n := C.convert_interleaved(e.audioSwr, outData, maxOut, in, C.int(inFrames))
+	if n < 0 {
+		e.fail(fmt.Errorf("audio conversion failed: %d", int(n)))
+		return
+	}
+	if n > 0 {
+		C.av_audio_fifo_write(e.audioFifo, (*unsafe.Pointer)(unsafe.Pointer(outData)), n)
+	}
+}
+
+// encodeAudioFrame reads n samples from the FIFO and encodes them.
+func (e *FFmpegEncoder) encodeAudioFrame(n int) {
+	if C.av_frame_make_writable(e.audioFrame) < 0 {
+		e.fail(fmt.Errorf("audio frame not writable"))
+		return
+	}
+	e.audioFrame.nb_samples = C.int(n)
+	C.av_audio_fifo_read(e.audioFifo, (*unsafe.Pointer)(unsafe.Pointer(&e.audioFrame.data[0])), C.int(n))
+	e.audioFrame.pts = C.int64_t(e.audioPTS)
+	e.audioPTS += int64(n)
+	e.encode(e.audioStream, e.audioCodecCtx, e.audioFrame)
+}
@@ -0,0 +1,146 @@
+package encoder
+
+/*
+#include <libavformat/avformat.h>
+#include <libavcodec/avcodec.h>
+#include <stdlib.h>
+
+// AV_NOPTS_VALUE is a macro cgo cannot evaluate.
+static int64_t nopts_value() {
+    return AV_NOPTS_VALUE;
+}
+*/
+import "C"
+import (
+	"fmt"
+	"log"
+	"math"
+	"unsafe"
+)
+
+// audioCopySource stream-copies the audio track of an input file into the output
+// container, so the original audio is muxed without being decoded and re-encoded.
+type audioCopySource struct {
+	formatCtx *C.AVFormatContext
+	inStream  *C.AVStream
+	outStream *C.AVStream
+	packet    *C.AVPacket
+	startPTS  int64 // First timestamp of the input track, subtracted so audio starts at zero
+	endPTS    int64 // Packets starting at or after this timestamp are trimmed
+	done      bool
+}
+
+// newAudioCopySource opens path and adds a stream-copy audio stream to the encoder's
+// output. The track is trimmed to duration seconds.
+func newAudioCopySource(e *FFmpegEncoder, path string, duration float64) (*audioCopySource, error) {
+	s := &audioCopySource{}
+
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	if C.avformat_open_input(&s.formatCtx, cPath, nil, nil) != 0 {
+		return nil, fmt.Errorf("failed to open audio copy input: %s", path)
+	}
+	if C.avformat_find_stream_info(s.formatCtx, nil) < 0 {
+		s.close()
+		return nil, fmt.Errorf("failed to find stream info for %s", path)
+	}
+
+	index := C.av_find_best_stream(s.formatCtx, C.AVMEDIA_TYPE_AUDIO, -1, -1, nil, 0)
+	if index < 0 {
+		s.close()
+		return nil, fmt.Errorf("no audio stream in %s", path)
+	}
+	s.inStream = *(**C.AVStream)(unsafe.Pointer(uintptr(unsafe.Pointer(s.formatCtx.streams)) + uintptr(index)*unsafe.Sizeof(*s.formatCtx.streams)))
+
+	if C.avformat_query_codec(e.formatCtx.oformat, s.inStream.codecpar.codec_id, C.FF_COMPLIANCE_NORMAL) != 1 {
+		s.close()
+		return nil, fmt.Errorf("the output container cannot hold the input's %s audio without re-encoding",
+			C.GoString(C.avcodec_get_name(s.inStream.codecpar.codec_id)))
+	}
+
+	s.outStream = C.avformat_new_stream(e.formatCtx, nil)
+	if s.outStream == nil {
+		s.close()
+		return nil, fmt.Errorf("could not create audio copy stream")
+	}
+	if C.avcodec_parameters_copy(s.outStream.codecpar, s.inStream.codecpar) < 0 {
+		s.close()
+		return nil, fmt.Errorf("could not copy audio codec parameters")
+	}
+	s.outStream.codecpar.codec_tag = 0
+	s.outStream.time_base = s.inStream.time_base
+
+	s.startPTS = 0
+	if int64(s.inStream.start_time) != int64(C.nopts_value()) {
+		s.startPTS = int64(s.inStream.start_time)
+	}
+	durationTB := C.av_rescale_q(C.int64_t(duration*C.AV_TIME_BASE), C.AVRational{num: 1, den: C.AV_TIME_BASE}, s.inStream.time_base)
+	s.endPTS = s.startPTS + int64(durationTB)
+
+	s.packet = C.av_packet_alloc()
+	log.Printf("Stream-copying %s audio from %s.", C.GoString(C.avcodec_get_name(s.inStream.codecpar.codec_id)), path)
+	return s, nil
+}
+
+// copyUntil writes input packets to the output until the copied audio reaches
+// the given time in seconds or the trim point.
+func (s *audioCopySource) copyUntil(e *FFmpegEncoder, seconds float64) {
+	limit := int64(math.MaxInt64)
+	if !math.IsInf(seconds, 1) {
+		limit = s.startPTS + int64(C.av_rescale_q(C.int64_t(seconds*C.AV_TIME_BASE), C.AVRational{num: 1, den: C.AV_TIME_BASE}, s.inStream.time_base))
+	}
+
+	for !s.done {
+		if C.av_read_frame(s.formatCtx, s.packet) < 0 {
+			s.done = true
+			return
+		}
+		if s.packet.stream_index != s.inStream.index {
+			C.av_packet_unref(s.packet)
+			continue
+		}
+
+		pts := int64(s.packet.pts)
+		if pts == int64(C.nopts_value()) {
+			pts = int64(s.packet.dts)
+		}
+		if pts >= s.endPTS {
+			C.av_packet_unref(s.packet)
+			s.done = true
+			return
+		}
+
+		// Rebase so the track starts at zero, like the rendered video.
+		if s.packet.pts != C.nopts_value() {
+			s.packet.pts -= C.int64_t(s.startPTS)
+		}
+		if s.packet.dts != C.nopts_value() {
+			s.packet.dts -= C.int64_t(s.startPTS)
+		}
+		C.av_packet_rescale_ts(s.packet, s.inStream.time_base, s.outStream.time_base)
+		s.packet.stream_index = s.outStream.index
+		s.packet.pos = -1
+
+		size := int64(s.packet.size)
+		if ret := C.av_interleaved_write_frame(e.formatCtx, s.packet); ret < 0 {
+			C.av_packet_unref(s.packet)
+			e.fail(fmt.Errorf("error writing copied audio packet: %d", int(ret)))
+			return
+		}
+		e.stats.bytesWritten.Add(size)
+		C.av_packet_unref(s.packet)
+
+		if pts >= limit {
+			return
+		}
+	}
+}
+
+func (s *audioCopySource) close() {
+	if s.packet != nil {
+		C.av_packet_free(&s.packet)
+	}
+	if s.formatCtx != nil {
+		C.avformat_close_input(&s.formatCtx)
+	}
+}
@@ -0,0 +1,128 @@
+package encoder
+
+/*
+#include <errno.h>
+#include <libavformat/avformat.h>
+#include <libavutil/dict.h>
+#include <libavutil/mem.h>
+#include <stdlib.h>
+
+// add_chapter appends a titled chapter to the output. FFmpeg's own helper
+// for this is private to libavformat.
+static int add_chapter(AVFormatContext *s, int id, AVRational time_base, int64_t start, int64_t end, const char *title) {
+    AVChapter *ch = av_mallocz(sizeof(AVChapter));
+    if (!ch) {
+        return AVERROR(ENOMEM);
+    }
+    ch->id = id;
+    ch->time_base = time_base;
+    ch->start = start;
+    ch->end = end;
+    av_dict_set(&ch->metadata, "title", title, 0);
+    int ret = av_dynarray_add_nofree(&s->chapters, &s->nb_chapters, ch);
+    if (ret < 0) {
+        av_dict_free(&ch->metadata);
+        av_free(ch);
+    }
+    return ret;
+}
+*/
+import "C"
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+// chapter is a scene of the output, starting at a video frame.
+type chapter struct {
+	frame int64
+	title string
+}
+
+// AddChapter starts a chapter titled title at video frame PTS frame. The
+// renderer adds one whenever the scene changes, so viewers can jump between
+// the shaders of a recorded playlist.
+func (e *FFmpegEncoder) AddChapter(frame int64, title string) {
+	e.chapterMu.Lock()
+	e.chapters = append(e.chapters, chapter{frame: frame, title: title})
+	e.chapterMu.Unlock()
+}
+
+// chapterEnds returns the chapters with the frame each ends at: where the
+// next one starts, or after the last frame encoded.
+func (e *FFmpegEncoder) chapterEnds() ([]chapter, []int64) {
+	e.chapterMu.Lock()
+	chapters := append([]chapter(nil), e.chapters...)
+	e.chapterMu.Unlock()
+	ends := make([]int64, len(chapters))
+	for i := range chapters {
+		ends[i] = e.endPTS
+		if i+1 < len(chapters) {
+			ends[i] = chapters[i+1].frame
+		}
+	}
+	return chapters, ends
+}
+
+// writeChapters adds the chapters to the output before its trailer is
+// written; MP4, MOV and Matroska store them in their index. A recording of a
+// single scene has none.
+func (e *FFmpegEncoder) writeChapters() {
+	chapters, ends := e.chapterEnds()
+	if len(chapters) < 2 {
+		return
+	}
+	timeBase := C.AVRational{num: 1, den: C.int(*e.opts.FPS)}
+	for i, ch := range chapters {
+		if ends[i] <= ch.frame {
+			continue
+		}
+		cTitle := C.CString(ch.title)
+		ret := C.add_chapter(e.formatCtx, C.int(i), timeBase, C.int64_t(ch.frame), C.int64_t(ends[i]), cTitle)
+		C.free(unsafe.Pointer(cTitle))
+		if ret < 0 {
+			log.Printf("Warning: could not add chapter '%s' to %s: error %d", ch.title, *e.opts.OutputFile, int(ret))
+			return
+		}
+	}
+}
+
+// writeSubtitleSidecar writes the chapter titles as SubRip subtitles next to
+// a file output, named like it with an .srt extension so players load them.
+// Network and segmented outputs have no sidecar.
+func (e *FFmpegEncoder) writeSubtitleSidecar(formatName string) {
+	out := *e.opts.OutputFile
+	if strings.Contains(out, "://") || isSegmentFormat(formatName) {
+		return
+	}
+	chapters, ends := e.chapterEnds()
+	var b strings.Builder
+	n := 0
+	for i, ch := range chapters {
+		if ends[i] <= ch.frame {
+			continue
+		}
+		n++
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", n, srtTime(ch.frame, e.opts), srtTime(ends[i], e.opts), ch.title)
+	}
+	if n == 0 {
+		return
+	}
+	path := strings.TrimSuffix(out, filepath.Ext(out)) + ".srt"
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		log.Printf("Warning: could not write subtitles %s: %v", path, err)
+	}
+}
+
+// srtTime formats the start of a video frame as a SubRip timestamp.
+func srtTime(frame int64, opts *options.ShaderOptions) string {
+	d := time.Duration(frame) * time.Second / time.Duration(*opts.FPS)
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, d.Milliseconds()%1000)
+}
@@ -0,0 +1,126 @@
+package encoder
+
+/*
+#include <libavformat/avformat.h>
+#include <libavutil/dict.h>
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+)
+
+// ConcatSegments joins segment files with identical stream layouts into output
+// without re-encoding, using FFmpeg's concat demuxer. formatName selects the
+// output container; empty guesses it from the output name.
+func ConcatSegments(segments []string, output, formatName string) error {
+	if len(segments) == 0 {
+		return fmt.Errorf("no segments to concatenate")
+	}
+
+	// The concat demuxer reads its inputs from a list file.
+	var list strings.Builder
+	list.WriteString("ffconcat version 1.0\n")
+	for _, seg := range segments {
+		abs, err := filepath.Abs(seg)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(abs, "'", `'\''`))
+	}
+	listFile, err := os.CreateTemp("", "goshadertoy-concat-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(listFile.Name())
+	if _, err := listFile.WriteString(list.String()); err != nil {
+		listFile.Close()
+		return err
+	}
+	listFile.Close()
+
+	cConcat := C.CString("concat")
+	defer C.free(unsafe.Pointer(cConcat))
+	cList := C.CString(listFile.Name())
+	defer C.free(unsafe.Pointer(cList))
+	cSafe := C.CString("safe")
+	defer C.free(unsafe.Pointer(cSafe))
+	cZero := C.CString("0")
+	defer C.free(unsafe.Pointer(cZero))
+
+	var demuxOpts *C.AVDictionary
+	C.av_dict_set(&demuxOpts, cSafe, cZero, 0)
+	defer C.av_dict_free(&demuxOpts)
+
+	var inCtx *C.AVFormatContext
+	if C.avformat_open_input(&inCtx, cList, C.av_find_input_format(cConcat), &demuxOpts) != 0 {
+		return fmt.Errorf("failed to open segment list")
+	}
+	defer C.avformat_close_input(&inCtx)
+	if C.avformat_find_stream_info(inCtx, nil) < 0 {
+		return fmt.Errorf("failed to read segment stream info")
+	}
+
+	cOutput := C.CString(output)
+	defer C.free(unsafe.Pointer(cOutput))
+	var cFormat *C.char
+	if formatName != "" {
+		cFormat = C.CString(formatName)
+		defer C.free(unsafe.Pointer(cFormat))
+	}
+	var outCtx *C.AVFormatContext
+	if C.avformat_alloc_output_context2(&outCtx, nil, cFormat, cOutput) < 0 || outCtx == nil {
+		return fmt.Errorf("could not create output context for %s", output)
+	}
+	defer C.avformat_free_context(outCtx)
+
+	inStreams := unsafe.Slice(inCtx.streams, inCtx.nb_streams)
+	outStreams := make([]*C.AVStream, len(inStreams))
+	for i, in := range inStreams {
+		out := C.avformat_new_stream(outCtx, nil)
+		if out == nil {
+			return fmt.Errorf("could not create output stream")
+		}
+		if C.avcodec_parameters_copy(out.codecpar, in.codecpar) < 0 {
+			return fmt.Errorf("could not copy codec parameters")
+		}
+		out.codecpar.codec_tag = 0
+		out.time_base = in.time_base
+		outStreams[i] = out
+	}
+
+	if outCtx.oformat.flags&C.AVFMT_NOFILE == 0 {
+		if C.avio_open(&outCtx.pb, cOutput, C.AVIO_FLAG_WRITE) < 0 {
+			return fmt.Errorf("could not open output file %s", output)
+		}
+		defer C.avio_closep(&outCtx.pb)
+	}
+	if C.avformat_write_header(outCtx, nil) < 0 {
+		return fmt.Errorf("could not write header to %s", output)
+	}
+
+	pkt := C.av_packet_alloc()
+	defer C.av_packet_free(&pkt)
+	for C.av_read_frame(inCtx, pkt) >= 0 {
+		idx := int(pkt.stream_index)
+		if idx >= len(outStreams) {
+			C.av_packet_unref(pkt)
+			continue
+		}
+		C.av_packet_rescale_ts(pkt, inStreams[idx].time_base, outStreams[idx].time_base)
+		pkt.pos = -1
+		if C.av_interleaved_write_frame(outCtx, pkt) < 0 {
+			C.av_packet_unref(pkt)
+			return fmt.Errorf("error writing concatenated packet")
+		}
+	}
+
+	if C.av_write_trailer(outCtx) < 0 {
+		return fmt.Errorf("could not write trailer to %s", output)
+	}
+	return nil
+}
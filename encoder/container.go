@@ -0,0 +1,88 @@
+package encoder
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+// containerInfo describes an output container: its FFmpeg muxer and the codecs
+// it can hold, the default first.
+type containerInfo struct {
+	muxer       string
+	videoCodecs []string
+	audioCodecs []string
+}
+
+// Containers are the -container values.
+var Containers = map[string]containerInfo{
+	"mp4":  {muxer: "mp4", videoCodecs: []string{"h264", "hevc", "av1"}, audioCodecs: []string{"aac", "opus", "flac"}},
+	"mkv":  {muxer: "matroska", videoCodecs: []string{"h264", "hevc", "av1"}, audioCodecs: []string{"aac", "opus", "flac", "pcm_s24le"}},
+	"webm": {muxer: "webm", videoCodecs: []string{"av1"}, audioCodecs: []string{"opus"}},
+	"mov":  {muxer: "mov", videoCodecs: []string{"h264", "hevc"}, audioCodecs: []string{"pcm_s24le", "aac"}},
+}
+
+// containerExtensions maps output file extensions to containers.
+var containerExtensions = map[string]string{
+	".mp4":  "mp4",
+	".m4v":  "mp4",
+	".mkv":  "mkv",
+	".webm": "webm",
+	".mov":  "mov",
+}
+
+// containerName returns the container of an output: the -container value, the
+// container whose muxer -format names, or the one the file extension implies.
+// It is empty for other outputs, such as streams, which aren't checked.
+func containerName(opts *options.ShaderOptions) string {
+	if opts.Container != nil && *opts.Container != "" {
+		return *opts.Container
+	}
+	if *opts.OutputFormat != "" {
+		for name, c := range Containers {
+			if c.muxer == *opts.OutputFormat {
+				return name
+			}
+		}
+		return ""
+	}
+	if *opts.Mode == "stream" {
+		return ""
+	}
+	return containerExtensions[strings.ToLower(filepath.Ext(*opts.OutputFile))]
+}
+
+// ResolveContainer checks that the video and audio codecs of an output fit its
+// container and picks the container's default video codec if none was chosen.
+func ResolveContainer(opts *options.ShaderOptions) error {
+	if opts.Container != nil && *opts.Container != "" {
+		if _, ok := Containers[*opts.Container]; !ok {
+			return fmt.Errorf("unsupported container '%s' (valid: mkv, mov, mp4, webm)", *opts.Container)
+		}
+		if *opts.OutputFormat != "" {
+			return fmt.Errorf("-container and -format both choose the container; use one")
+		}
+	}
+	name := containerName(opts)
+	c, known := Containers[name]
+	if *opts.Codec == "" {
+		codec := "h264"
+		if known {
+			codec = c.videoCodecs[0]
+		}
+		opts.Codec = &codec
+	}
+	if !known {
+		return nil
+	}
+	if !slices.Contains(c.videoCodecs, *opts.Codec) {
+		return fmt.Errorf("%s outputs can't hold %s video (supported: %s)", name, *opts.Codec, strings.Join(c.videoCodecs, ", "))
+	}
+	if *opts.AudioCodec != "" && !slices.Contains(c.audioCodecs, *opts.AudioCodec) {
+		return fmt.Errorf("%s outputs can't hold %s audio (supported: %s)", name, *opts.AudioCodec, strings.Join(c.audioCodecs, ", "))
+	}
+	return nil
+}
@@ -1,13 +1,13 @@
 package encoder
 
 /*
-#cgo CFLAGS: -I${SRCDIR}/../release/include/arcana
-
 #include <libavformat/avformat.h>
 #include <libavcodec/avcodec.h>
 #include <libavutil/opt.h>
 #include <libavutil/imgutils.h>
 #include <libswscale/swscale.h>
+#include <libswresample/swresample.h>
+#include <libavutil/audio_fifo.h>
 #include <stdlib.h>
 
 // av_err2str is a macro, so we need a wrapper function
@@ -26,42 +26,53 @@ import "C"
 import (
 	"fmt"
 	"log"
+	"math"
 	"runtime"
+	"strings"
 	"sync"
 	"unsafe"
 
 	options "github.com/richinsley/goshadertoy/options"
+	sink "github.com/richinsley/goshadertoy/sink"
 )
 
-// Frame represents a single rendered video frame's data, ready for encoding.
-type Frame struct {
-	Pixels []byte
-	PTS    int64
-}
-
 // FFmpegEncoder handles the in-process video and audio encoding using FFmpeg libraries.
 type FFmpegEncoder struct {
-	formatCtx            *C.AVFormatContext
-	videoCodecCtx        *C.AVCodecContext
-	audioCodecCtx        *C.AVCodecContext
-	videoStream          *C.AVStream
-	audioStream          *C.AVStream
-	swsCtx               *C.struct_SwsContext
-	videoFrame           *C.AVFrame
-	audioFrame           *C.AVFrame
-	videoFrameBuffer     unsafe.Pointer // Reusable buffer for video frames
-	videoFrameBufferSize int            // Size of the reusable buffer
+	formatCtx      *C.AVFormatContext
+	videoCodecCtx  *C.AVCodecContext
+	audioCodecCtx  *C.AVCodecContext
+	videoStream    *C.AVStream
+	audioStream    *C.AVStream
+	swsCtx         *C.struct_SwsContext
+	filter         *videoFilter // Set when the video runs through a filter graph
+	videoFrame     *C.AVFrame   // Filter input with a filter graph, else encoder input
+	audioFrame     *C.AVFrame
+	audioSwr       *C.SwrContext  // Converts renderer audio to the encoder's format
+	audioFifo      *C.AVAudioFifo // Collects converted audio into encoder-sized frames
+	audioFrameSize int
+	audioPTS       int64
+	audioCopy      *audioCopySource // Set when the input file's audio is stream-copied
 
 	opts        *options.ShaderOptions
-	videoFrames chan *Frame
+	queue       *videoQueue      // Frames sent but not yet taken by Run
+	videoFrames chan *sink.Frame // Hands frames from the queue to Run
 	audioFrames chan []float32
 	done        chan error
 	audioMutex  sync.Mutex
+	stats       encoderStats
+
+	failOnce sync.Once
+	failed   chan struct{} // Closed when an FFmpeg call fails and output stops
+	failErr  error
+
+	chapterMu sync.Mutex
+	chapters  []chapter // Scenes of the output, in order
+	endPTS    int64     // PTS after the last video frame encoded
 }
 
-// findBestVideoEncoder attempts to find a suitable video encoder by checking a prioritized list.
-// It prefers hardware encoders specific to the platform and falls back to software encoders.
-func findBestVideoEncoder(codecPref string) (*C.AVCodec, string) {
+// videoEncoderNames returns the FFmpeg encoders for a -codec value, in order
+// of preference: the platform's hardware encoders, then software.
+func videoEncoderNames(codecPref string) []string {
 	var encoderNames []string
 
 	switch codecPref {
@@ -77,6 +88,15 @@ func findBestVideoEncoder(codecPref string) (*C.AVCodec, string) {
 		default:
 			encoderNames = []string{"libx265"}
 		}
+	case "av1":
+		switch runtime.GOOS {
+		case "linux":
+			encoderNames = []string{"av1_nvenc", "libaom-av1"}
+		case "windows":
+			encoderNames = []string{"av1_nvenc", "av1_amf", "av1_qsv", "libaom-av1"}
+		default:
+			encoderNames = []string{"libaom-av1"}
+		}
 	default: // Default to h264
 		switch runtime.GOOS {
 		case "linux":
@@ -89,8 +109,13 @@ func findBestVideoEncoder(codecPref string) (*C.AVCodec, string) {
 			encoderNames = []string{"libx264"}
 		}
 	}
+	return encoderNames
+}
 
-	for _, name := range encoderNames {
+// findBestVideoEncoder attempts to find a suitable video encoder by checking a prioritized list.
+// It prefers hardware encoders specific to the platform and falls back to software encoders.
+func findBestVideoEncoder(codecPref string) (*C.AVCodec, string) {
+	for _, name := range videoEncoderNames(codecPref) {
 		cName := C.CString(name)
 		codec := C.avcodec_find_encoder_by_name(cName)
 		C.free(unsafe.Pointer(cName))
@@ -103,7 +128,42 @@ func findBestVideoEncoder(codecPref string) (*C.AVCodec, string) {
 	return nil, ""
 }
 
-func getFFmpegPixFmt(bitDepth int) C.enum_AVPixelFormat {
+// outputFormatName picks the container for an output. An explicit format or
+// container wins; network URLs get a streaming container; otherwise FFmpeg
+// guesses from the name.
+func outputFormatName(opts *options.ShaderOptions) string {
+	if *opts.OutputFormat != "" {
+		return *opts.OutputFormat
+	}
+	if opts.Container != nil {
+		if c, ok := Containers[*opts.Container]; ok {
+			return c.muxer
+		}
+	}
+	url := strings.ToLower(*opts.OutputFile)
+	switch {
+	case strings.HasPrefix(url, "rtmp://"), strings.HasPrefix(url, "rtmps://"):
+		return "flv"
+	case strings.HasPrefix(url, "srt://"), strings.HasPrefix(url, "udp://"), strings.HasPrefix(url, "tcp://"):
+		return "mpegts"
+	case strings.HasSuffix(url, ".m3u8"):
+		return "hls"
+	case strings.HasSuffix(url, ".mpd"):
+		return "dash"
+	case *opts.Mode == "stream":
+		return "mpegts"
+	default:
+		return ""
+	}
+}
+
+func getFFmpegPixFmt(bitDepth int, codecName string) C.enum_AVPixelFormat {
+	if codecName == "libaom-av1" { // libaom only takes planar input
+		if bitDepth > 8 {
+			return C.AV_PIX_FMT_YUV420P10LE
+		}
+		return C.AV_PIX_FMT_YUV420P
+	}
 	switch bitDepth {
 	case 10, 12:
 		return C.AV_PIX_FMT_P010LE
@@ -113,17 +173,23 @@ func getFFmpegPixFmt(bitDepth int) C.enum_AVPixelFormat {
 }
 
 func NewFFmpegEncoder(opts *options.ShaderOptions) (*FFmpegEncoder, error) {
+	policy, err := queuePolicy(opts)
+	if err != nil {
+		return nil, err
+	}
 	e := &FFmpegEncoder{
 		opts:        opts,
-		videoFrames: make(chan *Frame, 5),
+		queue:       newVideoQueue(*opts.EncodeQueue, policy),
+		videoFrames: make(chan *sink.Frame),
 		done:        make(chan error, 1),
+		failed:      make(chan struct{}),
 	}
 
 	cFilename := C.CString(*opts.OutputFile)
 	defer C.free(unsafe.Pointer(cFilename))
 
-	if *opts.Mode == "stream" {
-		cFormatName := C.CString("mpegts")
+	if formatName := outputFormatName(opts); formatName != "" {
+		cFormatName := C.CString(formatName)
 		defer C.free(unsafe.Pointer(cFormatName))
 		if C.avformat_alloc_output_context2(&e.formatCtx, nil, cFormatName, cFilename) < 0 {
 			return nil, fmt.Errorf("could not allocate output context")
@@ -138,7 +204,7 @@ func NewFFmpegEncoder(opts *options.ShaderOptions) (*FFmpegEncoder, error) {
 	// Find and add video stream
 	videoCodec, videoCodecName := findBestVideoEncoder(*opts.Codec)
 	if videoCodec == nil {
-		return nil, fmt.Errorf("could not find a suitable video encoder for '%s'", *opts.Codec)
+		return nil, fmt.Errorf("could not find a suitable video encoder for '%s' in this FFmpeg build (see -list-encoders)", *opts.Codec)
 	}
 	if err := e.addStream(&e.videoStream, &e.videoCodecCtx, videoCodec); err != nil {
 		return nil, fmt.Errorf("failed to add video stream: %w", err)
@@ -147,12 +213,22 @@ func NewFFmpegEncoder(opts *options.ShaderOptions) (*FFmpegEncoder, error) {
 	// Find and add audio stream (if applicable)
 	var audioCodec *C.AVCodec
 	hasAudio := *opts.AudioInputFile != "" || *opts.AudioInputDevice != "" || opts.HasSoundShader
+	if hasAudio && *opts.AudioCopy && *opts.AudioInputFile != "" {
+		// The audio track is muxed straight from the file; rendered audio is only visualized.
+		audioCopy, err := newAudioCopySource(e, *opts.AudioInputFile, *opts.Duration)
+		if err != nil {
+			return nil, err
+		}
+		e.audioCopy = audioCopy
+		hasAudio = false
+	} else if *opts.AudioCopy {
+		log.Println("Warning: -audio-copy needs an audio file input; encoding audio instead.")
+	}
 	if hasAudio {
-		cAACName := C.CString("aac")
-		audioCodec = C.avcodec_find_encoder_by_name(cAACName)
-		C.free(unsafe.Pointer(cAACName))
-		if audioCodec == nil {
-			return nil, fmt.Errorf("could not find 'aac' audio encoder")
+		var err error
+		audioCodec, err = findAudioEncoder(opts)
+		if err != nil {
+			return nil, err
 		}
 		if err := e.addStream(&e.audioStream, &e.audioCodecCtx, audioCodec); err != nil {
 			return nil, fmt.Errorf("failed to add audio stream: %w", err)
@@ -167,20 +243,8 @@ func NewFFmpegEncoder(opts *options.ShaderOptions) (*FFmpegEncoder, error) {
 	if err := e.openVideo(videoCodec, videoCodecName, opts); err != nil {
 		return nil, err
 	}
-
-	// Allocate the reusable C buffer for video frames
-	width := int(*opts.Width)
-	height := int(*opts.Height)
-	bytesPerPixel := 1
-	if *opts.BitDepth > 8 {
-		bytesPerPixel = 2
-	}
-	// The input format is YUV planar, so we need space for 3 planes.
-	e.videoFrameBufferSize = width * height * bytesPerPixel * 3
-	e.videoFrameBuffer = C.malloc(C.size_t(e.videoFrameBufferSize))
-	if e.videoFrameBuffer == nil {
-		e.cleanup() // Ensure other resources are freed on failure
-		return nil, fmt.Errorf("could not allocate reusable video frame buffer")
+	if err := e.addProjectionMetadata(opts); err != nil {
+		return nil, err
 	}
 
 	if hasAudio {
@@ -196,8 +260,13 @@ func NewFFmpegEncoder(opts *options.ShaderOptions) (*FFmpegEncoder, error) {
 		}
 	}
 
-	if C.avformat_write_header(e.formatCtx, nil) < 0 {
-		return nil, fmt.Errorf("could not write header")
+	e.addMetadata(opts)
+	formatName := C.GoString(e.formatCtx.oformat.name)
+	if err := e.writeHeader(formatName); err != nil {
+		return nil, err
+	}
+	if *opts.MetadataSidecar {
+		writeMetadataSidecar(opts, formatName)
 	}
 
 	return e, nil
@@ -228,7 +297,26 @@ func (e *FFmpegEncoder) openVideo(codec *C.AVCodec, codecName string, opts *opti
 	ctx.time_base = C.AVRational{num: 1, den: C.int(*opts.FPS)}
 	ctx.framerate = C.AVRational{num: C.int(*opts.FPS), den: 1}
 	ctx.gop_size = 12
-	ctx.pix_fmt = getFFmpegPixFmt(*opts.BitDepth)
+	if isSegmentFormat(C.GoString(e.formatCtx.oformat.name)) {
+		// Segments can only start on a keyframe, so place one at every segment boundary.
+		ctx.gop_size = C.int(max(1, math.Round(*opts.SegmentTime*float64(*opts.FPS))))
+	}
+	ctx.pix_fmt = getFFmpegPixFmt(*opts.BitDepth, codecName)
+
+	// The input format from the renderer is YUV Planar (3 separate planes)
+	inPixFmt := C.enum_AVPixelFormat(C.AV_PIX_FMT_YUV444P)
+	if *opts.BitDepth > 8 {
+		inPixFmt = C.AV_PIX_FMT_YUV444P10LE
+	}
+
+	if *opts.VideoFilter != "" {
+		filter, err := newVideoFilter(*opts.VideoFilter, *opts.Width, *opts.Height, inPixFmt, *opts.FPS, ctx.pix_fmt)
+		if err != nil {
+			return err
+		}
+		e.filter = filter
+		ctx.width, ctx.height = filter.size()
+	}
 
 	// Disable B-frames to prevent frame reordering, which simplifies timestamp handling
 	// for real-time encoding.
@@ -242,35 +330,54 @@ func (e *FFmpegEncoder) openVideo(codec *C.AVCodec, codecName string, opts *opti
 		C.av_opt_set(ctx.priv_data, C.CString("tune"), C.CString("zerolatency"), 0)
 	case "libx265":
 		C.av_opt_set(ctx.priv_data, C.CString("preset"), C.CString("slow"), 0)
-	case "h264_nvenc", "hevc_nvenc":
+	case "libaom-av1":
+		// The default cpu-used of 1 is far too slow to record with.
+		C.av_opt_set(ctx.priv_data, C.CString("cpu-used"), C.CString("6"), 0)
+	case "h264_nvenc", "hevc_nvenc", "av1_nvenc":
 		C.av_opt_set(ctx.priv_data, C.CString("preset"), C.CString("p2"), 0)
 	}
 
+	var codecOpts *C.AVDictionary
+	defer C.av_dict_free(&codecOpts)
+	for key, value := range parallelCodecOptions(codecName, opts) {
+		cKey := C.CString(key)
+		cValue := C.CString(value)
+		C.av_dict_set(&codecOpts, cKey, cValue, 0)
+		C.free(unsafe.Pointer(cKey))
+		C.free(unsafe.Pointer(cValue))
+	}
+
 	if (e.formatCtx.oformat.flags & C.AVFMT_GLOBALHEADER) != 0 {
 		ctx.flags |= C.AV_CODEC_FLAG_GLOBAL_HEADER
 	}
 
-	if C.avcodec_open2(ctx, codec, nil) < 0 {
+	if C.avcodec_open2(ctx, codec, &codecOpts) < 0 {
 		return fmt.Errorf("could not open video codec")
 	}
+	if C.av_dict_count(codecOpts) > 0 {
+		log.Printf("Warning: %s ignored %d of its threading options", codecName, C.av_dict_count(codecOpts))
+	}
 
 	if C.avcodec_parameters_from_context(e.videoStream.codecpar, ctx) < 0 {
 		return fmt.Errorf("could not copy video codec parameters to stream")
 	}
 
-	// Initialize the video frame and SWS context for pixel format conversion
+	// Initialize the video frame and SWS context for pixel format conversion.
+	// The filter graph converts the renderer's frames itself.
 	e.videoFrame = C.av_frame_alloc()
 	e.videoFrame.format = C.int(ctx.pix_fmt)
 	e.videoFrame.width = ctx.width
 	e.videoFrame.height = ctx.height
+	if e.filter != nil {
+		e.videoFrame.format = C.int(inPixFmt)
+		e.videoFrame.width = C.int(*opts.Width)
+		e.videoFrame.height = C.int(*opts.Height)
+	}
 	if C.av_frame_get_buffer(e.videoFrame, 0) < 0 {
 		return fmt.Errorf("could not allocate video frame data")
 	}
-
-	// The input format from the renderer is YUV Planar (3 separate planes)
-	inPixFmt := C.AV_PIX_FMT_YUV444P
-	if *opts.BitDepth > 8 {
-		inPixFmt = C.AV_PIX_FMT_YUV444P10LE
+	if e.filter != nil {
+		return nil
 	}
 
 	e.swsCtx = C.sws_getContext(ctx.width, ctx.height, int32(inPixFmt),
@@ -282,59 +389,38 @@ func (e *FFmpegEncoder) openVideo(codec *C.AVCodec, codecName string, opts *opti
 	return nil
 }
 
-func (e *FFmpegEncoder) openAudio(codec *C.AVCodec, opts *options.ShaderOptions) error {
-	ctx := e.audioCodecCtx
-	ctx.sample_fmt = C.AV_SAMPLE_FMT_FLTP // Planar float for AAC
-	ctx.bit_rate = 192000
-	ctx.sample_rate = 44100
-	C.av_channel_layout_from_string(&ctx.ch_layout, C.CString("stereo"))
-
-	if (e.formatCtx.oformat.flags & C.AVFMT_GLOBALHEADER) != 0 {
-		ctx.flags |= C.AV_CODEC_FLAG_GLOBAL_HEADER
-	}
-
-	if C.avcodec_open2(ctx, codec, nil) < 0 {
-		return fmt.Errorf("could not open audio codec")
-	}
-
-	if C.avcodec_parameters_from_context(e.audioStream.codecpar, ctx) < 0 {
-		return fmt.Errorf("could not copy audio codec parameters to stream")
-	}
-
-	// Initialize the audio frame
-	e.audioFrame = C.av_frame_alloc()
-	e.audioFrame.nb_samples = ctx.frame_size
-	e.audioFrame.format = C.int(ctx.sample_fmt)
-	C.av_channel_layout_copy(&e.audioFrame.ch_layout, &ctx.ch_layout)
-	if C.av_frame_get_buffer(e.audioFrame, 0) < 0 {
-		return fmt.Errorf("could not allocate audio frame data")
-	}
-
-	return nil
-}
-
+// Run encodes the frames and audio sent to the encoder until it is closed. It
+// runs on its own goroutine, so encoding only slows down rendering when the
+// queue is full under the block policy.
 func (e *FFmpegEncoder) Run() {
-	var audioPTS int64 = 0
-	internalAudioBuffer := make([]float32, 0, 4096)
-
+	go func() {
+		for {
+			frame, ok := e.queue.pop()
+			if !ok {
+				close(e.videoFrames)
+				return
+			}
+			e.videoFrames <- frame
+		}
+	}()
 	for {
 		select {
 		case frame, ok := <-e.videoFrames:
 			if !ok {
 				e.videoFrames = nil // Stop selecting on this channel
+			} else if e.Err() != nil {
+				frame.Release() // Keep draining so senders don't block
 			} else {
 				e.encodeVideo(frame)
+				if e.audioCopy != nil {
+					e.audioCopy.copyUntil(e, float64(frame.PTS+1)/float64(*e.opts.FPS))
+				}
 			}
 		case audioData, ok := <-e.audioFrames:
 			if !ok {
 				e.audioFrames = nil // Stop selecting on this channel
-			} else {
-				internalAudioBuffer = append(internalAudioBuffer, audioData...)
-				for len(internalAudioBuffer) >= int(e.audioCodecCtx.frame_size)*2 {
-					e.encodeAudio(internalAudioBuffer[:e.audioCodecCtx.frame_size*2], audioPTS)
-					internalAudioBuffer = internalAudioBuffer[e.audioCodecCtx.frame_size*2:]
-					audioPTS += int64(e.audioCodecCtx.frame_size)
-				}
+			} else if e.Err() == nil {
+				e.writeAudio(audioData)
 			}
 		}
 
@@ -344,20 +430,59 @@ func (e *FFmpegEncoder) Run() {
 	}
 
 	// Flush encoders
-	e.encode(e.videoStream, e.videoCodecCtx, nil)
-	if e.audioStream != nil {
-		e.encode(e.audioStream, e.audioCodecCtx, nil)
+	if e.Err() == nil && e.filter != nil {
+		e.filterVideo(nil)
+	}
+	if e.Err() == nil {
+		e.encode(e.videoStream, e.videoCodecCtx, nil)
+		if e.audioCopy != nil {
+			e.audioCopy.copyUntil(e, math.Inf(1))
+		}
+		if e.audioStream != nil {
+			e.flushAudio()
+			e.encode(e.audioStream, e.audioCodecCtx, nil)
+		}
 	}
 
-	// Write trailer and cleanup
-	C.av_write_trailer(e.formatCtx)
+	e.writeChapters()
+	if *e.opts.SceneSubtitles {
+		e.writeSubtitleSidecar(C.GoString(e.formatCtx.oformat.name))
+	}
+
+	// Write trailer and cleanup. After a failure the trailer still makes what
+	// was written so far playable, if the output can take it.
+	if ret := C.av_write_trailer(e.formatCtx); ret < 0 {
+		e.fail(fmt.Errorf("could not finish %s: %s", *e.opts.OutputFile, C.GoString(C.av_error_str(ret))))
+	}
 	e.cleanup()
-	e.done <- nil
+	e.done <- e.Err()
+}
+
+// fail records err as the reason the output stopped. Only the first failure
+// is kept; everything sent afterwards is discarded.
+func (e *FFmpegEncoder) fail(err error) {
+	e.failOnce.Do(func() {
+		log.Printf("Error: encoding to %s failed: %v", *e.opts.OutputFile, err)
+		e.failErr = err
+		close(e.failed)
+	})
 }
 
-func (e *FFmpegEncoder) encodeVideo(frameData *Frame) {
+// Err returns the error that stopped the encoder, or nil while it is working.
+func (e *FFmpegEncoder) Err() error {
+	select {
+	case <-e.failed:
+		return e.failErr
+	default:
+		return nil
+	}
+}
+
+func (e *FFmpegEncoder) encodeVideo(frameData *sink.Frame) {
+	defer frameData.Release()
 	if C.av_frame_make_writable(e.videoFrame) < 0 {
-		log.Println("Video frame not writable")
+		e.stats.droppedFrames.Add(1)
+		e.fail(fmt.Errorf("video frame not writable"))
 		return
 	}
 
@@ -368,21 +493,27 @@ func (e *FFmpegEncoder) encodeVideo(frameData *Frame) {
 		bytesPerPixel = 2
 	}
 	planeSize := width * height * bytesPerPixel
+	if e.filter != nil {
+		copyPlanes(e.videoFrame, frameData.Pixels, bytesPerPixel)
+		e.videoFrame.pts = C.int64_t(frameData.PTS)
+		e.endPTS = frameData.PTS + 1
+		e.filterVideo(e.videoFrame)
+		e.stats.videoFrames.Add(1)
+		return
+	}
 
-	// Copy Go pixel data into our pre-allocated C buffer.
-	// This is much faster than allocating new C memory on every frame.
-	C.memcpy(e.videoFrameBuffer, unsafe.Pointer(&frameData.Pixels[0]), C.size_t(len(frameData.Pixels)))
-
-	srcPlanes := (**C.uchar)(C.malloc(C.size_t(unsafe.Sizeof((*C.uchar)(nil)) * 4)))
-	defer C.free(unsafe.Pointer(srcPlanes))
-
-	srcPlanesSlice := (*[4]*C.uchar)(unsafe.Pointer(srcPlanes))
-
-	// Point the plane pointers to the appropriate locations in our stable C buffer.
-	srcPlanesSlice[0] = (*C.uchar)(e.videoFrameBuffer)
-	srcPlanesSlice[1] = (*C.uchar)(unsafe.Add(e.videoFrameBuffer, planeSize))
-	srcPlanesSlice[2] = (*C.uchar)(unsafe.Add(e.videoFrameBuffer, planeSize*2))
-	srcPlanesSlice[3] = nil
+	// sws_scale reads the planes straight from the frame. Pinning the pixels
+	// lets the plane pointer array passed to C hold pointers into them.
+	pixels := unsafe.Pointer(&frameData.Pixels[0])
+	var pinner runtime.Pinner
+	pinner.Pin(pixels)
+	defer pinner.Unpin()
+	srcPlanes := [4]*C.uchar{
+		(*C.uchar)(pixels),
+		(*C.uchar)(unsafe.Add(pixels, planeSize)),
+		(*C.uchar)(unsafe.Add(pixels, planeSize*2)),
+		nil,
+	}
 
 	srcStrides := [4]C.int{
 		C.int(width * bytesPerPixel),
@@ -391,30 +522,13 @@ func (e *FFmpegEncoder) encodeVideo(frameData *Frame) {
 		0,
 	}
 
-	C.sws_scale(e.swsCtx, srcPlanes, &srcStrides[0], 0, C.int(height),
+	C.sws_scale(e.swsCtx, &srcPlanes[0], &srcStrides[0], 0, C.int(height),
 		&e.videoFrame.data[0], &e.videoFrame.linesize[0])
 
 	e.videoFrame.pts = C.int64_t(frameData.PTS)
+	e.endPTS = frameData.PTS + 1
 	e.encode(e.videoStream, e.videoCodecCtx, e.videoFrame)
-}
-
-func (e *FFmpegEncoder) encodeAudio(samples []float32, pts int64) {
-	if C.av_frame_make_writable(e.audioFrame) < 0 {
-		log.Println("Audio frame not writable")
-		return
-	}
-
-	// Deinterleave stereo float32 into two planar float32 buffers
-	left := (*float32)(unsafe.Pointer(e.audioFrame.data[0]))
-	right := (*float32)(unsafe.Pointer(e.audioFrame.data[1]))
-
-	for i := 0; i < int(e.audioFrame.nb_samples); i++ {
-		*(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(left)) + uintptr(i*4))) = samples[i*2]
-		*(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(right)) + uintptr(i*4))) = samples[i*2+1]
-	}
-
-	e.audioFrame.pts = C.int64_t(pts)
-	e.encode(e.audioStream, e.audioCodecCtx, e.audioFrame)
+	e.stats.videoFrames.Add(1)
 }
 
 func (e *FFmpegEncoder) encode(st *C.AVStream, ctx *C.AVCodecContext, frame *C.AVFrame) {
@@ -423,8 +537,11 @@ func (e *FFmpegEncoder) encode(st *C.AVStream, ctx *C.AVCodecContext, frame *C.A
 
 	// Send the frame to the encoder.
 	// If frame is nil, this is a flush signal.
-	if C.avcodec_send_frame(ctx, frame) < 0 {
-		log.Println("Error sending frame to encoder")
+	if ret := C.avcodec_send_frame(ctx, frame); ret < 0 {
+		if frame != nil && st == e.videoStream {
+			e.stats.droppedFrames.Add(1)
+		}
+		e.fail(fmt.Errorf("error sending frame to the %s encoder: %s", C.GoString(ctx.codec.name), C.GoString(C.av_error_str(ret))))
 		return
 	}
 
@@ -442,7 +559,7 @@ func (e *FFmpegEncoder) encode(st *C.AVStream, ctx *C.AVCodecContext, frame *C.A
 			// The encoder has been fully flushed.
 			break
 		} else if ret < 0 {
-			log.Printf("Error during encoding: %s", C.GoString(C.av_error_str(ret)))
+			e.fail(fmt.Errorf("error during encoding: %s", C.GoString(C.av_error_str(ret))))
 			break // Stop on a real error.
 		}
 
@@ -450,9 +567,16 @@ func (e *FFmpegEncoder) encode(st *C.AVStream, ctx *C.AVCodecContext, frame *C.A
 		C.av_packet_rescale_ts(pkt, ctx.time_base, st.time_base)
 		pkt.stream_index = st.index
 
-		if C.av_interleaved_write_frame(e.formatCtx, pkt) < 0 {
-			log.Println("Error writing packet")
+		size := int64(pkt.size)
+		if ret := C.av_interleaved_write_frame(e.formatCtx, pkt); ret < 0 {
+			if st == e.videoStream {
+				e.stats.droppedFrames.Add(1)
+			}
+			e.fail(fmt.Errorf("error writing packet: %s", C.GoString(C.av_error_str(ret))))
+			C.av_packet_unref(pkt)
+			break
 		}
+		e.stats.bytesWritten.Add(size)
 		C.av_packet_unref(pkt)
 
 		// After flushing with a nil frame, we must continue calling
@@ -463,8 +587,14 @@ func (e *FFmpegEncoder) encode(st *C.AVStream, ctx *C.AVCodecContext, frame *C.A
 	}
 }
 
-func (e *FFmpegEncoder) SendVideo(frame *Frame) {
-	e.videoFrames <- frame
+// SendVideo queues frame for encoding. When the queue is full, the queue
+// policy decides whether it waits, drops the oldest frame or queues anyway.
+func (e *FFmpegEncoder) SendVideo(frame *sink.Frame) {
+	frame.Retain() // Released by encodeVideo
+	if dropped := e.queue.push(frame); dropped != nil {
+		dropped.Release()
+		e.stats.droppedFrames.Add(1)
+	}
 }
 
 func (e *FFmpegEncoder) SendAudio(samples []float32) {
@@ -487,15 +617,12 @@ func (e *FFmpegEncoder) CloseAudio() {
 }
 
 func (e *FFmpegEncoder) Close() error {
-	close(e.videoFrames)
+	e.queue.close()
 	e.CloseAudio()
 	return <-e.done
 }
 
 func (e *FFmpegEncoder) cleanup() {
-	if e.videoFrameBuffer != nil {
-		C.free(e.videoFrameBuffer)
-	}
 	if e.videoFrame != nil {
 		C.av_frame_free(&e.videoFrame)
 	}
@@ -505,6 +632,17 @@ func (e *FFmpegEncoder) cleanup() {
 	if e.audioFrame != nil {
 		C.av_frame_free(&e.audioFrame)
 	}
+	if e.audioSwr != nil {
+		C.swr_free(&e.audioSwr)
+	}
+	if e.audioCopy != nil {
+		e.audioCopy.close()
+		e.audioCopy = nil
+	}
+	if e.audioFifo != nil {
+		C.av_audio_fifo_free(e.audioFifo)
+		e.audioFifo = nil
+	}
 	if e.videoCodecCtx != nil {
 		C.avcodec_free_context(&e.videoCodecCtx)
 	}
@@ -514,6 +652,10 @@ func (e *FFmpegEncoder) cleanup() {
 	if e.swsCtx != nil {
 		C.sws_freeContext(e.swsCtx)
 	}
+	if e.filter != nil {
+		e.filter.close()
+		e.filter = nil
+	}
 	if e.formatCtx != nil {
 		if (e.formatCtx.oformat.flags & C.AVFMT_NOFILE) == 0 {
 			C.avio_closep(&e.formatCtx.pb)
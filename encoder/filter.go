@@ -0,0 +1,131 @@
+package encoder
+
+/*
+#include <errno.h>
+#include <stdio.h>
+#include <libavfilter/avfilter.h>
+#include <libavfilter/buffersink.h>
+#include <libavfilter/buffersrc.h>
+#include <libavutil/imgutils.h>
+#include <libavutil/mem.h>
+#include <libavutil/pixdesc.h>
+#include <stdlib.h>
+
+static inline const char* filter_error_str(int errnum) {
+    static char str[AV_ERROR_MAX_STRING_SIZE];
+    return av_make_error_string(str, AV_ERROR_MAX_STRING_SIZE, errnum);
+}
+
+// filter_open builds graph from desc, fed width x height frames of in_fmt at
+// fps through src and read from sink. The frames are BT.709 limited range,
+// which scale and format conversions in desc need to know.
+static int filter_open(AVFilterGraph **graph, AVFilterContext **src, AVFilterContext **sink,
+        const char *desc, int width, int height, int in_fmt, int fps) {
+    AVFilterInOut *outputs = avfilter_inout_alloc();
+    AVFilterInOut *inputs = avfilter_inout_alloc();
+    char args[256];
+    int ret;
+
+    *graph = avfilter_graph_alloc();
+    if (!*graph || !outputs || !inputs) {
+        ret = AVERROR(ENOMEM);
+        goto end;
+    }
+    snprintf(args, sizeof(args), "video_size=%dx%d:pix_fmt=%d:time_base=1/%d:frame_rate=%d/1:pixel_aspect=1/1:colorspace=bt709:range=tv",
+        width, height, in_fmt, fps, fps);
+    ret = avfilter_graph_create_filter(src, avfilter_get_by_name("buffer"), "in", args, NULL, *graph);
+    if (ret < 0) goto end;
+    ret = avfilter_graph_create_filter(sink, avfilter_get_by_name("buffersink"), "out", NULL, NULL, *graph);
+    if (ret < 0) goto end;
+
+    // The open ends of desc: its input is fed by src, its output feeds sink.
+    outputs->name = av_strdup("in");
+    outputs->filter_ctx = *src;
+    inputs->name = av_strdup("out");
+    inputs->filter_ctx = *sink;
+    if ((ret = avfilter_graph_parse_ptr(*graph, desc, &inputs, &outputs, NULL)) < 0) goto end;
+    ret = avfilter_graph_config(*graph, NULL);
+end:
+    avfilter_inout_free(&inputs);
+    avfilter_inout_free(&outputs);
+    return ret;
+}
+*/
+import "C"
+import (
+	"fmt"
+	"log"
+	"unsafe"
+)
+
+// videoFilter runs the encoder's video through a libavfilter graph, e.g. to
+// scale it or apply a LUT with lut3d, in the same pass as the encode.
+type videoFilter struct {
+	graph *C.AVFilterGraph
+	src   *C.AVFilterContext
+	sink  *C.AVFilterContext
+	out   *C.AVFrame
+}
+
+// newVideoFilter builds the graph desc, in FFmpeg's -vf syntax, for width x
+// height frames of inFmt at fps. The graph converts its output to outFmt,
+// but may change its size.
+func newVideoFilter(desc string, width, height int, inFmt C.enum_AVPixelFormat, fps int, outFmt C.enum_AVPixelFormat) (*videoFilter, error) {
+	f := &videoFilter{out: C.av_frame_alloc()}
+	if f.out == nil {
+		return nil, fmt.Errorf("could not allocate filtered frame")
+	}
+	cDesc := C.CString(desc + ",format=" + C.GoString(C.av_get_pix_fmt_name(outFmt)))
+	defer C.free(unsafe.Pointer(cDesc))
+	if ret := C.filter_open(&f.graph, &f.src, &f.sink, cDesc, C.int(width), C.int(height), C.int(inFmt), C.int(fps)); ret < 0 {
+		f.close()
+		return nil, fmt.Errorf("invalid video filter '%s': %s", desc, C.GoString(C.filter_error_str(ret)))
+	}
+	w, h := f.size()
+	log.Printf("Filtering video through '%s' (%dx%d)", desc, w, h)
+	return f, nil
+}
+
+// size returns the size of the filtered frames.
+func (f *videoFilter) size() (C.int, C.int) {
+	return C.av_buffersink_get_w(f.sink), C.av_buffersink_get_h(f.sink)
+}
+
+// filterVideo sends frame through the filter and encodes the frames it puts
+// out. A nil frame flushes the filter.
+func (e *FFmpegEncoder) filterVideo(frame *C.AVFrame) {
+	f := e.filter
+	if ret := C.av_buffersrc_add_frame_flags(f.src, frame, C.AV_BUFFERSRC_FLAG_KEEP_REF); ret < 0 {
+		e.fail(fmt.Errorf("error sending frame to the video filter: %s", C.GoString(C.filter_error_str(ret))))
+		return
+	}
+	sinkTimeBase := C.av_buffersink_get_time_base(f.sink)
+	for {
+		ret := C.av_buffersink_get_frame(f.sink, f.out)
+		if ret < 0 {
+			if ret != C.AVERROR_EOF && ret != -C.EAGAIN {
+				e.fail(fmt.Errorf("error filtering video: %s", C.GoString(C.filter_error_str(ret))))
+			}
+			return
+		}
+		f.out.pts = C.av_rescale_q(f.out.pts, sinkTimeBase, e.videoCodecCtx.time_base)
+		e.encode(e.videoStream, e.videoCodecCtx, f.out)
+		C.av_frame_unref(f.out)
+	}
+}
+
+// copyPlanes copies the planar YUV pixels the renderer produces into frame,
+// which has their format and size.
+func copyPlanes(frame *C.AVFrame, pixels []byte, bytesPerPixel int) {
+	width := int(frame.width) * bytesPerPixel
+	height := int(frame.height)
+	for i := 0; i < 3; i++ {
+		src := (*C.uint8_t)(unsafe.Pointer(&pixels[i*width*height]))
+		C.av_image_copy_plane(frame.data[i], frame.linesize[i], src, C.int(width), C.int(width), C.int(height))
+	}
+}
+
+func (f *videoFilter) close() {
+	C.avfilter_graph_free(&f.graph)
+	C.av_frame_free(&f.out)
+}
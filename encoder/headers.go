@@ -0,0 +1,10 @@
+//go:build cgo && !systemffmpeg
+
+package encoder
+
+// Compiles against the ffmpeg-arcana headers in release/ (see arcana/headers.go).
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../release/include/arcana
+*/
+import "C"
@@ -0,0 +1,114 @@
+package encoder
+
+/*
+#include <libavcodec/avcodec.h>
+#include <libavutil/hwcontext.h>
+#include <stdlib.h>
+
+static inline const char* list_error_str(int errnum) {
+    static char str[AV_ERROR_MAX_STRING_SIZE];
+    return av_make_error_string(str, AV_ERROR_MAX_STRING_SIZE, errnum);
+}
+*/
+import "C"
+import (
+	"fmt"
+	"sort"
+	"unsafe"
+)
+
+// VideoCodecs are the -codec values, in the order they are listed.
+var VideoCodecs = []string{"h264", "hevc", "av1"}
+
+// EncoderInfo describes an FFmpeg encoder a codec option can select.
+type EncoderInfo struct {
+	Codec    string // The -codec or -audio-codec value
+	Name     string // FFmpeg encoder name
+	Linked   bool   // Whether the linked FFmpeg has the encoder
+	Hardware bool
+	Err      error // Why a linked video encoder failed to open, e.g. no GPU to run it on
+}
+
+// VideoEncoders lists the encoders each of VideoCodecs tries on this
+// platform, in order. Linked encoders are opened at a small size to find
+// out whether they work here, as hardware encoders need their GPU and
+// driver.
+func VideoEncoders() []EncoderInfo {
+	var infos []EncoderInfo
+	for _, codecPref := range VideoCodecs {
+		for _, name := range videoEncoderNames(codecPref) {
+			info := EncoderInfo{Codec: codecPref, Name: name}
+			if codec := findEncoder(name); codec != nil {
+				info.Linked = true
+				info.Hardware = codec.capabilities&C.AV_CODEC_CAP_HARDWARE != 0
+				info.Err = probeVideoEncoder(codec, name)
+			}
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+// AudioEncoders lists the encoders each -audio-codec value tries, in order.
+func AudioEncoders() []EncoderInfo {
+	names := make([]string, 0, len(audioCodecs))
+	for name := range audioCodecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var infos []EncoderInfo
+	for _, codecName := range names {
+		for _, name := range audioCodecs[codecName] {
+			infos = append(infos, EncoderInfo{Codec: codecName, Name: name, Linked: findEncoder(name) != nil})
+		}
+	}
+	return infos
+}
+
+// HWDevice is a hardware device type of the linked FFmpeg, for hardware
+// accelerated decoding and filtering.
+type HWDevice struct {
+	Type string
+	Err  error // Why a device of the type could not be created; nil if it could
+}
+
+// HWDevices lists the hardware device types the linked FFmpeg supports, and
+// creates the default device of each to find out whether it works here.
+func HWDevices() []HWDevice {
+	var devices []HWDevice
+	for t := C.av_hwdevice_iterate_types(C.AV_HWDEVICE_TYPE_NONE); t != C.AV_HWDEVICE_TYPE_NONE; t = C.av_hwdevice_iterate_types(t) {
+		device := HWDevice{Type: C.GoString(C.av_hwdevice_get_type_name(t))}
+		var ref *C.AVBufferRef
+		if ret := C.av_hwdevice_ctx_create(&ref, t, nil, nil, 0); ret < 0 {
+			device.Err = fmt.Errorf("%s", C.GoString(C.list_error_str(ret)))
+		} else {
+			C.av_buffer_unref(&ref)
+		}
+		devices = append(devices, device)
+	}
+	return devices
+}
+
+func findEncoder(name string) *C.AVCodec {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	return C.avcodec_find_encoder_by_name(cName)
+}
+
+// probeVideoEncoder opens codec for small 8-bit frames and closes it again.
+func probeVideoEncoder(codec *C.AVCodec, name string) error {
+	ctx := C.avcodec_alloc_context3(codec)
+	if ctx == nil {
+		return fmt.Errorf("could not allocate codec context")
+	}
+	defer C.avcodec_free_context(&ctx)
+	ctx.width = 256
+	ctx.height = 256
+	ctx.pix_fmt = getFFmpegPixFmt(8, name)
+	ctx.time_base = C.AVRational{num: 1, den: 30}
+	ctx.framerate = C.AVRational{num: 30, den: 1}
+	if ret := C.avcodec_open2(ctx, codec, nil); ret < 0 {
+		return fmt.Errorf("%s", C.GoString(C.list_error_str(ret)))
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package encoder
+
+/*
+#include <libavformat/avformat.h>
+#include <libavutil/dict.h>
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"unsafe"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+// addMetadata tags the output with opts.Metadata: the shader's title, author
+// and source and the render settings. Containers keep the tags they have
+// fields for.
+func (e *FFmpegEncoder) addMetadata(opts *options.ShaderOptions) {
+	for key, value := range opts.Metadata {
+		cKey := C.CString(key)
+		cValue := C.CString(value)
+		C.av_dict_set(&e.formatCtx.metadata, cKey, cValue, 0)
+		C.free(unsafe.Pointer(cKey))
+		C.free(unsafe.Pointer(cValue))
+	}
+}
+
+// writeMetadataSidecar writes opts.Metadata to <output>.json next to a file
+// output, for containers that drop tags and for archives that index them.
+// Network and segmented outputs have no sidecar.
+func writeMetadataSidecar(opts *options.ShaderOptions, formatName string) {
+	if len(opts.Metadata) == 0 || strings.Contains(*opts.OutputFile, "://") || isSegmentFormat(formatName) {
+		return
+	}
+	data, err := json.MarshalIndent(opts.Metadata, "", "  ")
+	if err != nil {
+		log.Printf("Warning: could not encode metadata sidecar: %v", err)
+		return
+	}
+	path := *opts.OutputFile + ".json"
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		log.Printf("Warning: could not write metadata sidecar %s: %v", path, err)
+	}
+}
@@ -0,0 +1,92 @@
+package encoder
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+// minTileWidth is the narrowest AV1 tile column chosen by default; narrower
+// tiles cost compression for little extra parallelism.
+const minTileWidth = 1024
+
+// ParseTiles parses an -encode-tiles value of the form COLUMNSxROWS.
+func ParseTiles(tiles string) (columns, rows int, err error) {
+	c, r, ok := strings.Cut(strings.ToLower(tiles), "x")
+	if ok {
+		columns, err = strconv.Atoi(c)
+		if err == nil {
+			rows, err = strconv.Atoi(r)
+		}
+	}
+	if !ok || err != nil || columns < 1 || rows < 1 {
+		return 0, 0, fmt.Errorf("invalid tiles '%s', expected COLUMNSxROWS such as 4x2", tiles)
+	}
+	return columns, rows, nil
+}
+
+// parallelCodecOptions returns the codec options that spread encoding of a
+// frame across cores, from -encode-threads, -encode-slices and -encode-tiles,
+// in the form the software encoder codecName takes them. Hardware encoders
+// only take slices. Settings the encoder has no equivalent for are warned
+// about and ignored.
+func parallelCodecOptions(codecName string, opts *options.ShaderOptions) map[string]string {
+	threads, slices, tiles := *opts.EncodeThreads, *opts.EncodeSlices, *opts.EncodeTiles
+	settings := map[string]string{}
+	unsupported := func(setting string) {
+		log.Printf("Warning: %s does not support %s; ignoring it", codecName, setting)
+	}
+
+	switch codecName {
+	case "libx264":
+		// 0 threads lets x264 use every core.
+		settings["threads"] = strconv.Itoa(threads)
+		if slices > 0 {
+			settings["slices"] = strconv.Itoa(slices)
+		}
+		if tiles != "" {
+			unsupported("-encode-tiles")
+		}
+	case "libx265":
+		// x265 sizes its thread pool from the cores unless told otherwise.
+		var params []string
+		if threads > 0 {
+			params = append(params, fmt.Sprintf("pools=%d", threads))
+		}
+		if slices > 0 {
+			params = append(params, fmt.Sprintf("slices=%d", slices))
+		}
+		if len(params) > 0 {
+			settings["x265-params"] = strings.Join(params, ":")
+		}
+		if tiles != "" {
+			unsupported("-encode-tiles")
+		}
+	case "libaom-av1":
+		// libaom runs single-threaded and untiled by default, so a 4K frame
+		// would encode on one core; 0 threads uses every core.
+		settings["threads"] = strconv.Itoa(threads)
+		settings["row-mt"] = "1"
+		if tiles == "" {
+			tiles = fmt.Sprintf("%dx1", max(1, *opts.Width/minTileWidth))
+		}
+		settings["tiles"] = tiles
+		if slices > 0 {
+			unsupported("-encode-slices")
+		}
+	default:
+		if slices > 0 {
+			settings["slices"] = strconv.Itoa(slices)
+		}
+		if threads > 0 {
+			unsupported("-encode-threads")
+		}
+		if tiles != "" {
+			unsupported("-encode-tiles")
+		}
+	}
+	return settings
+}
@@ -0,0 +1,83 @@
+package encoder
+
+/*
+#include <libavformat/avformat.h>
+#include <libavcodec/avcodec.h>
+#include <libavutil/spherical.h>
+#include <libavutil/stereo3d.h>
+*/
+import "C"
+import (
+	"fmt"
+	"log"
+	"unsafe"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+// addProjectionMetadata tags the video stream as 360° equirectangular video
+// and with its stereo layout, so players and video sites show it as such.
+// MP4 and MOV outputs carry the tags as the sv3d and st3d boxes of the
+// Spherical Video V2 specification, which FFmpeg treats as unofficial.
+func (e *FFmpegEncoder) addProjectionMetadata(opts *options.ShaderOptions) error {
+	codecpar := e.videoStream.codecpar
+	tagged := false
+
+	if *opts.Projection == "equirect" {
+		var size C.size_t
+		spherical := C.av_spherical_alloc(&size)
+		if spherical == nil {
+			return fmt.Errorf("could not allocate spherical metadata")
+		}
+		spherical.projection = C.AV_SPHERICAL_EQUIRECTANGULAR
+		if C.av_packet_side_data_add(&codecpar.coded_side_data, &codecpar.nb_coded_side_data,
+			C.AV_PKT_DATA_SPHERICAL, unsafe.Pointer(spherical), size, 0) == nil {
+			C.av_free(unsafe.Pointer(spherical))
+			return fmt.Errorf("could not add spherical metadata")
+		}
+		tagged = true
+	}
+
+	var layout C.enum_AVStereo3DType
+	switch *opts.Stereo {
+	case "sbs":
+		layout = C.AV_STEREO3D_SIDEBYSIDE
+	case "tb":
+		layout = C.AV_STEREO3D_TOPBOTTOM
+	default:
+		layout = C.AV_STEREO3D_2D
+	}
+	if layout != C.AV_STEREO3D_2D {
+		stereo := C.av_stereo3d_alloc()
+		if stereo == nil {
+			return fmt.Errorf("could not allocate stereo metadata")
+		}
+		stereo._type = layout
+		if C.av_packet_side_data_add(&codecpar.coded_side_data, &codecpar.nb_coded_side_data,
+			C.AV_PKT_DATA_STEREO3D, unsafe.Pointer(stereo), C.sizeof_AVStereo3D, 0) == nil {
+			C.av_free(unsafe.Pointer(stereo))
+			return fmt.Errorf("could not add stereo metadata")
+		}
+		tagged = true
+	}
+
+	if tagged {
+		e.formatCtx.strict_std_compliance = C.FF_COMPLIANCE_UNOFFICIAL
+		log.Printf("Tagging video as %s", projectionDescription(opts))
+	}
+	return nil
+}
+
+func projectionDescription(opts *options.ShaderOptions) string {
+	desc := "flat"
+	if *opts.Projection == "equirect" {
+		desc = "360° equirectangular"
+	}
+	switch *opts.Stereo {
+	case "sbs":
+		desc += ", side-by-side stereo"
+	case "tb":
+		desc += ", top-bottom stereo"
+	}
+	return desc
+}
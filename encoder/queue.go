@@ -0,0 +1,132 @@
+package encoder
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	options "github.com/richinsley/goshadertoy/options"
+	sink "github.com/richinsley/goshadertoy/sink"
+)
+
+// QueuePolicies are what SendVideo does when an encoder's queue is full.
+var QueuePolicies = map[string]string{
+	"block":       "wait for the encoder to make room",
+	"drop-oldest": "drop the oldest queued frame, keeping latency bounded",
+	"never-drop":  "grow the queue beyond its depth, so rendering never waits",
+}
+
+// queuePolicy returns the -queue-policy of opts, defaulting to drop-oldest
+// for live streams, where a late frame is worthless, and to block otherwise,
+// where every frame must be encoded.
+func queuePolicy(opts *options.ShaderOptions) (string, error) {
+	policy := *opts.QueuePolicy
+	if policy == "" {
+		if *opts.Mode == "stream" {
+			return "drop-oldest", nil
+		}
+		return "block", nil
+	}
+	if _, ok := QueuePolicies[policy]; !ok {
+		return "", fmt.Errorf("unknown queue policy '%s'", policy)
+	}
+	return policy, nil
+}
+
+// videoQueue holds the frames sent to an encoder until its goroutine takes
+// them, up to depth frames, applying the queue policy beyond.
+type videoQueue struct {
+	mu     sync.Mutex
+	ready  *sync.Cond // Signaled when a frame is added or the queue closes
+	room   *sync.Cond // Signaled when a frame is taken
+	frames []*sink.Frame
+	depth  int
+	policy string
+	closed bool
+
+	// Occupancy, sampled when a frame is added
+	peak    int
+	sum     int64
+	samples int64
+	waits   int64 // Frames that waited for room
+	waited  time.Duration
+	dropped int64 // Frames dropped by drop-oldest
+}
+
+func newVideoQueue(depth int, policy string) *videoQueue {
+	q := &videoQueue{depth: depth, policy: policy}
+	q.ready = sync.NewCond(&q.mu)
+	q.room = sync.NewCond(&q.mu)
+	return q
+}
+
+// push adds frame to the queue, and returns the frame the policy dropped to
+// make room for it, or nil.
+func (q *videoQueue) push(frame *sink.Frame) (dropped *sink.Frame) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.frames) >= q.depth {
+		switch q.policy {
+		case "drop-oldest":
+			dropped = q.frames[0]
+			q.frames = q.frames[1:]
+			q.dropped++
+		case "block":
+			start := time.Now()
+			for len(q.frames) >= q.depth && !q.closed {
+				q.room.Wait()
+			}
+			q.waits++
+			q.waited += time.Since(start)
+		}
+	}
+	q.frames = append(q.frames, frame)
+	q.samples++
+	q.sum += int64(len(q.frames))
+	q.peak = max(q.peak, len(q.frames))
+	q.ready.Signal()
+	return dropped
+}
+
+// pop takes the oldest frame, waiting for one. It returns false once the
+// queue is closed and empty.
+func (q *videoQueue) pop() (*sink.Frame, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.frames) == 0 && !q.closed {
+		q.ready.Wait()
+	}
+	if len(q.frames) == 0 {
+		return nil, false
+	}
+	frame := q.frames[0]
+	q.frames[0] = nil
+	q.frames = q.frames[1:]
+	q.room.Signal()
+	return frame, true
+}
+
+// close lets pop return false once the queued frames have been taken.
+func (q *videoQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.ready.Broadcast()
+	q.room.Broadcast()
+}
+
+// stats fills in the queue fields of s.
+func (q *videoQueue) stats(s *sink.Stats) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s.QueuePolicy = q.policy
+	s.QueueDepth = q.depth
+	s.QueueLength = len(q.frames)
+	s.QueuePeak = q.peak
+	if q.samples > 0 {
+		s.QueueMean = float64(q.sum) / float64(q.samples)
+	}
+	s.QueueWaits = q.waits
+	s.QueueWaited = q.waited
+	s.QueueDropped = q.dropped
+}
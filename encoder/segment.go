@@ -0,0 +1,85 @@
+package encoder
+
+/*
+#include <libavformat/avformat.h>
+#include <libavutil/dict.h>
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+// isSegmentFormat reports whether the muxer writes a playlist plus media
+// segments that a web server can serve as they appear.
+func isSegmentFormat(formatName string) bool {
+	return formatName == "hls" || formatName == "dash"
+}
+
+// segmentMuxerOptions returns the HLS or DASH muxer settings for opts. Record
+// mode writes a complete on-demand playlist; stream mode keeps a sliding window
+// of -segment-list-size segments and deletes the older ones.
+func segmentMuxerOptions(formatName string, opts *options.ShaderOptions) map[string]string {
+	segmentTime := fmt.Sprintf("%g", *opts.SegmentTime)
+	live := *opts.Mode == "stream"
+	listSize := *opts.SegmentListSize
+	if !live {
+		listSize = 0
+	}
+
+	settings := map[string]string{}
+	switch formatName {
+	case "hls":
+		settings["hls_time"] = segmentTime
+		settings["hls_list_size"] = fmt.Sprint(listSize)
+		settings["hls_flags"] = "independent_segments"
+		if *opts.SegmentType == "fmp4" {
+			settings["hls_segment_type"] = "fmp4"
+		}
+		if !live {
+			settings["hls_playlist_type"] = "vod"
+		} else if listSize > 0 {
+			settings["hls_flags"] += "+delete_segments"
+		}
+	case "dash":
+		settings["seg_duration"] = segmentTime
+		settings["use_template"] = "1"
+		settings["use_timeline"] = "1"
+		settings["window_size"] = fmt.Sprint(listSize)
+		if live {
+			settings["streaming"] = "1"
+		}
+	}
+	return settings
+}
+
+// writeHeader writes the output header, passing the segmenting muxers their
+// settings. The directory of a playlist is created if needed, as the muxer
+// writes its segments next to it.
+func (e *FFmpegEncoder) writeHeader(formatName string) error {
+	var muxOpts *C.AVDictionary
+	defer C.av_dict_free(&muxOpts)
+
+	if isSegmentFormat(formatName) {
+		if err := os.MkdirAll(filepath.Dir(*e.opts.OutputFile), 0755); err != nil {
+			return fmt.Errorf("could not create output directory: %w", err)
+		}
+		for key, value := range segmentMuxerOptions(formatName, e.opts) {
+			cKey := C.CString(key)
+			cValue := C.CString(value)
+			C.av_dict_set(&muxOpts, cKey, cValue, 0)
+			C.free(unsafe.Pointer(cKey))
+			C.free(unsafe.Pointer(cValue))
+		}
+	}
+
+	if C.avformat_write_header(e.formatCtx, &muxOpts) < 0 {
+		return fmt.Errorf("could not write header")
+	}
+	return nil
+}
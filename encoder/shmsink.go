@@ -0,0 +1,295 @@
+//go:build linux || darwin
+
+package encoder
+
+/*
+#include <libavutil/pixfmt.h>
+*/
+import "C"
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"unsafe"
+
+	options "github.com/richinsley/goshadertoy/options"
+	semaphore "github.com/richinsley/goshadertoy/semaphore"
+	sharedmemory "github.com/richinsley/goshadertoy/sharedmemory"
+	sink "github.com/richinsley/goshadertoy/sink"
+)
+
+func init() {
+	sink.RegisterSink("shm", newSHMSink)
+}
+
+const (
+	shmSlots         = 3 // Ring buffer slots per stream, as in shmframe's muxer
+	shmControlSize   = 8 // SHMControlBlock: num_buffers, eof
+	shmAudioSlotSecs = 1 // Seconds of audio per slot
+)
+
+// shmHeader is shmframe's SHMHeader (shmframe/protocol.h), written once to
+// the pipe.
+type shmHeader struct {
+	VideoFile     [512]byte
+	VideoEmptySem [256]byte
+	VideoFullSem  [256]byte
+	AudioFile     [512]byte
+	AudioEmptySem [256]byte
+	AudioFullSem  [256]byte
+	Version       uint32
+	StreamCount   uint32
+	FrameRate     uint32
+	Channels      uint32
+	SampleRate    uint32
+	BitDepth      uint32
+	Width         uint32
+	Height        uint32
+	PixFmt        int32
+}
+
+// shmFrameHeader is shmframe's FrameHeader, written to the pipe for each
+// frame in shared memory.
+type shmFrameHeader struct {
+	CmdType uint32 // 0 video, 1 audio, 2 EOF
+	Size    uint32
+	PTS     int64
+	Offset  uint64 // Of the frame in the stream's shared memory
+}
+
+// shmRing is the shared memory ring buffer of one stream.
+type shmRing struct {
+	mem         *sharedmemory.SharedMemory
+	empty, full semaphore.Semaphore
+	semNames    [2]string
+	slotSize    int
+	next        int
+}
+
+func newSHMRing(name string, slotSize int) (*shmRing, error) {
+	r := &shmRing{slotSize: slotSize, semNames: [2]string{name + "_empty", name + "_full"}}
+	var err error
+	if r.mem, err = sharedmemory.CreateSharedMemory(name, shmControlSize+slotSize*shmSlots); err != nil {
+		return nil, fmt.Errorf("failed to create shared memory %s: %w", name, err)
+	}
+	binary.LittleEndian.PutUint32(r.mem.GetByteSlice(0)[:4], shmSlots)
+	for i, semName := range r.semNames {
+		semaphore.RemoveSemaphore(semName) // Left over from a process that died
+		initial := shmSlots
+		if i == 1 {
+			initial = 0
+		}
+		sem, err := semaphore.NewSemaphore(semName, initial)
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+		if i == 0 {
+			r.empty = sem
+		} else {
+			r.full = sem
+		}
+	}
+	return r, nil
+}
+
+// put copies data into the next free slot, waiting for the consumer to free
+// one, and returns its offset.
+func (r *shmRing) put(data []byte) (uint64, error) {
+	if err := r.empty.Acquire(); err != nil {
+		return 0, err
+	}
+	offset := shmControlSize + r.next*r.slotSize
+	copy(r.mem.GetByteSlice(offset)[:r.slotSize], data)
+	r.next = (r.next + 1) % shmSlots
+	return uint64(offset), nil
+}
+
+// close marks the end of the stream and unlinks the names, which the
+// consumer has opened by then.
+func (r *shmRing) close() {
+	if r.mem != nil {
+		binary.LittleEndian.PutUint32(r.mem.GetByteSlice(4)[:4], 1)
+		r.mem.Close()
+	}
+	for _, sem := range []semaphore.Semaphore{r.empty, r.full} {
+		if sem != nil {
+			sem.Close()
+		}
+	}
+	for _, name := range r.semNames {
+		semaphore.RemoveSemaphore(name)
+	}
+}
+
+// shmSink hands the uncompressed frames and audio to another process through
+// shared memory, with the protocol of shmframe's muxer: a header and one
+// FrameHeader per frame go down the -output pipe (a FIFO, file or "-" for
+// standard output), the pixels and samples through ring buffers. An FFmpeg
+// built with the shmframe demuxer reads it with "-f shmframe -i <pipe>".
+type shmSink struct {
+	output   string
+	out      io.WriteCloser
+	w        *bufio.Writer
+	video    *shmRing
+	audio    *shmRing
+	channels int
+	audioPTS int64 // In samples
+
+	mu     sync.Mutex
+	frames int64
+	bytes  int64
+	err    error
+}
+
+func newSHMSink(opts *options.ShaderOptions) (sink.Sink, error) {
+	pid := os.Getpid()
+	bytesPerSample, pixFmt := 1, int32(C.AV_PIX_FMT_YUV444P)
+	if *opts.BitDepth > 8 {
+		bytesPerSample, pixFmt = 2, int32(C.AV_PIX_FMT_YUV444P10LE)
+	}
+	frameSize := *opts.Width * *opts.Height * bytesPerSample * 3
+	header := shmHeader{
+		Version:     1,
+		StreamCount: 1,
+		FrameRate:   uint32(*opts.FPS),
+		Width:       uint32(*opts.Width),
+		Height:      uint32(*opts.Height),
+		PixFmt:      pixFmt,
+	}
+	s := &shmSink{output: *opts.OutputFile}
+	name := fmt.Sprintf("goshadertoy_video_%d", pid)
+	var err error
+	if s.video, err = newSHMRing(name, frameSize); err != nil {
+		return nil, err
+	}
+	copy(header.VideoFile[:], "/"+name)
+	copy(header.VideoEmptySem[:], s.video.semNames[0])
+	copy(header.VideoFullSem[:], s.video.semNames[1])
+
+	if *opts.AudioInputFile != "" || *opts.AudioInputDevice != "" || opts.HasSoundShader {
+		name := fmt.Sprintf("goshadertoy_audio_%d", pid)
+		s.channels = *opts.AudioOutChannels
+		if s.audio, err = newSHMRing(name, *opts.AudioSampleRate*s.channels*4*shmAudioSlotSecs); err != nil {
+			s.video.close()
+			return nil, err
+		}
+		copy(header.AudioFile[:], "/"+name)
+		copy(header.AudioEmptySem[:], s.audio.semNames[0])
+		copy(header.AudioFullSem[:], s.audio.semNames[1])
+		header.StreamCount = 2
+		header.Channels = uint32(s.channels)
+		header.SampleRate = uint32(*opts.AudioSampleRate)
+		header.BitDepth = 32
+	}
+
+	if s.out, err = sink.OpenOutput(*opts.OutputFile); err != nil {
+		s.closeRings()
+		return nil, err
+	}
+	s.w = bufio.NewWriter(s.out)
+	s.writeHeader(&header)
+	if err := s.err; err != nil {
+		s.out.Close()
+		s.closeRings()
+		return nil, err
+	}
+	log.Printf("Sharing frames through shared memory %s, announced on %s", name, s.output)
+	return s, nil
+}
+
+// writeHeader writes a header to the pipe and flushes it, so the consumer
+// sees it at once. Must be called with mu held once the sink is shared.
+func (s *shmSink) writeHeader(header any) {
+	if s.err != nil {
+		return
+	}
+	if err := binary.Write(s.w, binary.LittleEndian, header); err != nil {
+		s.err = fmt.Errorf("failed to write to %s: %w", s.output, err)
+		return
+	}
+	if err := s.w.Flush(); err != nil {
+		s.err = fmt.Errorf("failed to write to %s: %w", s.output, err)
+	}
+}
+
+// send puts data into ring and announces it. Must be called with mu held.
+func (s *shmSink) send(ring *shmRing, cmdType uint32, pts int64, data []byte) {
+	if s.err != nil {
+		return
+	}
+	offset, err := ring.put(data)
+	if err != nil {
+		s.err = fmt.Errorf("shared memory: %w", err)
+		return
+	}
+	if err := ring.full.Release(); err != nil {
+		s.err = fmt.Errorf("shared memory: %w", err)
+		return
+	}
+	s.writeHeader(&shmFrameHeader{CmdType: cmdType, Size: uint32(len(data)), PTS: pts, Offset: offset})
+	s.bytes += int64(len(data))
+}
+
+func (s *shmSink) SendVideo(frame *sink.Frame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.send(s.video, 0, frame.PTS, frame.Pixels)
+	if s.err == nil {
+		s.frames++
+	}
+}
+
+// SendAudio sends samples, interleaved float32 as shmframe expects, in
+// chunks of at most a slot.
+func (s *shmSink) SendAudio(samples []float32) {
+	if s.audio == nil || len(samples) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := unsafe.Slice((*byte)(unsafe.Pointer(&samples[0])), len(samples)*4)
+	for len(data) > 0 && s.err == nil {
+		n := min(len(data), s.audio.slotSize)
+		s.send(s.audio, 1, s.audioPTS, data[:n])
+		s.audioPTS += int64(n / 4 / s.channels)
+		data = data[n:]
+	}
+}
+
+func (s *shmSink) CloseAudio()              {}
+func (s *shmSink) AddChapter(int64, string) {}
+
+func (s *shmSink) Stats() []sink.Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return []sink.Stats{{Output: s.output, VideoFrames: s.frames, BytesWritten: s.bytes}}
+}
+
+func (s *shmSink) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *shmSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writeHeader(&shmFrameHeader{CmdType: 2})
+	if err := s.out.Close(); err != nil && s.err == nil {
+		s.err = err
+	}
+	s.closeRings()
+	return s.err
+}
+
+func (s *shmSink) closeRings() {
+	s.video.close()
+	if s.audio != nil {
+		s.audio.close()
+	}
+}
@@ -0,0 +1,161 @@
+//go:build cgo
+
+package encoder
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	options "github.com/richinsley/goshadertoy/options"
+	sink "github.com/richinsley/goshadertoy/sink"
+)
+
+func init() {
+	sink.RegisterSink("ffmpeg", newFFmpegSinks)
+	sink.RegisterConcat(ConcatSegments)
+}
+
+// OutputSpec is one entry of the -outputs list: a file name or URL followed by
+// optional per-sink settings, e.g. "rtmp://host/live/key|codec=h264,audio-bitrate=128".
+type OutputSpec struct {
+	URL      string
+	Settings map[string]string
+}
+
+// outputSettings are the per-sink settings accepted in an OutputSpec.
+var outputSettings = map[string]bool{
+	"codec":         true,
+	"container":     true,
+	"format":        true,
+	"audio-codec":   true,
+	"audio-bitrate": true,
+	"queue-policy":  true,
+}
+
+// ParseOutputSpecs parses a ';'-separated list of output specs.
+func ParseOutputSpecs(spec string) ([]OutputSpec, error) {
+	var specs []OutputSpec
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		url, settingsStr, _ := strings.Cut(entry, "|")
+		out := OutputSpec{URL: strings.TrimSpace(url), Settings: map[string]string{}}
+		if out.URL == "" {
+			return nil, fmt.Errorf("output '%s' has no file name or URL", entry)
+		}
+		if settingsStr != "" {
+			for _, kv := range strings.Split(settingsStr, ",") {
+				key, value, ok := strings.Cut(kv, "=")
+				key = strings.ToLower(strings.TrimSpace(key))
+				if !ok || !outputSettings[key] {
+					return nil, fmt.Errorf("invalid setting '%s' for output %s (valid: codec, format, audio-codec, audio-bitrate, queue-policy)", kv, out.URL)
+				}
+				out.Settings[key] = strings.TrimSpace(value)
+			}
+		}
+		if err := out.validate(); err != nil {
+			return nil, err
+		}
+		specs = append(specs, out)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no outputs specified")
+	}
+	return specs, nil
+}
+
+func (o OutputSpec) validate() error {
+	if codec, ok := o.Settings["codec"]; ok && codec != "h264" && codec != "hevc" && codec != "av1" {
+		return fmt.Errorf("invalid codec '%s' for output %s. Valid codecs are: h264, hevc, av1", codec, o.URL)
+	}
+	if container, ok := o.Settings["container"]; ok {
+		if _, valid := Containers[container]; !valid {
+			return fmt.Errorf("invalid container '%s' for output %s. Valid containers are: mkv, mov, mp4, webm", container, o.URL)
+		}
+	}
+	if codec, ok := o.Settings["audio-codec"]; ok {
+		if err := ValidateAudioCodec(codec); err != nil {
+			return fmt.Errorf("output %s: %w", o.URL, err)
+		}
+	}
+	if bitrate, ok := o.Settings["audio-bitrate"]; ok {
+		if v, err := strconv.Atoi(bitrate); err != nil || v <= 0 {
+			return fmt.Errorf("invalid audio-bitrate '%s' for output %s", bitrate, o.URL)
+		}
+	}
+	if policy, ok := o.Settings["queue-policy"]; ok {
+		if _, valid := QueuePolicies[policy]; !valid {
+			return fmt.Errorf("invalid queue-policy '%s' for output %s. Valid policies are: block, drop-oldest, never-drop", policy, o.URL)
+		}
+	}
+	return nil
+}
+
+// optionsFor returns a copy of opts with the spec's URL and settings applied.
+// The copy shares every pointer the spec does not override.
+func (o OutputSpec) optionsFor(opts *options.ShaderOptions) *options.ShaderOptions {
+	sinkOpts := *opts
+	url := o.URL
+	sinkOpts.OutputFile = &url
+	if codec, ok := o.Settings["codec"]; ok {
+		sinkOpts.Codec = &codec
+	}
+	if container, ok := o.Settings["container"]; ok {
+		sinkOpts.Container = &container
+	}
+	if format, ok := o.Settings["format"]; ok {
+		sinkOpts.OutputFormat = &format
+	}
+	if codec, ok := o.Settings["audio-codec"]; ok {
+		sinkOpts.AudioCodec = &codec
+	}
+	if bitrate, ok := o.Settings["audio-bitrate"]; ok {
+		v, _ := strconv.Atoi(bitrate)
+		sinkOpts.AudioBitrate = &v
+	}
+	if policy, ok := o.Settings["queue-policy"]; ok {
+		sinkOpts.QueuePolicy = &policy
+	}
+	return &sinkOpts
+}
+
+// newFFmpegSinks creates and starts an encoder for every configured output.
+// With no -outputs list, the single -output file is used.
+func newFFmpegSinks(opts *options.ShaderOptions) (sink.Sink, error) {
+	specs := []OutputSpec{{URL: *opts.OutputFile}}
+	if *opts.Outputs != "" {
+		var err error
+		if specs, err = ParseOutputSpecs(*opts.Outputs); err != nil {
+			return nil, err
+		}
+	}
+
+	var sinks sink.MultiSink
+	for _, spec := range specs {
+		sinkOpts := opts
+		if *opts.Outputs != "" {
+			sinkOpts = spec.optionsFor(opts)
+		}
+		if err := ResolveContainer(sinkOpts); err != nil {
+			sinks.Close()
+			return nil, fmt.Errorf("output %s: %w", spec.URL, err)
+		}
+		e, err := NewFFmpegEncoder(sinkOpts)
+		if err != nil {
+			sinks.Close()
+			return nil, fmt.Errorf("failed to open output %s: %w", spec.URL, err)
+		}
+		go e.Run()
+		log.Printf("Opened output %s", spec.URL)
+		sinks = append(sinks, e)
+	}
+
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return sinks, nil
+}
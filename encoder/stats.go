@@ -0,0 +1,29 @@
+package encoder
+
+import (
+	"sync/atomic"
+
+	sink "github.com/richinsley/goshadertoy/sink"
+)
+
+// encoderStats is updated by the encoding goroutine and read by Stats.
+type encoderStats struct {
+	videoFrames   atomic.Int64
+	bytesWritten  atomic.Int64
+	droppedFrames atomic.Int64
+}
+
+// Stats returns a snapshot of the encoder's progress.
+func (e *FFmpegEncoder) Stats() []sink.Stats {
+	s := sink.Stats{
+		Output:        *e.opts.OutputFile,
+		VideoFrames:   e.stats.videoFrames.Load(),
+		BytesWritten:  e.stats.bytesWritten.Load(),
+		DroppedFrames: e.stats.droppedFrames.Load(),
+	}
+	e.queue.stats(&s)
+	if seconds := float64(s.VideoFrames) / float64(*e.opts.FPS); seconds > 0 {
+		s.BitrateKbps = float64(s.BytesWritten) * 8 / seconds / 1000
+	}
+	return []sink.Stats{s}
+}
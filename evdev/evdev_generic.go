@@ -0,0 +1,23 @@
+//go:build !linux
+
+package evdev
+
+import "fmt"
+
+// Reader reads Linux input devices; it is unavailable on other platforms.
+type Reader struct{}
+
+// KeyEvent is a key going down or up, by Linux key code.
+type KeyEvent struct {
+	Code uint16
+	Down bool
+}
+
+func Open(spec string) (*Reader, error) {
+	return nil, fmt.Errorf("reading input devices is only supported on Linux")
+}
+
+func (r *Reader) SetBounds(width, height int)        {}
+func (r *Reader) Pointer() (x, y float64, down bool) { return 0, 0, false }
+func (r *Reader) KeyEvents() []KeyEvent              { return nil }
+func (r *Reader) Close()                             {}
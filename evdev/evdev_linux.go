@@ -0,0 +1,191 @@
+//go:build linux
+
+package evdev
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// Event types and codes from linux/input-event-codes.h.
+const (
+	evKey = 0x01
+	evRel = 0x02
+	evAbs = 0x03
+
+	relX = 0x00
+	relY = 0x01
+	absX = 0x00
+	absY = 0x01
+
+	btnLeft  = 0x110
+	btnTouch = 0x14a
+)
+
+// inputEvent is struct input_event.
+type inputEvent struct {
+	Time  syscall.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// absInfo is struct input_absinfo.
+type absInfo struct {
+	Value, Minimum, Maximum, Fuzz, Flat, Resolution int32
+}
+
+// Reader merges the pointer and keyboard events of Linux input devices
+// (/dev/input/event*), for when no window system delivers input, e.g. under
+// gamescope's DRM backend. Relative devices move the pointer by their
+// motion in pixels; absolute ones (touchscreens, tablets) place it.
+type Reader struct {
+	mu            sync.Mutex
+	files         []*os.File
+	width, height float64
+	x, y          float64 // Pointer in pixels from the top left
+	down          bool
+	keys          []KeyEvent // Key events since the last KeyEvents
+}
+
+// KeyEvent is a key going down or up, by Linux key code (KEY_*).
+type KeyEvent struct {
+	Code uint16
+	Down bool
+}
+
+// Open starts reading the devices in spec, a comma-separated list of event
+// device paths, or "all" for every device in /dev/input.
+func Open(spec string) (*Reader, error) {
+	var paths []string
+	if spec == "all" {
+		paths, _ = filepath.Glob("/dev/input/event*")
+	} else {
+		for _, p := range strings.Split(spec, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				paths = append(paths, p)
+			}
+		}
+	}
+
+	r := &Reader{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Printf("Warning: cannot read input device %s: %v", path, err)
+			continue
+		}
+		r.files = append(r.files, f)
+		go r.read(f, absRanges(f))
+	}
+	if len(r.files) == 0 {
+		return nil, fmt.Errorf("no readable input devices in '%s' (is the user in the input group?)", spec)
+	}
+	log.Printf("Reading input from %d device(s)", len(r.files))
+	return r, nil
+}
+
+// absRanges returns the ranges of a device's absolute X and Y axes, zero if it
+// has none.
+func absRanges(f *os.File) [2]absInfo {
+	var ranges [2]absInfo
+	for axis := range ranges {
+		// EVIOCGABS(axis) = _IOR('E', 0x40 + axis, struct input_absinfo)
+		req := 2<<30 | unsafe.Sizeof(absInfo{})<<16 | 'E'<<8 | uintptr(0x40+axis)
+		syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(unsafe.Pointer(&ranges[axis])))
+	}
+	return ranges
+}
+
+func (r *Reader) read(f *os.File, ranges [2]absInfo) {
+	var ev inputEvent
+	buf := make([]byte, unsafe.Sizeof(ev))
+	for {
+		if _, err := io.ReadFull(f, buf); err != nil {
+			return // Closed or unplugged
+		}
+		ev = *(*inputEvent)(unsafe.Pointer(&buf[0]))
+		r.handle(ev, ranges)
+	}
+}
+
+func (r *Reader) handle(ev inputEvent, ranges [2]absInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch ev.Type {
+	case evRel:
+		switch ev.Code {
+		case relX:
+			r.x = clamp(r.x+float64(ev.Value), r.width)
+		case relY:
+			r.y = clamp(r.y+float64(ev.Value), r.height)
+		}
+	case evAbs:
+		if ev.Code == absX || ev.Code == absY {
+			rng := ranges[ev.Code]
+			if rng.Maximum <= rng.Minimum {
+				return
+			}
+			t := float64(ev.Value-rng.Minimum) / float64(rng.Maximum-rng.Minimum)
+			if ev.Code == absX {
+				r.x = clamp(t*r.width, r.width)
+			} else {
+				r.y = clamp(t*r.height, r.height)
+			}
+		}
+	case evKey:
+		switch {
+		case ev.Code == btnLeft || ev.Code == btnTouch:
+			r.down = ev.Value != 0
+		case ev.Value != 2 && ev.Code < btnLeft: // Not repeats
+			r.keys = append(r.keys, KeyEvent{Code: ev.Code, Down: ev.Value == 1})
+		}
+	}
+}
+
+func clamp(v, size float64) float64 {
+	return max(0, min(v, size-1))
+}
+
+// SetBounds sets the size in pixels of the area the pointer moves in, which
+// starts at its center.
+func (r *Reader) SetBounds(width, height int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.width == 0 && r.height == 0 {
+		r.x, r.y = float64(width)/2, float64(height)/2
+	}
+	r.width, r.height = float64(width), float64(height)
+	r.x, r.y = clamp(r.x, r.width), clamp(r.y, r.height)
+}
+
+// Pointer returns the pointer position in pixels from the top left and
+// whether the left button (or a touch) is down.
+func (r *Reader) Pointer() (x, y float64, down bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.x, r.y, r.down
+}
+
+// KeyEvents returns the key events since it was last called.
+func (r *Reader) KeyEvents() []KeyEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := r.keys
+	r.keys = nil
+	return keys
+}
+
+// Close stops reading the devices.
+func (r *Reader) Close() {
+	for _, f := range r.files {
+		f.Close()
+	}
+}
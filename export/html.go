@@ -0,0 +1,192 @@
+// Package export turns a fetched shader into a standalone web page.
+package export
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	api "github.com/richinsley/goshadertoy/api"
+)
+
+// passOrder is the order Shadertoy renders passes in each frame.
+var passOrder = []string{"A", "B", "C", "D", "image"}
+
+type pageData struct {
+	Title  string     `json:"title"`
+	Common string     `json:"common"`
+	Passes []passData `json:"passes"`
+}
+
+type passData struct {
+	Name   string        `json:"name"`
+	Code   string        `json:"code"`
+	Inputs []channelData `json:"inputs"`
+}
+
+type channelData struct {
+	Channel int         `json:"channel"`
+	Type    string      `json:"type"`
+	Filter  string      `json:"filter"`
+	Wrap    string      `json:"wrap"`
+	VFlip   bool        `json:"vflip"`
+	Buffer  string      `json:"buffer,omitempty"` // Buffer pass read by a "buffer" input
+	Image   string      `json:"image,omitempty"`  // PNG data URI of a texture
+	Faces   []string    `json:"faces,omitempty"`  // PNG data URIs of the cubemap faces, in GL order
+	Volume  *volumeData `json:"volume,omitempty"`
+	Audio   string      `json:"audio,omitempty"` // Data URI of the music track
+}
+
+type volumeData struct {
+	Width    uint32 `json:"width"`
+	Height   uint32 `json:"height"`
+	Depth    uint32 `json:"depth"`
+	Channels uint8  `json:"channels"`
+	Format   uint16 `json:"format"` // 0 for I8, 10 for F32
+	Data     string `json:"data"`   // Base64 texels
+}
+
+// WriteHTMLFile writes the shader to path as a self-contained HTML page.
+func WriteHTMLFile(path string, args *api.ShaderArgs) error {
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, args); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// WriteHTML writes the shader as a self-contained HTML page that renders it
+// with WebGL2. Textures, cubemaps, volumes and music are embedded, so the page
+// works offline. Sound passes are not exported.
+func WriteHTML(w io.Writer, args *api.ShaderArgs) error {
+	data := pageData{Title: args.Title, Common: args.CommonCode}
+	for _, name := range passOrder {
+		pass, ok := args.Buffers[name]
+		if !ok {
+			continue
+		}
+		pd := passData{Name: name, Code: pass.Code, Inputs: []channelData{}}
+		for _, ch := range pass.Inputs {
+			if ch == nil {
+				continue
+			}
+			cd, err := channelFor(ch)
+			if err != nil {
+				return fmt.Errorf("pass %s channel %d: %w", name, ch.Channel, err)
+			}
+			if cd != nil {
+				pd.Inputs = append(pd.Inputs, *cd)
+			}
+		}
+		data.Passes = append(data.Passes, pd)
+	}
+	if _, ok := args.Buffers["image"]; !ok {
+		return fmt.Errorf("shader has no image pass")
+	}
+	if _, ok := args.Buffers["sound"]; ok {
+		log.Println("Warning: the sound pass is not included in the exported page")
+	}
+
+	// encoding/json escapes <, > and &, so the data is safe inside a script element.
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	page := strings.NewReplacer(
+		"{{TITLE}}", html.EscapeString(args.Title),
+		"{{DATA}}", string(dataJSON),
+	).Replace(pageTemplate)
+	_, err = io.WriteString(w, page)
+	return err
+}
+
+// channelFor converts a channel to its embedded form. Unsupported channel
+// types are skipped with a warning.
+func channelFor(ch *api.ShadertoyChannel) (*channelData, error) {
+	cd := &channelData{
+		Channel: ch.Channel,
+		Type:    ch.CType,
+		Filter:  ch.Sampler.Filter,
+		Wrap:    ch.Sampler.Wrap,
+		VFlip:   ch.Sampler.VFlip == "true",
+	}
+	switch ch.CType {
+	case "buffer":
+		cd.Buffer = ch.BufferRef
+	case "texture":
+		if ch.Data == nil {
+			return nil, fmt.Errorf("texture was not loaded")
+		}
+		uri, err := pngDataURI(ch.Data)
+		if err != nil {
+			return nil, err
+		}
+		cd.Image = uri
+	case "cubemap":
+		for i, face := range ch.CubeData {
+			if face == nil {
+				return nil, fmt.Errorf("cubemap face %d was not loaded", i)
+			}
+			uri, err := pngDataURI(face)
+			if err != nil {
+				return nil, err
+			}
+			cd.Faces = append(cd.Faces, uri)
+		}
+	case "volume":
+		if ch.Volume == nil {
+			return nil, fmt.Errorf("volume was not loaded")
+		}
+		v := ch.Volume
+		cd.Volume = &volumeData{
+			Width:    v.Width,
+			Height:   v.Height,
+			Depth:    v.Depth,
+			Channels: v.NumChannels,
+			Format:   v.Format,
+			Data:     base64.StdEncoding.EncodeToString(v.Data),
+		}
+	case "music":
+		audio, err := os.ReadFile(ch.MusicFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read music: %w", err)
+		}
+		cd.Audio = "data:" + audioMIMEType(ch.MusicFile) + ";base64," + base64.StdEncoding.EncodeToString(audio)
+	case "mic":
+		// The page asks for the microphone when audio is started.
+	default:
+		log.Printf("Warning: %s input on channel %d is not supported in exported pages", ch.CType, ch.Channel)
+		return nil, nil
+	}
+	return cd, nil
+}
+
+func pngDataURI(img image.Image) (string, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", fmt.Errorf("failed to encode image: %w", err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func audioMIMEType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ogg":
+		return "audio/ogg"
+	case ".wav":
+		return "audio/wav"
+	case ".m4a", ".aac":
+		return "audio/mp4"
+	default:
+		return "audio/mpeg"
+	}
+}
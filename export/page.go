@@ -0,0 +1,420 @@
+package export
+
+// pageTemplate is the exported page. {{TITLE}} is replaced with the escaped
+// shader title and {{DATA}} with the JSON pageData.
+const pageTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{TITLE}}</title>
+<style>
+html, body { margin: 0; height: 100%; background: #000; overflow: hidden; }
+canvas { display: block; width: 100%; height: 100%; }
+#info { position: fixed; left: 8px; bottom: 8px; padding: 4px 8px; border-radius: 3px;
+        background: rgba(0, 0, 0, 0.5); color: #ccc; font: 12px sans-serif; }
+#error { position: fixed; top: 0; left: 0; right: 0; margin: 0; padding: 8px; display: none;
+         background: rgba(0, 0, 0, 0.85); color: #f66; font: 12px monospace; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<canvas id="canvas"></canvas>
+<div id="info">{{TITLE}}</div>
+<pre id="error"></pre>
+<script>
+"use strict";
+const shader = {{DATA}};
+
+const canvas = document.getElementById("canvas");
+const info = document.getElementById("info");
+const gl = canvas.getContext("webgl2");
+
+function fail(message) {
+  const el = document.getElementById("error");
+  el.textContent = message;
+  el.style.display = "block";
+  throw new Error(message);
+}
+
+if (!gl) {
+  fail("This browser does not support WebGL2.");
+}
+// Buffers are half float where the browser can render to it, like Shadertoy.
+const floatBuffers = gl.getExtension("EXT_color_buffer_float") !== null;
+gl.getExtension("OES_texture_float_linear");
+
+// ---- Programs ----
+
+const vertexSource = "#version 300 es\nin vec2 position;\nvoid main() { gl_Position = vec4(position, 0.0, 1.0); }\n";
+
+function inputFor(pass, channel) {
+  return pass.inputs.find(function (input) { return input.channel === channel; });
+}
+
+function samplerType(input) {
+  if (input && input.type === "cubemap") return "samplerCube";
+  if (input && input.type === "volume") return "sampler3D";
+  return "sampler2D";
+}
+
+function fragmentSource(pass) {
+  const lines = [
+    "#version 300 es",
+    "precision highp float;",
+    "precision highp int;",
+    "precision mediump sampler3D;",
+    "#define HW_PERFORMANCE 1",
+    "uniform vec3  iResolution;",
+    "uniform float iTime;",
+    "uniform float iTimeDelta;",
+    "uniform float iFrameRate;",
+    "uniform int   iFrame;",
+    "uniform float iChannelTime[4];",
+    "uniform vec3  iChannelResolution[4];",
+    "uniform vec4  iMouse;",
+    "uniform vec4  iDate;",
+    "uniform float iSampleRate;"
+  ];
+  for (let i = 0; i < 4; i++) {
+    lines.push("uniform " + samplerType(inputFor(pass, i)) + " iChannel" + i + ";");
+  }
+  lines.push("out vec4 fragColor;");
+  return lines.join("\n") + "\n" + shader.common + "\n" + pass.code +
+    "\nvoid main(void)\n{\n    mainImage(fragColor, gl_FragCoord.xy);\n}\n";
+}
+
+function compile(type, source, name) {
+  const s = gl.createShader(type);
+  gl.shaderSource(s, source);
+  gl.compileShader(s);
+  if (!gl.getShaderParameter(s, gl.COMPILE_STATUS)) {
+    fail("Failed to compile " + name + ":\n" + gl.getShaderInfoLog(s));
+  }
+  return s;
+}
+
+function link(source, name) {
+  const program = gl.createProgram();
+  gl.attachShader(program, compile(gl.VERTEX_SHADER, vertexSource, name));
+  gl.attachShader(program, compile(gl.FRAGMENT_SHADER, source, name));
+  gl.bindAttribLocation(program, 0, "position");
+  gl.linkProgram(program);
+  if (!gl.getProgramParameter(program, gl.LINK_STATUS)) {
+    fail("Failed to link " + name + ":\n" + gl.getProgramInfoLog(program));
+  }
+  return program;
+}
+
+const uniformNames = ["iResolution", "iTime", "iTimeDelta", "iFrameRate", "iFrame",
+  "iChannelTime", "iChannelResolution", "iMouse", "iDate", "iSampleRate"];
+
+const passes = shader.passes.map(function (pass) {
+  const program = link(fragmentSource(pass), pass.name === "image" ? "Image" : "Buffer " + pass.name);
+  const uniforms = {};
+  uniformNames.forEach(function (name) { uniforms[name] = gl.getUniformLocation(program, name); });
+  const channels = [0, 1, 2, 3].map(function (i) { return gl.getUniformLocation(program, "iChannel" + i); });
+  return { name: pass.name, inputs: pass.inputs, program: program, uniforms: uniforms, channels: channels, textures: [] };
+});
+
+// A single triangle covering the viewport.
+const vao = gl.createVertexArray();
+gl.bindVertexArray(vao);
+gl.bindBuffer(gl.ARRAY_BUFFER, gl.createBuffer());
+gl.bufferData(gl.ARRAY_BUFFER, new Float32Array([-1, -1, 3, -1, -1, 3]), gl.STATIC_DRAW);
+gl.enableVertexAttribArray(0);
+gl.vertexAttribPointer(0, 2, gl.FLOAT, false, 0, 0);
+
+// ---- Inputs ----
+
+function setSampler(target, input, mipmaps) {
+  const wrap = input.wrap === "clamp" ? gl.CLAMP_TO_EDGE : gl.REPEAT;
+  let min = gl.LINEAR;
+  let mag = gl.LINEAR;
+  if (input.filter === "nearest") {
+    min = mag = gl.NEAREST;
+  } else if (input.filter === "mipmap" && mipmaps) {
+    min = gl.LINEAR_MIPMAP_LINEAR;
+  }
+  gl.texParameteri(target, gl.TEXTURE_MIN_FILTER, min);
+  gl.texParameteri(target, gl.TEXTURE_MAG_FILTER, mag);
+  gl.texParameteri(target, gl.TEXTURE_WRAP_S, wrap);
+  gl.texParameteri(target, gl.TEXTURE_WRAP_T, wrap);
+  if (target !== gl.TEXTURE_2D) {
+    gl.texParameteri(target, gl.TEXTURE_WRAP_R, wrap);
+  }
+}
+
+function loadImage(src) {
+  return new Promise(function (resolve, reject) {
+    const img = new Image();
+    img.onload = function () { resolve(img); };
+    img.onerror = function () { reject(new Error("could not decode image")); };
+    img.src = src;
+  });
+}
+
+async function createTexture(input) {
+  const texture = gl.createTexture();
+  if (input.type === "texture") {
+    const img = await loadImage(input.image);
+    gl.bindTexture(gl.TEXTURE_2D, texture);
+    gl.pixelStorei(gl.UNPACK_FLIP_Y_WEBGL, input.vflip);
+    gl.texImage2D(gl.TEXTURE_2D, 0, gl.RGBA, gl.RGBA, gl.UNSIGNED_BYTE, img);
+    gl.pixelStorei(gl.UNPACK_FLIP_Y_WEBGL, false);
+    if (input.filter === "mipmap") gl.generateMipmap(gl.TEXTURE_2D);
+    setSampler(gl.TEXTURE_2D, input, true);
+    return { target: gl.TEXTURE_2D, texture: texture, size: [img.width, img.height, 1] };
+  }
+  if (input.type === "cubemap") {
+    const faces = await Promise.all(input.faces.map(loadImage));
+    gl.bindTexture(gl.TEXTURE_CUBE_MAP, texture);
+    gl.pixelStorei(gl.UNPACK_FLIP_Y_WEBGL, input.vflip);
+    faces.forEach(function (img, i) {
+      gl.texImage2D(gl.TEXTURE_CUBE_MAP_POSITIVE_X + i, 0, gl.RGBA, gl.RGBA, gl.UNSIGNED_BYTE, img);
+    });
+    gl.pixelStorei(gl.UNPACK_FLIP_Y_WEBGL, false);
+    if (input.filter === "mipmap") gl.generateMipmap(gl.TEXTURE_CUBE_MAP);
+    setSampler(gl.TEXTURE_CUBE_MAP, input, true);
+    return { target: gl.TEXTURE_CUBE_MAP, texture: texture, size: [faces[0].width, faces[0].height, 1] };
+  }
+  if (input.type === "volume") {
+    const v = input.volume;
+    const bytes = Uint8Array.from(atob(v.data), function (c) { return c.charCodeAt(0); });
+    const isFloat = v.format === 10;
+    const formats = isFloat
+      ? [[gl.R32F, gl.RED], [gl.RG32F, gl.RG], [gl.RGB32F, gl.RGB], [gl.RGBA32F, gl.RGBA]]
+      : [[gl.R8, gl.RED], [gl.RG8, gl.RG], [gl.RGB8, gl.RGB], [gl.RGBA8, gl.RGBA]];
+    const format = formats[v.channels - 1];
+    gl.bindTexture(gl.TEXTURE_3D, texture);
+    gl.pixelStorei(gl.UNPACK_ALIGNMENT, 1);
+    gl.texImage3D(gl.TEXTURE_3D, 0, format[0], v.width, v.height, v.depth, 0, format[1],
+      isFloat ? gl.FLOAT : gl.UNSIGNED_BYTE, isFloat ? new Float32Array(bytes.buffer) : bytes);
+    gl.pixelStorei(gl.UNPACK_ALIGNMENT, 4);
+    if (input.filter === "mipmap" && !isFloat) gl.generateMipmap(gl.TEXTURE_3D);
+    setSampler(gl.TEXTURE_3D, input, !isFloat);
+    return { target: gl.TEXTURE_3D, texture: texture, size: [v.width, v.height, v.depth] };
+  }
+  return null;
+}
+
+// Music and microphone inputs are 512x2 textures: the spectrum in the first
+// row and the waveform in the second, as on Shadertoy.
+const audioInputs = [];
+let audioContext = null;
+
+function createAudioTexture(input) {
+  const texture = gl.createTexture();
+  gl.bindTexture(gl.TEXTURE_2D, texture);
+  gl.texImage2D(gl.TEXTURE_2D, 0, gl.R8, 512, 2, 0, gl.RED, gl.UNSIGNED_BYTE, null);
+  setSampler(gl.TEXTURE_2D, input, false);
+  const entry = { target: gl.TEXTURE_2D, texture: texture, size: [512, 2, 1], input: input,
+                  analyser: null, element: null, data: new Uint8Array(1024) };
+  audioInputs.push(entry);
+  return entry;
+}
+
+// Browsers only allow audio after a user gesture, so it starts on the first click.
+function startAudio() {
+  if (audioContext || audioInputs.length === 0) return;
+  audioContext = new AudioContext();
+  audioInputs.forEach(function (entry) {
+    const analyser = audioContext.createAnalyser();
+    analyser.fftSize = 1024;
+    analyser.smoothingTimeConstant = 0.8;
+    if (entry.input.type === "music") {
+      entry.element = new Audio(entry.input.audio);
+      entry.element.loop = true;
+      audioContext.createMediaElementSource(entry.element).connect(analyser);
+      analyser.connect(audioContext.destination);
+      entry.element.play();
+    } else {
+      navigator.mediaDevices.getUserMedia({ audio: true }).then(function (stream) {
+        audioContext.createMediaStreamSource(stream).connect(analyser);
+      }).catch(function (err) {
+        console.warn("Microphone unavailable:", err);
+      });
+    }
+    entry.analyser = analyser;
+  });
+  info.textContent = shader.title;
+}
+
+function updateAudio() {
+  audioInputs.forEach(function (entry) {
+    if (!entry.analyser) return;
+    entry.analyser.getByteFrequencyData(entry.data.subarray(0, 512));
+    entry.analyser.getByteTimeDomainData(entry.data.subarray(512));
+    gl.bindTexture(gl.TEXTURE_2D, entry.texture);
+    gl.texSubImage2D(gl.TEXTURE_2D, 0, 0, 0, 512, 2, gl.RED, gl.UNSIGNED_BYTE, entry.data);
+  });
+}
+
+// ---- Buffers ----
+
+// Each buffer pass renders into one of two textures and reads the other, so it
+// can sample its own previous frame.
+const buffers = {};
+
+function createBuffers(width, height) {
+  passes.forEach(function (pass) {
+    if (pass.name === "image") return;
+    const old = buffers[pass.name];
+    if (old) {
+      old.targets.forEach(function (t) {
+        gl.deleteTexture(t.texture);
+        gl.deleteFramebuffer(t.framebuffer);
+      });
+    }
+    const targets = [0, 1].map(function () {
+      const texture = gl.createTexture();
+      gl.bindTexture(gl.TEXTURE_2D, texture);
+      gl.texImage2D(gl.TEXTURE_2D, 0, floatBuffers ? gl.RGBA16F : gl.RGBA8, width, height, 0,
+        gl.RGBA, floatBuffers ? gl.HALF_FLOAT : gl.UNSIGNED_BYTE, null);
+      setSampler(gl.TEXTURE_2D, { filter: "linear", wrap: "clamp" }, false);
+      const framebuffer = gl.createFramebuffer();
+      gl.bindFramebuffer(gl.FRAMEBUFFER, framebuffer);
+      gl.framebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, texture, 0);
+      gl.clearColor(0, 0, 0, 0);
+      gl.clear(gl.COLOR_BUFFER_BIT);
+      return { texture: texture, framebuffer: framebuffer };
+    });
+    buffers[pass.name] = { targets: targets, read: 0 };
+  });
+  gl.bindFramebuffer(gl.FRAMEBUFFER, null);
+}
+
+function resize() {
+  const dpr = window.devicePixelRatio || 1;
+  const width = Math.max(1, Math.floor(canvas.clientWidth * dpr));
+  const height = Math.max(1, Math.floor(canvas.clientHeight * dpr));
+  if (width === canvas.width && height === canvas.height && Object.keys(buffers).length > 0) return;
+  canvas.width = width;
+  canvas.height = height;
+  createBuffers(width, height);
+}
+
+// ---- Mouse ----
+
+// iMouse follows Shadertoy: xy is the position while the button is down, zw
+// the click position; z is negative once released and w only positive on the
+// frame of the click.
+const mouse = [0, 0, 0, 0];
+let mouseDown = false;
+
+function mousePosition(e) {
+  const r = canvas.getBoundingClientRect();
+  return [(e.clientX - r.left) * canvas.width / r.width, (r.bottom - e.clientY) * canvas.height / r.height];
+}
+
+canvas.addEventListener("mousedown", function (e) {
+  const p = mousePosition(e);
+  mouse[0] = mouse[2] = p[0];
+  mouse[1] = mouse[3] = p[1];
+  mouseDown = true;
+  startAudio();
+});
+window.addEventListener("mousemove", function (e) {
+  if (!mouseDown) return;
+  const p = mousePosition(e);
+  mouse[0] = p[0];
+  mouse[1] = p[1];
+});
+window.addEventListener("mouseup", function () {
+  mouseDown = false;
+  mouse[2] = -Math.abs(mouse[2]);
+  mouse[3] = -Math.abs(mouse[3]);
+});
+
+// ---- Rendering ----
+
+let startTime = null;
+let lastTime = 0;
+let frameCount = 0;
+
+function bindChannels(pass, channelTime, channelResolution) {
+  for (let i = 0; i < 4; i++) {
+    gl.activeTexture(gl.TEXTURE0 + i);
+    gl.bindTexture(gl.TEXTURE_2D, null);
+    gl.bindTexture(gl.TEXTURE_CUBE_MAP, null);
+    gl.bindTexture(gl.TEXTURE_3D, null);
+    gl.uniform1i(pass.channels[i], i);
+
+    const input = inputFor(pass, i);
+    let tex = pass.textures[i];
+    if (input && input.type === "buffer") {
+      const buffer = buffers[input.buffer];
+      tex = buffer ? { target: gl.TEXTURE_2D, texture: buffer.targets[buffer.read].texture,
+                       size: [canvas.width, canvas.height, 1] } : null;
+    }
+    if (!tex) continue;
+    gl.bindTexture(tex.target, tex.texture);
+    if (input.type === "buffer") setSampler(gl.TEXTURE_2D, input, false);
+    channelResolution.set(tex.size, i * 3);
+    if (tex.element) channelTime[i] = tex.element.currentTime;
+  }
+}
+
+function frame(now) {
+  resize();
+  updateAudio();
+
+  now /= 1000;
+  if (startTime === null) startTime = now;
+  const time = now - startTime;
+  const delta = frameCount === 0 ? 1 / 60 : time - lastTime;
+  lastTime = time;
+  const date = new Date();
+  const seconds = date.getHours() * 3600 + date.getMinutes() * 60 + date.getSeconds() + date.getMilliseconds() / 1000;
+
+  passes.forEach(function (pass) {
+    const buffer = buffers[pass.name];
+    gl.bindFramebuffer(gl.FRAMEBUFFER, buffer ? buffer.targets[1 - buffer.read].framebuffer : null);
+    gl.viewport(0, 0, canvas.width, canvas.height);
+    gl.useProgram(pass.program);
+
+    const channelTime = new Float32Array(4);
+    const channelResolution = new Float32Array(12);
+    bindChannels(pass, channelTime, channelResolution);
+
+    const u = pass.uniforms;
+    gl.uniform3f(u.iResolution, canvas.width, canvas.height, 1);
+    gl.uniform1f(u.iTime, time);
+    gl.uniform1f(u.iTimeDelta, delta);
+    gl.uniform1f(u.iFrameRate, delta > 0 ? 1 / delta : 60);
+    gl.uniform1i(u.iFrame, frameCount);
+    gl.uniform1fv(u.iChannelTime, channelTime);
+    gl.uniform3fv(u.iChannelResolution, channelResolution);
+    gl.uniform4fv(u.iMouse, mouse);
+    gl.uniform4f(u.iDate, date.getFullYear(), date.getMonth(), date.getDate(), seconds);
+    gl.uniform1f(u.iSampleRate, audioContext ? audioContext.sampleRate : 44100);
+
+    gl.drawArrays(gl.TRIANGLES, 0, 3);
+    if (buffer) buffer.read = 1 - buffer.read;
+  });
+
+  mouse[3] = -Math.abs(mouse[3]);
+  frameCount++;
+  requestAnimationFrame(frame);
+}
+
+async function init() {
+  for (const pass of passes) {
+    for (const input of pass.inputs) {
+      if (input.type === "music" || input.type === "mic") {
+        pass.textures[input.channel] = createAudioTexture(input);
+      } else if (input.type !== "buffer") {
+        pass.textures[input.channel] = await createTexture(input);
+      }
+    }
+  }
+  if (audioInputs.length > 0) {
+    info.textContent = shader.title + " — click to start audio";
+  }
+  requestAnimationFrame(frame);
+}
+
+init().catch(function (err) { fail("Failed to load inputs: " + err.message); });
+</script>
+</body>
+</html>
+`
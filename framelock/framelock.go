@@ -0,0 +1,65 @@
+// Package framelock keeps goshadertoy instances on several machines, e.g. the
+// projectors of a video wall, rendering the same frame at the same moment.
+//
+// One master decides the number and time of every frame and sends them to
+// the slaves over UDP. Each slave renders that frame and reports it ready; once
+// every slave has, the master tells them all to show it, and shows it itself.
+// An instance that hears nothing for Timeout goes ahead on its own, so a lost
+// packet or machine stalls the wall for a moment rather than for good.
+//
+// Every packet is the magic "GSFL", a message type byte, the frame number as
+// a big-endian uint64 and the frame time as a big-endian float64.
+package framelock
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// Timeout is how long an instance waits for the others before going ahead.
+const Timeout = 100 * time.Millisecond
+
+const (
+	magic      = "GSFL"
+	packetSize = len(magic) + 1 + 8 + 8
+)
+
+// Message types.
+const (
+	msgHello byte = iota + 1 // Slave to master: add me
+	msgFrame                 // Master to slaves: render this frame at this time
+	msgReady                 // Slave to master: I have rendered the frame
+	msgShow                  // Master to slaves: show the frame
+)
+
+type packet struct {
+	kind  byte
+	frame int64
+	time  float64
+}
+
+// timeout returns a channel receiving after Timeout.
+func timeout() <-chan time.Time {
+	return time.After(Timeout)
+}
+
+func (p packet) marshal() []byte {
+	b := make([]byte, packetSize)
+	copy(b, magic)
+	b[4] = p.kind
+	binary.BigEndian.PutUint64(b[5:], uint64(p.frame))
+	binary.BigEndian.PutUint64(b[13:], math.Float64bits(p.time))
+	return b
+}
+
+func parsePacket(b []byte) (packet, bool) {
+	if len(b) != packetSize || string(b[:4]) != magic {
+		return packet{}, false
+	}
+	return packet{
+		kind:  b[4],
+		frame: int64(binary.BigEndian.Uint64(b[5:])),
+		time:  math.Float64frombits(binary.BigEndian.Uint64(b[13:])),
+	}, true
+}
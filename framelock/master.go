@@ -0,0 +1,134 @@
+package framelock
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// Master leads the frames of the slaves that contact it.
+type Master struct {
+	conn   *net.UDPConn
+	slaves int // Slaves to wait for before showing a frame
+
+	mu    sync.Mutex
+	peers map[string]*peer
+	ready chan struct{} // Signaled when a slave reports a frame ready
+
+	waiting bool // Waiting for slaves that haven't reported, logged once
+}
+
+type peer struct {
+	addr  *net.UDPAddr
+	ready int64 // Last frame the slave reported ready
+}
+
+// NewMaster listens for slaves on the UDP address addr, e.g. ":7770", and
+// waits for slaves of them to report each frame ready before showing it.
+func NewMaster(addr string, slaves int) (*Master, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid frame lock address %s: %w", addr, err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for frame lock slaves: %w", err)
+	}
+	m := &Master{
+		conn:   conn,
+		slaves: slaves,
+		peers:  make(map[string]*peer),
+		ready:  make(chan struct{}, 1),
+	}
+	go m.receive()
+	log.Printf("Frame lock master listening on %s for %d slaves", conn.LocalAddr(), slaves)
+	return m, nil
+}
+
+func (m *Master) receive() {
+	buf := make([]byte, packetSize+1)
+	for {
+		n, addr, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			return // Closed
+		}
+		p, ok := parsePacket(buf[:n])
+		if !ok || (p.kind != msgHello && p.kind != msgReady) {
+			continue
+		}
+		m.mu.Lock()
+		pr, known := m.peers[addr.String()]
+		if !known {
+			pr = &peer{addr: addr, ready: -1}
+			m.peers[addr.String()] = pr
+			log.Printf("Frame lock slave %s joined (%d of %d)", addr, len(m.peers), m.slaves)
+		}
+		if p.kind == msgReady {
+			pr.ready = max(pr.ready, p.frame)
+		}
+		m.mu.Unlock()
+		select {
+		case m.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Begin sends the number and time of the next frame to the slaves and
+// returns them.
+func (m *Master) Begin(frame int64, t float64) (int64, float64) {
+	m.send(packet{kind: msgFrame, frame: frame, time: t})
+	return frame, t
+}
+
+// Ready waits until the slaves have rendered frame, or for Timeout, and then
+// tells them to show it.
+func (m *Master) Ready(frame int64) {
+	deadline := time.NewTimer(Timeout)
+	defer deadline.Stop()
+	for !m.allReady(frame) {
+		select {
+		case <-m.ready:
+			continue
+		case <-deadline.C:
+		}
+		if !m.waiting {
+			log.Printf("Warning: frame lock slaves are missing or slow; showing frame %d without them", frame)
+			m.waiting = true
+		}
+		break
+	}
+	m.send(packet{kind: msgShow, frame: frame})
+}
+
+func (m *Master) allReady(frame int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, pr := range m.peers {
+		if pr.ready >= frame {
+			n++
+		}
+	}
+	if n >= m.slaves && m.waiting {
+		log.Printf("All %d frame lock slaves are in step again", n)
+		m.waiting = false
+	}
+	return n >= m.slaves
+}
+
+func (m *Master) send(p packet) {
+	b := p.marshal()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, pr := range m.peers {
+		m.conn.WriteToUDP(b, pr.addr)
+	}
+}
+
+// Close stops listening.
+func (m *Master) Close() error {
+	return m.conn.Close()
+}
@@ -0,0 +1,128 @@
+package framelock
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+)
+
+// Slave renders the frames its master sends.
+type Slave struct {
+	conn   *net.UDPConn
+	frames chan packet // Frames to render, newest last
+	shows  chan int64  // Frames to show
+
+	lost bool // No frame came from the master in time, logged once
+}
+
+// NewSlave contacts the master at the UDP address master, e.g.
+// "10.0.0.1:7770".
+func NewSlave(master string) (*Slave, error) {
+	addr, err := net.ResolveUDPAddr("udp", master)
+	if err != nil {
+		return nil, fmt.Errorf("invalid frame lock master %s: %w", master, err)
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach frame lock master: %w", err)
+	}
+	s := &Slave{conn: conn, frames: make(chan packet, 16), shows: make(chan int64, 16)}
+	go s.receive()
+	s.send(packet{kind: msgHello})
+	log.Printf("Frame lock slave of %s", master)
+	return s, nil
+}
+
+func (s *Slave) receive() {
+	buf := make([]byte, packetSize+1)
+	for {
+		n, err := s.conn.Read(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			continue // E.g. refused while the master isn't up yet
+		}
+		p, ok := parsePacket(buf[:n])
+		if !ok {
+			continue
+		}
+		switch p.kind {
+		case msgFrame:
+			offer(s.frames, p)
+		case msgShow:
+			offer(s.shows, p.frame)
+		}
+	}
+}
+
+// offer sends v on ch, dropping the oldest value if ch is full.
+func offer[T any](ch chan T, v T) {
+	for {
+		select {
+		case ch <- v:
+			return
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
+
+// Begin waits for the master's next frame and returns its number and time.
+// Without one within Timeout, the slave renders frame at t of its own clock
+// and asks the master to add it again, in case the master restarted.
+func (s *Slave) Begin(frame int64, t float64) (int64, float64) {
+	var p packet
+	select {
+	case p = <-s.frames:
+	case <-timeout():
+		if !s.lost {
+			log.Println("Warning: no frames from the frame lock master; running freely")
+			s.lost = true
+		}
+		s.send(packet{kind: msgHello})
+		return frame, t
+	}
+	// A slave that fell behind skips to the newest frame.
+	for drained := false; !drained; {
+		select {
+		case p = <-s.frames:
+		default:
+			drained = true
+		}
+	}
+	if s.lost {
+		log.Printf("Frame lock master is back at frame %d", p.frame)
+		s.lost = false
+	}
+	return p.frame, p.time
+}
+
+// Ready reports frame rendered and waits until the master shows it, or for
+// Timeout.
+func (s *Slave) Ready(frame int64) {
+	s.send(packet{kind: msgReady, frame: frame})
+	deadline := timeout()
+	for {
+		select {
+		case shown := <-s.shows:
+			if shown >= frame {
+				return
+			}
+		case <-deadline:
+			return
+		}
+	}
+}
+
+func (s *Slave) send(p packet) {
+	s.conn.Write(p.marshal())
+}
+
+// Close stops following the master.
+func (s *Slave) Close() error {
+	return s.conn.Close()
+}
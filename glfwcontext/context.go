@@ -2,22 +2,42 @@ package glfwcontext
 
 import (
 	"log"
+	"math"
 	"runtime"
+	"strings"
 
 	glfw "github.com/go-gl/glfw/v3.3/glfw"
+	evdev "github.com/richinsley/goshadertoy/evdev"
+	graphics "github.com/richinsley/goshadertoy/graphics"
 	options "github.com/richinsley/goshadertoy/options"
 )
 
 // Context now tracks mouse state for the GetMouseInput method.
 type Context struct {
-	window          *glfw.Window
-	lastMouseClickX float64
-	lastMouseClickY float64
-	mouseWasDown    bool
+	window *glfw.Window
+	mouse  graphics.MouseState
+	keys   graphics.KeyboardState // For keyboard channels
 	// A map to store functions to be called on key presses.
 	keyCallbacks map[glfw.Key]func()
+	// Screensaver windows close on any input.
+	screensaver    bool
+	cursorStartSet bool
+	cursorStartX   float64
+	cursorStartY   float64
+	// Fullscreen state toggled with F11. Spanning windows don't toggle.
+	spanning      bool
+	fullscreen    bool
+	monitor       *glfw.Monitor // Monitor for fullscreen; nil uses the one under the window
+	exclusiveMode *glfw.VidMode // Video mode for exclusive fullscreen; nil for borderless
+	windowed      [4]int        // Position and size restored when leaving fullscreen
+	// Input read straight from the devices when the window gets none.
+	evdev *evdev.Reader
 }
 
+// screensaverCursorSlack is how far in pixels the cursor may drift before a
+// screensaver window closes, so sensor jitter doesn't end it.
+const screensaverCursorSlack = 10
+
 // New creates and initializes a new GLFW window and returns a Context object.
 // func New(width, height int, visible bool, share interface{}) (*Context, error) {
 func New(options *options.ShaderOptions, visible bool, share interface{}) (*Context, error) {
@@ -26,8 +46,16 @@ func New(options *options.ShaderOptions, visible bool, share interface{}) (*Cont
 	glfw.WindowHint(glfw.ContextVersionMinor, 1)
 	glfw.WindowHint(glfw.OpenGLProfile, glfw.OpenGLCoreProfile)
 	glfw.WindowHint(glfw.OpenGLForwardCompatible, glfw.True)
-
-	if *options.BitDepth > 8 {
+	// Lose the context on a GPU reset, where the driver supports telling.
+	glfw.WindowHint(glfw.ContextRobustness, glfw.LoseContextOnReset)
+
+	if options.HDROutput != nil && *options.HDROutput == "pq" {
+		// HDR10 framebuffer
+		glfw.WindowHint(glfw.RedBits, 10)
+		glfw.WindowHint(glfw.GreenBits, 10)
+		glfw.WindowHint(glfw.BlueBits, 10)
+		glfw.WindowHint(glfw.AlphaBits, 2)
+	} else if *options.BitDepth > 8 {
 		glfw.WindowHint(glfw.RedBits, 16)
 		glfw.WindowHint(glfw.GreenBits, 16)
 		glfw.WindowHint(glfw.BlueBits, 16)
@@ -35,28 +63,272 @@ func New(options *options.ShaderOptions, visible bool, share interface{}) (*Cont
 		// glfw.WindowHint(glfw.ContextCreationAPI, glfw.EGLContextAPI)
 	}
 
-	if visible {
+	screensaver := visible && options.Screensaver != nil && *options.Screensaver
+	span := visible && (screensaver || (options.Span != nil && *options.Span))
+	monitorSpec := ""
+	if visible && options.Monitor != nil {
+		monitorSpec = *options.Monitor
+	}
+
+	fullscreenFlag := visible && options.Fullscreen != nil && *options.Fullscreen
+	borderless := visible && options.Borderless != nil && *options.Borderless
+	videoModeSpec := ""
+	if options.VideoMode != nil {
+		videoModeSpec = *options.VideoMode
+	}
+	if isWayland && visible {
+		// Wayland clients can't place windows, so spanning and borderless
+		// windows become compositor fullscreen on one monitor, which also
+		// keeps the screen from blanking. Nor can they change video modes.
+		if span {
+			if strings.Contains(monitorSpec, ",") || (monitorSpec == "" && len(glfw.GetMonitors()) > 1) {
+				log.Println("Warning: Wayland windows can't span monitors, using fullscreen on the first")
+			}
+			monitorSpec, _, _ = strings.Cut(monitorSpec, ",")
+		}
+		if span || borderless {
+			span, borderless, fullscreenFlag = false, false, true
+		}
+		if videoModeSpec != "" {
+			log.Printf("Warning: Wayland can't change video modes, ignoring -video-mode %s", videoModeSpec)
+			videoModeSpec = ""
+		}
+	}
+
+	width, height := *options.Width, *options.Height
+	var x, y int
+	var fullscreen, monitor *glfw.Monitor
+	var exclusiveMode *glfw.VidMode
+	switch {
+	case span:
+		// A borderless window over the bounding box of the monitors, so
+		// iResolution is the size of the whole wall.
+		monitors, err := selectMonitors(monitorSpec)
+		if err != nil {
+			return nil, err
+		}
+		x, y, width, height = monitorsBounds(monitors)
+		glfw.WindowHint(glfw.Decorated, glfw.False)
+		glfw.WindowHint(glfw.AutoIconify, glfw.False)
+		if screensaver {
+			glfw.WindowHint(glfw.Floating, glfw.True)
+		}
+	case borderless:
+		// Windowed fullscreen: a borderless window covering the monitor,
+		// without changing its video mode.
+		m, err := selectMonitor(monitorSpec)
+		if err != nil {
+			return nil, err
+		}
+		monitor = m
+		mode := m.GetVideoMode()
+		x, y = m.GetPos()
+		width, height = mode.Width, mode.Height
+		glfw.WindowHint(glfw.Decorated, glfw.False)
+		glfw.WindowHint(glfw.AutoIconify, glfw.False)
+		glfw.WindowHint(glfw.Resizable, glfw.True) // For when F11 returns it to a window
+	case fullscreenFlag || monitorSpec != "":
+		// Exclusive fullscreen, in the -video-mode or else the current mode.
+		m, err := selectMonitor(monitorSpec)
+		if err != nil {
+			return nil, err
+		}
+		mode, err := chooseVideoMode(m, videoModeSpec)
+		if err != nil {
+			return nil, err
+		}
+		fullscreen, monitor, exclusiveMode = m, m, mode
+		width, height = mode.Width, mode.Height
+		glfw.WindowHint(glfw.RefreshRate, mode.RefreshRate)
+	case visible:
 		glfw.WindowHint(glfw.Resizable, glfw.True)
-	} else {
+		width, height = windowSize(width, height)
+	default:
 		glfw.WindowHint(glfw.Visible, glfw.False)
 	}
 
-	win, err := glfw.CreateWindow(*options.Width, *options.Height, "goshadertoy", nil, sharecontext)
+	win, err := glfw.CreateWindow(width, height, "goshadertoy", fullscreen, sharecontext)
 	if err != nil {
 		return nil, err
 	}
 
 	c := &Context{
-		window:       win,
-		keyCallbacks: make(map[glfw.Key]func()),
+		window:        win,
+		keyCallbacks:  make(map[glfw.Key]func()),
+		screensaver:   screensaver,
+		spanning:      span,
+		fullscreen:    monitor != nil,
+		monitor:       monitor,
+		exclusiveMode: exclusiveMode,
+	}
+	if videoModeSpec != "" && exclusiveMode == nil && visible && !span {
+		// F11 switches to the requested mode.
+		if m, err := selectMonitor(monitorSpec); err == nil {
+			if mode, err := chooseVideoMode(m, videoModeSpec); err == nil {
+				c.monitor, c.exclusiveMode = m, mode
+			}
+		}
+	}
+
+	switch {
+	case span:
+		win.SetPos(x, y)
+		log.Printf("Spanning %dx%d window at (%d, %d)", width, height, x, y)
+	case borderless:
+		win.SetPos(x, y)
+		log.Printf("Borderless %dx%d window on monitor '%s'", width, height, monitor.GetName())
+	case fullscreen != nil:
+		log.Printf("Fullscreen %dx%d@%dHz on monitor '%s'", width, height, exclusiveMode.RefreshRate, fullscreen.GetName())
+	}
+	if c.fullscreen {
+		// Leaving fullscreen restores a -width x -height window centered on the monitor.
+		mx, my := monitor.GetPos()
+		mode := monitor.GetVideoMode()
+		w, h := windowSize(*options.Width, *options.Height)
+		c.windowed = [4]int{mx + (mode.Width-w)/2, my + (mode.Height-h)/2, w, h}
+	}
+	if isWayland && visible {
+		fw, fh := win.GetFramebufferSize()
+		sx, _ := win.GetContentScale()
+		log.Printf("Wayland window, content scale %.2f, framebuffer %dx%d", sx, fw, fh)
+		// The framebuffer, and so iResolution, follows the scale of the output
+		// the window is on. GLFW rounds fractional scales up and the
+		// compositor scales the buffer down.
+		win.SetContentScaleCallback(func(w *glfw.Window, x, y float32) {
+			fw, fh := w.GetFramebufferSize()
+			log.Printf("Content scale changed to %.2f, framebuffer %dx%d", x, fw, fh)
+		})
 	}
 
 	// Set the key callback for the window to be the method on our new context instance.
 	win.SetKeyCallback(c.glfwKeyCallback)
+	// A click that starts and ends between two frames still registers as a
+	// click on the next one.
+	win.SetInputMode(glfw.StickyMouseButtonsMode, glfw.True)
+
+	if visible && options.Evdev != nil && *options.Evdev != "" {
+		if r, err := evdev.Open(*options.Evdev); err != nil {
+			log.Printf("Warning: %v", err)
+		} else {
+			c.evdev = r
+		}
+	}
+
+	if screensaver {
+		win.SetInputMode(glfw.CursorMode, glfw.CursorHidden)
+		win.SetMouseButtonCallback(func(w *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
+			w.SetShouldClose(true)
+		})
+		win.SetScrollCallback(func(w *glfw.Window, xoff, yoff float64) {
+			w.SetShouldClose(true)
+		})
+		win.SetCursorPosCallback(c.screensaverCursorCallback)
+	}
 
 	return c, nil
 }
 
+// screensaverCursorCallback closes a screensaver window once the cursor
+// moves away from where it was first seen.
+func (c *Context) screensaverCursorCallback(w *glfw.Window, xpos, ypos float64) {
+	if !c.cursorStartSet {
+		c.cursorStartX, c.cursorStartY = xpos, ypos
+		c.cursorStartSet = true
+		return
+	}
+	if math.Abs(xpos-c.cursorStartX) > screensaverCursorSlack || math.Abs(ypos-c.cursorStartY) > screensaverCursorSlack {
+		w.SetShouldClose(true)
+	}
+}
+
+// toggleFullscreen switches between a window and fullscreen: exclusive in the
+// -video-mode when one was chosen, otherwise borderless on the monitor under
+// the window.
+func (c *Context) toggleFullscreen() {
+	if c.spanning {
+		return
+	}
+	if c.fullscreen {
+		x, y, w, h := c.windowed[0], c.windowed[1], c.windowed[2], c.windowed[3]
+		c.window.SetMonitor(nil, x, y, w, h, 0)
+		c.window.SetAttrib(glfw.Decorated, glfw.True)
+		c.fullscreen = false
+		log.Printf("Windowed %dx%d", w, h)
+		return
+	}
+
+	var x, y int
+	if !isWayland {
+		x, y = c.window.GetPos()
+	}
+	w, h := c.window.GetSize()
+	c.windowed = [4]int{x, y, w, h}
+	m := c.monitor
+	if m == nil && isWayland {
+		m = glfw.GetPrimaryMonitor()
+	} else if m == nil {
+		m = monitorAt(x+w/2, y+h/2)
+	}
+	if c.exclusiveMode != nil || isWayland {
+		// A Wayland compositor's fullscreen keeps the current video mode.
+		mode := c.exclusiveMode
+		if mode == nil {
+			mode = m.GetVideoMode()
+		}
+		c.window.SetMonitor(m, 0, 0, mode.Width, mode.Height, mode.RefreshRate)
+		log.Printf("Fullscreen %dx%d@%dHz on monitor '%s'", mode.Width, mode.Height, mode.RefreshRate, m.GetName())
+	} else {
+		mode := m.GetVideoMode()
+		mx, my := m.GetPos()
+		c.window.SetAttrib(glfw.Decorated, glfw.False)
+		c.window.SetMonitor(nil, mx, my, mode.Width, mode.Height, 0)
+		log.Printf("Borderless %dx%d on monitor '%s'", mode.Width, mode.Height, m.GetName())
+	}
+	c.fullscreen = true
+}
+
+// windowSize returns the window size that gives a framebuffer of width x
+// height pixels. Wayland sizes windows in units of the content scale.
+func windowSize(width, height int) (int, int) {
+	if !isWayland {
+		return width, height
+	}
+	m := glfw.GetPrimaryMonitor()
+	if m == nil {
+		return width, height
+	}
+	sx, sy := m.GetContentScale()
+	if sx <= 0 || sy <= 0 {
+		return width, height
+	}
+	return int(math.Round(float64(width) / float64(sx))), int(math.Round(float64(height) / float64(sy)))
+}
+
+// SetVSync sets the swap interval of the context, which must be current:
+// "on" waits for every vertical blank, "off" never waits, and "adaptive"
+// waits unless the frame is late, falling back to "on" where the driver lacks
+// swap control tear.
+func (c *Context) SetVSync(mode string) {
+	switch mode {
+	case "off":
+		glfw.SwapInterval(0)
+	case "adaptive":
+		if glfw.ExtensionSupported("GLX_EXT_swap_control_tear") || glfw.ExtensionSupported("WGL_EXT_swap_control_tear") {
+			glfw.SwapInterval(-1)
+		} else {
+			log.Println("Warning: adaptive vsync is not supported by the driver, using vsync on")
+			glfw.SwapInterval(1)
+		}
+	default:
+		glfw.SwapInterval(1)
+	}
+}
+
+// SetTitle sets the window title.
+func (c *Context) SetTitle(title string) {
+	c.window.SetTitle(title)
+}
+
 // RegisterKeyCallback allows the main application to register a function to be
 // called when a specific key is pressed.
 func (c *Context) RegisterKeyCallback(key glfw.Key, f func()) {
@@ -66,10 +338,22 @@ func (c *Context) RegisterKeyCallback(key glfw.Key, f func()) {
 // glfwKeyCallback is the function that will be called by GLFW on a key event.
 // It now dispatches to our registered custom callbacks.
 func (c *Context) glfwKeyCallback(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
-	// Handle the default Escape key behavior
-	if key == glfw.KeyEscape && action == glfw.Press {
+	// Handle the default Escape key behavior; a screensaver closes on any key.
+	if (key == glfw.KeyEscape || c.screensaver) && action == glfw.Press {
 		w.SetShouldClose(true)
 	}
+	if key == glfw.KeyF11 && action == glfw.Press && !c.screensaver {
+		c.toggleFullscreen()
+	}
+
+	if code, ok := jsKeyCodes[key]; ok {
+		switch action {
+		case glfw.Press:
+			c.keys.Press(code)
+		case glfw.Release:
+			c.keys.Release(code)
+		}
+	}
 
 	// If a key is pressed and we have a callback for it, run it.
 	if action == glfw.Press {
@@ -102,6 +386,24 @@ func (c *Context) GetMouseInput() [4]float32 {
 		return mouseData
 	}
 
+	fbWidth, fbHeight := c.GetFramebufferSize()
+	pixelX, pixelY := c.cursorPixels()
+
+	const mouseLeft = 0
+	isMouseDown := c.window.GetMouseButton(mouseLeft) == glfw.Press
+	if c.evdev != nil {
+		c.evdev.SetBounds(fbWidth, fbHeight)
+		var down bool
+		pixelX, pixelY, down = c.evdev.Pointer()
+		isMouseDown = isMouseDown || down
+	}
+
+	return c.mouse.Update(pixelX, float64(fbHeight)-pixelY, isMouseDown)
+}
+
+// cursorPixels returns the cursor position in framebuffer pixels from the top
+// left.
+func (c *Context) cursorPixels() (float64, float64) {
 	fbWidth, fbHeight := c.GetFramebufferSize()
 	winWidth, winHeight := c.window.GetSize()
 	var scaleX, scaleY float64 = 1.0, 1.0
@@ -109,32 +411,52 @@ func (c *Context) GetMouseInput() [4]float32 {
 		scaleX = float64(fbWidth) / float64(winWidth)
 		scaleY = float64(fbHeight) / float64(winHeight)
 	}
-
 	cursorX, cursorY := c.window.GetCursorPos()
-	pixelX := cursorX * scaleX
-	pixelY := cursorY * scaleY
-
-	mouseX := float32(pixelX)
-	mouseY := float32(fbHeight) - float32(pixelY)
+	return cursorX * scaleX, cursorY * scaleY
+}
 
-	const mouseLeft = 0
-	isMouseDown := c.window.GetMouseButton(mouseLeft) == glfw.Press
-	if isMouseDown && !c.mouseWasDown {
-		c.lastMouseClickX = pixelX
-		c.lastMouseClickY = pixelY
+// SetViewCallbacks routes view gestures, which shaders don't see: zoom gets
+// the scroll wheel steps and the cursor position, pan the motion of drags with
+// the right mouse button. Positions are in framebuffer pixels from the bottom
+// left. A screensaver window keeps closing on these gestures instead.
+func (c *Context) SetViewCallbacks(zoom func(steps, x, y float64), pan func(dx, dy float64)) {
+	if c.screensaver {
+		return
 	}
-	c.mouseWasDown = isMouseDown
-
-	clickX := float32(c.lastMouseClickX)
-	clickY := float32(fbHeight) - float32(c.lastMouseClickY)
-
-	if !isMouseDown {
-		clickX = -clickX
-		clickY = -clickY
+	cursor := func() (float64, float64) {
+		_, fbHeight := c.GetFramebufferSize()
+		x, y := c.cursorPixels()
+		return x, float64(fbHeight) - y
 	}
+	c.window.SetScrollCallback(func(w *glfw.Window, xoff, yoff float64) {
+		x, y := cursor()
+		zoom(yoff, x, y)
+	})
+
+	dragging := false
+	var lastX, lastY float64
+	c.window.SetMouseButtonCallback(func(w *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
+		if button == glfw.MouseButtonRight {
+			dragging = action == glfw.Press
+			lastX, lastY = cursor()
+		}
+	})
+	c.window.SetCursorPosCallback(func(w *glfw.Window, xpos, ypos float64) {
+		if !dragging {
+			return
+		}
+		x, y := cursor()
+		pan(x-lastX, y-lastY)
+		lastX, lastY = x, y
+	})
+}
 
-	mouseData = [4]float32{mouseX, mouseY, clickX, clickY}
-	return mouseData
+// GetKeyboardInput returns the keyboard for a frame: the keys held now and
+// those pressed since it was last called.
+func (c *Context) GetKeyboardInput() *graphics.KeyboardState {
+	keys := c.keys
+	c.keys.NextFrame()
+	return &keys
 }
 
 // MakeCurrent makes the context current for the calling goroutine.
@@ -144,6 +466,9 @@ func (c *Context) MakeCurrent() {
 
 // Shutdown now only destroys the window.
 func (c *Context) Shutdown() {
+	if c.evdev != nil {
+		c.evdev.Close()
+	}
 	c.window.Destroy()
 }
 
@@ -154,6 +479,18 @@ func (c *Context) ShouldClose() bool {
 func (c *Context) EndFrame() {
 	c.window.SwapBuffers()
 	glfw.PollEvents()
+	if c.evdev != nil {
+		// Dispatched like the window's own key events, on this thread.
+		for _, ev := range c.evdev.KeyEvents() {
+			if key, ok := evdevKeys[ev.Code]; ok {
+				action := glfw.Release
+				if ev.Down {
+					action = glfw.Press
+				}
+				c.glfwKeyCallback(c.window, key, 0, action, 0)
+			}
+		}
+	}
 }
 
 func (c *Context) GetFramebufferSize() (int, int) {
@@ -175,7 +512,11 @@ func InitGraphics() error {
 	if err := glfw.Init(); err != nil {
 		return err
 	}
-	log.Printf("GLFW Initialized")
+	if isWayland {
+		log.Printf("GLFW Initialized (Wayland)")
+	} else {
+		log.Printf("GLFW Initialized")
+	}
 	return nil
 }
 
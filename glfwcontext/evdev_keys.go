@@ -0,0 +1,39 @@
+package glfwcontext
+
+import glfw "github.com/go-gl/glfw/v3.3/glfw"
+
+// evdevKeys maps Linux key codes (KEY_*) to GLFW keys, for the keys read
+// from input devices with -evdev.
+var evdevKeys = func() map[uint16]glfw.Key {
+	keys := map[uint16]glfw.Key{
+		1:   glfw.KeyEscape,
+		11:  glfw.Key0,
+		14:  glfw.KeyBackspace,
+		15:  glfw.KeyTab,
+		28:  glfw.KeyEnter,
+		57:  glfw.KeySpace,
+		87:  glfw.KeyF11,
+		88:  glfw.KeyF12,
+		102: glfw.KeyHome,
+		103: glfw.KeyUp,
+		104: glfw.KeyPageUp,
+		105: glfw.KeyLeft,
+		106: glfw.KeyRight,
+		107: glfw.KeyEnd,
+		108: glfw.KeyDown,
+		109: glfw.KeyPageDown,
+	}
+	for i := uint16(0); i < 9; i++ { // KEY_1..KEY_9
+		keys[2+i] = glfw.Key1 + glfw.Key(i)
+	}
+	for i := uint16(0); i < 10; i++ { // KEY_F1..KEY_F10
+		keys[59+i] = glfw.KeyF1 + glfw.Key(i)
+	}
+	// The letter keys run in keyboard rows.
+	for first, row := range map[uint16]string{16: "QWERTYUIOP", 30: "ASDFGHJKL", 44: "ZXCVBNM"} {
+		for i, ch := range row {
+			keys[first+uint16(i)] = glfw.KeyA + glfw.Key(ch-'A')
+		}
+	}
+	return keys
+}()
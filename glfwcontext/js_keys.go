@@ -0,0 +1,62 @@
+package glfwcontext
+
+import glfw "github.com/go-gl/glfw/v3.3/glfw"
+
+// jsKeyCodes maps GLFW keys to the JavaScript key codes that index
+// Shadertoy's keyboard texture. Letters, digits and space share their codes.
+var jsKeyCodes = func() map[glfw.Key]int {
+	codes := map[glfw.Key]int{}
+	for _, kc := range []struct {
+		key  glfw.Key
+		code int
+	}{
+		{glfw.KeySpace, 32},
+		{glfw.KeyApostrophe, 222},
+		{glfw.KeyComma, 188},
+		{glfw.KeyMinus, 189},
+		{glfw.KeyPeriod, 190},
+		{glfw.KeySlash, 191},
+		{glfw.KeySemicolon, 186},
+		{glfw.KeyEqual, 187},
+		{glfw.KeyLeftBracket, 219},
+		{glfw.KeyBackslash, 220},
+		{glfw.KeyRightBracket, 221},
+		{glfw.KeyGraveAccent, 192},
+		{glfw.KeyEscape, 27},
+		{glfw.KeyEnter, 13},
+		{glfw.KeyTab, 9},
+		{glfw.KeyBackspace, 8},
+		{glfw.KeyInsert, 45},
+		{glfw.KeyDelete, 46},
+		{glfw.KeyRight, 39},
+		{glfw.KeyLeft, 37},
+		{glfw.KeyDown, 40},
+		{glfw.KeyUp, 38},
+		{glfw.KeyPageUp, 33},
+		{glfw.KeyPageDown, 34},
+		{glfw.KeyHome, 36},
+		{glfw.KeyEnd, 35},
+		{glfw.KeyLeftShift, 16},
+		{glfw.KeyRightShift, 16},
+		{glfw.KeyLeftControl, 17},
+		{glfw.KeyRightControl, 17},
+		{glfw.KeyLeftAlt, 18},
+		{glfw.KeyRightAlt, 18},
+		{glfw.KeyKPEnter, 13},
+	} {
+		codes[kc.key] = kc.code
+	}
+	for k := glfw.KeyA; k <= glfw.KeyZ; k++ {
+		codes[k] = int(k)
+	}
+	for k := glfw.Key0; k <= glfw.Key9; k++ {
+		codes[k] = int(k)
+	}
+	for i := 0; i < 12; i++ {
+		codes[glfw.KeyF1+glfw.Key(i)] = 112 + i
+	}
+	for i := 0; i < 10; i++ {
+		codes[glfw.KeyKP0+glfw.Key(i)] = 96 + i
+	}
+	return codes
+}()
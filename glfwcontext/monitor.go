@@ -0,0 +1,171 @@
+package glfwcontext
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	glfw "github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// selectMonitors returns the monitors named by spec, a comma-separated list of
+// indexes into the connected monitors (0 is the primary) or of monitor names,
+// which match case-insensitively on a prefix. An empty spec selects all
+// monitors.
+func selectMonitors(spec string) ([]*glfw.Monitor, error) {
+	monitors := glfw.GetMonitors()
+	if len(monitors) == 0 {
+		return nil, fmt.Errorf("no monitors found")
+	}
+	if spec == "" {
+		return monitors, nil
+	}
+
+	var selected []*glfw.Monitor
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		m, err := findMonitor(monitors, item)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, m)
+	}
+	return selected, nil
+}
+
+// selectMonitor returns the single monitor named by spec, or the primary
+// monitor if spec is empty.
+func selectMonitor(spec string) (*glfw.Monitor, error) {
+	if spec == "" {
+		if m := glfw.GetPrimaryMonitor(); m != nil {
+			return m, nil
+		}
+		return nil, fmt.Errorf("no monitors found")
+	}
+	monitors, err := selectMonitors(spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(monitors) != 1 {
+		return nil, fmt.Errorf("-monitor selects %d monitors; use -span to cover more than one", len(monitors))
+	}
+	return monitors[0], nil
+}
+
+// monitorAt returns the monitor containing the screen point, or the primary
+// monitor.
+func monitorAt(x, y int) *glfw.Monitor {
+	for _, m := range glfw.GetMonitors() {
+		mx, my := m.GetPos()
+		mode := m.GetVideoMode()
+		if x >= mx && x < mx+mode.Width && y >= my && y < my+mode.Height {
+			return m
+		}
+	}
+	return glfw.GetPrimaryMonitor()
+}
+
+// ParseVideoMode parses a -video-mode of the form WIDTHxHEIGHT[@HZ]. hz is 0
+// when no refresh rate is given.
+func ParseVideoMode(spec string) (width, height, hz int, err error) {
+	size, rate, hasRate := strings.Cut(strings.ToLower(spec), "@")
+	w, h, ok := strings.Cut(size, "x")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("'%s' is not WIDTHxHEIGHT[@HZ]", spec)
+	}
+	if width, err = strconv.Atoi(w); err != nil || width <= 0 {
+		return 0, 0, 0, fmt.Errorf("invalid width in '%s'", spec)
+	}
+	if height, err = strconv.Atoi(h); err != nil || height <= 0 {
+		return 0, 0, 0, fmt.Errorf("invalid height in '%s'", spec)
+	}
+	if hasRate {
+		if hz, err = strconv.Atoi(rate); err != nil || hz <= 0 {
+			return 0, 0, 0, fmt.Errorf("invalid refresh rate in '%s'", spec)
+		}
+	}
+	return width, height, hz, nil
+}
+
+// chooseVideoMode returns the monitor's video mode matching spec: the given
+// size at the given refresh rate, or the closest one it supports, or at the
+// highest rate if none is given. An empty spec selects the current mode.
+func chooseVideoMode(m *glfw.Monitor, spec string) (*glfw.VidMode, error) {
+	if spec == "" {
+		return m.GetVideoMode(), nil
+	}
+	width, height, hz, err := ParseVideoMode(spec)
+	if err != nil {
+		return nil, err
+	}
+	var best *glfw.VidMode
+	var sizes []string
+	for _, mode := range m.GetVideoModes() {
+		sizes = append(sizes, fmt.Sprintf("%dx%d@%d", mode.Width, mode.Height, mode.RefreshRate))
+		if mode.Width != width || mode.Height != height {
+			continue
+		}
+		switch {
+		case best == nil:
+			best = mode
+		case hz == 0 && mode.RefreshRate > best.RefreshRate:
+			best = mode
+		case hz != 0 && abs(mode.RefreshRate-hz) < abs(best.RefreshRate-hz):
+			best = mode
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("monitor '%s' has no %dx%d mode; modes are: %s", m.GetName(), width, height, strings.Join(sizes, ", "))
+	}
+	if hz != 0 && best.RefreshRate != hz {
+		log.Printf("Warning: monitor '%s' has no %dx%d@%d mode, using %dHz", m.GetName(), width, height, hz, best.RefreshRate)
+	}
+	return best, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func findMonitor(monitors []*glfw.Monitor, item string) (*glfw.Monitor, error) {
+	if index, err := strconv.Atoi(item); err == nil {
+		if index < 0 || index >= len(monitors) {
+			return nil, fmt.Errorf("monitor index %d out of range; monitors are: %s", index, describeMonitors(monitors))
+		}
+		return monitors[index], nil
+	}
+	for _, m := range monitors {
+		if strings.HasPrefix(strings.ToLower(m.GetName()), strings.ToLower(item)) {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("no monitor named '%s'; monitors are: %s", item, describeMonitors(monitors))
+}
+
+func describeMonitors(monitors []*glfw.Monitor) string {
+	names := make([]string, len(monitors))
+	for i, m := range monitors {
+		mode := m.GetVideoMode()
+		names[i] = fmt.Sprintf("%d '%s' (%dx%d)", i, m.GetName(), mode.Width, mode.Height)
+	}
+	return strings.Join(names, ", ")
+}
+
+// monitorsBounds returns the rectangle, in screen coordinates, covering the
+// monitors.
+func monitorsBounds(monitors []*glfw.Monitor) (x, y, width, height int) {
+	minX, minY := math.MaxInt, math.MaxInt
+	maxX, maxY := math.MinInt, math.MinInt
+	for _, m := range monitors {
+		mx, my := m.GetPos()
+		mode := m.GetVideoMode()
+		minX, minY = min(minX, mx), min(minY, my)
+		maxX, maxY = max(maxX, mx+mode.Width), max(maxY, my+mode.Height)
+	}
+	return minX, minY, maxX - minX, maxY - minY
+}
@@ -0,0 +1,5 @@
+//go:build !((linux || freebsd || netbsd) && wayland)
+
+package glfwcontext
+
+const isWayland = false
@@ -0,0 +1,9 @@
+//go:build (linux || freebsd || netbsd) && wayland
+
+package glfwcontext
+
+// isWayland is set when GLFW is built for Wayland ("go build -tags wayland")
+// and talks to the compositor directly instead of through XWayland. Wayland
+// clients can't place their windows or change video modes, and their window
+// sizes are in scaled units rather than pixels.
+const isWayland = true
@@ -7,9 +7,19 @@ replace github.com/go-gl/glfw/v3.3/glfw => ./glfw/v3.3/glfw
 require (
 	github.com/go-gl/gl v0.0.0-20231021071112-07e5d0ea2e71
 	github.com/go-gl/glfw/v3.3/glfw v0.0.0-20250301202403-da16c1255728
+	github.com/hajimehoshi/go-mp3 v0.3.4
+	github.com/jfreymuth/oggvorbis v1.0.5
+	github.com/mewkiz/flac v1.0.14
 	github.com/mjibson/go-dsp v0.0.0-20180508042940-11479a337f12
 	github.com/richinsley/goshadertranslator v1.0.2
-	golang.org/x/sys v0.0.0-20200930185726-fdedc70b468f
+	golang.org/x/sys v0.0.0-20220712014510-0a85c31ab51e
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require github.com/tetratelabs/wazero v1.9.0 // indirect
+require (
+	github.com/icza/bitio v1.1.0 // indirect
+	github.com/jfreymuth/vorbis v1.0.2 // indirect
+	github.com/mewkiz/pkg v0.0.0-20250417130911-3f050ff8c56d // indirect
+	github.com/mewpkg/term v0.0.0-20241026122259-37a80af23985 // indirect
+	github.com/tetratelabs/wazero v1.9.0 // indirect
+)
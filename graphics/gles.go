@@ -0,0 +1,50 @@
+package graphics
+
+import (
+	"sync"
+	"unsafe"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// glesExtensionFunctions maps desktop GL functions that OpenGL ES only has
+// through an extension to the extension's name for them.
+var glesExtensionFunctions = map[string]string{
+	"glBufferStorage": "glBufferStorageEXT", // GL_EXT_buffer_storage
+}
+
+var (
+	glesLoadedMu sync.Mutex
+	glesLoaded   = make(map[string]bool)
+)
+
+// InitGLES loads the GL bindings for the current OpenGL ES context through
+// lookup, which returns nil for functions the implementation lacks. Functions
+// OpenGL ES only has through extensions are loaded under the extension's
+// name, so that gl.BufferStorage calls glBufferStorageEXT. The other missing
+// functions, desktop GL functions the renderer doesn't call on GLES, are set
+// to stub, as the bindings require every GL 4.1 function.
+func InitGLES(lookup func(name string) unsafe.Pointer, stub unsafe.Pointer) error {
+	glesLoadedMu.Lock()
+	defer glesLoadedMu.Unlock()
+	return gl.InitWithProcAddrFunc(func(name string) unsafe.Pointer {
+		if ext, ok := glesExtensionFunctions[name]; ok {
+			proc := lookup(ext)
+			glesLoaded[name] = proc != nil
+			return proc
+		}
+		if proc := lookup(name); proc != nil {
+			return proc
+		}
+		return stub
+	})
+}
+
+// GLESFunctionLoaded reports whether InitGLES found name, one of the
+// functions OpenGL ES only has through an extension. Without it, calling the
+// function crashes.
+func GLESFunctionLoaded(name string) bool {
+	glesLoadedMu.Lock()
+	defer glesLoadedMu.Unlock()
+	return glesLoaded[name]
+}
@@ -0,0 +1,32 @@
+package graphics
+
+// KeyboardState is the keyboard during a frame, indexed by JavaScript key
+// code as Shadertoy's keyboard texture is. A key pressed and released within
+// one frame is Pressed but not Down, as in the Shadertoy player.
+type KeyboardState struct {
+	Down    [256]bool // Held at the end of the frame
+	Pressed [256]bool // Went down during the frame
+	Toggled [256]bool // Pressed an odd number of times
+}
+
+// Press records a key going down. Repeats while it is held are ignored.
+func (k *KeyboardState) Press(code int) {
+	if code < 0 || code >= len(k.Down) || k.Down[code] {
+		return
+	}
+	k.Down[code] = true
+	k.Pressed[code] = true
+	k.Toggled[code] = !k.Toggled[code]
+}
+
+// Release records a key going up.
+func (k *KeyboardState) Release(code int) {
+	if code >= 0 && code < len(k.Down) {
+		k.Down[code] = false
+	}
+}
+
+// NextFrame clears the keys pressed during the last frame.
+func (k *KeyboardState) NextFrame() {
+	k.Pressed = [256]bool{}
+}
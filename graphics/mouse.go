@@ -0,0 +1,42 @@
+package graphics
+
+import "math"
+
+// MouseState turns per-frame pointer samples into iMouse the way the
+// Shadertoy player does:
+//   - xy is the pointer position while the button is down, and stays where
+//     it was released.
+//   - zw is where the button went down.
+//   - z is positive while the button is held.
+//   - w is positive only on the frame the button went down.
+//
+// Positions are in whole pixels with the origin at the bottom left. Before the
+// first click, iMouse is zero.
+type MouseState struct {
+	posX, posY     float32
+	clickX, clickY float32
+	down           bool
+}
+
+// Update records the pointer for a frame, at (x, y) pixels from the bottom
+// left with the button down or not, and returns iMouse for the frame.
+func (m *MouseState) Update(x, y float64, down bool) [4]float32 {
+	px, py := float32(math.Floor(x)), float32(math.Floor(y))
+	pressed := down && !m.down
+	if pressed {
+		m.clickX, m.clickY = px, py
+	}
+	if down {
+		m.posX, m.posY = px, py
+	}
+	m.down = down
+
+	z, w := m.clickX, m.clickY
+	if !down {
+		z = -z
+	}
+	if !pressed {
+		w = -w
+	}
+	return [4]float32{m.posX, m.posY, z, w}
+}
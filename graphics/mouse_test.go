@@ -0,0 +1,69 @@
+package graphics
+
+import "testing"
+
+type mouseSample struct {
+	x, y float64
+	down bool
+	want [4]float32
+}
+
+func TestMouseStateUpdate(t *testing.T) {
+	tests := []struct {
+		name  string
+		trace []mouseSample
+	}{
+		{
+			name: "idle before the first click",
+			trace: []mouseSample{
+				{10, 20, false, [4]float32{0, 0, 0, 0}},
+				{30.7, 40.2, false, [4]float32{0, 0, 0, 0}},
+			},
+		},
+		{
+			name: "press, drag and release",
+			trace: []mouseSample{
+				{10.4, 20.9, true, [4]float32{10, 20, 10, 20}},  // Pressed: z and w positive
+				{15, 25, true, [4]float32{15, 25, 10, -20}},     // Held: w negative
+				{50.5, 60.5, true, [4]float32{50, 60, 10, -20}}, // Dragged: xy follows
+				{70, 80, false, [4]float32{50, 60, -10, -20}},   // Released: z negative, xy stays
+				{90, 100, false, [4]float32{50, 60, -10, -20}},  // Moving without the button
+			},
+		},
+		{
+			name: "single-frame click",
+			trace: []mouseSample{
+				{5, 6, true, [4]float32{5, 6, 5, 6}},
+				{5, 6, false, [4]float32{5, 6, -5, -6}},
+			},
+		},
+		{
+			name: "second click moves the click position",
+			trace: []mouseSample{
+				{5, 6, true, [4]float32{5, 6, 5, 6}},
+				{7, 8, false, [4]float32{5, 6, -5, -6}},
+				{100, 200, true, [4]float32{100, 200, 100, 200}},
+				{110, 210, true, [4]float32{110, 210, 100, -200}},
+				{110, 210, false, [4]float32{110, 210, -100, -200}},
+			},
+		},
+		{
+			name: "click at the origin",
+			trace: []mouseSample{
+				{0.5, 0.5, true, [4]float32{0, 0, 0, 0}},
+				{3, 4, true, [4]float32{3, 4, 0, 0}},
+				{3, 4, false, [4]float32{3, 4, 0, 0}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m MouseState
+			for i, s := range tt.trace {
+				if got := m.Update(s.x, s.y, s.down); got != s.want {
+					t.Errorf("frame %d: Update(%g, %g, %v) = %v, want %v", i, s.x, s.y, s.down, got, s.want)
+				}
+			}
+		})
+	}
+}
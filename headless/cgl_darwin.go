@@ -0,0 +1,175 @@
+//go:build darwin
+
+package headless
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+)
+
+/*
+#cgo CFLAGS: -Wno-deprecated-declarations
+#cgo LDFLAGS: -framework OpenGL
+#include <OpenGL/OpenGL.h>
+
+// choose_pixel_format picks a GL 4.1 core pixel format without a drawable,
+// on a GPU whether or not it drives a display, or on the software renderer
+// unless accelerated.
+static CGLError choose_pixel_format(int accelerated, CGLPixelFormatObj *pix) {
+    CGLPixelFormatAttribute attribs[] = {
+        kCGLPFAOpenGLProfile, (CGLPixelFormatAttribute) kCGLOGLPVersion_GL4_Core,
+        kCGLPFAColorSize, (CGLPixelFormatAttribute) 24,
+        kCGLPFAAlphaSize, (CGLPixelFormatAttribute) 8,
+        kCGLPFADepthSize, (CGLPixelFormatAttribute) 24,
+        kCGLPFAAllowOfflineRenderers,
+        accelerated ? kCGLPFAAccelerated : (CGLPixelFormatAttribute) 0,
+        (CGLPixelFormatAttribute) 0,
+    };
+    GLint num = 0;
+    CGLError err = CGLChoosePixelFormat(attribs, pix, &num);
+    if (err == kCGLNoError && *pix == NULL) {
+        err = kCGLBadPixelFormat;
+    }
+    return err;
+}
+
+static GLint describe_renderer(CGLRendererInfoObj info, GLint i, CGLRendererProperty prop) {
+    GLint value = 0;
+    CGLDescribeRenderer(info, i, prop, &value);
+    return value;
+}
+*/
+import "C"
+
+// Headless is an offscreen desktop GL 4.1 core context of CGL. It needs no
+// window or login session, so it works over SSH and from launchd. It has no
+// default framebuffer: everything renders into framebuffer objects, as
+// record mode does.
+type Headless struct {
+	context   C.CGLContextObj
+	width     int
+	height    int
+	startTime time.Time
+}
+
+// Available checks that headless contexts can be created at all; on macOS,
+// CGL is part of the system.
+func Available() error {
+	return nil
+}
+
+// EGLDevices describes the CGL renderers, as macOS has no EGL: their ID,
+// whether they are accelerated and drive a display, and their memory.
+func EGLDevices() ([]string, error) {
+	var info C.CGLRendererInfoObj
+	var count C.GLint
+	if err := C.CGLQueryRendererInfo(C.GLuint(0xffffffff), &info, &count); err != C.kCGLNoError {
+		return nil, fmt.Errorf("failed to query CGL renderers: %s", C.GoString(C.CGLErrorString(err)))
+	}
+	defer C.CGLDestroyRendererInfo(info)
+	var descriptions []string
+	for i := C.GLint(0); i < count; i++ {
+		descriptions = append(descriptions, fmt.Sprintf("renderer %d: id 0x%x, accelerated %v, online %v, %d MB",
+			i, C.describe_renderer(info, i, C.kCGLRPRendererID), C.describe_renderer(info, i, C.kCGLRPAccelerated) != 0,
+			C.describe_renderer(info, i, C.kCGLRPOnline) != 0, C.describe_renderer(info, i, C.kCGLRPVideoMemoryMegabytes)))
+	}
+	return descriptions, nil
+}
+
+// NewHeadless creates a headless context. macOS has no GLES, so it is a
+// desktop GL 4.1 core context like NewHeadlessGL's, and IsGLES reports false.
+func NewHeadless(width, height int) (*Headless, error) {
+	return NewHeadlessGL(width, height)
+}
+
+// NewHeadlessGL creates a headless desktop OpenGL 4.1 core context.
+func NewHeadlessGL(width, height int) (*Headless, error) {
+	h := &Headless{
+		width:     width,
+		height:    height,
+		startTime: time.Now(),
+	}
+
+	var pix C.CGLPixelFormatObj
+	if err := C.choose_pixel_format(1, &pix); err != C.kCGLNoError {
+		log.Printf("Warning: No accelerated CGL renderer (%s); using the software renderer.", C.GoString(C.CGLErrorString(err)))
+		if err := C.choose_pixel_format(0, &pix); err != C.kCGLNoError {
+			return nil, fmt.Errorf("failed to choose CGL pixel format: %s", C.GoString(C.CGLErrorString(err)))
+		}
+	}
+	defer C.CGLReleasePixelFormat(pix)
+
+	if err := C.CGLCreateContext(pix, nil, &h.context); err != C.kCGLNoError {
+		return nil, fmt.Errorf("failed to create CGL context: %s", C.GoString(C.CGLErrorString(err)))
+	}
+	if err := C.CGLSetCurrentContext(h.context); err != C.kCGLNoError {
+		h.Shutdown()
+		return nil, fmt.Errorf("failed to make CGL context current: %s", C.GoString(C.CGLErrorString(err)))
+	}
+
+	if err := gl.Init(); err != nil {
+		h.Shutdown()
+		return nil, fmt.Errorf("failed to initialize OpenGL: %w", err)
+	}
+	log.Printf("CGL Initialized. Renderer: %s", gl.GoStr(gl.GetString(gl.RENDERER)))
+
+	return h, nil
+}
+
+func (h *Headless) MakeCurrent() {
+	C.CGLSetCurrentContext(h.context)
+}
+
+// ShouldClose for headless context is always false; it's controlled externally.
+func (h *Headless) ShouldClose() bool {
+	return false
+}
+
+// EndFrame flushes the frame, which has no drawable to be swapped to.
+func (h *Headless) EndFrame() {
+	gl.Flush()
+}
+
+func (h *Headless) GetFramebufferSize() (int, int) {
+	return h.width, h.height
+}
+
+// Time provides an internal timer since the headless context doesn't rely on GLFW's timer.
+func (h *Headless) Time() float64 {
+	return time.Since(h.startTime).Seconds()
+}
+
+func (c *Headless) IsGLES() bool {
+	return false
+}
+
+// GetWindow returns nil for headless contexts.
+func (c *Headless) GetWindow() interface{} {
+	return nil // No window in headless mode
+}
+
+func (h *Headless) DetachCurrent() {
+	C.CGLSetCurrentContext(nil)
+}
+
+// GetMouseInput for a headless context always returns zero values.
+func (h *Headless) GetMouseInput() [4]float32 {
+	return [4]float32{0, 0, 0, 0}
+}
+
+func (h *Headless) Shutdown() {
+	if h.context != nil {
+		if C.CGLGetCurrentContext() == h.context {
+			C.CGLSetCurrentContext(nil)
+		}
+		C.CGLDestroyContext(h.context)
+		h.context = nil
+	}
+}
+
+func (h *Headless) SwapBuffers() {
+	gl.Flush()
+}
@@ -1,4 +1,4 @@
-//go:build !linux
+//go:build !linux && !darwin
 
 package headless
 
@@ -8,6 +8,18 @@ import (
 	"github.com/richinsley/goshadertoy/graphics"
 )
 
+func Available() error {
+	return fmt.Errorf("egl headless rendering is not supported on this platform")
+}
+
+func EGLDevices() ([]string, error) {
+	return nil, fmt.Errorf("EGL devices are not supported on this platform")
+}
+
 func NewHeadless(width, height int) (graphics.Context, error) {
 	return nil, fmt.Errorf("egl headless rendering is not supported on this platform")
 }
+
+func NewHeadlessGL(width, height int) (graphics.Context, error) {
+	return nil, fmt.Errorf("egl headless rendering is not supported on this platform")
+}
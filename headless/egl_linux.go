@@ -5,25 +5,90 @@ package headless
 import (
 	"fmt"
 	"log"
+	"slices"
+	"strings"
+	"syscall"
 	"time"
 	"unsafe"
 
 	gl "github.com/go-gl/gl/v4.1-core/gl"
+	graphics "github.com/richinsley/goshadertoy/graphics"
 )
 
 /*
-#cgo LDFLAGS: -lEGL -lGLESv2
+#cgo LDFLAGS: -lEGL -lGLESv2 -ldl
+#define _GNU_SOURCE
 #include <EGL/egl.h>
 #include <EGL/eglext.h>
+#include <dlfcn.h>
+#include <stdint.h>
+#include <stdlib.h>
+
+// find_gl_proc looks a GL function up through EGL, or in the linked GLES
+// library for EGL implementations that only return extension functions. It
+// returns NULL if neither has it.
+static void *find_gl_proc(const char *name) {
+    void *proc = (void *)eglGetProcAddress(name);
+    if (proc == NULL) {
+        proc = dlsym(RTLD_DEFAULT, name);
+    }
+    return proc;
+}
+
+// unsupported_gl_function stands in for the desktop GL functions GLES lacks
+// (see graphics.InitGLES).
+static void unsupported_gl_function(void) {}
+
+static void *unsupported_gl_function_ptr(void) {
+    return (void *)unsupported_gl_function;
+}
 
 // Go doesn't have a great way to call function pointers from C,
 // so we'll create simple wrappers for the extension functions.
 static PFNEGLQUERYDEVICESEXTPROC eglQueryDevicesEXT_ptr = NULL;
 static PFNEGLGETPLATFORMDISPLAYEXTPROC eglGetPlatformDisplayEXT_ptr = NULL;
+static PFNEGLQUERYDEVICESTRINGEXTPROC eglQueryDeviceStringEXT_ptr = NULL;
+static PFNEGLCREATEIMAGEKHRPROC eglCreateImageKHR_ptr = NULL;
+static PFNEGLDESTROYIMAGEKHRPROC eglDestroyImageKHR_ptr = NULL;
+static PFNEGLEXPORTDMABUFIMAGEQUERYMESAPROC eglExportDMABUFImageQueryMESA_ptr = NULL;
+static PFNEGLEXPORTDMABUFIMAGEMESAPROC eglExportDMABUFImageMESA_ptr = NULL;
 
 static void initialize_egl_extension_pointers() {
     eglQueryDevicesEXT_ptr = (PFNEGLQUERYDEVICESEXTPROC) eglGetProcAddress("eglQueryDevicesEXT");
     eglGetPlatformDisplayEXT_ptr = (PFNEGLGETPLATFORMDISPLAYEXTPROC) eglGetProcAddress("eglGetPlatformDisplayEXT");
+    eglQueryDeviceStringEXT_ptr = (PFNEGLQUERYDEVICESTRINGEXTPROC) eglGetProcAddress("eglQueryDeviceStringEXT");
+    eglCreateImageKHR_ptr = (PFNEGLCREATEIMAGEKHRPROC) eglGetProcAddress("eglCreateImageKHR");
+    eglDestroyImageKHR_ptr = (PFNEGLDESTROYIMAGEKHRPROC) eglGetProcAddress("eglDestroyImageKHR");
+    eglExportDMABUFImageQueryMESA_ptr = (PFNEGLEXPORTDMABUFIMAGEQUERYMESAPROC) eglGetProcAddress("eglExportDMABUFImageQueryMESA");
+    eglExportDMABUFImageMESA_ptr = (PFNEGLEXPORTDMABUFIMAGEMESAPROC) eglGetProcAddress("eglExportDMABUFImageMESA");
+}
+
+// export_dmabuf exports a GL texture as DMA-BUF planes (at most 4), through
+// an EGLImage that the file descriptors outlive. It returns the number of
+// planes, or 0 on failure.
+static int export_dmabuf(EGLDisplay display, EGLContext context, unsigned int texture, int *fourcc, EGLuint64KHR *modifiers, int *fds, EGLint *strides, EGLint *offsets) {
+    if (!eglCreateImageKHR_ptr || !eglDestroyImageKHR_ptr || !eglExportDMABUFImageQueryMESA_ptr || !eglExportDMABUFImageMESA_ptr) {
+        return 0;
+    }
+    EGLImageKHR image = eglCreateImageKHR_ptr(display, context, EGL_GL_TEXTURE_2D_KHR, (EGLClientBuffer)(uintptr_t) texture, NULL);
+    if (image == EGL_NO_IMAGE_KHR) {
+        return 0;
+    }
+    int planes = 0;
+    if (!eglExportDMABUFImageQueryMESA_ptr(display, image, fourcc, &planes, NULL) || planes < 1 || planes > 4 ||
+        !eglExportDMABUFImageQueryMESA_ptr(display, image, fourcc, &planes, modifiers) ||
+        !eglExportDMABUFImageMESA_ptr(display, image, fds, strides, offsets)) {
+        planes = 0;
+    }
+    eglDestroyImageKHR_ptr(display, image);
+    return planes;
+}
+
+static const char *query_device_string(EGLDeviceEXT device, EGLint name) {
+    if (eglQueryDeviceStringEXT_ptr) {
+        return eglQueryDeviceStringEXT_ptr(device, name);
+    }
+    return NULL;
 }
 
 static EGLDisplay get_platform_display(EGLenum platform, void *native_display, const EGLint *attrib_list) {
@@ -48,6 +113,7 @@ type Headless struct {
 	surface   C.EGLSurface
 	width     int
 	height    int
+	gles      bool
 	startTime time.Time
 }
 
@@ -88,10 +154,57 @@ func getEGLDisplay() (C.EGLDisplay, error) {
 	return C.EGLDisplay(C.EGL_NO_DISPLAY), fmt.Errorf("could not get a valid EGL display from any available device")
 }
 
+// Available checks that headless contexts can be created at all; on Linux,
+// EGL is linked in.
+func Available() error {
+	return nil
+}
+
+// EGLDevices describes each EGL device: its DRM device file, if any, and
+// its extensions.
+func EGLDevices() ([]string, error) {
+	C.initialize_egl_extension_pointers()
+	var num_devices C.EGLint
+	if C.query_devices(0, nil, &num_devices) == C.EGL_FALSE {
+		return nil, fmt.Errorf("EGL_EXT_device_query is not supported")
+	}
+	if num_devices == 0 {
+		return nil, nil
+	}
+	devices := make([]C.EGLDeviceEXT, num_devices)
+	if C.query_devices(num_devices, &devices[0], &num_devices) == C.EGL_FALSE {
+		return nil, fmt.Errorf("failed to query EGL devices")
+	}
+	str := func(device C.EGLDeviceEXT, name C.EGLint) string {
+		if s := C.query_device_string(device, name); s != nil {
+			return C.GoString(s)
+		}
+		return "(unknown)"
+	}
+	var descriptions []string
+	for i := 0; i < int(num_devices); i++ {
+		descriptions = append(descriptions, fmt.Sprintf("device %d: %s\n  extensions: %s",
+			i, str(devices[i], C.EGL_DRM_DEVICE_FILE_EXT), str(devices[i], C.EGL_EXTENSIONS)))
+	}
+	return descriptions, nil
+}
+
 func NewHeadless(width, height int) (*Headless, error) {
+	return newHeadless(width, height, true)
+}
+
+// NewHeadlessGL creates a headless desktop OpenGL 4.1 core context, the API
+// that windowed rendering uses, so offscreen renders can be compared with the
+// GLES path. Not every EGL driver provides desktop GL.
+func NewHeadlessGL(width, height int) (*Headless, error) {
+	return newHeadless(width, height, false)
+}
+
+func newHeadless(width, height int, gles bool) (*Headless, error) {
 	h := &Headless{
 		width:     width,
 		height:    height,
+		gles:      gles,
 		startTime: time.Now(),
 	}
 
@@ -107,6 +220,14 @@ func NewHeadless(width, height int) (*Headless, error) {
 	}
 	log.Printf("EGL Initialized. Version: %d.%d", major, minor)
 
+	renderableType := C.EGLint(C.EGL_OPENGL_ES3_BIT)
+	if !gles {
+		renderableType = C.EGL_OPENGL_BIT
+	}
+	if !h.bindAPI() {
+		return nil, fmt.Errorf("EGL driver does not support the requested client API")
+	}
+
 	configAttribs := []C.EGLint{
 		C.EGL_SURFACE_TYPE, C.EGL_PBUFFER_BIT,
 		C.EGL_RED_SIZE, 8,
@@ -114,7 +235,7 @@ func NewHeadless(width, height int) (*Headless, error) {
 		C.EGL_BLUE_SIZE, 8,
 		C.EGL_ALPHA_SIZE, 8,
 		C.EGL_DEPTH_SIZE, 24,
-		C.EGL_RENDERABLE_TYPE, C.EGL_OPENGL_ES3_BIT,
+		C.EGL_RENDERABLE_TYPE, renderableType,
 		C.EGL_NONE,
 	}
 
@@ -124,37 +245,153 @@ func NewHeadless(width, height int) (*Headless, error) {
 		return nil, fmt.Errorf("failed to choose EGL config")
 	}
 
-	pbufferAttribs := []C.EGLint{
-		C.EGL_WIDTH, C.EGLint(width),
-		C.EGL_HEIGHT, C.EGLint(height),
-		C.EGL_NONE,
-	}
-	h.surface = C.eglCreatePbufferSurface(h.display, config, &pbufferAttribs[0])
-	if h.surface == C.EGLSurface(C.EGL_NO_SURFACE) {
-		return nil, fmt.Errorf("failed to create Pbuffer surface")
+	// Everything renders into framebuffer objects, so a context without a
+	// surface does, where the driver allows it, and saves the pbuffer's memory.
+	surfaceless := h.hasExtension("EGL_KHR_surfaceless_context")
+	if !surfaceless {
+		if err := h.createPbuffer(config); err != nil {
+			return nil, err
+		}
 	}
 
 	contextAttribs := []C.EGLint{
 		C.EGL_CONTEXT_CLIENT_VERSION, 3,
 		C.EGL_NONE,
 	}
+	if !gles {
+		contextAttribs = []C.EGLint{
+			C.EGL_CONTEXT_MAJOR_VERSION, 4,
+			C.EGL_CONTEXT_MINOR_VERSION, 1,
+			C.EGL_CONTEXT_OPENGL_PROFILE_MASK, C.EGL_CONTEXT_OPENGL_CORE_PROFILE_BIT,
+			C.EGL_NONE,
+		}
+	}
 	h.context = C.eglCreateContext(h.display, config, C.EGLContext(C.EGL_NO_CONTEXT), &contextAttribs[0])
 	if h.context == C.EGLContext(C.EGL_NO_CONTEXT) {
 		return nil, fmt.Errorf("failed to create EGL context")
 	}
 
 	if C.eglMakeCurrent(h.display, h.surface, h.surface, h.context) == C.EGL_FALSE {
-		return nil, fmt.Errorf("failed to make EGL context current")
+		if !surfaceless {
+			return nil, fmt.Errorf("failed to make EGL context current")
+		}
+		log.Println("Warning: EGL context can't be made current without a surface; using a pbuffer.")
+		if err := h.createPbuffer(config); err != nil {
+			return nil, err
+		}
+		if C.eglMakeCurrent(h.display, h.surface, h.surface, h.context) == C.EGL_FALSE {
+			return nil, fmt.Errorf("failed to make EGL context current")
+		}
+	} else if surfaceless {
+		log.Println("Using a surfaceless EGL context.")
 	}
 
-	if err := gl.Init(); err != nil {
-		return nil, fmt.Errorf("failed to initialize OpenGL ES: %w", err)
+	if err := h.initGL(); err != nil {
+		return nil, fmt.Errorf("failed to initialize OpenGL: %w", err)
 	}
 
 	return h, nil
 }
 
+// initGL loads the GL bindings. Those of a GLES context come from EGL, with
+// the functions GLES only has through extensions under their extension
+// names.
+func (h *Headless) initGL() error {
+	if !h.gles {
+		return gl.Init()
+	}
+	return graphics.InitGLES(func(name string) unsafe.Pointer {
+		cName := C.CString(name)
+		defer C.free(unsafe.Pointer(cName))
+		return C.find_gl_proc(cName)
+	}, C.unsupported_gl_function_ptr())
+}
+
+// hasExtension reports whether the display supports the EGL extension name.
+func (h *Headless) hasExtension(name string) bool {
+	extensions := C.eglQueryString(h.display, C.EGL_EXTENSIONS)
+	return extensions != nil && slices.Contains(strings.Fields(C.GoString(extensions)), name)
+}
+
+// createPbuffer creates the pbuffer surface of the context.
+func (h *Headless) createPbuffer(config C.EGLConfig) error {
+	pbufferAttribs := []C.EGLint{
+		C.EGL_WIDTH, C.EGLint(h.width),
+		C.EGL_HEIGHT, C.EGLint(h.height),
+		C.EGL_NONE,
+	}
+	h.surface = C.eglCreatePbufferSurface(h.display, config, &pbufferAttribs[0])
+	if h.surface == C.EGLSurface(C.EGL_NO_SURFACE) {
+		return fmt.Errorf("failed to create Pbuffer surface")
+	}
+	return nil
+}
+
+// DMABuf is a texture exported as DMA-BUF planes, which VAAPI encoders and
+// Wayland compositors import without copying. It shares the texture's
+// memory, so each frame rendered into the texture shows through once the GL
+// commands have finished (e.g. after gl.Finish).
+type DMABuf struct {
+	Width    int
+	Height   int
+	FourCC   uint32 // DRM format, e.g. DRM_FORMAT_ABGR8888 for RGBA8
+	Modifier uint64 // DRM format modifier of the memory layout
+	FDs      []int  // Per plane, owned by the DMABuf
+	Strides  []int
+	Offsets  []int
+}
+
+// Close closes the file descriptors of the planes.
+func (d *DMABuf) Close() error {
+	var err error
+	for _, fd := range d.FDs {
+		if cerr := syscall.Close(fd); err == nil {
+			err = cerr
+		}
+	}
+	d.FDs = nil
+	return err
+}
+
+// ExportDMABuf exports a 2D texture of the context, e.g. the render target,
+// as a DMA-BUF. It needs EGL_KHR_gl_texture_2D_image and
+// EGL_MESA_image_dma_buf_export, which Mesa drivers have, and the context
+// current on the calling thread.
+func (h *Headless) ExportDMABuf(texture uint32, width, height int) (*DMABuf, error) {
+	for _, ext := range []string{"EGL_KHR_gl_texture_2D_image", "EGL_MESA_image_dma_buf_export"} {
+		if !h.hasExtension(ext) {
+			return nil, fmt.Errorf("DMA-BUF export needs %s, which the EGL driver lacks", ext)
+		}
+	}
+	var fourcc C.int
+	var modifiers [4]C.EGLuint64KHR
+	var fds [4]C.int
+	var strides, offsets [4]C.EGLint
+	planes := int(C.export_dmabuf(h.display, h.context, C.uint(texture), &fourcc, &modifiers[0], &fds[0], &strides[0], &offsets[0]))
+	if planes == 0 {
+		return nil, fmt.Errorf("failed to export texture %d as DMA-BUF", texture)
+	}
+	d := &DMABuf{Width: width, Height: height, FourCC: uint32(fourcc), Modifier: uint64(modifiers[0])}
+	for i := 0; i < planes; i++ {
+		d.FDs = append(d.FDs, int(fds[i]))
+		d.Strides = append(d.Strides, int(strides[i]))
+		d.Offsets = append(d.Offsets, int(offsets[i]))
+	}
+	return d, nil
+}
+
+// bindAPI selects the client API of the context for the calling thread, which
+// eglMakeCurrent and eglCreateContext use.
+func (h *Headless) bindAPI() bool {
+	api := C.EGLenum(C.EGL_OPENGL_ES_API)
+	if !h.gles {
+		api = C.EGL_OPENGL_API
+	}
+	return C.eglBindAPI(api) == C.EGL_TRUE
+}
+
 func (h *Headless) MakeCurrent() {
+	h.bindAPI()
 	C.eglMakeCurrent(h.display, h.surface, h.surface, h.context)
 }
 
@@ -164,7 +401,7 @@ func (h *Headless) ShouldClose() bool {
 }
 
 func (h *Headless) EndFrame() {
-	C.eglSwapBuffers(h.display, h.surface)
+	h.SwapBuffers()
 }
 
 func (h *Headless) GetFramebufferSize() (int, int) {
@@ -177,7 +414,7 @@ func (h *Headless) Time() float64 {
 }
 
 func (c *Headless) IsGLES() bool {
-	return true // Headless context is always GLES
+	return c.gles
 }
 
 // GetWindow returns nil for headless contexts.
@@ -207,6 +444,11 @@ func (h *Headless) Shutdown() {
 	}
 }
 
+// SwapBuffers swaps the pbuffer, or only flushes without a surface.
 func (h *Headless) SwapBuffers() {
+	if h.surface == C.EGLSurface(C.EGL_NO_SURFACE) {
+		gl.Flush()
+		return
+	}
 	C.eglSwapBuffers(h.display, h.surface)
 }
@@ -20,6 +20,11 @@ type Buffer struct {
 
 	resolution [3]float32
 
+	// The other stereo eye's contents, swapped in by SetEye; nil until the
+	// right eye is first rendered.
+	otherEye *eyeState
+	eye      int
+
 	// Render pass specific state that will be set by the renderer
 	ShaderProgram uint32
 	PassInputs    []IChannel
@@ -28,6 +33,14 @@ type Buffer struct {
 	filter        string
 }
 
+// eyeState is the double-buffered contents of one stereo eye of a buffer.
+type eyeState struct {
+	fbo        [2]uint32
+	textureID  [2]uint32
+	readIndex  int
+	writeIndex int
+}
+
 // NewBuffer creates the necessary OpenGL resources for a render buffer.
 // It initializes two framebuffers and two textures for double buffering.
 func NewBuffer(width, height int, vao uint32) (*Buffer, error) {
@@ -40,6 +53,17 @@ func NewBuffer(width, height int, vao uint32) (*Buffer, error) {
 		filter:     "linear",
 	}
 
+	fbos, textures, err := newPingPong(width, height)
+	if err != nil {
+		return nil, err
+	}
+	b.fbo, b.textureID = fbos, textures
+	b.resolution = [3]float32{float32(width), float32(height), 1.0}
+	return b, nil
+}
+
+// newPingPong creates the two textures and FBOs a buffer alternates between.
+func newPingPong(width, height int) (fbos, textures [2]uint32, err error) {
 	for i := 0; i < 2; i++ {
 		var fbo, texture uint32
 		gl.GenTextures(1, &texture)
@@ -57,20 +81,68 @@ func NewBuffer(width, height int, vao uint32) (*Buffer, error) {
 		// Attach the texture to the FBO
 		gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, texture, 0)
 
+		fbos[i], textures[i] = fbo, texture
 		if gl.CheckFramebufferStatus(gl.FRAMEBUFFER) != gl.FRAMEBUFFER_COMPLETE {
-			return nil, fmt.Errorf("framebuffer %d for buffer is not complete", i)
+			gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+			gl.DeleteFramebuffers(int32(i+1), &fbos[0])
+			gl.DeleteTextures(int32(i+1), &textures[0])
+			return fbos, textures, fmt.Errorf("framebuffer %d for buffer is not complete", i)
 		}
-
-		b.fbo[i] = fbo
-		b.textureID[i] = texture
 	}
 
 	// Unbind to avoid accidental modifications
 	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
 	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return fbos, textures, nil
+}
 
-	b.resolution = [3]float32{float32(width), float32(height), 1.0}
-	return b, nil
+// SetEye makes the buffer render to and read from the contents of stereo eye
+// 0 (left) or 1 (right). The right eye gets textures of its own when first
+// set, so that a pass depending on the eye keeps a separate state per eye.
+func (b *Buffer) SetEye(eye int) error {
+	if eye == b.eye {
+		return nil
+	}
+	if b.otherEye == nil {
+		fbos, textures, err := newPingPong(int(b.resolution[0]), int(b.resolution[1]))
+		if err != nil {
+			return err
+		}
+		minFilter, magFilter := getFilterMode(b.filter)
+		wrapmode := getWrapMode(b.wrap)
+		for _, texture := range textures {
+			gl.BindTexture(gl.TEXTURE_2D, texture)
+			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, minFilter)
+			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, magFilter)
+			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, wrapmode)
+			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, wrapmode)
+		}
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+		b.otherEye = &eyeState{fbo: fbos, textureID: textures, readIndex: 0, writeIndex: 1}
+	}
+	b.swapEye()
+	b.eye = eye
+	return nil
+}
+
+// swapEye exchanges the current eye's contents with the other eye's.
+func (b *Buffer) swapEye() {
+	o := b.otherEye
+	b.fbo, o.fbo = o.fbo, b.fbo
+	b.textureID, o.textureID = o.textureID, b.textureID
+	b.readIndex, o.readIndex = o.readIndex, b.readIndex
+	b.writeIndex, o.writeIndex = o.writeIndex, b.writeIndex
+}
+
+// eachEye calls f once for every eye the buffer has contents for, with that
+// eye's textures current.
+func (b *Buffer) eachEye(f func()) {
+	f()
+	if b.otherEye != nil {
+		b.swapEye()
+		f()
+		b.swapEye()
+	}
 }
 
 // BindForWriting binds the current write-target FBO.
@@ -93,6 +165,34 @@ func (b *Buffer) GetTextureID() uint32 {
 	return b.textureID[b.readIndex]
 }
 
+// ReadState returns the contents of the buffer's current (read) texture as
+// RGBA float32 values, e.g. to checkpoint a render.
+func (b *Buffer) ReadState() []float32 {
+	width, height := int32(b.resolution[0]), int32(b.resolution[1])
+	data := make([]float32, int(width)*int(height)*4)
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, b.fbo[b.readIndex])
+	gl.ReadBuffer(gl.COLOR_ATTACHMENT0)
+	gl.ReadPixels(0, 0, width, height, gl.RGBA, gl.FLOAT, gl.Ptr(data))
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+	return data
+}
+
+// WriteState restores contents saved by ReadState into both textures.
+func (b *Buffer) WriteState(data []float32) error {
+	width, height := int32(b.resolution[0]), int32(b.resolution[1])
+	if len(data) != int(width)*int(height)*4 {
+		return fmt.Errorf("buffer state has %d values, expected %d", len(data), int(width)*int(height)*4)
+	}
+	b.eachEye(func() {
+		for i := 0; i < 2; i++ {
+			gl.BindTexture(gl.TEXTURE_2D, b.textureID[i])
+			gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, width, height, gl.RGBA, gl.FLOAT, gl.Ptr(data))
+		}
+	})
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return nil
+}
+
 // Resize changes the size of both textures and their FBO attachments.
 func (b *Buffer) Resize(width, height int) {
 	if width == int(b.resolution[0]) && height == int(b.resolution[1]) {
@@ -102,10 +202,12 @@ func (b *Buffer) Resize(width, height int) {
 
 	// Delete old textures and FBOs
 	b.resolution = [3]float32{float32(width), float32(height), 1.0}
-	for i := 0; i < 2; i++ {
-		gl.BindTexture(gl.TEXTURE_2D, b.textureID[i])
-		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA32F, int32(width), int32(height), 0, gl.RGBA, gl.FLOAT, nil)
-	}
+	b.eachEye(func() {
+		for i := 0; i < 2; i++ {
+			gl.BindTexture(gl.TEXTURE_2D, b.textureID[i])
+			gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA32F, int32(width), int32(height), 0, gl.RGBA, gl.FLOAT, nil)
+		}
+	})
 	gl.BindTexture(gl.TEXTURE_2D, 0)
 }
 
@@ -119,18 +221,20 @@ func (b *Buffer) UpdateTextureParameters(wrap, filter string, sampler api.Sample
 	minFilter, magFilter := getFilterMode(sampler.Filter)
 	wrapmode := getWrapMode(sampler.Wrap)
 
-	for i := 0; i < 2; i++ {
-		gl.BindTexture(gl.TEXTURE_2D, b.textureID[i])
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, minFilter)
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, magFilter)
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, wrapmode)
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, wrapmode)
-
-		// We must explicitly generate the mipmaps for the buffer texture.
-		if sampler.Filter == "mipmap" {
-			gl.GenerateMipmap(gl.TEXTURE_2D)
+	b.eachEye(func() {
+		for i := 0; i < 2; i++ {
+			gl.BindTexture(gl.TEXTURE_2D, b.textureID[i])
+			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, minFilter)
+			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, magFilter)
+			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, wrapmode)
+			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, wrapmode)
+
+			// We must explicitly generate the mipmaps for the buffer texture.
+			if sampler.Filter == "mipmap" {
+				gl.GenerateMipmap(gl.TEXTURE_2D)
+			}
 		}
-	}
+	})
 	// Unbind to clean up
 	gl.BindTexture(gl.TEXTURE_2D, 0)
 
@@ -144,9 +248,18 @@ func (b *Buffer) GetCType() string          { return b.ctype }
 func (b *Buffer) Update(uniforms *Uniforms) { /* The renderer will handle updating buffers */ }
 func (b *Buffer) ChannelRes() [3]float32    { return b.resolution }
 func (b *Buffer) GetSamplerType() string    { return "sampler2D" }
+func (b *Buffer) GPUMemory() int64 {
+	textures := int64(2) // Two RGBA32F textures per eye
+	if b.otherEye != nil {
+		textures = 4
+	}
+	return textures * textureMemory(b.resolution, 16, b.filter)
+}
 func (b *Buffer) Destroy() {
-	gl.DeleteFramebuffers(2, &b.fbo[0])
-	gl.DeleteTextures(2, &b.textureID[0])
+	b.eachEye(func() {
+		gl.DeleteFramebuffers(2, &b.fbo[0])
+		gl.DeleteTextures(2, &b.textureID[0])
+	})
 	if b.ShaderProgram != 0 {
 		gl.DeleteProgram(b.ShaderProgram)
 	}
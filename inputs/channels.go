@@ -64,6 +64,13 @@ func GetChannels(shaderInputs []*api.ShadertoyChannel, width, height int, vao ui
 			}
 			channels[channelIndex] = cubeChannel
 			log.Printf("Initialized CubeMapChannel %d.", channelIndex)
+		case "video", "webcam":
+			videoChannel, err := NewVideoChannel(chInput.Video, chInput.CType == "webcam", chInput.Sampler, *options.HWAccel)
+			if err != nil {
+				log.Fatalf("Failed to create %s channel %d: %v", chInput.CType, channelIndex, err)
+			}
+			channels[channelIndex] = videoChannel
+			log.Printf("Initialized VideoChannel %d.", channelIndex)
 		case "buffer":
 			// Look up the buffer in the provided map
 			buffer, ok := buffers[chInput.BufferRef]
@@ -85,6 +92,34 @@ func GetChannels(shaderInputs []*api.ShadertoyChannel, width, height int, vao ui
 			}
 			channels[channelIndex] = newChannel
 			log.Printf("Initialized MicChannel %d.", channelIndex)
+		case "spectrogram":
+			spectrogramChannel, err := NewSpectrogramChannel(options, chInput.Sampler, ad, *options.SpectrogramRows)
+			if err != nil {
+				log.Fatalf("Failed to create spectrogram channel: %v", err)
+			}
+			channels[channelIndex] = spectrogramChannel
+			log.Printf("Initialized SpectrogramChannel %d.", channelIndex)
+		case "data":
+			dataChannel, err := NewDataChannel(chInput.DataSource, chInput.Sampler)
+			if err != nil {
+				log.Fatalf("Failed to create data channel %d: %v", channelIndex, err)
+			}
+			channels[channelIndex] = dataChannel
+			log.Printf("Initialized DataChannel %d (%s).", channelIndex, chInput.DataSource)
+		case "share":
+			shareChannel, err := NewSharedTextureChannel(chInput.Share, chInput.Sampler)
+			if err != nil {
+				log.Fatalf("Failed to create shared texture channel %d: %v", channelIndex, err)
+			}
+			channels[channelIndex] = shareChannel
+			log.Printf("Initialized SharedTextureChannel %d (%s).", channelIndex, chInput.Share)
+		case "keyboard":
+			keyboardChannel, err := NewKeyboardChannel()
+			if err != nil {
+				log.Fatalf("Failed to create keyboard channel: %v", err)
+			}
+			channels[channelIndex] = keyboardChannel
+			log.Printf("Initialized KeyboardChannel %d.", channelIndex)
 		case "music":
 			if *options.AudioInputDevice == "" && *options.AudioInputFile == "" {
 				*options.AudioInputFile = chInput.MusicFile
@@ -100,3 +100,6 @@ func (c *CubeMapChannel) GetTextureID() uint32      { return c.textureID }
 func (c *CubeMapChannel) ChannelRes() [3]float32    { return c.resolution }
 func (c *CubeMapChannel) Destroy()                  { gl.DeleteTextures(1, &c.textureID) }
 func (c *CubeMapChannel) GetSamplerType() string    { return "samplerCube" }
+func (c *CubeMapChannel) GPUMemory() int64 {
+	return 6 * textureMemory(c.resolution, 4, c.sampler.Filter)
+}
@@ -0,0 +1,83 @@
+package inputs
+
+import (
+	"fmt"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	api "github.com/richinsley/goshadertoy/api"
+	datasource "github.com/richinsley/goshadertoy/datasource"
+)
+
+// DataChannel shows the values of an external data source as a row of float
+// texels, one per value, updated each frame. iChannelResolution.x is the
+// number of values, which can change as the source supplies more.
+type DataChannel struct {
+	textureID uint32
+	source    datasource.Source
+	width     int
+	values    []float32 // Values last uploaded
+}
+
+// NewDataChannel opens the data source described by spec (see datasource.Open).
+func NewDataChannel(spec string, sampler api.Sampler) (*DataChannel, error) {
+	source, err := datasource.Open(spec)
+	if err != nil {
+		return nil, fmt.Errorf("data channel: %w", err)
+	}
+	c := &DataChannel{source: source, width: 1, values: []float32{0}}
+	gl.GenTextures(1, &c.textureID)
+	gl.BindTexture(gl.TEXTURE_2D, c.textureID)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, getWrapMode(sampler.Wrap))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, getWrapMode(sampler.Wrap))
+	// Float textures aren't mipmapped.
+	filter := int32(gl.NEAREST)
+	if sampler.Filter == "linear" || sampler.Filter == "mipmap" {
+		filter = gl.LINEAR
+	}
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, filter)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, filter)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.R32F, 1, 1, 0, gl.RED, gl.FLOAT, gl.Ptr(c.values))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return c, nil
+}
+
+func (c *DataChannel) Update(uniforms *Uniforms) {
+	values := c.source.Values(float64(uniforms.Time))
+	if len(values) == 0 || equalValues(values, c.values) {
+		return
+	}
+	c.values = append(c.values[:0], values...)
+
+	gl.BindTexture(gl.TEXTURE_2D, c.textureID)
+	if len(values) != c.width {
+		c.width = len(values)
+		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.R32F, int32(c.width), 1, 0, gl.RED, gl.FLOAT, gl.Ptr(c.values))
+	} else {
+		gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, int32(c.width), 1, gl.RED, gl.FLOAT, gl.Ptr(c.values))
+	}
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+func equalValues(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// IChannel Interface Implementation
+func (c *DataChannel) GetCType() string       { return "data" }
+func (c *DataChannel) GetTextureID() uint32   { return c.textureID }
+func (c *DataChannel) ChannelRes() [3]float32 { return [3]float32{float32(c.width), 1, 1} }
+func (c *DataChannel) GetSamplerType() string { return "sampler2D" }
+func (c *DataChannel) GPUMemory() int64       { return textureMemory(c.ChannelRes(), 4, "") } // R32F
+
+func (c *DataChannel) Destroy() {
+	c.source.Close()
+	gl.DeleteTextures(1, &c.textureID)
+}
@@ -0,0 +1,116 @@
+package inputs
+
+import (
+	"fmt"
+	"math"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+// FFTParams controls how audio samples are analysed into the FFT row of the
+// mic/music texture. The defaults match the WebAudio AnalyserNode settings
+// Shadertoy uses.
+type FFTParams struct {
+	Size        int     // FFT input size in mono samples (power of two, >= 2*textureWidth)
+	Smoothing   float64 // Exponential smoothing between frames, in [0, 1)
+	MinDecibels float64 // Level mapped to 0.0 in the texture
+	MaxDecibels float64 // Level mapped to 1.0 in the texture
+	Window      string  // Window function: blackman, hann, hamming or rectangular
+}
+
+// DefaultFFTParams returns the Shadertoy-compatible analysis settings.
+func DefaultFFTParams() FFTParams {
+	return FFTParams{
+		Size:        2048,
+		Smoothing:   0.8,
+		MinDecibels: -100.0,
+		MaxDecibels: -30.0,
+		Window:      "blackman",
+	}
+}
+
+// FFTParamsFromOptions builds FFTParams from the command line options,
+// falling back to the defaults for any option that is not set.
+func FFTParamsFromOptions(opts *options.ShaderOptions) FFTParams {
+	p := DefaultFFTParams()
+	if opts == nil {
+		return p
+	}
+	if opts.FFTSize != nil {
+		p.Size = *opts.FFTSize
+	}
+	if opts.FFTSmoothing != nil {
+		p.Smoothing = *opts.FFTSmoothing
+	}
+	if opts.FFTMinDecibels != nil {
+		p.MinDecibels = *opts.FFTMinDecibels
+	}
+	if opts.FFTMaxDecibels != nil {
+		p.MaxDecibels = *opts.FFTMaxDecibels
+	}
+	if opts.FFTWindow != nil && *opts.FFTWindow != "" {
+		p.Window = *opts.FFTWindow
+	}
+	return p
+}
+
+// Validate checks that the parameters describe a usable analysis.
+func (p FFTParams) Validate() error {
+	if p.Size < 2*textureWidth || p.Size&(p.Size-1) != 0 {
+		return fmt.Errorf("fft size must be a power of two >= %d, got %d", 2*textureWidth, p.Size)
+	}
+	if p.Smoothing < 0 || p.Smoothing >= 1 {
+		return fmt.Errorf("fft smoothing must be in [0, 1), got %g", p.Smoothing)
+	}
+	if p.MinDecibels >= p.MaxDecibels {
+		return fmt.Errorf("fft min decibels (%g) must be below max decibels (%g)", p.MinDecibels, p.MaxDecibels)
+	}
+	if _, err := windowFunction(p.Window, p.Size); err != nil {
+		return err
+	}
+	return nil
+}
+
+// windowFunction generates the named window of the given size.
+func windowFunction(name string, size int) ([]float64, error) {
+	switch name {
+	case "blackman":
+		return blackmanWindow(size), nil
+	case "hann":
+		return cosineWindow(size, 0.5, 0.5), nil
+	case "hamming":
+		return cosineWindow(size, 0.54, 0.46), nil
+	case "rectangular":
+		window := make([]float64, size)
+		for i := range window {
+			window[i] = 1.0
+		}
+		return window, nil
+	default:
+		return nil, fmt.Errorf("unknown fft window function '%s' (valid: blackman, hann, hamming, rectangular)", name)
+	}
+}
+
+// blackmanWindow generates a Blackman window, as used by Shadertoy.
+func blackmanWindow(size int) []float64 {
+	window := make([]float64, size)
+	a0 := 0.42
+	a1 := 0.5
+	a2 := 0.08
+	invSize := 1.0 / float64(size-1)
+	for i := range window {
+		t := float64(i) * invSize
+		window[i] = a0 - (a1 * math.Cos(2*math.Pi*t)) + (a2 * math.Cos(4*math.Pi*t))
+	}
+	return window
+}
+
+// cosineWindow generates a generalized two-term cosine window (Hann, Hamming).
+func cosineWindow(size int, a0, a1 float64) []float64 {
+	window := make([]float64, size)
+	invSize := 1.0 / float64(size-1)
+	for i := range window {
+		window[i] = a0 - a1*math.Cos(2*math.Pi*float64(i)*invSize)
+	}
+	return window
+}
@@ -1,8 +1,15 @@
 package inputs
 
+import (
+	"time"
+
+	graphics "github.com/richinsley/goshadertoy/graphics"
+)
+
 // Uniforms holds the global shader values that dynamic channels might need.
 type Uniforms struct {
 	Time              float32
+	TimeExact         float64 // Time at full precision; 0 takes Time
 	Mouse             [4]float32
 	Frame             int32 // Frame count for animations or effects
 	TimeDelta         float32
@@ -10,6 +17,12 @@ type Uniforms struct {
 	ChannelTime       [4]float32
 	SampleRate        float32
 	ChannelResolution [4][3]float32
+	Keyboard          *graphics.KeyboardState // Keys for keyboard channels; nil if none
+	Eye               float32                 // Stereo eye being rendered: -1 left, 1 right, 0 without stereo
+	EyeOffset         float32                 // Signed half eye separation of the eye being rendered
+	Date              time.Time               // Date and time iDate shows; set by the renderer
+	Seed              float32                 // iSeed, for shaders that declare it
+	Time64            [2]float32              // iTime64: the whole seconds and fraction of iTime; set by the renderer
 }
 
 // IChannel defines the contract for any Shadertoy input channel (iChannel0-3).
@@ -31,4 +44,7 @@ type IChannel interface {
 
 	// GetSamplerType returns the GLSL sampler type (e.g., "sampler2D", "samplerCube").
 	GetSamplerType() string
+
+	// GPUMemory returns the estimated GPU memory of the channel's textures, in bytes.
+	GPUMemory() int64
 }
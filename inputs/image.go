@@ -119,6 +119,12 @@ func (c *ImageChannel) Update(uniforms *Uniforms) { /*No-op for static images. *
 func (c *ImageChannel) GetTextureID() uint32      { return c.textureID }
 func (c *ImageChannel) ChannelRes() [3]float32    { return c.resolution }
 func (c *ImageChannel) Destroy()                  { gl.DeleteTextures(1, &c.textureID) }
+func (c *ImageChannel) GPUMemory() int64 {
+	if c.sampler.Internal == "float" {
+		return textureMemory(c.resolution, 8, c.sampler.Filter) // RGBA16F
+	}
+	return textureMemory(c.resolution, 4, c.sampler.Filter)
+}
 func (c *ImageChannel) GetSamplerType() string {
 	// All image inputs are currently treated as 2D textures.
 	return "sampler2D"
@@ -0,0 +1,65 @@
+package inputs
+
+import (
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// keyboardTextureWidth is the number of key codes in the keyboard texture.
+const keyboardTextureWidth = 256
+
+// KeyboardChannel is Shadertoy's keyboard input: a 256x3 texture indexed by
+// JavaScript key code whose rows are 1.0 for keys held, pressed this frame,
+// and toggled. It follows Uniforms.Keyboard, and is all zero without one.
+type KeyboardChannel struct {
+	textureID uint32
+	pixels    [3 * keyboardTextureWidth]byte
+}
+
+// NewKeyboardChannel creates the keyboard texture.
+func NewKeyboardChannel() (*KeyboardChannel, error) {
+	c := &KeyboardChannel{}
+	gl.GenTextures(1, &c.textureID)
+	gl.BindTexture(gl.TEXTURE_2D, c.textureID)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.R8, keyboardTextureWidth, 3, 0, gl.RED, gl.UNSIGNED_BYTE, gl.Ptr(&c.pixels[0]))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return c, nil
+}
+
+func (c *KeyboardChannel) Update(uniforms *Uniforms) {
+	var pixels [3 * keyboardTextureWidth]byte
+	if k := uniforms.Keyboard; k != nil {
+		for code := 0; code < keyboardTextureWidth; code++ {
+			pixels[code] = boolByte(k.Down[code])
+			pixels[keyboardTextureWidth+code] = boolByte(k.Pressed[code])
+			pixels[2*keyboardTextureWidth+code] = boolByte(k.Toggled[code])
+		}
+	}
+	if pixels == c.pixels {
+		return
+	}
+	c.pixels = pixels
+	gl.BindTexture(gl.TEXTURE_2D, c.textureID)
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, keyboardTextureWidth, 3, gl.RED, gl.UNSIGNED_BYTE, gl.Ptr(&c.pixels[0]))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 255
+	}
+	return 0
+}
+
+// IChannel Interface Implementation
+func (c *KeyboardChannel) GetCType() string       { return "keyboard" }
+func (c *KeyboardChannel) GetTextureID() uint32   { return c.textureID }
+func (c *KeyboardChannel) ChannelRes() [3]float32 { return [3]float32{keyboardTextureWidth, 3, 1} }
+func (c *KeyboardChannel) Destroy()               { gl.DeleteTextures(1, &c.textureID) }
+func (c *KeyboardChannel) GetSamplerType() string { return "sampler2D" }
+func (c *KeyboardChannel) GPUMemory() int64       { return textureMemory(c.ChannelRes(), 1, "") }
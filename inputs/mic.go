@@ -15,20 +15,24 @@ import (
 const (
 	textureWidth  = 512
 	textureHeight = 2
-	// Shadertoy uses an fftSize of 2048, which gives 1024 frequency bins.
-	fftInputSize = 2048
 )
 
 // MicChannel acts as a consumer of an audio stream.
+//
+// As a "spectrogram" channel it keeps a history instead: each frame adds a
+// row of FFT (red) and waveform (green) at the bottom of the texture and
+// scrolls the older rows up, so y is the age in frames.
 type MicChannel struct {
-	ctype           string
-	textureID       uint32
-	audioDevice     audio.AudioDevice
-	textureData     []float32 // This now holds the result of the last FFT
-	mode            string
-	lastFFT         []float64
-	smoothingFactor float64
-	dataMutex       sync.Mutex // Mutex to protect textureData between processing and uploading
+	ctype       string
+	textureID   uint32
+	audioDevice audio.AudioDevice
+	rows        int       // Texture height: 2, or the frames of history of a spectrogram
+	textureData []float32 // This now holds the result of the last FFT
+	mode        string
+	lastFFT     []float64
+	fftParams   FFTParams
+	window      []float64  // Precomputed window function for fftParams
+	dataMutex   sync.Mutex // Mutex to protect textureData between processing and uploading
 }
 
 // NewMicChannel creates a channel that gets data from the default microphone.
@@ -37,10 +41,20 @@ func NewMicChannel(options *options.ShaderOptions, sampler api.Sampler, ad audio
 }
 
 func NewMicChannelWithDevice(device audio.AudioDevice, options *options.ShaderOptions, sampler api.Sampler) (*MicChannel, error) {
+	return newMicChannel(device, options, sampler, "mic", textureHeight)
+}
+
+// NewSpectrogramChannel creates a channel with the last rows frames of FFT
+// and waveform of the audio input.
+func NewSpectrogramChannel(options *options.ShaderOptions, sampler api.Sampler, ad audio.AudioDevice, rows int) (*MicChannel, error) {
+	return newMicChannel(ad, options, sampler, "spectrogram", rows)
+}
+
+func newMicChannel(device audio.AudioDevice, options *options.ShaderOptions, sampler api.Sampler, ctype string, rows int) (*MicChannel, error) {
 	var textureID uint32
 	gl.GenTextures(1, &textureID)
 	gl.BindTexture(gl.TEXTURE_2D, textureID)
-	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RG32F, textureWidth, textureHeight, 0, gl.RG, gl.FLOAT, nil)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RG32F, textureWidth, int32(rows), 0, gl.RG, gl.FLOAT, nil)
 	minFilter, magFilter := getFilterMode(sampler.Filter)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, minFilter)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, magFilter)
@@ -49,25 +63,60 @@ func NewMicChannelWithDevice(device audio.AudioDevice, options *options.ShaderOp
 	gl.BindTexture(gl.TEXTURE_2D, 0)
 
 	mc := &MicChannel{
-		ctype:           "mic",
-		textureID:       textureID,
-		audioDevice:     device,
-		textureData:     make([]float32, textureWidth*textureHeight*2),
-		lastFFT:         make([]float64, textureWidth),
-		smoothingFactor: 0.8,
-		mode:            *options.Mode,
+		ctype:       ctype,
+		textureID:   textureID,
+		audioDevice: device,
+		rows:        rows,
+		textureData: make([]float32, textureWidth*rows*2),
+		lastFFT:     make([]float64, textureWidth),
+		mode:        *options.Mode,
+	}
+
+	if err := mc.SetFFTParams(FFTParamsFromOptions(options)); err != nil {
+		gl.DeleteTextures(1, &mc.textureID)
+		return nil, err
 	}
 
 	log.Printf("MicChannel configured with audio device.")
 	return mc, nil
 }
 
+// SetFFTParams changes the analysis parameters. It is safe to call while the
+// channel is in use, e.g. from a control interface.
+func (c *MicChannel) SetFFTParams(params FFTParams) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	window, _ := windowFunction(params.Window, params.Size)
+
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+	c.fftParams = params
+	c.window = window
+
+	// The shared buffer peek window holds interleaved stereo samples.
+	if c.audioDevice != nil {
+		c.audioDevice.GetBuffer().EnsureWindowSize(params.Size * 2)
+	}
+	return nil
+}
+
+// FFTParams returns the analysis parameters currently in use.
+func (c *MicChannel) FFTParams() FFTParams {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+	return c.fftParams
+}
+
 // ProcessAudio performs the FFT on the provided mono samples and stores the
 // result in the channel's internal textureData buffer. This should be called
 // from the main render thread before Update.
 func (c *MicChannel) ProcessAudio(monoSamples []float32) {
-	const minDecibels = -100.0
-	const maxDecibels = -30.0
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	params := c.fftParams
+	fftInputSize := params.Size
 
 	// Ensure we have enough samples for the FFT, pad with silence if necessary.
 	if len(monoSamples) < fftInputSize {
@@ -79,16 +128,17 @@ func (c *MicChannel) ProcessAudio(monoSamples []float32) {
 	// Use the most recent samples for the FFT
 	fftSamples := monoSamples[len(monoSamples)-fftInputSize:]
 
-	window := blackmanWindow(fftInputSize)
 	samples64 := make([]float64, fftInputSize)
 	for i, s := range fftSamples {
-		samples64[i] = float64(s) * window[i]
+		samples64[i] = float64(s) * c.window[i]
 	}
 
 	fftResult := fft.FFTReal(samples64)
 
-	c.dataMutex.Lock()
-	defer c.dataMutex.Unlock()
+	// A spectrogram scrolls its history up a row for the new frame.
+	if c.ctype == "spectrogram" {
+		copy(c.textureData[textureWidth*2:], c.textureData[:len(c.textureData)-textureWidth*2])
+	}
 
 	// Process FFT (Frequency) Data
 	for i := 0; i < textureWidth; i++ {
@@ -96,27 +146,32 @@ func (c *MicChannel) ProcessAudio(monoSamples []float32) {
 		im := imag(fftResult[i])
 		magnitude := math.Sqrt(re*re+im*im) * (2.0 / float64(fftInputSize))
 		db := 20 * math.Log10(magnitude+1e-9)
-		c.lastFFT[i] = (c.smoothingFactor * c.lastFFT[i]) + ((1.0 - c.smoothingFactor) * db)
+		c.lastFFT[i] = (params.Smoothing * c.lastFFT[i]) + ((1.0 - params.Smoothing) * db)
 		smoothedDb := c.lastFFT[i]
 
 		var scaledValue float32
-		if smoothedDb < minDecibels {
+		if smoothedDb < params.MinDecibels {
 			scaledValue = 0.0
-		} else if smoothedDb > maxDecibels {
+		} else if smoothedDb > params.MaxDecibels {
 			scaledValue = 1.0
 		} else {
-			scaledValue = float32((smoothedDb - minDecibels) / (maxDecibels - minDecibels))
+			scaledValue = float32((smoothedDb - params.MinDecibels) / (params.MaxDecibels - params.MinDecibels))
 		}
 
 		c.textureData[i*2] = scaledValue
 		c.textureData[i*2+1] = 0.0
 	}
 
-	// Process Waveform Data
+	// Process Waveform Data, into the second row, or green for a spectrogram
 	waveSegment := monoSamples[len(monoSamples)-textureWidth:]
 	for i := 0; i < textureWidth; i++ {
-		c.textureData[(textureWidth+i)*2] = (waveSegment[i] + 1.0) * 0.5
-		c.textureData[(textureWidth+i)*2+1] = 0.0
+		wave := (waveSegment[i] + 1.0) * 0.5
+		if c.ctype == "spectrogram" {
+			c.textureData[i*2+1] = wave
+		} else {
+			c.textureData[(textureWidth+i)*2] = wave
+			c.textureData[(textureWidth+i)*2+1] = 0.0
+		}
 	}
 }
 
@@ -126,7 +181,7 @@ func (c *MicChannel) Update(uniforms *Uniforms) {
 	defer c.dataMutex.Unlock()
 
 	gl.BindTexture(gl.TEXTURE_2D, c.textureID)
-	gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, textureWidth, textureHeight, gl.RG, gl.FLOAT, gl.Ptr(c.textureData))
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, textureWidth, int32(c.rows), gl.RG, gl.FLOAT, gl.Ptr(c.textureData))
 	gl.BindTexture(gl.TEXTURE_2D, 0)
 }
 
@@ -143,22 +198,9 @@ func (c *MicChannel) Destroy() {
 func (c *MicChannel) GetCType() string       { return c.ctype }
 func (c *MicChannel) GetTextureID() uint32   { return c.textureID }
 func (c *MicChannel) GetSamplerType() string { return "sampler2D" }
+func (c *MicChannel) GPUMemory() int64       { return textureMemory(c.ChannelRes(), 8, "") } // RG32F
 func (c *MicChannel) ChannelRes() [3]float32 {
-	return [3]float32{float32(textureWidth), float32(textureHeight), 0}
-}
-
-// blackmanWindow generates a Blackman window, as used by Shadertoy.
-func blackmanWindow(size int) []float64 {
-	window := make([]float64, size)
-	a0 := 0.42
-	a1 := 0.5
-	a2 := 0.08
-	invSize := 1.0 / float64(size-1)
-	for i := range window {
-		t := float64(i) * invSize
-		window[i] = a0 - (a1 * math.Cos(2*math.Pi*t)) + (a2 * math.Cos(4*math.Pi*t))
-	}
-	return window
+	return [3]float32{float32(textureWidth), float32(c.rows), 0}
 }
 
 // SampleRate returns the sample rate of the audio device.
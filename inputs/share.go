@@ -0,0 +1,62 @@
+package inputs
+
+import (
+	"fmt"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	api "github.com/richinsley/goshadertoy/api"
+	texshare "github.com/richinsley/goshadertoy/texshare"
+)
+
+// SharedTextureChannel shows the frames another application shares through
+// Syphon. Until the sender runs it is a black 1x1 texture.
+type SharedTextureChannel struct {
+	textureID uint32
+	receiver  *texshare.Receiver
+	width     int
+	height    int
+}
+
+// NewSharedTextureChannel receives the frames of the sender called name.
+func NewSharedTextureChannel(name string, sampler api.Sampler) (*SharedTextureChannel, error) {
+	receiver, err := texshare.NewReceiver(name)
+	if err != nil {
+		return nil, fmt.Errorf("shared texture channel: %w", err)
+	}
+	c := &SharedTextureChannel{receiver: receiver, width: 1, height: 1}
+	gl.GenTextures(1, &c.textureID)
+	gl.BindTexture(gl.TEXTURE_2D, c.textureID)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, getWrapMode(sampler.Wrap))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, getWrapMode(sampler.Wrap))
+	// Frames replace the texture's level 0 only, so it isn't mipmapped.
+	filter := int32(gl.NEAREST)
+	if sampler.Filter == "linear" || sampler.Filter == "mipmap" {
+		filter = gl.LINEAR
+	}
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, filter)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, filter)
+	black := []uint8{0, 0, 0, 255}
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA8, 1, 1, 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(black))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return c, nil
+}
+
+func (c *SharedTextureChannel) Update(uniforms *Uniforms) {
+	if width, height := c.receiver.Receive(c.textureID); width > 0 && height > 0 {
+		c.width, c.height = width, height
+	}
+}
+
+// IChannel Interface Implementation
+func (c *SharedTextureChannel) GetCType() string     { return "share" }
+func (c *SharedTextureChannel) GetTextureID() uint32 { return c.textureID }
+func (c *SharedTextureChannel) ChannelRes() [3]float32 {
+	return [3]float32{float32(c.width), float32(c.height), 1}
+}
+func (c *SharedTextureChannel) GetSamplerType() string { return "sampler2D" }
+func (c *SharedTextureChannel) GPUMemory() int64       { return textureMemory(c.ChannelRes(), 4, "") }
+
+func (c *SharedTextureChannel) Destroy() {
+	c.receiver.Close()
+	gl.DeleteTextures(1, &c.textureID)
+}
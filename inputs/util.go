@@ -29,3 +29,15 @@ func getFilterMode(filter string) (minFilter, magFilter int32) {
 		return gl.LINEAR, gl.LINEAR // Default behavior
 	}
 }
+
+// textureMemory estimates the GPU memory of a texture of resolution res with
+// bytesPerTexel, including its mipmap chain if filter is "mipmap".
+func textureMemory(res [3]float32, bytesPerTexel int, filter string) int64 {
+	w, h, d := max(1, int64(res[0])), max(1, int64(res[1])), max(1, int64(res[2]))
+	total := w * h * d * int64(bytesPerTexel)
+	for filter == "mipmap" && (w > 1 || h > 1 || d > 1) {
+		w, h, d = max(1, w/2), max(1, h/2), max(1, d/2)
+		total += w * h * d * int64(bytesPerTexel)
+	}
+	return total
+}
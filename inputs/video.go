@@ -0,0 +1,475 @@
+package inputs
+
+/*
+#include <stdlib.h>
+#include <libavformat/avformat.h>
+#include <libavcodec/avcodec.h>
+#include <libavutil/hwcontext.h>
+#include <libswscale/swscale.h>
+
+typedef struct {
+    AVFormatContext *fmt;
+    AVCodecContext *codec;
+    const AVCodec *decoder;
+    AVBufferRef *hw_device;
+    enum AVPixelFormat hw_format; // AV_PIX_FMT_NONE without a hardware decoder
+    struct SwsContext *sws;
+    AVPacket *pkt;
+    AVFrame *frame;
+    AVFrame *sw_frame; // A hardware frame downloaded to system memory
+    int stream;
+    int width, height;
+    double time_base;
+    double start;
+    double duration;
+} video_decoder;
+
+static inline const char* video_error_str(int errnum) {
+    static char str[AV_ERROR_MAX_STRING_SIZE];
+    return av_make_error_string(str, AV_ERROR_MAX_STRING_SIZE, errnum);
+}
+
+// video_open opens the first video stream of url, read with the input format
+// format if not empty. video_hw_init may pick a hardware decoder before
+// video_open_codec opens the decoder.
+static int video_open(video_decoder *d, const char *url, const char *format) {
+    const AVInputFormat *ifmt = NULL;
+    AVStream *st;
+    int ret;
+
+    d->hw_format = AV_PIX_FMT_NONE;
+    if (format[0]) {
+        ifmt = av_find_input_format(format);
+        if (!ifmt) return AVERROR_DEMUXER_NOT_FOUND;
+    }
+    if ((ret = avformat_open_input(&d->fmt, url, ifmt, NULL)) < 0) return ret;
+    if ((ret = avformat_find_stream_info(d->fmt, NULL)) < 0) return ret;
+    d->stream = av_find_best_stream(d->fmt, AVMEDIA_TYPE_VIDEO, -1, -1, &d->decoder, 0);
+    if (d->stream < 0) return d->stream;
+    st = d->fmt->streams[d->stream];
+
+    d->codec = avcodec_alloc_context3(d->decoder);
+    if (!d->codec) return AVERROR(ENOMEM);
+    return avcodec_parameters_to_context(d->codec, st->codecpar);
+}
+
+// video_get_format picks the hardware format where the decoder offers it for
+// a frame, and a software one where it doesn't, e.g. for a profile the GPU
+// can't decode.
+static enum AVPixelFormat video_get_format(AVCodecContext *ctx, const enum AVPixelFormat *formats) {
+    video_decoder *d = ctx->opaque;
+    const enum AVPixelFormat *p;
+    for (p = formats; *p != AV_PIX_FMT_NONE; p++) {
+        if (*p == d->hw_format) return *p;
+    }
+    return avcodec_default_get_format(ctx, formats);
+}
+
+// video_hw_init makes the decoder decode on the hardware device type name,
+// e.g. "cuda", "vaapi" or "videotoolbox".
+static int video_hw_init(video_decoder *d, const char *name) {
+    enum AVHWDeviceType type = av_hwdevice_find_type_by_name(name);
+    const AVCodecHWConfig *config;
+    int i, ret;
+
+    if (type == AV_HWDEVICE_TYPE_NONE) return AVERROR(EINVAL);
+    for (i = 0;; i++) {
+        config = avcodec_get_hw_config(d->decoder, i);
+        if (!config) return AVERROR(ENOSYS);
+        if ((config->methods & AV_CODEC_HW_CONFIG_METHOD_HW_DEVICE_CTX) && config->device_type == type) break;
+    }
+    if ((ret = av_hwdevice_ctx_create(&d->hw_device, type, NULL, NULL, 0)) < 0) return ret;
+    d->codec->hw_device_ctx = av_buffer_ref(d->hw_device);
+    if (!d->codec->hw_device_ctx) return AVERROR(ENOMEM);
+    d->hw_format = config->pix_fmt;
+    d->codec->opaque = d;
+    d->codec->get_format = video_get_format;
+    return 0;
+}
+
+static int video_open_codec(video_decoder *d) {
+    AVStream *st = d->fmt->streams[d->stream];
+    int ret;
+
+    if ((ret = avcodec_open2(d->codec, d->decoder, NULL)) < 0) return ret;
+    d->width = d->codec->width;
+    d->height = d->codec->height;
+    if (d->width <= 0 || d->height <= 0) return AVERROR_INVALIDDATA;
+
+    d->pkt = av_packet_alloc();
+    d->frame = av_frame_alloc();
+    d->sw_frame = av_frame_alloc();
+    if (!d->pkt || !d->frame || !d->sw_frame) return AVERROR(ENOMEM);
+    d->time_base = av_q2d(st->time_base);
+    d->start = st->start_time != AV_NOPTS_VALUE ? st->start_time * d->time_base : 0;
+    d->duration = d->fmt->duration > 0 ? d->fmt->duration / (double)AV_TIME_BASE : 0;
+    return 0;
+}
+
+// video_next decodes the next frame into rgba, width * height top-down RGBA
+// pixels, and sets pts to its time in seconds, or -1 if it has none.
+// Hardware frames are downloaded first; there is no GL interop.
+static int video_next(video_decoder *d, uint8_t *rgba, double *pts) {
+    int ret;
+    for (;;) {
+        ret = avcodec_receive_frame(d->codec, d->frame);
+        if (ret == 0) {
+            AVFrame *f = d->frame;
+            uint8_t *dst[4] = {rgba, NULL, NULL, NULL};
+            int stride[4] = {d->width * 4, 0, 0, 0};
+            *pts = f->best_effort_timestamp == AV_NOPTS_VALUE ? -1 : f->best_effort_timestamp * d->time_base - d->start;
+            if (f->format == d->hw_format) {
+                ret = av_hwframe_transfer_data(d->sw_frame, f, 0);
+                av_frame_unref(f);
+                if (ret < 0) return ret;
+                f = d->sw_frame;
+            }
+            d->sws = sws_getCachedContext(d->sws, f->width, f->height, f->format,
+                d->width, d->height, AV_PIX_FMT_RGBA, SWS_BILINEAR, NULL, NULL, NULL);
+            if (!d->sws) {
+                av_frame_unref(f);
+                return AVERROR(EINVAL);
+            }
+            sws_scale(d->sws, (const uint8_t * const *)f->data, f->linesize, 0, f->height, dst, stride);
+            av_frame_unref(f);
+            return 0;
+        }
+        if (ret != AVERROR(EAGAIN)) return ret;
+
+        ret = av_read_frame(d->fmt, d->pkt);
+        if (ret == AVERROR_EOF) {
+            avcodec_send_packet(d->codec, NULL); // Drain the decoder
+            continue;
+        }
+        if (ret < 0) return ret;
+        if (d->pkt->stream_index == d->stream) ret = avcodec_send_packet(d->codec, d->pkt);
+        av_packet_unref(d->pkt);
+        if (ret < 0 && ret != AVERROR_INVALIDDATA) return ret;
+    }
+}
+
+// video_seek moves to the last key frame at or before seconds.
+static int video_seek(video_decoder *d, double seconds) {
+    int64_t ts = (int64_t)((seconds + d->start) / d->time_base);
+    int ret = av_seek_frame(d->fmt, d->stream, ts, AVSEEK_FLAG_BACKWARD);
+    avcodec_flush_buffers(d->codec);
+    return ret;
+}
+
+static int video_is_eof(int ret) {
+    return ret == AVERROR_EOF;
+}
+
+static void video_close(video_decoder *d) {
+    sws_freeContext(d->sws);
+    av_frame_free(&d->frame);
+    av_frame_free(&d->sw_frame);
+    av_packet_free(&d->pkt);
+    avcodec_free_context(&d->codec);
+    av_buffer_unref(&d->hw_device);
+    avformat_close_input(&d->fmt);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	api "github.com/richinsley/goshadertoy/api"
+)
+
+// seekThreshold is how far in seconds a video file is behind the shader
+// before it seeks instead of decoding its way there.
+const seekThreshold = 2.0
+
+// VideoChannel plays a video into a texture. Files follow the shader's time
+// and loop, so recordings are deterministic; capture devices show their
+// newest frame.
+type VideoChannel struct {
+	ctype      string
+	textureID  uint32
+	resolution [3]float32
+	sampler    api.Sampler
+	dec        *C.video_decoder
+	width      int
+	height     int
+	upload     []byte // Frame in texture row order
+
+	// Files
+	frame      []byte  // Decoded frame, top-down
+	framePTS   float64 // Time of frame; -1 before the first
+	pending    []byte  // Frame decoded ahead of the shader's time
+	pendingPTS float64
+	hasPending bool
+	duration   float64 // 0 until known
+
+	// Capture devices
+	mu     sync.Mutex
+	latest []byte // Newest captured frame, top-down
+	fresh  bool   // latest hasn't been uploaded
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// hwaccelTypes returns the FFmpeg hardware device types hwaccel tries, in
+// order: those of the platform's GPUs for "auto", none for "none", else
+// hwaccel itself.
+func hwaccelTypes(hwaccel string) []string {
+	switch hwaccel {
+	case "none":
+		return nil
+	case "auto":
+		switch runtime.GOOS {
+		case "darwin":
+			return []string{"videotoolbox"}
+		case "windows":
+			return []string{"cuda", "d3d11va", "dxva2"}
+		default:
+			return []string{"cuda", "vaapi"}
+		}
+	}
+	return []string{hwaccel}
+}
+
+// webcamFormat returns the FFmpeg input format and default device of the
+// platform's cameras.
+func webcamFormat() (format, device string) {
+	switch runtime.GOOS {
+	case "darwin":
+		return "avfoundation", "0"
+	case "windows":
+		return "dshow", ""
+	default:
+		return "v4l2", "/dev/video0"
+	}
+}
+
+// NewVideoChannel opens source, a video file or URL, or with capture a
+// camera device (empty for the default one). Files and URLs are decoded on
+// the GPU with hwaccel, an FFmpeg hardware device type, "auto" or "none",
+// and on the CPU where it can't decode them. Decoded frames still reach the
+// texture through system memory.
+func NewVideoChannel(source string, capture bool, sampler api.Sampler, hwaccel string) (*VideoChannel, error) {
+	var format string
+	ctype := "video"
+	if capture {
+		var device string
+		format, device = webcamFormat()
+		if source == "" {
+			source = device
+		}
+		if source == "" {
+			return nil, fmt.Errorf("webcam channels need a device on %s, e.g. webcam:video=NAME", runtime.GOOS)
+		}
+		ctype = "webcam"
+	}
+
+	dec := (*C.video_decoder)(C.calloc(1, C.size_t(unsafe.Sizeof(C.video_decoder{}))))
+	cSource := C.CString(source)
+	defer C.free(unsafe.Pointer(cSource))
+	cFormat := C.CString(format)
+	defer C.free(unsafe.Pointer(cFormat))
+	if ret := C.video_open(dec, cSource, cFormat); ret < 0 {
+		C.video_close(dec)
+		C.free(unsafe.Pointer(dec))
+		return nil, fmt.Errorf("failed to open %s: %s", source, C.GoString(C.video_error_str(ret)))
+	}
+	decoder := "software"
+	if !capture {
+		for _, name := range hwaccelTypes(hwaccel) {
+			cName := C.CString(name)
+			ret := C.video_hw_init(dec, cName)
+			C.free(unsafe.Pointer(cName))
+			if ret == 0 {
+				decoder = name
+				break
+			}
+			if hwaccel != "auto" {
+				log.Printf("Warning: cannot decode %s with %s, decoding in software: %s", source, name, C.GoString(C.video_error_str(ret)))
+			}
+		}
+	}
+	if ret := C.video_open_codec(dec); ret < 0 {
+		C.video_close(dec)
+		C.free(unsafe.Pointer(dec))
+		return nil, fmt.Errorf("failed to open decoder for %s: %s", source, C.GoString(C.video_error_str(ret)))
+	}
+
+	c := &VideoChannel{
+		ctype:    ctype,
+		sampler:  sampler,
+		dec:      dec,
+		width:    int(dec.width),
+		height:   int(dec.height),
+		framePTS: -1,
+		duration: float64(dec.duration),
+	}
+	size := c.width * c.height * 4
+	c.upload = make([]byte, size)
+	c.resolution = [3]float32{float32(c.width), float32(c.height), 1.0}
+
+	gl.GenTextures(1, &c.textureID)
+	gl.BindTexture(gl.TEXTURE_2D, c.textureID)
+	var internalFormat int32 = gl.RGBA8
+	if sampler.SRGB == "true" {
+		internalFormat = gl.SRGB8_ALPHA8
+	}
+	gl.TexImage2D(gl.TEXTURE_2D, 0, internalFormat, int32(c.width), int32(c.height), 0, gl.RGBA, gl.UNSIGNED_BYTE, nil)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, getWrapMode(sampler.Wrap))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, getWrapMode(sampler.Wrap))
+	minFilter, magFilter := getFilterMode(sampler.Filter)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, minFilter)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, magFilter)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+
+	if capture {
+		c.latest = make([]byte, size)
+		c.stop = make(chan struct{})
+		c.done = make(chan struct{})
+		go c.capture()
+	} else {
+		c.frame = make([]byte, size)
+		c.pending = make([]byte, size)
+	}
+	log.Printf("Opened %s %s: %dx%d, %s decoding", ctype, source, c.width, c.height, decoder)
+	return c, nil
+}
+
+// capture decodes a capture device until Destroy.
+func (c *VideoChannel) capture() {
+	defer close(c.done)
+	frame := make([]byte, len(c.latest))
+	for {
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+		var pts C.double
+		if ret := C.video_next(c.dec, (*C.uint8_t)(unsafe.Pointer(&frame[0])), &pts); ret < 0 {
+			log.Printf("Warning: webcam capture stopped: %s", C.GoString(C.video_error_str(ret)))
+			return
+		}
+		c.mu.Lock()
+		c.latest, frame = frame, c.latest
+		c.fresh = true
+		c.mu.Unlock()
+	}
+}
+
+// decode decodes the next frame of a file into pending, looping at its end.
+func (c *VideoChannel) decode() bool {
+	var pts C.double
+	ret := C.video_next(c.dec, (*C.uint8_t)(unsafe.Pointer(&c.pending[0])), &pts)
+	if C.video_is_eof(ret) != 0 {
+		if c.duration == 0 {
+			// Not in the container: as long as it played.
+			c.duration = math.Max(c.framePTS, 0) + 1.0/30
+		}
+		return false
+	}
+	if ret < 0 {
+		log.Printf("Warning: video decoding failed: %s", C.GoString(C.video_error_str(ret)))
+		return false
+	}
+	c.pendingPTS = float64(pts)
+	if c.pendingPTS < 0 {
+		c.pendingPTS = c.framePTS + 1.0/30 // No timestamps; assume 30 fps
+	}
+	c.hasPending = true
+	return true
+}
+
+// seek moves a file to t seconds, discarding decoded frames.
+func (c *VideoChannel) seek(t float64) {
+	C.video_seek(c.dec, C.double(t))
+	c.framePTS = -1
+	c.hasPending = false
+}
+
+// advance decodes a file up to the frame showing at time t and reports
+// whether the frame changed.
+func (c *VideoChannel) advance(t float64) bool {
+	if c.duration > 0 {
+		t = math.Mod(t, c.duration)
+	}
+	if t < c.framePTS || t-c.framePTS > seekThreshold {
+		c.seek(t)
+	}
+	changed := false
+	for {
+		if !c.hasPending && !c.decode() {
+			return changed // At the end, the last frame holds until t loops back
+		}
+		if c.pendingPTS > t && c.framePTS >= 0 {
+			return changed
+		}
+		c.frame, c.pending = c.pending, c.frame
+		c.framePTS = c.pendingPTS
+		c.hasPending = false
+		changed = true
+	}
+}
+
+// Update uploads the frame for the shader's time, or the newest captured one.
+func (c *VideoChannel) Update(uniforms *Uniforms) {
+	var frame []byte
+	if c.stop != nil {
+		c.mu.Lock()
+		if c.fresh {
+			c.fresh = false
+			frame = c.upload
+			c.flipInto(frame, c.latest)
+		}
+		c.mu.Unlock()
+	} else if c.advance(float64(uniforms.Time)) {
+		frame = c.upload
+		c.flipInto(frame, c.frame)
+	}
+	if frame == nil {
+		return
+	}
+
+	gl.BindTexture(gl.TEXTURE_2D, c.textureID)
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, int32(c.width), int32(c.height), gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(frame))
+	if c.sampler.Filter == "mipmap" {
+		gl.GenerateMipmap(gl.TEXTURE_2D)
+	}
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+// flipInto copies a top-down frame to dst in the row order the sampler's
+// vflip asks for.
+func (c *VideoChannel) flipInto(dst, src []byte) {
+	if c.sampler.VFlip != "true" {
+		copy(dst, src)
+		return
+	}
+	stride := c.width * 4
+	for y := 0; y < c.height; y++ {
+		copy(dst[y*stride:(y+1)*stride], src[(c.height-1-y)*stride:])
+	}
+}
+
+// IChannel Interface Implementation
+func (c *VideoChannel) GetCType() string       { return c.ctype }
+func (c *VideoChannel) GetTextureID() uint32   { return c.textureID }
+func (c *VideoChannel) ChannelRes() [3]float32 { return c.resolution }
+func (c *VideoChannel) GetSamplerType() string { return "sampler2D" }
+func (c *VideoChannel) GPUMemory() int64       { return textureMemory(c.resolution, 4, c.sampler.Filter) }
+
+func (c *VideoChannel) Destroy() {
+	if c.stop != nil {
+		close(c.stop)
+		<-c.done
+	}
+	C.video_close(c.dec)
+	C.free(unsafe.Pointer(c.dec))
+	gl.DeleteTextures(1, &c.textureID)
+}
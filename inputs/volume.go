@@ -14,6 +14,7 @@ type VolumeChannel struct {
 	textureID  uint32
 	resolution [3]float32
 	sampler    api.Sampler
+	texelBytes int
 }
 
 // NewVolumeChannel creates and initializes a new OpenGL 3D texture from parsed .bin volume data.
@@ -76,11 +77,21 @@ func NewVolumeChannel(vol *api.VolumeData, sampler api.Sampler) (*VolumeChannel,
 			float32(vol.Height),
 			float32(vol.Depth),
 		},
-		sampler: sampler,
+		sampler:    sampler,
+		texelBytes: volumeTexelBytes(vol.NumChannels, vol.Format),
 	}, nil
 }
 
 // getVolumeFormat translates Shadertoy's .bin format codes into OpenGL constants.
+// volumeTexelBytes returns the size of a texel of the format getVolumeFormat
+// chooses.
+func volumeTexelBytes(numChannels uint8, binFormat uint16) int {
+	if binFormat == 10 {
+		return int(numChannels) * 4
+	}
+	return int(numChannels)
+}
+
 func getVolumeFormat(numChannels uint8, binFormat uint16) (internalFormat int32, format uint32, typ uint32, err error) {
 	// Determine the data type (gl.FLOAT or gl.UNSIGNED_BYTE)
 	switch binFormat {
@@ -131,3 +142,6 @@ func (c *VolumeChannel) GetTextureID() uint32      { return c.textureID }
 func (c *VolumeChannel) ChannelRes() [3]float32    { return c.resolution }
 func (c *VolumeChannel) Destroy()                  { gl.DeleteTextures(1, &c.textureID) }
 func (c *VolumeChannel) GetSamplerType() string    { return "sampler3D" }
+func (c *VolumeChannel) GPUMemory() int64 {
+	return textureMemory(c.resolution, c.texelBytes, c.sampler.Filter)
+}
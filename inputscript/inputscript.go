@@ -0,0 +1,193 @@
+// Package inputscript plays a timeline of mouse and keyboard events into the
+// iMouse uniform and keyboard channels, so interactive shaders can be
+// rendered deterministically.
+//
+// A script is a JSON file:
+//
+//	{"events": [
+//	  {"time": 1.0, "type": "mousedown", "x": 0.25, "y": 0.5},
+//	  {"time": 1.5, "type": "mousemove", "x": 0.75, "y": 0.5},
+//	  {"time": 2.0, "type": "mouseup"},
+//	  {"time": 3.0, "type": "keydown", "key": 32},
+//	  {"time": 3.2, "type": "keyup", "key": 32}
+//	]}
+//
+// Times are in seconds of shader time. Positions are fractions of the frame
+// from its bottom left corner, so a script plays at any resolution; mouse
+// events without one keep the pointer where it is. Keys are JavaScript key
+// codes, as Shadertoy's keyboard texture uses.
+package inputscript
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	graphics "github.com/richinsley/goshadertoy/graphics"
+)
+
+// Event types.
+const (
+	MouseMove = "mousemove"
+	MouseDown = "mousedown"
+	MouseUp   = "mouseup"
+	KeyDown   = "keydown"
+	KeyUp     = "keyup"
+)
+
+// Event is one input event of a script.
+type Event struct {
+	Time float64  `json:"time"`
+	Type string   `json:"type"`
+	X    *float64 `json:"x,omitempty"`
+	Y    *float64 `json:"y,omitempty"`
+	Key  int      `json:"key,omitempty"`
+}
+
+// Script is a timeline of input events, in time order.
+type Script struct {
+	Events []Event `json:"events"`
+}
+
+// Load reads and checks a script file.
+func Load(path string) (*Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Script
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid input script %s: %w", path, err)
+	}
+	for i, ev := range s.Events {
+		switch ev.Type {
+		case MouseMove, MouseDown, MouseUp:
+		case KeyDown, KeyUp:
+			if ev.Key < 0 || ev.Key > 255 {
+				return nil, fmt.Errorf("input script %s: event %d: key code %d is not in 0-255", path, i, ev.Key)
+			}
+		default:
+			return nil, fmt.Errorf("input script %s: event %d: unknown type '%s'", path, i, ev.Type)
+		}
+		if ev.Time < 0 {
+			return nil, fmt.Errorf("input script %s: event %d: negative time", path, i)
+		}
+	}
+	sort.SliceStable(s.Events, func(i, j int) bool { return s.Events[i].Time < s.Events[j].Time })
+	return &s, nil
+}
+
+// Player plays a script frame by frame.
+type Player struct {
+	events []Event
+	next   int
+	x, y   float64 // Pointer as fractions of the frame
+	down   bool
+	mouse  graphics.MouseState
+	keys   graphics.KeyboardState
+}
+
+// NewPlayer returns a player at the start of the script.
+func (s *Script) NewPlayer() *Player {
+	return &Player{events: s.Events}
+}
+
+// Frame applies the events up to t, the time of a frame, and returns iMouse
+// and the keyboard for the frame when rendered at width x height. Frames must
+// be played in order. A click that starts and ends between two frames
+// registers as a click on the second.
+func (p *Player) Frame(t float64, width, height int) ([4]float32, *graphics.KeyboardState) {
+	p.keys.NextFrame()
+	clicked := false
+	for ; p.next < len(p.events) && p.events[p.next].Time <= t; p.next++ {
+		ev := p.events[p.next]
+		if ev.X != nil {
+			p.x = *ev.X
+		}
+		if ev.Y != nil {
+			p.y = *ev.Y
+		}
+		switch ev.Type {
+		case MouseDown:
+			p.down = true
+			clicked = true
+		case MouseUp:
+			p.down = false
+		case KeyDown:
+			p.keys.Press(ev.Key)
+		case KeyUp:
+			p.keys.Release(ev.Key)
+		}
+	}
+	mouse := p.mouse.Update(p.x*float64(width), p.y*float64(height), p.down || clicked)
+	return mouse, &p.keys
+}
+
+// Save writes the script as JSON.
+func (s *Script) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Recorder builds a script from the iMouse and keyboard of successive
+// frames, such that playing it reproduces them at any resolution.
+type Recorder struct {
+	script    Script
+	lastMouse [4]float32
+	lastKeys  graphics.KeyboardState
+}
+
+// Frame records the input of the frame at time t, rendered at width x height.
+func (r *Recorder) Frame(t float64, mouse [4]float32, keys *graphics.KeyboardState, width, height int) {
+	at := func(x, y float32) (*float64, *float64) {
+		fx, fy := float64(x)/float64(width), float64(y)/float64(height)
+		return &fx, &fy
+	}
+	add := func(typ string, x, y *float64, key int) {
+		r.script.Events = append(r.script.Events, Event{Time: t, Type: typ, X: x, Y: y, Key: key})
+	}
+
+	wasDown := r.lastMouse[2] > 0
+	switch {
+	case mouse[3] > 0: // Clicked this frame
+		if wasDown {
+			add(MouseUp, nil, nil, 0)
+		}
+		x, y := at(mouse[2], mouse[3])
+		add(MouseDown, x, y, 0)
+	case mouse[2] > 0 && (mouse[0] != r.lastMouse[0] || mouse[1] != r.lastMouse[1]):
+		x, y := at(mouse[0], mouse[1])
+		add(MouseMove, x, y, 0)
+	}
+	if wasDown && mouse[2] <= 0 && mouse[3] <= 0 {
+		add(MouseUp, nil, nil, 0)
+	}
+	r.lastMouse = mouse
+
+	if keys == nil {
+		keys = &graphics.KeyboardState{}
+	}
+	for code := range keys.Down {
+		if keys.Pressed[code] {
+			if r.lastKeys.Down[code] {
+				add(KeyUp, nil, nil, code)
+			}
+			add(KeyDown, nil, nil, code)
+			if !keys.Down[code] {
+				add(KeyUp, nil, nil, code)
+			}
+		} else if r.lastKeys.Down[code] && !keys.Down[code] {
+			add(KeyUp, nil, nil, code)
+		}
+	}
+	r.lastKeys = *keys
+}
+
+// Script returns the events recorded so far.
+func (r *Recorder) Script() *Script {
+	return &r.script
+}
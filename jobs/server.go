@@ -0,0 +1,445 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/richinsley/goshadertoy/logging"
+)
+
+// Request describes a render job submitted over HTTP. Zero fields use the
+// server's defaults, i.e. the options it was started with.
+type Request struct {
+	Shader   string  `json:"shader"`
+	Duration float64 `json:"duration,omitempty"`
+	Width    int     `json:"width,omitempty"`
+	Height   int     `json:"height,omitempty"`
+	FPS      int     `json:"fps,omitempty"`
+	BitDepth int     `json:"bitdepth,omitempty"`
+	Codec    string  `json:"codec,omitempty"`
+}
+
+// Limits keep a single request from monopolizing the server.
+const (
+	maxDuration  = 3600
+	maxDimension = 7680
+	maxFPS       = 240
+)
+
+var shaderIDPattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+func (r Request) validate() error {
+	if !shaderIDPattern.MatchString(r.Shader) {
+		return fmt.Errorf("invalid shader ID '%s'", r.Shader)
+	}
+	if r.Duration < 0 || r.Duration > maxDuration {
+		return fmt.Errorf("duration must be between 0 and %d seconds", maxDuration)
+	}
+	if r.Width < 0 || r.Width > maxDimension || r.Height < 0 || r.Height > maxDimension {
+		return fmt.Errorf("width and height must be at most %d", maxDimension)
+	}
+	if r.Width%2 != 0 || r.Height%2 != 0 {
+		return fmt.Errorf("width and height must be even")
+	}
+	if r.FPS < 0 || r.FPS > maxFPS {
+		return fmt.Errorf("fps must be at most %d", maxFPS)
+	}
+	if r.BitDepth != 0 && r.BitDepth != 8 && r.BitDepth != 10 && r.BitDepth != 12 {
+		return fmt.Errorf("bitdepth must be 8, 10, or 12")
+	}
+	if r.Codec != "" && r.Codec != "h264" && r.Codec != "hevc" && r.Codec != "av1" {
+		return fmt.Errorf("codec must be h264, hevc, or av1")
+	}
+	return nil
+}
+
+// Job states.
+const (
+	StateQueued    = "queued"
+	StateRunning   = "running"
+	StateDone      = "done"
+	StateFailed    = "failed"
+	StateCancelled = "cancelled"
+)
+
+// Job is a queued or finished render.
+type Job struct {
+	ID      string
+	Request Request
+	Output  string // Path of the rendered file
+
+	mu          sync.Mutex
+	state       string
+	err         string
+	created     time.Time
+	started     time.Time
+	finished    time.Time
+	framesDone  int64
+	framesTotal int64
+	cancel      func()
+}
+
+// Status is the JSON representation of a job.
+type Status struct {
+	ID          string    `json:"id"`
+	Request     Request   `json:"request"`
+	State       string    `json:"state"`
+	Error       string    `json:"error,omitempty"`
+	FramesDone  int64     `json:"framesDone"`
+	FramesTotal int64     `json:"framesTotal"`
+	Progress    float64   `json:"progress"`
+	Created     time.Time `json:"created"`
+	Started     time.Time `json:"started"`
+	Finished    time.Time `json:"finished"`
+	OutputURL   string    `json:"outputUrl,omitempty"`
+}
+
+// SetProgress records how many frames of the job have been rendered.
+func (j *Job) SetProgress(done, total int64) {
+	j.mu.Lock()
+	j.framesDone, j.framesTotal = done, total
+	j.mu.Unlock()
+}
+
+// SetCancel registers the function that stops the job while it is running. If
+// the job was cancelled already, cancel is called right away.
+func (j *Job) SetCancel(cancel func()) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.cancel = cancel
+	if j.state == StateCancelled {
+		cancel()
+	}
+}
+
+// Cancelled reports whether the job was cancelled.
+func (j *Job) Cancelled() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state == StateCancelled
+}
+
+func (j *Job) status() Status {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	s := Status{
+		ID:          j.ID,
+		Request:     j.Request,
+		State:       j.state,
+		Error:       j.err,
+		FramesDone:  j.framesDone,
+		FramesTotal: j.framesTotal,
+		Created:     j.created,
+		Started:     j.started,
+		Finished:    j.finished,
+	}
+	if j.framesTotal > 0 {
+		s.Progress = float64(j.framesDone) / float64(j.framesTotal)
+	}
+	if j.state == StateDone {
+		s.Progress = 1
+		s.OutputURL = "/jobs/" + j.ID + "/output"
+	}
+	return s
+}
+
+// Runner renders a job to job.Output. It is called on the goroutine that calls
+// Server.Run, one job at a time.
+type Runner func(job *Job) error
+
+// Server queues render jobs submitted over a REST API:
+//
+//	POST   /jobs             submit a Request, returns the job Status
+//	GET    /jobs             list all jobs
+//	GET    /jobs/{id}        job status and progress
+//	GET    /jobs/{id}/output download the finished file
+//	DELETE /jobs/{id}        cancel a queued or running job
+//
+// Every request needs the server's token, as the token query parameter or an
+// "Authorization: Bearer" header.
+type Server struct {
+	dir       string
+	extension string
+	queue     chan *Job
+	token     string
+
+	// Finished jobs and their outputs are removed once older than ttl, or
+	// beyond the keep most recent ones; zero disables either limit.
+	ttl  time.Duration
+	keep int
+
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	order  []*Job
+	nextID int
+}
+
+// NewServer creates a job server writing outputs with the given extension
+// (e.g. ".mp4") to dir. At most queueSize jobs may wait at once. An empty
+// token is replaced by a random one, logged when the server starts listening.
+func NewServer(dir, extension string, queueSize int, token string) (*Server, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create job directory: %w", err)
+	}
+	if token == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate token: %w", err)
+		}
+		token = hex.EncodeToString(b)
+		log.Printf("Job server token: %s", token)
+	}
+	logging.Redact(token) // Kept out of diagnostics
+
+	return &Server{
+		dir:       dir,
+		extension: extension,
+		queue:     make(chan *Job, queueSize),
+		token:     token,
+		jobs:      make(map[string]*Job),
+	}, nil
+}
+
+// SetRetention removes finished jobs, with their outputs, once they finished
+// more than ttl ago or more than keep newer jobs have finished. Zero disables
+// either limit. It must be called before Run.
+func (s *Server) SetRetention(ttl time.Duration, keep int) {
+	s.ttl, s.keep = ttl, keep
+}
+
+// ListenAndServe serves the API on addr in the background.
+func (s *Server) ListenAndServe(addr string) {
+	go func() {
+		log.Printf("Job server listening on http://%s/jobs", addr)
+		if err := http.ListenAndServe(addr, s.handler()); err != nil {
+			log.Fatalf("Job server stopped: %v", err)
+		}
+	}()
+}
+
+// Serve serves the REST API on an existing listener in the background, e.g.
+// one passed by systemd socket activation.
+func (s *Server) Serve(l net.Listener) {
+	go func() {
+		log.Printf("Job server listening on http://%s/jobs", l.Addr())
+		if err := http.Serve(l, s.handler()); err != nil {
+			log.Fatalf("Job server stopped: %v", err)
+		}
+	}()
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", s.submit)
+	mux.HandleFunc("GET /jobs", s.list)
+	mux.HandleFunc("GET /jobs/{id}", s.get)
+	mux.HandleFunc("GET /jobs/{id}/output", s.output)
+	mux.HandleFunc("DELETE /jobs/{id}", s.cancel)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			token = bearer
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			http.Error(w, "missing or wrong token", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Run executes queued jobs with runner until the process exits. Rendering needs
+// a thread with a current GL context, so it is called from the main goroutine.
+func (s *Server) Run(runner Runner) {
+	if s.ttl > 0 {
+		go func() {
+			for range time.Tick(min(s.ttl, time.Minute)) {
+				s.prune()
+			}
+		}()
+	}
+	for job := range s.queue {
+		job.mu.Lock()
+		if job.state == StateCancelled {
+			job.mu.Unlock()
+			continue
+		}
+		job.state = StateRunning
+		job.started = time.Now()
+		job.mu.Unlock()
+		log.Printf("Job %s: rendering shader %s", job.ID, job.Request.Shader)
+
+		err := runner(job)
+
+		job.mu.Lock()
+		job.finished = time.Now()
+		job.cancel = nil
+		switch {
+		case job.state == StateCancelled:
+			log.Printf("Job %s: cancelled", job.ID)
+		case err != nil:
+			job.state, job.err = StateFailed, err.Error()
+			log.Printf("Job %s: failed: %v", job.ID, err)
+		default:
+			job.state = StateDone
+			log.Printf("Job %s: done in %.1fs", job.ID, job.finished.Sub(job.started).Seconds())
+		}
+		job.mu.Unlock()
+		s.prune()
+	}
+}
+
+// prune removes the finished jobs the retention limits no longer keep, and
+// their outputs.
+func (s *Server) prune() {
+	s.mu.Lock()
+	var kept, removed []*Job
+	finished := 0
+	for i := len(s.order) - 1; i >= 0; i-- { // Newest first
+		job := s.order[i]
+		job.mu.Lock()
+		done := job.state != StateQueued && job.state != StateRunning && !job.finished.IsZero()
+		age := time.Since(job.finished)
+		job.mu.Unlock()
+		if done {
+			finished++
+			if (s.keep > 0 && finished > s.keep) || (s.ttl > 0 && age > s.ttl) {
+				removed = append(removed, job)
+				delete(s.jobs, job.ID)
+				continue
+			}
+		}
+		kept = append(kept, job)
+	}
+	if len(removed) > 0 {
+		s.order = s.order[:0]
+		for i := len(kept) - 1; i >= 0; i-- {
+			s.order = append(s.order, kept[i])
+		}
+	}
+	s.mu.Unlock()
+
+	for _, job := range removed {
+		if err := os.Remove(job.Output); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: job %s: failed to remove output: %v", job.ID, err)
+		}
+	}
+}
+
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	id := fmt.Sprintf("%d", s.nextID)
+	job := &Job{
+		ID:      id,
+		Request: req,
+		Output:  filepath.Join(s.dir, "job-"+id+s.extension),
+		state:   StateQueued,
+		created: time.Now(),
+	}
+	select {
+	case s.queue <- job:
+	default:
+		s.nextID--
+		s.mu.Unlock()
+		http.Error(w, "job queue is full", http.StatusServiceUnavailable)
+		return
+	}
+	s.jobs[id] = job
+	s.order = append(s.order, job)
+	s.mu.Unlock()
+
+	log.Printf("Job %s: queued shader %s", id, req.Shader)
+	writeJSON(w, http.StatusAccepted, job.status())
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	statuses := make([]Status, 0, len(s.order))
+	for _, job := range s.order {
+		statuses = append(statuses, job.status())
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) *Job {
+	s.mu.Lock()
+	job := s.jobs[r.PathValue("id")]
+	s.mu.Unlock()
+	if job == nil {
+		http.Error(w, "no such job", http.StatusNotFound)
+	}
+	return job
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	if job := s.lookup(w, r); job != nil {
+		writeJSON(w, http.StatusOK, job.status())
+	}
+}
+
+func (s *Server) output(w http.ResponseWriter, r *http.Request) {
+	job := s.lookup(w, r)
+	if job == nil {
+		return
+	}
+	if job.status().State != StateDone {
+		http.Error(w, "job has not finished", http.StatusConflict)
+		return
+	}
+	http.ServeFile(w, r, job.Output)
+}
+
+func (s *Server) cancel(w http.ResponseWriter, r *http.Request) {
+	job := s.lookup(w, r)
+	if job == nil {
+		return
+	}
+	job.mu.Lock()
+	switch job.state {
+	case StateQueued:
+		job.state = StateCancelled
+		job.finished = time.Now()
+	case StateRunning:
+		job.state = StateCancelled
+		if job.cancel != nil {
+			job.cancel()
+		}
+	default:
+		job.mu.Unlock()
+		http.Error(w, "job has already finished", http.StatusConflict)
+		return
+	}
+	job.mu.Unlock()
+	writeJSON(w, http.StatusOK, job.status())
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package kms
+
+import (
+	"fmt"
+
+	"github.com/richinsley/goshadertoy/graphics"
+)
+
+func New(device, connector string, width, height, hz int) (graphics.Context, error) {
+	return nil, fmt.Errorf("DRM/KMS output is only supported on Linux")
+}
@@ -0,0 +1,520 @@
+//go:build linux
+
+package kms
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	graphics "github.com/richinsley/goshadertoy/graphics"
+)
+
+/*
+#cgo pkg-config: libdrm gbm
+#cgo LDFLAGS: -lEGL -lGLESv2 -ldl
+#define _GNU_SOURCE
+#include <stdlib.h>
+#include <string.h>
+#include <poll.h>
+#include <dlfcn.h>
+#include <xf86drm.h>
+#include <xf86drmMode.h>
+#include <gbm.h>
+#include <EGL/egl.h>
+#include <EGL/eglext.h>
+
+// find_gl_proc looks a GL function up through EGL, or in the linked GLES
+// library. It returns NULL if neither has it.
+static void *find_gl_proc(const char *name) {
+    void *proc = (void *)eglGetProcAddress(name);
+    if (proc == NULL) {
+        proc = dlsym(RTLD_DEFAULT, name);
+    }
+    return proc;
+}
+
+// unsupported_gl_function stands in for the desktop GL functions GLES lacks
+// (see graphics.InitGLES).
+static void unsupported_gl_function(void) {}
+
+static void *unsupported_gl_function_ptr(void) {
+    return (void *)unsupported_gl_function;
+}
+
+static EGLDisplay get_gbm_display(struct gbm_device *gbm) {
+    PFNEGLGETPLATFORMDISPLAYEXTPROC get_platform_display =
+        (PFNEGLGETPLATFORMDISPLAYEXTPROC) eglGetProcAddress("eglGetPlatformDisplayEXT");
+    if (get_platform_display) {
+        return get_platform_display(EGL_PLATFORM_GBM_KHR, gbm, NULL);
+    }
+    return eglGetDisplay((EGLNativeDisplayType) gbm);
+}
+
+// choose_config returns an EGL config whose native visual is format, as a GBM
+// surface can only be drawn with those.
+static EGLBoolean choose_config(EGLDisplay display, EGLint format, EGLConfig *out) {
+    static const EGLint attribs[] = {
+        EGL_SURFACE_TYPE, EGL_WINDOW_BIT,
+        EGL_RED_SIZE, 8,
+        EGL_GREEN_SIZE, 8,
+        EGL_BLUE_SIZE, 8,
+        EGL_ALPHA_SIZE, 0,
+        EGL_RENDERABLE_TYPE, EGL_OPENGL_ES3_BIT,
+        EGL_NONE,
+    };
+    EGLint count = 0;
+    if (!eglChooseConfig(display, attribs, NULL, 0, &count) || count == 0) {
+        return EGL_FALSE;
+    }
+    EGLConfig *configs = malloc(count * sizeof(EGLConfig));
+    EGLBoolean found = EGL_FALSE;
+    if (eglChooseConfig(display, attribs, configs, count, &count)) {
+        for (EGLint i = 0; i < count; i++) {
+            EGLint id;
+            if (eglGetConfigAttrib(display, configs[i], EGL_NATIVE_VISUAL_ID, &id) && id == format) {
+                *out = configs[i];
+                found = EGL_TRUE;
+                break;
+            }
+        }
+    }
+    free(configs);
+    return found;
+}
+
+static EGLSurface create_window_surface(EGLDisplay display, EGLConfig config, struct gbm_surface *surface) {
+    return eglCreateWindowSurface(display, config, (EGLNativeWindowType) surface, NULL);
+}
+
+static void page_flip_handler(int fd, unsigned int frame, unsigned int sec, unsigned int usec, void *data) {
+    *(int *) data = 0;
+}
+
+// page_flip shows fb on the CRTC at the next vertical blank and waits for it.
+static int page_flip(int fd, uint32_t crtc, uint32_t fb) {
+    int waiting = 1;
+    int ret = drmModePageFlip(fd, crtc, fb, DRM_MODE_PAGE_FLIP_EVENT, &waiting);
+    if (ret) {
+        return ret;
+    }
+    drmEventContext ev;
+    memset(&ev, 0, sizeof(ev));
+    ev.version = 2;
+    ev.page_flip_handler = page_flip_handler;
+    struct pollfd pfd = { .fd = fd, .events = POLLIN };
+    while (waiting) {
+        if (poll(&pfd, 1, 1000) <= 0) {
+            return -1;
+        }
+        drmHandleEvent(fd, &ev);
+    }
+    return 0;
+}
+
+static uint32_t res_connector(drmModeRes *res, int i) { return res->connectors[i]; }
+static uint32_t res_crtc(drmModeRes *res, int i) { return res->crtcs[i]; }
+static uint32_t conn_encoder(drmModeConnector *conn, int i) { return conn->encoders[i]; }
+static drmModeModeInfo *conn_mode(drmModeConnector *conn, int i) { return &conn->modes[i]; }
+*/
+import "C"
+
+// KMS renders straight to a display through DRM/KMS, with no window system:
+// frames are drawn into GBM buffers that are page flipped onto a connector's
+// CRTC at each vertical blank.
+type KMS struct {
+	file       *os.File
+	fd         C.int
+	connector  C.uint32_t
+	crtc       C.uint32_t
+	mode       C.drmModeModeInfo
+	savedCrtc  *C.drmModeCrtc // Restored on shutdown
+	gbm        *C.struct_gbm_device
+	gbmSurface *C.struct_gbm_surface
+	display    C.EGLDisplay
+	context    C.EGLContext
+	surface    C.EGLSurface
+	bo         *C.struct_gbm_bo // Buffer on screen
+	fb         C.uint32_t
+	width      int
+	height     int
+	startTime  time.Time
+	lost       bool // The context was lost to a GPU reset
+}
+
+// output is a connected connector.
+type output struct {
+	name      string
+	connector *C.drmModeConnector
+}
+
+// New opens device, a DRM card such as /dev/dri/card0 or "fd:N" for a DRM
+// file descriptor inherited from a lease, and shows frames on the connected
+// connector named by connector: an index into the connected connectors or a
+// name such as HDMI-A-1, matched case-insensitively on a prefix. An empty
+// device tries each card, and an empty connector picks the first connected
+// one. The mode is width x height at hz, or the closest rate or the highest
+// if hz is 0, or the connector's preferred mode if width is 0.
+func New(device, connector string, width, height, hz int) (*KMS, error) {
+	if device != "" {
+		return open(device, connector, width, height, hz)
+	}
+	cards, _ := filepath.Glob("/dev/dri/card*")
+	if len(cards) == 0 {
+		return nil, fmt.Errorf("no DRM devices found in /dev/dri")
+	}
+	var errs []string
+	for _, card := range cards {
+		k, err := open(card, connector, width, height, hz)
+		if err == nil {
+			return k, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return nil, fmt.Errorf("no usable DRM device: %s", strings.Join(errs, "; "))
+}
+
+func open(device, connector string, width, height, hz int) (*KMS, error) {
+	k := &KMS{startTime: time.Now()}
+	if fdSpec, ok := strings.CutPrefix(device, "fd:"); ok {
+		fd, err := strconv.Atoi(fdSpec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DRM file descriptor '%s'", device)
+		}
+		k.file = os.NewFile(uintptr(fd), device)
+	} else {
+		f, err := os.OpenFile(device, os.O_RDWR, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", device, err)
+		}
+		k.file = f
+	}
+	k.fd = C.int(k.file.Fd())
+
+	if err := k.setup(device, connector, width, height, hz); err != nil {
+		k.Shutdown()
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *KMS) setup(device, connectorSpec string, width, height, hz int) error {
+	res := C.drmModeGetResources(k.fd)
+	if res == nil {
+		return fmt.Errorf("%s does not support mode setting", device)
+	}
+	defer C.drmModeFreeResources(res)
+
+	var outputs []output
+	for i := 0; i < int(res.count_connectors); i++ {
+		conn := C.drmModeGetConnector(k.fd, C.res_connector(res, C.int(i)))
+		if conn == nil {
+			continue
+		}
+		if conn.connection != C.DRM_MODE_CONNECTED || conn.count_modes == 0 {
+			C.drmModeFreeConnector(conn)
+			continue
+		}
+		name := fmt.Sprintf("%s-%d", C.GoString(C.drmModeGetConnectorTypeName(conn.connector_type)), conn.connector_type_id)
+		outputs = append(outputs, output{name: name, connector: conn})
+	}
+	defer func() {
+		for _, o := range outputs {
+			C.drmModeFreeConnector(o.connector)
+		}
+	}()
+	if len(outputs) == 0 {
+		return fmt.Errorf("%s has no connected displays", device)
+	}
+
+	out, err := findOutput(outputs, connectorSpec)
+	if err != nil {
+		return fmt.Errorf("%s: %w", device, err)
+	}
+	mode, err := chooseMode(out, width, height, hz)
+	if err != nil {
+		return fmt.Errorf("%s: %w", device, err)
+	}
+	k.connector = out.connector.connector_id
+	k.mode = *mode
+	k.width, k.height = int(mode.hdisplay), int(mode.vdisplay)
+
+	k.crtc = findCrtc(k.fd, res, out.connector)
+	if k.crtc == 0 {
+		return fmt.Errorf("%s: no CRTC can drive %s", device, out.name)
+	}
+	k.savedCrtc = C.drmModeGetCrtc(k.fd, k.crtc)
+
+	k.gbm = C.gbm_create_device(k.fd)
+	if k.gbm == nil {
+		return fmt.Errorf("failed to create GBM device for %s", device)
+	}
+	k.gbmSurface = C.gbm_surface_create(k.gbm, C.uint32_t(k.width), C.uint32_t(k.height),
+		C.GBM_FORMAT_XRGB8888, C.GBM_BO_USE_SCANOUT|C.GBM_BO_USE_RENDERING)
+	if k.gbmSurface == nil {
+		return fmt.Errorf("failed to create %dx%d GBM surface", k.width, k.height)
+	}
+
+	k.display = C.get_gbm_display(k.gbm)
+	if k.display == C.EGLDisplay(C.EGL_NO_DISPLAY) {
+		return fmt.Errorf("failed to get EGL display for %s", device)
+	}
+	var major, minor C.EGLint
+	if C.eglInitialize(k.display, &major, &minor) == C.EGL_FALSE {
+		return fmt.Errorf("failed to initialize EGL")
+	}
+	log.Printf("EGL Initialized. Version: %d.%d", major, minor)
+
+	var config C.EGLConfig
+	if C.choose_config(k.display, C.GBM_FORMAT_XRGB8888, &config) == C.EGL_FALSE {
+		return fmt.Errorf("no EGL config matches the GBM surface format")
+	}
+	contextAttribs := []C.EGLint{
+		C.EGL_CONTEXT_CLIENT_VERSION, 3,
+		C.EGL_NONE, C.EGL_NONE, // Room for reset notification
+		C.EGL_NONE,
+	}
+	// Ask to be told of GPU resets, so a watchdog can recover from them.
+	if strings.Contains(C.GoString(C.eglQueryString(k.display, C.EGL_EXTENSIONS)), "EGL_EXT_create_context_robustness") {
+		contextAttribs[2] = C.EGL_CONTEXT_OPENGL_RESET_NOTIFICATION_STRATEGY_EXT
+		contextAttribs[3] = C.EGL_LOSE_CONTEXT_ON_RESET_EXT
+	}
+	k.context = C.eglCreateContext(k.display, config, C.EGLContext(C.EGL_NO_CONTEXT), &contextAttribs[0])
+	if k.context == C.EGLContext(C.EGL_NO_CONTEXT) {
+		return fmt.Errorf("failed to create EGL context")
+	}
+	k.surface = C.create_window_surface(k.display, config, k.gbmSurface)
+	if k.surface == C.EGLSurface(C.EGL_NO_SURFACE) {
+		return fmt.Errorf("failed to create EGL window surface")
+	}
+	if C.eglMakeCurrent(k.display, k.surface, k.surface, k.context) == C.EGL_FALSE {
+		return fmt.Errorf("failed to make EGL context current")
+	}
+	err = graphics.InitGLES(func(name string) unsafe.Pointer {
+		cName := C.CString(name)
+		defer C.free(unsafe.Pointer(cName))
+		return C.find_gl_proc(cName)
+	}, C.unsupported_gl_function_ptr())
+	if err != nil {
+		return fmt.Errorf("failed to initialize OpenGL ES: %w", err)
+	}
+
+	log.Printf("KMS output %s %dx%d@%dHz on %s", out.name, k.width, k.height, int(mode.vrefresh), device)
+	return nil
+}
+
+// findOutput returns the output named by spec, by index or name prefix.
+func findOutput(outputs []output, spec string) (output, error) {
+	if spec == "" {
+		return outputs[0], nil
+	}
+	names := make([]string, len(outputs))
+	for i, o := range outputs {
+		names[i] = fmt.Sprintf("%d '%s'", i, o.name)
+	}
+	if index, err := strconv.Atoi(spec); err == nil {
+		if index < 0 || index >= len(outputs) {
+			return output{}, fmt.Errorf("connector index %d out of range; connected are: %s", index, strings.Join(names, ", "))
+		}
+		return outputs[index], nil
+	}
+	for _, o := range outputs {
+		if strings.HasPrefix(strings.ToLower(o.name), strings.ToLower(spec)) {
+			return o, nil
+		}
+	}
+	return output{}, fmt.Errorf("no connected connector named '%s'; connected are: %s", spec, strings.Join(names, ", "))
+}
+
+// chooseMode returns the output's mode of the given size closest to hz, or
+// with the highest rate if hz is 0, or its preferred mode if width is 0.
+func chooseMode(o output, width, height, hz int) (*C.drmModeModeInfo, error) {
+	var best *C.drmModeModeInfo
+	var sizes []string
+	for i := 0; i < int(o.connector.count_modes); i++ {
+		mode := C.conn_mode(o.connector, C.int(i))
+		if width == 0 {
+			if best == nil || mode._type&C.DRM_MODE_TYPE_PREFERRED != 0 {
+				best = mode
+			}
+			continue
+		}
+		sizes = append(sizes, fmt.Sprintf("%dx%d@%d", mode.hdisplay, mode.vdisplay, mode.vrefresh))
+		if int(mode.hdisplay) != width || int(mode.vdisplay) != height {
+			continue
+		}
+		rate := int(mode.vrefresh)
+		switch {
+		case best == nil:
+			best = mode
+		case hz == 0 && rate > int(best.vrefresh):
+			best = mode
+		case hz != 0 && abs(rate-hz) < abs(int(best.vrefresh)-hz):
+			best = mode
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("connector '%s' has no %dx%d mode; modes are: %s", o.name, width, height, strings.Join(sizes, ", "))
+	}
+	if hz != 0 && int(best.vrefresh) != hz {
+		log.Printf("Warning: connector '%s' has no %dx%d@%d mode, using %dHz", o.name, width, height, hz, best.vrefresh)
+	}
+	return best, nil
+}
+
+// findCrtc returns the CRTC driving the connector, or else the first one its
+// encoders can use.
+func findCrtc(fd C.int, res *C.drmModeRes, conn *C.drmModeConnector) C.uint32_t {
+	if conn.encoder_id != 0 {
+		if enc := C.drmModeGetEncoder(fd, conn.encoder_id); enc != nil {
+			crtc := enc.crtc_id
+			C.drmModeFreeEncoder(enc)
+			if crtc != 0 {
+				return crtc
+			}
+		}
+	}
+	for i := 0; i < int(conn.count_encoders); i++ {
+		enc := C.drmModeGetEncoder(fd, C.conn_encoder(conn, C.int(i)))
+		if enc == nil {
+			continue
+		}
+		possible := enc.possible_crtcs
+		C.drmModeFreeEncoder(enc)
+		for j := 0; j < int(res.count_crtcs); j++ {
+			if possible&(1<<j) != 0 {
+				return C.res_crtc(res, C.int(j))
+			}
+		}
+	}
+	return 0
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func (k *KMS) MakeCurrent() {
+	C.eglMakeCurrent(k.display, k.surface, k.surface, k.context)
+}
+
+func (k *KMS) DetachCurrent() {
+	C.eglMakeCurrent(k.display, C.EGLSurface(C.EGL_NO_SURFACE), C.EGLSurface(C.EGL_NO_SURFACE), C.EGLContext(C.EGL_NO_CONTEXT))
+}
+
+// ShouldClose is always false; there is no window to close, so KMS output
+// runs until the process is signalled.
+func (k *KMS) ShouldClose() bool {
+	return false
+}
+
+// EndFrame swaps the frame into a GBM buffer and flips it onto the screen,
+// waiting for the vertical blank. The first frame sets the mode.
+func (k *KMS) EndFrame() {
+	if C.eglSwapBuffers(k.display, k.surface) == C.EGL_FALSE && C.eglGetError() == C.EGL_CONTEXT_LOST {
+		k.lost = true
+		return
+	}
+	bo := C.gbm_surface_lock_front_buffer(k.gbmSurface)
+	if bo == nil {
+		log.Println("KMS: failed to lock front buffer")
+		return
+	}
+	var fb C.uint32_t
+	handle := C.gbm_bo_get_handle(bo)
+	if C.drmModeAddFB(k.fd, C.uint32_t(k.width), C.uint32_t(k.height), 24, 32, C.gbm_bo_get_stride(bo), *(*C.uint32_t)(unsafe.Pointer(&handle)), &fb) != 0 {
+		log.Println("KMS: failed to add framebuffer")
+		C.gbm_surface_release_buffer(k.gbmSurface, bo)
+		return
+	}
+
+	if k.bo == nil {
+		if C.drmModeSetCrtc(k.fd, k.crtc, fb, 0, 0, &k.connector, 1, &k.mode) != 0 {
+			log.Println("KMS: failed to set mode; another process may be the DRM master")
+		}
+	} else if C.page_flip(k.fd, k.crtc, fb) != 0 {
+		log.Println("KMS: page flip failed")
+	}
+
+	k.releaseBuffer()
+	k.bo, k.fb = bo, fb
+}
+
+// releaseBuffer returns the buffer that was on screen to the GBM surface.
+func (k *KMS) releaseBuffer() {
+	if k.bo == nil {
+		return
+	}
+	C.drmModeRmFB(k.fd, k.fb)
+	C.gbm_surface_release_buffer(k.gbmSurface, k.bo)
+	k.bo, k.fb = nil, 0
+}
+
+// ContextLost reports whether a swap found the context lost.
+func (k *KMS) ContextLost() bool {
+	return k.lost
+}
+
+func (k *KMS) GetFramebufferSize() (int, int) {
+	return k.width, k.height
+}
+
+// Time provides an internal timer since there is no GLFW timer.
+func (k *KMS) Time() float64 {
+	return time.Since(k.startTime).Seconds()
+}
+
+// GetMouseInput always returns zero values; KMS output has no pointer.
+func (k *KMS) GetMouseInput() [4]float32 {
+	return [4]float32{0, 0, 0, 0}
+}
+
+func (k *KMS) IsGLES() bool {
+	return true
+}
+
+// GetWindow returns nil; there is no window.
+func (k *KMS) GetWindow() interface{} {
+	return nil
+}
+
+// Shutdown restores the CRTC to what it showed before and releases the
+// display.
+func (k *KMS) Shutdown() {
+	if k.savedCrtc != nil {
+		C.drmModeSetCrtc(k.fd, k.savedCrtc.crtc_id, k.savedCrtc.buffer_id, k.savedCrtc.x, k.savedCrtc.y, &k.connector, 1, &k.savedCrtc.mode)
+		C.drmModeFreeCrtc(k.savedCrtc)
+		k.savedCrtc = nil
+	}
+	k.releaseBuffer()
+	if k.display != C.EGLDisplay(C.EGL_NO_DISPLAY) {
+		C.eglMakeCurrent(k.display, C.EGLSurface(C.EGL_NO_SURFACE), C.EGLSurface(C.EGL_NO_SURFACE), C.EGLContext(C.EGL_NO_CONTEXT))
+		if k.context != C.EGLContext(C.EGL_NO_CONTEXT) {
+			C.eglDestroyContext(k.display, k.context)
+		}
+		if k.surface != C.EGLSurface(C.EGL_NO_SURFACE) {
+			C.eglDestroySurface(k.display, k.surface)
+		}
+		C.eglTerminate(k.display)
+	}
+	if k.gbmSurface != nil {
+		C.gbm_surface_destroy(k.gbmSurface)
+		k.gbmSurface = nil
+	}
+	if k.gbm != nil {
+		C.gbm_device_destroy(k.gbm)
+		k.gbm = nil
+	}
+	if k.file != nil {
+		k.file.Close()
+		k.file = nil
+	}
+}
@@ -0,0 +1,364 @@
+// Package logging routes the standard log package through log/slog, with
+// levels, per-subsystem filtering and optional JSON output for log
+// aggregation. Lines logged with log.Printf need no changes: their level is
+// taken from how they start ("Warning:", "Error", "Failed to") and their
+// subsystem is the package that logged them, e.g. api, renderer, audio or
+// encoder. The lines of log.Fatal and log.Panic, which end the program, are
+// errors that every level logs. Code that wants to log attributes can use
+// Logger.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LevelQuiet is above every level, to silence a subsystem.
+const LevelQuiet = slog.Level(12)
+
+var levelNames = map[string]slog.Level{
+	"debug":   slog.LevelDebug,
+	"info":    slog.LevelInfo,
+	"warn":    slog.LevelWarn,
+	"warning": slog.LevelWarn,
+	"error":   slog.LevelError,
+	"quiet":   LevelQuiet,
+}
+
+// Levels are the minimum levels logged, overall and per subsystem.
+type Levels struct {
+	Default    slog.Level
+	Subsystems map[string]slog.Level
+}
+
+// For returns the minimum level of subsystem.
+func (l Levels) For(subsystem string) slog.Level {
+	if level, ok := l.Subsystems[subsystem]; ok {
+		return level
+	}
+	return l.Default
+}
+
+// ParseLevels parses a level spec: a level, then comma-separated
+// subsystem=level overrides, e.g. "info,encoder=warn,audio=quiet". The
+// levels are debug, info, warn, error and quiet.
+func ParseLevels(spec string) (Levels, error) {
+	levels := Levels{Default: slog.LevelInfo, Subsystems: map[string]slog.Level{}}
+	for i, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		subsystem, name, ok := strings.Cut(part, "=")
+		if !ok {
+			name = subsystem
+		}
+		level, known := levelNames[strings.ToLower(strings.TrimSpace(name))]
+		if !known {
+			names := make([]string, 0, len(levelNames))
+			for n := range levelNames {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return levels, fmt.Errorf("invalid level '%s' (valid: %s)", name, strings.Join(names, ", "))
+		}
+		switch {
+		case ok:
+			levels.Subsystems[strings.TrimSpace(subsystem)] = level
+		case i == 0:
+			levels.Default = level
+		default:
+			return levels, fmt.Errorf("'%s' needs a subsystem, as subsystem=level", part)
+		}
+	}
+	return levels, nil
+}
+
+// MinLevel returns the minimum level subsystem logs, for libraries with
+// their own level filtering.
+func MinLevel(subsystem string) slog.Level {
+	mu.RLock()
+	defer mu.RUnlock()
+	return levels.For(subsystem)
+}
+
+// Config configures Setup.
+type Config struct {
+	Levels     Levels
+	JSON       bool // One JSON object per line, with level and subsystem
+	Timestamps bool // Start text lines with the time, as the log package does
+}
+
+const recentLines = 1000 // Lines Recent keeps
+
+var (
+	mu     sync.RWMutex
+	levels = Levels{Default: slog.LevelInfo}
+	output slog.Handler // Formats records; nil until Setup
+	recent = &history{}
+
+	secretsMu sync.Mutex
+	secrets   []string // Values Recent redacts
+)
+
+// history keeps the last recentLines lines written to it.
+type history struct {
+	mu    sync.Mutex
+	lines []string
+	next  int // Index of the oldest line once lines is full
+}
+
+func (h *history) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, line := range strings.SplitAfter(string(p), "\n") {
+		if line == "" {
+			continue
+		}
+		if len(h.lines) < recentLines {
+			h.lines = append(h.lines, line)
+		} else {
+			h.lines[h.next] = line
+			h.next = (h.next + 1) % recentLines
+		}
+	}
+	return len(p), nil
+}
+
+// Recent returns the last lines logged since Setup, oldest first, in the
+// format they were written in, e.g. for a bug report. Values passed to Redact
+// are replaced by REDACTED.
+func Recent() []byte {
+	recent.mu.Lock()
+	var b strings.Builder
+	for i := range recent.lines {
+		b.WriteString(recent.lines[(recent.next+i)%len(recent.lines)])
+	}
+	recent.mu.Unlock()
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		pairs = append(pairs, secret, "REDACTED")
+	}
+	return []byte(strings.NewReplacer(pairs...).Replace(b.String()))
+}
+
+// Redact makes Recent hide value, e.g. a token or a stream key, wherever it
+// was or will be logged.
+func Redact(value string) {
+	if value == "" {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, secret := range secrets {
+		if secret == value {
+			return
+		}
+	}
+	secrets = append(secrets, value)
+}
+
+// Setup makes the log package and Logger write to standard error as cfg
+// says, keeping the most recent lines for Recent.
+func Setup(cfg Config) {
+	out := io.MultiWriter(os.Stderr, recent)
+	var h slog.Handler
+	if cfg.JSON {
+		h = slog.NewJSONHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug})
+	} else {
+		h = &lineHandler{out: out, mu: &sync.Mutex{}, timestamps: cfg.Timestamps}
+	}
+	mu.Lock()
+	levels, output = cfg.Levels, h
+	mu.Unlock()
+	slog.SetDefault(Logger("main"))
+	// After slog.SetDefault, which points the log package at slog itself.
+	log.SetFlags(0)
+	log.SetOutput(bridge{})
+}
+
+// Logger returns a logger tagged with subsystem.
+func Logger(subsystem string) *slog.Logger {
+	return slog.New(&filter{subsystem: subsystem}).With("subsystem", subsystem)
+}
+
+// filter drops the records below its subsystem's level and passes the rest
+// to the output.
+type filter struct {
+	subsystem string
+	with      []func(slog.Handler) slog.Handler // The WithAttrs and WithGroup calls, for the output
+}
+
+func (f *filter) Enabled(_ context.Context, level slog.Level) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return level >= levels.For(f.subsystem)
+}
+
+func (f *filter) Handle(ctx context.Context, r slog.Record) error {
+	mu.RLock()
+	h := output
+	mu.RUnlock()
+	if h == nil {
+		return nil
+	}
+	for _, with := range f.with {
+		h = with(h)
+	}
+	return h.Handle(ctx, r)
+}
+
+func (f *filter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return f.and(func(h slog.Handler) slog.Handler { return h.WithAttrs(attrs) })
+}
+
+func (f *filter) WithGroup(name string) slog.Handler {
+	return f.and(func(h slog.Handler) slog.Handler { return h.WithGroup(name) })
+}
+
+func (f *filter) and(with func(slog.Handler) slog.Handler) *filter {
+	return &filter{subsystem: f.subsystem, with: append(append([]func(slog.Handler) slog.Handler(nil), f.with...), with)}
+}
+
+// bridge receives the lines of the log package.
+type bridge struct{}
+
+func (bridge) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	subsystem, pc, fatal := caller()
+	logger := Logger(subsystem)
+	level := levelOf(msg)
+	if fatal {
+		level = slog.LevelError
+	}
+	ctx := context.Background()
+	if fatal || logger.Enabled(ctx, level) {
+		logger.Handler().Handle(ctx, slog.NewRecord(time.Now(), level, msg, pc))
+	}
+	return len(p), nil
+}
+
+// levelOf returns the level of a line from how it starts, after any
+// "Subsystem: " tag.
+func levelOf(msg string) slog.Level {
+	s := strings.ToLower(msg)
+	level, ok := levelPrefix(s)
+	if tag, rest, tagged := strings.Cut(s, ": "); !ok && tagged && len(tag) <= 16 && !strings.Contains(tag, " ") {
+		level, _ = levelPrefix(rest)
+	}
+	return level
+}
+
+func levelPrefix(s string) (slog.Level, bool) {
+	switch {
+	case strings.HasPrefix(s, "warning"):
+		return slog.LevelWarn, true
+	case strings.HasPrefix(s, "error"), strings.HasPrefix(s, "failed"), strings.HasPrefix(s, "fatal"):
+		return slog.LevelError, true
+	case strings.HasPrefix(s, "debug"):
+		return slog.LevelDebug, true
+	}
+	return slog.LevelInfo, false
+}
+
+// caller returns the package that called the log package, and where, and
+// whether it called one of the Fatal or Panic functions.
+func caller() (subsystem string, pc uintptr, fatal bool) {
+	var pcs [16]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs[:])])
+	for {
+		frame, more := frames.Next()
+		fn := frame.Function
+		if !strings.HasPrefix(fn, "log.") && !strings.HasPrefix(fn, "runtime.") {
+			return packageOf(fn), frame.PC, fatal
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(fn, "log."), "(*Logger).")
+		if strings.HasPrefix(name, "Fatal") || strings.HasPrefix(name, "Panic") {
+			fatal = true
+		}
+		if !more {
+			return "main", 0, fatal
+		}
+	}
+}
+
+// packageOf returns the last element of the package path of a function
+// name such as "github.com/richinsley/goshadertoy/renderer.(*Renderer).Run".
+func packageOf(fn string) string {
+	if i := strings.LastIndex(fn, "/"); i >= 0 {
+		fn = fn[i+1:]
+	}
+	if i := strings.Index(fn, "."); i >= 0 {
+		fn = fn[:i]
+	}
+	return fn
+}
+
+// lineHandler writes records as plain lines, as the log package does, with
+// any attributes but the subsystem after the message as key=value.
+type lineHandler struct {
+	out        io.Writer
+	mu         *sync.Mutex
+	timestamps bool
+	attrs      []slog.Attr
+	group      string
+}
+
+func (h *lineHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *lineHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	if h.timestamps {
+		b.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	}
+	b.WriteString(r.Message)
+	write := func(a slog.Attr) bool {
+		if a.Key != "subsystem" {
+			fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+		}
+		return true
+	}
+	for _, a := range h.attrs {
+		write(a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		if h.group != "" {
+			a.Key = h.group + "." + a.Key
+		}
+		return write(a)
+	})
+	b.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.out, b.String())
+	return err
+}
+
+func (h *lineHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	for _, a := range attrs {
+		if h.group != "" {
+			a.Key = h.group + "." + a.Key
+		}
+		c.attrs = append(append([]slog.Attr(nil), c.attrs...), a)
+	}
+	return &c
+}
+
+func (h *lineHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	if h.group != "" {
+		name = h.group + "." + name
+	}
+	c.group = name
+	return &c
+}
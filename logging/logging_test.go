@@ -0,0 +1,119 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLevelOf(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want slog.Level
+	}{
+		{"Warning: no audio input", slog.LevelWarn},
+		{"Error creating sink: no space", slog.LevelError},
+		{"Failed to load shader XlSSzV", slog.LevelError},
+		{"Fatal: out of memory", slog.LevelError},
+		{"Debug: frame 12", slog.LevelDebug},
+		{"Renderer: Warning: slow frame", slog.LevelWarn},
+		{"Using GLFW contexts.", slog.LevelInfo},
+		{"Invalid mode: foo", slog.LevelInfo},
+		{"a long tag with spaces: Warning", slog.LevelInfo},
+	}
+	for _, tt := range tests {
+		if got := levelOf(tt.msg); got != tt.want {
+			t.Errorf("levelOf(%q) = %v, want %v", tt.msg, got, tt.want)
+		}
+	}
+}
+
+// capture makes the log package write to the returned buffer at the levels
+// of spec, as lines or JSON, until the test ends.
+func capture(t *testing.T, spec string, json bool) *bytes.Buffer {
+	t.Helper()
+	l, err := ParseLevels(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	var h slog.Handler = &lineHandler{out: buf, mu: &sync.Mutex{}}
+	if json {
+		h = slog.NewJSONHandler(buf, nil)
+	}
+	mu.Lock()
+	prevLevels, prevOutput := levels, output
+	levels, output = l, h
+	mu.Unlock()
+	prevFlags, prevWriter := log.Flags(), log.Writer()
+	log.SetFlags(0)
+	log.SetOutput(bridge{})
+	t.Cleanup(func() {
+		log.SetFlags(prevFlags)
+		log.SetOutput(prevWriter)
+		mu.Lock()
+		levels, output = prevLevels, prevOutput
+		mu.Unlock()
+	})
+	return buf
+}
+
+func TestBridgeLevels(t *testing.T) {
+	buf := capture(t, "warn", false)
+	log.Printf("Using GLFW contexts.")
+	log.Printf("Warning: no audio input")
+	if got, want := buf.String(), "Warning: no audio input\n"; got != want {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+}
+
+func TestBridgePanicIgnoresLevels(t *testing.T) {
+	for _, spec := range []string{"error", "quiet", "info,logging=quiet"} {
+		buf := capture(t, spec, false)
+		func() {
+			defer func() { recover() }()
+			log.Panicf("Invalid mode: %s", "foo") // As log.Fatalf words its lines
+		}()
+		if got, want := buf.String(), "Invalid mode: foo\n"; got != want {
+			t.Errorf("%s: logged %q, want %q", spec, got, want)
+		}
+	}
+}
+
+func TestBridgeFatalIsError(t *testing.T) {
+	buf := capture(t, "info", true)
+	func() {
+		defer func() { recover() }()
+		log.Panicln("No scenes could be loaded")
+	}()
+	if got := buf.String(); !strings.Contains(got, `"level":"ERROR"`) || !strings.Contains(got, `"subsystem":"logging"`) {
+		t.Errorf("logged %s, want an error of subsystem logging", got)
+	}
+}
+
+func TestRecentRedacts(t *testing.T) {
+	prevRecent := recent
+	recent = &history{}
+	secretsMu.Lock()
+	prevSecrets := secrets
+	secretsMu.Unlock()
+	t.Cleanup(func() {
+		recent = prevRecent
+		secretsMu.Lock()
+		secrets = prevSecrets
+		secretsMu.Unlock()
+	})
+
+	fmt.Fprintf(recent, "Job server token: 0123abcd\nControl UI available at http://:8080/?token=feedbeef\n")
+	Redact("0123abcd")
+	Redact("feedbeef")
+	Redact("")
+	want := "Job server token: REDACTED\nControl UI available at http://:8080/?token=REDACTED\n"
+	if got := string(Recent()); got != want {
+		t.Errorf("Recent() = %q, want %q", got, want)
+	}
+}
@@ -1,25 +1,166 @@
 package options
 
+import "reflect"
+
 type ShaderOptions struct {
-	APIKey            *string
-	ShaderID          *string
-	Help              *bool
-	Mode              *string
-	Duration          *float64
-	FPS               *int
-	Width             *int
-	Height            *int
-	BitDepth          *int
-	OutputFile        *string
-	DecklinkDevice    *string
-	Codec             *string
-	NumPBOs           *int
-	Prewarm           *bool   // Optional prewarm flag to initialize the renderer before recording/streaming
-	AudioInputDevice  *string // FFmpeg audio input device string (e.g., a file path or 'avfoundation:default'). Overrides default mic.
-	AudioInputFile    *string // FFmpeg audio input file (e.g., a WAV or MP3 file). Overrides default mic.
-	AudioOutputDevice *string // FFmpeg audio output device string.
-	HasSoundShader    bool
+	APIKey             *string
+	ConfigFile         *string // Config file supplying defaults for every other option, with per-shader overrides.
+	ShaderID           *string
+	Help               *bool
+	Mode               *string
+	Duration           *float64
+	FPS                *int
+	Width              *int
+	Height             *int
+	BitDepth           *int
+	Dither             *string // Dithering of the quantized output: none, triangular or blue-noise.
+	Transfer           *string // Output transfer: shadertoy, srgb or gamma2.2 (see renderer.Transfers).
+	OutputFile         *string
+	Sink               *string  // Where record and stream mode frames go: ffmpeg, raw, y4m, images or shm (see sink.SinkNames).
+	AudioOutput        *string  // File or pipe receiving the audio as float WAV, for sinks that only write video. Empty drops the audio.
+	ExportHTML         *string  // Write the first shader as a standalone WebGL2 page to this file and exit.
+	ReportVRAM         *bool    // Log the estimated GPU memory of each loaded scene.
+	DumpShaders        *string  // Directory receiving the assembled and translated GLSL of every compiled pass. Empty disables it.
+	OutputFormat       *string  // FFmpeg container for the output. Empty guesses from the file name or URL.
+	Container          *string  // Output container: mkv, mov, mp4 or webm, checked against the codecs. Empty uses the file name.
+	PreviewAddr        *string  // Address for the MJPEG preview server in record/stream mode (e.g. ":8090"). Empty disables it.
+	ShareOut           *string  // Name to publish rendered frames under through Syphon (macOS). Empty disables sharing.
+	Projection         *string  // Image pass projection: flat, or equirect for 360° panoramas of mainVR/mainCubemap shaders.
+	Stereo             *string  // Stereo display mode: anaglyph, sbs or tb. Empty renders a single view.
+	EyeSeparation      *float64 // Stereo: distance between the eyes in scene units.
+	Precision          *string  // Shader precision: default, or highp to force every precision qualifier to highp.
+	AuditFrames        *int     // Audit mode: number of frames rendered before comparing the last one.
+	AuditOutput        *string  // Audit mode: PNG receiving both renders and their difference.
+	Jobs               *int     // Batch mode: number of shaders rendered in parallel.
+	BatchOutput        *string  // Batch mode: output file pattern; {id} and {n} expand to the shader ID and 1-based position.
+	BatchStatus        *string  // Batch mode: JSON file updated with the state of every job. Empty disables it.
+	ListenAddr         *string  // Server mode: address of the job REST API.
+	JobDir             *string  // Server mode: directory receiving rendered job outputs.
+	JobQueueSize       *int     // Server mode: maximum number of queued jobs.
+	JobToken           *string  // Server mode: token required by the job REST API. Empty generates one.
+	JobTTL             *float64 // Server mode: seconds finished jobs are kept; 0 disables the limit.
+	JobKeep            *int     // Server mode: finished jobs kept; 0 disables the limit.
+	ControlAddr        *string  // Address for the web monitor and controller (e.g. ":8080"). Empty disables it.
+	ControlToken       *string  // Token required by the controller's WebSocket and command API. Empty generates one.
+	SegmentTime        *float64 // HLS/DASH outputs: target segment duration in seconds.
+	SegmentListSize    *int     // HLS/DASH outputs in stream mode: segments kept in the playlist; 0 keeps all.
+	SegmentType        *string  // HLS outputs: segment container, ts or fmp4.
+	Outputs            *string  // ';'-separated outputs, each "url|key=value,...", written simultaneously.
+	DecklinkDevice     *string
+	Codec              *string
+	NumPBOs            *int
+	EncodeQueue        *int     // Frames each output queues for its encoder before QueuePolicy applies.
+	QueuePolicy        *string  // What a full encoder queue does: block, drop-oldest, or never-drop. Empty drops the oldest when streaming and blocks otherwise.
+	EncodeThreads      *int     // Threads of each software video encoder; 0 uses every core.
+	EncodeSlices       *int     // Slices per frame encoded in parallel; 0 keeps the encoder's default.
+	EncodeTiles        *string  // AV1 tiles per frame as COLUMNSxROWS. Empty picks columns from the width.
+	VideoFilter        *string  // libavfilter graph the video runs through before encoding, in FFmpeg's -vf syntax. Empty disables it.
+	Screensaver        *bool    // Live mode: borderless window over all monitors that exits on input and cycles the shaders randomly.
+	Dwell              *float64 // Screensaver mode: seconds each shader is shown.
+	Monitor            *string  // Live mode: monitor index or name to go fullscreen on; with Span, the comma-separated monitors to cover.
+	Span               *bool    // Live mode: one borderless window spanning the monitors (all unless Monitor is set).
+	Fullscreen         *bool    // Live mode: exclusive fullscreen on the Monitor (primary by default) in VideoMode.
+	Borderless         *bool    // Live mode: borderless window covering the Monitor, keeping its video mode.
+	VideoMode          *string  // Exclusive fullscreen mode as WIDTHxHEIGHT[@HZ]. Empty keeps the current mode.
+	VSync              *string  // Live mode swap interval: on, off, or adaptive.
+	HDROutput          *string  // Live mode HDR presentation: scrgb or pq (see renderer.HDROutputs). Empty presents SDR.
+	HDRWhite           *float64 // HDR output: luminance of SDR white (the shader's 1.0), in nits.
+	GLWatchdog         *float64 // Live mode: seconds a frame may take before the GPU counts as hung; a lost or hung context restarts the process. 0 disables it.
+	MaxFPS             *float64 // Live mode frame rate cap; 0 is unlimited.
+	Clock              *string  // Live mode source of iTime: window, monotonic, audio, ltc, or ntp (see renderer.Clocks).
+	TimecodeInput      *string  // LTC clock: FFmpeg audio input device carrying the timecode on its left channel.
+	NTPServer          *string  // NTP clock: server to sync with. Empty trusts the system clock to be synced.
+	ClockEpoch         *string  // NTP clock: RFC 3339 time that iTime counts from.
+	FrameLock          *string  // Live mode: master or slave of instances rendering in lockstep. Empty runs alone.
+	FrameLockAddr      *string  // Frame lock: UDP address the master listens on, or that slaves reach it at.
+	FrameLockSlaves    *int     // Frame lock master: slaves that must render each frame before it is shown.
+	Viewport           *string  // Region of Canvas to render as "X,Y,W,H" from its top left. Empty renders all of it.
+	Canvas             *string  // Size of the canvas Viewport is part of, as WIDTHxHEIGHT.
+	KMS                *bool    // Live mode: render straight to the Monitor connector through DRM/KMS, without a window system.
+	KMSDevice          *string  // DRM device for KMS, or "fd:N" for a leased DRM file descriptor. Empty tries each card.
+	Evdev              *string  // Live mode: input devices to read mouse and keys from directly, comma-separated or "all". Empty uses the window's input.
+	Progress           *string  // Record mode progress reporting: text, json, or none.
+	LogLevel           *string  // Minimum level logged, then optional subsystem=level overrides, e.g. "info,encoder=warn".
+	LogJSON            *bool    // Log one JSON object per line, with level and subsystem, instead of plain lines.
+	QuietFFmpeg        *bool    // Log only FFmpeg's warnings and errors, as with ffmpeg=warn in LogLevel.
+	Diagnostics        *string  // Zip file to write a diagnostics bundle for bug reports to, before exiting. Empty runs normally.
+	CheckpointDir      *string  // Record mode: directory for segments and checkpoints that let an interrupted render resume. Empty disables it.
+	CheckpointInterval *float64 // Record mode: seconds of output per segment when checkpointing.
+	InputScript        *string  // Record mode: JSON timeline of mouse and keyboard events to play into iMouse and keyboard channels.
+	RecordInput        *string  // Live mode: file to save the session's mouse and keyboard to as an input script.
+	SimFPS             *int     // Record mode: rate the shader is stepped at, a multiple of FPS; every FPS/SimFPS-th step is encoded. 0 steps at FPS.
+	TimeWrap           *float64 // Seconds after which iTime wraps back to 0. 0 never wraps.
+	Date               *string  // Date iDate starts at with iTime 0, advancing with it. Empty follows the wall clock.
+	Seed               *float64 // iSeed, for shaders that declare it.
+	WarmupFrames       *int     // Record mode: frames simulated without encoding before the first frame.
+	LoadState          *string  // Live and record modes: savestate to continue the shader's buffers, iFrame and iTime from.
+	SaveState          *string  // Savestate file F5 saves to and F9 loads in live mode; record mode saves the last frame's state to it.
+	Channel0           *string  // Override of the image pass's iChannel0 as "type:source[,sampler options]". Empty keeps the shader's input.
+	Channel1           *string  // Override of iChannel1, as Channel0.
+	Channel2           *string  // Override of iChannel2, as Channel0.
+	Channel3           *string  // Override of iChannel3, as Channel0.
+	HWAccel            *string  // Hardware decoder of video channels: auto, none, or an FFmpeg device type such as cuda, vaapi or videotoolbox.
+	Prewarm            *bool    // Optional prewarm flag to initialize the renderer before recording/streaming
+	SoundChunkRows     *int     // Rows of 512 samples the sound shader renders at a time; 0 picks by mode.
+	AudioInput         *string  // Audio input preset; "system" captures the machine's playback through a loopback device.
+	AudioInputDevice   *string  // FFmpeg audio input device string (e.g., a file path or 'avfoundation:default'). Overrides default mic.
+	AudioInputFile     *string  // FFmpeg audio input file (e.g., a WAV or MP3 file). Overrides default mic.
+	AudioOutputDevice  *string  // FFmpeg audio output device string.
+	Mute               *bool    // Live mode: do not play sound shader audio through the default output device.
+	AudioBackend       *string  // Audio device backend (alsa, pulse, jack, avfoundation, dshow). Empty selects the platform default.
+	ListAudioDevices   *bool    // List the capture sources and playback sinks of the audio backend and exit.
+	ListEncoders       *bool    // List the video and audio encoders and hardware devices the linked FFmpeg provides and exit.
+	AudioCopy          *bool    // Record mode: stream-copy the audio track of the input file instead of re-encoding it.
+	AudioCodec         *string  // Audio codec for encoding: aac, opus, flac, pcm_s24le. Empty selects a default per container.
+	AudioBitrate       *int     // Audio bitrate in kbps for lossy codecs.
+	AudioOutChannels   *int     // Number of encoded audio channels (1 or 2), -audio-out-channels.
+	AudioSampleRate    *int     // Sample rate of the audio pipeline, used for playback and encoding.
+	AVOffset           *float64 // Delay in milliseconds between audio capture and its visualization in live mode.
+	AudioGain          *float64 // Input gain in dB applied in the resample stage.
+	AudioStats         *float64 // Seconds between logs of the audio buffer occupancy; 0 only warns of underruns and overruns.
+	AudioChannelMap    *string  // 1-based input channels feeding left,right (e.g. "3,4").
+	HasSoundShader     bool
+	Metadata           map[string]string // Container tags of recorded files, set from the loaded shader
+	MetadataSidecar    *bool             // Also write the tags of file outputs to <output>.json.
+	SceneSubtitles     *bool             // Also write the title of each scene of file outputs as subtitles to <output name>.srt.
+	TitleCard          *float64          // Record and stream modes: seconds the shader's title, author and source are burnt in at the start of each scene; 0 disables it.
+	TitlePosition      *string           // Title card position, e.g. bottom-left (see renderer.OverlayPositions).
+	Timestamp          *string           // Record and stream modes: burn in the render time ("time") or wall clock ("clock"). Empty disables it.
+	TimestampPosition  *string           // Timestamp position.
+	Post               *string           // Post-processing chain as effect=strength pairs: grain, vignette, aberration, bloom and its threshold. Empty disables it.
+	LUT                *string           // .cube 3D LUT every rendered frame is graded through. Empty disables it.
+	Watermark          *string           // Record and stream modes: PNG or JPEG image burnt into every frame. Empty disables it.
+	WatermarkPosition  *string           // Watermark position.
+	WatermarkOpacity   *float64          // Watermark opacity, 0 to 1.
+	// FFT analysis options for mic/music channels
+	FFTSize         *int     // FFT input size in samples (power of two, >= 1024)
+	FFTSmoothing    *float64 // Smoothing between successive FFT frames [0, 1)
+	FFTMinDecibels  *float64 // Level mapped to 0.0 in the FFT texture
+	FFTMaxDecibels  *float64 // Level mapped to 1.0 in the FFT texture
+	FFTWindow       *string  // Window function: blackman, hann, hamming, rectangular
+	SpectrogramRows *int     // Frames of history in spectrogram channels
 	// Gamescope options
 	GamescopeSocket          *string
 	GamescopeTerminateOnExit *bool
+	GamescopeHDR             *bool   // Request an HDR session.
+	GamescopeSDRNits         *int    // Brightness of SDR content in an HDR session.
+	GamescopeBackend         *string // Gamescope backend (drm, wayland, sdl, headless). Empty leaves it to the manager.
+	GamescopeArgs            *string // Extra gamescope command-line arguments, whitespace-separated.
+}
+
+// Clone returns a copy of o whose option values can be changed without
+// affecting o, e.g. to apply per-job settings.
+func (o *ShaderOptions) Clone() *ShaderOptions {
+	c := *o
+	v := reflect.ValueOf(&c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if f.Kind() != reflect.Pointer || f.IsNil() {
+			continue
+		}
+		copied := reflect.New(f.Type().Elem())
+		copied.Elem().Set(f.Elem())
+		f.Set(copied)
+	}
+	return &c
 }
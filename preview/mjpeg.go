@@ -0,0 +1,283 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const pageHTML = `<!DOCTYPE html>
+<html><head><title>goshadertoy preview</title>
+<style>body{margin:0;background:#111;display:flex;align-items:center;justify-content:center;height:100vh}img{max-width:100%;max-height:100%}</style>
+</head><body><img src="/stream.mjpg"></body></html>`
+
+// MJPEGServer publishes downscaled rendered frames as a Motion-JPEG stream, so an
+// operator can watch a headless record or stream run from a browser.
+type MJPEGServer struct {
+	maxWidth int
+	interval time.Duration
+	quality  int
+
+	mu         sync.Mutex
+	ready      chan struct{} // Closed and replaced on every new JPEG
+	frame      []byte        // Latest JPEG
+	seq        uint64        // Incremented on every new JPEG
+	lastUpdate time.Time
+	encoding   atomic.Bool
+}
+
+// NewMJPEGServer creates a preview that encodes at most fps frames per second,
+// scaled down to maxWidth pixels wide.
+func NewMJPEGServer(maxWidth, fps int) *MJPEGServer {
+	return &MJPEGServer{
+		maxWidth: maxWidth,
+		interval: time.Second / time.Duration(fps),
+		quality:  70,
+		ready:    make(chan struct{}),
+	}
+}
+
+// UpdateYUV offers a new frame in the renderer's planar YUV 4:4:4 layout (BT.709,
+// limited range, 8-bit samples, or little-endian 16-bit samples holding
+// bitDepth bits). Frames arriving faster
+// than the preview rate, or while a previous frame is still encoding, are skipped.
+// The pixel slice is only read, possibly after UpdateYUV returns; release, if
+// not nil, is called once it no longer is.
+func (s *MJPEGServer) UpdateYUV(pixels []byte, width, height, bitDepth int, release func()) {
+	s.update(func() *image.RGBA {
+		return yuvToRGBA(pixels, width, height, bitDepth, s.maxWidth)
+	}, release)
+}
+
+// UpdateRGBA offers a new frame of 8-bit RGBA pixels, such as the result of
+// glReadPixels. With flipY set, rows are stored bottom-up. The pixel slice is
+// only read, possibly after UpdateRGBA returns.
+func (s *MJPEGServer) UpdateRGBA(pixels []byte, width, height int, flipY bool) {
+	s.update(func() *image.RGBA {
+		return scaleRGBA(pixels, width, height, flipY, s.maxWidth)
+	}, nil)
+}
+
+// Due reports whether a frame offered now would be encoded. Callers can use it
+// to skip an expensive readback.
+func (s *MJPEGServer) Due() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Since(s.lastUpdate) >= s.interval && !s.encoding.Load()
+}
+
+// update converts and encodes a frame in the background if one is due.
+// release, if not nil, is called once convert has run or won't run.
+func (s *MJPEGServer) update(convert func() *image.RGBA, release func()) {
+	if release == nil {
+		release = func() {}
+	}
+	s.mu.Lock()
+	due := time.Since(s.lastUpdate) >= s.interval
+	if due {
+		s.lastUpdate = time.Now()
+	}
+	s.mu.Unlock()
+	if !due || !s.encoding.CompareAndSwap(false, true) {
+		release()
+		return
+	}
+
+	go func() {
+		defer s.encoding.Store(false)
+		img := convert()
+		release()
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: s.quality}); err != nil {
+			log.Printf("Preview: JPEG encoding failed: %v", err)
+			return
+		}
+		s.mu.Lock()
+		s.frame = buf.Bytes()
+		s.seq++
+		close(s.ready)
+		s.ready = make(chan struct{})
+		s.mu.Unlock()
+	}()
+}
+
+// Latest returns the most recent JPEG, or nil before the first frame.
+func (s *MJPEGServer) Latest() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frame
+}
+
+// waitFrame blocks until a JPEG newer than seq is available, or ctx is done.
+func (s *MJPEGServer) waitFrame(ctx context.Context, seq uint64) ([]byte, uint64, error) {
+	for {
+		s.mu.Lock()
+		frame, latest, ready := s.frame, s.seq, s.ready
+		s.mu.Unlock()
+		if latest != seq {
+			return frame, latest, nil
+		}
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, seq, ctx.Err()
+		}
+	}
+}
+
+// ServeStream writes the multipart MJPEG stream until the client disconnects.
+func (s *MJPEGServer) ServeStream(w http.ResponseWriter, r *http.Request) {
+	const boundary = "goshadertoyframe"
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+boundary)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	var seq uint64
+	var frame []byte
+	var err error
+	for {
+		if frame, seq, err = s.waitFrame(r.Context(), seq); err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", boundary, len(frame)); err != nil {
+			return
+		}
+		if _, err := w.Write(frame); err != nil {
+			return
+		}
+		if _, err := w.Write([]byte("\r\n")); err != nil {
+			return
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+// ServeSnapshot writes the latest frame as a single JPEG.
+func (s *MJPEGServer) ServeSnapshot(w http.ResponseWriter, r *http.Request) {
+	frame := s.Latest()
+	if frame == nil {
+		http.Error(w, "no frame rendered yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(frame)
+}
+
+// Register adds the preview page, stream, and snapshot handlers to mux.
+func (s *MJPEGServer) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/stream.mjpg", s.ServeStream)
+	mux.HandleFunc("/snapshot.jpg", s.ServeSnapshot)
+}
+
+// ListenAndServe serves the preview page on addr in the background.
+func (s *MJPEGServer) ListenAndServe(addr string) {
+	mux := http.NewServeMux()
+	s.Register(mux)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(pageHTML))
+	})
+	go func() {
+		log.Printf("Preview available at http://%s/", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("Preview server stopped: %v", err)
+		}
+	}()
+}
+
+// yuvToRGBA converts planar BT.709 limited-range YUV 4:4:4 to RGBA, decimating
+// to at most maxWidth pixels wide with nearest-neighbour sampling.
+func yuvToRGBA(pixels []byte, width, height, bitDepth, maxWidth int) *image.RGBA {
+	step := 1
+	for width/step > maxWidth {
+		step++
+	}
+	outW, outH := width/step, height/step
+	img := image.NewRGBA(image.Rect(0, 0, outW, outH))
+
+	bytesPerSample := 1
+	if bitDepth > 8 {
+		bytesPerSample = 2
+	}
+	planeSize := width * height * bytesPerSample
+	if len(pixels) < planeSize*3 {
+		return img
+	}
+
+	// sample returns a plane value normalized to 8-bit code values.
+	scale := float64(int(1) << max(bitDepth-8, 0))
+	sample := func(plane, idx int) float64 {
+		off := plane*planeSize + idx*bytesPerSample
+		if bytesPerSample == 1 {
+			return float64(pixels[off])
+		}
+		v := uint16(pixels[off]) | uint16(pixels[off+1])<<8
+		return float64(v) / scale
+	}
+
+	for y := 0; y < outH; y++ {
+		for x := 0; x < outW; x++ {
+			idx := (y*step)*width + x*step
+			yy := (sample(0, idx) - 16) / 219
+			cb := (sample(1, idx) - 128) / 224
+			cr := (sample(2, idx) - 128) / 224
+
+			r := yy + 1.5748*cr
+			g := yy - 0.1873*cb - 0.4681*cr
+			b := yy + 1.8556*cb
+
+			o := img.PixOffset(x, y)
+			img.Pix[o] = clamp8(r)
+			img.Pix[o+1] = clamp8(g)
+			img.Pix[o+2] = clamp8(b)
+			img.Pix[o+3] = 255
+		}
+	}
+	return img
+}
+
+// scaleRGBA copies RGBA pixels into an image, decimating to at most maxWidth
+// pixels wide with nearest-neighbour sampling.
+func scaleRGBA(pixels []byte, width, height int, flipY bool, maxWidth int) *image.RGBA {
+	step := 1
+	for width/step > maxWidth {
+		step++
+	}
+	outW, outH := width/step, height/step
+	img := image.NewRGBA(image.Rect(0, 0, outW, outH))
+	if len(pixels) < width*height*4 {
+		return img
+	}
+	for y := 0; y < outH; y++ {
+		srcY := y * step
+		if flipY {
+			srcY = height - 1 - srcY
+		}
+		for x := 0; x < outW; x++ {
+			src := (srcY*width + x*step) * 4
+			o := img.PixOffset(x, y)
+			copy(img.Pix[o:o+3], pixels[src:src+3])
+			img.Pix[o+3] = 255
+		}
+	}
+	return img
+}
+
+func clamp8(v float64) uint8 {
+	v = v*255 + 0.5
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
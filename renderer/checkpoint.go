@@ -0,0 +1,200 @@
+package renderer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	options "github.com/richinsley/goshadertoy/options"
+	sink "github.com/richinsley/goshadertoy/sink"
+)
+
+const checkpointFile = "checkpoint.json"
+
+// checkpointState is persisted after every finished segment of a checkpointed
+// record run. Frame is the next frame to render.
+type checkpointState struct {
+	Shader           string            `json:"shader"`
+	Width            int               `json:"width"`
+	Height           int               `json:"height"`
+	FPS              int               `json:"fps"`
+	Duration         float64           `json:"duration"`
+	Frame            int               `json:"frame"`
+	AudioSamplesSent int64             `json:"audioSamplesSent"`
+	Segments         []string          `json:"segments"`
+	Buffers          map[string]string `json:"buffers"` // Buffer name -> state file
+}
+
+// recordCheckpoint writes a record run as a series of segments in a checkpoint
+// directory, so an interrupted run can resume after the last finished segment.
+type recordCheckpoint struct {
+	dir           string
+	options       *options.ShaderOptions
+	segmentFrames int
+	state         checkpointState
+}
+
+// openRecordCheckpoint loads the checkpoint in -checkpoint-dir, or starts a new
+// one. A checkpoint made with different settings is rejected.
+func openRecordCheckpoint(opts *options.ShaderOptions) (*recordCheckpoint, error) {
+	c := &recordCheckpoint{
+		dir:           *opts.CheckpointDir,
+		options:       opts,
+		segmentFrames: int(*opts.CheckpointInterval * float64(*opts.FPS)),
+		state: checkpointState{
+			Shader:   *opts.ShaderID,
+			Width:    *opts.Width,
+			Height:   *opts.Height,
+			FPS:      *opts.FPS,
+			Duration: *opts.Duration,
+		},
+	}
+	if c.segmentFrames < 1 {
+		c.segmentFrames = 1
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.dir, checkpointFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved checkpointState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint in %s: %w", c.dir, err)
+	}
+	if saved.Shader != c.state.Shader || saved.Width != c.state.Width || saved.Height != c.state.Height ||
+		saved.FPS != c.state.FPS || saved.Duration != c.state.Duration {
+		return nil, fmt.Errorf("the checkpoint in %s was made with different settings; remove it to start over", c.dir)
+	}
+	c.state = saved
+	return c, nil
+}
+
+// nextSegmentOptions returns options that write the next segment file.
+func (c *recordCheckpoint) nextSegmentOptions() *options.ShaderOptions {
+	opts := c.options.Clone()
+	name := fmt.Sprintf("segment-%04d%s", len(c.state.Segments), filepath.Ext(*c.options.OutputFile))
+	*opts.OutputFile = filepath.Join(c.dir, name)
+	*opts.Outputs = ""
+	c.state.Segments = append(c.state.Segments, name)
+	return opts
+}
+
+// save records that every frame before frame has been written to a finished
+// segment, together with the scene's buffer contents.
+func (c *recordCheckpoint) save(r *Renderer, frame int, audioSamplesSent int64) error {
+	c.state.Frame = frame
+	c.state.AudioSamplesSent = audioSamplesSent
+	c.state.Buffers = make(map[string]string)
+	for name, buffer := range r.activeScene.Buffers {
+		file := "buffer-" + name + ".bin"
+		if err := writeFloats(filepath.Join(c.dir, file), buffer.ReadState()); err != nil {
+			return fmt.Errorf("failed to save buffer %s: %w", name, err)
+		}
+		c.state.Buffers[name] = file
+	}
+
+	data, err := json.MarshalIndent(c.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(c.dir, checkpointFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(c.dir, checkpointFile))
+}
+
+// restoreBuffers loads the saved buffer contents into the active scene.
+func (c *recordCheckpoint) restoreBuffers(r *Renderer) error {
+	for name, file := range c.state.Buffers {
+		buffer, ok := r.activeScene.Buffers[name]
+		if !ok {
+			return fmt.Errorf("checkpoint has state for buffer %s, which the shader does not use", name)
+		}
+		data, err := readFloats(filepath.Join(c.dir, file))
+		if err != nil {
+			return fmt.Errorf("failed to load buffer %s: %w", name, err)
+		}
+		if err := buffer.WriteState(data); err != nil {
+			return fmt.Errorf("failed to restore buffer %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// finish joins the segments into the final output and removes the checkpoint.
+func (c *recordCheckpoint) finish() error {
+	segments := make([]string, len(c.state.Segments))
+	for i, name := range c.state.Segments {
+		segments[i] = filepath.Join(c.dir, name)
+	}
+	log.Printf("Joining %d segments into %s", len(segments), *c.options.OutputFile)
+	if err := sink.ConcatSegments(segments, *c.options.OutputFile, *c.options.OutputFormat); err != nil {
+		return fmt.Errorf("failed to join segments (they are kept in %s): %w", c.dir, err)
+	}
+
+	for _, seg := range segments {
+		os.Remove(seg)
+	}
+	for _, file := range c.state.Buffers {
+		os.Remove(filepath.Join(c.dir, file))
+	}
+	os.Remove(filepath.Join(c.dir, checkpointFile))
+	os.Remove(c.dir) // Only succeeds if nothing else is in it
+	return nil
+}
+
+// skipAudio consumes the first samples stereo samples of the audio source, which
+// a resumed recording has already written. The source is read in chunks since
+// its buffer blocks when full.
+func (r *Renderer) skipAudio(samples int64) error {
+	chunk := int64(r.audioDevice.SampleRate())
+	for skipped := int64(0); skipped < samples; {
+		target := min(skipped+chunk, samples)
+		if err := r.audioDevice.DecodeUntil(target); err != nil {
+			return err
+		}
+		r.audioDevice.GetBuffer().Discard(int(target-skipped) * 2)
+		skipped = target
+	}
+	return nil
+}
+
+func writeFloats(path string, data []float32) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(f, binary.LittleEndian, data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readFloats(path string) ([]float32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]float32, info.Size()/4)
+	if err := binary.Read(f, binary.LittleEndian, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
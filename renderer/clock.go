@@ -0,0 +1,199 @@
+package renderer
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	audio "github.com/richinsley/goshadertoy/audio"
+	graphics "github.com/richinsley/goshadertoy/graphics"
+	timesource "github.com/richinsley/goshadertoy/timesource"
+)
+
+// Clocks are the live mode sources of iTime:
+//
+//   - window: the window system's timer, as Shadertoy uses the browser's
+//   - monotonic: the OS monotonic clock, which keeps running while the
+//     window system holds up the render loop, e.g. while a window is dragged
+//   - audio: the position of the audio device, so visuals stay locked to
+//     what is heard however far its sample clock drifts from the system's
+//   - ltc: SMPTE linear timecode on the timecode input (see SetTimecodeInput)
+//   - ntp: the wall clock since an epoch, kept in step across machines by NTP
+//     or PTP (see SetNTPClock)
+//
+// The ltc and ntp clocks let several machines, e.g. those driving a video
+// wall, render the same moment of a shader at the same time.
+var Clocks = map[string]bool{"window": true, "monotonic": true, "audio": true, "ltc": true, "ntp": true}
+
+const (
+	clockSlew   = 0.05 // Share of the drift from a reference corrected per update
+	clockResync = 0.25 // Drift in seconds that is corrected at once instead
+)
+
+// mediaClock is the time base of live mode.
+type mediaClock interface {
+	// Now returns the seconds since the clock started. It only decreases
+	// if the reference it follows jumps back.
+	Now() float64
+}
+
+// SetTimecodeInput makes the ltc clock read timecode from the audio of
+// device. The renderer reads its buffer; nothing else may.
+func (r *Renderer) SetTimecodeInput(device audio.AudioDevice) {
+	r.timecodeInput = device
+}
+
+// SetNTPClock makes the ntp clock count the time of source since epoch.
+func (r *Renderer) SetNTPClock(source *timesource.NTPClock, epoch time.Time) {
+	r.ntpSource, r.ntpEpoch = source, epoch
+}
+
+// newMediaClock returns the Clocks entry name, started now.
+func (r *Renderer) newMediaClock(name string) (mediaClock, error) {
+	switch name {
+	case "window", "":
+		return &windowClock{context: r.context, start: r.context.Time()}, nil
+	case "monotonic":
+		return &monotonicClock{start: time.Now()}, nil
+	case "audio":
+		if r.audioDevice == nil {
+			return nil, fmt.Errorf("the audio clock needs an audio device")
+		}
+		return &audioClock{
+			buffer: r.audioDevice.GetBuffer(),
+			rate:   float64(r.audioDevice.SampleRate()),
+			slewed: slewedClock{mono: monotonicClock{start: time.Now()}},
+		}, nil
+	case "ltc":
+		if r.timecodeInput == nil {
+			return nil, fmt.Errorf("the ltc clock needs a timecode input")
+		}
+		return &ltcClock{
+			buffer:  r.timecodeInput.GetBuffer(),
+			decoder: timesource.NewLTCDecoder(r.timecodeInput.SampleRate()),
+			rate:    float64(r.timecodeInput.SampleRate()),
+			slewed:  slewedClock{mono: monotonicClock{start: time.Now()}},
+		}, nil
+	case "ntp":
+		if r.ntpSource == nil {
+			return nil, fmt.Errorf("the ntp clock needs an epoch")
+		}
+		return &ntpClock{source: r.ntpSource, epoch: r.ntpEpoch}, nil
+	}
+	return nil, fmt.Errorf("unknown clock '%s'", name)
+}
+
+type windowClock struct {
+	context graphics.Context
+	start   float64
+}
+
+func (c *windowClock) Now() float64 {
+	return c.context.Time() - c.start
+}
+
+type monotonicClock struct {
+	start time.Time
+}
+
+func (c *monotonicClock) Now() float64 {
+	return time.Since(c.start).Seconds()
+}
+
+// slewedClock runs on the monotonic clock between the updates of a reference
+// that moves in steps, and is slewed towards each update rather than
+// stepping with it. It jumps to references too far off, e.g. when timecode is
+// rewound.
+type slewedClock struct {
+	mono   monotonicClock
+	offset float64 // Reference minus monotonic time
+	last   float64
+}
+
+// follow steers the clock towards the reference position at this moment.
+func (c *slewedClock) follow(position float64) {
+	drift := position - (c.mono.Now() + c.offset)
+	if math.Abs(drift) > clockResync {
+		c.offset += drift
+		c.last = position
+	} else {
+		c.offset += drift * clockSlew
+	}
+}
+
+func (c *slewedClock) Now() float64 {
+	c.last = max(c.last, c.mono.Now()+c.offset)
+	return c.last
+}
+
+// audioClock follows the samples the audio device has played, or captured if
+// nothing plays them. While they don't move, e.g. before the audio starts or
+// after it ends, the clock runs freely.
+type audioClock struct {
+	buffer      *audio.SharedAudioBuffer
+	rate        float64
+	slewed      slewedClock
+	lastSamples int64
+}
+
+func (c *audioClock) Now() float64 {
+	samples := c.buffer.TotalSamplesRead()
+	if samples == 0 {
+		samples = c.buffer.TotalSamplesWritten()
+	}
+	if samples != c.lastSamples {
+		c.lastSamples = samples
+		c.slewed.follow(float64(samples/2) / c.rate) // Interleaved stereo
+	}
+	return c.slewed.Now()
+}
+
+// ltcClock follows the timecode decoded from the left channel of the timecode
+// input, which it reads as it goes. Without timecode it runs freely.
+type ltcClock struct {
+	buffer  *audio.SharedAudioBuffer
+	decoder *timesource.LTCDecoder
+	rate    float64
+	slewed  slewedClock
+	stereo  []float32
+	mono    []float32
+	locked  bool
+}
+
+func (c *ltcClock) Now() float64 {
+	if c.stereo == nil {
+		c.stereo = make([]float32, 8192)
+	}
+	for {
+		n := c.buffer.ReadInto(c.stereo)
+		if n == 0 {
+			break
+		}
+		c.mono = c.mono[:0]
+		for i := 0; i < n; i += 2 {
+			c.mono = append(c.mono, c.stereo[i])
+		}
+		frames := c.decoder.Write(c.mono)
+		if len(frames) == 0 {
+			continue
+		}
+		f := frames[len(frames)-1]
+		if !c.locked {
+			log.Printf("Locked to LTC at %v, %.2f fps", f.Timecode, f.FPS)
+			c.locked = true
+		}
+		c.slewed.follow(f.EndTime() + float64(c.decoder.Samples()-f.End)/c.rate)
+	}
+	return c.slewed.Now()
+}
+
+// ntpClock is the time of an NTP-disciplined clock since an epoch.
+type ntpClock struct {
+	source *timesource.NTPClock
+	epoch  time.Time
+}
+
+func (c *ntpClock) Now() float64 {
+	return c.source.Now().Sub(c.epoch).Seconds()
+}
@@ -0,0 +1,276 @@
+package renderer
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	inputs "github.com/richinsley/goshadertoy/inputs"
+	preview "github.com/richinsley/goshadertoy/preview"
+	shader "github.com/richinsley/goshadertoy/shader"
+	sink "github.com/richinsley/goshadertoy/sink"
+	texshare "github.com/richinsley/goshadertoy/texshare"
+	gst "github.com/richinsley/goshadertranslator"
+)
+
+// standardUniforms are provided by the renderer and never exposed for adjustment.
+var standardUniforms = map[string]bool{
+	"iResolution": true, "iTime": true, "iTimeDelta": true, "iFrameRate": true,
+	"iFrame": true, "iMouse": true, "iDate": true, "iSampleRate": true,
+	"iChannelTime": true, "iChannelResolution": true, "iEye": true, "iEyeOffset": true, "iSeed": true, "iTime64": true,
+	"iChannel0": true, "iChannel1": true, "iChannel2": true, "iChannel3": true,
+	shader.ViewOffsetUniform: true,
+}
+
+// customUniform is a user-declared float/vec uniform of a render pass.
+type customUniform struct {
+	name       string
+	loc        int32
+	components int
+}
+
+// CustomUniform describes an adjustable uniform of the active scene.
+type CustomUniform struct {
+	Name       string
+	Components int
+	Value      []float32
+}
+
+// controlState holds the state shared with control interfaces running on other
+// goroutines. All GL work is deferred to the render thread through Post.
+type controlState struct {
+	postMu sync.Mutex
+	posted []func()
+
+	uniformMu     sync.Mutex
+	uniformValues map[string][]float32
+	sceneUniforms []CustomUniform // Adjustable uniforms of the active scene, without values
+
+	frames  atomic.Int64
+	fpsBits atomic.Uint64
+	stopped atomic.Bool
+
+	preview *preview.MJPEGServer
+	share   *texshare.Sender
+
+	sinkMu sync.Mutex
+	sink   sink.Sink
+}
+
+// Post queues fn to run on the render thread before the next frame.
+func (c *controlState) Post(fn func()) {
+	c.postMu.Lock()
+	c.posted = append(c.posted, fn)
+	c.postMu.Unlock()
+}
+
+func (c *controlState) runPosted() {
+	c.postMu.Lock()
+	posted := c.posted
+	c.posted = nil
+	c.postMu.Unlock()
+	for _, fn := range posted {
+		fn()
+	}
+}
+
+// Stop asks the render loop to finish. It is safe to call from any goroutine,
+// e.g. a signal handler. Record and stream modes flush and finalize their
+// outputs before RunOffscreen returns.
+func (c *controlState) Stop() {
+	c.stopped.Store(true)
+}
+
+func (c *controlState) stopRequested() bool {
+	return c.stopped.Load()
+}
+
+// SetUniformValue sets a custom uniform by name. The value applies to every
+// pass and scene that declares the uniform, and persists across scene switches.
+func (c *controlState) SetUniformValue(name string, value []float32) {
+	c.uniformMu.Lock()
+	defer c.uniformMu.Unlock()
+	if c.uniformValues == nil {
+		c.uniformValues = make(map[string][]float32)
+	}
+	c.uniformValues[name] = append([]float32(nil), value...)
+}
+
+// Frames returns the number of frames rendered so far.
+func (c *controlState) Frames() int64 {
+	return c.frames.Load()
+}
+
+// FPS returns the measured render rate.
+func (c *controlState) FPS() float64 {
+	return math.Float64frombits(c.fpsBits.Load())
+}
+
+// SetPreview makes the renderer feed rendered frames to pv. In record and stream
+// modes the encoder sink does this; in live mode the renderer reads back the
+// displayed image itself.
+func (c *controlState) SetPreview(pv *preview.MJPEGServer) {
+	c.preview = pv
+}
+
+// SetShareSender makes the renderer publish each rendered frame through s, for
+// other applications to receive over Syphon.
+func (c *controlState) SetShareSender(s *texshare.Sender) {
+	c.share = s
+}
+
+// EncoderStats returns per-output statistics, or nil when not encoding.
+func (c *controlState) EncoderStats() []sink.Stats {
+	c.sinkMu.Lock()
+	defer c.sinkMu.Unlock()
+	if c.sink == nil {
+		return nil
+	}
+	return c.sink.Stats()
+}
+
+func (c *controlState) setSink(s sink.Sink) {
+	c.sinkMu.Lock()
+	c.sink = s
+	c.sinkMu.Unlock()
+}
+
+// countFrame updates the frame counter and a smoothed FPS estimate.
+func (c *controlState) countFrame(delta time.Duration) {
+	c.frames.Add(1)
+	if delta <= 0 {
+		return
+	}
+	fps := 1 / delta.Seconds()
+	if prev := c.FPS(); prev > 0 {
+		fps = prev*0.9 + fps*0.1
+	}
+	c.fpsBits.Store(math.Float64bits(fps))
+}
+
+// findCustomUniforms returns the non-standard float uniforms of a translated shader.
+func findCustomUniforms(uniformMap map[string]gst.ShaderVariable, program uint32) []customUniform {
+	var uniforms []customUniform
+	for name, v := range uniformMap {
+		if v.Category != "uniforms" || standardUniforms[name] || strings.Contains(name, "[") {
+			continue
+		}
+		components := 0
+		switch v.Type {
+		case gl.FLOAT:
+			components = 1
+		case gl.FLOAT_VEC2:
+			components = 2
+		case gl.FLOAT_VEC3:
+			components = 3
+		case gl.FLOAT_VEC4:
+			components = 4
+		default:
+			continue
+		}
+		loc := gl.GetUniformLocation(program, gl.Str(v.MappedName+"\x00"))
+		if loc < 0 {
+			continue
+		}
+		uniforms = append(uniforms, customUniform{name: name, loc: loc, components: components})
+	}
+	return uniforms
+}
+
+// applyCustomUniforms uploads the values set through SetUniformValue for pass.
+// Must be called with the pass program in use.
+func (c *controlState) applyCustomUniforms(pass *RenderPass) {
+	if len(pass.customUniforms) == 0 {
+		return
+	}
+	c.uniformMu.Lock()
+	defer c.uniformMu.Unlock()
+	for _, u := range pass.customUniforms {
+		value, ok := c.uniformValues[u.name]
+		if !ok {
+			continue
+		}
+		var v [4]float32
+		copy(v[:], value)
+		switch u.components {
+		case 1:
+			gl.Uniform1f(u.loc, v[0])
+		case 2:
+			gl.Uniform2f(u.loc, v[0], v[1])
+		case 3:
+			gl.Uniform3f(u.loc, v[0], v[1], v[2])
+		case 4:
+			gl.Uniform4f(u.loc, v[0], v[1], v[2], v[3])
+		}
+	}
+}
+
+// CustomUniforms lists the adjustable uniforms of the active scene with their
+// current values.
+func (c *controlState) CustomUniforms() []CustomUniform {
+	c.uniformMu.Lock()
+	defer c.uniformMu.Unlock()
+	list := make([]CustomUniform, len(c.sceneUniforms))
+	for i, u := range c.sceneUniforms {
+		value := make([]float32, u.Components)
+		copy(value, c.uniformValues[u.Name])
+		list[i] = CustomUniform{Name: u.Name, Components: u.Components, Value: value}
+	}
+	return list
+}
+
+// setSceneUniforms records the adjustable uniforms of a newly active scene.
+func (c *controlState) setSceneUniforms(scene *Scene) {
+	seen := make(map[string]bool)
+	var list []CustomUniform
+	if scene != nil {
+		for _, pass := range scene.NamedPasses {
+			for _, u := range pass.customUniforms {
+				if !seen[u.name] {
+					seen[u.name] = true
+					list = append(list, CustomUniform{Name: u.name, Components: u.components})
+				}
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	c.uniformMu.Lock()
+	c.sceneUniforms = list
+	c.uniformMu.Unlock()
+}
+
+// SetFFTParams changes the audio analysis of every mic/music channel in the
+// active scene. It must be called on the render thread, or through Post.
+func (r *Renderer) SetFFTParams(params inputs.FFTParams) error {
+	if r.activeScene == nil {
+		return nil
+	}
+	for _, ch := range r.activeScene.allChannels {
+		if mic, ok := ch.(*inputs.MicChannel); ok {
+			if err := mic.SetFFTParams(params); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// updateLivePreview reads back the displayed image for the preview server when
+// a new preview frame is due.
+func (r *Renderer) updateLivePreview() {
+	if r.preview == nil || !r.preview.Due() {
+		return
+	}
+	width, height := r.offscreenRenderer.width, r.offscreenRenderer.height
+	pixels := make([]byte, width*height*4)
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, r.offscreenRenderer.fbo)
+	gl.ReadBuffer(gl.COLOR_ATTACHMENT0)
+	gl.ReadPixels(0, 0, int32(width), int32(height), gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(pixels))
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+	r.preview.UpdateRGBA(pixels, width, height, true)
+}
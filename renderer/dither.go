@@ -0,0 +1,184 @@
+package renderer
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// Ditherings are the dithering modes of the YUV conversion, which add noise
+// of about one output level before quantizing so smooth gradients don't band:
+//
+//   - none
+//   - triangular: white noise with a triangular PDF, which makes the
+//     quantization error independent of the signal
+//   - blue-noise: the same distribution from a blue noise texture, whose
+//     noise is high frequency and so less visible
+//
+// The noise changes every frame, so it averages out over time.
+var Ditherings = map[string]int32{"none": 0, "triangular": 1, "blue-noise": 2}
+
+const (
+	blueNoiseSize  = 64      // Width and height of the blue noise texture
+	blueNoiseSigma = 1.5     // Standard deviation of the void-and-cluster filter
+	ditherPeriod   = 1 << 16 // Frames before the noise repeats
+)
+
+// ditherState is the dithering of the YUV conversion.
+type ditherState struct {
+	mode     int32
+	texture  uint32 // Blue noise, once needed
+	frame    int32
+	modeLoc  int32
+	frameLoc int32
+}
+
+// SetDither sets the Ditherings entry the YUV conversion dithers with.
+func (r *Renderer) SetDither(mode string) error {
+	m, ok := Ditherings[mode]
+	if !ok {
+		return fmt.Errorf("unknown dithering '%s'", mode)
+	}
+	d := &r.dither
+	d.mode = m
+	gl.UseProgram(r.yuvProgram)
+	d.modeLoc = gl.GetUniformLocation(r.yuvProgram, gl.Str("u_dither\x00"))
+	d.frameLoc = gl.GetUniformLocation(r.yuvProgram, gl.Str("u_frame\x00"))
+	gl.Uniform1i(gl.GetUniformLocation(r.yuvProgram, gl.Str("u_noise\x00")), 1)
+	gl.Uniform1i(d.modeLoc, m)
+	gl.UseProgram(0)
+
+	if mode == "blue-noise" && d.texture == 0 {
+		gl.GenTextures(1, &d.texture)
+		gl.BindTexture(gl.TEXTURE_2D, d.texture)
+		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.R32F, blueNoiseSize, blueNoiseSize, 0, gl.RED, gl.FLOAT, gl.Ptr(blueNoise()))
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+	}
+	return nil
+}
+
+// bindDither sets up the next frame's dithering. Must be called with the YUV
+// program in use.
+func (r *Renderer) bindDither() {
+	d := &r.dither
+	if d.mode == 0 {
+		return
+	}
+	gl.Uniform1i(d.frameLoc, d.frame)
+	d.frame = (d.frame + 1) % ditherPeriod
+	if d.texture != 0 {
+		gl.ActiveTexture(gl.TEXTURE1)
+		gl.BindTexture(gl.TEXTURE_2D, d.texture)
+		gl.ActiveTexture(gl.TEXTURE0)
+	}
+}
+
+func (d *ditherState) destroy() {
+	if d.texture != 0 {
+		gl.DeleteTextures(1, &d.texture)
+		d.texture = 0
+	}
+}
+
+var (
+	blueNoiseOnce sync.Once
+	blueNoiseData []float32
+)
+
+// blueNoise returns a blueNoiseSize^2 blue noise texture, uniform in [0, 1),
+// made with Ulichney's void-and-cluster method.
+func blueNoise() []float32 {
+	blueNoiseOnce.Do(func() { blueNoiseData = voidAndCluster(blueNoiseSize, blueNoiseSigma) })
+	return blueNoiseData
+}
+
+// voidAndCluster ranks the pixels of a size x size tile so that the first n
+// of them are evenly spread for every n, and returns each pixel's rank
+// divided by size^2. The tile wraps around.
+func voidAndCluster(size int, sigma float64) []float32 {
+	n := size * size
+
+	// Energy a pixel adds to others, by toroidal offset.
+	kernel := make([]float64, n)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx := float64(min(x, size-x))
+			dy := float64(min(y, size-y))
+			kernel[y*size+x] = math.Exp(-(dx*dx + dy*dy) / (2 * sigma * sigma))
+		}
+	}
+	on := make([]bool, n)
+	energy := make([]float64, n)
+	toggle := func(p int, set bool) {
+		on[p] = set
+		sign := 1.0
+		if !set {
+			sign = -1
+		}
+		px, py := p%size, p/size
+		for y := 0; y < size; y++ {
+			row := ((y - py + size) % size) * size
+			for x := 0; x < size; x++ {
+				energy[y*size+x] += sign * kernel[row+(x-px+size)%size]
+			}
+		}
+	}
+	// extreme returns the pixel of state set with the highest energy, the
+	// tightest cluster, or of !set with the lowest, the largest void.
+	extreme := func(set bool) int {
+		best := -1
+		for p := range energy {
+			if on[p] != set {
+				continue
+			}
+			if best < 0 || (set && energy[p] > energy[best]) || (!set && energy[p] < energy[best]) {
+				best = p
+			}
+		}
+		return best
+	}
+
+	// The initial pattern: a tenth of the pixels at random, then spread out
+	// by moving the tightest cluster to the largest void until it stays.
+	rng := rand.New(rand.NewSource(1))
+	ones := n / 10
+	for _, p := range rng.Perm(n)[:ones] {
+		toggle(p, true)
+	}
+	for i := 0; i < n; i++ {
+		cluster := extreme(true)
+		toggle(cluster, false)
+		void := extreme(false)
+		toggle(void, true)
+		if void == cluster {
+			break
+		}
+	}
+	initial := append([]bool(nil), on...)
+	initialEnergy := append([]float64(nil), energy...)
+
+	rank := make([]float32, n)
+	// Rank the initial pixels by removing clusters...
+	for r := ones - 1; r >= 0; r-- {
+		p := extreme(true)
+		toggle(p, false)
+		rank[p] = float32(r)
+	}
+	// ...and the rest by filling voids.
+	copy(on, initial)
+	copy(energy, initialEnergy)
+	for r := ones; r < n; r++ {
+		p := extreme(false)
+		toggle(p, true)
+		rank[p] = float32(r)
+	}
+	for p := range rank {
+		rank[p] /= float32(n)
+	}
+	return rank
+}
@@ -0,0 +1,57 @@
+package renderer
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+// dumpShaderSource writes the assembled source of a pass, and its translation
+// if there is one, to the -dump-shaders directory as
+// <dir>/<shader>/<pass>.glsl and <pass>.translated.glsl. Failures are logged
+// and otherwise ignored.
+func dumpShaderSource(opts *options.ShaderOptions, title, pass, source, translated string) {
+	if opts == nil || opts.DumpShaders == nil || *opts.DumpShaders == "" {
+		return
+	}
+	dir := filepath.Join(*opts.DumpShaders, dumpDirName(title))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Warning: could not create shader dump directory: %v", err)
+		return
+	}
+	files := map[string]string{pass + ".glsl": source}
+	if translated != "" {
+		files[pass+".translated.glsl"] = translated
+	}
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			log.Printf("Warning: could not write %s: %v", path, err)
+			continue
+		}
+		log.Printf("Wrote %s", path)
+	}
+}
+
+// dumpDirName turns a shader title into a directory name.
+func dumpDirName(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	name := strings.TrimSuffix(b.String(), "-")
+	if name == "" {
+		return "shader"
+	}
+	return name
+}
@@ -0,0 +1,17 @@
+package renderer
+
+// FrameLock keeps the frames of instances on several machines in step, e.g.
+// with the framelock package.
+type FrameLock interface {
+	// Begin returns the number and time of the next frame to render, given
+	// those of the instance's own counter and clock.
+	Begin(frame int64, t float64) (int64, float64)
+	// Ready waits until every instance may show frame.
+	Ready(frame int64)
+}
+
+// SetFrameLock renders the frames lock decides on in live mode and shows each
+// when lock allows, so several machines render and show them together.
+func (r *Renderer) SetFrameLock(lock FrameLock) {
+	r.frameLock = lock
+}
@@ -0,0 +1,38 @@
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	graphics "github.com/richinsley/goshadertoy/graphics"
+)
+
+// GLInfo describes the driver behind ctx: vendor, renderer, versions and
+// extensions. ctx must be current on the calling thread.
+func GLInfo(ctx graphics.Context) (string, error) {
+	if initErr := initGL(ctx); initErr != nil {
+		return "", fmt.Errorf("failed to initialize OpenGL: %w", initErr)
+	}
+
+	var b strings.Builder
+	for _, s := range []struct {
+		name string
+		id   uint32
+	}{
+		{"vendor", gl.VENDOR},
+		{"renderer", gl.RENDERER},
+		{"version", gl.VERSION},
+		{"GLSL version", gl.SHADING_LANGUAGE_VERSION},
+	} {
+		fmt.Fprintf(&b, "%s: %s\n", s.name, gl.GoStr(gl.GetString(s.id)))
+	}
+	fmt.Fprintf(&b, "GLES: %v\n", ctx.IsGLES())
+	var n int32
+	gl.GetIntegerv(gl.NUM_EXTENSIONS, &n)
+	b.WriteString("extensions:\n")
+	for i := int32(0); i < n; i++ {
+		fmt.Fprintf(&b, "  %s\n", gl.GoStr(gl.GetStringi(gl.EXTENSIONS, uint32(i))))
+	}
+	return b.String(), nil
+}
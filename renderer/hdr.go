@@ -0,0 +1,82 @@
+package renderer
+
+import (
+	"fmt"
+	"log"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	shader "github.com/richinsley/goshadertoy/shader"
+)
+
+// HDROutputs are the encodings of HDR display output in live mode:
+//
+//   - scrgb: linear BT.709 on a floating-point framebuffer, for window
+//     systems that present float framebuffers as extended-range sRGB
+//   - pq: SMPTE ST 2084 in BT.2020 on a 10-bit framebuffer, for outputs and
+//     compositors that take HDR10 signals as they are
+//
+// Values above 1.0 in the frame, which SDR output clips, then show brighter
+// than SDR white.
+var HDROutputs = map[string]int32{"scrgb": 0, "pq": 1}
+
+// hdrOutput is the HDR presentation of live mode.
+type hdrOutput struct {
+	program uint32
+}
+
+// SetHDROutput presents live frames on the window encoded as the HDROutputs
+// entry mode, with the frame's 1.0 at white nits. The window system must
+// present the framebuffer as that encoding: nothing here tags the surface's
+// colour space. SetHDROutput fails if the window's framebuffer can't hold the
+// encoding, a floating-point one for scrgb or 10 bits per channel for pq.
+func (r *Renderer) SetHDROutput(mode string, white float64) error {
+	m, ok := HDROutputs[mode]
+	if !ok {
+		return fmt.Errorf("unknown HDR output '%s'", mode)
+	}
+
+	// The default framebuffer's back buffer is BACK_LEFT in desktop GL.
+	attachment := uint32(gl.BACK_LEFT)
+	if r.isGLES() {
+		attachment = gl.BACK
+	}
+	var componentType, redBits int32
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	gl.GetFramebufferAttachmentParameteriv(gl.FRAMEBUFFER, attachment, gl.FRAMEBUFFER_ATTACHMENT_COMPONENT_TYPE, &componentType)
+	gl.GetFramebufferAttachmentParameteriv(gl.FRAMEBUFFER, attachment, gl.FRAMEBUFFER_ATTACHMENT_RED_SIZE, &redBits)
+	switch {
+	case mode == "scrgb" && componentType != gl.FLOAT:
+		return fmt.Errorf("the window has no floating-point framebuffer for scRGB output")
+	case mode == "pq" && redBits < 10:
+		return fmt.Errorf("the window framebuffer has %d bits per channel, PQ output needs 10", redBits)
+	}
+
+	program, err := newProgram(shader.GenerateVertexShader(r.isGLES()), shader.GetHDRBlitFragmentShader(r.isGLES()))
+	if err != nil {
+		return fmt.Errorf("failed to create HDR blit program: %w", err)
+	}
+	gl.UseProgram(program)
+	gl.Uniform1i(gl.GetUniformLocation(program, gl.Str("u_texture\x00")), 0)
+	gl.Uniform1i(gl.GetUniformLocation(program, gl.Str("u_mode\x00")), m)
+	gl.Uniform1f(gl.GetUniformLocation(program, gl.Str("u_white\x00")), float32(white))
+	gl.UseProgram(0)
+
+	if r.hdr != nil {
+		r.hdr.destroy()
+	}
+	r.hdr = &hdrOutput{program: program}
+	log.Printf("Presenting HDR as %s, SDR white at %g nits", mode, white)
+	return nil
+}
+
+// presentProgram returns the program that draws frames to the window.
+func (r *Renderer) presentProgram() uint32 {
+	if r.hdr != nil {
+		return r.hdr.program
+	}
+	return r.blitProgram
+}
+
+func (h *hdrOutput) destroy() {
+	gl.DeleteProgram(h.program)
+}
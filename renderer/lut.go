@@ -0,0 +1,213 @@
+package renderer
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	shader "github.com/richinsley/goshadertoy/shader"
+)
+
+// CubeLUT is a 3D color lookup table in the Adobe/Resolve .cube format.
+type CubeLUT struct {
+	Title     string
+	Size      int        // Entries along each axis
+	DomainMin [3]float32 // Input color at the first entry of each axis
+	DomainMax [3]float32 // Input color at the last entry of each axis
+	Data      []float32  // Size^3 RGB entries, red varying fastest, then green
+}
+
+// LoadCubeLUT reads a 3D LUT from a .cube file. 1D LUTs are not supported.
+func LoadCubeLUT(path string) (*CubeLUT, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lut := &CubeLUT{DomainMax: [3]float32{1, 1, 1}}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(text)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch fields[0] {
+		case "TITLE":
+			lut.Title = strings.Trim(strings.TrimSpace(strings.TrimPrefix(text, "TITLE")), `"`)
+		case "LUT_3D_SIZE":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: LUT_3D_SIZE needs a size", line)
+			}
+			if lut.Size, err = strconv.Atoi(fields[1]); err != nil || lut.Size < 2 || lut.Size > 256 {
+				return nil, fmt.Errorf("line %d: invalid LUT_3D_SIZE '%s'", line, fields[1])
+			}
+			lut.Data = make([]float32, 0, lut.Size*lut.Size*lut.Size*3)
+		case "LUT_1D_SIZE":
+			return nil, fmt.Errorf("1D LUTs are not supported")
+		case "DOMAIN_MIN", "DOMAIN_MAX":
+			v, err := parseCubeValues(fields[1:], 3)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %w", line, fields[0], err)
+			}
+			if fields[0] == "DOMAIN_MIN" {
+				lut.DomainMin = [3]float32(v)
+			} else {
+				lut.DomainMax = [3]float32(v)
+			}
+		case "LUT_3D_INPUT_RANGE": // Resolve's form of an equal domain for each channel
+			v, err := parseCubeValues(fields[1:], 2)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: LUT_3D_INPUT_RANGE: %w", line, err)
+			}
+			lut.DomainMin = [3]float32{v[0], v[0], v[0]}
+			lut.DomainMax = [3]float32{v[1], v[1], v[1]}
+		default:
+			if lut.Size == 0 {
+				return nil, fmt.Errorf("line %d: entries before LUT_3D_SIZE", line)
+			}
+			v, err := parseCubeValues(fields, 3)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			lut.Data = append(lut.Data, v...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if lut.Size == 0 {
+		return nil, fmt.Errorf("no LUT_3D_SIZE")
+	}
+	if n := len(lut.Data) / 3; n != lut.Size*lut.Size*lut.Size {
+		return nil, fmt.Errorf("%d entries, expected %d", n, lut.Size*lut.Size*lut.Size)
+	}
+	for i := range lut.DomainMin {
+		if lut.DomainMax[i] <= lut.DomainMin[i] {
+			return nil, fmt.Errorf("empty domain")
+		}
+	}
+	return lut, nil
+}
+
+// parseCubeValues parses the n numbers of a .cube entry or keyword.
+func parseCubeValues(fields []string, n int) ([]float32, error) {
+	if len(fields) != n {
+		return nil, fmt.Errorf("expected %d values, got %d", n, len(fields))
+	}
+	v := make([]float32, n)
+	for i, field := range fields {
+		f, err := strconv.ParseFloat(field, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value '%s'", field)
+		}
+		v[i] = float32(f)
+	}
+	return v, nil
+}
+
+// lutRenderer grades the rendered frame through a 3D LUT. The grade is drawn
+// into a scratch texture and copied back, so everything reading the frame
+// afterwards sees it graded.
+type lutRenderer struct {
+	program   uint32
+	lutTex    uint32
+	scratch   postTarget
+	size      int
+	gradeLoc  int32
+	domainMin [3]float32
+	domainMax [3]float32
+}
+
+// SetLUT grades every rendered frame through the .cube LUT at path, before
+// the overlay, display and encoding, e.g. to match a broadcast or film look.
+// An empty path removes the grade.
+func (r *Renderer) SetLUT(path string) error {
+	if path == "" {
+		if r.lut != nil {
+			r.lut.destroy()
+			r.lut = nil
+		}
+		return nil
+	}
+	lut, err := LoadCubeLUT(path)
+	if err != nil {
+		return fmt.Errorf("failed to load LUT %s: %w", path, err)
+	}
+
+	l := &lutRenderer{size: lut.Size, domainMin: lut.DomainMin, domainMax: lut.DomainMax}
+	l.program, err = newProgram(shader.GenerateVertexShader(r.isGLES()), shader.GetLUTFragmentShader(r.isGLES()))
+	if err != nil {
+		return fmt.Errorf("failed to create LUT program: %w", err)
+	}
+	gl.UseProgram(l.program)
+	gl.Uniform1i(gl.GetUniformLocation(l.program, gl.Str("u_texture\x00")), 0)
+	gl.Uniform1i(gl.GetUniformLocation(l.program, gl.Str("u_lut\x00")), 1)
+	gl.Uniform3f(gl.GetUniformLocation(l.program, gl.Str("u_domainMin\x00")), l.domainMin[0], l.domainMin[1], l.domainMin[2])
+	gl.Uniform3f(gl.GetUniformLocation(l.program, gl.Str("u_domainMax\x00")), l.domainMax[0], l.domainMax[1], l.domainMax[2])
+	gl.Uniform1f(gl.GetUniformLocation(l.program, gl.Str("u_size\x00")), float32(l.size))
+	l.gradeLoc = gl.GetUniformLocation(l.program, gl.Str("u_grade\x00"))
+	gl.UseProgram(0)
+
+	gl.GenTextures(1, &l.lutTex)
+	gl.BindTexture(gl.TEXTURE_3D, l.lutTex)
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 4)
+	gl.TexImage3D(gl.TEXTURE_3D, 0, gl.RGB16F, int32(lut.Size), int32(lut.Size), int32(lut.Size), 0, gl.RGB, gl.FLOAT, gl.Ptr(lut.Data))
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	for _, wrap := range []uint32{gl.TEXTURE_WRAP_S, gl.TEXTURE_WRAP_T, gl.TEXTURE_WRAP_R} {
+		gl.TexParameteri(gl.TEXTURE_3D, wrap, gl.CLAMP_TO_EDGE)
+	}
+	gl.BindTexture(gl.TEXTURE_3D, 0)
+
+	if r.lut != nil {
+		r.lut.destroy()
+	}
+	r.lut = l
+	title := lut.Title
+	if title == "" {
+		title = path
+	}
+	log.Printf("Grading through LUT %s (%d^3)", title, lut.Size)
+	return nil
+}
+
+// renderLUT grades the width x height frame in the offscreen FBO.
+func (r *Renderer) renderLUT(width, height int) {
+	l := r.lut
+	l.scratch.resize(width, height)
+	gl.UseProgram(l.program)
+	gl.BindVertexArray(r.quadVAO)
+	gl.ActiveTexture(gl.TEXTURE1)
+	gl.BindTexture(gl.TEXTURE_3D, l.lutTex)
+	gl.ActiveTexture(gl.TEXTURE0)
+
+	// Grade the frame into the scratch texture, then copy it back.
+	gl.Uniform1i(l.gradeLoc, 1)
+	l.scratch.draw(r.offscreenRenderer.textureID)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, r.offscreenRenderer.fbo)
+	gl.Viewport(0, 0, int32(width), int32(height))
+	gl.BindTexture(gl.TEXTURE_2D, l.scratch.texture)
+	gl.Uniform1i(l.gradeLoc, 0)
+	gl.DrawArrays(gl.TRIANGLES, 0, 6)
+
+	gl.ActiveTexture(gl.TEXTURE1)
+	gl.BindTexture(gl.TEXTURE_3D, 0)
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.UseProgram(0)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+}
+
+func (l *lutRenderer) destroy() {
+	gl.DeleteProgram(l.program)
+	gl.DeleteTextures(1, &l.lutTex)
+	l.scratch.destroy()
+}
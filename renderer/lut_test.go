@@ -0,0 +1,89 @@
+package renderer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// identityCube is the body of a 2^3 identity LUT, red varying fastest.
+const identityCube = `0 0 0
+1 0 0
+0 1 0
+1 1 0
+0 0 1
+1 0 1
+0 1 1
+1 1 1
+`
+
+func TestLoadCubeLUT(t *testing.T) {
+	tests := []struct {
+		name      string
+		cube      string
+		title     string
+		size      int
+		domainMin [3]float32
+		domainMax [3]float32
+		err       string // Substring of the error; empty if the LUT loads
+	}{
+		{
+			name:      "identity",
+			cube:      "# comment\nTITLE \"Identity\"\nLUT_3D_SIZE 2\n\n" + identityCube,
+			title:     "Identity",
+			size:      2,
+			domainMax: [3]float32{1, 1, 1},
+		},
+		{
+			name:      "domain",
+			cube:      "LUT_3D_SIZE 2\nDOMAIN_MIN 0 -0.5 0\nDOMAIN_MAX 1 2 4\n" + identityCube,
+			size:      2,
+			domainMin: [3]float32{0, -0.5, 0},
+			domainMax: [3]float32{1, 2, 4},
+		},
+		{
+			name:      "input range",
+			cube:      "LUT_3D_INPUT_RANGE -1 2\nLUT_3D_SIZE 2\n" + identityCube,
+			size:      2,
+			domainMin: [3]float32{-1, -1, -1},
+			domainMax: [3]float32{2, 2, 2},
+		},
+		{name: "no size", cube: "TITLE \"Empty\"\n", err: "no LUT_3D_SIZE"},
+		{name: "size too small", cube: "LUT_3D_SIZE 1\n0 0 0\n", err: "invalid LUT_3D_SIZE '1'"},
+		{name: "size not a number", cube: "LUT_3D_SIZE big\n", err: "invalid LUT_3D_SIZE 'big'"},
+		{name: "size without value", cube: "LUT_3D_SIZE\n", err: "line 1: LUT_3D_SIZE needs a size"},
+		{name: "1D", cube: "LUT_1D_SIZE 16\n", err: "1D LUTs are not supported"},
+		{name: "entries before size", cube: "0 0 0\nLUT_3D_SIZE 2\n", err: "line 1: entries before LUT_3D_SIZE"},
+		{name: "short entry", cube: "LUT_3D_SIZE 2\n0 0\n", err: "line 2: expected 3 values, got 2"},
+		{name: "invalid entry", cube: "LUT_3D_SIZE 2\n0 x 0\n", err: "line 2: invalid value 'x'"},
+		{name: "missing entries", cube: "LUT_3D_SIZE 2\n0 0 0\n", err: "1 entries, expected 8"},
+		{name: "short domain", cube: "DOMAIN_MIN 0 0\n", err: "line 1: DOMAIN_MIN: expected 3 values, got 2"},
+		{name: "empty domain", cube: "LUT_3D_SIZE 2\nDOMAIN_MAX 1 0 1\n" + identityCube, err: "empty domain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.cube")
+			if err := os.WriteFile(path, []byte(tt.cube), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			lut, err := LoadCubeLUT(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("LoadCubeLUT = %v, want error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lut.Title != tt.title || lut.Size != tt.size || lut.DomainMin != tt.domainMin || lut.DomainMax != tt.domainMax {
+				t.Fatalf("LoadCubeLUT = title %q size %d domain %v-%v, want %q %d %v-%v",
+					lut.Title, lut.Size, lut.DomainMin, lut.DomainMax, tt.title, tt.size, tt.domainMin, tt.domainMax)
+			}
+			if len(lut.Data) != 3*tt.size*tt.size*tt.size || lut.Data[3] != 1 || lut.Data[len(lut.Data)-1] != 1 {
+				t.Fatalf("LoadCubeLUT data = %v", lut.Data)
+			}
+		})
+	}
+}
@@ -7,9 +7,10 @@ import (
 
 	gl "github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/richinsley/goshadertoy/audio"
-	"github.com/richinsley/goshadertoy/encoder"
 	"github.com/richinsley/goshadertoy/inputs"
+	"github.com/richinsley/goshadertoy/inputscript"
 	"github.com/richinsley/goshadertoy/options"
+	"github.com/richinsley/goshadertoy/sink"
 )
 
 type OffscreenRenderer struct {
@@ -20,8 +21,11 @@ type OffscreenRenderer struct {
 	blitTextureID     uint32
 	width             int
 	height            int
-	pbos              []uint32 // Use a slice for a variable number of PBOs
-	pboIndex          int      // Index to track which PBO is currently in use
+	ring              []readbackSlot // Frames of YUV readback in flight
+	framePool         *sink.FramePool
+	oldest            int // Slot of the oldest frame in flight
+	inFlight          int
+	stats             readbackStats
 	bitDepth          int
 	yuvFbo            uint32
 	yuvTextureIDs     [3]uint32
@@ -38,15 +42,14 @@ func getFormatForBitDepth(bitDepth int) (glInternalFormat int32, glpixelFormat u
 	}
 }
 func NewOffscreenRenderer(width, height, bitDepth, numPBOs int) (*OffscreenRenderer, error) {
-	if numPBOs < 2 {
-		return nil, fmt.Errorf("number of PBOs must be at least 2")
+	if numPBOs < 1 {
+		return nil, fmt.Errorf("number of PBOs must be at least 1")
 	}
 
 	or := &OffscreenRenderer{
 		width:    width,
 		height:   height,
 		bitDepth: bitDepth,
-		pbos:     make([]uint32, numPBOs*3), // 3 PBOs per frame (Y, U, V)
 	}
 
 	var internalColorFormat int32
@@ -101,8 +104,7 @@ func NewOffscreenRenderer(width, height, bitDepth, numPBOs int) (*OffscreenRende
 		return nil, fmt.Errorf("yuv fbo is not complete")
 	}
 
-	// PBO Initialization
-	gl.GenBuffers(int32(len(or.pbos)), &or.pbos[0])
+	// PBO Initialization: numPBOs frames of 3 planes (Y, U, V)
 	_, _, pixelType := getFormatForBitDepth(bitDepth)
 	var bytesPerPixel int
 	switch pixelType {
@@ -113,13 +115,9 @@ func NewOffscreenRenderer(width, height, bitDepth, numPBOs int) (*OffscreenRende
 	default:
 		return nil, fmt.Errorf("unsupported pixel type for PBO sizing: %v", pixelType)
 	}
-	bufferSize := width * height * bytesPerPixel
-	for i := 0; i < len(or.pbos); i++ {
-		gl.BindBuffer(gl.PIXEL_PACK_BUFFER, or.pbos[i])
-		gl.BufferData(gl.PIXEL_PACK_BUFFER, bufferSize, nil, gl.STREAM_READ)
-	}
+	or.ring = newReadbackRing(numPBOs, width, height, bytesPerPixel)
+	or.framePool = sink.NewFramePool(width * height * bytesPerPixel * 3)
 
-	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
 	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
 	return or, nil
 }
@@ -130,68 +128,55 @@ func (or *OffscreenRenderer) Destroy() {
 	gl.DeleteRenderbuffers(1, &or.depthRenderbuffer)
 	gl.DeleteFramebuffers(1, &or.yuvFbo)
 	gl.DeleteTextures(3, &or.yuvTextureIDs[0])
-	gl.DeleteBuffers(int32(len(or.pbos)), &or.pbos[0])
-}
-
-func (or *OffscreenRenderer) readYUVPixelsAsync(width, height int) ([]byte, error) {
-	_, pixelFormat, pixelType := getFormatForBitDepth(or.bitDepth)
-	var bytesPerPixel int
-	switch pixelType {
-	case gl.UNSIGNED_BYTE:
-		bytesPerPixel = 1
-	case gl.UNSIGNED_SHORT:
-		bytesPerPixel = 2
-	default:
-		return nil, fmt.Errorf("unsupported pixel type")
-	}
-
-	planeSize := width * height * bytesPerPixel
-	yuvData := make([]byte, planeSize*3) // Y, U, V planes concatenated
-
-	// This logic implements triple-buffering with PBOs to avoid stalling the pipeline.
-	for i := 0; i < 3; i++ { // For each plane Y, U, V
-		currentPboIndex := (or.pboIndex + i) % len(or.pbos)
-		nextPboIndex := (or.pboIndex + i + 3) % len(or.pbos)
-
-		// 1. Issue read command for the current frame into the current PBO
-		gl.ReadBuffer(gl.COLOR_ATTACHMENT0 + uint32(i))
-		gl.BindBuffer(gl.PIXEL_PACK_BUFFER, or.pbos[currentPboIndex])
-		gl.ReadPixels(0, 0, int32(width), int32(height), pixelFormat, pixelType, nil)
-
-		// 2. Process the data from the *previous* frame's PBO (which should be ready now)
-		gl.BindBuffer(gl.PIXEL_PACK_BUFFER, or.pbos[nextPboIndex])
-		ptr := gl.MapBufferRange(gl.PIXEL_PACK_BUFFER, 0, planeSize, gl.MAP_READ_BIT)
-		if ptr == nil {
-			gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
-			return nil, fmt.Errorf("failed to map PBO for plane %d", i)
-		}
-
-		// Copy the data from the mapped PBO into our Go slice
-		pixelData := (*[1 << 30]byte)(ptr)[:planeSize:planeSize]
-		copy(yuvData[i*planeSize:], pixelData)
-
-		gl.UnmapBuffer(gl.PIXEL_PACK_BUFFER)
-	}
-
-	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
-	or.pboIndex = (or.pboIndex + 3) % len(or.pbos)
-
-	return yuvData, nil
+	or.destroyReadbackRing()
 }
 
-func findMicChannel(scene *Scene) *inputs.MicChannel {
+// findMicChannels returns the audio analysis channels (mic, music and
+// spectrogram) of scene.
+func findMicChannels(scene *Scene) []*inputs.MicChannel {
 	if scene == nil {
 		return nil
 	}
+	var mics []*inputs.MicChannel
 	// It's sufficient to check the named passes as they are a superset
 	for _, pass := range scene.NamedPasses {
 		for _, ch := range pass.Channels {
 			if mic, ok := ch.(*inputs.MicChannel); ok {
-				return mic
+				mics = append(mics, mic)
 			}
 		}
 	}
-	return nil
+	return mics
+}
+
+// micAudio holds the buffers feedMicChannels reuses from frame to frame.
+type micAudio struct {
+	window []float32
+	mono   []float32
+}
+
+// feedMicChannels updates the FFT of every mic channel from the latest audio
+// window. It must be called on the render thread.
+func (r *Renderer) feedMicChannels(mics []*inputs.MicChannel) {
+	r.micAudio.window = r.audioDevice.GetBuffer().WindowPeekInto(r.micAudio.window)
+	r.micAudio.mono = audio.DownmixStereoToMonoInto(r.micAudio.mono, r.micAudio.window)
+	for _, mic := range mics {
+		mic.ProcessAudio(r.micAudio.mono)
+	}
+}
+
+// chapterMarker starts a chapter of the output whenever the scene changes.
+type chapterMarker struct {
+	scene *Scene
+}
+
+// mark starts a chapter at frame if scene differs from that of the previous
+// frame.
+func (m *chapterMarker) mark(scene *Scene, out sink.Sink, frame int64) {
+	if scene != m.scene {
+		m.scene = scene
+		out.AddChapter(frame, scene.Title)
+	}
 }
 
 func (r *Renderer) RunOffscreen(options *options.ShaderOptions) error {
@@ -204,48 +189,76 @@ func (r *Renderer) RunOffscreen(options *options.ShaderOptions) error {
 func (r *Renderer) runStreamMode(options *options.ShaderOptions) error {
 	log.Println("Starting in stream mode...")
 
-	ffEncoder, err := encoder.NewFFmpegEncoder(options)
+	ffEncoder, err := sink.NewSink(options, r.preview)
 	if err != nil {
 		return fmt.Errorf("failed to create CGO encoder: %w", err)
 	}
-	go ffEncoder.Run()
-
-	hasAudio := r.audioDevice != nil && (*options.AudioInputFile != "" || *options.AudioInputDevice != "")
-	if hasAudio {
-		go func() {
-			defer func() {
-				if r := recover(); r != nil {
-					log.Printf("Recovered in audio bridge: %v", r)
-				}
-			}()
-
-			samplesPerFrame := r.audioDevice.SampleRate() / *options.FPS
-			ticker := time.NewTicker(time.Second / time.Duration(*options.FPS))
-			defer ticker.Stop()
-
-			for range ticker.C {
-				samples := r.audioDevice.GetBuffer().Read(samplesPerFrame)
-				if len(samples) > 0 {
-					ffEncoder.SendAudio(samples)
-				}
-			}
-		}()
-	}
+	r.setSink(ffEncoder)
 
+	hasAudio := r.audioDevice != nil && (*options.AudioInputFile != "" || *options.AudioInputDevice != "" || options.HasSoundShader)
 	if *options.Prewarm {
 		log.Println("Pre-warming renderer...")
-		for i := 0; i < len(r.offscreenRenderer.pbos); i++ {
+		for i := 0; i < len(r.offscreenRenderer.ring); i++ {
 			r.RenderFrame(&inputs.Uniforms{})
 			r.RenderToYUV()
 		}
 		log.Println("Pre-warming complete.")
 	}
 
+	micChannels := findMicChannels(r.activeScene)
+	var chapters chapterMarker
 	startTime := time.Now()
 	frameDuration := time.Second / time.Duration(*options.FPS)
 	var frameCounter int64 = 0
 
+	// Audio is pulled per frame with the same accounting as record mode, so
+	// the audio track stays locked to the video PTS however long the stream
+	// runs. A source that falls behind is padded with silence.
+	var audioSamplesSent int64
+	sendAudio := func(frame int64) {
+		targetSample := (frame + 1) * int64(r.audioDevice.SampleRate()) / int64(*options.FPS)
+		frameSamples := int(targetSample-audioSamplesSent) * 2
+		stereoSamples := r.audioDevice.GetBuffer().Read(frameSamples)
+		if len(stereoSamples) < frameSamples {
+			r.audioDevice.GetBuffer().ReportUnderrun()
+			stereoSamples = append(stereoSamples, make([]float32, frameSamples-len(stereoSamples))...)
+		}
+		ffEncoder.SendAudio(stereoSamples)
+		audioSamplesSent = targetSample
+	}
+
+	// Frames are read back a few frames after they are rendered, in order.
+	var nextPTS int64
+	sendFrames := func(frames []*sink.Frame) {
+		for _, frame := range frames {
+			frame.PTS = nextPTS
+			ffEncoder.SendVideo(frame)
+			frame.Release()
+			nextPTS++
+		}
+	}
+	finish := func() error {
+		frames, err := r.offscreenRenderer.drainYUVPixels(*options.Width, *options.Height)
+		sendFrames(frames)
+		if err != nil {
+			log.Printf("Error reading pixels at end of stream: %v", err)
+		}
+		r.offscreenRenderer.logReadbackStats(time.Since(startTime))
+		err = ffEncoder.Close()
+		sink.LogQueueStats(ffEncoder)
+		return err
+	}
+
 	for {
+		if r.stopRequested() {
+			log.Printf("Stopping stream after %d frames, finalizing outputs...", frameCounter)
+			return finish()
+		}
+		if err := ffEncoder.Err(); err != nil {
+			log.Printf("Stopping stream after %d frames, the encoder failed: %v", frameCounter, err)
+			return finish()
+		}
+
 		elapsedTime := time.Since(startTime)
 		shouldHaveRendered := int64(float64(elapsedTime) / float64(frameDuration))
 
@@ -258,25 +271,35 @@ func (r *Renderer) runStreamMode(options *options.ShaderOptions) error {
 			simTime := float64(frameCounter) * frameDuration.Seconds()
 			uniforms := &inputs.Uniforms{
 				Time:      float32(simTime),
+				TimeExact: simTime,
 				TimeDelta: float32(frameDuration.Seconds()),
 				FrameRate: float32(*options.FPS),
 				Frame:     int32(frameCounter),
 			}
 
+			if hasAudio {
+				sendAudio(frameCounter)
+				if len(micChannels) > 0 {
+					r.feedMicChannels(micChannels)
+				}
+			}
+
 			r.RenderFrame(uniforms)
+			chapters.mark(r.activeScene, ffEncoder, frameCounter)
 			r.RenderToYUV()
 
 			gl.BindFramebuffer(gl.READ_FRAMEBUFFER, r.offscreenRenderer.yuvFbo)
-			pixels, err := r.offscreenRenderer.readYUVPixelsAsync(*options.Width, *options.Height)
+			frames, err := r.offscreenRenderer.readYUVPixels(*options.Width, *options.Height)
 			gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+			sendFrames(frames)
 
 			if err != nil {
 				log.Printf("Error reading pixels on frame %d: %v", frameCounter, err)
 				return ffEncoder.Close()
 			}
 
-			ffEncoder.SendVideo(&encoder.Frame{Pixels: pixels, PTS: frameCounter})
 			frameCounter++
+			r.countFrame(frameDuration)
 		}
 	}
 }
@@ -284,68 +307,268 @@ func (r *Renderer) runStreamMode(options *options.ShaderOptions) error {
 func (r *Renderer) runRecordMode(options *options.ShaderOptions) error {
 	log.Println("Starting in record mode with CGO encoder...")
 
-	ffEncoder, err := encoder.NewFFmpegEncoder(options)
-	if err != nil {
-		return fmt.Errorf("failed to create CGO encoder: %w", err)
-	}
-	go ffEncoder.Run()
-
 	totalFrames := int(*options.Duration * float64(*options.FPS))
 	timeStep := 1.0 / float64(*options.FPS)
+	// With -sim-fps the shader takes substeps steps of simStep per frame, and
+	// only the first of them is encoded.
+	substeps := 1
+	if *options.SimFPS > 0 {
+		substeps = *options.SimFPS / *options.FPS
+	}
+	simStep := timeStep / float64(substeps)
+	simRate := float32(*options.FPS * substeps)
 	sampleRate := r.audioDevice.SampleRate()
-	samplesPerFrame := sampleRate / *options.FPS
-	micChannel := findMicChannel(r.activeScene)
+	micChannels := findMicChannels(r.activeScene)
 	hasAudio := r.audioDevice != nil && (*options.AudioInputFile != "" || *options.AudioInputDevice != "" || options.HasSoundShader)
+	audioEnded := false
+	var audioSamplesSent int64
+	startFrame := 0
+
+	// With -checkpoint-dir the output is written as segments, and a previous
+	// interrupted run resumes after its last finished segment.
+	var checkpoint *recordCheckpoint
+	if *options.CheckpointDir != "" {
+		var err error
+		if checkpoint, err = openRecordCheckpoint(options); err != nil {
+			return err
+		}
+		if startFrame = checkpoint.state.Frame; startFrame > 0 {
+			log.Printf("Resuming from checkpoint at frame %d of %d", startFrame, totalFrames)
+			if err := checkpoint.restoreBuffers(r); err != nil {
+				return err
+			}
+			audioSamplesSent = checkpoint.state.AudioSamplesSent
+			if hasAudio {
+				if err := r.skipAudio(audioSamplesSent); err != nil {
+					log.Printf("Audio source ended: %v. Padding the rest with silence.", err)
+					audioEnded = true
+				}
+			}
+		}
+	}
+
+	openSink := func() (sink.Sink, error) {
+		sinkOptions := options
+		if checkpoint != nil {
+			sinkOptions = checkpoint.nextSegmentOptions()
+		}
+		out, err := sink.NewSink(sinkOptions, r.preview)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create CGO encoder: %w", err)
+		}
+		r.setSink(out)
+		return out, nil
+	}
+	ffEncoder, err := openSink()
+	if err != nil {
+		return err
+	}
+
+	// Readback lags rendering by a few frames, returning frames in order once
+	// the GPU has copied them out. The frames still in flight are drained
+	// before a sink is closed, so the PTS of every encoded frame matches the
+	// frame that was rendered.
+	segmentStart := startFrame
+	nextPTS := startFrame
+	sendFrames := func(frames []*sink.Frame) {
+		for _, frame := range frames {
+			frame.PTS = int64(nextPTS - segmentStart)
+			ffEncoder.SendVideo(frame)
+			frame.Release()
+			nextPTS++
+		}
+	}
+	drain := func() error {
+		frames, err := r.offscreenRenderer.drainYUVPixels(*options.Width, *options.Height)
+		sendFrames(frames)
+		return err
+	}
+
+	// With -load-state the shader continues from a saved state: its buffers
+	// are restored and iFrame and iTime count on from the saved frame.
+	var frameOffset int32
+	var timeOffset float64
+	if *options.LoadState != "" {
+		if err := r.LoadState(*options.LoadState); err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+		frame, t, _ := r.takeLoadedState()
+		frameOffset, timeOffset = frame+1, t+simStep
+	}
+
+	// With -warmup-frames the shader's simulation runs on without encoding
+	// before the first frame, so its buffers have converged by then. A resumed
+	// run restored them, so only counts the frames.
+	if warmup := *options.WarmupFrames; warmup > 0 {
+		if startFrame == 0 {
+			log.Printf("Warming up for %d frames...", warmup)
+		}
+		for i := 0; i < warmup && startFrame == 0 && !r.stopRequested(); i++ {
+			r.RenderFrame(&inputs.Uniforms{
+				Time:      float32(timeOffset + float64(i)*simStep),
+				TimeExact: timeOffset + float64(i)*simStep,
+				TimeDelta: float32(simStep),
+				FrameRate: simRate,
+				Frame:     frameOffset + int32(i),
+			})
+		}
+		frameOffset += int32(warmup)
+		timeOffset += float64(warmup) * simStep
+	}
+
+	// Scripted input is replayed from the start, so resuming reaches the same
+	// state.
+	var input *inputscript.Player
+	if *options.InputScript != "" {
+		script, err := inputscript.Load(*options.InputScript)
+		if err != nil {
+			return err
+		}
+		input = script.NewPlayer()
+		for i := 0; i < startFrame; i++ {
+			input.Frame(float64(i)*timeStep, *options.Width, *options.Height)
+		}
+	}
+
+	var chapters chapterMarker
+	recordStart := time.Now()
+	lastFrame := recordStart
+	progress := newProgressReporter(*options.Progress, totalFrames)
+	framesRendered := startFrame
+	stopped := false
+	var readErr error
+
+	for i := startFrame; i < totalFrames; i++ {
+		if r.stopRequested() {
+			log.Printf("Recording stopped at frame %d of %d, finalizing output...", i, totalFrames)
+			stopped = true
+			break
+		}
+		if err := ffEncoder.Err(); err != nil {
+			log.Printf("Recording stopped at frame %d of %d, the encoder failed: %v", i, totalFrames, err)
+			break
+		}
 
-	for i := 0; i < totalFrames; i++ {
 		currentTime := float64(i) * timeStep
 		uniforms := &inputs.Uniforms{
-			Time:      float32(currentTime),
-			TimeDelta: float32(timeStep),
-			FrameRate: float32(*options.FPS),
-			Frame:     int32(i),
+			Time:      float32(currentTime + timeOffset),
+			TimeExact: currentTime + timeOffset,
+			TimeDelta: float32(simStep),
+			FrameRate: simRate,
+			Frame:     int32(i*substeps) + frameOffset,
+		}
+		if input != nil {
+			uniforms.Mouse, uniforms.Keyboard = input.Frame(currentTime, *options.Width, *options.Height)
 		}
 
 		if hasAudio {
-			targetSample := int64((currentTime + timeStep) * float64(sampleRate))
+			// Frame i ends exactly at sample (i+1)*rate/fps. Computing the target
+			// from the frame index carries the fractional remainder forward, so the
+			// audio never drifts against the video PTS.
+			targetSample := int64(i+1) * int64(sampleRate) / int64(*options.FPS)
 
 			// will block when more audio is needed,
 			// and return immediately if the buffer is already sufficient.
-			if err := r.audioDevice.DecodeUntil(targetSample); err != nil {
-				log.Printf("Error decoding audio: %v. Audio stream will stop.", err)
-				ffEncoder.CloseAudio() // Safely close the audio channel
-				hasAudio = false       // Prevent further audio processing attempts
+			if !audioEnded {
+				if err := r.audioDevice.DecodeUntil(targetSample); err != nil {
+					log.Printf("Audio source ended: %v. Padding the rest with silence.", err)
+					audioEnded = true
+				}
 			}
 
-			// Read a frame's worth of audio if available.
-			if r.audioDevice.GetBuffer().AvailableSamples() > 0 {
-				stereoSamples := r.audioDevice.GetBuffer().Read(samplesPerFrame * 2)
-				if len(stereoSamples) > 0 {
-					ffEncoder.SendAudio(stereoSamples)
-				}
-			} else {
-				log.Println("No audio samples available for this frame, skipping audio send.")
+			// Send exactly this frame's share of audio, padding with silence if the
+			// source ran short so the audio track matches the video duration.
+			frameSamples := int(targetSample-audioSamplesSent) * 2
+			stereoSamples := r.audioDevice.GetBuffer().Read(frameSamples)
+			if len(stereoSamples) < frameSamples {
+				stereoSamples = append(stereoSamples, make([]float32, frameSamples-len(stereoSamples))...)
 			}
+			ffEncoder.SendAudio(stereoSamples)
+			audioSamplesSent = targetSample
 
-			if micChannel != nil {
-				fftStereoChunk := r.audioDevice.GetBuffer().WindowPeek()
-				monoSamples := audio.DownmixStereoToMono(fftStereoChunk)
-				micChannel.ProcessAudio(monoSamples)
+			if len(micChannels) > 0 {
+				r.feedMicChannels(micChannels)
 			}
 		}
 
 		r.RenderFrame(uniforms)
+		chapters.mark(r.activeScene, ffEncoder, int64(i-segmentStart))
 		r.RenderToYUV()
 
 		gl.BindFramebuffer(gl.READ_FRAMEBUFFER, r.offscreenRenderer.yuvFbo)
-		pixels, err := r.offscreenRenderer.readYUVPixelsAsync(*options.Width, *options.Height)
+		frames, err := r.offscreenRenderer.readYUVPixels(*options.Width, *options.Height)
 		gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+		sendFrames(frames)
 		if err != nil {
 			log.Printf("Error reading pixels on frame %d: %v", i, err)
+			readErr = err
 			break
 		}
-		ffEncoder.SendVideo(&encoder.Frame{Pixels: pixels, PTS: int64(i)})
+		// The steps up to the next frame are simulated without encoding.
+		for s := 1; s < substeps; s++ {
+			r.RenderFrame(&inputs.Uniforms{
+				Time:      float32(currentTime + float64(s)*simStep + timeOffset),
+				TimeExact: currentTime + float64(s)*simStep + timeOffset,
+				TimeDelta: float32(simStep),
+				FrameRate: simRate,
+				Frame:     uniforms.Frame + int32(s),
+				Mouse:     uniforms.Mouse,
+				Keyboard:  uniforms.Keyboard,
+			})
+		}
+		r.countFrame(time.Since(lastFrame))
+		lastFrame = time.Now()
+		framesRendered++
+		progress.update(framesRendered)
+
+		if checkpoint != nil && i+1-segmentStart >= checkpoint.segmentFrames && i+1 < totalFrames {
+			if readErr = drain(); readErr != nil {
+				log.Printf("Error reading pixels on frame %d: %v", i, readErr)
+				break
+			}
+			if err := ffEncoder.Close(); err != nil {
+				return fmt.Errorf("failed to finish segment: %w", err)
+			}
+			if err := checkpoint.save(r, i+1, audioSamplesSent); err != nil {
+				return fmt.Errorf("failed to write checkpoint: %w", err)
+			}
+			if ffEncoder, err = openSink(); err != nil {
+				return err
+			}
+			segmentStart = i + 1
+			chapters = chapterMarker{} // Each segment starts with the current scene
+		}
+	}
+
+	if err := drain(); err != nil {
+		log.Printf("Error reading pixels at end of recording: %v", err)
+	}
+	if *options.SaveState != "" {
+		if err := r.SaveState(*options.SaveState); err != nil {
+			log.Printf("Warning: failed to save state: %v", err)
+		}
+	}
+	err = ffEncoder.Close()
+	progress.finish(framesRendered)
+	r.offscreenRenderer.logReadbackStats(time.Since(recordStart))
+	sink.LogQueueStats(ffEncoder)
+	if err != nil || checkpoint == nil {
+		return err
+	}
+	if readErr != nil {
+		return fmt.Errorf("recording failed, resume from the checkpoint in %s: %w", checkpoint.dir, readErr)
 	}
 
-	return ffEncoder.Close()
+	if stopped {
+		if framesRendered == segmentStart {
+			// Nothing was written to the segment opened last.
+			checkpoint.state.Segments = checkpoint.state.Segments[:len(checkpoint.state.Segments)-1]
+		}
+		if err := checkpoint.save(r, framesRendered, audioSamplesSent); err != nil {
+			return fmt.Errorf("failed to write checkpoint: %w", err)
+		}
+		log.Printf("Checkpoint saved to %s; run the same command again to resume", checkpoint.dir)
+		return nil
+	}
+	return checkpoint.finish()
 }
@@ -0,0 +1,276 @@
+package renderer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"time"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	shader "github.com/richinsley/goshadertoy/shader"
+)
+
+// OverlayPositions are the corners and edges an overlay element can be placed
+// at, as the fraction of the free space left of and above it.
+var OverlayPositions = map[string][2]float64{
+	"top-left":     {0, 0},
+	"top":          {0.5, 0},
+	"top-right":    {1, 0},
+	"center":       {0.5, 0.5},
+	"bottom-left":  {0, 1},
+	"bottom":       {0.5, 1},
+	"bottom-right": {1, 1},
+}
+
+// TimestampModes are the OverlayConfig.Timestamp values: the render time of
+// the frame, or the wall clock when it was rendered.
+var TimestampModes = map[string]bool{"time": true, "clock": true}
+
+// OverlayConfig configures the elements burnt into the output.
+type OverlayConfig struct {
+	TitleSeconds      float64 // Seconds the title card shows after each scene starts; 0 disables it
+	TitlePosition     string
+	Timestamp         string // A TimestampModes value; empty disables it
+	TimestampPosition string
+	Watermark         string // PNG or JPEG image file; empty disables it
+	WatermarkPosition string
+	WatermarkOpacity  float64
+}
+
+// Enabled reports whether the config shows anything.
+func (c OverlayConfig) Enabled() bool {
+	return c.TitleSeconds > 0 || c.Timestamp != "" || c.Watermark != ""
+}
+
+const (
+	titleFadeSeconds = 0.5            // The title card fades out over its last half second
+	overlayGlyphW    = 6              // Font cell width, including a column of spacing
+	overlayGlyphH    = 9              // Font cell height, including a row of spacing
+	overlayPadding   = 2              // Font pixels between the text and the edge of its box
+	overlayMargin    = 0.03           // Distance of the elements from the edges, relative to the height
+	overlayWatermark = 0.25           // Largest watermark width, relative to the output width
+	overlayTimestamp = "15:04:05.000" // Clock timestamp layout
+)
+
+// overlayImage is an element uploaded to a texture. key identifies what it
+// shows, so it is only uploaded again when that changes.
+type overlayImage struct {
+	texture uint32
+	width   int
+	height  int
+	key     string
+}
+
+// overlayRenderer composites the title card, timestamp and watermark over
+// the rendered frame.
+type overlayRenderer struct {
+	config     OverlayConfig
+	program    uint32
+	opacityLoc int32
+	title      overlayImage
+	timestamp  overlayImage
+	watermark  overlayImage
+
+	scene      *Scene  // Scene the title card was shown for
+	sceneStart float64 // Render time that scene started at
+}
+
+// SetOverlay burns a title card, timestamp and watermark into every rendered
+// frame as configured. The title card credits the active scene's shader with
+// its title, author and source, as the Shadertoy license requires of
+// published renders, and shows again when the scene switches.
+func (r *Renderer) SetOverlay(config OverlayConfig) error {
+	for _, position := range []string{config.TitlePosition, config.TimestampPosition, config.WatermarkPosition} {
+		if _, ok := OverlayPositions[position]; !ok {
+			return fmt.Errorf("unknown overlay position '%s'", position)
+		}
+	}
+	if config.Timestamp != "" && !TimestampModes[config.Timestamp] {
+		return fmt.Errorf("unknown timestamp mode '%s'", config.Timestamp)
+	}
+	o := &overlayRenderer{config: config}
+	if config.Watermark != "" {
+		img, err := loadOverlayImage(config.Watermark)
+		if err != nil {
+			return fmt.Errorf("failed to load watermark: %w", err)
+		}
+		o.watermark.upload(img)
+	}
+
+	var err error
+	o.program, err = newProgram(shader.GenerateVertexShader(r.isGLES()), shader.GetOverlayFragmentShader(r.isGLES()))
+	if err != nil {
+		o.destroy()
+		return fmt.Errorf("failed to create overlay program: %w", err)
+	}
+	gl.UseProgram(o.program)
+	gl.Uniform1i(gl.GetUniformLocation(o.program, gl.Str("u_overlay\x00")), 0)
+	o.opacityLoc = gl.GetUniformLocation(o.program, gl.Str("u_opacity\x00"))
+	gl.UseProgram(0)
+
+	if r.overlay != nil {
+		r.overlay.destroy()
+	}
+	r.overlay = o
+	return nil
+}
+
+// loadOverlayImage decodes a PNG or JPEG file.
+func loadOverlayImage(path string) (*image.RGBA, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+	draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+	return img, nil
+}
+
+// renderOverlay composites the overlay elements for render time t into the
+// offscreen FBO.
+func (r *Renderer) renderOverlay(t float64, width, height int) {
+	o := r.overlay
+	if o.scene != r.activeScene {
+		o.scene, o.sceneStart = r.activeScene, t
+	}
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, r.offscreenRenderer.fbo)
+	gl.UseProgram(o.program)
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindVertexArray(r.quadVAO)
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.ONE, gl.ONE_MINUS_SRC_ALPHA) // Images are premultiplied
+
+	if o.watermark.texture != 0 {
+		w, h := o.watermark.width, o.watermark.height
+		if maxWidth := int(float64(width) * overlayWatermark); w > maxWidth {
+			w, h = maxWidth, h*maxWidth/w
+		}
+		o.draw(&o.watermark, w, h, o.config.WatermarkPosition, o.config.WatermarkOpacity, width, height)
+	}
+	if elapsed := t - o.sceneStart; elapsed < o.config.TitleSeconds {
+		lines := []string{o.scene.Title} // Already credits the author, if known
+		if o.scene.Source != "" {
+			lines = append(lines, o.scene.Source)
+		}
+		scale := max(2, height/180)
+		o.title.setText(lines, scale, width)
+		opacity := min(1, (o.config.TitleSeconds-elapsed)/titleFadeSeconds)
+		o.draw(&o.title, o.title.width, o.title.height, o.config.TitlePosition, opacity, width, height)
+	}
+	if o.config.Timestamp != "" {
+		var text string
+		if o.config.Timestamp == "clock" {
+			text = time.Now().Format(overlayTimestamp)
+		} else {
+			d := time.Duration(t * float64(time.Second))
+			text = fmt.Sprintf("%02d:%02d:%02d.%03d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, d.Milliseconds()%1000)
+		}
+		scale := max(1, height/360)
+		o.timestamp.setText([]string{text}, scale, width)
+		o.draw(&o.timestamp, o.timestamp.width, o.timestamp.height, o.config.TimestampPosition, 1, width, height)
+	}
+
+	gl.Disable(gl.BLEND)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.UseProgram(0)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+}
+
+// draw composites img at w x h pixels at a position of a width x height frame.
+func (o *overlayRenderer) draw(img *overlayImage, w, h int, position string, opacity float64, width, height int) {
+	anchor := OverlayPositions[position]
+	margin := int(float64(height) * overlayMargin)
+	x := margin + int(anchor[0]*float64(width-w-2*margin))
+	y := margin + int((1-anchor[1])*float64(height-h-2*margin)) // GL viewports start at the bottom
+	gl.Uniform1f(o.opacityLoc, float32(opacity))
+	gl.BindTexture(gl.TEXTURE_2D, img.texture)
+	gl.Viewport(int32(x), int32(y), int32(w), int32(h))
+	gl.DrawArrays(gl.TRIANGLES, 0, 6)
+}
+
+// setText shows lines of text in a box no wider than maxWidth, drawn with
+// font pixels of scale x scale.
+func (img *overlayImage) setText(lines []string, scale, maxWidth int) {
+	key := fmt.Sprint(lines, scale, maxWidth)
+	if key == img.key {
+		return
+	}
+	img.upload(textImage(lines, scale, maxWidth))
+	img.key = key
+}
+
+// upload replaces the image's texture contents.
+func (img *overlayImage) upload(rgba *image.RGBA) {
+	if img.texture == 0 {
+		gl.GenTextures(1, &img.texture)
+		gl.BindTexture(gl.TEXTURE_2D, img.texture)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	}
+	img.width, img.height = rgba.Bounds().Dx(), rgba.Bounds().Dy()
+	gl.BindTexture(gl.TEXTURE_2D, img.texture)
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA8, int32(img.width), int32(img.height), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(rgba.Pix))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+// textImage draws white text on a translucent black box. Characters outside
+// printable ASCII are drawn as '?', and lines too long for maxWidth end in
+// "...".
+func textImage(lines []string, scale, maxWidth int) *image.RGBA {
+	maxChars := max(1, (maxWidth/scale-2*overlayPadding+1)/overlayGlyphW)
+	rows := make([][]rune, len(lines))
+	columns := 0
+	for i, line := range lines {
+		rows[i] = []rune(line)
+		if len(rows[i]) > maxChars {
+			rows[i] = append(rows[i][:max(0, maxChars-3)], []rune("...")[:min(3, maxChars)]...)
+		}
+		columns = max(columns, len(rows[i]))
+	}
+	w := (columns*overlayGlyphW - 1 + 2*overlayPadding) * scale
+	h := (len(rows)*overlayGlyphH - 1 + 2*overlayPadding) * scale
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{A: 144}), image.Point{}, draw.Src)
+	white := image.NewUniform(color.White)
+	for row, line := range rows {
+		for col, c := range line {
+			if c < 0x20 || c > 0x7E {
+				c = '?'
+			}
+			glyph := font5x8[c-0x20]
+			for gx, bits := range glyph {
+				for gy := 0; gy < 8; gy++ {
+					if bits&(1<<gy) == 0 {
+						continue
+					}
+					x := (overlayPadding + col*overlayGlyphW + gx) * scale
+					y := (overlayPadding + row*overlayGlyphH + gy) * scale
+					draw.Draw(img, image.Rect(x, y, x+scale, y+scale), white, image.Point{}, draw.Src)
+				}
+			}
+		}
+	}
+	return img
+}
+
+func (o *overlayRenderer) destroy() {
+	gl.DeleteProgram(o.program)
+	for _, img := range []*overlayImage{&o.title, &o.timestamp, &o.watermark} {
+		if img.texture != 0 {
+			gl.DeleteTextures(1, &img.texture)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package renderer
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	shader "github.com/richinsley/goshadertoy/shader"
+)
+
+// PostConfig configures the post-processing chain applied to every frame
+// after the image pass, for a consistent finish across shaders.
+type PostConfig struct {
+	Grain      float64 // Film grain strength, in output levels of 0 to 1
+	Vignette   float64 // Darkening of the corners, 0 to 1
+	Aberration float64 // Chromatic aberration: shift of red and blue at the edges, relative to the frame
+	Bloom      float64 // Strength of the glow around areas brighter than Threshold
+	Threshold  float64 // Brightness bloom starts at
+}
+
+// postEffects are the effects of a post spec, with their PostConfig fields.
+var postEffects = map[string]func(*PostConfig) *float64{
+	"grain":      func(c *PostConfig) *float64 { return &c.Grain },
+	"vignette":   func(c *PostConfig) *float64 { return &c.Vignette },
+	"aberration": func(c *PostConfig) *float64 { return &c.Aberration },
+	"bloom":      func(c *PostConfig) *float64 { return &c.Bloom },
+	"threshold":  func(c *PostConfig) *float64 { return &c.Threshold },
+}
+
+// Enabled reports whether the config changes the frame.
+func (c PostConfig) Enabled() bool {
+	return c.Grain > 0 || c.Vignette > 0 || c.Aberration > 0 || c.Bloom > 0
+}
+
+// ParsePostConfig parses a post spec: comma-separated effect=strength pairs,
+// e.g. "grain=0.04,vignette=0.3,aberration=0.005,bloom=0.6,threshold=0.8".
+func ParsePostConfig(spec string) (PostConfig, error) {
+	c := PostConfig{Threshold: 0.8}
+	if strings.TrimSpace(spec) == "" {
+		return c, nil
+	}
+	for _, kv := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(kv, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		field, known := postEffects[key]
+		if !ok || !known {
+			names := make([]string, 0, len(postEffects))
+			for name := range postEffects {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return c, fmt.Errorf("invalid effect '%s' (valid: %s)", kv, strings.Join(names, ", "))
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || v < 0 {
+			return c, fmt.Errorf("invalid strength '%s' for %s", value, key)
+		}
+		*field(&c) = v
+	}
+	if c.Vignette > 1 {
+		return c, fmt.Errorf("invalid vignette %g. Must be between 0 and 1", c.Vignette)
+	}
+	return c, nil
+}
+
+const postBloomPasses = 2 // Blur passes of the bloom, each widening it
+
+// postTarget is a texture the post-processing chain renders into.
+type postTarget struct {
+	fbo     uint32
+	texture uint32
+	width   int
+	height  int
+}
+
+// resize (re)creates the target at width x height if its size differs. The
+// texture is RGBA16F, or RGBA8 where float textures can't be rendered to,
+// as in GLES without EXT_color_buffer_float.
+func (t *postTarget) resize(width, height int) {
+	if t.fbo != 0 && t.width == width && t.height == height {
+		return
+	}
+	if t.fbo == 0 {
+		gl.GenFramebuffers(1, &t.fbo)
+		gl.GenTextures(1, &t.texture)
+	}
+	t.width, t.height = width, height
+	gl.BindTexture(gl.TEXTURE_2D, t.texture)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA16F, int32(width), int32(height), 0, gl.RGBA, gl.FLOAT, nil)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, t.fbo)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, t.texture, 0)
+	if gl.CheckFramebufferStatus(gl.FRAMEBUFFER) != gl.FRAMEBUFFER_COMPLETE {
+		log.Println("Warning: float render targets are unavailable; post-processing is quantized to 8 bits.")
+		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA8, int32(width), int32(height), 0, gl.RGBA, gl.UNSIGNED_BYTE, nil)
+	}
+}
+
+// draw renders the current stage from texture into the target.
+func (t *postTarget) draw(texture uint32) {
+	gl.BindFramebuffer(gl.FRAMEBUFFER, t.fbo)
+	gl.Viewport(0, 0, int32(t.width), int32(t.height))
+	gl.BindTexture(gl.TEXTURE_2D, texture)
+	gl.DrawArrays(gl.TRIANGLES, 0, 6)
+}
+
+func (t *postTarget) destroy() {
+	if t.fbo != 0 {
+		gl.DeleteFramebuffers(1, &t.fbo)
+		gl.DeleteTextures(1, &t.texture)
+	}
+}
+
+// postRenderer runs the post-processing chain: bloom is extracted and blurred
+// at half resolution, then composited with the other effects into a scratch
+// texture that is copied back.
+type postRenderer struct {
+	config        PostConfig
+	program       uint32
+	stageLoc      int32
+	directionLoc  int32
+	seedLoc       int32
+	resolutionLoc int32
+	scratch       postTarget
+	bloom         [2]postTarget
+	frame         int
+}
+
+// SetPost applies the post-processing chain config to every rendered frame,
+// before the color grade and overlay. A config that changes nothing removes
+// the chain.
+func (r *Renderer) SetPost(config PostConfig) error {
+	if !config.Enabled() {
+		if r.post != nil {
+			r.post.destroy()
+			r.post = nil
+		}
+		return nil
+	}
+
+	p := &postRenderer{config: config}
+	var err error
+	p.program, err = newProgram(shader.GenerateVertexShader(r.isGLES()), shader.GetPostFragmentShader(r.isGLES()))
+	if err != nil {
+		return fmt.Errorf("failed to create post-processing program: %w", err)
+	}
+	loc := func(name string) int32 {
+		return gl.GetUniformLocation(p.program, gl.Str(name+"\x00"))
+	}
+	gl.UseProgram(p.program)
+	gl.Uniform1i(loc("u_texture"), 0)
+	gl.Uniform1i(loc("u_bloom"), 1)
+	gl.Uniform1f(loc("u_threshold"), float32(config.Threshold))
+	gl.Uniform1f(loc("u_bloomAmount"), float32(config.Bloom))
+	gl.Uniform1f(loc("u_aberration"), float32(config.Aberration))
+	gl.Uniform1f(loc("u_vignette"), float32(config.Vignette))
+	gl.Uniform1f(loc("u_grain"), float32(config.Grain))
+	p.stageLoc = loc("u_stage")
+	p.directionLoc = loc("u_direction")
+	p.seedLoc = loc("u_seed")
+	p.resolutionLoc = loc("u_resolution")
+	gl.UseProgram(0)
+
+	if r.post != nil {
+		r.post.destroy()
+	}
+	r.post = p
+	return nil
+}
+
+// renderPost runs the post-processing chain on the width x height frame in
+// the offscreen FBO.
+func (r *Renderer) renderPost(width, height int) {
+	p := r.post
+	p.scratch.resize(width, height)
+	gl.UseProgram(p.program)
+	gl.BindVertexArray(r.quadVAO)
+	gl.ActiveTexture(gl.TEXTURE0)
+
+	// Without bloom, u_bloom samples no texture, which is black.
+	bloom := &p.bloom[0]
+	if p.config.Bloom > 0 {
+		bloom.resize(max(1, width/2), max(1, height/2))
+		p.bloom[1].resize(bloom.width, bloom.height)
+		gl.Uniform1i(p.stageLoc, 1)
+		bloom.draw(r.offscreenRenderer.textureID)
+		gl.Uniform1i(p.stageLoc, 2)
+		for i := 0; i < postBloomPasses; i++ {
+			gl.Uniform2f(p.directionLoc, 1/float32(bloom.width), 0)
+			p.bloom[1].draw(bloom.texture)
+			gl.Uniform2f(p.directionLoc, 0, 1/float32(bloom.height))
+			bloom.draw(p.bloom[1].texture)
+		}
+	}
+
+	gl.Uniform1i(p.stageLoc, 3)
+	gl.Uniform1f(p.seedLoc, float32(p.frame%1024))
+	gl.Uniform2f(p.resolutionLoc, float32(width), float32(height))
+	gl.ActiveTexture(gl.TEXTURE1)
+	gl.BindTexture(gl.TEXTURE_2D, bloom.texture)
+	gl.ActiveTexture(gl.TEXTURE0)
+	p.scratch.draw(r.offscreenRenderer.textureID)
+
+	gl.Uniform1i(p.stageLoc, 0)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, r.offscreenRenderer.fbo)
+	gl.Viewport(0, 0, int32(width), int32(height))
+	gl.BindTexture(gl.TEXTURE_2D, p.scratch.texture)
+	gl.DrawArrays(gl.TRIANGLES, 0, 6)
+	p.frame++
+
+	gl.ActiveTexture(gl.TEXTURE1)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.UseProgram(0)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+}
+
+func (p *postRenderer) destroy() {
+	gl.DeleteProgram(p.program)
+	p.scratch.destroy()
+	p.bloom[0].destroy()
+	p.bloom[1].destroy()
+}
@@ -0,0 +1,94 @@
+package renderer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// progressInterval is how often record mode reports progress.
+const progressInterval = time.Second
+
+// ProgressEvent is one machine-readable progress report, written as a line of
+// JSON to stdout with -progress json.
+type ProgressEvent struct {
+	Event      string  `json:"event"` // "progress" or "done"
+	Frame      int     `json:"frame"`
+	TotalFrame int     `json:"totalFrames"`
+	Percent    float64 `json:"percent"`
+	FPS        float64 `json:"fps"`        // Average render+encode rate so far
+	ETASeconds float64 `json:"etaSeconds"` // Estimated time remaining
+	Elapsed    float64 `json:"elapsedSeconds"`
+}
+
+// progressReporter prints record mode progress in the format selected by -progress.
+type progressReporter struct {
+	format     string // "text", "json" or "none"
+	out        io.Writer
+	total      int
+	start      time.Time
+	lastReport time.Time
+}
+
+func newProgressReporter(format string, totalFrames int) *progressReporter {
+	now := time.Now()
+	return &progressReporter{format: format, out: os.Stdout, total: totalFrames, start: now, lastReport: now}
+}
+
+// update reports progress after frame frames have been rendered, at most once
+// per progressInterval.
+func (p *progressReporter) update(frames int) {
+	if p.format == "none" || time.Since(p.lastReport) < progressInterval {
+		return
+	}
+	p.lastReport = time.Now()
+	p.report("progress", frames)
+}
+
+// finish reports the final state.
+func (p *progressReporter) finish(frames int) {
+	if p.format == "none" {
+		return
+	}
+	p.report("done", frames)
+}
+
+func (p *progressReporter) report(event string, frames int) {
+	elapsed := time.Since(p.start).Seconds()
+	ev := ProgressEvent{Event: event, Frame: frames, TotalFrame: p.total, Elapsed: elapsed}
+	if p.total > 0 {
+		ev.Percent = 100 * float64(frames) / float64(p.total)
+	}
+	if elapsed > 0 {
+		ev.FPS = float64(frames) / elapsed
+	}
+	if ev.FPS > 0 {
+		ev.ETASeconds = float64(p.total-frames) / ev.FPS
+	}
+
+	if p.format == "json" {
+		data, _ := json.Marshal(ev)
+		fmt.Fprintln(p.out, string(data))
+		return
+	}
+	if event == "done" {
+		log.Printf("Rendered %d/%d frames in %s (%.1f fps)", frames, p.total, formatDuration(elapsed), ev.FPS)
+		return
+	}
+	log.Printf("Frame %d/%d (%.1f%%), %.1f fps, ETA %s", frames, p.total, ev.Percent, ev.FPS, formatDuration(ev.ETASeconds))
+}
+
+// formatDuration formats seconds as h:mm:ss or m:ss.
+func formatDuration(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Second)
+	h := int(d / time.Hour)
+	m := int(d/time.Minute) % 60
+	s := int(d/time.Second) % 60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
@@ -0,0 +1,243 @@
+package renderer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unsafe"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	graphics "github.com/richinsley/goshadertoy/graphics"
+	sink "github.com/richinsley/goshadertoy/sink"
+)
+
+// readbackSlot is one frame of the readback ring: a PBO per YUV plane and the
+// fence signaled once the GPU has finished copying the planes into them.
+type readbackSlot struct {
+	pbos   [3]uint32
+	mapped [3]unsafe.Pointer // Persistent mappings of the PBOs, or nil
+	fence  uintptr           // 0 while the slot holds no frame
+	issued time.Time         // When the reads were queued
+}
+
+// persistentMapFlags map a PBO once for its lifetime, coherently so a frame
+// can be copied out as soon as its fence is signaled.
+const persistentMapFlags = gl.MAP_READ_BIT | gl.MAP_PERSISTENT_BIT | gl.MAP_COHERENT_BIT
+
+// readbackStats measures the readback ring, to tune -numpbos.
+type readbackStats struct {
+	frames  int
+	latency time.Duration // Summed from queueing the reads to copying out the frame
+	copying time.Duration // CPU time copying frames out of the PBOs
+	blocked time.Duration // Time rendering waited for a full ring
+	stalls  int           // Frames that found the ring full
+}
+
+// newReadbackRing creates frames slots of PBOs for width x height planes of
+// bytesPerPixel. Where buffer storage is available the PBOs are mapped once,
+// persistently, which saves a map and an unmap per plane and frame.
+func newReadbackRing(frames, width, height, bytesPerPixel int) []readbackSlot {
+	size := width * height * bytesPerPixel
+	if hasBufferStorage() {
+		ring, err := allocReadbackRing(frames, size, true)
+		if err == nil {
+			log.Printf("Readback: %d frames of persistently mapped PBOs", frames)
+			return ring
+		}
+		log.Printf("Warning: %v; mapping readback PBOs per frame", err)
+	}
+	ring, _ := allocReadbackRing(frames, size, false)
+	return ring
+}
+
+// allocReadbackRing creates frames slots of PBOs of size bytes, mapped
+// persistently if persistent is set.
+func allocReadbackRing(frames, size int, persistent bool) ([]readbackSlot, error) {
+	ring := make([]readbackSlot, frames)
+	for i := range ring {
+		gl.GenBuffers(3, &ring[i].pbos[0])
+		for j, pbo := range ring[i].pbos {
+			gl.BindBuffer(gl.PIXEL_PACK_BUFFER, pbo)
+			if !persistent {
+				gl.BufferData(gl.PIXEL_PACK_BUFFER, size, nil, gl.STREAM_READ)
+				continue
+			}
+			gl.BufferStorage(gl.PIXEL_PACK_BUFFER, size, nil, persistentMapFlags)
+			if ring[i].mapped[j] = gl.MapBufferRange(gl.PIXEL_PACK_BUFFER, 0, size, persistentMapFlags); ring[i].mapped[j] == nil {
+				gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
+				destroyReadbackSlots(ring[:i+1])
+				return nil, fmt.Errorf("could not map readback PBOs persistently")
+			}
+		}
+	}
+	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
+	return ring, nil
+}
+
+// hasBufferStorage reports whether the current context can create immutable,
+// persistently mappable buffers: OpenGL 4.4, or ARB_buffer_storage, or
+// EXT_buffer_storage on OpenGL ES, where graphics.InitGLES loads
+// glBufferStorageEXT as gl.BufferStorage if the implementation has it.
+func hasBufferStorage() bool {
+	var major, minor int32
+	gl.GetIntegerv(gl.MAJOR_VERSION, &major)
+	gl.GetIntegerv(gl.MINOR_VERSION, &minor)
+	extensions := glExtensions()
+	if strings.HasPrefix(gl.GoStr(gl.GetString(gl.VERSION)), "OpenGL ES") {
+		return extensions["GL_EXT_buffer_storage"] && graphics.GLESFunctionLoaded("glBufferStorage")
+	}
+	return major > 4 || (major == 4 && minor >= 4) || extensions["GL_ARB_buffer_storage"]
+}
+
+// readYUVPixels queues the reads of the YUV planes of the frame just rendered
+// into the YUV FBO, and returns the frames whose reads have finished since,
+// oldest first, each as the Y, U and V planes concatenated. The frames come
+// from the renderer's frame pool and must be released. The reads are
+// asynchronous: a frame is returned by a later call, or by drainYUVPixels.
+// Only when every slot of the ring is still in flight does it wait, for the
+// oldest frame. The YUV FBO must be bound as the read framebuffer.
+func (or *OffscreenRenderer) readYUVPixels(width, height int) ([]*sink.Frame, error) {
+	frames, err := or.collectYUVPixels(width, height, false)
+	if err != nil {
+		return frames, err
+	}
+	if or.inFlight == len(or.ring) {
+		waitStart := time.Now()
+		frame, err := or.collectFrame(width, height, true)
+		or.stats.blocked += time.Since(waitStart)
+		or.stats.stalls++
+		if err != nil {
+			return frames, err
+		}
+		frames = append(frames, frame)
+	}
+
+	_, pixelFormat, pixelType := getFormatForBitDepth(or.bitDepth)
+	slot := &or.ring[(or.oldest+or.inFlight)%len(or.ring)]
+	for i, pbo := range slot.pbos {
+		gl.ReadBuffer(gl.COLOR_ATTACHMENT0 + uint32(i))
+		gl.BindBuffer(gl.PIXEL_PACK_BUFFER, pbo)
+		gl.ReadPixels(0, 0, int32(width), int32(height), pixelFormat, pixelType, nil)
+	}
+	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
+	slot.fence = gl.FenceSync(gl.SYNC_GPU_COMMANDS_COMPLETE, 0)
+	if slot.fence == 0 {
+		return frames, fmt.Errorf("failed to create readback fence")
+	}
+	slot.issued = time.Now()
+	or.inFlight++
+	return frames, nil
+}
+
+// drainYUVPixels waits for the frames still in flight and returns them, oldest
+// first, without queueing new reads. Afterwards the ring is empty again.
+func (or *OffscreenRenderer) drainYUVPixels(width, height int) ([]*sink.Frame, error) {
+	return or.collectYUVPixels(width, height, true)
+}
+
+// collectYUVPixels returns the frames in flight, oldest first, up to the first
+// whose reads haven't finished unless wait is set.
+func (or *OffscreenRenderer) collectYUVPixels(width, height int, wait bool) ([]*sink.Frame, error) {
+	var frames []*sink.Frame
+	for or.inFlight > 0 {
+		frame, err := or.collectFrame(width, height, wait)
+		if err != nil || frame == nil {
+			return frames, err
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// collectFrame copies out the oldest frame in flight into a pooled frame.
+// Without wait it returns nil if the GPU hasn't finished its reads yet.
+func (or *OffscreenRenderer) collectFrame(width, height int, wait bool) (*sink.Frame, error) {
+	slot := &or.ring[or.oldest]
+	var timeout uint64
+	if wait {
+		timeout = uint64(time.Second)
+	}
+	switch gl.ClientWaitSync(slot.fence, gl.SYNC_FLUSH_COMMANDS_BIT, timeout) {
+	case gl.ALREADY_SIGNALED, gl.CONDITION_SATISFIED:
+	case gl.TIMEOUT_EXPIRED:
+		if !wait {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("timed out waiting for frame readback")
+	default:
+		return nil, fmt.Errorf("failed to wait for frame readback")
+	}
+	gl.DeleteSync(slot.fence)
+	slot.fence = 0
+
+	_, _, pixelType := getFormatForBitDepth(or.bitDepth)
+	bytesPerPixel := 1
+	if pixelType == gl.UNSIGNED_SHORT {
+		bytesPerPixel = 2
+	}
+	planeSize := width * height * bytesPerPixel
+	frame := or.framePool.Get(0)
+	yuvData := frame.Pixels // Y, U, V planes concatenated
+	copyStart := time.Now()
+	var err error
+	for i, pbo := range slot.pbos {
+		if slot.mapped[i] != nil {
+			copy(yuvData[i*planeSize:], unsafe.Slice((*byte)(slot.mapped[i]), planeSize))
+			continue
+		}
+		gl.BindBuffer(gl.PIXEL_PACK_BUFFER, pbo)
+		ptr := gl.MapBufferRange(gl.PIXEL_PACK_BUFFER, 0, planeSize, gl.MAP_READ_BIT)
+		if ptr == nil {
+			err = fmt.Errorf("failed to map PBO for plane %d", i)
+			break
+		}
+		copy(yuvData[i*planeSize:], unsafe.Slice((*byte)(ptr), planeSize))
+		gl.UnmapBuffer(gl.PIXEL_PACK_BUFFER)
+	}
+	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
+
+	or.stats.copying += time.Since(copyStart)
+	or.stats.frames++
+	or.stats.latency += time.Since(slot.issued)
+	or.oldest = (or.oldest + 1) % len(or.ring)
+	or.inFlight--
+	if err != nil {
+		frame.Release()
+		return nil, err
+	}
+	return frame, nil
+}
+
+// logReadbackStats logs the latency of the frames read back so far and how
+// long rendering waited for them.
+func (or *OffscreenRenderer) logReadbackStats(elapsed time.Duration) {
+	s := or.stats
+	if s.frames == 0 {
+		return
+	}
+	perFrame := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 / float64(s.frames) }
+	log.Printf("Readback: %d frames at %.1f frames/s through %d slots, %.1f ms latency and %.2f ms copying per frame on average; rendering waited for a full ring %d times, %v in total",
+		s.frames, float64(s.frames)/elapsed.Seconds(), len(or.ring), perFrame(s.latency), perFrame(s.copying),
+		s.stalls, s.blocked.Round(time.Millisecond))
+	if s.stalls > s.frames/10 {
+		log.Printf("Warning: rendering waited for readback on %d of %d frames; a larger -numpbos may help", s.stalls, s.frames)
+	}
+}
+
+func (or *OffscreenRenderer) destroyReadbackRing() {
+	destroyReadbackSlots(or.ring)
+	or.ring = nil
+	or.oldest, or.inFlight = 0, 0
+}
+
+// destroyReadbackSlots deletes the fences and PBOs of slots. Deleting a PBO
+// also ends its persistent mapping.
+func destroyReadbackSlots(slots []readbackSlot) {
+	for i := range slots {
+		if slots[i].fence != 0 {
+			gl.DeleteSync(slots[i].fence)
+		}
+		gl.DeleteBuffers(3, &slots[i].pbos[0])
+	}
+}
@@ -0,0 +1,129 @@
+package renderer
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	headless "github.com/richinsley/goshadertoy/headless"
+	sink "github.com/richinsley/goshadertoy/sink"
+)
+
+// BenchmarkReadYUVPixels measures the readback ring at 1080p for each ring
+// size: how often rendering found the ring full, and how long it waited then.
+// The frames are only cleared, so the numbers are those of the readback alone.
+func BenchmarkReadYUVPixels(b *testing.B) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	const width, height = 1920, 1080
+	ctx, err := headless.NewHeadless(width, height)
+	if err != nil {
+		b.Skipf("no headless GL context: %v", err)
+	}
+	defer ctx.Shutdown()
+	if err := initGL(ctx); err != nil {
+		b.Fatal(err)
+	}
+
+	release := func(frames []*sink.Frame) {
+		for _, frame := range frames {
+			frame.Release()
+		}
+	}
+	for _, numPBOs := range []int{1, 2, 3, 4} {
+		b.Run(fmt.Sprintf("numpbos=%d", numPBOs), func(b *testing.B) {
+			or, err := NewOffscreenRenderer(width, height, 8, numPBOs)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer or.Destroy()
+			gl.BindFramebuffer(gl.FRAMEBUFFER, or.yuvFbo)
+			defer gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+
+			b.SetBytes(width * height * 3)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				value := [4]uint32{uint32(i), 128, 128, 255}
+				for plane := int32(0); plane < 3; plane++ {
+					gl.ClearBufferuiv(gl.COLOR, plane, &value[0])
+				}
+				frames, err := or.readYUVPixels(width, height)
+				release(frames)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			frames, err := or.drainYUVPixels(width, height)
+			release(frames)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(or.stats.stalls)/float64(b.N), "stalls/op")
+			b.ReportMetric(float64(or.stats.blocked.Nanoseconds())/float64(b.N), "blocked-ns/op")
+			b.ReportMetric(float64(or.stats.latency.Nanoseconds())/float64(or.stats.frames), "latency-ns/frame")
+		})
+	}
+}
+
+// TestReadbackRingOrder checks that frames come out of the ring in the order
+// they were rendered, whatever its size.
+func TestReadbackRingOrder(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	const width, height, frames = 64, 32, 10
+	ctx, err := headless.NewHeadless(width, height)
+	if err != nil {
+		t.Skipf("no headless GL context: %v", err)
+	}
+	defer ctx.Shutdown()
+	if err := initGL(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, numPBOs := range []int{1, 2, 3} {
+		or, err := NewOffscreenRenderer(width, height, 8, numPBOs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gl.BindFramebuffer(gl.FRAMEBUFFER, or.yuvFbo)
+		var got []byte
+		collect := func(out []*sink.Frame) {
+			for _, frame := range out {
+				got = append(got, frame.Pixels[0])
+				frame.Release()
+			}
+		}
+		for i := 0; i < frames; i++ {
+			value := [4]uint32{uint32(i), 0, 0, 0}
+			for plane := int32(0); plane < 3; plane++ {
+				gl.ClearBufferuiv(gl.COLOR, plane, &value[0])
+			}
+			out, err := or.readYUVPixels(width, height)
+			collect(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		out, err := or.drainYUVPixels(width, height)
+		collect(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+		or.Destroy()
+
+		if len(got) != frames {
+			t.Fatalf("numpbos=%d: read back %d frames, want %d", numPBOs, len(got), frames)
+		}
+		for i, v := range got {
+			if int(v) != i {
+				t.Errorf("numpbos=%d: frame %d holds the pixels of frame %d", numPBOs, i, v)
+			}
+		}
+	}
+}
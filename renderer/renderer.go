@@ -3,21 +3,37 @@ package renderer
 import (
 	"fmt"
 	"log"
-	"runtime"
 	"strings"
 	"time"
 
 	gl "github.com/go-gl/gl/v4.1-core/gl"
-	audio "github.com/richinsley/goshadertoy/audio"
 	glfwcontext "github.com/richinsley/goshadertoy/glfwcontext"
+	graphics "github.com/richinsley/goshadertoy/graphics"
 	inputs "github.com/richinsley/goshadertoy/inputs"
+	inputscript "github.com/richinsley/goshadertoy/inputscript"
+	options "github.com/richinsley/goshadertoy/options"
 	gst "github.com/richinsley/goshadertranslator"
 )
 
+// initGL loads the GL function pointers once per application run. GLES
+// contexts have loaded them with graphics.InitGLES when created, which gl.Init
+// would replace with the system OpenGL's.
+func initGL(ctx graphics.Context) error {
+	var err error
+	glInitOnce.Do(func() {
+		if ctx.IsGLES() {
+			return
+		}
+		err = gl.Init()
+	})
+	return err
+}
+
 func (r *Renderer) isGLES() bool {
-	// In record mode on Linux, we use a headless EGL context which uses GLES.
-	// For all other cases (interactive mode or other OSes), we use GLFW with desktop GL.
-	return r.recordMode && runtime.GOOS == "linux"
+	// In record mode on Linux, we use a headless EGL context which uses
+	// GLES, unless it was created for desktop GL (see headless.NewHeadlessGL).
+	// For all other cases (interactive mode or other OSes), we use desktop GL.
+	return r.recordMode && r.context.IsGLES()
 }
 
 var quadVertices = []float32{
@@ -41,16 +57,24 @@ func (r *Renderer) GetUniformLocation(uniformMap map[string]gst.ShaderVariable,
 func (r *Renderer) SetScene(scene *Scene) *Scene {
 	previousScene := r.activeScene
 	r.activeScene = scene
+	r.setSceneUniforms(scene)
 	if scene != nil {
 		log.Printf("Renderer active scene set to: %s", scene.Title)
+		if r.stereo != nil {
+			warnIfMonoScene(scene)
+		}
 	}
 	return previousScene
 }
 
 func (r *Renderer) RenderFrame(uniforms *inputs.Uniforms) {
+	r.runPosted()
 	if r.activeScene == nil {
 		return // Can't render without a scene
 	}
+	uniforms.Date = r.dateAt(uniforms.Time)
+	uniforms.Seed = r.seed
+	r.preciseTime(uniforms)
 
 	var renderWidth, renderHeight int
 
@@ -76,7 +100,7 @@ func (r *Renderer) RenderFrame(uniforms *inputs.Uniforms) {
 
 			// IMPORTANT: Resize the active scene's buffers
 			for _, buffer := range r.activeScene.Buffers {
-				buffer.Resize(fbWidth, fbHeight)
+				buffer.Resize(r.bufferSize(fbWidth, fbHeight))
 			}
 		}
 	} else {
@@ -85,19 +109,52 @@ func (r *Renderer) RenderFrame(uniforms *inputs.Uniforms) {
 		renderHeight = r.height
 	}
 
+	if r.stereo != nil {
+		r.renderStereo(uniforms, renderWidth, renderHeight)
+	} else {
+		r.renderPasses(uniforms, renderWidth, renderHeight, r.offscreenRenderer.fbo, true)
+	}
+	if r.post != nil {
+		r.renderPost(renderWidth, renderHeight)
+	}
+	if r.transfer != nil {
+		r.renderTransfer(renderWidth, renderHeight)
+	}
+	if r.lut != nil {
+		r.renderLUT(renderWidth, renderHeight)
+	}
+	if r.overlay != nil {
+		r.renderOverlay(float64(uniforms.Time), renderWidth, renderHeight)
+	}
+
+	if r.share != nil && r.activeScene.ImagePass != nil {
+		r.share.Send(r.offscreenRenderer.textureID, renderWidth, renderHeight)
+	}
+	r.savestate.frame, r.savestate.time = uniforms.Frame, float64(uniforms.Time)
+}
+
+// renderPasses renders the buffer passes of the active scene, then its image
+// pass into fbo. Unless allBuffers is set, only the buffer passes that depend
+// on the stereo eye are rendered.
+func (r *Renderer) renderPasses(uniforms *inputs.Uniforms, renderWidth, renderHeight int, fbo uint32, allBuffers bool) {
 	// Render Buffer Passes from the Active Scene
+	bufferWidth, bufferHeight := r.bufferSize(renderWidth, renderHeight)
 	for _, pass := range r.activeScene.BufferPasses {
 		if pass.Buffer == nil {
 			continue // Should not happen, but a safe check
 		}
+		if !allBuffers && !pass.usesEye() {
+			continue
+		}
 
 		pass.Buffer.BindForWriting()
 
 		gl.UseProgram(pass.ShaderProgram)
-		updateUniforms(pass, renderWidth, renderHeight, uniforms)
+		updateUniforms(pass, bufferWidth, bufferHeight, uniforms)
+		r.applyCustomUniforms(pass)
 		bindChannels(pass, uniforms)
 
-		gl.Viewport(0, 0, int32(renderWidth), int32(renderHeight))
+		gl.Viewport(0, 0, int32(bufferWidth), int32(bufferHeight))
 		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
 		gl.BindVertexArray(r.quadVAO)
 		gl.DrawArrays(gl.TRIANGLES, 0, 6)
@@ -110,9 +167,11 @@ func (r *Renderer) RenderFrame(uniforms *inputs.Uniforms) {
 	// Render the Final Image Pass from the Active Scene
 	imagePass := r.activeScene.ImagePass
 	if imagePass != nil {
-		gl.BindFramebuffer(gl.FRAMEBUFFER, r.offscreenRenderer.fbo)
+		gl.BindFramebuffer(gl.FRAMEBUFFER, fbo)
 		gl.UseProgram(imagePass.ShaderProgram)
 		updateUniforms(imagePass, renderWidth, renderHeight, uniforms)
+		r.applyView(imagePass, renderWidth, renderHeight, uniforms)
+		r.applyCustomUniforms(imagePass)
 		bindChannels(imagePass, uniforms)
 
 		gl.Viewport(0, 0, int32(renderWidth), int32(renderHeight))
@@ -129,6 +188,7 @@ func (r *Renderer) RenderToYUV() {
 	gl.BindFramebuffer(gl.FRAMEBUFFER, r.offscreenRenderer.yuvFbo)
 	gl.UseProgram(r.yuvProgram)
 	gl.Uniform1i(r.yuvBitDepthLoc, int32(r.offscreenRenderer.bitDepth))
+	r.bindDither()
 	gl.ActiveTexture(gl.TEXTURE0)
 	gl.BindTexture(gl.TEXTURE_2D, r.offscreenRenderer.textureID)
 	gl.Viewport(0, 0, int32(r.width), int32(r.height))
@@ -138,30 +198,99 @@ func (r *Renderer) RenderToYUV() {
 	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
 }
 
-func (r *Renderer) Run() {
+// OutputTexture returns the texture the final image renders into, before the
+// conversion to YUV, and its size: e.g. for headless.Headless.ExportDMABuf.
+func (r *Renderer) OutputTexture() (texture uint32, width, height int) {
+	return r.offscreenRenderer.textureID, r.width, r.height
+}
+
+// Run renders live until the window closes or Stop is called. With a
+// watchdog set, it returns ErrContextLost if the context is lost.
+func (r *Renderer) Run(options *options.ShaderOptions) error {
 	if r.context == nil {
-		return // Cannot run in interactive mode without a window context
+		return nil // Cannot run in interactive mode without a window context
+	}
+	if r.watchdog != nil {
+		defer r.watchdog.stop()
+	}
+	if gctx, ok := r.context.(*glfwcontext.Context); ok {
+		gctx.SetVSync(*options.VSync)
+	}
+	// Frames are paced to -max-fps on top of any vsync wait.
+	var frameInterval time.Duration
+	if *options.MaxFPS > 0 {
+		frameInterval = time.Duration(float64(time.Second) / *options.MaxFPS)
+	}
+	nextFrame := time.Now()
+
+	// With -record-input the session's mouse and keyboard are saved as an
+	// input script on exit.
+	var recorder *inputscript.Recorder
+	if *options.RecordInput != "" {
+		recorder = &inputscript.Recorder{}
+		defer func() {
+			if err := recorder.Script().Save(*options.RecordInput); err != nil {
+				log.Printf("Failed to save input script: %v", err)
+			} else {
+				log.Printf("Saved %d input events to %s", len(recorder.Script().Events), *options.RecordInput)
+			}
+		}()
+	}
+
+	clock, err := r.newMediaClock(*options.Clock)
+	if err != nil {
+		log.Printf("Warning: %v; using the window clock", err)
+		clock, _ = r.newMediaClock("window")
 	}
-	startTime := r.context.Time()
 	var frameCount int32 = 0
-	var lastFrameTime = r.context.Time()
+	var lastFrameTime float64
+	var timeOffset float64 // Moves iTime to that of a loaded state
+	// The -load-state buffers are loaded after the first frame, which sizes
+	// them to the window.
+	loadState := *options.LoadState
 
-	for !r.context.ShouldClose() {
+	for !r.context.ShouldClose() && !r.stopRequested() {
 		// If no scene is active, just clear the screen and continue.
 		if r.activeScene == nil {
+			r.runPosted()
 			fbWidth, fbHeight := r.context.GetFramebufferSize()
 			gl.Viewport(0, 0, int32(fbWidth), int32(fbHeight))
 			gl.ClearColor(0.0, 0.0, 0.0, 1.0)
 			gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
 			r.context.EndFrame()
+			if r.watchdog != nil && r.frameDone() {
+				return ErrContextLost
+			}
 			continue
 		}
 
-		currentTime := r.context.Time() - startTime
+		currentTime := clock.Now() + timeOffset
+		if frame, t, ok := r.takeLoadedState(); ok {
+			// Continue from the saved frame, a frame's time after it.
+			delta := currentTime - lastFrameTime
+			if delta <= 0 {
+				delta = 1.0 / 60
+			}
+			timeOffset += t + delta - currentTime
+			currentTime, lastFrameTime = t+delta, t
+			frameCount = frame + 1
+		}
+		if r.frameLock != nil {
+			frame, t := r.frameLock.Begin(int64(frameCount), currentTime)
+			frameCount, currentTime = int32(frame), t
+		}
 		timeDelta := float32(currentTime - lastFrameTime)
 		lastFrameTime = currentTime
 
 		mouseData := r.context.GetMouseInput()
+		var keyboard *graphics.KeyboardState
+		if gctx, ok := r.context.(*glfwcontext.Context); ok {
+			keyboard = gctx.GetKeyboardInput()
+		}
+		if recorder != nil {
+			fbWidth, fbHeight := r.context.GetFramebufferSize()
+			recorder.Frame(currentTime, mouseData, keyboard, fbWidth, fbHeight)
+		}
 
 		var sampleRate float32 = 44100
 		var channelResolutions [4][3]float32
@@ -184,42 +313,64 @@ func (r *Renderer) Run() {
 
 		uniforms := &inputs.Uniforms{
 			Time:              float32(currentTime),
+			TimeExact:         currentTime,
 			TimeDelta:         timeDelta,
 			FrameRate:         frameRate,
 			Frame:             frameCount,
 			Mouse:             mouseData,
+			Keyboard:          keyboard,
 			ChannelTime:       [4]float32{float32(currentTime), float32(currentTime), float32(currentTime), float32(currentTime)},
 			SampleRate:        sampleRate,
 			ChannelResolution: channelResolutions,
 		}
 
-		// Find the mic channel within the active scene
-		micChannel := findMicChannel(r.activeScene)
-		if micChannel != nil {
-			const fftInputSize = 2048 // From inputs/mic.go
-			samples := r.audioDevice.GetBuffer().WindowPeek()
-			monoSamples := audio.DownmixStereoToMono(samples)
-			micChannel.ProcessAudio(monoSamples)
+		// Find the mic channels within the active scene
+		if micChannels := findMicChannels(r.activeScene); len(micChannels) > 0 {
+			r.feedMicChannels(micChannels)
 		}
 
 		r.RenderFrame(uniforms)
-
-		// Blit the final rendered texture to the screen
-		if _, ok := r.context.(*glfwcontext.Context); ok {
-			fbWidth, fbHeight := r.context.GetFramebufferSize()
-			gl.Viewport(0, 0, int32(fbWidth), int32(fbHeight))
-			gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
-			gl.UseProgram(r.blitProgram)
-			gl.ActiveTexture(gl.TEXTURE0)
-			gl.BindTexture(gl.TEXTURE_2D, r.offscreenRenderer.textureID)
-			gl.BindVertexArray(r.quadVAO)
-			gl.DrawArrays(gl.TRIANGLES, 0, 6)
-			gl.BindTexture(gl.TEXTURE_2D, 0)
+		r.updateLivePreview()
+		if loadState != "" {
+			if err := r.LoadState(loadState); err != nil {
+				log.Printf("Warning: failed to load state: %v", err)
+			}
+			loadState = ""
 		}
 
+		// Blit the final rendered texture to the screen (a window or KMS output)
+		fbWidth, fbHeight := r.context.GetFramebufferSize()
+		gl.Viewport(0, 0, int32(fbWidth), int32(fbHeight))
+		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+		gl.UseProgram(r.presentProgram())
+		gl.ActiveTexture(gl.TEXTURE0)
+		gl.BindTexture(gl.TEXTURE_2D, r.offscreenRenderer.textureID)
+		gl.BindVertexArray(r.quadVAO)
+		gl.DrawArrays(gl.TRIANGLES, 0, 6)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+
+		if r.frameLock != nil {
+			gl.Finish() // The frame is rendered, not just queued
+			r.frameLock.Ready(int64(frameCount))
+		}
 		r.context.EndFrame()
+		if r.watchdog != nil && r.frameDone() {
+			return ErrContextLost
+		}
 		frameCount++
+		r.countFrame(time.Duration(float64(timeDelta) * float64(time.Second)))
+
+		if frameInterval > 0 {
+			nextFrame = nextFrame.Add(frameInterval)
+			if wait := time.Until(nextFrame); wait > 0 {
+				time.Sleep(wait)
+			} else if wait < -frameInterval {
+				// Don't rush to catch up after a stall.
+				nextFrame = time.Now()
+			}
+		}
 	}
+	return nil
 }
 
 func updateUniforms(pass *RenderPass, width, height int, uniforms *inputs.Uniforms) {
@@ -242,16 +393,28 @@ func updateUniforms(pass *RenderPass, width, height int, uniforms *inputs.Unifor
 		gl.Uniform4f(pass.mouseLoc, uniforms.Mouse[0], uniforms.Mouse[1], uniforms.Mouse[2], uniforms.Mouse[3])
 	}
 	if pass.iDateLoc != -1 {
-		now := time.Now()
+		now := uniforms.Date
 		year := float32(now.Year())
 		month := float32(now.Month())
 		day := float32(now.Day())
-		timeInSeconds := float32(now.Hour()*3600 + now.Minute()*60 + now.Second())
+		timeInSeconds := float32(now.Hour()*3600+now.Minute()*60+now.Second()) + float32(now.Nanosecond())/1e9
 		gl.Uniform4f(pass.iDateLoc, year, month, day, timeInSeconds)
 	}
+	if pass.iSeedLoc != -1 {
+		gl.Uniform1f(pass.iSeedLoc, uniforms.Seed)
+	}
+	if pass.iTime64Loc != -1 {
+		gl.Uniform2f(pass.iTime64Loc, uniforms.Time64[0], uniforms.Time64[1])
+	}
 	if pass.iSampleRateLoc != -1 {
 		gl.Uniform1f(pass.iSampleRateLoc, uniforms.SampleRate)
 	}
+	if pass.iEyeLoc != -1 {
+		gl.Uniform1f(pass.iEyeLoc, uniforms.Eye)
+	}
+	if pass.iEyeOffsetLoc != -1 {
+		gl.Uniform1f(pass.iEyeOffsetLoc, uniforms.EyeOffset)
+	}
 
 	if pass.iChannelTimeLoc != -1 {
 		gl.Uniform1fv(pass.iChannelTimeLoc, 4, &uniforms.ChannelTime[0])
@@ -355,7 +518,7 @@ func compileShader(source string, shaderType uint32) (uint32, error) {
 		gl.GetShaderiv(shader, gl.INFO_LOG_LENGTH, &logLength)
 		logText := strings.Repeat("\x00", int(logLength+1))
 		gl.GetShaderInfoLog(shader, logLength, nil, gl.Str(logText))
-		return 0, fmt.Errorf("failed to compile shader: %v", logText)
+		return 0, &compileError{shaderType: shaderType, log: strings.TrimRight(logText, "\x00")}
 	}
 	return shader, nil
 }
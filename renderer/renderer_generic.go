@@ -5,11 +5,13 @@ package renderer
 import (
 	"fmt"
 	"sync" // Import the sync package
+	"time"
 
 	gl "github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/richinsley/goshadertoy/audio"
 	"github.com/richinsley/goshadertoy/graphics"
 	shader "github.com/richinsley/goshadertoy/shader"
+	timesource "github.com/richinsley/goshadertoy/timesource"
 )
 
 // Add the same sync.Once variable here.
@@ -28,10 +30,30 @@ type Renderer struct {
 	blitProgram       uint32
 	yuvProgram        uint32
 	yuvBitDepthLoc    int32
+	dither            ditherState // Dithering of the YUV conversion
 	width             int
 	height            int
 	recordMode        bool
 	audioDevice       audio.AudioDevice
+	stereo            *stereoRenderer      // Stereo display mode; nil renders one view
+	post              *postRenderer        // Post-processing chain; nil applies none
+	transfer          *transferRenderer    // Output transfer encoding; nil uses the colors as they are
+	hdr               *hdrOutput           // HDR presentation of live mode; nil presents SDR
+	lut               *lutRenderer         // Color grade; nil grades nothing
+	overlay           *overlayRenderer     // Title card, timestamp and watermark; nil draws none
+	timecodeInput     audio.AudioDevice    // LTC source of the ltc clock
+	ntpSource         *timesource.NTPClock // Time source of the ntp clock
+	ntpEpoch          time.Time            // Time the ntp clock counts from
+	frameLock         FrameLock            // Keeps live frames in step with other instances; nil runs alone
+	view              viewState            // Zoom and pan of the live view
+	savestate         savestateSlot        // Position for savestates and a loaded state to continue from
+	date              time.Time            // iDate at iTime 0; zero follows the wall clock
+	seed              float32              // iSeed
+	timeWrap          float64              // Period iTime wraps at; 0 never wraps
+	watchdog          *glWatchdog          // Watches live rendering for a lost context or hang; nil doesn't
+	micAudio          micAudio             // Reused buffers feeding mic channels
+
+	controlState
 }
 
 func NewRenderer(width, height int, recordMode bool, bitDepth int, numPBOs int, ad audio.AudioDevice, ctx graphics.Context) (*Renderer, error) {
@@ -47,11 +69,7 @@ func NewRenderer(width, height int, recordMode bool, bitDepth int, numPBOs int,
 	r.context.MakeCurrent()
 
 	// Initialize the OpenGL function pointers once per application run.
-	var initErr error
-	glInitOnce.Do(func() {
-		initErr = gl.Init()
-	})
-	if initErr != nil {
+	if initErr := initGL(r.context); initErr != nil {
 		return nil, fmt.Errorf("failed to initialize OpenGL: %w", initErr)
 	}
 
@@ -108,9 +126,28 @@ func (r *Renderer) Shutdown() {
 	// Clean up renderer-specific resources.
 	gl.DeleteProgram(r.blitProgram)
 	gl.DeleteProgram(r.yuvProgram)
+	r.dither.destroy()
 	if r.offscreenRenderer != nil {
 		r.offscreenRenderer.Destroy()
 	}
+	if r.stereo != nil {
+		r.stereo.destroy()
+	}
+	if r.post != nil {
+		r.post.destroy()
+	}
+	if r.transfer != nil {
+		r.transfer.destroy()
+	}
+	if r.hdr != nil {
+		r.hdr.destroy()
+	}
+	if r.lut != nil {
+		r.lut.destroy()
+	}
+	if r.overlay != nil {
+		r.overlay.destroy()
+	}
 	gl.DeleteVertexArrays(1, &r.quadVAO)
 
 	// The context itself is managed and shut down by the main application.
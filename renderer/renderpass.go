@@ -19,4 +19,10 @@ type RenderPass struct {
 	iTimeDeltaLoc         int32
 	iFrameRateLoc         int32
 	iChannelTimeLoc       int32
+	iEyeLoc               int32
+	iEyeOffsetLoc         int32
+	iSeedLoc              int32
+	iTime64Loc            int32
+	viewOffsetLoc         int32
+	customUniforms        []customUniform
 }
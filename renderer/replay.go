@@ -0,0 +1,45 @@
+package renderer
+
+import (
+	"fmt"
+	"time"
+)
+
+// dateLayouts are the forms ParseDate accepts.
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// ParseDate parses a date for SetDate as RFC 3339, YYYY-MM-DDTHH:MM:SS or
+// YYYY-MM-DD. iDate shows the date and time as written, in any time zone.
+func ParseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date '%s' (e.g. 2024-01-01T00:00:00)", s)
+}
+
+// SetDate makes iDate start at date at iTime 0 and advance with iTime, so
+// shaders that seed from it render the same every time. The zero time follows
+// the wall clock, as Shadertoy does.
+func (r *Renderer) SetDate(date time.Time) {
+	r.date = date
+}
+
+// SetSeed sets iSeed, a uniform for shaders to seed their randomness from
+// that they opt in to by declaring
+//
+//	uniform float iSeed;
+//
+// so renders are reproducible and can be varied without editing the shader.
+func (r *Renderer) SetSeed(seed float64) {
+	r.seed = float32(seed)
+}
+
+// dateAt returns the date iDate shows at iTime t.
+func (r *Renderer) dateAt(t float32) time.Time {
+	if r.date.IsZero() {
+		return time.Now()
+	}
+	return r.date.Add(time.Duration(float64(t) * float64(time.Second)))
+}
@@ -0,0 +1,150 @@
+package renderer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+const savestateMagic = "goshadertoy-savestate"
+
+// savestateHeader is the first line of a savestate file, as JSON. The RGBA
+// float32 values of each of Buffers follow, little-endian, in that order.
+type savestateHeader struct {
+	Magic   string            `json:"magic"`
+	Shader  string            `json:"shader"` // Source of the scene it was saved from
+	Frame   int32             `json:"frame"`  // iFrame of the last frame rendered into the buffers
+	Time    float64           `json:"time"`   // iTime of that frame
+	Buffers []savestateBuffer `json:"buffers"`
+}
+
+type savestateBuffer struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// savestateSlot holds the iFrame and iTime of the last frame rendered, for
+// SaveState, and a loaded state until the render loop takes it up.
+type savestateSlot struct {
+	frame   int32
+	time    float64
+	pending *savestateHeader
+}
+
+// SaveState writes the contents of the active scene's buffers, with the
+// iFrame and iTime of the last frame rendered into them, to path. A shader
+// that evolves over time, e.g. a fluid simulation, can then be resumed or
+// branched from there with LoadState.
+func (r *Renderer) SaveState(path string) error {
+	if r.activeScene == nil {
+		return fmt.Errorf("no active scene")
+	}
+	header := savestateHeader{
+		Magic:  savestateMagic,
+		Shader: r.activeScene.Source,
+		Frame:  r.savestate.frame,
+		Time:   r.savestate.time,
+	}
+	names := make([]string, 0, len(r.activeScene.Buffers))
+	for name := range r.activeScene.Buffers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		res := r.activeScene.Buffers[name].ChannelRes()
+		header.Buffers = append(header.Buffers, savestateBuffer{Name: name, Width: int(res[0]), Height: int(res[1])})
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	w.Write(append(data, '\n'))
+	for _, name := range names {
+		if err := binary.Write(w, binary.LittleEndian, r.activeScene.Buffers[name].ReadState()); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Printf("Saved state at frame %d (%.2fs) to %s", header.Frame, header.Time, path)
+	return nil
+}
+
+// LoadState restores a state written by SaveState into the active scene's
+// buffers, which must have the sizes they were saved at. The render loop
+// continues with the frame after the saved one.
+func (r *Renderer) LoadState(path string) error {
+	if r.activeScene == nil {
+		return fmt.Errorf("no active scene")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rd := bufio.NewReader(f)
+	line, err := rd.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("invalid savestate %s: %w", path, err)
+	}
+	var header savestateHeader
+	if err := json.Unmarshal(line, &header); err != nil || header.Magic != savestateMagic {
+		return fmt.Errorf("%s is not a savestate", path)
+	}
+	if header.Shader != r.activeScene.Source {
+		log.Printf("Warning: %s was saved from %s, not %s", path, header.Shader, r.activeScene.Source)
+	}
+
+	// Everything is read before any buffer changes, so a bad file leaves the
+	// scene as it was.
+	states := make([][]float32, len(header.Buffers))
+	for i, b := range header.Buffers {
+		buffer, ok := r.activeScene.Buffers[b.Name]
+		if !ok {
+			return fmt.Errorf("savestate has buffer %s, which the shader does not use", b.Name)
+		}
+		if res := buffer.ChannelRes(); int(res[0]) != b.Width || int(res[1]) != b.Height {
+			return fmt.Errorf("buffer %s was saved at %dx%d, but is %dx%d", b.Name, b.Width, b.Height, int(res[0]), int(res[1]))
+		}
+		states[i] = make([]float32, b.Width*b.Height*4)
+		if err := binary.Read(rd, binary.LittleEndian, states[i]); err != nil {
+			return fmt.Errorf("failed to read buffer %s: %w", b.Name, err)
+		}
+	}
+	for i, b := range header.Buffers {
+		if err := r.activeScene.Buffers[b.Name].WriteState(states[i]); err != nil {
+			return fmt.Errorf("failed to restore buffer %s: %w", b.Name, err)
+		}
+	}
+	r.savestate.pending = &header
+	log.Printf("Loaded state at frame %d (%.2fs) from %s", header.Frame, header.Time, path)
+	return nil
+}
+
+// takeLoadedState returns the iFrame and iTime of the saved frame of a state
+// loaded since the last call, if any.
+func (r *Renderer) takeLoadedState() (frame int32, time float64, ok bool) {
+	p := r.savestate.pending
+	if p == nil {
+		return 0, 0, false
+	}
+	r.savestate.pending = nil
+	return p.Frame, p.Time, true
+}
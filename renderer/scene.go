@@ -16,7 +16,8 @@ import (
 
 // Scene encapsulates all the resources and render passes for a single Shadertoy shader.
 type Scene struct {
-	Title string
+	Title  string
+	Source string // Where the shader was loaded from
 	// The final render pass that draws to the screen or primary FBO.
 	ImagePass *RenderPass
 	// The ordered list of buffer passes (A, B, C, D) that must execute before the ImagePass.
@@ -61,6 +62,7 @@ func (s *Scene) Destroy() {
 func (r *Renderer) LoadScene(shaderArgs *api.ShaderArgs, options *options.ShaderOptions) (*Scene, error) {
 	scene := &Scene{
 		Title:        shaderArgs.Title,
+		Source:       shaderArgs.Source,
 		NamedPasses:  make(map[string]*RenderPass),
 		BufferPasses: make([]*RenderPass, 0),
 		Buffers:      make(map[string]*inputs.Buffer),
@@ -71,6 +73,7 @@ func (r *Renderer) LoadScene(shaderArgs *api.ShaderArgs, options *options.Shader
 	if !r.recordMode && r.context != nil {
 		width, height = r.context.GetFramebufferSize()
 	}
+	width, height = r.bufferSize(width, height)
 
 	// 1. Create Buffers for the Scene
 	for _, name := range []string{"A", "B", "C", "D"} {
@@ -134,6 +137,7 @@ func (r *Renderer) createRenderPass(name string, shaderArgs *api.ShaderArgs, opt
 	if r.context != nil {
 		width, height = r.context.GetFramebufferSize()
 	}
+	width, height = r.bufferSize(width, height)
 
 	// This now uses the passed-in buffers map from the scene being built.
 	channels, err := inputs.GetChannels(passArgs.Inputs, width, height, r.quadVAO, buffers, options, r.audioDevice)
@@ -142,15 +146,29 @@ func (r *Renderer) createRenderPass(name string, shaderArgs *api.ShaderArgs, opt
 	}
 
 	fullFragmentSource := shader.GetFragmentShader(channels, shaderArgs.CommonCode, passArgs.Code)
+	if name == "image" && *options.Projection == "equirect" {
+		fullFragmentSource, err = shader.GetEquirectFragmentShader(channels, shaderArgs.CommonCode, passArgs.Code)
+		if err != nil {
+			return nil, err
+		}
+	}
+	common, code := shaderArgs.CommonCode, passArgs.Code
+	if *options.Precision == "highp" {
+		fullFragmentSource = shader.ForceHighPrecision(fullFragmentSource)
+		common, code = shader.ForceHighPrecision(common), shader.ForceHighPrecision(code)
+	}
 	outputFormat := gst.OutputFormatGLSL410
 	if r.isGLES() {
 		outputFormat = gst.OutputFormatESSL
 	}
+	srcMap := newSourceMap(fullFragmentSource, name, common, code, shaderArgs.SourceFiles)
 	translator := xlate.GetTranslator()
 	fsShader, err := translator.TranslateShader(fullFragmentSource, "fragment", gst.ShaderSpecWebGL2, outputFormat)
 	if err != nil {
-		return nil, fmt.Errorf("fragment shader translation failed: %w", err)
+		dumpShaderSource(options, shaderArgs.Title, name, fullFragmentSource, "")
+		return nil, fmt.Errorf("fragment shader translation failed: %s", srcMap.mapTranslatorLog(err.Error()))
 	}
+	dumpShaderSource(options, shaderArgs.Title, name, fullFragmentSource, fsShader.Code)
 
 	retv := &RenderPass{
 		ShaderProgram: 0,
@@ -160,7 +178,7 @@ func (r *Renderer) createRenderPass(name string, shaderArgs *api.ShaderArgs, opt
 	vertexShaderSource := shader.GenerateVertexShader(r.isGLES())
 	retv.ShaderProgram, err = newProgram(vertexShaderSource, fsShader.Code)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create shader program: %w", err)
+		return nil, fmt.Errorf("failed to create shader program: %w", srcMap.mapCompilerError(err, fsShader.Code))
 	}
 
 	// get the standard uniforms
@@ -174,6 +192,11 @@ func (r *Renderer) createRenderPass(name string, shaderArgs *api.ShaderArgs, opt
 	retv.iSampleRateLoc = r.GetUniformLocation(uniformMap, retv.ShaderProgram, "iSampleRate")
 	retv.iTimeDeltaLoc = r.GetUniformLocation(uniformMap, retv.ShaderProgram, "iTimeDelta")
 	retv.iFrameRateLoc = r.GetUniformLocation(uniformMap, retv.ShaderProgram, "iFrameRate")
+	retv.iEyeLoc = r.GetUniformLocation(uniformMap, retv.ShaderProgram, "iEye")
+	retv.iEyeOffsetLoc = r.GetUniformLocation(uniformMap, retv.ShaderProgram, "iEyeOffset")
+	retv.iSeedLoc = r.GetUniformLocation(uniformMap, retv.ShaderProgram, "iSeed")
+	retv.iTime64Loc = r.GetUniformLocation(uniformMap, retv.ShaderProgram, "iTime64")
+	retv.viewOffsetLoc = r.GetUniformLocation(uniformMap, retv.ShaderProgram, shader.ViewOffsetUniform)
 
 	retv.iChannelTimeLoc = r.GetUniformLocation(uniformMap, retv.ShaderProgram, "iChannelTime[0]")
 	if retv.iChannelTimeLoc < 0 {
@@ -185,6 +208,9 @@ func (r *Renderer) createRenderPass(name string, shaderArgs *api.ShaderArgs, opt
 		retv.iChannelResolutionLoc = r.GetUniformLocation(uniformMap, retv.ShaderProgram, "iChannelResolution")
 	}
 
+	// User-declared uniforms that a control interface may adjust
+	retv.customUniforms = findCustomUniforms(uniformMap, retv.ShaderProgram)
+
 	// iChannel uniforms
 	for i := 0; i < 4; i++ {
 		samplerName := fmt.Sprintf("iChannel%d", i)
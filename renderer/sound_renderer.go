@@ -7,6 +7,7 @@ import (
 
 	gl "github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/richinsley/goshadertoy/api"
+	"github.com/richinsley/goshadertoy/audio"
 	"github.com/richinsley/goshadertoy/graphics"
 	inputs "github.com/richinsley/goshadertoy/inputs"
 	options "github.com/richinsley/goshadertoy/options"
@@ -21,6 +22,10 @@ const (
 	soundSampleRate    = 44100
 )
 
+// liveSoundChunkRows is the default chunk in live and stream modes: 16 rows
+// of 512 samples, about 0.19 seconds of audio.
+const liveSoundChunkRows = 16
+
 // SoundShaderRenderer manages the execution of a sound shader.
 type SoundShaderRenderer struct {
 	context         graphics.Context
@@ -33,6 +38,15 @@ type SoundShaderRenderer struct {
 	options         *options.ShaderOptions
 	uniformMap      map[string]gst.ShaderVariable
 	channels        []inputs.IChannel
+	floatTarget     bool // Samples render as floats to an RG32F texture rather than packed into RGBA8
+	readRG          bool // The float target reads back as interleaved RG floats, the samples themselves
+
+	// Audio input for the shader's mic, music and spectrogram channels
+	input        audio.AudioDevice
+	mics         []*inputs.MicChannel
+	inputAudio   micAudio
+	inputDecoded int64 // Input frames decoded so far in record mode
+	inputEnded   bool
 
 	// uniform locations to match the official spec
 	timeOffsetLoc        int32
@@ -52,29 +66,28 @@ func (ssr *SoundShaderRenderer) GetUniformLocation(name string) int32 {
 	return -1
 }
 
-// NewSoundShaderRenderer creates a new renderer for sound shaders.
-func NewSoundShaderRenderer(ctx graphics.Context, preRenderedChan chan<- []float32, shaderArgs *api.ShaderArgs, options *options.ShaderOptions) *SoundShaderRenderer {
+// NewSoundShaderRenderer creates a new renderer for sound shaders. input, if
+// not nil, feeds the shader's mic, music and spectrogram channels; the
+// renderer is its only reader.
+func NewSoundShaderRenderer(ctx graphics.Context, preRenderedChan chan<- []float32, shaderArgs *api.ShaderArgs, options *options.ShaderOptions, input audio.AudioDevice) *SoundShaderRenderer {
 	return &SoundShaderRenderer{
 		context:         ctx,
 		preRenderedChan: preRenderedChan,
 		shaderArgs:      shaderArgs,
 		options:         options,
+		input:           input,
 	}
 }
 
 // InitGL sets up all OpenGL resources. It MUST be called from the goroutine
-// that will be running the rendering loop, after locking the OS thread.
+// that will be running the rendering loop, after locking the OS thread, and
+// leaves the context current. If it fails, Shutdown frees what it set up.
 func (ssr *SoundShaderRenderer) InitGL() error {
 	// This function now assumes it's running on the correct, locked thread.
 	ssr.context.MakeCurrent()
-	defer ssr.context.DetachCurrent() // Detach context when done with setup
 
 	// Initialize OpenGL bindings for this context
-	var initErr error
-	glInitOnce.Do(func() {
-		initErr = gl.Init()
-	})
-	if initErr != nil {
+	if initErr := initGL(ssr.context); initErr != nil {
 		return fmt.Errorf("sound renderer gl.Init failed: %w", initErr)
 	}
 
@@ -99,12 +112,18 @@ func (ssr *SoundShaderRenderer) InitGL() error {
 	gl.BindFramebuffer(gl.FRAMEBUFFER, ssr.fbo)
 	gl.GenTextures(1, &ssr.textureID)
 	gl.BindTexture(gl.TEXTURE_2D, ssr.textureID)
-	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA8, soundTextureWidth, soundTextureHeight, 0, gl.RGBA, gl.UNSIGNED_BYTE, nil)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
-	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, ssr.textureID, 0)
-	if gl.CheckFramebufferStatus(gl.FRAMEBUFFER) != gl.FRAMEBUFFER_COMPLETE {
-		return fmt.Errorf("sound renderer FBO is not complete")
+	// A float target keeps the shader's full precision instead of Shadertoy's
+	// 16 bits. GLES only renders to it with EXT_color_buffer_float.
+	ssr.floatTarget = ssr.attachTarget(gl.RG32F, gl.RG, gl.FLOAT)
+	if ssr.floatTarget {
+		ssr.readRG = !ssr.context.IsGLES() || readFormatIs(gl.RG, gl.FLOAT)
+	} else {
+		log.Println("Float render targets are unavailable; sound shader output is quantized to 16 bits.")
+		if !ssr.attachTarget(gl.RGBA8, gl.RGBA, gl.UNSIGNED_BYTE) {
+			return fmt.Errorf("sound renderer FBO is not complete")
+		}
 	}
 	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
 
@@ -112,31 +131,46 @@ func (ssr *SoundShaderRenderer) InitGL() error {
 	vertexShaderSource := shader.GenerateVertexShader(ssr.context.IsGLES())
 
 	var err error
-	ssr.channels, err = inputs.GetChannels(passArgs.Inputs, soundTextureWidth, soundTextureHeight, ssr.quadVAO, nil, ssr.options, nil)
+	ssr.channels, err = inputs.GetChannels(passArgs.Inputs, soundTextureWidth, soundTextureHeight, ssr.quadVAO, nil, ssr.options, ssr.input)
 	if err != nil {
 		return fmt.Errorf("failed to create channels for sound shader: %w", err)
 	}
+	if ssr.input != nil {
+		for _, ch := range ssr.channels {
+			if mic, ok := ch.(*inputs.MicChannel); ok {
+				ssr.mics = append(ssr.mics, mic)
+			}
+		}
+	}
 
-	fullFragmentSource := shader.GenerateSoundShaderSource(ssr.shaderArgs.CommonCode, passArgs.Code, ssr.channels)
+	fullFragmentSource := shader.GenerateSoundShaderSource(ssr.shaderArgs.CommonCode, passArgs.Code, ssr.channels, ssr.floatTarget)
+	common, code := ssr.shaderArgs.CommonCode, passArgs.Code
+	if *ssr.options.Precision == "highp" {
+		fullFragmentSource = shader.ForceHighPrecision(fullFragmentSource)
+		common, code = shader.ForceHighPrecision(common), shader.ForceHighPrecision(code)
+	}
 
 	outputFormat := gst.OutputFormatGLSL410
 	if ssr.context.IsGLES() {
 		outputFormat = gst.OutputFormatESSL
 	}
 
+	srcMap := newSourceMap(fullFragmentSource, "sound", common, code, ssr.shaderArgs.SourceFiles)
 	translator := xlate.GetTranslator()
 	fsShader, err := translator.TranslateShader(fullFragmentSource, "fragment", gst.ShaderSpecWebGL2, outputFormat)
 	if err != nil {
 		log.Printf("Problematic Sound Shader Source:\n%s\n", fullFragmentSource)
-		return fmt.Errorf("sound shader translation failed: %w", err)
+		dumpShaderSource(ssr.options, ssr.shaderArgs.Title, "sound", fullFragmentSource, "")
+		return fmt.Errorf("sound shader translation failed: %s", srcMap.mapTranslatorLog(err.Error()))
 	}
+	dumpShaderSource(ssr.options, ssr.shaderArgs.Title, "sound", fullFragmentSource, fsShader.Code)
 
 	// Store the uniform map for later use
 	ssr.uniformMap = fsShader.Variables
 
 	ssr.program, err = newProgram(vertexShaderSource, fsShader.Code)
 	if err != nil {
-		return fmt.Errorf("failed to create sound shader program: %w", err)
+		return fmt.Errorf("failed to create sound shader program: %w", srcMap.mapCompilerError(err, fsShader.Code))
 	}
 
 	if ssr.program == 0 {
@@ -171,52 +205,107 @@ func (ssr *SoundShaderRenderer) InitGL() error {
 	return nil
 }
 
+// attachTarget defines the sound texture in internalFormat and attaches it to
+// the bound FBO, and reports whether the FBO can be rendered to.
+func (ssr *SoundShaderRenderer) attachTarget(internalFormat int32, format, xtype uint32) bool {
+	gl.TexImage2D(gl.TEXTURE_2D, 0, internalFormat, soundTextureWidth, soundTextureHeight, 0, format, xtype, nil)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, ssr.textureID, 0)
+	return gl.CheckFramebufferStatus(gl.FRAMEBUFFER) == gl.FRAMEBUFFER_COMPLETE
+}
+
+// readFormatIs reports whether the bound read framebuffer can be read back in
+// format and xtype besides RGBA, as GLES lets each implementation choose one.
+func readFormatIs(format, xtype uint32) bool {
+	var readFormat, readType int32
+	gl.GetIntegerv(gl.IMPLEMENTATION_COLOR_READ_FORMAT, &readFormat)
+	gl.GetIntegerv(gl.IMPLEMENTATION_COLOR_READ_TYPE, &readType)
+	return uint32(readFormat) == format && uint32(readType) == xtype
+}
+
+// chunkRows returns how many rows of 512 samples the renderer renders and
+// delivers at a time: -sound-chunk, or by default a few rows in live and
+// stream modes, so the audio starts quickly and reacts to changes within a
+// fraction of a second, and the whole texture otherwise, for throughput.
+func (ssr *SoundShaderRenderer) chunkRows() int {
+	if *ssr.options.SoundChunkRows > 0 {
+		return *ssr.options.SoundChunkRows
+	}
+	if *ssr.options.Mode == "live" || *ssr.options.Mode == "stream" {
+		return liveSoundChunkRows
+	}
+	return soundTextureHeight
+}
+
 // Run starts the rendering loop for the sound shader.
 func (ssr *SoundShaderRenderer) Run(ctx context.Context) {
 	ssr.context.MakeCurrent()
 	defer ssr.Shutdown()
 
-	var timeOffset float32 = 0.0
 	var sampleOffset int32 = 0
-	samplesPerFullBuffer := int32(soundTextureWidth * soundTextureHeight)
-	timeStepPerFullBuffer := float32(samplesPerFullBuffer) / float32(soundSampleRate)
+	rows := ssr.chunkRows()
+	samplesPerChunk := int32(soundTextureWidth * rows)
+	var pixelData []byte      // Packed RGBA8 samples
+	var floatPixels []float32 // Float RGBA samples, when RG can't be read directly
+	switch {
+	case !ssr.floatTarget:
+		pixelData = make([]byte, samplesPerChunk*4)
+	case !ssr.readRG:
+		floatPixels = make([]float32, samplesPerChunk*4)
+	}
+	log.Printf("Sound shader renders %d samples (%.2f s) at a time.", samplesPerChunk, float64(samplesPerChunk)/soundSampleRate)
 
 	for {
-		// Check for cancellation at the start of each large render cycle.
+		// Check for cancellation at the start of each render cycle.
 		select {
 		case <-ctx.Done():
 			log.Println("Stopping sound shader renderer.")
 			return
 		default:
-			// Continue to render the next large buffer.
+			// Continue to render the next chunk.
 		}
 
-		// Render one large buffer
+		// Render one chunk into the bottom rows of the texture. The time is
+		// derived from the sample offset rather than accumulated, so it
+		// doesn't drift however many chunks are rendered.
+		timeOffset := float32(float64(sampleOffset) / soundSampleRate)
 		gl.BindFramebuffer(gl.FRAMEBUFFER, ssr.fbo)
 		gl.UseProgram(ssr.program)
 
-		// Set uniforms for the start of this buffer
+		// Set uniforms for the start of this chunk
 		gl.Uniform1f(ssr.timeOffsetLoc, timeOffset)
 		gl.Uniform1i(ssr.sampleOffsetLoc, sampleOffset)
 		gl.Uniform1f(ssr.sampleRateLoc, soundSampleRate)
 		// log.Println("Rendering sound shader frame at timeOffset:", timeOffset, "sampleOffset:", sampleOffset)
 
-		gl.Viewport(0, 0, soundTextureWidth, soundTextureHeight)
+		gl.Viewport(0, 0, soundTextureWidth, int32(rows))
 		gl.BindVertexArray(ssr.quadVAO)
 
+		if len(ssr.mics) > 0 {
+			ssr.feedInput(int64(sampleOffset + samplesPerChunk))
+		}
 		bindChannelsSound(ssr, timeOffset)
 		gl.DrawArrays(gl.TRIANGLES, 0, 6)
 		unbindChannelsSound(ssr)
 
-		// Read the entire large buffer back
-		pixelData := make([]byte, samplesPerFullBuffer*4)
+		// Read the chunk back and send it in one go.
+		var audioSamples []float32
 		gl.ReadBuffer(gl.COLOR_ATTACHMENT0)
-		gl.ReadPixels(0, 0, soundTextureWidth, soundTextureHeight, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(pixelData))
+		switch {
+		case ssr.readRG:
+			audioSamples = make([]float32, samplesPerChunk*2)
+			gl.ReadPixels(0, 0, soundTextureWidth, int32(rows), gl.RG, gl.FLOAT, gl.Ptr(audioSamples))
+		case ssr.floatTarget:
+			gl.ReadPixels(0, 0, soundTextureWidth, int32(rows), gl.RGBA, gl.FLOAT, gl.Ptr(floatPixels))
+			audioSamples = make([]float32, samplesPerChunk*2)
+			for i := range samplesPerChunk {
+				audioSamples[i*2], audioSamples[i*2+1] = floatPixels[i*4], floatPixels[i*4+1]
+			}
+		default:
+			gl.ReadPixels(0, 0, soundTextureWidth, int32(rows), gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(pixelData))
+			audioSamples = ssr.convertPixelsToAudio(pixelData)
+		}
 		gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
 
-		// Convert and send the entire buffer in one go.
-		audioSamples := ssr.convertPixelsToAudio(pixelData)
-
 		select {
 		case ssr.preRenderedChan <- audioSamples:
 			// Successfully sent the buffer.
@@ -225,18 +314,57 @@ func (ssr *SoundShaderRenderer) Run(ctx context.Context) {
 			return
 		}
 
-		// Increment offsets for the next large buffer
-		timeOffset += timeStepPerFullBuffer
-		sampleOffset += samplesPerFullBuffer
+		sampleOffset += samplesPerChunk
+	}
+}
+
+// inputDecodeStep is the most input feedInput decodes at once in record mode,
+// in seconds, so the input buffer never fills while nothing else reads it.
+const inputDecodeStep = 1
+
+// feedInput updates the FFT of the mic channels from the input audio up to
+// endSample, the end of the chunk about to render. In record mode it decodes
+// the input that far first, so the shader hears it in step with its own
+// output; in real-time modes the input runs on its own and the shader hears
+// the latest of it. Either way the samples in between are discarded, as the
+// channels only see the most recent window.
+func (ssr *SoundShaderRenderer) feedInput(endSample int64) {
+	buffer := ssr.input.GetBuffer()
+	if *ssr.options.Mode == "record" {
+		rate := int64(ssr.input.SampleRate())
+		target := endSample * rate / soundSampleRate
+		for !ssr.inputEnded && ssr.inputDecoded < target {
+			next := min(target, ssr.inputDecoded+inputDecodeStep*rate)
+			if err := ssr.input.DecodeUntil(next); err != nil {
+				log.Printf("Sound shader audio input ended: %v", err)
+				ssr.inputEnded = true
+			}
+			ssr.inputDecoded = next
+			buffer.Discard(buffer.AvailableSamples())
+		}
+	}
+	buffer.Discard(buffer.AvailableSamples())
+
+	ssr.inputAudio.window = buffer.WindowPeekInto(ssr.inputAudio.window)
+	ssr.inputAudio.mono = audio.DownmixStereoToMonoInto(ssr.inputAudio.mono, ssr.inputAudio.window)
+	for _, mic := range ssr.mics {
+		mic.ProcessAudio(ssr.inputAudio.mono)
 	}
 }
 
-// Shutdown cleans up the OpenGL resources.
+// Shutdown cleans up the OpenGL resources. Calling it again does nothing.
 func (ssr *SoundShaderRenderer) Shutdown() {
 	gl.DeleteProgram(ssr.program)
 	gl.DeleteFramebuffers(1, &ssr.fbo)
 	gl.DeleteTextures(1, &ssr.textureID)
 	gl.DeleteVertexArrays(1, &ssr.quadVAO)
+	ssr.program, ssr.fbo, ssr.textureID, ssr.quadVAO = 0, 0, 0, 0
+	for _, ch := range ssr.channels {
+		if ch != nil {
+			ch.Destroy()
+		}
+	}
+	ssr.channels = nil
 	log.Println("Sound Shader Renderer resources cleaned up.")
 }
 
@@ -0,0 +1,321 @@
+package renderer
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// sourceSection is the span of a generated shader that holds one piece of
+// the author's code.
+type sourceSection struct {
+	name  string // "common" or the pass name
+	first int    // 1-based line of the generated source where the code starts
+	lines int
+}
+
+// lineOrigin is where the compiler places a line of the generated source,
+// given the #line directives before it.
+type lineOrigin struct {
+	src       int // Source string number
+	line      int
+	directive int // Line of the #line directive that numbered it, 0 if none
+}
+
+// sourceMap relates lines of a generated shader (preamble, common code, pass
+// code and main wrapper) to the author's code, and lines of its translation
+// back to the generated shader.
+type sourceMap struct {
+	sections []sourceSection
+	lines    []string     // Lines of the generated source
+	origins  []lineOrigin // Compiler location of each generated line
+	files    []string     // Names of the source strings numbered by #line directives
+
+	translatedLines []string
+	translated      []int // Generated line for each translated line, 0 if unknown
+}
+
+// Error locations in compiler logs: the translator and most drivers
+// ("ERROR: 0:12: msg"), Mesa ("0:12(5): error: msg") and NVIDIA
+// ("0(12) : error C0000: msg").
+var (
+	angleLocationPattern  = regexp.MustCompile(`^(ERROR|WARNING): (\d+):(\d+): ?(.*)$`)
+	mesaLocationPattern   = regexp.MustCompile(`^(\d+):(\d+)\(\d+\): ?(.*)$`)
+	nvidiaLocationPattern = regexp.MustCompile(`^(\d+)\((\d+)\) : ?(.*)$`)
+	identifierPattern     = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+	lineDirectivePattern  = regexp.MustCompile(`^\s*#\s*line\s+(\d+)(?:\s+(\d+))?`)
+)
+
+// translatedPrefix is prepended by the translator to user identifiers.
+const translatedPrefix = "_u"
+
+// alignWindow is how far ahead of the last aligned line a translated line is
+// first looked for.
+const alignWindow = 64
+
+// compileError is a shader compile failure with the driver's info log.
+type compileError struct {
+	shaderType uint32
+	log        string
+}
+
+func (e *compileError) Error() string {
+	return "failed to compile shader: " + e.log
+}
+
+// newSourceMap locates the common and pass code of the pass called name in
+// the generated source full. The pass code follows the common code, so both
+// are searched for from the end. files names the source strings of expanded
+// includes (api.ShaderArgs.SourceFiles).
+func newSourceMap(full, name, common, code string, files []string) *sourceMap {
+	m := &sourceMap{lines: strings.Split(full, "\n"), files: files}
+	m.origins = make([]lineOrigin, len(m.lines))
+	cur := lineOrigin{line: 1}
+	for i, line := range m.lines {
+		m.origins[i] = cur
+		cur.line++
+		if sub := lineDirectivePattern.FindStringSubmatch(line); sub != nil {
+			// In GLSL ES 3.00 the directive numbers the line after it.
+			cur.line, _ = strconv.Atoi(sub[1])
+			if sub[2] != "" {
+				cur.src, _ = strconv.Atoi(sub[2])
+			}
+			cur.directive = i + 1
+		}
+	}
+	codeStart := strings.LastIndex(full, code)
+	if code == "" || codeStart < 0 {
+		codeStart = len(full)
+	}
+	if common != "" {
+		if start := strings.LastIndex(full[:codeStart], common); start >= 0 {
+			m.add("common", full, start, common)
+		}
+	}
+	if codeStart < len(full) {
+		m.add(name, full, codeStart, code)
+	}
+	return m
+}
+
+func (m *sourceMap) add(name, full string, start int, text string) {
+	m.sections = append(m.sections, sourceSection{
+		name:  name,
+		first: strings.Count(full[:start], "\n") + 1,
+		lines: strings.Count(text, "\n") + 1,
+	})
+}
+
+// locate returns the section and the line within it of a line of the
+// generated source. ok is false for generated lines.
+func (m *sourceMap) locate(line int) (section sourceSection, sectionLine int, ok bool) {
+	for _, s := range m.sections {
+		if line >= s.first && line < s.first+s.lines {
+			return s, line - s.first + 1, true
+		}
+	}
+	return sourceSection{}, 0, false
+}
+
+// describe returns the file, or section, and line in it that a line of the
+// generated source came from. Lines numbered by a #line directive in the same
+// section belong to the source string it names. ok is false for generated
+// lines.
+func (m *sourceMap) describe(line int) (name string, fileLine int, ok bool) {
+	if line < 1 || line > len(m.origins) {
+		return "", 0, false
+	}
+	section, sectionLine, ok := m.locate(line)
+	if !ok {
+		return "", 0, false
+	}
+	o := m.origins[line-1]
+	if o.directive >= section.first && o.src > 0 && o.src < len(m.files) {
+		return m.files[o.src], o.line, true
+	}
+	return section.name, sectionLine, true
+}
+
+// mapTranslatorLog rewrites the locations in a translator log, which are
+// source string and line numbers, to the author's code.
+func (m *sourceMap) mapTranslatorLog(log string) string {
+	return m.rewriteLog(log, func(src, line int) (int, bool) {
+		for i, o := range m.origins {
+			if o.src == src && o.line == line {
+				return i + 1, true
+			}
+		}
+		return 0, false
+	})
+}
+
+// mapCompilerError rewrites the log of a failed fragment shader compile of
+// the translated source to the author's code. Other errors are returned as is.
+func (m *sourceMap) mapCompilerError(err error, translated string) error {
+	var ce *compileError
+	if !errors.As(err, &ce) || ce.shaderType != gl.FRAGMENT_SHADER {
+		return err
+	}
+	m.alignTranslated(translated)
+	log := m.rewriteLog(ce.log, func(_, line int) (int, bool) { return m.generatedLine(line) })
+	return fmt.Errorf("failed to compile shader:\n%s", log)
+}
+
+// generatedLine returns the generated line a translated line came from, or
+// of the closest aligned line before it.
+func (m *sourceMap) generatedLine(line int) (int, bool) {
+	for i := line - 1; i >= 0 && i < len(m.translated); i-- {
+		if m.translated[i] > 0 {
+			return m.translated[i], true
+		}
+	}
+	return 0, false
+}
+
+// alignTranslated matches each line of the translation to the generated line
+// it came from. The translator renames identifiers and reformats expressions
+// but keeps their order, so lines are matched on the identifiers they share,
+// looking a short way ahead of the previous match first.
+func (m *sourceMap) alignTranslated(translated string) {
+	m.translatedLines = strings.Split(translated, "\n")
+	m.translated = make([]int, len(m.translatedLines))
+
+	generated := make([]map[string]bool, len(m.lines))
+	for i, line := range m.lines {
+		generated[i] = map[string]bool{}
+		for _, id := range identifierPattern.FindAllString(stripComments(line), -1) {
+			generated[i][id] = true
+		}
+	}
+
+	score := func(ids []string, i int) int {
+		s := 0
+		for _, id := range ids {
+			if strings.HasPrefix(id, translatedPrefix) && generated[i][id[len(translatedPrefix):]] {
+				s += 3
+			} else if generated[i][id] {
+				s++
+			}
+		}
+		return s
+	}
+	best := func(ids []string, from, to int) (int, int) {
+		bestLine, bestScore := -1, 2
+		for i := from; i < to && i < len(generated); i++ {
+			if s := score(ids, i); s > bestScore {
+				bestLine, bestScore = i, s
+			}
+		}
+		return bestLine, bestScore
+	}
+
+	next := 0
+	for t, line := range m.translatedLines {
+		ids := unique(identifierPattern.FindAllString(line, -1))
+		if len(ids) == 0 {
+			continue
+		}
+		if i, _ := best(ids, next, next+alignWindow); i >= 0 {
+			// A generated line may become several translated lines.
+			m.translated[t] = i + 1
+			next = i
+		} else if i, _ := best(ids, 0, len(generated)); i >= 0 {
+			// Out of order, e.g. a declaration the translator hoisted.
+			m.translated[t] = i + 1
+		}
+	}
+}
+
+// rewriteLog rewrites each located line of a compiler log to the author's
+// code and adds the surrounding lines. toGenerated converts a log location to
+// a line of the generated source.
+func (m *sourceMap) rewriteLog(log string, toGenerated func(src, line int) (int, bool)) string {
+	var out strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(log, "\x00\n"), "\n") {
+		prefix, src, lineNum, msg, ok := parseLogLocation(line)
+		if !ok {
+			out.WriteString(line + "\n")
+			continue
+		}
+		genLine, ok := toGenerated(src, lineNum)
+		if !ok {
+			fmt.Fprintf(&out, "%s<translated>:%d: %s\n", prefix, lineNum, msg)
+			if lineNum >= 1 && lineNum <= len(m.translatedLines) {
+				fmt.Fprintf(&out, "    %s\n", strings.TrimSpace(m.translatedLines[lineNum-1]))
+			}
+			continue
+		}
+		name, fileLine, ok := m.describe(genLine)
+		if !ok {
+			fmt.Fprintf(&out, "%s<generated>:%d: %s\n", prefix, genLine, msg)
+			continue
+		}
+		fmt.Fprintf(&out, "%s%s:%d: %s\n", prefix, name, fileLine, msg)
+		out.WriteString(m.snippet(genLine))
+	}
+	return out.String()
+}
+
+// snippet returns a generated line with the lines each side of it that come
+// from the same file, numbered as in that file.
+func (m *sourceMap) snippet(genLine int) string {
+	name, _, _ := m.describe(genLine)
+	var out strings.Builder
+	for l := genLine - 1; l <= genLine+1; l++ {
+		n, fileLine, ok := m.describe(l)
+		if !ok || n != name || m.origins[l-1].directive != m.origins[genLine-1].directive {
+			continue
+		}
+		marker := " "
+		if l == genLine {
+			marker = ">"
+		}
+		fmt.Fprintf(&out, "  %s %4d | %s\n", marker, fileLine, m.lines[l-1])
+	}
+	return out.String()
+}
+
+// parseLogLocation splits a compiler log line into its severity prefix,
+// source string and line number, and message.
+func parseLogLocation(line string) (prefix string, src, lineNum int, msg string, ok bool) {
+	if sub := angleLocationPattern.FindStringSubmatch(line); sub != nil {
+		src, _ = strconv.Atoi(sub[2])
+		lineNum, _ = strconv.Atoi(sub[3])
+		return sub[1] + ": ", src, lineNum, sub[4], true
+	}
+	if sub := mesaLocationPattern.FindStringSubmatch(line); sub != nil {
+		src, _ = strconv.Atoi(sub[1])
+		lineNum, _ = strconv.Atoi(sub[2])
+		return "", src, lineNum, sub[3], true
+	}
+	if sub := nvidiaLocationPattern.FindStringSubmatch(line); sub != nil {
+		src, _ = strconv.Atoi(sub[1])
+		lineNum, _ = strconv.Atoi(sub[2])
+		return "", src, lineNum, sub[3], true
+	}
+	return "", 0, 0, "", false
+}
+
+// stripComments removes a trailing line comment.
+func stripComments(line string) string {
+	if i := strings.Index(line, "//"); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+func unique(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	out := ids[:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
@@ -0,0 +1,175 @@
+package renderer
+
+import (
+	"fmt"
+	"log"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	inputs "github.com/richinsley/goshadertoy/inputs"
+	shader "github.com/richinsley/goshadertoy/shader"
+)
+
+// StereoModes are the stereo display modes and their stereo shader modes.
+var StereoModes = map[string]int32{
+	"anaglyph": 0, // Red-cyan glasses
+	"sbs":      1, // Side by side, for 3D TVs
+	"tb":       2, // Top and bottom, for 3D TVs
+}
+
+// stereoRenderer renders the scene once per eye and combines the views.
+type stereoRenderer struct {
+	mode       int32
+	separation float32 // Distance between the eyes, in scene units
+	bitDepth   int
+	program    uint32
+	modeLoc    int32
+	fbos       [2]uint32 // Left and right eye
+	textures   [2]uint32
+	width      int
+	height     int
+}
+
+// SetStereo renders each frame as two eye views combined for a stereo display
+// mode (see StereoModes). Shaders choose the eye by declaring either of
+//
+//	uniform float iEye;       // -1 for the left eye, 1 for the right, 0 without stereo
+//	uniform float iEyeOffset; // iEye * separation / 2
+//
+// and moving their camera sideways by iEyeOffset. Buffer passes that declare
+// neither are rendered once per frame, for the left eye.
+func (r *Renderer) SetStereo(mode string, separation float64) error {
+	m, ok := StereoModes[mode]
+	if !ok {
+		return fmt.Errorf("unknown stereo mode '%s'", mode)
+	}
+	s := &stereoRenderer{mode: m, separation: float32(separation), bitDepth: r.offscreenRenderer.bitDepth}
+	var err error
+	s.program, err = newProgram(shader.GenerateVertexShader(r.isGLES()), shader.GetStereoFragmentShader(r.isGLES()))
+	if err != nil {
+		return fmt.Errorf("failed to create stereo program: %w", err)
+	}
+	gl.UseProgram(s.program)
+	gl.Uniform1i(gl.GetUniformLocation(s.program, gl.Str("u_left\x00")), 0)
+	gl.Uniform1i(gl.GetUniformLocation(s.program, gl.Str("u_right\x00")), 1)
+	s.modeLoc = gl.GetUniformLocation(s.program, gl.Str("u_mode\x00"))
+	gl.UseProgram(0)
+
+	gl.GenFramebuffers(2, &s.fbos[0])
+	gl.GenTextures(2, &s.textures[0])
+	for i := range s.fbos {
+		gl.BindTexture(gl.TEXTURE_2D, s.textures[i])
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	}
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+
+	r.stereo = s
+	if r.activeScene != nil {
+		warnIfMonoScene(r.activeScene)
+	}
+	return nil
+}
+
+// resize sizes the eye views to width x height.
+func (s *stereoRenderer) resize(width, height int) error {
+	if width == s.width && height == s.height {
+		return nil
+	}
+	internalFormat, pixelType := int32(gl.RGBA8), uint32(gl.UNSIGNED_BYTE)
+	if s.bitDepth > 8 {
+		internalFormat, pixelType = gl.RGBA16F, gl.FLOAT
+	}
+	for i := range s.fbos {
+		gl.BindTexture(gl.TEXTURE_2D, s.textures[i])
+		gl.TexImage2D(gl.TEXTURE_2D, 0, internalFormat, int32(width), int32(height), 0, gl.RGBA, pixelType, nil)
+		gl.BindFramebuffer(gl.FRAMEBUFFER, s.fbos[i])
+		gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, s.textures[i], 0)
+		if gl.CheckFramebufferStatus(gl.FRAMEBUFFER) != gl.FRAMEBUFFER_COMPLETE {
+			gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+			return fmt.Errorf("stereo eye fbo is not complete")
+		}
+	}
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	s.width, s.height = width, height
+	return nil
+}
+
+// renderStereo renders both eyes and combines them into the offscreen FBO.
+func (r *Renderer) renderStereo(uniforms *inputs.Uniforms, width, height int) {
+	s := r.stereo
+	if err := s.resize(width, height); err != nil {
+		log.Printf("Warning: %v; rendering without stereo", err)
+		r.renderPasses(uniforms, width, height, r.offscreenRenderer.fbo, true)
+		return
+	}
+	// Buffers that don't depend on the eye are rendered once, with the left
+	// eye. Those that do keep a feedback state per eye, so each renders once
+	// per eye and frame and never reads the other eye's.
+	for eye, sign := range []float32{-1, 1} {
+		if err := r.setBufferEye(eye); err != nil {
+			log.Printf("Warning: %v; the right eye shares the left eye's buffers", err)
+			r.setBufferEye(0)
+			break
+		}
+		uniforms.Eye = sign
+		uniforms.EyeOffset = sign * s.separation / 2
+		r.renderPasses(uniforms, width, height, s.fbos[eye], eye == 0)
+	}
+	r.setBufferEye(0)
+	uniforms.Eye, uniforms.EyeOffset = 0, 0
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, r.offscreenRenderer.fbo)
+	gl.UseProgram(s.program)
+	gl.Uniform1i(s.modeLoc, s.mode)
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, s.textures[0])
+	gl.ActiveTexture(gl.TEXTURE1)
+	gl.BindTexture(gl.TEXTURE_2D, s.textures[1])
+	gl.Viewport(0, 0, int32(width), int32(height))
+	gl.BindVertexArray(r.quadVAO)
+	gl.DrawArrays(gl.TRIANGLES, 0, 6)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+}
+
+// setBufferEye switches the buffers of the passes that depend on the eye to
+// the contents of eye.
+func (r *Renderer) setBufferEye(eye int) error {
+	for _, pass := range r.activeScene.BufferPasses {
+		if pass.Buffer != nil && pass.usesEye() {
+			if err := pass.Buffer.SetEye(eye); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// usesEye reports whether a pass declares iEye or iEyeOffset.
+func (pass *RenderPass) usesEye() bool {
+	return pass.iEyeLoc != -1 || pass.iEyeOffsetLoc != -1
+}
+
+// warnIfMonoScene warns that a scene renders the same view for both eyes.
+func warnIfMonoScene(scene *Scene) {
+	if scene.ImagePass != nil && scene.ImagePass.usesEye() {
+		return
+	}
+	for _, pass := range scene.BufferPasses {
+		if pass.usesEye() {
+			return
+		}
+	}
+	log.Printf("Warning: shader '%s' declares neither iEye nor iEyeOffset; both eyes see the same view", scene.Title)
+}
+
+func (s *stereoRenderer) destroy() {
+	gl.DeleteProgram(s.program)
+	gl.DeleteFramebuffers(2, &s.fbos[0])
+	gl.DeleteTextures(2, &s.textures[0])
+}
@@ -0,0 +1,29 @@
+package renderer
+
+import (
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	inputs "github.com/richinsley/goshadertoy/inputs"
+)
+
+// RenderStill renders frames frames of the active scene from time zero at a
+// fixed frame rate, as record mode does, and returns the last one as RGBA
+// floats, bottom row first. The result depends only on the scene and the GL
+// implementation, so renders of different contexts can be compared.
+func (r *Renderer) RenderStill(frames int, fps float64) []float32 {
+	timeStep := 1.0 / fps
+	for i := 0; i < max(1, frames); i++ {
+		r.RenderFrame(&inputs.Uniforms{
+			Time:      float32(float64(i) * timeStep),
+			TimeExact: float64(i) * timeStep,
+			TimeDelta: float32(timeStep),
+			FrameRate: float32(fps),
+			Frame:     int32(i),
+		})
+	}
+
+	pixels := make([]float32, r.width*r.height*4)
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, r.offscreenRenderer.fbo)
+	gl.ReadPixels(0, 0, int32(r.width), int32(r.height), gl.RGBA, gl.FLOAT, gl.Ptr(pixels))
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+	return pixels
+}
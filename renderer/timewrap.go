@@ -0,0 +1,40 @@
+package renderer
+
+import (
+	"math"
+
+	inputs "github.com/richinsley/goshadertoy/inputs"
+)
+
+// SetTimeWrap makes iTime wrap back to 0 every period seconds, so that
+// installations running for days keep it small enough for float32 to step
+// smoothly: at a day of iTime its steps are about 8 ms. Shaders whose
+// animation repeats with a period that divides it continue seamlessly across
+// the wrap. 0 never wraps.
+//
+// Shaders that need the unwrapped time can instead declare
+//
+//	uniform vec2 iTime64; // The whole seconds and fraction of iTime
+//
+// The fraction keeps float32's precision however long it runs; the whole
+// seconds are exact up to 2^24 s, about 194 days.
+func (r *Renderer) SetTimeWrap(period float64) {
+	r.timeWrap = period
+}
+
+// preciseTime wraps the frame's iTime and splits it into iTime64.
+func (r *Renderer) preciseTime(uniforms *inputs.Uniforms) {
+	t := uniforms.TimeExact
+	if t == 0 {
+		t = float64(uniforms.Time)
+	}
+	if r.timeWrap > 0 {
+		t = math.Mod(t, r.timeWrap)
+		if t < 0 {
+			t += r.timeWrap
+		}
+		uniforms.Time = float32(t)
+	}
+	whole := math.Floor(t)
+	uniforms.Time64 = [2]float32{float32(whole), float32(t - whole)}
+}
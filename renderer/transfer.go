@@ -0,0 +1,92 @@
+package renderer
+
+import (
+	"fmt"
+	"log"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	shader "github.com/richinsley/goshadertoy/shader"
+)
+
+// Transfers are the output transfers, how the shader's colors are encoded
+// for display and encoding:
+//
+//   - shadertoy: the colors are already encoded and are used as they are,
+//     as Shadertoy's WebGL canvas presents them
+//   - srgb: the colors are linear light, encoded with the sRGB curve
+//   - gamma2.2: the colors are linear light, encoded with a pure 2.2 gamma,
+//     as most displays decode
+//
+// Every output sees the same encoded frame: the window, the YUV conversion
+// of every bit depth, screenshots and shared textures.
+var Transfers = map[string]int32{"shadertoy": 0, "srgb": 1, "gamma2.2": 2}
+
+// transferRenderer encodes the frame for its output transfer. The encoded
+// frame is drawn into a scratch texture and copied back, as the LUT is.
+type transferRenderer struct {
+	program     uint32
+	transferLoc int32
+	transfer    int32
+	scratch     postTarget
+}
+
+// SetTransfer sets the Transfers entry the rendered frames are encoded with,
+// after post-processing and before the color grade and overlay.
+func (r *Renderer) SetTransfer(mode string) error {
+	t, ok := Transfers[mode]
+	if !ok {
+		return fmt.Errorf("unknown transfer '%s'", mode)
+	}
+	if t == 0 {
+		if r.transfer != nil {
+			r.transfer.destroy()
+			r.transfer = nil
+		}
+		return nil
+	}
+
+	program, err := newProgram(shader.GenerateVertexShader(r.isGLES()), shader.GetTransferFragmentShader(r.isGLES()))
+	if err != nil {
+		return fmt.Errorf("failed to create transfer program: %w", err)
+	}
+	tr := &transferRenderer{program: program, transfer: t}
+	gl.UseProgram(program)
+	gl.Uniform1i(gl.GetUniformLocation(program, gl.Str("u_texture\x00")), 0)
+	tr.transferLoc = gl.GetUniformLocation(program, gl.Str("u_transfer\x00"))
+	gl.UseProgram(0)
+
+	if r.transfer != nil {
+		r.transfer.destroy()
+	}
+	r.transfer = tr
+	if r.recordMode && r.offscreenRenderer.bitDepth == 8 {
+		log.Printf("Warning: linear output is stored in 8 bits before it is encoded, which bands in the shadows; use -bitdepth 10")
+	}
+	return nil
+}
+
+// renderTransfer encodes the width x height frame in the offscreen FBO.
+func (r *Renderer) renderTransfer(width, height int) {
+	t := r.transfer
+	t.scratch.resize(width, height)
+	gl.UseProgram(t.program)
+	gl.BindVertexArray(r.quadVAO)
+	gl.ActiveTexture(gl.TEXTURE0)
+
+	gl.Uniform1i(t.transferLoc, t.transfer)
+	t.scratch.draw(r.offscreenRenderer.textureID)
+	gl.Uniform1i(t.transferLoc, 0)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, r.offscreenRenderer.fbo)
+	gl.Viewport(0, 0, int32(width), int32(height))
+	gl.BindTexture(gl.TEXTURE_2D, t.scratch.texture)
+	gl.DrawArrays(gl.TRIANGLES, 0, 6)
+
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.UseProgram(0)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+}
+
+func (t *transferRenderer) destroy() {
+	gl.DeleteProgram(t.program)
+	t.scratch.destroy()
+}
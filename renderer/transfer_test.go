@@ -0,0 +1,261 @@
+package renderer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"runtime"
+	"testing"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	audio "github.com/richinsley/goshadertoy/audio"
+	headless "github.com/richinsley/goshadertoy/headless"
+	sink "github.com/richinsley/goshadertoy/sink"
+)
+
+// encodeTransfer is the Transfers entry mode applied to linear l, mirrored
+// for negative values as in the transfer shader.
+func encodeTransfer(mode string, l float64) float64 {
+	a := math.Abs(l)
+	switch mode {
+	case "srgb": // IEC 61966-2-1
+		if a <= 0.0031308 {
+			a *= 12.92
+		} else {
+			a = 1.055*math.Pow(a, 1/2.4) - 0.055
+		}
+	case "gamma2.2":
+		a = math.Pow(a, 1/2.2)
+	}
+	return math.Copysign(a, l)
+}
+
+// referenceYCbCr returns the BT.709 limited range codes of R'G'B' at
+// bitDepth, derived from the luma coefficients rather than the shader's
+// matrix.
+func referenceYCbCr(rgb [3]float64, bitDepth int) [3]int {
+	const kr, kb = 0.2126, 0.0722
+	r, g, b := rgb[0], rgb[1], rgb[2]
+	y := kr*r + (1-kr-kb)*g + kb*b
+	cb := (b - y) / (2 * (1 - kb))
+	cr := (r - y) / (2 * (1 - kr))
+	s := float64(int(1) << (bitDepth - 8))
+	quantize := func(v, scale, offset, max float64) int {
+		return int(math.Round(math.Max(16*s, math.Min((v*scale+offset)*s, max*s))))
+	}
+	return [3]int{quantize(y, 219, 16, 235), quantize(cb, 224, 128, 240), quantize(cr, 224, 128, 240)}
+}
+
+func TestTransfers(t *testing.T) {
+	// The codes are those of the transfer shader's u_transfer.
+	tests := []struct {
+		mode string
+		code int32
+		ok   bool
+	}{
+		{"shadertoy", 0, true},
+		{"srgb", 1, true},
+		{"gamma2.2", 2, true},
+		{"sRGB", 0, false},
+		{"linear", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		code, ok := Transfers[tt.mode]
+		if ok != tt.ok || code != tt.code {
+			t.Errorf("Transfers[%q] = %d, %v, want %d, %v", tt.mode, code, ok, tt.code, tt.ok)
+		}
+	}
+	if len(Transfers) != 3 {
+		t.Errorf("Transfers has %d entries, want 3", len(Transfers))
+	}
+}
+
+func TestTransferReference(t *testing.T) {
+	tests := []struct {
+		mode string
+		in   float64
+		want float64
+	}{
+		{"shadertoy", 0.18, 0.18},
+		{"shadertoy", -0.5, -0.5},
+		{"srgb", 0, 0},
+		{"srgb", 0.0031308, 0.04045},
+		{"srgb", 0.002, 0.02584},
+		{"srgb", 0.18, 0.46135},
+		{"srgb", 0.5, 0.73536},
+		{"srgb", 1, 1},
+		{"srgb", -0.18, -0.46135},
+		{"gamma2.2", 0.18, 0.45865},
+		{"gamma2.2", 0.5, 0.72974},
+		{"gamma2.2", 1, 1},
+	}
+	for _, tt := range tests {
+		if got := encodeTransfer(tt.mode, tt.in); math.Abs(got-tt.want) > 1e-4 {
+			t.Errorf("encodeTransfer(%q, %g) = %.5f, want %.5f", tt.mode, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReferenceYCbCr(t *testing.T) {
+	// Published BT.709 limited range values
+	tests := []struct {
+		name     string
+		rgb      [3]float64
+		bitDepth int
+		want     [3]int
+	}{
+		{"black", [3]float64{0, 0, 0}, 8, [3]int{16, 128, 128}},
+		{"white", [3]float64{1, 1, 1}, 8, [3]int{235, 128, 128}},
+		{"red", [3]float64{1, 0, 0}, 8, [3]int{63, 102, 240}},
+		{"green", [3]float64{0, 1, 0}, 8, [3]int{173, 42, 26}},
+		{"blue", [3]float64{0, 0, 1}, 8, [3]int{32, 240, 118}},
+		{"black", [3]float64{0, 0, 0}, 10, [3]int{64, 512, 512}},
+		{"white", [3]float64{1, 1, 1}, 10, [3]int{940, 512, 512}},
+		{"red", [3]float64{1, 0, 0}, 10, [3]int{250, 409, 960}},
+		{"over white", [3]float64{2, 2, 2}, 10, [3]int{940, 512, 512}},
+	}
+	for _, tt := range tests {
+		if got := referenceYCbCr(tt.rgb, tt.bitDepth); got != tt.want {
+			t.Errorf("%s at %d bits: got %v, want %v", tt.name, tt.bitDepth, got, tt.want)
+		}
+	}
+}
+
+func TestGetFormatForBitDepth(t *testing.T) {
+	// Deeper than 8 bits, every output takes 10-bit codes in 16-bit words.
+	tests := []struct {
+		bitDepth       int
+		internalFormat int32
+		pixelType      uint32
+	}{
+		{8, gl.R8UI, gl.UNSIGNED_BYTE},
+		{10, gl.R16UI, gl.UNSIGNED_SHORT},
+		{12, gl.R16UI, gl.UNSIGNED_SHORT},
+	}
+	for _, tt := range tests {
+		internalFormat, pixelFormat, pixelType := getFormatForBitDepth(tt.bitDepth)
+		if internalFormat != tt.internalFormat || pixelFormat != gl.RED_INTEGER || pixelType != tt.pixelType {
+			t.Errorf("getFormatForBitDepth(%d) = %#x, %#x, %#x, want %#x, %#x, %#x", tt.bitDepth,
+				internalFormat, pixelFormat, pixelType, tt.internalFormat, gl.RED_INTEGER, tt.pixelType)
+		}
+	}
+}
+
+// TestYUVOutput renders colors through the transfer and YUV conversion
+// shaders and checks the codes against the reference, within a code for the
+// shader's rounded matrix and the half float frame.
+func TestYUVOutput(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	colors := [][3]float64{
+		{0, 0, 0}, {1, 1, 1}, {0.18, 0.18, 0.18},
+		{1, 0, 0}, {0, 1, 0}, {0, 0, 1},
+		{0.002, 0.002, 0.002}, // The linear segment of sRGB
+		{2, 2, 2},             // Clipped to white
+		{-0.1, 0.5, 0.25},     // Out of gamut
+	}
+	width := len(colors)
+	ctx, err := headless.NewHeadless(width, 1)
+	if err != nil {
+		t.Skipf("no headless GL context: %v", err)
+	}
+	defer ctx.Shutdown()
+
+	tests := []struct {
+		bitDepth int
+		transfer string
+	}{
+		{8, "shadertoy"},
+		{10, "shadertoy"},
+		{10, "srgb"},
+		{10, "gamma2.2"},
+		{12, "srgb"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d-bit %s", tt.bitDepth, tt.transfer), func(t *testing.T) {
+			r, err := NewRenderer(width, 1, true, tt.bitDepth, 1, audio.NewNullDevice(44100), ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Shutdown()
+			if err := r.SetTransfer(tt.transfer); err != nil {
+				t.Fatal(err)
+			}
+
+			// The frame as the shader renders it. 8-bit frames only hold
+			// 0 to 1 in steps of 1/255.
+			frame := make([]float64, 0, 3*width)
+			for _, c := range colors {
+				for _, v := range c {
+					if tt.bitDepth == 8 {
+						v = math.Round(min(max(v, 0), 1)*255) / 255
+					}
+					frame = append(frame, v)
+				}
+			}
+			gl.BindTexture(gl.TEXTURE_2D, r.offscreenRenderer.textureID)
+			if tt.bitDepth == 8 {
+				pixels := make([]uint8, 0, 4*width)
+				for i, v := range frame {
+					pixels = append(pixels, uint8(math.Round(v*255)))
+					if i%3 == 2 {
+						pixels = append(pixels, 255)
+					}
+				}
+				gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, int32(width), 1, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(pixels))
+			} else {
+				pixels := make([]float32, 0, 4*width)
+				for i := 0; i < len(frame); i += 3 {
+					pixels = append(pixels, float32(frame[i]), float32(frame[i+1]), float32(frame[i+2]), 1)
+				}
+				gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, int32(width), 1, gl.RGBA, gl.FLOAT, gl.Ptr(pixels))
+			}
+			gl.BindTexture(gl.TEXTURE_2D, 0)
+
+			if r.transfer != nil {
+				r.renderTransfer(width, 1)
+			}
+			r.RenderToYUV()
+			gl.BindFramebuffer(gl.FRAMEBUFFER, r.offscreenRenderer.yuvFbo)
+			frames, err := r.offscreenRenderer.readYUVPixels(width, 1)
+			if err == nil {
+				var drained []*sink.Frame
+				drained, err = r.offscreenRenderer.drainYUVPixels(width, 1)
+				frames = append(frames, drained...)
+			}
+			gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(frames) != 1 {
+				t.Fatalf("read back %d frames, want 1", len(frames))
+			}
+			defer frames[0].Release()
+
+			pixels := frames[0].Pixels
+			code := func(plane, x int) int {
+				if tt.bitDepth == 8 {
+					return int(pixels[plane*width+x])
+				}
+				return int(binary.LittleEndian.Uint16(pixels[(plane*width+x)*2:]))
+			}
+			codeDepth := min(tt.bitDepth, 10)
+			for x := range colors {
+				var encoded [3]float64
+				for i := range encoded {
+					encoded[i] = encodeTransfer(tt.transfer, frame[3*x+i])
+				}
+				want := referenceYCbCr(encoded, codeDepth)
+				got := [3]int{code(0, x), code(1, x), code(2, x)}
+				for i := range got {
+					if d := got[i] - want[i]; d < -1 || d > 1 {
+						t.Errorf("%v: got %v, want %v", colors[x], got, want)
+						break
+					}
+				}
+			}
+		})
+	}
+}
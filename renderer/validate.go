@@ -0,0 +1,100 @@
+package renderer
+
+import (
+	"fmt"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	api "github.com/richinsley/goshadertoy/api"
+	graphics "github.com/richinsley/goshadertoy/graphics"
+	inputs "github.com/richinsley/goshadertoy/inputs"
+	shader "github.com/richinsley/goshadertoy/shader"
+	xlate "github.com/richinsley/goshadertoy/translator"
+	gst "github.com/richinsley/goshadertranslator"
+)
+
+// PassResult is the outcome of validating one pass of a shader.
+type PassResult struct {
+	Pass string
+	Err  error // nil if the pass translated, compiled and linked
+}
+
+// samplerChannel stands in for an input channel when only its sampler type
+// is needed, so passes can be compiled without loading their inputs.
+type samplerChannel struct {
+	inputs.IChannel
+	samplerType string
+}
+
+func (c samplerChannel) GetSamplerType() string { return c.samplerType }
+
+// ValidateShader translates, compiles and links every pass of shaderArgs,
+// including the sound pass, without creating inputs or rendering. Errors
+// refer to lines of the common or pass code. ctx must be current on the
+// calling thread.
+func ValidateShader(ctx graphics.Context, shaderArgs *api.ShaderArgs) ([]PassResult, error) {
+	if initErr := initGL(ctx); initErr != nil {
+		return nil, fmt.Errorf("failed to initialize OpenGL: %w", initErr)
+	}
+
+	outputFormat := gst.OutputFormatGLSL410
+	if ctx.IsGLES() {
+		outputFormat = gst.OutputFormatESSL
+	}
+	vertexShaderSource := shader.GenerateVertexShader(ctx.IsGLES())
+
+	var results []PassResult
+	if _, ok := shaderArgs.Buffers["image"]; !ok {
+		results = append(results, PassResult{Pass: "image", Err: fmt.Errorf("shader has no image pass")})
+	}
+	for _, name := range []string{"A", "B", "C", "D", "image", "sound"} {
+		passArgs, ok := shaderArgs.Buffers[name]
+		if !ok {
+			continue
+		}
+		channels := validationChannels(passArgs.Inputs)
+		var fullFragmentSource string
+		if name == "sound" {
+			fullFragmentSource = shader.GenerateSoundShaderSource(shaderArgs.CommonCode, passArgs.Code, channels, true)
+		} else {
+			fullFragmentSource = shader.GetFragmentShader(channels, shaderArgs.CommonCode, passArgs.Code)
+		}
+		srcMap := newSourceMap(fullFragmentSource, name, shaderArgs.CommonCode, passArgs.Code, shaderArgs.SourceFiles)
+		err := validateProgram(vertexShaderSource, fullFragmentSource, outputFormat, srcMap)
+		results = append(results, PassResult{Pass: name, Err: err})
+	}
+	return results, nil
+}
+
+func validateProgram(vertexShaderSource, fullFragmentSource string, outputFormat gst.OutputFormat, srcMap *sourceMap) error {
+	translator := xlate.GetTranslator()
+	fsShader, err := translator.TranslateShader(fullFragmentSource, "fragment", gst.ShaderSpecWebGL2, outputFormat)
+	if err != nil {
+		return fmt.Errorf("fragment shader translation failed: %s", srcMap.mapTranslatorLog(err.Error()))
+	}
+	program, err := newProgram(vertexShaderSource, fsShader.Code)
+	if err != nil {
+		return srcMap.mapCompilerError(err, fsShader.Code)
+	}
+	gl.DeleteProgram(program)
+	return nil
+}
+
+// validationChannels returns stand-ins with the sampler types GetChannels
+// would create for the inputs.
+func validationChannels(shaderInputs []*api.ShadertoyChannel) []inputs.IChannel {
+	channels := make([]inputs.IChannel, 4)
+	for _, chInput := range shaderInputs {
+		if chInput == nil || chInput.Channel < 0 || chInput.Channel >= 4 {
+			continue
+		}
+		samplerType := "sampler2D"
+		switch chInput.CType {
+		case "cubemap":
+			samplerType = "samplerCube"
+		case "volume":
+			samplerType = "sampler3D"
+		}
+		channels[chInput.Channel] = samplerChannel{samplerType: samplerType}
+	}
+	return channels
+}
@@ -0,0 +1,149 @@
+package renderer
+
+import (
+	"math"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	inputs "github.com/richinsley/goshadertoy/inputs"
+)
+
+// maxViewZoom limits the virtual resolution of a zoomed view.
+const maxViewZoom = 64
+
+// viewState maps the framebuffer onto a region of a larger virtual frame, to
+// inspect how the image pass renders at a higher resolution. The pass sees
+// the virtual frame's iResolution and the fragCoord and iMouse of the region,
+// so detail sized by the resolution (antialiasing widths, noise octaves)
+// appears as it would in a render of the virtual size.
+type viewState struct {
+	zoom     float64    // Virtual resolution as a multiple of the framebuffer's; 1 or 0 shows the frame
+	offset   [2]float64 // Virtual pixel at the framebuffer's bottom left
+	size     [2]float64 // Framebuffer size the view was last applied to
+	viewport *Viewport  // Fixed region of a canvas shared with other instances; overrides the zoom
+}
+
+// Viewport is the region of a larger canvas an instance shows, e.g. one
+// projector's part of a video wall. X and Y are the region's top left corner
+// in canvas pixels.
+type Viewport struct {
+	X, Y, Width, Height int
+	CanvasWidth         int
+	CanvasHeight        int
+}
+
+// SetViewport renders only vp of the canvas: the image pass sees the canvas's
+// iResolution and the fragCoord of the region, scaled to the framebuffer.
+// Instances showing the regions of a canvas together show all of it, and
+// recordings of the regions stitch into a recording of the canvas. Buffer
+// passes render the whole canvas, so feedback and blurs read the same pixels
+// across the edges of the regions as in a render of the canvas. It must be
+// called before scenes are loaded.
+func (r *Renderer) SetViewport(vp Viewport) {
+	r.view.viewport = &vp
+}
+
+// bufferSize returns the size of the buffer passes when the image pass is
+// width x height: the whole canvas of a viewport, at the same scale.
+func (r *Renderer) bufferSize(width, height int) (int, int) {
+	vp := r.view.viewport
+	if vp == nil {
+		return width, height
+	}
+	return vp.CanvasWidth * width / vp.Width, vp.CanvasHeight * height / vp.Height
+}
+
+// ZoomView multiplies the zoom of the view by factor, keeping the virtual
+// pixel under framebuffer pixel (x, y) in place. It must be called on the
+// render thread.
+func (r *Renderer) ZoomView(factor, x, y float64) {
+	v := &r.view
+	zoom := math.Max(1, math.Min(maxViewZoom, v.currentZoom()*factor))
+	factor = zoom / v.currentZoom()
+	v.offset[0] = (v.offset[0]+x)*factor - x
+	v.offset[1] = (v.offset[1]+y)*factor - y
+	v.zoom = zoom
+	v.clamp()
+}
+
+// PanView moves the view along with a drag of (dx, dy) framebuffer pixels.
+// It must be called on the render thread.
+func (r *Renderer) PanView(dx, dy float64) {
+	r.view.offset[0] -= dx
+	r.view.offset[1] -= dy
+	r.view.clamp()
+}
+
+// ResetView shows the whole frame again. It must be called on the render thread.
+func (r *Renderer) ResetView() {
+	r.view = viewState{size: r.view.size, viewport: r.view.viewport}
+}
+
+// ViewZoom returns the zoom of the view; 1 shows the whole frame.
+func (r *Renderer) ViewZoom() float64 {
+	return r.view.currentZoom()
+}
+
+func (v *viewState) currentZoom() float64 {
+	if v.zoom < 1 {
+		return 1
+	}
+	return v.zoom
+}
+
+// clamp keeps the view within the virtual frame.
+func (v *viewState) clamp() {
+	for i := range v.offset {
+		v.offset[i] = math.Max(0, math.Min(v.size[i]*(v.currentZoom()-1), v.offset[i]))
+	}
+}
+
+// applyView sets the uniforms of the image pass for the view, after
+// updateUniforms. Must be called with the pass program in use.
+func (r *Renderer) applyView(pass *RenderPass, width, height int, uniforms *inputs.Uniforms) {
+	if pass.viewOffsetLoc == -1 {
+		return // Not mapped through fragCoord, e.g. an equirectangular pass
+	}
+	v := &r.view
+	if vp := v.viewport; vp != nil {
+		sx := float64(width) / float64(vp.Width)
+		sy := float64(height) / float64(vp.Height)
+		ox := float32(float64(vp.X) * sx)
+		oy := float32(float64(vp.CanvasHeight-vp.Y-vp.Height) * sy) // fragCoord starts at the bottom
+		gl.Uniform2f(pass.viewOffsetLoc, ox, oy)
+		if pass.resolutionLoc != -1 {
+			gl.Uniform3f(pass.resolutionLoc, float32(float64(vp.CanvasWidth)*sx), float32(float64(vp.CanvasHeight)*sy), 0)
+		}
+		offsetMouse(pass, uniforms, ox, oy)
+		return
+	}
+	if v.size != [2]float64{float64(width), float64(height)} {
+		v.size = [2]float64{float64(width), float64(height)}
+		v.clamp()
+	}
+	zoom := v.currentZoom()
+	ox, oy := float32(v.offset[0]), float32(v.offset[1])
+	gl.Uniform2f(pass.viewOffsetLoc, ox, oy)
+	if zoom == 1 {
+		return
+	}
+
+	if pass.resolutionLoc != -1 {
+		gl.Uniform3f(pass.resolutionLoc, float32(float64(width)*zoom), float32(float64(height)*zoom), 0)
+	}
+	offsetMouse(pass, uniforms, ox, oy)
+}
+
+// offsetMouse moves iMouse from the framebuffer to the virtual frame of the
+// view, whose bottom left is at (ox, oy).
+func offsetMouse(pass *RenderPass, uniforms *inputs.Uniforms, ox, oy float32) {
+	if m := uniforms.Mouse; pass.mouseLoc != -1 && m != [4]float32{} {
+		// The sign of zw encodes the button state.
+		offsetSigned := func(value, offset float32) float32 {
+			if value < 0 {
+				return value - offset
+			}
+			return value + offset
+		}
+		gl.Uniform4f(pass.mouseLoc, m[0]+ox, m[1]+oy, offsetSigned(m[2], ox), offsetSigned(m[3], oy))
+	}
+}
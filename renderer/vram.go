@@ -0,0 +1,165 @@
+package renderer
+
+import (
+	"fmt"
+	"log"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+	inputs "github.com/richinsley/goshadertoy/inputs"
+)
+
+// GPU memory queries of the NVIDIA and AMD extensions, in KiB.
+const (
+	gpuMemoryTotalAvailableNVX   = 0x9048 // GL_GPU_MEMORY_INFO_TOTAL_AVAILABLE_MEMORY_NVX
+	gpuMemoryCurrentAvailableNVX = 0x9049 // GL_GPU_MEMORY_INFO_CURRENT_AVAILABLE_VIDMEM_NVX
+	textureFreeMemoryATI         = 0x87FC // GL_TEXTURE_FREE_MEMORY_ATI
+)
+
+// lowFreeVRAM is the free GPU memory below which rendering likely spills
+// into system memory or fails to allocate.
+const lowFreeVRAM = 64 << 20
+
+// ReportVRAM logs the estimated GPU memory of the textures of every pass of
+// scene and of the renderer's own frames, with the total, and warns if the
+// resolution or the total likely exceeds what the GPU has. It must be called
+// on the render thread.
+func (r *Renderer) ReportVRAM(scene *Scene) {
+	width, height := r.width, r.height
+	if r.offscreenRenderer != nil {
+		width, height = r.offscreenRenderer.width, r.offscreenRenderer.height
+	}
+	log.Printf("Estimated GPU memory of '%s' at %dx%d:", scene.Title, width, height)
+
+	var total int64
+	counted := make(map[inputs.IChannel]bool) // Inputs shared by passes are counted once
+	for _, name := range []string{"A", "B", "C", "D", "image"} {
+		pass, ok := scene.NamedPasses[name]
+		if !ok {
+			continue
+		}
+		passName := "Image"
+		if name != "image" {
+			passName = "Buffer " + name
+		}
+		var passTotal int64
+		if pass.Buffer != nil {
+			passTotal += pass.Buffer.GPUMemory()
+		}
+		var inputLines []string
+		for i, ch := range pass.Channels {
+			if ch == nil {
+				continue
+			}
+			res := ch.ChannelRes()
+			size := fmt.Sprintf("%gx%g", res[0], res[1])
+			if ch.GetSamplerType() == "sampler3D" {
+				size += fmt.Sprintf("x%g", res[2])
+			}
+			if _, isBuffer := ch.(*inputs.Buffer); isBuffer {
+				inputLines = append(inputLines, fmt.Sprintf("    iChannel%d %s %s (pass output)", i, ch.GetCType(), size))
+				continue
+			}
+			if counted[ch] {
+				inputLines = append(inputLines, fmt.Sprintf("    iChannel%d %s %s (counted above)", i, ch.GetCType(), size))
+				continue
+			}
+			counted[ch] = true
+			passTotal += ch.GPUMemory()
+			inputLines = append(inputLines, fmt.Sprintf("    iChannel%d %s %s: %s", i, ch.GetCType(), size, formatBytes(ch.GPUMemory())))
+		}
+		log.Printf("  %s: %s", passName, formatBytes(passTotal))
+		if pass.Buffer != nil {
+			log.Printf("    output RGBA32F x2: %s", formatBytes(pass.Buffer.GPUMemory()))
+		}
+		for _, line := range inputLines {
+			log.Print(line)
+		}
+		total += passTotal
+	}
+
+	frames := r.frameMemory(width, height)
+	log.Printf("  Renderer frames (color, depth, YUV planes, readback PBOs): %s", formatBytes(frames))
+	total += frames
+	log.Printf("  Total: %s", formatBytes(total))
+
+	var maxTexture, maxRenderbuffer int32
+	gl.GetIntegerv(gl.MAX_TEXTURE_SIZE, &maxTexture)
+	gl.GetIntegerv(gl.MAX_RENDERBUFFER_SIZE, &maxRenderbuffer)
+	if limit := min(maxTexture, maxRenderbuffer); limit > 0 && (width > int(limit) || height > int(limit)) {
+		log.Printf("Warning: %dx%d exceeds the GPU's maximum texture size of %d", width, height, limit)
+	}
+
+	totalVRAM, freeVRAM, ok := queryVRAM()
+	switch {
+	case !ok:
+		log.Printf("  Available GPU memory is unknown (needs GL_NVX_gpu_memory_info or GL_ATI_meminfo)")
+	case totalVRAM > 0:
+		log.Printf("  GPU memory: %s free of %s", formatBytes(freeVRAM), formatBytes(totalVRAM))
+	default:
+		log.Printf("  GPU memory: %s free", formatBytes(freeVRAM))
+	}
+	if ok && totalVRAM > 0 && total > totalVRAM {
+		log.Printf("Warning: the estimate of %s exceeds the GPU's %s; lower the resolution or use fewer buffers", formatBytes(total), formatBytes(totalVRAM))
+	} else if ok && freeVRAM < lowFreeVRAM {
+		log.Printf("Warning: only %s of GPU memory is free; rendering may slow down or fail, lower the resolution or use fewer buffers", formatBytes(freeVRAM))
+	}
+}
+
+// frameMemory estimates the memory of the renderer's offscreen color and
+// depth attachments, YUV planes, readback PBOs and stereo eye views.
+func (r *Renderer) frameMemory(width, height int) int64 {
+	or := r.offscreenRenderer
+	pixels := int64(width) * int64(height)
+	colorBytes, planeBytes := int64(4), int64(1)
+	if or.bitDepth > 8 || !r.recordMode { // Live mode resizes to RGBA16F
+		colorBytes = 8
+	}
+	if or.bitDepth > 8 {
+		planeBytes = 2
+	}
+	total := pixels * (colorBytes + 4) // Color and DEPTH_COMPONENT24
+	total += 3 * pixels * planeBytes
+	total += int64(3*len(or.ring)) * pixels * planeBytes
+	if r.stereo != nil {
+		total += 2 * pixels * colorBytes
+	}
+	return total
+}
+
+// queryVRAM returns the total and free GPU memory reported by the driver.
+// total is 0 if the driver only reports free memory; ok is false if it
+// reports neither.
+func queryVRAM() (total, free int64, ok bool) {
+	extensions := glExtensions()
+	switch {
+	case extensions["GL_NVX_gpu_memory_info"]:
+		var totalKiB, freeKiB int32
+		gl.GetIntegerv(gpuMemoryTotalAvailableNVX, &totalKiB)
+		gl.GetIntegerv(gpuMemoryCurrentAvailableNVX, &freeKiB)
+		return int64(totalKiB) << 10, int64(freeKiB) << 10, true
+	case extensions["GL_ATI_meminfo"]:
+		var info [4]int32 // Free, largest free block, free auxiliary, largest auxiliary block
+		gl.GetIntegerv(textureFreeMemoryATI, &info[0])
+		return 0, int64(info[0]) << 10, true
+	}
+	return 0, 0, false
+}
+
+// glExtensions returns the extensions of the current context.
+func glExtensions() map[string]bool {
+	var count int32
+	gl.GetIntegerv(gl.NUM_EXTENSIONS, &count)
+	extensions := make(map[string]bool, count)
+	for i := int32(0); i < count; i++ {
+		extensions[gl.GoStr(gl.GetStringi(gl.EXTENSIONS, uint32(i)))] = true
+	}
+	return extensions
+}
+
+// formatBytes formats n bytes in MiB, or KiB when small.
+func formatBytes(n int64) string {
+	if n < 1<<20 {
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+}
@@ -0,0 +1,76 @@
+package renderer
+
+import (
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	gl "github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// ErrContextLost is returned by Run when the GL context was lost, e.g. to a
+// GPU reset or a restarted compositor. Every GL object is gone with it, so
+// rendering can only go on in a new context.
+var ErrContextLost = errors.New("the GL context was lost")
+
+// glWatchdog watches live rendering for a lost context or a hung frame.
+type glWatchdog struct {
+	resetStatus func() uint32 // The robustness extension's reset query; nil without one
+	lastFrame   atomic.Int64  // UnixNano when the last frame finished
+	timeout     time.Duration
+	onHang      func()
+	done        chan struct{}
+}
+
+// SetWatchdog makes Run return ErrContextLost when the context is lost, and
+// calls onHang from another goroutine when a frame takes longer than timeout,
+// e.g. when the GPU stopped responding; Run can't return then. Contexts only
+// report a GPU reset if they were created with reset notification, as the
+// GLFW and KMS contexts are.
+func (r *Renderer) SetWatchdog(timeout time.Duration, onHang func()) {
+	w := &glWatchdog{timeout: timeout, onHang: onHang, done: make(chan struct{})}
+	switch extensions := glExtensions(); {
+	case extensions["GL_KHR_robustness"]:
+		w.resetStatus = gl.GetGraphicsResetStatusKHR
+	case extensions["GL_ARB_robustness"]:
+		w.resetStatus = gl.GetGraphicsResetStatusARB
+	default:
+		log.Printf("Warning: the GL context can't report GPU resets; only hangs are detected")
+	}
+	w.lastFrame.Store(time.Now().UnixNano())
+	r.watchdog = w
+	go w.watch()
+}
+
+// watch calls onHang once when no frame has finished for timeout.
+func (w *glWatchdog) watch() {
+	ticker := time.NewTicker(w.timeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			if since := time.Since(time.Unix(0, w.lastFrame.Load())); since > w.timeout {
+				log.Printf("No frame has finished for %.1fs; the GPU is hung", since.Seconds())
+				w.onHang()
+				return
+			}
+		}
+	}
+}
+
+// frameDone reports a finished frame, and whether the context was lost.
+func (r *Renderer) frameDone() (lost bool) {
+	w := r.watchdog
+	w.lastFrame.Store(time.Now().UnixNano())
+	if l, ok := r.context.(interface{ ContextLost() bool }); ok && l.ContextLost() {
+		return true
+	}
+	return w.resetStatus != nil && w.resetStatus() != gl.NO_ERROR
+}
+
+func (w *glWatchdog) stop() {
+	close(w.done)
+}
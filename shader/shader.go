@@ -2,6 +2,8 @@ package shader
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 
 	inputs "github.com/richinsley/goshadertoy/inputs"
 )
@@ -17,15 +19,18 @@ void main() {
 }
 `
 
-// YUV conversion with γ-correction + unbiased rounding
+// YUV conversion with unbiased rounding
 const yuvFragmentShaderSourceGL = `#version 410 core
 in  vec2 frag_uv;
 layout(location = 0) out uint y_out;
 layout(location = 1) out uint u_out;
 layout(location = 2) out uint v_out;
 
-uniform sampler2D u_texture;   // linear RGB input
+uniform sampler2D u_texture;   // R'G'B' input
 uniform int       u_bitDepth;  // 8 or 10
+uniform int       u_dither;    // 0 none, 1 triangular, 2 blue noise
+uniform sampler2D u_noise;     // Blue noise, uniform in [0, 1)
+uniform int       u_frame;     // Moves the dither from frame to frame
 
 // BT.709 (R'G'B' -> Y'Cb'Cr')
 // This matrix is constructed with column vectors to match GLSL's column-major memory layout.
@@ -35,44 +40,56 @@ const mat3 RGB_TO_YUV = mat3(
     vec3( 0.0722,  0.5000, -0.0458)  // Column 2
 );
 
-// Linear -> sRGB (BT.709) transfer
-vec3 linearToSRGB(vec3 l)
-{
-    bvec3 cutoff = lessThanEqual(l, vec3(0.0031308));
-    vec3  low    = l * 12.92;
-    vec3  high   = 1.055 * pow(l, vec3(1.0 / 2.4)) - 0.055;
-    return mix(high, low, cutoff);
+// hash returns a uniform random number in [0, 1) for x (PCG3D).
+float hash(uvec3 x) {
+    x = x * 1664525u + 1013904223u;
+    x.x += x.y * x.z; x.y += x.z * x.x; x.z += x.x * x.y;
+    x ^= x >> 16u;
+    x.x += x.y * x.z; x.y += x.z * x.x; x.z += x.x * x.y;
+    return float(x.x) * (1.0 / 4294967296.0);
+}
+
+// dither returns noise with a triangular distribution in (-1, 1), in units
+// of the output's least significant bit, for channel c of this pixel.
+float dither(int c) {
+    int i = u_frame * 3 + c;
+    if (u_dither == 1) {
+        uvec3 x = uvec3(uvec2(gl_FragCoord.xy), uint(i));
+        return hash(x) + hash(x + uvec3(0u, 0u, 0x9E3779B9u)) - 1.0;
+    }
+    // Blue noise, moved along the R2 sequence so frames and channels differ,
+    // and reshaped from uniform to triangular.
+    ivec2 size = textureSize(u_noise, 0);
+    ivec2 offset = ivec2(fract(vec2(0.7548776662, 0.5698402910) * float(i)) * vec2(size));
+    float n = texelFetch(u_noise, (ivec2(gl_FragCoord.xy) + offset) % size, 0).r * 2.0 - 1.0;
+    return sign(n) * (1.0 - sqrt(1.0 - abs(n)));
 }
 
 void main()
 {
     // flip the v coordinate
     vec2 nfrag_uv = vec2(frag_uv.x, 1.0 - frag_uv.y);
-    vec3 rgb_in = texture(u_texture, nfrag_uv).rgb;
-    vec3 rgb_p; // This will hold the sRGB / gamma-corrected value
-
-    if (u_bitDepth > 8) {
-        // For high bit depth, the input texture is linear (e.g., RGBA16F),
-        // so we must convert it to sRGB before the YUV matrix.
-        rgb_p = linearToSRGB(rgb_in);
-    } else {
-        // For 8-bit, the input texture is already sRGB (RGBA8),
-        // so we use its value directly.
-        rgb_p = rgb_in;
-    }
+    // The frame is already transfer-encoded (see GetTransferFragmentShader),
+    // whatever the bit depth of its texture.
+    vec3 rgb_p = texture(u_texture, nfrag_uv).rgb;
 
     // 2) R'G'B' -> Y'Cb'Cr' (Y in [0..1], C in [-0.5..+0.5])
     vec3 yuv = RGB_TO_YUV * rgb_p;
 
-    // 3) quantise to TV-range with unbiased rounding
+    // 3) quantise to TV-range with unbiased rounding, dithered so gradients
+    //    don't band
+    vec3 d = vec3(0.0);
+    if (u_dither != 0) {
+        d = vec3(dither(0), dither(1), dither(2));
+    }
     if (u_bitDepth > 8) {
-        y_out = uint(round(clamp(yuv.x * 876.0 +  64.0,  64.0, 940.0))); // 10-bit
-        u_out = uint(round(clamp(yuv.y * 896.0 + 512.0,  64.0, 960.0)));
-        v_out = uint(round(clamp(yuv.z * 896.0 + 512.0,  64.0, 960.0)));
+        y_out = uint(round(clamp(yuv.x * 876.0 +  64.0 + d.x,  64.0, 940.0))); // 10-bit
+        u_out = uint(round(clamp(yuv.y * 896.0 + 512.0 + d.y,  64.0, 960.0)));
+        v_out = uint(round(clamp(yuv.z * 896.0 + 512.0 + d.z,  64.0, 960.0)));
     } else {
-        y_out = uint(round(clamp(yuv.x * 219.0 +  16.0,  16.0, 235.0))); // 8-bit
-        u_out = uint(round(clamp(yuv.y * 224.0 + 128.0,  16.0, 240.0)));
-        v_out = uint(round(clamp(yuv.z * 224.0 + 128.0,  16.0, 240.0)));
+        y_out = uint(round(clamp(yuv.x * 219.0 +  16.0 + d.x,  16.0, 235.0))); // 8-bit
+        u_out = uint(round(clamp(yuv.y * 224.0 + 128.0 + d.y,  16.0, 240.0)));
+        v_out = uint(round(clamp(yuv.z * 224.0 + 128.0 + d.z,  16.0, 240.0)));
     }
 }
 `
@@ -114,6 +131,9 @@ layout(location = 2) out uint v_out;
 
 uniform sampler2D u_texture;
 uniform int       u_bitDepth;
+uniform int       u_dither;
+uniform sampler2D u_noise;
+uniform int       u_frame;
 
 // BT.709 (R'G'B' -> Y'Cb'Cr')
 // This matrix is constructed with column vectors to match GLSL's column-major memory layout.
@@ -123,42 +143,56 @@ const mat3 RGB_TO_YUV = mat3(
     vec3( 0.0722,  0.5000, -0.0458)  // Column 2
 );
 
-// Linear -> sRGB transfer
-vec3 linearToSRGB(vec3 l) {
-    vec3 low  = 12.92 * l;
-    vec3 high = 1.055 * pow(l, vec3(1.0 / 2.4)) - 0.055;
-    return mix(high, low, step(l, vec3(0.0031308)));
+// hash returns a uniform random number in [0, 1) for x (PCG3D).
+float hash(uvec3 x) {
+    x = x * 1664525u + 1013904223u;
+    x.x += x.y * x.z; x.y += x.z * x.x; x.z += x.x * x.y;
+    x ^= x >> 16u;
+    x.x += x.y * x.z; x.y += x.z * x.x; x.z += x.x * x.y;
+    return float(x.x) * (1.0 / 4294967296.0);
+}
+
+// dither returns noise with a triangular distribution in (-1, 1), in units
+// of the output's least significant bit, for channel c of this pixel.
+float dither(int c) {
+    int i = u_frame * 3 + c;
+    if (u_dither == 1) {
+        uvec3 x = uvec3(uvec2(gl_FragCoord.xy), uint(i));
+        return hash(x) + hash(x + uvec3(0u, 0u, 0x9E3779B9u)) - 1.0;
+    }
+    // Blue noise, moved along the R2 sequence so frames and channels differ,
+    // and reshaped from uniform to triangular.
+    ivec2 size = textureSize(u_noise, 0);
+    ivec2 offset = ivec2(fract(vec2(0.7548776662, 0.5698402910) * float(i)) * vec2(size));
+    float n = texelFetch(u_noise, (ivec2(gl_FragCoord.xy) + offset) % size, 0).r * 2.0 - 1.0;
+    return sign(n) * (1.0 - sqrt(1.0 - abs(n)));
 }
 
 void main()
 {
     // flip the v coordinate
     vec2 nfrag_uv = vec2(frag_uv.x, 1.0 - frag_uv.y);
-    vec3 rgb_in = texture(u_texture, nfrag_uv).rgb;
-    vec3 rgb_p; // This will hold the sRGB / gamma-corrected value
-
-    if (u_bitDepth > 8) {
-        // For high bit depth, the input texture is linear (e.g., RGBA16F),
-        // so we must convert it to sRGB before the YUV matrix.
-        rgb_p = linearToSRGB(rgb_in);
-    } else {
-        // For 8-bit, the input texture is already sRGB (RGBA8),
-        // so we use its value directly.
-        rgb_p = rgb_in;
-    }
+    // The frame is already transfer-encoded (see GetTransferFragmentShader),
+    // whatever the bit depth of its texture.
+    vec3 rgb_p = texture(u_texture, nfrag_uv).rgb;
 
     // 2) R'G'B' -> Y'Cb'Cr' (Y in [0..1], C in [-0.5..+0.5])
     vec3 yuv = RGB_TO_YUV * rgb_p;
 
-    // 3) quantise to TV-range with unbiased rounding
+    // 3) quantise to TV-range with unbiased rounding, dithered so gradients
+    //    don't band
+    vec3 d = vec3(0.0);
+    if (u_dither != 0) {
+        d = vec3(dither(0), dither(1), dither(2));
+    }
     if (u_bitDepth > 8) {
-        y_out = uint(round(clamp(yuv.x * 876.0 +  64.0,  64.0, 940.0))); // 10-bit
-        u_out = uint(round(clamp(yuv.y * 896.0 + 512.0,  64.0, 960.0)));
-        v_out = uint(round(clamp(yuv.z * 896.0 + 512.0,  64.0, 960.0)));
+        y_out = uint(round(clamp(yuv.x * 876.0 +  64.0 + d.x,  64.0, 940.0))); // 10-bit
+        u_out = uint(round(clamp(yuv.y * 896.0 + 512.0 + d.y,  64.0, 960.0)));
+        v_out = uint(round(clamp(yuv.z * 896.0 + 512.0 + d.z,  64.0, 960.0)));
     } else {
-        y_out = uint(round(clamp(yuv.x * 219.0 +  16.0,  16.0, 235.0))); // 8-bit
-        u_out = uint(round(clamp(yuv.y * 224.0 + 128.0,  16.0, 240.0)));
-        v_out = uint(round(clamp(yuv.z * 224.0 + 128.0,  16.0, 240.0)));
+        y_out = uint(round(clamp(yuv.x * 219.0 +  16.0 + d.x,  16.0, 235.0))); // 8-bit
+        u_out = uint(round(clamp(yuv.y * 224.0 + 128.0 + d.y,  16.0, 240.0)));
+        v_out = uint(round(clamp(yuv.z * 224.0 + 128.0 + d.z,  16.0, 240.0)));
     }
 }
 `
@@ -179,8 +213,203 @@ uniform sampler2D u_texture;
 void main() { fragColor = texture(u_texture, frag_uv); }
 `
 
+// hdrBlitFragmentShaderBody presents u_texture, whose 1.0 is SDR white, on an
+// HDR framebuffer: u_mode 0 encodes it as scRGB (linear BT.709, 1.0 is 80
+// nits) and 1 as PQ (SMPTE ST 2084) in BT.2020. u_white is SDR white in nits.
+const hdrBlitFragmentShaderBody = `
+in vec2 frag_uv;
+out vec4 fragColor;
+uniform sampler2D u_texture;
+uniform int u_mode;
+uniform float u_white;
+
+// BT.709 -> BT.2020 primaries, column-major
+const mat3 BT709_TO_BT2020 = mat3(
+    vec3(0.6274, 0.0691, 0.0164), // Column 0
+    vec3(0.3293, 0.9195, 0.0880), // Column 1
+    vec3(0.0433, 0.0114, 0.8956)  // Column 2
+);
+
+// sRGB -> linear, extended past 0 and 1 by mirroring and the power curve
+vec3 srgbToLinear(vec3 c) {
+    vec3 a = abs(c);
+    vec3 l = mix(pow((a + 0.055) / 1.055, vec3(2.4)), a / 12.92, step(a, vec3(0.04045)));
+    return sign(c) * l;
+}
+
+// Absolute luminance in nits -> PQ
+vec3 pq(vec3 nits) {
+    vec3 y = pow(clamp(nits / 10000.0, 0.0, 1.0), vec3(0.1593017578125));
+    return pow((0.8359375 + 18.8515625 * y) / (1.0 + 18.6875 * y), vec3(78.84375));
+}
+
+void main() {
+    vec4 c = texture(u_texture, frag_uv);
+    vec3 l = srgbToLinear(c.rgb);
+    if (u_mode == 0) {
+        fragColor = vec4(l * (u_white / 80.0), c.a);
+    } else {
+        fragColor = vec4(pq(max(BT709_TO_BT2020 * l, 0.0) * u_white), c.a);
+    }
+}
+`
+
+// stereoFragmentShaderBody combines the eye views of a stereo display mode:
+// 0 is a half-color red-cyan anaglyph, 1 side by side and 2 top and bottom,
+// each view squeezed into its half as 3D TVs expect.
+const stereoFragmentShaderBody = `
+in vec2 frag_uv;
+out vec4 fragColor;
+uniform sampler2D u_left;
+uniform sampler2D u_right;
+uniform int u_mode;
+void main() {
+    if (u_mode == 0) {
+        vec3 l = texture(u_left, frag_uv).rgb;
+        vec3 r = texture(u_right, frag_uv).rgb;
+        fragColor = vec4(dot(l, vec3(0.299, 0.587, 0.114)), r.g, r.b, 1.0);
+    } else if (u_mode == 1) {
+        vec2 uv = vec2(fract(frag_uv.x * 2.0), frag_uv.y);
+        fragColor = frag_uv.x < 0.5 ? texture(u_left, uv) : texture(u_right, uv);
+    } else {
+        vec2 uv = vec2(frag_uv.x, fract(frag_uv.y * 2.0));
+        fragColor = frag_uv.y >= 0.5 ? texture(u_left, uv) : texture(u_right, uv);
+    }
+}
+`
+
+// transferFragmentShaderBody encodes u_texture, linear light, for display:
+// u_transfer 1 with the sRGB curve and 2 with a pure 2.2 gamma. 0 copies it.
+// Negative values, from wide-gamut or HDR content, are encoded mirrored.
+const transferFragmentShaderBody = `
+in vec2 frag_uv;
+out vec4 fragColor;
+uniform sampler2D u_texture;
+uniform int u_transfer;
+
+// Linear -> sRGB (IEC 61966-2-1)
+vec3 linearToSRGB(vec3 l) {
+    vec3 low  = 12.92 * l;
+    vec3 high = 1.055 * pow(l, vec3(1.0 / 2.4)) - 0.055;
+    return mix(high, low, step(l, vec3(0.0031308)));
+}
+
+void main() {
+    vec4 c = texture(u_texture, frag_uv);
+    vec3 a = abs(c.rgb);
+    if (u_transfer == 1) {
+        c.rgb = sign(c.rgb) * linearToSRGB(a);
+    } else if (u_transfer == 2) {
+        c.rgb = sign(c.rgb) * pow(a, vec3(1.0 / 2.2));
+    }
+    fragColor = c;
+}
+`
+
+// lutFragmentShaderBody grades u_texture through the 3D LUT u_lut, whose
+// input domain is u_domainMin to u_domainMax, or copies it if u_grade is 0.
+const lutFragmentShaderBody = `
+in vec2 frag_uv;
+out vec4 fragColor;
+uniform sampler2D u_texture;
+uniform mediump sampler3D u_lut;
+uniform vec3 u_domainMin;
+uniform vec3 u_domainMax;
+uniform float u_size;
+uniform int u_grade;
+void main() {
+    vec4 c = texture(u_texture, frag_uv);
+    if (u_grade == 0) {
+        fragColor = c;
+        return;
+    }
+    vec3 x = clamp((c.rgb - u_domainMin) / (u_domainMax - u_domainMin), 0.0, 1.0);
+    // Sample the centers of the first and last texels at the domain's ends.
+    fragColor = vec4(texture(u_lut, (x * (u_size - 1.0) + 0.5) / u_size).rgb, c.a);
+}
+`
+
+// postFragmentShaderBody runs the stages of the post-processing chain on
+// u_texture: 0 copies it, 1 keeps what is brighter than u_threshold, 2 blurs
+// it along u_direction, and 3 adds the bloom in u_bloom, chromatic
+// aberration, vignetting and film grain.
+const postFragmentShaderBody = `
+in vec2 frag_uv;
+out vec4 fragColor;
+uniform sampler2D u_texture;
+uniform sampler2D u_bloom;
+uniform int u_stage;
+uniform vec2 u_direction;
+uniform float u_threshold;
+uniform float u_bloomAmount;
+uniform float u_aberration;
+uniform float u_vignette;
+uniform float u_grain;
+uniform float u_seed;
+uniform vec2 u_resolution;
+
+float hash(vec3 p) {
+    p = fract(p * 0.1031);
+    p += dot(p, p.zyx + 31.32);
+    return fract((p.x + p.y) * p.z);
+}
+
+void main() {
+    if (u_stage == 0) {
+        fragColor = texture(u_texture, frag_uv);
+        return;
+    }
+    if (u_stage == 1) {
+        vec3 c = texture(u_texture, frag_uv).rgb;
+        float l = max(c.r, max(c.g, c.b));
+        fragColor = vec4(c * max(l - u_threshold, 0.0) / max(l, 1e-4), 1.0);
+        return;
+    }
+    if (u_stage == 2) {
+        // 9-tap Gaussian from 5 bilinear fetches
+        vec3 c = texture(u_texture, frag_uv).rgb * 0.2270270270;
+        c += (texture(u_texture, frag_uv + u_direction * 1.3846153846).rgb +
+              texture(u_texture, frag_uv - u_direction * 1.3846153846).rgb) * 0.3162162162;
+        c += (texture(u_texture, frag_uv + u_direction * 3.2307692308).rgb +
+              texture(u_texture, frag_uv - u_direction * 3.2307692308).rgb) * 0.0702702703;
+        fragColor = vec4(c, 1.0);
+        return;
+    }
+
+    vec2 d = frag_uv - 0.5;
+    vec4 c = texture(u_texture, frag_uv);
+    if (u_aberration > 0.0) {
+        c.r = texture(u_texture, frag_uv + d * u_aberration).r;
+        c.b = texture(u_texture, frag_uv - d * u_aberration).b;
+    }
+    c.rgb += texture(u_bloom, frag_uv).rgb * u_bloomAmount;
+    d.x *= u_resolution.x / u_resolution.y;
+    c.rgb *= mix(1.0, smoothstep(1.0, 0.25, length(d)), u_vignette);
+    if (u_grain > 0.0) {
+        vec3 p = vec3(gl_FragCoord.xy, u_seed);
+        c.rgb += (hash(p) + hash(p + 17.0) - 1.0) * u_grain;
+    }
+    fragColor = c;
+}
+`
+
+// overlayFragmentShaderBody draws a premultiplied overlay image, whose first
+// row is its top, faded by u_opacity.
+const overlayFragmentShaderBody = `
+in vec2 frag_uv;
+out vec4 fragColor;
+uniform sampler2D u_overlay;
+uniform float u_opacity;
+void main() {
+    fragColor = texture(u_overlay, vec2(frag_uv.x, 1.0 - frag_uv.y)) * u_opacity;
+}
+`
+
 // GenerateSoundShaderSource creates the full WebGL source for a sound shader.
-func GenerateSoundShaderSource(commonCode, soundShader string, channels []inputs.IChannel) string {
+// With floatOutput, it writes the left and right samples as floats to the red
+// and green channels; otherwise it packs them into 16 bits per channel, two
+// bytes each, as Shadertoy does for an RGBA8 target.
+func GenerateSoundShaderSource(commonCode, soundShader string, channels []inputs.IChannel, floatOutput bool) string {
 	// The preamble includes all standard uniforms a sound shader might need.
 	preamble := `#version 300 es
 precision highp float;
@@ -214,24 +443,48 @@ void main()
     float t = iTimeOffset + ((gl_FragCoord.x-0.5) + (gl_FragCoord.y-0.5)*512.0)/iSampleRate;
     int   s = iSampleOffset + int(gl_FragCoord.y-0.5)*512 + int(gl_FragCoord.x-0.5);
 
-    // Call the user's mainSound function, which might be mainSound(t) or mainSound(s, t)
-    // We will assume the more complex one is available if defined.
-    vec2 y = mainSound( s, t );
+    vec2 y = ` + mainSoundCall(commonCode+"\n"+soundShader) + `;
 
-    vec2 v  = floor((0.5+0.5*y)*65536.0);
+`
+	if floatOutput {
+		mainWrapper += `    outColor = vec4(clamp(y, -1.0, 1.0), 0.0, 1.0);
+}
+`
+	} else {
+		mainWrapper += `    vec2 v  = floor((0.5+0.5*y)*65536.0);
     vec2 vl =   mod(v,256.0)/255.0;
     vec2 vh = floor(v/256.0)/255.0;
     outColor = vec4(vl.x,vh.x,vl.y,vh.y);
 }
 `
+	}
 	// Combine all parts. The user's soundShader string is expected to contain the mainSound function.
-	// We also need to add a dummy mainSound(s,t) if only mainSound(t) is provided.
-	soundShaderCode := soundShader
-	// if !strings.Contains(soundShader, "mainSound( int, float )") {
-	// 	soundShaderCode += "\nvec2 mainSound( int s, float t ) { return mainSound(t); }\n"
-	// }
+	return preamble + commonCode + "\n" + soundShader + "\n" + mainWrapper
+}
 
-	return preamble + commonCode + "\n" + soundShaderCode + "\n" + mainWrapper
+var glslComment = regexp.MustCompile(`(?s)/\*.*?\*/|//[^\n]*`)
+
+// mainSoundDefinition matches a definition of mainSound and captures the type
+// of its first parameter: int for mainSound(int samp, float time), float for
+// the older mainSound(float time).
+var mainSoundDefinition = regexp.MustCompile(`\bvec2\s+mainSound\s*\(\s*(?:(?:in|const|highp|mediump|lowp)\s+)*(int|float)\b[^)]*\)\s*\{`)
+
+// mainSoundCall returns how main calls the mainSound that code defines, with
+// the sample index s and time t. Shaders written before Shadertoy added the
+// sample index only define mainSound(float time); if code defines both, or
+// neither can be found, the current signature is used.
+func mainSoundCall(code string) string {
+	takesTime := false
+	for _, m := range mainSoundDefinition.FindAllStringSubmatch(glslComment.ReplaceAllString(code, ""), -1) {
+		if m[1] == "int" {
+			return "mainSound( s, t )"
+		}
+		takesTime = true
+	}
+	if takesTime {
+		return "mainSound( t )"
+	}
+	return "mainSound( s, t )"
 }
 
 // ────────────────────────────────── Public API ─────────────────────────────────
@@ -250,6 +503,48 @@ func GetYUVFragmentShader(isGLES bool) string {
 	return yuvFragmentShaderSourceGL
 }
 
+func GetHDRBlitFragmentShader(isGLES bool) string {
+	if isGLES {
+		return "#version 300 es\nprecision highp float;\n" + hdrBlitFragmentShaderBody
+	}
+	return "#version 410 core\n" + hdrBlitFragmentShaderBody
+}
+
+func GetStereoFragmentShader(isGLES bool) string {
+	if isGLES {
+		return "#version 300 es\nprecision mediump float;\n" + stereoFragmentShaderBody
+	}
+	return "#version 410 core\n" + stereoFragmentShaderBody
+}
+
+func GetTransferFragmentShader(isGLES bool) string {
+	if isGLES {
+		return "#version 300 es\nprecision highp float;\n" + transferFragmentShaderBody
+	}
+	return "#version 410 core\n" + transferFragmentShaderBody
+}
+
+func GetLUTFragmentShader(isGLES bool) string {
+	if isGLES {
+		return "#version 300 es\nprecision mediump float;\n" + lutFragmentShaderBody
+	}
+	return "#version 410 core\n" + lutFragmentShaderBody
+}
+
+func GetPostFragmentShader(isGLES bool) string {
+	if isGLES {
+		return "#version 300 es\nprecision highp float;\n" + postFragmentShaderBody
+	}
+	return "#version 410 core\n" + postFragmentShaderBody
+}
+
+func GetOverlayFragmentShader(isGLES bool) string {
+	if isGLES {
+		return "#version 300 es\nprecision mediump float;\n" + overlayFragmentShaderBody
+	}
+	return "#version 410 core\n" + overlayFragmentShaderBody
+}
+
 func GetBlitFragmentShader(flip, isGLES bool) string {
 	if isGLES {
 		if flip {
@@ -307,11 +602,16 @@ vec4  fast_tanh(vec4  x) { return FAST_TANH_BODY(x); }
 `
 }
 
+// ViewOffsetUniform shifts fragCoord to the region of a zoomed view; the name
+// keeps it clear of user uniforms.
+const ViewOffsetUniform = "goshadertoyViewOffset"
+
 func GetMain() string {
 	return `
+uniform vec2 ` + ViewOffsetUniform + `;
 void main(void)
 {
-    mainImage(fragColor, gl_FragCoord.xy);
+    mainImage(fragColor, gl_FragCoord.xy + ` + ViewOffsetUniform + `);
 }
 `
 }
@@ -320,3 +620,58 @@ void main(void)
 func GetFragmentShader(ch []inputs.IChannel, common, user string) string {
 	return GeneratePreamble(ch) + common + user + GetMain()
 }
+
+var lowPrecisionQualifier = regexp.MustCompile(`\b(lowp|mediump)\b`)
+
+// ForceHighPrecision makes every float, int and sampler of shader source
+// highp: lowp and mediump qualifiers become highp, and the preamble's default
+// sampler precision covers all sampler types. The translator then declares
+// every variable highp explicitly, so the GLES path computes at the precision
+// desktop GL always uses. Lines keep their numbers.
+func ForceHighPrecision(source string) string {
+	source = lowPrecisionQualifier.ReplaceAllString(source, "highp")
+	return strings.ReplaceAll(source, "precision highp sampler3D;",
+		"precision highp sampler2D; precision highp sampler3D; precision highp samplerCube;")
+}
+
+// rayEntryPoints are the functions taking a ray that equirectangular rendering
+// can call, in order of preference: Shadertoy's VR and cubemap pass entry
+// points, both (out vec4 fragColor, in vec2 fragCoord, in vec3 rayOri, in vec3 rayDir).
+var rayEntryPoints = []string{"mainVR", "mainCubemap"}
+
+var eyeOffsetDeclaration = regexp.MustCompile(`\buniform\s+(?:(?:highp|mediump|lowp)\s+)?float\s+iEyeOffset\b`)
+
+// GetEquirectMain returns a main that renders a 360° equirectangular panorama
+// by calling entry with the ray of each pixel: longitude runs left to right
+// with -Z in the center, latitude bottom to top with +Y up. Ray origins lie on
+// a horizontal circle of radius iEyeOffset, so stereo renders are
+// omnidirectional; declareEye declares iEyeOffset for code that doesn't.
+func GetEquirectMain(entry string, declareEye bool) string {
+	eye := ""
+	if declareEye {
+		eye = "uniform float iEyeOffset;\n"
+	}
+	return "\n" + eye + `void main(void)
+{
+    vec2 uv = gl_FragCoord.xy / iResolution.xy;
+    float lon = (uv.x - 0.5) * 6.283185307179586;
+    float lat = (uv.y - 0.5) * 3.141592653589793;
+    vec3 rayDir = vec3(sin(lon) * cos(lat), sin(lat), -cos(lon) * cos(lat));
+    vec3 rayOri = iEyeOffset * vec3(cos(lon), 0.0, sin(lon));
+    ` + entry + `(fragColor, gl_FragCoord.xy, rayOri, rayDir);
+}
+`
+}
+
+// GetEquirectFragmentShader is GetFragmentShader for an image pass rendered as
+// an equirectangular panorama. The pass or common code must define mainVR or
+// mainCubemap.
+func GetEquirectFragmentShader(ch []inputs.IChannel, common, user string) (string, error) {
+	code := common + user
+	for _, entry := range rayEntryPoints {
+		if regexp.MustCompile(`\bvoid\s+` + entry + `\s*\(`).MatchString(code) {
+			return GeneratePreamble(ch) + code + GetEquirectMain(entry, !eyeOffsetDeclaration.MatchString(code)), nil
+		}
+	}
+	return "", fmt.Errorf("equirectangular rendering needs a shader defining mainVR or mainCubemap")
+}
@@ -0,0 +1,69 @@
+package sink
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Frame represents a single rendered video frame's data, ready for encoding.
+// Frames from a FramePool must be released by whoever holds them.
+type Frame struct {
+	Pixels []byte
+	PTS    int64
+
+	pool *FramePool
+	buf  *[]byte // Pooled buffer of Pixels
+	refs atomic.Int32
+}
+
+// FramePool recycles the pixel buffers of frames of one size, so streaming
+// and recording don't allocate a frame per rendered frame. A pooled frame is
+// reference counted: its producer and every sink holding it past SendVideo
+// own a reference, and the buffer returns to the pool when the last is
+// released.
+type FramePool struct {
+	pool sync.Pool
+}
+
+// NewFramePool creates a pool of frames of size bytes of pixels.
+func NewFramePool(size int) *FramePool {
+	p := &FramePool{}
+	p.pool.New = func() any {
+		buf := make([]byte, size)
+		return &buf
+	}
+	return p
+}
+
+// Get returns a frame with size bytes of pixels, of undefined content, owned
+// by the caller until it calls Release.
+func (p *FramePool) Get(pts int64) *Frame {
+	buf := p.pool.Get().(*[]byte)
+	f := &Frame{Pixels: *buf, PTS: pts, pool: p, buf: buf}
+	f.refs.Store(1)
+	return f
+}
+
+// Retain adds a reference to a pooled frame, for a sink that reads it after
+// SendVideo returns. It does nothing for frames without a pool.
+func (f *Frame) Retain() {
+	if f.pool != nil {
+		f.refs.Add(1)
+	}
+}
+
+// Release drops a reference to a pooled frame; the last returns its pixels to
+// the pool, after which they must not be used. It does nothing for frames
+// without a pool.
+func (f *Frame) Release() {
+	if f.pool == nil {
+		return
+	}
+	switch refs := f.refs.Add(-1); {
+	case refs == 0:
+		f.Pixels = nil
+		f.pool.pool.Put(f.buf)
+	case refs < 0:
+		panic("sink: frame released more often than retained")
+	}
+}
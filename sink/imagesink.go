@@ -0,0 +1,190 @@
+package sink
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+func init() {
+	RegisterSink("images", newImageSink)
+}
+
+// imageSink writes every frame to its own PNG or JPEG file, named by the
+// -output pattern with the frame number, e.g. "frames/%05d.png". PNGs are
+// 16 bits per channel above 8-bit output. Frames are converted and written
+// by a worker per CPU. Audio is discarded.
+type imageSink struct {
+	pattern  string
+	width    int
+	height   int
+	bitDepth int
+	jpeg     bool
+
+	frames  chan *Frame
+	workers sync.WaitGroup
+	written atomic.Int64
+	bytes   atomic.Int64
+
+	mu  sync.Mutex
+	err error // The first failed write
+}
+
+func newImageSink(opts *options.ShaderOptions) (Sink, error) {
+	pattern := *opts.OutputFile
+	if name := fmt.Sprintf(pattern, 0); !strings.Contains(pattern, "%") || strings.Contains(name, "%!") {
+		return nil, fmt.Errorf("image sequence output '%s' needs a frame number verb, e.g. frames/%%05d.png", pattern)
+	}
+	s := &imageSink{
+		pattern:  pattern,
+		width:    *opts.Width,
+		height:   *opts.Height,
+		bitDepth: *opts.BitDepth,
+		frames:   make(chan *Frame, runtime.NumCPU()),
+	}
+	switch ext := strings.ToLower(filepath.Ext(pattern)); ext {
+	case ".png":
+	case ".jpg", ".jpeg":
+		s.jpeg = true
+	default:
+		return nil, fmt.Errorf("unsupported image format '%s' (valid: .png, .jpg)", ext)
+	}
+	if err := os.MkdirAll(filepath.Dir(pattern), 0755); err != nil {
+		return nil, err
+	}
+	for i := 0; i < runtime.NumCPU(); i++ {
+		s.workers.Add(1)
+		go s.work()
+	}
+	log.Printf("Writing frames as images to %s", pattern)
+	return s, nil
+}
+
+func (s *imageSink) work() {
+	defer s.workers.Done()
+	for frame := range s.frames {
+		if s.Err() == nil {
+			if err := s.writeFrame(frame); err != nil {
+				s.mu.Lock()
+				if s.err == nil {
+					s.err = err
+				}
+				s.mu.Unlock()
+			}
+		}
+		frame.Release()
+	}
+}
+
+func (s *imageSink) writeFrame(frame *Frame) error {
+	path := fmt.Sprintf(s.pattern, frame.PTS)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	img := yuvToImage(frame.Pixels, s.width, s.height, s.bitDepth)
+	if s.jpeg {
+		err = jpeg.Encode(f, img, &jpeg.Options{Quality: 95})
+	} else {
+		err = png.Encode(f, img)
+	}
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if info, err := f.Stat(); err == nil {
+		s.bytes.Add(info.Size())
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.written.Add(1)
+	return nil
+}
+
+func (s *imageSink) SendVideo(frame *Frame) {
+	frame.Retain()
+	s.frames <- frame
+}
+
+func (s *imageSink) SendAudio(samples []float32) {}
+func (s *imageSink) CloseAudio()                 {}
+func (s *imageSink) AddChapter(int64, string)    {}
+
+func (s *imageSink) Stats() []Stats {
+	return []Stats{{Output: s.pattern, VideoFrames: s.written.Load(), BytesWritten: s.bytes.Load()}}
+}
+
+func (s *imageSink) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *imageSink) Close() error {
+	close(s.frames)
+	s.workers.Wait()
+	return s.Err()
+}
+
+// yuvToImage converts planar BT.709 limited-range YUV 4:4:4 to an image with
+// 8 bits per channel, or 16 above 8-bit output.
+func yuvToImage(pixels []byte, width, height, bitDepth int) image.Image {
+	planeSize := width * height
+	sample := func(plane, i int) float64 {
+		return float64(pixels[plane*planeSize+i])
+	}
+	scale := 1.0 // Of the 8-bit code values
+	if bitDepth > 8 {
+		planeSize *= 2
+		sample = func(plane, i int) float64 {
+			off := plane*planeSize + i*2
+			return float64(uint16(pixels[off]) | uint16(pixels[off+1])<<8)
+		}
+		scale = 4
+	}
+	rgb := func(i int) (r, g, b float64) {
+		y := (sample(0, i) - 16*scale) / (219 * scale)
+		cb := (sample(1, i) - 128*scale) / (224 * scale)
+		cr := (sample(2, i) - 128*scale) / (224 * scale)
+		return y + 1.5748*cr, y - 0.1873*cb - 0.4681*cr, y + 1.8556*cb
+	}
+	quantize := func(v, top float64) float64 {
+		return min(top, max(0, v*top+0.5))
+	}
+
+	if bitDepth <= 8 {
+		img := image.NewNRGBA(image.Rect(0, 0, width, height))
+		for i := 0; i < width*height; i++ {
+			r, g, b := rgb(i)
+			o := i * 4
+			img.Pix[o] = uint8(quantize(r, 255))
+			img.Pix[o+1] = uint8(quantize(g, 255))
+			img.Pix[o+2] = uint8(quantize(b, 255))
+			img.Pix[o+3] = 255
+		}
+		return img
+	}
+	img := image.NewNRGBA64(image.Rect(0, 0, width, height))
+	for i := 0; i < width*height; i++ {
+		r, g, b := rgb(i)
+		o := i * 8
+		for c, v := range [3]float64{r, g, b} {
+			u := uint16(quantize(v, 65535))
+			img.Pix[o+c*2] = uint8(u >> 8)
+			img.Pix[o+c*2+1] = uint8(u)
+		}
+		img.Pix[o+6], img.Pix[o+7] = 255, 255
+	}
+	return img
+}
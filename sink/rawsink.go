@@ -0,0 +1,130 @@
+package sink
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+func init() {
+	RegisterSink("raw", func(opts *options.ShaderOptions) (Sink, error) { return newPipeSink(opts, false) })
+	RegisterSink("y4m", func(opts *options.ShaderOptions) (Sink, error) { return newPipeSink(opts, true) })
+}
+
+// OpenOutput opens the -output file of a sink for writing, or standard output
+// for "-", which closing leaves open.
+func OpenOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// pipeSink writes the frames uncompressed to a file or standard output, for
+// the user's own tooling: as raw planar YUV 4:4:4 (yuv444p, or yuv444p10le
+// above 8 bits), or as a YUV4MPEG2 stream, which carries the size, rate and
+// format for e.g. "ffmpeg -i -". Audio is discarded.
+type pipeSink struct {
+	output      string
+	out         io.WriteCloser
+	w           *bufio.Writer
+	frameHeader []byte // Written before each frame
+
+	mu     sync.Mutex
+	frames int64
+	bytes  int64
+	err    error
+}
+
+func newPipeSink(opts *options.ShaderOptions, y4m bool) (*pipeSink, error) {
+	out, err := OpenOutput(*opts.OutputFile)
+	if err != nil {
+		return nil, err
+	}
+	s := &pipeSink{output: *opts.OutputFile, out: out, w: bufio.NewWriterSize(out, 1<<20)}
+	format := "yuv444p"
+	if *opts.BitDepth > 8 {
+		format = "yuv444p10le"
+	}
+	if y4m {
+		colorspace := "C444"
+		if *opts.BitDepth > 8 {
+			colorspace = "C444p10"
+		}
+		s.write([]byte(fmt.Sprintf("YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 %s XCOLORRANGE=LIMITED\n", *opts.Width, *opts.Height, *opts.FPS, colorspace)))
+		s.frameHeader = []byte("FRAME\n")
+		format = "YUV4MPEG2 " + format
+	}
+	// A reader can pick up the format before the first frame is complete.
+	if err := s.w.Flush(); err != nil && s.err == nil {
+		s.err = fmt.Errorf("failed to write to %s: %w", s.output, err)
+	}
+	if err := s.Err(); err != nil {
+		out.Close()
+		return nil, err
+	}
+	log.Printf("Writing %dx%d %s frames at %d fps to %s", *opts.Width, *opts.Height, format, *opts.FPS, s.output)
+	return s, nil
+}
+
+// write writes p unless an earlier write failed. Must be called with mu held
+// once the sink is shared.
+func (s *pipeSink) write(p []byte) {
+	if s.err != nil {
+		return
+	}
+	n, err := s.w.Write(p)
+	s.bytes += int64(n)
+	if err != nil {
+		s.err = fmt.Errorf("failed to write to %s: %w", s.output, err)
+	}
+}
+
+func (s *pipeSink) SendVideo(frame *Frame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.write(s.frameHeader)
+	s.write(frame.Pixels)
+	if s.err == nil {
+		s.frames++
+	}
+}
+
+func (s *pipeSink) SendAudio(samples []float32) {}
+func (s *pipeSink) CloseAudio()                 {}
+func (s *pipeSink) AddChapter(int64, string)    {}
+
+func (s *pipeSink) Stats() []Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return []Stats{{Output: s.output, VideoFrames: s.frames, BytesWritten: s.bytes}}
+}
+
+func (s *pipeSink) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *pipeSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		if err := s.w.Flush(); err != nil {
+			s.err = fmt.Errorf("failed to write to %s: %w", s.output, err)
+		}
+	}
+	if err := s.out.Close(); err != nil && s.err == nil {
+		s.err = err
+	}
+	return s.err
+}
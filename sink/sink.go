@@ -0,0 +1,181 @@
+// Package sink defines where record and stream mode send their frames and
+// audio: the Sink interface, the registry of sinks selectable with -sink, and
+// the sinks that need no FFmpeg, which write raw or YUV4MPEG2 video, image
+// sequences or WAV audio. The FFmpeg encoder registers itself from the
+// encoder package.
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	options "github.com/richinsley/goshadertoy/options"
+	preview "github.com/richinsley/goshadertoy/preview"
+)
+
+// Sink consumes rendered video frames and audio. The encoder package's
+// FFmpegEncoder is the main implementation; every kind of sink is registered
+// with RegisterSink, and MultiSink fans one render out to several sinks.
+// Frames are planar BT.709 limited-range YUV 4:4:4, 8-bit or 10-bit
+// little-endian by the bit depth. A sink that
+// reads a frame after SendVideo returns must Retain it, and Release it when
+// done; the caller releases its own reference once SendVideo returns.
+type Sink interface {
+	SendVideo(frame *Frame)
+	SendAudio(samples []float32)
+	CloseAudio()
+	Close() error
+	// Stats reports the progress of every output behind the sink.
+	Stats() []Stats
+	// AddChapter starts a chapter titled title at video frame PTS frame.
+	AddChapter(frame int64, title string)
+	// Err returns the error that stopped the sink, or nil while it is
+	// working. A failed sink discards what it is sent; Close returns the
+	// error as well.
+	Err() error
+}
+
+// MultiSink sends every frame and audio chunk to all of its sinks. Frames and
+// samples are shared, so sinks must treat them as read-only.
+type MultiSink []Sink
+
+func (m MultiSink) SendVideo(frame *Frame) {
+	for _, s := range m {
+		s.SendVideo(frame)
+	}
+}
+
+func (m MultiSink) SendAudio(samples []float32) {
+	for _, s := range m {
+		s.SendAudio(samples)
+	}
+}
+
+func (m MultiSink) CloseAudio() {
+	for _, s := range m {
+		s.CloseAudio()
+	}
+}
+
+func (m MultiSink) AddChapter(frame int64, title string) {
+	for _, s := range m {
+		s.AddChapter(frame, title)
+	}
+}
+
+func (m MultiSink) Stats() []Stats {
+	var stats []Stats
+	for _, s := range m {
+		stats = append(stats, s.Stats()...)
+	}
+	return stats
+}
+
+// Err returns the combined errors of the sinks that have failed.
+func (m MultiSink) Err() error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Err(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every sink and returns the combined errors.
+func (m MultiSink) Close() error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SinkFactory opens a sink writing to the output of opts.
+type SinkFactory func(opts *options.ShaderOptions) (Sink, error)
+
+var sinkFactories = map[string]SinkFactory{}
+
+// RegisterSink makes factory selectable with -sink name.
+func RegisterSink(name string, factory SinkFactory) {
+	sinkFactories[name] = factory
+}
+
+// SinkNames returns the names of the registered sinks, sorted.
+func SinkNames() []string {
+	names := make([]string, 0, len(sinkFactories))
+	for name := range sinkFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ConcatFunc joins segment files with identical stream layouts into output
+// without re-encoding. formatName selects the output container; empty guesses
+// it from the output name.
+type ConcatFunc func(segments []string, output, formatName string) error
+
+var concatSegments ConcatFunc
+
+// RegisterConcat sets the function that joins the segments of a checkpointed
+// recording. The encoder package registers FFmpeg's concat demuxer.
+func RegisterConcat(concat ConcatFunc) {
+	concatSegments = concat
+}
+
+// ConcatSegments joins segments into output with the registered ConcatFunc.
+func ConcatSegments(segments []string, output, formatName string) error {
+	if concatSegments == nil {
+		return errors.New("no sink can join segments in this build")
+	}
+	return concatSegments(segments, output, formatName)
+}
+
+// NewSink opens the -sink selected by opts, plus a feed to pv if it is not
+// nil.
+func NewSink(opts *options.ShaderOptions, pv *preview.MJPEGServer) (Sink, error) {
+	factory, ok := sinkFactories[*opts.Sink]
+	if !ok {
+		return nil, fmt.Errorf("unknown sink '%s' (valid: %s)", *opts.Sink, strings.Join(SinkNames(), ", "))
+	}
+	sink, err := factory(opts)
+	if err != nil {
+		return nil, err
+	}
+	if *opts.AudioOutput != "" {
+		sink = withAudioOutput(sink, opts)
+	}
+	if pv != nil {
+		preview := &previewSink{server: pv, width: *opts.Width, height: *opts.Height, bitDepth: *opts.BitDepth}
+		if multi, ok := sink.(MultiSink); ok {
+			return append(multi, preview), nil
+		}
+		return MultiSink{sink, preview}, nil
+	}
+	return sink, nil
+}
+
+// previewSink feeds rendered frames to the MJPEG preview server.
+type previewSink struct {
+	server   *preview.MJPEGServer
+	width    int
+	height   int
+	bitDepth int
+}
+
+func (p *previewSink) SendVideo(frame *Frame) {
+	frame.Retain()
+	p.server.UpdateYUV(frame.Pixels, p.width, p.height, p.bitDepth, frame.Release)
+}
+
+func (p *previewSink) SendAudio(samples []float32) {}
+func (p *previewSink) CloseAudio()                 {}
+func (p *previewSink) Close() error                { return nil }
+func (p *previewSink) Stats() []Stats              { return nil }
+func (p *previewSink) Err() error                  { return nil }
+func (p *previewSink) AddChapter(int64, string)    {}
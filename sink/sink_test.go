@@ -0,0 +1,146 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+func testOptions(sink, output string, bitDepth int) *options.ShaderOptions {
+	width, height, fps, rate, channels := 4, 2, 30, 48000, 2
+	audioOutput := ""
+	return &options.ShaderOptions{
+		Sink:             &sink,
+		OutputFile:       &output,
+		Width:            &width,
+		Height:           &height,
+		FPS:              &fps,
+		BitDepth:         &bitDepth,
+		AudioOutput:      &audioOutput,
+		AudioSampleRate:  &rate,
+		AudioOutChannels: &channels,
+	}
+}
+
+func TestPipeSinks(t *testing.T) {
+	tests := []struct {
+		sink     string
+		bitDepth int
+		header   string
+		frame    string
+	}{
+		{"raw", 8, "", ""},
+		{"raw", 10, "", ""},
+		{"y4m", 8, "YUV4MPEG2 W4 H2 F30:1 Ip A1:1 C444 XCOLORRANGE=LIMITED\n", "FRAME\n"},
+		{"y4m", 10, "YUV4MPEG2 W4 H2 F30:1 Ip A1:1 C444p10 XCOLORRANGE=LIMITED\n", "FRAME\n"},
+	}
+	for _, tt := range tests {
+		output := filepath.Join(t.TempDir(), "out")
+		opts := testOptions(tt.sink, output, tt.bitDepth)
+		s, err := NewSink(opts, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sink, err)
+		}
+		pool := NewFramePool(4 * 2 * 3 * (tt.bitDepth + 7) / 8)
+		var want bytes.Buffer
+		want.WriteString(tt.header)
+		for i := 0; i < 3; i++ {
+			frame := pool.Get(int64(i))
+			for j := range frame.Pixels {
+				frame.Pixels[j] = byte(i*len(frame.Pixels) + j)
+			}
+			want.WriteString(tt.frame)
+			want.Write(frame.Pixels)
+			s.SendVideo(frame)
+			frame.Release()
+		}
+		if err := s.Close(); err != nil {
+			t.Fatalf("%s: Close: %v", tt.sink, err)
+		}
+		got, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want.Bytes()) {
+			t.Errorf("%s %d-bit: wrote %q, want %q", tt.sink, tt.bitDepth, got, want.Bytes())
+		}
+		if stats := s.Stats(); len(stats) != 1 || stats[0].VideoFrames != 3 || stats[0].BytesWritten != int64(want.Len()) {
+			t.Errorf("%s %d-bit: Stats() = %+v, want 3 frames of %d bytes", tt.sink, tt.bitDepth, stats, want.Len())
+		}
+	}
+}
+
+func TestWAVAudioOutput(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions("raw", filepath.Join(dir, "video"), 8)
+	audioOutput := filepath.Join(dir, "audio.wav")
+	opts.AudioOutput = &audioOutput
+	s, err := NewSink(opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := []float32{0, 0.5, -0.5, 1}
+	s.SendAudio(samples)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(audioOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 44+4*len(samples) {
+		t.Fatalf("wrote %d bytes, want %d", len(data), 44+4*len(samples))
+	}
+	le := binary.LittleEndian
+	fields := []struct {
+		name      string
+		got, want uint32
+	}{
+		{"RIFF size", le.Uint32(data[4:]), uint32(36 + 4*len(samples))},
+		{"format", uint32(le.Uint16(data[20:])), 3},
+		{"channels", uint32(le.Uint16(data[22:])), 2},
+		{"sample rate", le.Uint32(data[24:]), 48000},
+		{"bits per sample", uint32(le.Uint16(data[34:])), 32},
+		{"data size", le.Uint32(data[40:]), uint32(4 * len(samples))},
+	}
+	for _, f := range fields {
+		if f.got != f.want {
+			t.Errorf("%s = %d, want %d", f.name, f.got, f.want)
+		}
+	}
+}
+
+func TestNewSinkUnknown(t *testing.T) {
+	opts := testOptions("nonexistent", filepath.Join(t.TempDir(), "out"), 8)
+	if _, err := NewSink(opts, nil); err == nil {
+		t.Error("NewSink accepted an unknown sink")
+	}
+}
+
+func TestFramePoolRefs(t *testing.T) {
+	pool := NewFramePool(16)
+	frame := pool.Get(7)
+	if len(frame.Pixels) != 16 || frame.PTS != 7 {
+		t.Fatalf("Get(7) = %d bytes at PTS %d, want 16 bytes at PTS 7", len(frame.Pixels), frame.PTS)
+	}
+	frame.Retain()
+	frame.Release()
+	if frame.Pixels == nil {
+		t.Fatal("the first of two releases returned the pixels to the pool")
+	}
+	frame.Release()
+	if frame.Pixels != nil {
+		t.Fatal("the last release kept the pixels")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("releasing a released frame didn't panic")
+		}
+	}()
+	frame.Release()
+}
@@ -0,0 +1,38 @@
+package sink
+
+import (
+	"log"
+	"time"
+)
+
+// Stats reports the progress of one output.
+type Stats struct {
+	Output        string
+	VideoFrames   int64
+	BytesWritten  int64
+	BitrateKbps   float64 // Average over the media duration written so far
+	DroppedFrames int64   // Video frames dropped by the queue or that failed to encode or write
+
+	// Queue of frames waiting for the encoder
+	QueuePolicy  string
+	QueueDepth   int
+	QueueLength  int           // Frames queued now
+	QueuePeak    int           // Most frames queued at once
+	QueueMean    float64       // Frames queued on average when a frame was sent
+	QueueWaits   int64         // Frames that waited for room under the block policy
+	QueueWaited  time.Duration // Summed time those frames waited
+	QueueDropped int64         // Frames dropped under the drop-oldest policy
+}
+
+// LogQueueStats logs how full the encoder queue of every output of sink ran,
+// and warns if rendering often waited for an encoder.
+func LogQueueStats(sink Sink) {
+	for _, s := range sink.Stats() {
+		log.Printf("Encoder queue of %s (%s, depth %d): peak %d frames, %.1f on average; %d frames waited for room, %v in total, %d dropped",
+			s.Output, s.QueuePolicy, s.QueueDepth, s.QueuePeak, s.QueueMean, s.QueueWaits, s.QueueWaited.Round(time.Millisecond), s.QueueDropped)
+		if s.QueueWaits > s.VideoFrames/10 {
+			log.Printf("Warning: rendering waited for the encoder of %s on %d of %d frames; a larger -encode-queue only absorbs bursts, a faster codec or more -encode-threads may help",
+				s.Output, s.QueueWaits, s.VideoFrames)
+		}
+	}
+}
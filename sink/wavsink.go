@@ -0,0 +1,151 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sync"
+
+	options "github.com/richinsley/goshadertoy/options"
+)
+
+const (
+	// wavUnknownSize stands in for the chunk sizes of a WAV file while they
+	// are unknown, and stays there when the output can't be rewound, e.g. a
+	// pipe.
+	wavUnknownSize = math.MaxUint32
+	wavQueue       = 256 // Audio chunks held while the output is not open yet
+)
+
+// wavSink writes the audio as 32-bit float WAV to a file or pipe, next to a
+// sink that only writes video, e.g. a y4m pipe. Video is ignored. The output
+// is opened and written by its own goroutine: opening a named pipe waits for
+// its reader, which may first read the video.
+type wavSink struct {
+	output     string
+	sampleRate int
+	channels   int
+	chunks     chan []float32
+	done       chan struct{}
+
+	mu    sync.Mutex
+	bytes int64 // Of samples written
+	err   error
+}
+
+func newWAVSink(path string, sampleRate, channels int) *wavSink {
+	s := &wavSink{
+		output:     path,
+		sampleRate: sampleRate,
+		channels:   channels,
+		chunks:     make(chan []float32, wavQueue),
+		done:       make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *wavSink) run() {
+	defer close(s.done)
+	out, err := OpenOutput(s.output)
+	if err != nil {
+		s.fail(fmt.Errorf("failed to open audio output %s: %w", s.output, err))
+		for range s.chunks {
+		}
+		return
+	}
+	log.Printf("Writing %d Hz %d-channel float WAV audio to %s", s.sampleRate, s.channels, s.output)
+	w := bufio.NewWriter(out)
+	s.writeHeader(w)
+	for samples := range s.chunks {
+		if s.Err() != nil {
+			continue
+		}
+		if err := binary.Write(w, binary.LittleEndian, samples); err != nil {
+			s.fail(fmt.Errorf("failed to write to %s: %w", s.output, err))
+			continue
+		}
+		s.mu.Lock()
+		s.bytes += int64(len(samples)) * 4
+		s.mu.Unlock()
+	}
+	if err := w.Flush(); err != nil {
+		s.fail(fmt.Errorf("failed to write to %s: %w", s.output, err))
+	}
+	s.fillSizes(out)
+	if err := out.Close(); err != nil {
+		s.fail(err)
+	}
+}
+
+// writeHeader writes the RIFF, fmt and data chunk headers, with unknown
+// sizes.
+func (s *wavSink) writeHeader(w io.Writer) {
+	blockAlign := s.channels * 4
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'}, uint32(wavUnknownSize), [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16),
+		uint16(3), // WAVE_FORMAT_IEEE_FLOAT
+		uint16(s.channels), uint32(s.sampleRate), uint32(s.sampleRate * blockAlign), uint16(blockAlign), uint16(32),
+		[4]byte{'d', 'a', 't', 'a'}, uint32(wavUnknownSize),
+	}
+	for _, v := range header {
+		binary.Write(w, binary.LittleEndian, v)
+	}
+}
+
+// fillSizes fills in the chunk sizes if out is a regular file.
+func (s *wavSink) fillSizes(out io.WriteCloser) {
+	f, ok := out.(*os.File)
+	if !ok || s.Err() != nil || s.bytes > wavUnknownSize-36 {
+		return
+	}
+	if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	if _, err := f.Seek(4, io.SeekStart); err == nil {
+		binary.Write(f, binary.LittleEndian, uint32(36+s.bytes))
+		f.Seek(40, io.SeekStart)
+		binary.Write(f, binary.LittleEndian, uint32(s.bytes))
+	}
+}
+
+func (s *wavSink) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *wavSink) SendAudio(samples []float32) {
+	s.chunks <- samples
+}
+
+func (s *wavSink) SendVideo(frame *Frame)   {}
+func (s *wavSink) CloseAudio()              {}
+func (s *wavSink) AddChapter(int64, string) {}
+func (s *wavSink) Stats() []Stats           { return nil }
+
+func (s *wavSink) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close writes the audio still queued and, for a file, fills in the chunk
+// sizes.
+func (s *wavSink) Close() error {
+	close(s.chunks)
+	<-s.done
+	return s.Err()
+}
+
+// withAudioOutput adds a WAV writer for -audio-output to sink.
+func withAudioOutput(sink Sink, opts *options.ShaderOptions) Sink {
+	return MultiSink{sink, newWAVSink(*opts.AudioOutput, *opts.AudioSampleRate, *opts.AudioOutChannels)}
+}
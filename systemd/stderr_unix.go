@@ -0,0 +1,18 @@
+//go:build !windows
+
+package systemd
+
+import (
+	"os"
+	"syscall"
+)
+
+// stderrIs reports whether standard error is the file with the given device
+// and inode numbers.
+func stderrIs(dev, ino uint64) bool {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(os.Stderr.Fd()), &st); err != nil {
+		return false
+	}
+	return uint64(st.Dev) == dev && uint64(st.Ino) == ino
+}
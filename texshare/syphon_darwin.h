@@ -0,0 +1,13 @@
+#ifndef SYPHON_DARWIN_H
+#define SYPHON_DARWIN_H
+
+void *syphon_server_new(const char *name);
+void syphon_server_publish(void *server, unsigned int texture, int width, int height);
+void syphon_server_free(void *server);
+
+void *syphon_client_new(const char *name);
+int syphon_client_valid(void *client);
+int syphon_client_receive(void *client, unsigned int texture, int *width, int *height);
+void syphon_client_free(void *client);
+
+#endif
@@ -0,0 +1,133 @@
+//go:build syphon
+
+#import <Foundation/Foundation.h>
+#import <OpenGL/OpenGL.h>
+#import <OpenGL/gl3.h>
+#import <Syphon/Syphon.h>
+
+#include "syphon_darwin.h"
+
+void *syphon_server_new(const char *name) {
+    @autoreleasepool {
+        CGLContextObj ctx = CGLGetCurrentContext();
+        if (ctx == NULL) {
+            return NULL;
+        }
+        SyphonOpenGLServer *server = [[SyphonOpenGLServer alloc]
+            initWithName:[NSString stringWithUTF8String:name]
+                 context:ctx
+                 options:nil];
+        return (__bridge_retained void *)server;
+    }
+}
+
+void syphon_server_publish(void *server, unsigned int texture, int width, int height) {
+    @autoreleasepool {
+        SyphonOpenGLServer *s = (__bridge SyphonOpenGLServer *)server;
+        // Frames are rendered bottom-up, as Syphon expects.
+        [s publishFrameTexture:texture
+                 textureTarget:GL_TEXTURE_2D
+                   imageRegion:NSMakeRect(0, 0, width, height)
+             textureDimensions:NSMakeSize(width, height)
+                       flipped:NO];
+    }
+}
+
+void syphon_server_free(void *server) {
+    @autoreleasepool {
+        SyphonOpenGLServer *s = (__bridge_transfer SyphonOpenGLServer *)server;
+        [s stop];
+    }
+}
+
+// syphon_client is a client and the framebuffer used to copy its frames.
+typedef struct {
+    void *client;
+    GLuint fbo;
+} syphon_client;
+
+void *syphon_client_new(const char *name) {
+    @autoreleasepool {
+        CGLContextObj ctx = CGLGetCurrentContext();
+        if (ctx == NULL) {
+            return NULL;
+        }
+        NSString *n = [NSString stringWithUTF8String:name];
+        SyphonServerDirectory *dir = [SyphonServerDirectory sharedDirectory];
+        NSArray *servers = [dir serversMatchingName:n appName:nil];
+        if ([servers count] == 0) {
+            servers = [dir serversMatchingName:nil appName:n];
+        }
+        if ([servers count] == 0) {
+            return NULL;
+        }
+        SyphonOpenGLClient *client = [[SyphonOpenGLClient alloc]
+            initWithServerDescription:[servers firstObject]
+                              context:ctx
+                              options:nil
+                      newFrameHandler:nil];
+        if (client == nil) {
+            return NULL;
+        }
+        syphon_client *c = calloc(1, sizeof(syphon_client));
+        c->client = (__bridge_retained void *)client;
+        glGenFramebuffers(1, &c->fbo);
+        return c;
+    }
+}
+
+int syphon_client_valid(void *client) {
+    syphon_client *c = client;
+    return [(__bridge SyphonOpenGLClient *)c->client isValid] ? 1 : 0;
+}
+
+// syphon_client_receive copies a new frame into texture, resizing it as
+// needed. It returns 0 if there's no new frame.
+int syphon_client_receive(void *client, unsigned int texture, int *width, int *height) {
+    @autoreleasepool {
+        syphon_client *c = client;
+        SyphonOpenGLClient *sc = (__bridge SyphonOpenGLClient *)c->client;
+        if (![sc hasNewFrame]) {
+            return 0;
+        }
+        SyphonOpenGLImage *image = [sc newFrameImage];
+        if (image == nil) {
+            return 0;
+        }
+        int w = (int)image.textureSize.width;
+        int h = (int)image.textureSize.height;
+
+        GLint prevRead, prevTex;
+        glGetIntegerv(GL_READ_FRAMEBUFFER_BINDING, &prevRead);
+        glGetIntegerv(GL_TEXTURE_BINDING_2D, &prevTex);
+
+        // The frame is a rectangle texture; copy it into the 2D texture.
+        glBindTexture(GL_TEXTURE_2D, texture);
+        if (w != *width || h != *height) {
+            glTexImage2D(GL_TEXTURE_2D, 0, GL_RGBA8, w, h, 0, GL_RGBA, GL_UNSIGNED_BYTE, NULL);
+        }
+        glBindFramebuffer(GL_READ_FRAMEBUFFER, c->fbo);
+        glFramebufferTexture2D(GL_READ_FRAMEBUFFER, GL_COLOR_ATTACHMENT0,
+                               GL_TEXTURE_RECTANGLE, image.textureName, 0);
+        glCopyTexSubImage2D(GL_TEXTURE_2D, 0, 0, 0, 0, 0, w, h);
+        glFramebufferTexture2D(GL_READ_FRAMEBUFFER, GL_COLOR_ATTACHMENT0,
+                               GL_TEXTURE_RECTANGLE, 0, 0);
+
+        glBindFramebuffer(GL_READ_FRAMEBUFFER, prevRead);
+        glBindTexture(GL_TEXTURE_2D, prevTex);
+
+        *width = w;
+        *height = h;
+        return 1;
+    }
+}
+
+void syphon_client_free(void *client) {
+    @autoreleasepool {
+        syphon_client *c = client;
+        SyphonOpenGLClient *sc = (__bridge_transfer SyphonOpenGLClient *)c->client;
+        [sc stop];
+        glDeleteFramebuffers(1, &c->fbo);
+        free(c);
+    }
+}
@@ -0,0 +1,16 @@
+// Package texshare shares OpenGL textures with other applications on the
+// same GPU, such as VJ software, through Syphon on macOS. Syphon is a
+// third-party framework, so it's only linked with the syphon build tag:
+//
+//	go build -tags syphon ./cmd
+//
+// Other builds have no texture sharing and every constructor returns an
+// error.
+//
+// A Sender publishes frames under a name; a Receiver copies the frames of a
+// named sender into a texture. Both use the OpenGL context current when they
+// are created, and must only be used with it current.
+package texshare
+
+// Name is the texture sharing framework of the platform, or "" if it has none.
+const Name = frameworkName
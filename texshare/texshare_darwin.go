@@ -0,0 +1,99 @@
+//go:build syphon && cgo
+
+package texshare
+
+/*
+#cgo CFLAGS: -x objective-c -fobjc-arc -Wno-deprecated-declarations
+#cgo LDFLAGS: -framework Foundation -framework OpenGL -framework Syphon
+#include <stdlib.h>
+#include "syphon_darwin.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+const frameworkName = "Syphon"
+
+// Sender publishes frames to other applications as a Syphon server.
+type Sender struct {
+	server unsafe.Pointer
+}
+
+// NewSender starts publishing frames as name.
+func NewSender(name string) (*Sender, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	server := C.syphon_server_new(cname)
+	if server == nil {
+		return nil, fmt.Errorf("failed to create Syphon server '%s'", name)
+	}
+	return &Sender{server: server}, nil
+}
+
+// Send publishes a frame from texture, a width x height GL_TEXTURE_2D.
+func (s *Sender) Send(texture uint32, width, height int) {
+	C.syphon_server_publish(s.server, C.uint(texture), C.int(width), C.int(height))
+}
+
+// Close stops publishing.
+func (s *Sender) Close() {
+	if s.server != nil {
+		C.syphon_server_free(s.server)
+		s.server = nil
+	}
+}
+
+// Receiver copies the frames of a Syphon server into a texture.
+type Receiver struct {
+	name    *C.char
+	client  unsafe.Pointer
+	lastTry time.Time
+	width   int
+	height  int
+}
+
+// NewReceiver receives the frames of the server called name (or of the
+// application called name). The server needn't be running yet.
+func NewReceiver(name string) (*Receiver, error) {
+	return &Receiver{name: C.CString(name)}, nil
+}
+
+// Receive copies the newest frame into texture, a GL_TEXTURE_2D that it
+// resizes to match the server, and returns its size; zero while the server
+// isn't running.
+func (r *Receiver) Receive(texture uint32) (width, height int) {
+	if r.client == nil || C.syphon_client_valid(r.client) == 0 {
+		if r.client != nil {
+			C.syphon_client_free(r.client)
+			r.client = nil
+			r.width, r.height = 0, 0
+		}
+		// Looking up servers is slow; retry about once a second.
+		if time.Since(r.lastTry) < time.Second {
+			return 0, 0
+		}
+		r.lastTry = time.Now()
+		if r.client = C.syphon_client_new(r.name); r.client == nil {
+			return 0, 0
+		}
+	}
+	w, h := C.int(r.width), C.int(r.height)
+	if C.syphon_client_receive(r.client, C.uint(texture), &w, &h) != 0 {
+		r.width, r.height = int(w), int(h)
+	}
+	return r.width, r.height
+}
+
+// Close stops receiving.
+func (r *Receiver) Close() {
+	if r.client != nil {
+		C.syphon_client_free(r.client)
+		r.client = nil
+	}
+	C.free(unsafe.Pointer(r.name))
+	r.name = nil
+}
@@ -0,0 +1,41 @@
+//go:build !(darwin && syphon && cgo)
+
+package texshare
+
+import "fmt"
+
+const frameworkName = ""
+
+var errUnsupported = fmt.Errorf("texture sharing needs a macOS build with the syphon tag")
+
+// Sender publishes frames to other applications.
+type Sender struct{}
+
+// NewSender starts publishing frames as name.
+func NewSender(name string) (*Sender, error) {
+	return nil, errUnsupported
+}
+
+// Send publishes a frame from texture, a width x height GL_TEXTURE_2D.
+func (s *Sender) Send(texture uint32, width, height int) {}
+
+// Close stops publishing.
+func (s *Sender) Close() {}
+
+// Receiver copies the frames of another application into a texture.
+type Receiver struct{}
+
+// NewReceiver receives the frames of the sender called name.
+func NewReceiver(name string) (*Receiver, error) {
+	return nil, errUnsupported
+}
+
+// Receive copies the newest frame into texture, a GL_TEXTURE_2D that it
+// resizes to match the sender, and returns its size; zero while the sender
+// isn't running.
+func (r *Receiver) Receive(texture uint32) (width, height int) {
+	return 0, 0
+}
+
+// Close stops receiving.
+func (r *Receiver) Close() {}
@@ -0,0 +1,151 @@
+package timesource
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	ltcFrameBits  = 80
+	ltcSyncWord   = 0xBFFC // Bits 64 to 79 of a frame, the first in the lowest bit
+	ltcHysteresis = 0.01   // Level a signal must cross to change polarity
+	ltcBitAverage = 0.1    // Weight of each new bit in the bit length estimate
+)
+
+// ltcRates are the nominal frame rates of LTC.
+var ltcRates = []float64{24, 25, 30}
+
+// Timecode is a SMPTE timecode.
+type Timecode struct {
+	Hours, Minutes, Seconds, Frames int
+	DropFrame                       bool // 29.97 fps NTSC drop-frame counting
+}
+
+func (t Timecode) String() string {
+	sep := ":"
+	if t.DropFrame {
+		sep = ";"
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%02d", t.Hours, t.Minutes, t.Seconds, sep, t.Frames)
+}
+
+// LTCFrame is a timecode decoded from an LTC signal.
+type LTCFrame struct {
+	Timecode
+	FPS float64 // Nominal frame rate, from the length of the frame
+	End int64   // Sample after the frame's last bit, counted from the first written
+}
+
+// EndTime returns the time in seconds the frame ends at: the start of the
+// next.
+func (f LTCFrame) EndTime() float64 {
+	return float64(f.Hours*3600+f.Minutes*60+f.Seconds) + float64(f.Frames+1)/f.FPS
+}
+
+// LTCDecoder decodes linear timecode from audio samples. LTC is biphase mark
+// coded: the signal changes polarity at every bit boundary, and in the middle
+// of each 1 bit.
+type LTCDecoder struct {
+	rate     float64
+	positive bool
+	run      int     // Samples since the last polarity change
+	bitLen   float64 // Estimated samples per bit
+	half     bool    // The first half of a 1 bit was seen
+	lo       uint64  // Last 80 bits received; the oldest is bit 0 of lo
+	hi       uint16
+	samples  int64 // Samples written so far
+	lastEnd  int64 // End of the previous frame, or -1
+}
+
+// NewLTCDecoder returns a decoder for audio of sampleRate.
+func NewLTCDecoder(sampleRate int) *LTCDecoder {
+	rate := float64(sampleRate)
+	return &LTCDecoder{rate: rate, bitLen: rate / (ltcFrameBits * 27.5), lastEnd: -1}
+}
+
+// Samples returns the number of samples written so far.
+func (d *LTCDecoder) Samples() int64 {
+	return d.samples
+}
+
+// Write decodes mono samples and returns the frames that ended in them.
+func (d *LTCDecoder) Write(samples []float32) []LTCFrame {
+	var frames []LTCFrame
+	for _, s := range samples {
+		d.samples++
+		d.run++
+		if (d.positive && s > -ltcHysteresis) || (!d.positive && s < ltcHysteresis) {
+			if float64(d.run) > 2.5*d.bitLen {
+				d.half = false // Silence or noise; wait for the signal to return
+			}
+			continue
+		}
+		d.positive = !d.positive
+		run := float64(d.run)
+		d.run = 0
+
+		switch {
+		case run > 2.5*d.bitLen:
+			d.half = false
+		case run > 0.75*d.bitLen: // A whole 0 bit
+			d.bitLen += ltcBitAverage * (run - d.bitLen)
+			d.half = false
+			if f, ok := d.push(0); ok {
+				frames = append(frames, f)
+			}
+		case d.half: // The second half of a 1 bit
+			d.bitLen += ltcBitAverage * (2*run - d.bitLen)
+			d.half = false
+			if f, ok := d.push(1); ok {
+				frames = append(frames, f)
+			}
+		default:
+			d.half = true
+		}
+	}
+	return frames
+}
+
+// push shifts in the next bit and returns the frame it completes, if any.
+func (d *LTCDecoder) push(bit uint64) (LTCFrame, bool) {
+	d.lo = d.lo>>1 | uint64(d.hi&1)<<63
+	d.hi = d.hi>>1 | uint16(bit)<<15
+	if d.hi != ltcSyncWord {
+		return LTCFrame{}, false
+	}
+
+	field := func(start, bits int) int {
+		return int(d.lo>>start) & (1<<bits - 1)
+	}
+	f := LTCFrame{
+		Timecode: Timecode{
+			Frames:    field(8, 2)*10 + field(0, 4),
+			Seconds:   field(24, 3)*10 + field(16, 4),
+			Minutes:   field(40, 3)*10 + field(32, 4),
+			Hours:     field(56, 2)*10 + field(48, 4),
+			DropFrame: field(10, 1) == 1,
+		},
+		End: d.samples,
+	}
+	length := float64(d.samples - d.lastEnd)
+	if d.lastEnd < 0 {
+		length = d.bitLen * ltcFrameBits
+	}
+	d.lastEnd = d.samples
+	f.FPS = nearestRate(d.rate / length)
+	if f.DropFrame {
+		f.FPS = 30000.0 / 1001
+	}
+	return f, true
+}
+
+// nearestRate returns the LTC frame rate closest to fps.
+func nearestRate(fps float64) float64 {
+	best := ltcRates[0]
+	for _, r := range ltcRates[1:] {
+		if math.Abs(r-fps) < math.Abs(best-fps) {
+			best = r
+		}
+	}
+	return best
+}
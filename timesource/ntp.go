@@ -0,0 +1,126 @@
+// Package timesource reads time references shared between machines, so
+// several instances can render the same moment of a shader at once: SMPTE
+// linear timecode (LTC) carried on an audio signal, and the wall clock
+// disciplined by an NTP server.
+package timesource
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ntpEpochOffset = 2208988800 // Seconds from the NTP epoch, 1900, to the Unix epoch
+	ntpTimeout     = 2 * time.Second
+	ntpInterval    = 64 * time.Second // Time between syncs, NTP's shortest default poll interval
+)
+
+// QueryNTP asks an NTP server, as "host" or "host:port", how far the system
+// clock is off from it. Adding the offset to the system time gives the
+// server's.
+func QueryNTP(server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	conn, err := net.DialTimeout("udp", server, ntpTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reach NTP server %s: %w", server, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ntpTimeout))
+
+	request := make([]byte, 48)
+	request[0] = 0x1B // No leap warning, version 3, client mode
+	sent := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		return 0, fmt.Errorf("failed to query NTP server %s: %w", server, err)
+	}
+	response := make([]byte, 48)
+	if _, err := conn.Read(response); err != nil {
+		return 0, fmt.Errorf("no answer from NTP server %s: %w", server, err)
+	}
+	received := time.Now()
+	if mode := response[0] & 7; mode != 4 {
+		return 0, fmt.Errorf("NTP server %s sent mode %d instead of a server reply", server, mode)
+	}
+	if stratum := response[1]; stratum == 0 {
+		return 0, fmt.Errorf("NTP server %s is not synchronized", server)
+	}
+
+	// The offset is the mean of the differences between the server's receive
+	// and transmit times and our send and receive times, cancelling out the
+	// network delay if it is the same both ways.
+	serverReceived := ntpTime(response[32:40])
+	serverSent := ntpTime(response[40:48])
+	return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, nil
+}
+
+// ntpTime decodes a 64-bit NTP timestamp.
+func ntpTime(b []byte) time.Time {
+	seconds := int64(binary.BigEndian.Uint32(b[0:4])) - ntpEpochOffset
+	fraction := int64(binary.BigEndian.Uint32(b[4:8]))
+	return time.Unix(seconds, fraction*int64(time.Second)>>32)
+}
+
+// NTPClock is the system clock corrected by the offset to an NTP server,
+// which it measures again every 64 seconds. Without a server it is the system
+// clock, for machines that an NTP or PTP daemon already keeps in step.
+type NTPClock struct {
+	server string
+	offset atomic.Int64 // time.Duration
+	stop   chan struct{}
+	done   sync.WaitGroup
+}
+
+// NewNTPClock syncs with server and keeps syncing until Close. A server that
+// can't be reached is logged and tried again at the next sync.
+func NewNTPClock(server string) *NTPClock {
+	c := &NTPClock{server: server, stop: make(chan struct{})}
+	if server == "" {
+		return c
+	}
+	c.sync()
+	c.done.Add(1)
+	go func() {
+		defer c.done.Done()
+		ticker := time.NewTicker(ntpInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				c.sync()
+			}
+		}
+	}()
+	return c
+}
+
+func (c *NTPClock) sync() {
+	offset, err := QueryNTP(c.server)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		return
+	}
+	if previous := time.Duration(c.offset.Swap(int64(offset))); previous == 0 {
+		log.Printf("System clock is %v off from NTP server %s", offset, c.server)
+	}
+}
+
+// Now returns the time of the NTP server.
+func (c *NTPClock) Now() time.Time {
+	return time.Now().Add(time.Duration(c.offset.Load()))
+}
+
+// Close stops syncing.
+func (c *NTPClock) Close() error {
+	close(c.stop)
+	c.done.Wait()
+	return nil
+}